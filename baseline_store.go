@@ -0,0 +1,129 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// BaselineStore persists cross-run baselines, such as the [LeakReport] of a
+// previous CI run, under keys like "pkg/suite.json". Implementations for
+// object stores, such as S3 or GCS, just need to map keys to object names; see
+// [FileBaselineStore] for a filesystem implementation.
+type BaselineStore interface {
+	// Fetch returns a reader for the baseline stored under the specified key.
+	// If there is no such baseline, the returned error wraps
+	// [fs.ErrNotExist]. The caller must close the returned reader.
+	Fetch(ctx context.Context, key string) (io.ReadCloser, error)
+	// Store stores the baseline read from r under the specified key,
+	// replacing any existing baseline under the same key.
+	Store(ctx context.Context, key string, r io.Reader) error
+}
+
+// FileBaselineStore is a [BaselineStore] storing baselines as files in a
+// directory, with the keys being slash-separated paths relative to it.
+type FileBaselineStore struct {
+	Dir string // directory to store baselines in.
+}
+
+var _ BaselineStore = (*FileBaselineStore)(nil)
+
+// Fetch returns a reader for the baseline file stored under the specified key.
+func (s FileBaselineStore) Fetch(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Store atomically stores the baseline read from r in a file under the
+// specified key, creating any missing intermediate directories. Readers never
+// see partially stored baselines.
+func (s FileBaselineStore) Store(ctx context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".baseline-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op after successful rename.
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// path returns the file path for the specified key, or an error if the key
+// would escape the store's directory.
+func (s FileBaselineStore) path(key string) (string, error) {
+	if key == "" || !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid baseline key %q", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+// FetchLeakReport fetches the LeakReport stored under the specified key from
+// the store. If there is no such report yet, such as on the very first CI run,
+// an empty report is returned together with found being false.
+func FetchLeakReport(ctx context.Context, store BaselineStore, key string) (report LeakReport, found bool, err error) {
+	r, err := store.Fetch(ctx, key)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return LeakReport{}, false, nil
+		}
+		return LeakReport{}, false, err
+	}
+	defer r.Close()
+	report, err = ReadLeakReport(r)
+	if err != nil {
+		return LeakReport{}, false, err
+	}
+	return report, true, nil
+}
+
+// StoreLeakReport stores the LeakReport under the specified key in the store,
+// in the same JSON format as written by [LeakReport.Write].
+func StoreLeakReport(ctx context.Context, store BaselineStore, key string, report LeakReport) error {
+	var buff bytes.Buffer
+	if err := report.Write(&buff); err != nil {
+		return err
+	}
+	return store.Store(ctx, key, &buff)
+}
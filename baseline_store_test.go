@@ -0,0 +1,109 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+// memStore is a minimal in-memory BaselineStore, standing in for object-store
+// backends.
+type memStore map[string][]byte
+
+func (s memStore) Fetch(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, ok := s[key]
+	if !ok {
+		return nil, &fs.PathError{Op: "fetch", Path: key, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s memStore) Store(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s[key] = data
+	return nil
+}
+
+var _ = Describe("baseline stores", func() {
+
+	ctx := context.Background()
+
+	It("stores and fetches files", func() {
+		store := FileBaselineStore{Dir: GinkgoT().TempDir()}
+		Expect(store.Fetch(ctx, "pkg/suite.json")).Error().To(MatchError(fs.ErrNotExist))
+		Expect(store.Store(ctx, "pkg/suite.json", strings.NewReader("foo"))).To(Succeed())
+		Expect(store.Store(ctx, "pkg/suite.json", strings.NewReader("bar"))).To(Succeed())
+		r := Successful(store.Fetch(ctx, "pkg/suite.json"))
+		defer r.Close()
+		Expect(io.ReadAll(r)).To(Equal([]byte("bar")))
+		Expect(os.ReadDir(filepath.Join(store.Dir, "pkg"))).To(HaveLen(1))
+	})
+
+	DescribeTable("rejects invalid keys",
+		func(key string) {
+			store := FileBaselineStore{Dir: GinkgoT().TempDir()}
+			Expect(store.Fetch(ctx, key)).Error().To(MatchError(ContainSubstring("invalid baseline key")))
+			Expect(store.Store(ctx, key, strings.NewReader(""))).To(MatchError(ContainSubstring("invalid baseline key")))
+		},
+		Entry(nil, ""),
+		Entry(nil, "../escape.json"),
+		Entry(nil, "/abs.json"),
+	)
+
+	It("honors cancelled contexts", func() {
+		store := FileBaselineStore{Dir: GinkgoT().TempDir()}
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(store.Store(cctx, "foo.json", strings.NewReader("foo"))).To(MatchError(context.Canceled))
+		Expect(store.Fetch(cctx, "foo.json")).Error().To(MatchError(context.Canceled))
+		Expect(os.ReadDir(store.Dir)).To(BeEmpty())
+	})
+
+	It("stores and fetches leak reports", func() {
+		for _, store := range []BaselineStore{FileBaselineStore{Dir: GinkgoT().TempDir()}, memStore{}} {
+			report, found, err := FetchLeakReport(ctx, store, "suite.json")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+			Expect(report.Leaks).To(BeEmpty())
+
+			stored := LeakReport{Leaks: []LeakedFd{{FdNo: 42, Key: "pipe", Description: "fd 42"}}}
+			Expect(StoreLeakReport(ctx, store, "suite.json", stored)).To(Succeed())
+			report, found, err = FetchLeakReport(ctx, store, "suite.json")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(report).To(Equal(stored))
+		}
+
+		store := memStore{"broken.json": []byte("{")}
+		Expect(FetchLeakReport(ctx, store, "broken.json")).Error().To(HaveOccurred())
+		Expect(FetchLeakReport(ctx, FileBaselineStore{}, "..")).Error().To(HaveOccurred())
+	})
+
+})
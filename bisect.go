@@ -0,0 +1,99 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+
+	"github.com/onsi/gomega/types"
+)
+
+// Step is a labelled sub-step of a test, to be run by [BisectLeaks].
+type Step struct {
+	Label string // label identifying this step in leak reports
+	Fn    func() // sub-step function
+}
+
+// LeakingStep lists the file descriptors that a particular step opened and
+// that were still leaking after all steps had been run.
+type LeakingStep struct {
+	Label  string
+	Leaked []FileDescriptor
+}
+
+// Description returns a pretty formatted multi-line textual description of
+// the step and its leaked file descriptors.
+func (s LeakingStep) Description(indentation uint) string {
+	return fmt.Sprintf("step %q leaked %d file descriptors:\n%s",
+		s.Label, len(s.Leaked), dumpFds(s.Leaked, indentation+1))
+}
+
+// BisectLeaks runs the specified steps in sequence, taking a snapshot of the
+// open file descriptors before the first step as well as after each step. It
+// then determines the file descriptors leaked after all steps have been run,
+// and attributes each leaked fd to the step after which it showed up first.
+// BisectLeaks returns only the leaking steps, in the order of the steps, so
+// an empty result means that no fds have leaked.
+//
+// As with [HaveLeakedFds], optional filter matchers can be specified in order
+// to ignore use case-specific file descriptors.
+//
+// BisectLeaks automates the manual bisection otherwise needed when a test
+// consisting of many sub-steps leaks:
+//
+//	leaking, err := BisectLeaks([]Step{
+//	    {Label: "connect", Fn: func() { ... }},
+//	    {Label: "query", Fn: func() { ... }},
+//	})
+//	Expect(err).NotTo(HaveOccurred())
+//	Expect(leaking).To(BeEmpty())
+func BisectLeaks(steps []Step, ignoring ...types.GomegaMatcher) ([]LeakingStep, error) {
+	snapshots := make([][]FileDescriptor, 0, len(steps)+1)
+	snapshots = append(snapshots, Filedescriptors())
+	for _, step := range steps {
+		step.Fn()
+		snapshots = append(snapshots, Filedescriptors())
+	}
+	leaked, err := filterFds(snapshots[len(snapshots)-1],
+		append([]types.GomegaMatcher{IgnoringFiledescriptors(snapshots[0])}, ignoring...))
+	if err != nil {
+		return nil, err
+	}
+	stepLeaks := make([][]FileDescriptor, len(steps))
+	for _, fd := range leaked {
+		// Find the first step after which this fd had been present; as fds
+		// might be closed and their numbers reused in between, we need to
+		// check for equality, not just the fd number.
+		for idx := range steps {
+			if present, _ := IgnoringFiledescriptors(snapshots[idx+1]).Match(fd); present {
+				stepLeaks[idx] = append(stepLeaks[idx], fd)
+				break
+			}
+		}
+	}
+	leaking := []LeakingStep{}
+	for idx, fds := range stepLeaks {
+		if len(fds) == 0 {
+			continue
+		}
+		leaking = append(leaking, LeakingStep{
+			Label:  steps[idx].Label,
+			Leaked: fds,
+		})
+	}
+	return leaking, nil
+}
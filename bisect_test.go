@@ -0,0 +1,72 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("leak bisection", func() {
+
+	It("doesn't report non-leaking steps", func() {
+		var f *os.File
+		leaking, err := BisectLeaks([]Step{
+			{Label: "open", Fn: func() { f, _ = os.Open("bisect_test.go") }},
+			{Label: "close", Fn: func() { f.Close() }},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leaking).To(BeEmpty())
+	})
+
+	It("fails when a filter fails", func() {
+		var f *os.File
+		defer func() { f.Close() }()
+		Expect(BisectLeaks([]Step{
+			{Label: "leaky", Fn: func() { f, _ = os.Open("bisect_test.go") }},
+		}, HaveField("Foo", 42))).Error().To(HaveOccurred())
+	})
+
+	It("identifies the leaking step", func() {
+		var f1, f2 *os.File
+		defer func() {
+			if f1 != nil {
+				f1.Close()
+			}
+			if f2 != nil {
+				f2.Close()
+			}
+		}()
+		leaking, err := BisectLeaks([]Step{
+			{Label: "innocent", Fn: func() {}},
+			{Label: "leaky", Fn: func() { f1, _ = os.Open("bisect_test.go") }},
+			{Label: "temporary", Fn: func() { f2, _ = os.Open("bisect.go") }},
+			{Label: "cleanup", Fn: func() { f2.Close(); f2 = nil }},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leaking).To(HaveLen(1))
+		Expect(leaking[0].Label).To(Equal("leaky"))
+		Expect(leaking[0].Leaked).To(ConsistOf(HaveField("FdNo()", int(f1.Fd()))))
+		Expect(leaking[0].Description(0)).To(MatchRegexp(
+			`(?m)^step "leaky" leaked 1 file descriptors:
+\s+fd \d+, flags 0x.*
+\s+path: ".*/bisect_test.go"$`))
+	})
+
+})
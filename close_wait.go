@@ -0,0 +1,78 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+)
+
+// HaveNoCloseWaitSockets succeeds if there are no TCP sockets that have been in
+// CLOSE_WAIT for longer than the specified threshold, that is, sockets whose
+// peers hung up some time ago, but that still haven't been closed. In contrast
+// to [HaveLeakedFds], HaveNoCloseWaitSockets doesn't need any baseline, so
+// that services can continuously assert it, not only in before/after form:
+//
+//	Consistently(func() ([]FileDescriptor, error) {
+//	    return filedesc.ProcessFiledescriptors(pid)
+//	}).Should(HaveNoCloseWaitSockets(5 * time.Second))
+//
+// The time in CLOSE_WAIT is approximated by the time since the socket last
+// received data or an ACK from its peer, see
+// [filedesc.SocketFd.TCPSinceLastReceived].
+func HaveNoCloseWaitSockets(olderThan time.Duration) types.GomegaMatcher {
+	return &haveNoCloseWaitSocketsMatcher{olderThan: olderThan}
+}
+
+type haveNoCloseWaitSocketsMatcher struct {
+	olderThan time.Duration
+	stale     []FileDescriptor
+}
+
+func (matcher *haveNoCloseWaitSocketsMatcher) Match(actual interface{}) (success bool, err error) {
+	actualFds, err := toFds(actual, "HaveNoCloseWaitSockets")
+	if err != nil {
+		return false, err
+	}
+	matcher.stale = nil
+	for _, fd := range actualFds {
+		s, ok := fd.(*filedesc.SocketFd)
+		if !ok || s.TCPState() != unix.BPF_TCP_CLOSE_WAIT ||
+			s.TCPSinceLastReceived() < matcher.olderThan {
+			continue
+		}
+		matcher.stale = append(matcher.stale, fd)
+	}
+	return len(matcher.stale) == 0, nil
+}
+
+// FailureMessage returns a failure message if there are sockets in CLOSE_WAIT
+// for longer than the threshold, listing these sockets.
+func (matcher *haveNoCloseWaitSocketsMatcher) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected no sockets in CLOSE_WAIT for longer than %s, but found %d:\n%s",
+		matcher.olderThan, len(matcher.stale), dumpFds(matcher.stale, 1))
+}
+
+// NegatedFailureMessage returns a negated failure message if there aren't any
+// sockets in CLOSE_WAIT for longer than the threshold.
+func (matcher *haveNoCloseWaitSocketsMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected sockets in CLOSE_WAIT for longer than %s", matcher.olderThan)
+}
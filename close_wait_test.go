@@ -0,0 +1,60 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HaveNoCloseWaitSockets matcher", func() {
+
+	It("fails for invalid actual", func() {
+		m := HaveNoCloseWaitSockets(time.Second)
+		Expect(m.Match(nil)).Error().To(HaveOccurred())
+		Expect(m.Match(42)).Error().To(HaveOccurred())
+	})
+
+	It("detects sockets in CLOSE_WAIT for too long", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		c, err := net.Dial("tcp", l.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer c.Close()
+		s, err := l.Accept()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(Filedescriptors()).To(HaveNoCloseWaitSockets(0))
+		Expect(s.Close()).To(Succeed())
+		Eventually(Filedescriptors).ShouldNot(HaveNoCloseWaitSockets(0))
+		Expect(Filedescriptors()).To(HaveNoCloseWaitSockets(time.Hour))
+		Eventually(Filedescriptors).ShouldNot(HaveNoCloseWaitSockets(100 * time.Millisecond))
+
+		m := HaveNoCloseWaitSockets(100 * time.Millisecond)
+		fds := Filedescriptors()
+		Expect(m.Match(fds)).To(BeFalse())
+		Expect(m.FailureMessage(fds)).To(MatchRegexp(
+			`^Expected no sockets in CLOSE_WAIT for longer than 100ms, but found 1:\n\s+fd \d+, .*`))
+		Expect(m.NegatedFailureMessage(fds)).To(Equal(
+			"Expected sockets in CLOSE_WAIT for longer than 100ms"))
+	})
+
+})
@@ -0,0 +1,57 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+// Command fdooze offers fd leak checking helpers outside of test suites.
+//
+// The “sanity” subcommand probes the current environment and prints the
+// capabilities fd discovery relies on; it exits with status 1 if any
+// capability is unavailable:
+//
+//	fdooze sanity
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/thediveo/fdooze"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the subcommand specified in args and returns the exit status.
+func run(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: fdooze sanity")
+		return 2
+	}
+	switch args[0] {
+	case "sanity":
+		report := fdooze.Sanity()
+		fmt.Println(report.Description(0))
+		for _, capability := range report.Capabilities {
+			if !capability.Available {
+				return 1
+			}
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "fdooze: unknown subcommand %q\n", args[0])
+		return 2
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import "fmt"
+
+// FdCompaction relates the highest open fd number to the number of open file
+// descriptors. As the kernel always hands out the lowest free fd number, a
+// huge gap between both, such as max fd 65000 with only 40 fds open, hints at
+// past churn or leak-and-close cycles.
+type FdCompaction struct {
+	MaxFd int `json:"maxfd"` // highest open fd number, or -1 if no fds are open.
+	Open  int `json:"open"`  // number of open fds.
+}
+
+// Compaction returns the fd number compaction of the specified list of file
+// descriptors.
+func Compaction(fds []FileDescriptor) FdCompaction {
+	compaction := FdCompaction{MaxFd: -1, Open: len(fds)}
+	for _, fd := range fds {
+		compaction.MaxFd = max(compaction.MaxFd, fd.FdNo())
+	}
+	return compaction
+}
+
+// Gap returns the number of unused fd numbers below the highest open fd number.
+func (c FdCompaction) Gap() int {
+	return c.MaxFd + 1 - c.Open
+}
+
+// Description returns a single-line textual description of the fd number
+// compaction.
+func (c FdCompaction) Description() string {
+	return fmt.Sprintf("max fd %d with %d fds open, %d unused fd numbers in between",
+		c.MaxFd, c.Open, c.Gap())
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fd number compaction", func() {
+
+	It("relates the max fd number to the number of open fds", func() {
+		Expect(Compaction(nil)).To(Equal(FdCompaction{MaxFd: -1}))
+		Expect(Compaction(nil).Gap()).To(BeZero())
+
+		f, err := os.Open("compaction_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		highfd, err := unix.FcntlInt(f.Fd(), unix.F_DUPFD_CLOEXEC, 4000)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(highfd)
+
+		compaction := Compaction(Filedescriptors())
+		Expect(compaction.MaxFd).To(Equal(highfd))
+		Expect(compaction.Gap()).To(BeNumerically(">", 4000-compaction.Open))
+		Expect(compaction.Description()).To(MatchRegexp(
+			`^max fd %d with \d+ fds open, \d+ unused fd numbers in between$`, highfd))
+	})
+
+	It("informs in leak reports", func() {
+		report, err := NewLeakReport(Filedescriptors(), Filedescriptors())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Compaction.Open).To(BeNumerically(">", 0))
+
+		var out strings.Builder
+		Expect(report.WriteMarkdown(&out)).To(Succeed())
+		Expect(out.String()).To(HaveSuffix("\n_" + report.Compaction.Description() + "_\n"))
+		out.Reset()
+		Expect(report.WriteHTML(&out)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("<p><em>max fd "))
+	})
+
+})
@@ -34,6 +34,10 @@ compare fd numbers, but takes as much additional detail information as possible
 into account: like file paths, socket domains, types, protocols and addresses,
 et cetera.
 
+In the simplest cases, [StandardFds] can be used instead of a live baseline: it
+returns the fds every Go test process predictably has, such as stdio and the Go
+runtime netpoller fds.
+
 On finding leaked file descriptors, fdooze dumps these leaked fds in the failure
 message of the [HaveLeakedFds] matcher. For instance:
 
@@ -65,6 +69,57 @@ but not the result of calling Filedescriptors.
 	// ❌❌❌ WRONG WRONG WRONG ❌❌❌
 	Eventually(Filedescriptors()).ShouldNot(HaveLeakedFds(...))
 
+In order to suppress one-off procfs races and short-lived helper fds without
+resorting to a fixed grace duration, [Quorum] runs multiple discovery passes and
+returns only those fds present in all passes:
+
+	Expect(Quorum(3, Filedescriptors)).NotTo(HaveLeakedFds(goodfds))
+
+# Custom Descriptions
+
+The descriptions of leaked file descriptors in failure messages and leak reports
+can be adjusted by registering custom renderers per kind of file descriptor
+using [RegisterRenderer], such as to include internal asset IDs resolved from
+paths:
+
+	RegisterRenderer("path", RendererFunc(func(fd FileDescriptor, indentation uint) string {
+	    return fd.Description(indentation) + "\n" + ...
+	}))
+
+Overlong quoted values in failure messages, such as long paths and unix socket
+names, get elided in their middle to fit [DescriptionWidth], while leak
+reports always contain the full values. Set [Redact] in order to keep
+sensitive values, such as tenant hostnames or secret-bearing paths, out of
+failure messages and leak reports.
+
+# Custom Leak Checks
+
+[LeakCheck] generalizes the leak checking machinery of [HaveLeakedFds] to other
+resources, such as inotify watches or loop devices, requiring only an identity
+and a describe function. Its HaveLeaked method then returns a sibling matcher
+supporting the same filter matchers as HaveLeakedFds. [HaveLeakedLoopDevices]
+and [HaveLeakedMounts] are such sibling matchers for leaked loop devices and
+leaked (namespace) bind mounts.
+
+# Connection Pools
+
+Connection pools, such as database/sql's, legitimately hold on to connections
+across specs. Register such pools using [RegisterPool] with a predicate
+identifying the pool-owned fds, such as by peer address using [OwnedByPeer] or
+by path using [OwnedByPath], so that HaveLeakedFds automatically subtracts the
+fds held by warm pools. Package [github.com/thediveo/fdooze/fdsql] does so for
+a database/sql DB, without fdooze itself depending on database/sql:
+
+	DeferCleanup(fdsql.RegisterPool(db, "127.0.0.1:5432"))
+
+# CLOSE_WAIT Sockets
+
+Sockets whose peers hung up, but that never got closed, linger in CLOSE_WAIT.
+[HaveNoCloseWaitSockets] asserts that there are no such sockets older than a
+threshold, without needing any baseline:
+
+	Expect(Filedescriptors()).To(HaveNoCloseWaitSockets(5 * time.Second))
+
 [Eventually]: https://pkg.go.dev/github.com/onsi/gomega#Eventually
 [Expect]: https://pkg.go.dev/github.com/onsi/gomega#Expect
 */
@@ -0,0 +1,343 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+)
+
+// FdMatcherBuilder builds a matcher for file descriptors from a set of
+// conditions that all need to be met. Use [Fd] to start building and finally
+// call [FdMatcherBuilder.Build] to get the matcher. For instance:
+//
+//	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds,
+//	    Fd().OfKind("socket").WithPeerPort(5432).Build()))
+//
+// The resulting matcher can be used as a filter with [HaveLeakedFds], but also
+// standalone, such as with Gomega's ContainElement.
+type FdMatcherBuilder struct {
+	conds []fdCondition
+	err   error // first error encountered while building, if any.
+}
+
+// fdCondition is a single condition a file descriptor must meet, together
+// with its textual description for use in failure messages.
+type fdCondition struct {
+	desc string
+	test func(fd FileDescriptor) bool
+}
+
+// fdKinds maps the supported kind names to tests for the corresponding
+// FileDescriptor implementations.
+var fdKinds = map[string]func(fd FileDescriptor) bool{
+	"path": func(fd FileDescriptor) bool {
+		_, ok := fd.(*filedesc.PathFd)
+		return ok
+	},
+	"shm": func(fd FileDescriptor) bool {
+		_, ok := fd.(*filedesc.ShmFd)
+		return ok
+	},
+	"pipe": func(fd FileDescriptor) bool {
+		_, ok := fd.(*filedesc.PipeFd)
+		return ok
+	},
+	"socket": func(fd FileDescriptor) bool {
+		_, ok := fd.(*filedesc.SocketFd)
+		return ok
+	},
+	"anon_inode": func(fd FileDescriptor) bool {
+		_, ok := filedesc.AnonInodeOf(fd)
+		return ok
+	},
+	"namespace": func(fd FileDescriptor) bool {
+		_, ok := fd.(*filedesc.NamespaceFd)
+		return ok
+	},
+}
+
+// pathOf returns the path referenced by the specified fd, if it is a path or
+// shared memory fd.
+func pathOf(fd FileDescriptor) (string, bool) {
+	switch fd := fd.(type) {
+	case *filedesc.PathFd:
+		return fd.Path(), true
+	case *filedesc.ShmFd:
+		return fd.Path(), true
+	}
+	return "", false
+}
+
+// Fd returns a new FdMatcherBuilder without any conditions; a matcher built
+// from it without adding any conditions matches any file descriptor.
+func Fd() *FdMatcherBuilder {
+	return &FdMatcherBuilder{}
+}
+
+// with adds another condition and returns the builder for chaining.
+func (b *FdMatcherBuilder) with(desc string, test func(fd FileDescriptor) bool) *FdMatcherBuilder {
+	b.conds = append(b.conds, fdCondition{desc: desc, test: test})
+	return b
+}
+
+// OfKind requires a file descriptor to be of the specified kind, which is one
+// of "path", "shm", "pipe", "socket", "anon_inode", or "namespace". Specifying any
+// other kind results in a matcher that always errors.
+func (b *FdMatcherBuilder) OfKind(kind string) *FdMatcherBuilder {
+	test, ok := fdKinds[kind]
+	if !ok {
+		if b.err == nil {
+			b.err = fmt.Errorf("Fd builder: unknown fd kind %q", kind)
+		}
+		return b
+	}
+	return b.with(fmt.Sprintf("of kind %q", kind), test)
+}
+
+// WithFdNo requires a file descriptor to have the specified fd number.
+func (b *FdMatcherBuilder) WithFdNo(fdNo int) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with fd number %d", fdNo), func(fd FileDescriptor) bool {
+		return fd.FdNo() == fdNo
+	})
+}
+
+// WithTargetOf requires a file descriptor to refer to the same underlying
+// object as the specified file descriptor, which might belong to a different
+// process; see [SameTarget]. For instance, to assert that a listening socket
+// passed to a child process is open in the child:
+//
+//	Expect(childFds).To(ContainElement(Fd().WithTargetOf(listenerFd).Build()))
+func (b *FdMatcherBuilder) WithTargetOf(target FileDescriptor) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("referring to the same object as fd %d", target.FdNo()), func(fd FileDescriptor) bool {
+		return SameTarget(fd, target)
+	})
+}
+
+// WithPath requires a file descriptor to reference the specified path.
+func (b *FdMatcherBuilder) WithPath(path string) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with path %q", path), func(fd FileDescriptor) bool {
+		p, ok := pathOf(fd)
+		return ok && p == path
+	})
+}
+
+// WithPathPrefix requires a file descriptor to reference a path starting with
+// the specified prefix.
+func (b *FdMatcherBuilder) WithPathPrefix(prefix string) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with path prefix %q", prefix), func(fd FileDescriptor) bool {
+		p, ok := pathOf(fd)
+		return ok && strings.HasPrefix(p, prefix)
+	})
+}
+
+// WithAnonInodeType requires a file descriptor to be an anonymous inode of
+// the specified “file” type, such as "eventfd" or "eventpoll".
+func (b *FdMatcherBuilder) WithAnonInodeType(ftype string) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with anonymous inode file type %q", ftype), func(fd FileDescriptor) bool {
+		a, ok := filedesc.AnonInodeOf(fd)
+		return ok && a.FileType() == ftype
+	})
+}
+
+// WithDomain requires a file descriptor to be a socket of the specified
+// domain, such as unix.AF_INET.
+func (b *FdMatcherBuilder) WithDomain(domain int) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with socket domain %s", filedesc.SocketDomain(domain)), func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		return ok && s.Domain() == domain
+	})
+}
+
+// WithType requires a file descriptor to be a socket of the specified type,
+// such as unix.SOCK_STREAM.
+func (b *FdMatcherBuilder) WithType(typ int) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with socket type %s", filedesc.SocketType(typ)), func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		return ok && s.Type() == typ
+	})
+}
+
+// Listening requires a file descriptor to be a listening socket.
+func (b *FdMatcherBuilder) Listening() *FdMatcherBuilder {
+	return b.with("listening", func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		return ok && s.Listening()
+	})
+}
+
+// WithLocalPort requires a file descriptor to be an IPv4 or IPv6 socket bound
+// to the specified local port.
+func (b *FdMatcherBuilder) WithLocalPort(port int) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with local port %d", port), func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		if !ok {
+			return false
+		}
+		p, ok := sockaddrPort(s.Addr())
+		return ok && p == port
+	})
+}
+
+// WithPeerPort requires a file descriptor to be an IPv4 or IPv6 socket
+// connected to the specified peer port.
+func (b *FdMatcherBuilder) WithPeerPort(port int) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with peer port %d", port), func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		if !ok {
+			return false
+		}
+		p, ok := sockaddrPort(s.PeerAddr())
+		return ok && p == port
+	})
+}
+
+// WithLocalPortInRange requires a file descriptor to be an IPv4 or IPv6 socket
+// bound to a local port within the specified (inclusive) range.
+func (b *FdMatcherBuilder) WithLocalPortInRange(low, high int) *FdMatcherBuilder {
+	return b.with(fmt.Sprintf("with local port in range %d-%d", low, high), func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		if !ok {
+			return false
+		}
+		_, port, ok := netAddrIPPort(s.NetAddr())
+		return ok && port >= low && port <= high
+	})
+}
+
+// WithPeerInCIDR requires a file descriptor to be an IPv4 or IPv6 socket
+// connected to a peer inside the specified network in CIDR notation, such as
+// "10.0.0.0/8" or "fd00::/8". An invalid CIDR results in a matcher that always
+// errors.
+func (b *FdMatcherBuilder) WithPeerInCIDR(cidr string) *FdMatcherBuilder {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil && b.err == nil {
+		b.err = fmt.Errorf("Fd builder: invalid CIDR %q", cidr)
+	}
+	return b.with(fmt.Sprintf("with peer in %s", cidr), func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		if !ok || network == nil {
+			return false
+		}
+		ip, _, ok := netAddrIPPort(s.PeerNetAddr())
+		return ok && network.Contains(ip)
+	})
+}
+
+// HalfClosed requires a file descriptor to be a half-closed TCP socket, see
+// [filedesc.SocketFd.HalfClosed], such as when hunting the classic “forgot to
+// Close after peer hung up” CLOSE_WAIT leak:
+//
+//	Expect(Filedescriptors()).NotTo(ContainElement(Fd().HalfClosed().Build()))
+func (b *FdMatcherBuilder) HalfClosed() *FdMatcherBuilder {
+	return b.with("being half-closed", func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		return ok && s.HalfClosed()
+	})
+}
+
+// sockaddrPort returns the port number of an IPv4 or IPv6 socket address,
+// and false for any other (or nil) socket address.
+func sockaddrPort(sa unix.Sockaddr) (int, bool) {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return sa.Port, true
+	case *unix.SockaddrInet6:
+		return sa.Port, true
+	}
+	return 0, false
+}
+
+// netAddrIPPort returns the IP address and port of a TCP, UDP, or IP address,
+// and false for any other (or nil) address.
+func netAddrIPPort(addr net.Addr) (net.IP, int, bool) {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP, addr.Port, true
+	case *net.UDPAddr:
+		return addr.IP, addr.Port, true
+	case *net.IPAddr:
+		return addr.IP, 0, true
+	}
+	return nil, 0, false
+}
+
+// Build returns a matcher that succeeds for a FileDescriptor meeting all the
+// conditions specified so far.
+func (b *FdMatcherBuilder) Build() types.GomegaMatcher {
+	return &fdMatcher{
+		conds: append([]fdCondition(nil), b.conds...),
+		err:   b.err,
+	}
+}
+
+type fdMatcher struct {
+	conds []fdCondition
+	err   error
+}
+
+// Match succeeds if actual is a [filedesc.FileDescriptor] meeting all
+// conditions.
+func (matcher *fdMatcher) Match(actual interface{}) (success bool, err error) {
+	if matcher.err != nil {
+		return false, matcher.err
+	}
+	actualFd, ok := actual.(FileDescriptor)
+	if !ok {
+		return false, fmt.Errorf(
+			"Fd matcher expects a filedesc.FileDescriptor.  Got:\n%s",
+			format.Object(actual, 1))
+	}
+	for _, cond := range matcher.conds {
+		if !cond.test(actualFd) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// description returns the textual description of all conditions.
+func (matcher *fdMatcher) description() string {
+	if len(matcher.conds) == 0 {
+		return "file descriptor"
+	}
+	descs := make([]string, 0, len(matcher.conds))
+	for _, cond := range matcher.conds {
+		descs = append(descs, cond.desc)
+	}
+	return "file descriptor " + strings.Join(descs, ", ")
+}
+
+// FailureMessage returns a failure message if the actual file descriptor
+// doesn't meet all conditions.
+func (matcher *fdMatcher) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected\n%s\nto be a %s",
+		format.Object(actual, 1), matcher.description())
+}
+
+// NegatedFailureMessage returns a failure message if the actual file
+// descriptor meets all conditions.
+func (matcher *fdMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected\n%s\nnot to be a %s",
+		format.Object(actual, 1), matcher.description())
+}
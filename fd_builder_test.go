@@ -0,0 +1,118 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"net"
+	"os"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fd matcher builder", func() {
+
+	It("rejects invalid actual values and unknown kinds", func() {
+		Expect(Fd().Build().Match(42)).Error().To(HaveOccurred())
+		Expect(Fd().OfKind("foobar").Build().Match(Filedescriptors()[0])).Error().To(
+			MatchError(ContainSubstring(`unknown fd kind "foobar"`)))
+		Expect(Fd().WithPeerInCIDR("10.0.0.0").Build().Match(Filedescriptors()[0])).Error().To(
+			MatchError(ContainSubstring(`invalid CIDR "10.0.0.0"`)))
+	})
+
+	It("matches any fd without conditions", func() {
+		Expect(Filedescriptors()).To(HaveEach(Fd().Build()))
+	})
+
+	It("matches path fds", func() {
+		f, err := os.Open("fd_builder_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		fdesc, err := filedesc.FromFile(f)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fdesc).To(Fd().OfKind("path").WithFdNo(int(f.Fd())).Build())
+		Expect(fdesc).NotTo(Fd().OfKind("socket").Build())
+		Expect(fdesc).To(Fd().WithPath(fdesc.(*filedesc.PathFd).Path()).Build())
+		Expect(fdesc).To(Fd().WithPathPrefix("/").Build())
+		Expect(fdesc).NotTo(Fd().WithPathPrefix("/foobar/").Build())
+	})
+
+	It("matches sockets", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		port := l.Addr().(*net.TCPAddr).Port
+		c, err := net.Dial("tcp", l.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer c.Close()
+
+		lfd, err := filedesc.FromConn(l.(*net.TCPListener))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lfd).To(Fd().OfKind("socket").Listening().WithLocalPort(port).Build())
+		Expect(lfd).To(Fd().WithDomain(unix.AF_INET).WithType(unix.SOCK_STREAM).Build())
+		Expect(lfd).NotTo(Fd().WithPeerPort(port).Build())
+
+		cfd, err := filedesc.FromConn(c.(*net.TCPConn))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfd).To(Fd().OfKind("socket").WithPeerPort(port).Build())
+		Expect(cfd).NotTo(Fd().Listening().Build())
+		Expect(cfd).NotTo(Fd().WithAnonInodeType("eventfd").Build())
+
+		Expect(cfd).To(PeerInCIDR("127.0.0.0/8"))
+		Expect(cfd).NotTo(PeerInCIDR("10.0.0.0/8"))
+		Expect(lfd).NotTo(PeerInCIDR("0.0.0.0/0"))
+		Expect(lfd).To(LocalPortInRange(port, port))
+		Expect(lfd).NotTo(LocalPortInRange(port+1, port+10))
+		Expect(Fd().WithPeerInCIDR("127.0.0.0/8").Build().(*fdMatcher).description()).To(
+			Equal("file descriptor with peer in 127.0.0.0/8"))
+
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(nil,
+			Fd().OfKind("socket").Build(),
+			Fd().OfKind("path").Build(),
+			Fd().OfKind("pipe").Build(),
+			Fd().OfKind("anon_inode").Build()))
+	})
+
+	It("matches half-closed sockets", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		c, err := net.Dial("tcp", l.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer c.Close()
+		s, err := l.Accept()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(Filedescriptors()).NotTo(ContainElement(Fd().HalfClosed().Build()))
+		Expect(s.Close()).To(Succeed())
+		Eventually(Filedescriptors).Should(ContainElement(Fd().HalfClosed().Build()))
+	})
+
+	It("returns failure messages", func() {
+		m := Fd().OfKind("pipe").WithFdNo(42).Build()
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`Expected\n\s+<nil>: nil\nto be a file descriptor of kind "pipe", with fd number 42`))
+		Expect(m.NegatedFailureMessage(nil)).To(MatchRegexp(
+			`Expected\n\s+<nil>: nil\nnot to be a file descriptor of kind "pipe", with fd number 42`))
+		Expect(Fd().Build().FailureMessage(nil)).To(HaveSuffix("to be a file descriptor"))
+	})
+
+})
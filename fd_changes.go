@@ -0,0 +1,108 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fdChanges broadcasts notified changes of the fd table of this process by
+// closing the current channel and replacing it with a fresh one.
+var fdChanges = struct {
+	mu sync.Mutex
+	ch chan struct{}
+}{ch: make(chan struct{})}
+
+// NotifyFdChange notifies all waiters that the fd table of this process has
+// changed. The accounting wrappers of this package, such as [Dup], [Close], and
+// the [FileTracer] wrappers, call NotifyFdChange automatically; custom
+// wrappers around creating and closing fds should call it too.
+//
+// Please note that Go offers no hook into the syscalls creating and closing
+// fds, so only fd changes made through accounting wrappers get notified.
+func NotifyFdChange() {
+	fdChanges.mu.Lock()
+	defer fdChanges.mu.Unlock()
+	close(fdChanges.ch)
+	fdChanges.ch = make(chan struct{})
+}
+
+// FdChange returns a channel that gets closed upon the next notified change of
+// the fd table of this process; see [NotifyFdChange].
+func FdChange() <-chan struct{} {
+	fdChanges.mu.Lock()
+	defer fdChanges.mu.Unlock()
+	return fdChanges.ch
+}
+
+// Dup duplicates the specified fd, like dup(2), but with the close-on-exec
+// flag set on the new fd, and notifies the fd change.
+func Dup(fd int) (int, error) {
+	newfd, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return -1, err
+	}
+	NotifyFdChange()
+	return newfd, nil
+}
+
+// Close closes the specified fd, like close(2), and notifies the fd change.
+func Close(fd int) error {
+	err := unix.Close(fd)
+	NotifyFdChange()
+	return err
+}
+
+// OnFdChange returns a function returning the currently open file descriptors
+// of this process that is intended to be passed to Eventually in place of
+// [Filedescriptors]. Except for its first call, the returned function blocks
+// until the next notified fd change before discovering the fds, so Eventually
+// reacts immediately to changes instead of relying on its polling interval.
+// As only fd changes made through accounting wrappers get notified (see
+// [NotifyFdChange]), the function falls back to rediscovering after maxWait
+// at the latest.
+//
+//	Eventually(OnFdChange(100 * time.Millisecond)).ShouldNot(HaveLeakedFds(goodfds))
+func OnFdChange(maxWait time.Duration) func() []FileDescriptor {
+	var next <-chan struct{}
+	return func() []FileDescriptor {
+		if next != nil {
+			timer := time.NewTimer(maxWait)
+			select {
+			case <-next:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+		// Pick up the channel before discovering, so that no change during
+		// the discovery gets missed.
+		next = FdChange()
+		return Filedescriptors()
+	}
+}
+
+// Close closes the specified file and notifies the fd change; see
+// [NotifyFdChange].
+func (t *FileTracer) Close(f *os.File) error {
+	err := f.Close()
+	NotifyFdChange()
+	return err
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("fd change notifications", func() {
+
+	It("notifies changes", func() {
+		ch := FdChange()
+		Consistently(ch, 50*time.Millisecond).ShouldNot(BeClosed())
+		NotifyFdChange()
+		Expect(ch).To(BeClosed())
+		Expect(FdChange()).NotTo(BeClosed())
+	})
+
+	It("notifies dups and closes", func() {
+		f := Successful(os.Open("fd_changes_test.go"))
+		defer f.Close()
+
+		ch := FdChange()
+		fd := Successful(Dup(int(f.Fd())))
+		Expect(ch).To(BeClosed())
+		ch = FdChange()
+		Expect(Close(fd)).To(Succeed())
+		Expect(ch).To(BeClosed())
+
+		_, err := Dup(-1)
+		Expect(err).To(HaveOccurred())
+		Expect(Close(-1)).NotTo(Succeed())
+	})
+
+	It("rediscovers upon changes", func() {
+		goodfds := Filedescriptors()
+		tracer := NewFileTracer()
+		opened := make(chan *os.File, 1)
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			opened <- Successful(tracer.Open("fd_changes_test.go"))
+		}()
+
+		start := time.Now()
+		fds := OnFdChange(time.Minute)
+		Eventually(fds).Within(10 * time.Second).Should(HaveLeakedFds(goodfds))
+		f := <-opened
+		Expect(tracer.Close(f)).To(Succeed())
+		Eventually(fds).Within(10 * time.Second).ShouldNot(HaveLeakedFds(goodfds))
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+	})
+
+	It("falls back to rediscovering after the maximum wait", func() {
+		fds := OnFdChange(10 * time.Millisecond)
+		Expect(fds()).NotTo(BeEmpty())
+		start := time.Now()
+		Expect(fds()).NotTo(BeEmpty())
+		Expect(time.Since(start)).To(BeNumerically(">=", 10*time.Millisecond))
+	})
+
+})
@@ -0,0 +1,41 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+/*
+Package fdassert provides thin adapters exposing fd leak checks to non-Ginkgo
+test suites, without having to learn Gomega matchers.
+
+Testify-style suites (and plain “testing” tests) assert that there are no
+leaked fds compared to a baseline taken earlier:
+
+	func TestFoo(t *testing.T) {
+	    goodfds := fdooze.Filedescriptors()
+	    defer fdassert.NoLeaks(t, goodfds)
+	    // ...
+	}
+
+gocheck suites wrap [LeakChecker] into a checker by combining it with a
+CheckerInfo:
+
+	var HasNoLeakedFds check.Checker = struct {
+	    *check.CheckerInfo
+	    fdassert.LeakChecker
+	}{&check.CheckerInfo{Name: "HasNoLeakedFds", Params: []string{"obtained", "baseline"}}, fdassert.LeakChecker{}}
+
+	c.Assert(fdooze.Filedescriptors(), HasNoLeakedFds, goodfds)
+
+Optional filter matchers, such as [fdooze.IgnoringShm], ignore use
+case-specific fds as with [fdooze.HaveLeakedFds].
+*/
+package fdassert
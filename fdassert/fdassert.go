@@ -0,0 +1,100 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdassert
+
+import (
+	"fmt"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+)
+
+// TestingT is the subset of testing.TB used by the assertions, compatible with
+// testify's TestingT.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// NoLeaks asserts that there are no file descriptors currently open that
+// weren't in the specified baseline of file descriptors, ignoring any fds
+// matched by the optional filter matchers. It reports leaked fds with (some)
+// detail information using t.Errorf and returns false, otherwise it returns
+// true.
+func NoLeaks(t TestingT, baseline []fdooze.FileDescriptor, ignoring ...types.GomegaMatcher) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	return NoLeaksIn(t, fdooze.Filedescriptors(), baseline, ignoring...)
+}
+
+// NoLeaksIn asserts that there are no file descriptors in the specified actual
+// fds that weren't in the specified baseline of file descriptors, see also
+// [NoLeaks].
+func NoLeaksIn(t TestingT, actual, baseline []fdooze.FileDescriptor, ignoring ...types.GomegaMatcher) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	ok, message := check(actual, baseline, ignoring)
+	if !ok {
+		t.Errorf("%s", message)
+	}
+	return ok
+}
+
+// LeakChecker implements the Check method of gocheck checkers, succeeding if
+// the obtained fds (first parameter) contain no fds that weren't in the
+// baseline fds (second parameter), ignoring any fds matched by the Ignoring
+// filter matchers. Combine it with a gocheck CheckerInfo in order to get a
+// gocheck checker, see the package documentation.
+type LeakChecker struct {
+	Ignoring []types.GomegaMatcher
+}
+
+// Check succeeds if the obtained fds in params[0] contain no leaked fds
+// compared to the baseline fds in params[1], otherwise returning the details
+// of the leaked fds as the error.
+func (c LeakChecker) Check(params []interface{}, names []string) (result bool, error string) {
+	if len(params) != 2 {
+		return false, fmt.Sprintf("expected obtained and baseline fds, got %d parameters", len(params))
+	}
+	actual, ok := params[0].([]fdooze.FileDescriptor)
+	if !ok {
+		return false, fmt.Sprintf("obtained value must be a []FileDescriptor.  Got:\n%s",
+			format.Object(params[0], 1))
+	}
+	baseline, ok := params[1].([]fdooze.FileDescriptor)
+	if !ok && params[1] != nil {
+		return false, fmt.Sprintf("baseline value must be a []FileDescriptor.  Got:\n%s",
+			format.Object(params[1], 1))
+	}
+	return check(actual, baseline, c.Ignoring)
+}
+
+// check returns true if there are no leaked fds, otherwise false together with
+// the details of the leaked fds.
+func check(actual, baseline []fdooze.FileDescriptor, ignoring []types.GomegaMatcher) (bool, string) {
+	matcher := fdooze.HaveLeakedFds(baseline, ignoring...)
+	leaked, err := matcher.Match(actual)
+	if err != nil {
+		return false, err.Error()
+	}
+	if leaked {
+		return false, matcher.NegatedFailureMessage(actual)
+	}
+	return true, ""
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdassert
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+var _ = Describe("assertion adapters", func() {
+
+	It("asserts no leaks testify-style", func() {
+		t := &fakeT{}
+		goodfds := fdooze.Filedescriptors()
+		Expect(NoLeaks(t, goodfds)).To(BeTrue())
+		Expect(t.errors).To(BeEmpty())
+
+		f, err := os.Open("fdassert_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		Expect(NoLeaks(t, goodfds)).To(BeFalse())
+		Expect(t.errors).To(ConsistOf(MatchRegexp(
+			`(?s)^Expected not to leak 1 file descriptors:\n.*fdassert_test.go`)))
+
+		t.errors = nil
+		Expect(NoLeaks(t, goodfds, fdooze.Fd().OfKind("path").Build())).To(BeTrue())
+		Expect(t.errors).To(BeEmpty())
+	})
+
+	It("checks for leaks gocheck-style", func() {
+		goodfds := fdooze.Filedescriptors()
+		Expect(LeakChecker{}.Check([]interface{}{goodfds, goodfds}, nil)).To(BeTrue())
+
+		f, err := os.Open("fdassert_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		ok, message := LeakChecker{}.Check([]interface{}{fdooze.Filedescriptors(), goodfds}, nil)
+		Expect(ok).To(BeFalse())
+		Expect(message).To(ContainSubstring("fdassert_test.go"))
+		Expect(LeakChecker{Ignoring: []types.GomegaMatcher{fdooze.IgnoringShm(), fdooze.Fd().OfKind("path").Build()}}.
+			Check([]interface{}{fdooze.Filedescriptors(), goodfds}, nil)).To(BeTrue())
+	})
+
+	It("rejects invalid parameters", func() {
+		_, message := LeakChecker{}.Check([]interface{}{}, nil)
+		Expect(message).To(ContainSubstring("got 0 parameters"))
+		_, message = LeakChecker{}.Check([]interface{}{42, nil}, nil)
+		Expect(message).To(ContainSubstring("obtained value must be"))
+		_, message = LeakChecker{}.Check([]interface{}{fdooze.Filedescriptors(), 42}, nil)
+		Expect(message).To(ContainSubstring("baseline value must be"))
+		_, message = LeakChecker{Ignoring: []types.GomegaMatcher{HaveField("Foo", 42)}}.
+			Check([]interface{}{fdooze.Filedescriptors(), nil}, nil)
+		Expect(message).NotTo(BeEmpty())
+	})
+
+})
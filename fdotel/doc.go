@@ -0,0 +1,30 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+/*
+Package fdotel provides an optional OpenTelemetry integration for fd leak
+checks, recording each leak check as a span in the same timeline as the traced
+end-to-end tests.
+
+	Expect(Filedescriptors()).NotTo(fdotel.HaveLeakedFds(ctx, tracer, goodfds))
+
+The span carries the baseline size, the number of leaked fds, and the kinds of
+the leaked fds as its attributes, while the details of the individual leaked
+fds are attached as span events. When polling leak checks using Eventually,
+only checks with changing outcomes get recorded.
+
+Package fdotel is a separate Go module, so that only importers of this package
+depend on OpenTelemetry, but not all importers of package fdooze.
+*/
+package fdotel
@@ -0,0 +1,134 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdotel
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanName is the name of the spans recording leak checks.
+const SpanName = "fdooze.HaveLeakedFds"
+
+// Attribute keys of leak check spans and their leaked fd events.
+const (
+	BaselineSizeKey = attribute.Key("fdooze.baseline.size")
+	LeakedCountKey  = attribute.Key("fdooze.leaked.count")
+	LeakedKindsKey  = attribute.Key("fdooze.leaked.kinds")
+	FdNoKey         = attribute.Key("fdooze.fd")
+	FdKeyKey        = attribute.Key("fdooze.fd.key")
+	DescriptionKey  = attribute.Key("fdooze.fd.description")
+)
+
+// HaveLeakedFds works like [fdooze.HaveLeakedFds], but additionally records
+// leak checks as spans using the specified tracer, as a child of any span in
+// the specified context. The span has the baseline size, the number of leaked
+// fds, and the kinds of leaked fds as its attributes, and the details of each
+// leaked fd attached as a span event.
+//
+// When polled repeatedly, such as by Gomega's Eventually, only the first leak
+// check and any check with an outcome differing from its predecessor get
+// recorded, so that polling doesn't flood the trace with identical spans.
+func HaveLeakedFds(ctx context.Context, tracer trace.Tracer, fds []filedesc.FileDescriptor, ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return &tracedMatcher{
+		GomegaMatcher: fdooze.HaveLeakedFds(fds, ignoring...),
+		ctx:           ctx,
+		tracer:        tracer,
+		baselineSize:  len(fds),
+	}
+}
+
+type tracedMatcher struct {
+	types.GomegaMatcher // the untraced HaveLeakedFds matcher
+	ctx                 context.Context
+	tracer              trace.Tracer
+	baselineSize        int
+	recorded            bool   // has any leak check been recorded yet?
+	lastOutcome         string // outcome of the most recently recorded check.
+}
+
+// Match succeeds if actual contains leaked file descriptors, as for
+// [fdooze.HaveLeakedFds], recording the leak check as a span unless its
+// outcome is the same as the previously recorded one.
+func (matcher *tracedMatcher) Match(actual interface{}) (success bool, err error) {
+	success, err = matcher.GomegaMatcher.Match(actual)
+	if err != nil {
+		if !matcher.changedOutcome("error " + err.Error()) {
+			return false, err
+		}
+		_, span := matcher.startSpan()
+		defer span.End()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return false, err
+	}
+	report, ok := fdooze.LeakReportOf(matcher.GomegaMatcher)
+	if !ok {
+		return success, nil
+	}
+	keys := make([]string, 0, len(report.Leaks))
+	for _, leak := range report.Leaks {
+		keys = append(keys, leak.Key)
+	}
+	if !matcher.changedOutcome("leaks " + strings.Join(keys, "\n")) {
+		return success, nil
+	}
+	_, span := matcher.startSpan()
+	defer span.End()
+	kinds := []string{}
+	for _, leak := range report.Leaks {
+		kind, _, _ := strings.Cut(leak.Key, " ")
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+		span.AddEvent("leaked fd", trace.WithAttributes(
+			FdNoKey.Int(leak.FdNo),
+			FdKeyKey.String(leak.Key),
+			DescriptionKey.String(leak.Description)))
+	}
+	slices.Sort(kinds)
+	span.SetAttributes(
+		LeakedCountKey.Int(len(report.Leaks)),
+		LeakedKindsKey.StringSlice(kinds))
+	return success, nil
+}
+
+// changedOutcome returns true if the specified outcome of a leak check is the
+// first one or differs from the most recently recorded one, remembering it as
+// the most recently recorded outcome.
+func (matcher *tracedMatcher) changedOutcome(outcome string) bool {
+	if matcher.recorded && outcome == matcher.lastOutcome {
+		return false
+	}
+	matcher.recorded = true
+	matcher.lastOutcome = outcome
+	return true
+}
+
+// startSpan starts a new leak check span.
+func (matcher *tracedMatcher) startSpan() (context.Context, trace.Span) {
+	return matcher.tracer.Start(matcher.ctx, SpanName,
+		trace.WithAttributes(BaselineSizeKey.Int(matcher.baselineSize)))
+}
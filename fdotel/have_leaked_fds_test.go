@@ -0,0 +1,103 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdotel
+
+import (
+	"context"
+	"os"
+
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("traced leak checks", func() {
+
+	var recorder *tracetest.SpanRecorder
+	var tracer *sdktrace.TracerProvider
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		DeferCleanup(func() { _ = tracer.Shutdown(context.Background()) })
+	})
+
+	It("records a leak check without leaks", func() {
+		goodfds := fdooze.Filedescriptors()
+		Expect(fdooze.Filedescriptors()).NotTo(
+			HaveLeakedFds(context.Background(), tracer.Tracer("test"), goodfds))
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal(SpanName))
+		Expect(spans[0].Attributes()).To(ContainElements(
+			BaselineSizeKey.Int(len(goodfds)),
+			LeakedCountKey.Int(0)))
+		Expect(spans[0].Events()).To(BeEmpty())
+	})
+
+	It("records leaked fds", func() {
+		goodfds := fdooze.Filedescriptors()
+		f, err := os.Open("have_leaked_fds_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		m := HaveLeakedFds(context.Background(), tracer.Tracer("test"), goodfds)
+		Expect(fdooze.Filedescriptors()).To(m)
+		Expect(m.FailureMessage(nil)).To(HavePrefix("Expected to leak 1 file descriptors"))
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Attributes()).To(ContainElements(
+			LeakedCountKey.Int(1),
+			LeakedKindsKey.StringSlice([]string{"path"})))
+		Expect(spans[0].Events()).To(ConsistOf(
+			HaveField("Attributes", ContainElements(
+				FdNoKey.Int(int(f.Fd())),
+				HaveField("Key", DescriptionKey)))))
+	})
+
+	It("records only changing outcomes when polled", func() {
+		goodfds := fdooze.Filedescriptors()
+		m := HaveLeakedFds(context.Background(), tracer.Tracer("test"), goodfds)
+		for range 3 {
+			Expect(fdooze.Filedescriptors()).NotTo(m)
+		}
+		Expect(recorder.Ended()).To(HaveLen(1))
+
+		f, err := os.Open("have_leaked_fds_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		for range 2 {
+			Expect(fdooze.Filedescriptors()).To(m)
+		}
+		Expect(recorder.Ended()).To(HaveLen(2))
+	})
+
+	It("records errors", func() {
+		m := HaveLeakedFds(context.Background(), tracer.Tracer("test"), []filedesc.FileDescriptor{})
+		Expect(m.Match(42)).Error().To(HaveOccurred())
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Events()).To(ContainElement(HaveField("Name", "exception")))
+	})
+
+})
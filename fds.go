@@ -27,3 +27,10 @@ type FileDescriptor = filedesc.FileDescriptor
 func Filedescriptors() []FileDescriptor {
 	return filedesc.Filedescriptors()
 }
+
+// FiledescriptorsWith returns the list of currently open file descriptors for
+// this process, restricted by the specified discovery options, such as
+// [filedesc.OnlyKinds] and [filedesc.OnlyFdRange].
+func FiledescriptorsWith(opts ...filedesc.DiscoveryOption) []FileDescriptor {
+	return filedesc.FiledescriptorsWith(opts...)
+}
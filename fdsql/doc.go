@@ -0,0 +1,24 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+/*
+Package fdsql registers database/sql connection pools with fdooze, so that
+fdooze's leak checks subtract the connections held by warm pools. Keeping this
+integration in its own package avoids every importer of fdooze pulling in
+database/sql.
+
+	db, _ := sql.Open("postgres", "postgres://127.0.0.1:5432/test")
+	DeferCleanup(fdsql.RegisterPool(db, "127.0.0.1:5432"))
+*/
+package fdsql
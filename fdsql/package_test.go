@@ -1,4 +1,4 @@
-// Copyright 2023 Harald Albrecht.
+// Copyright 2022 Harald Albrecht.
 //
 // Licensed under the Apache License, Version 2.0 (the "License"); you may not
 // use this file except in compliance with the License. You may obtain a copy
@@ -12,9 +12,18 @@
 // License for the specific language governing permissions and limitations
 // under the License.
 
-package cage
+//go:build linux
 
-const (
-	IP   = "1.2.34.56"
-	Port = 12345
+package fdsql
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
 )
+
+func TestFdsqlPackage(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "fdsql package")
+}
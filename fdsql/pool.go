@@ -0,0 +1,38 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdsql
+
+import (
+	"database/sql"
+
+	"github.com/thediveo/fdooze"
+)
+
+// RegisterPool registers the connection pool of the specified database/sql DB
+// with the connections to the specified peer address, returning a function to
+// unregister the pool again. At most as many sockets connected to the peer are
+// subtracted as the DB reports open connections.
+//
+//	db, _ := sql.Open("postgres", "postgres://127.0.0.1:5432/test")
+//	DeferCleanup(fdsql.RegisterPool(db, "127.0.0.1:5432"))
+func RegisterPool(db *sql.DB, peer string) (unregister func()) {
+	return fdooze.RegisterPool(fdooze.Pool{
+		Name:     "database/sql " + peer,
+		Owns:     fdooze.OwnedByPeer(peer),
+		Capacity: func() int { return db.Stats().OpenConnections },
+	})
+}
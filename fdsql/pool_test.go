@@ -0,0 +1,115 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/thediveo/fdooze"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// dialDriver is a database/sql driver that simply dials TCP connections to the
+// data source name address, sufficient for warming up connection pools.
+type dialDriver struct{}
+
+type dialConn struct{ net.Conn }
+
+func (dialDriver) Open(name string) (driver.Conn, error) {
+	conn, err := net.Dial("tcp", name)
+	if err != nil {
+		return nil, err
+	}
+	return &dialConn{conn}, nil
+}
+
+func (c *dialConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *dialConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("fdooze-dial", dialDriver{})
+}
+
+var _ = Describe("database/sql connection pools", func() {
+
+	It("subtracts fds held by registered database/sql pools", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		conns := make(chan net.Conn, 10)
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conns <- conn
+			}
+		}()
+		DeferCleanup(func() {
+			l.Close()
+			for {
+				select {
+				case conn := <-conns:
+					conn.Close()
+				default:
+					return
+				}
+			}
+		})
+		peer := l.Addr().String()
+		port := l.Addr().(*net.TCPAddr).Port
+
+		goodfds := fdooze.Filedescriptors()
+		db, err := sql.Open("fdooze-dial", peer)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		db.SetMaxIdleConns(2)
+
+		ctx := context.Background()
+		conn1, err := db.Conn(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		conn2, err := db.Conn(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		conn1.Close()
+		conn2.Close()
+		Expect(db.Stats().OpenConnections).To(Equal(2))
+
+		serverSide := fdooze.Fd().WithLocalPort(port).Build() // the server's accepted connections
+		Expect(fdooze.Filedescriptors()).To(fdooze.HaveLeakedFds(goodfds, serverSide))
+
+		unregister := RegisterPool(db, peer)
+		Expect(fdooze.Filedescriptors()).NotTo(fdooze.HaveLeakedFds(goodfds, serverSide))
+
+		leaky, err := net.Dial("tcp", peer)
+		Expect(err).NotTo(HaveOccurred())
+		defer leaky.Close()
+		m := fdooze.HaveLeakedFds(goodfds, serverSide)
+		Expect(m.Match(fdooze.Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(HavePrefix("Expected to leak 1 file descriptors:"))
+
+		unregister()
+		Expect(m.Match(fdooze.Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(HavePrefix("Expected to leak 3 file descriptors:"))
+	})
+
+})
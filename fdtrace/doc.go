@@ -0,0 +1,45 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+/*
+Package fdtrace supervises short-lived processes using ptrace(2) in order to
+detect exit-time fd leaks: fds that a process never closes before exiting. As
+such processes are usually gone before their fds could be inspected, [Run]
+starts the process as a tracee, records every syscall opening or closing an
+fd, and snapshots the process's fds right before it exits.
+
+	trace, err := fdtrace.Run(exec.Command("./frobnicate", "--once"))
+	Expect(err).NotTo(HaveOccurred())
+	report, err := trace.LeakReport()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(report.Leaks).To(BeEmpty())
+
+The fds inherited by the process when it exec'ed are never considered to be
+leaked, as they are closed by the kernel upon exit anyway. Leaked fds are
+annotated with the syscall that opened them, pointing at the culpable code.
+
+Where the calling process isn't allowed to ptrace, but strace(1) is available
+to the test harness, [ReadStrace] reconstructs the fd lifecycle from the output
+of “strace -f -y -e trace=%desc,%process” instead.
+
+	log, err := fdtrace.ReadStrace(straceOutput)
+	Expect(err).NotTo(HaveOccurred())
+	report, err := log.LeakReport()
+
+Tracing requires the calling process to be allowed to ptrace its own children,
+which might be prohibited in some sandboxes and containers, and Linux 5.3 or
+later. Only syscalls of the native architecture are interpreted. Threads of
+the traced process are followed, but forked children are not.
+*/
+package fdtrace
@@ -0,0 +1,672 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdtrace
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+)
+
+// StraceLog is the fd lifecycle of a process reconstructed from the output of
+// strace(1); see [ReadStrace].
+type StraceLog struct {
+	PID    int             // PID of the traced process, or 0 if strace didn't log it.
+	Events []Event         // fd events in the order of the syscalls returning.
+	Exited bool            // true if the traced process was logged exiting.
+	Status unix.WaitStatus // wait status of the exited process.
+
+	open *fdTable // fds opened in the log and still open at its end.
+}
+
+// loggedFd is an fd opened in an strace log.
+type loggedFd struct {
+	event   Event  // event opening the fd.
+	link    string // fd link destination, if decorated by “strace -y”.
+	path    string // path argument of the opening syscall, if any.
+	cloexec bool   // close-on-exec flag.
+	socket  loggedSocket
+}
+
+// fdTable is the fd table of one or more logged tracees, sharing the same
+// table.
+type fdTable struct {
+	fds map[int]loggedFd
+}
+
+// fdNos returns the sorted numbers of the fds in this table.
+func (t *fdTable) fdNos() []int {
+	fdNos := make([]int, 0, len(t.fds))
+	for fdNo := range t.fds {
+		fdNos = append(fdNos, fdNo)
+	}
+	slices.Sort(fdNos)
+	return fdNos
+}
+
+// straceRecord is a completed syscall or an exit notification in an strace
+// log.
+type straceRecord struct {
+	seq     int              // line number of the syscall entry or exit notification.
+	tid     int              // ID of the logging tracee, or 0 if not logged.
+	syscall string           // syscall name; empty for exit notifications.
+	args    []string         // syscall arguments as logged.
+	ret     string           // return value as logged, such as "3</dev/null>".
+	forks   bool             // syscall creates a new tracee.
+	status  *unix.WaitStatus // wait status of an exit notification.
+}
+
+// pendingCall is an unfinished syscall in an strace log.
+type pendingCall struct {
+	seq  int
+	text string
+}
+
+// ReadStrace reads the output of “strace -f -e trace=%desc” from the specified
+// reader until EOF and reconstructs the fd lifecycle of the traced process
+// from it. This is an alternative to [Run] where the calling process isn't
+// allowed to ptrace, but an strace can be run by the test harness instead.
+//
+// ReadStrace understands the output of strace's -f, -o, -t, -tt, -ttt, -r,
+// -T, -y and -yy options, including unfinished and resumed syscalls. Logging
+// with -y is recommended, as the fd links then identify the leaked fds more
+// precisely. Additionally tracing the %process syscalls allows ReadStrace to
+// tell forked children with their own fd tables apart from threads, and to
+// close the close-on-exec fds upon exec. Otherwise, all tracees are
+// considered to be threads sharing the fd table of the traced process. The
+// traced process is the tracee logged first; lines logged without any tracee
+// ID are attributed to the traced process.
+func ReadStrace(r io.Reader) (*StraceLog, error) {
+	records, err := readStraceRecords(r)
+	if err != nil {
+		return nil, err
+	}
+	s := &StraceLog{}
+	if len(records) == 0 {
+		s.open = &fdTable{}
+		return s, nil
+	}
+	s.PID = records[0].tid
+	main := &fdTable{fds: map[int]loggedFd{}}
+	tables := map[int]*fdTable{}
+	tableOf := func(tid int) *fdTable {
+		table, ok := tables[tid]
+		if !ok {
+			table = main
+			tables[tid] = table
+		}
+		return table
+	}
+	for _, rec := range records {
+		table := tableOf(rec.tid)
+		switch {
+		case rec.status != nil:
+			if rec.tid == s.PID || (s.PID == 0 && table == main) {
+				s.Exited = true
+				s.Status = *rec.status
+			}
+		case rec.forks:
+			child, _, ok := parseRet(rec.ret)
+			if !ok || child <= 0 {
+				continue
+			}
+			if slices.ContainsFunc(rec.args, func(arg string) bool {
+				return strings.Contains(arg, "CLONE_FILES")
+			}) {
+				tables[int(child)] = table
+				continue
+			}
+			tables[int(child)] = &fdTable{fds: maps.Clone(table.fds)}
+		default:
+			s.replay(table, table == main, rec)
+		}
+	}
+	s.open = main
+	return s, nil
+}
+
+// readStraceRecords reads the completed syscalls and exit notifications from
+// the specified strace output, in the order of their effects on the fd
+// tables: syscalls creating new tracees take effect when they are entered,
+// all other syscalls when they return. Malformed lines are skipped.
+func readStraceRecords(r io.Reader) ([]straceRecord, error) {
+	var records []straceRecord
+	pending := map[int]pendingCall{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for seq := 0; scanner.Scan(); seq++ {
+		tid, text := splitStraceLine(scanner.Text())
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			if status, ok := parseExitNotification(text); ok {
+				records = append(records, straceRecord{seq: seq, tid: tid, status: &status})
+			}
+			continue
+		case strings.HasSuffix(text, "<unfinished ...>"):
+			pending[tid] = pendingCall{
+				seq:  seq,
+				text: strings.TrimSpace(strings.TrimSuffix(text, "<unfinished ...>")),
+			}
+			continue
+		case strings.HasPrefix(text, "<... "):
+			_, rest, ok := strings.Cut(text, " resumed>")
+			call, known := pending[tid]
+			if !ok || !known {
+				continue
+			}
+			delete(pending, tid)
+			rec, ok := parseStraceCall(call.text + rest)
+			if !ok {
+				continue
+			}
+			rec.seq, rec.tid = seq, tid
+			if rec.forks {
+				rec.seq = call.seq
+			}
+			records = append(records, rec)
+			continue
+		}
+		rec, ok := parseStraceCall(text)
+		if !ok {
+			continue
+		}
+		rec.seq, rec.tid = seq, tid
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(records, func(a, b straceRecord) int { return a.seq - b.seq })
+	return records, nil
+}
+
+// replay applies the effects of the specified successfully completed syscall
+// to the fd table of the logging tracee, recording the fd events only for the
+// fd table of the traced process.
+func (s *StraceLog) replay(table *fdTable, traced bool, rec straceRecord) {
+	ret, link, ok := parseRet(rec.ret)
+	if ok && ret < 0 && rec.syscall == "connect" && strings.Contains(rec.ret, "EINPROGRESS") {
+		ret = 0 // non-blocking connect in progress.
+	}
+	if !ok || ret < 0 {
+		return
+	}
+	opened := func(fdNo int, link string) {
+		fd := loggedFd{
+			event:   Event{TID: rec.tid, Syscall: rec.syscall, Op: Opened, FdNo: fdNo},
+			link:    link,
+			path:    pathArg(rec.args),
+			cloexec: cloexecFlag(rec.syscall, rec.args),
+			socket:  socketFromLink(link),
+		}
+		switch rec.syscall {
+		case "socket", "socketpair":
+			if s := socketFromArgs(rec.args); s.known {
+				fd.socket = s
+			}
+		case "accept", "accept4":
+			if listener, ok := fdArg(table, rec.args, 0); ok && listener.socket.known {
+				fd.socket = loggedSocket{
+					known:    true,
+					domain:   listener.socket.domain,
+					typ:      listener.socket.typ,
+					protocol: listener.socket.protocol,
+					peer:     fd.socket.peer,
+				}
+				if len(rec.args) > 1 && fd.socket.peer == "" {
+					fd.socket.peer = sockaddrArg(rec.args[1])
+				}
+			}
+		case "dup", "dup2", "dup3", "fcntl":
+			// the new fd refers to the same open file description.
+			if src, ok := fdArg(table, rec.args, 0); ok {
+				fd.path, fd.socket = src.path, src.socket
+				if fd.link == "" {
+					fd.link = src.link
+				}
+			}
+		}
+		table.fds[fdNo] = fd
+		if traced {
+			s.Events = append(s.Events, fd.event)
+		}
+	}
+	closed := func(fdNo int, syscall string) {
+		delete(table.fds, fdNo)
+		if traced {
+			s.Events = append(s.Events, Event{TID: rec.tid, Syscall: syscall, Op: Closed, FdNo: fdNo})
+		}
+	}
+	switch rec.syscall {
+	case "execve", "execveat":
+		for _, fdNo := range table.fdNos() {
+			if table.fds[fdNo].cloexec {
+				closed(fdNo, rec.syscall)
+			}
+		}
+		return
+	case "fcntl":
+		if len(rec.args) == 3 && rec.args[1] == "F_SETFD" {
+			setCloexec(table, rec.args[0], strings.Contains(rec.args[2], "FD_CLOEXEC"))
+			return
+		}
+	case "ioctl":
+		if len(rec.args) >= 2 && (rec.args[1] == "FIOCLEX" || rec.args[1] == "FIONCLEX") {
+			setCloexec(table, rec.args[0], rec.args[1] == "FIOCLEX")
+		}
+		return
+	case "bind", "connect", "listen":
+		updateSocket(table, rec)
+		return
+	}
+	sc, ok := straceSyscalls()[rec.syscall]
+	if !ok {
+		return
+	}
+	switch sc.kind {
+	case opensFd:
+		switch sc.name {
+		case "fcntl":
+			if len(rec.args) < 2 || (rec.args[1] != "F_DUPFD" && rec.args[1] != "F_DUPFD_CLOEXEC") {
+				return
+			}
+		case "signalfd", "signalfd4":
+			if len(rec.args) == 0 || rec.args[0] != "-1" {
+				return // updates the signal mask of an existing signalfd.
+			}
+		case "dup2", "dup3":
+			// duplicating onto an open fd silently closes it first, unless
+			// it is the same fd.
+			if len(rec.args) > 0 {
+				if src, _, ok := parseRet(rec.args[0]); ok && src == ret {
+					return
+				}
+			}
+			if _, ok := table.fds[int(ret)]; ok {
+				closed(int(ret), rec.syscall)
+			}
+		}
+		opened(int(ret), link)
+	case opensFdPair:
+		if sc.pairArg >= len(rec.args) {
+			return
+		}
+		for _, arg := range splitArgs(strings.Trim(rec.args[sc.pairArg], "[]")) {
+			if fdNo, link, ok := parseRet(arg); ok && fdNo >= 0 {
+				opened(int(fdNo), link)
+			}
+		}
+	case closesFd:
+		if len(rec.args) == 0 {
+			return
+		}
+		if fdNo, _, ok := parseRet(rec.args[0]); ok && fdNo >= 0 {
+			closed(int(fdNo), rec.syscall)
+		}
+	case closesRange:
+		if len(rec.args) != 3 {
+			return
+		}
+		first, last := rangeArg(rec.args[0]), rangeArg(rec.args[1])
+		cloexec := strings.Contains(rec.args[2], "CLOSE_RANGE_CLOEXEC")
+		for _, fdNo := range table.fdNos() {
+			if uint32(fdNo) < first || uint32(fdNo) > last {
+				continue
+			}
+			if cloexec {
+				fd := table.fds[fdNo]
+				fd.cloexec = true
+				table.fds[fdNo] = fd
+				continue
+			}
+			closed(fdNo, rec.syscall)
+		}
+	}
+}
+
+// straceSyscalls returns the syscalls opening or closing fds by their names.
+var straceSyscalls = sync.OnceValue(func() map[string]fdSyscall {
+	syscalls := make(map[string]fdSyscall, len(fdSyscalls))
+	for _, sc := range fdSyscalls {
+		syscalls[sc.name] = sc
+	}
+	return syscalls
+})
+
+// forkingSyscalls are the syscalls creating new tracees, returning their IDs.
+var forkingSyscalls = map[string]bool{
+	"clone": true, "clone3": true, "fork": true, "vfork": true,
+}
+
+// splitStraceLine splits a line of strace output into the ID of the logging
+// tracee, if any, and the logged text, skipping any timestamp. The tracee ID
+// is either logged as “[pid N]” or, when logging into a file, as a leading
+// number.
+func splitStraceLine(line string) (int, string) {
+	tid := 0
+	text := strings.TrimSpace(line)
+	if rest, ok := strings.CutPrefix(text, "[pid "); ok {
+		if id, rest, ok := strings.Cut(rest, "]"); ok {
+			tid, _ = strconv.Atoi(strings.TrimSpace(id))
+			text = strings.TrimSpace(rest)
+		}
+	} else if id, rest, ok := strings.Cut(text, " "); ok && strings.Trim(id, "0123456789") == "" {
+		tid, _ = strconv.Atoi(id)
+		text = strings.TrimSpace(rest)
+	}
+	if stamp, rest, ok := strings.Cut(text, " "); ok &&
+		strings.Trim(stamp, "0123456789:.") == "" && strings.ContainsAny(stamp, ":.") {
+		text = strings.TrimSpace(rest)
+	}
+	return tid, text
+}
+
+// parseExitNotification returns the wait status from an exit notification in
+// the form of “+++ exited with N +++” or “+++ killed by SIGNAL +++”.
+func parseExitNotification(text string) (unix.WaitStatus, bool) {
+	text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "+++ "), "+++"))
+	if code, ok := strings.CutPrefix(text, "exited with "); ok {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			return 0, false
+		}
+		return unix.WaitStatus(status&0xff) << 8, true
+	}
+	if signal, ok := strings.CutPrefix(text, "killed by "); ok {
+		signal, core := strings.CutSuffix(signal, " (core dumped)")
+		sig := unix.SignalNum(signal)
+		if sig == 0 {
+			return 0, false
+		}
+		status := unix.WaitStatus(sig)
+		if core {
+			status |= 0x80
+		}
+		return status, true
+	}
+	return 0, false
+}
+
+// parseStraceCall parses a completed syscall logged in the form of
+// “NAME(ARGS) = RET”, where strace might pad the “=” with additional spaces.
+func parseStraceCall(text string) (straceRecord, bool) {
+	open := strings.IndexByte(text, '(')
+	eq := strings.LastIndex(text, " = ")
+	if open <= 0 || eq < open {
+		return straceRecord{}, false
+	}
+	name := text[:open]
+	if strings.TrimLeft(name, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+		return straceRecord{}, false
+	}
+	args, ok := strings.CutSuffix(strings.TrimRight(text[open+1:eq], " "), ")")
+	if !ok {
+		return straceRecord{}, false
+	}
+	return straceRecord{
+		syscall: name,
+		args:    splitArgs(args),
+		ret:     strings.TrimSpace(text[eq+3:]),
+		forks:   forkingSyscalls[name],
+	}, true
+}
+
+// splitArgs splits logged syscall arguments at the commas outside any quotes
+// and brackets, such as the brackets of arrays, structs, and fd links.
+func splitArgs(args string) []string {
+	var split []string
+	var brackets []byte
+	quoted := false
+	start := 0
+	for pos := 0; pos < len(args); pos++ {
+		switch ch := args[pos]; {
+		case quoted:
+			switch ch {
+			case '\\':
+				pos++
+			case '"':
+				quoted = false
+			}
+		case ch == '"':
+			quoted = true
+		case ch == '(' || ch == '[' || ch == '{' || ch == '<':
+			brackets = append(brackets, ch)
+		case ch == ')' || ch == ']' || ch == '}' || ch == '>':
+			if len(brackets) > 0 && brackets[len(brackets)-1] == openingBracket[ch] {
+				brackets = brackets[:len(brackets)-1]
+			}
+		case ch == ',' && len(brackets) == 0:
+			split = append(split, strings.TrimSpace(args[start:pos]))
+			start = pos + 1
+		}
+	}
+	if rest := strings.TrimSpace(args[start:]); rest != "" || len(split) > 0 {
+		split = append(split, rest)
+	}
+	return split
+}
+
+// openingBracket maps closing brackets to their opening counterparts.
+var openingBracket = map[byte]byte{')': '(', ']': '[', '}': '{', '>': '<'}
+
+// parseRet parses a logged fd or return value in the form of “N”, optionally
+// followed by the fd link in the form of “<LINK>” when logging with -y or
+// -yy. Details appended by -yy to fd links of device files are dropped.
+func parseRet(text string) (int64, string, bool) {
+	end := 0
+	for end < len(text) && (text[end] >= '0' && text[end] <= '9' || (end == 0 && text[end] == '-')) {
+		end++
+	}
+	val, err := strconv.ParseInt(text[:end], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	text = text[end:]
+	if !strings.HasPrefix(text, "<") {
+		return val, "", true
+	}
+	depth := 0
+	for pos := 0; pos < len(text); pos++ {
+		switch text[pos] {
+		case '[':
+			// fd links of sockets might contain "->", so skip over them,
+			// including the nested brackets of IPv6 addresses.
+			nested := 0
+		skipping:
+			for ; pos < len(text); pos++ {
+				switch text[pos] {
+				case '[':
+					nested++
+				case ']':
+					if nested--; nested == 0 {
+						break skipping
+					}
+				}
+			}
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				link, _, _ := strings.Cut(text[1:pos], "<")
+				return val, link, true
+			}
+		}
+	}
+	return val, "", true
+}
+
+// pathArg returns the (unquoted) path argument of a syscall opening a file,
+// if any.
+func pathArg(args []string) string {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, `"`) {
+			continue
+		}
+		if path, err := strconv.Unquote(arg); err == nil {
+			return path
+		}
+		return strings.Trim(arg, `"`)
+	}
+	return ""
+}
+
+// cloexecFlag returns true if the specified syscall opens new fds with their
+// close-on-exec flags set, either due to a *_CLOEXEC flag argument or because
+// the syscall always does so.
+func cloexecFlag(syscall string, args []string) bool {
+	switch syscall {
+	case "pidfd_open", "pidfd_getfd", "io_uring_setup":
+		return true
+	}
+	return slices.ContainsFunc(args, func(arg string) bool {
+		return strings.Contains(arg, "CLOEXEC")
+	})
+}
+
+// fdArg returns the logged fd passed as the specified argument, if known.
+func fdArg(table *fdTable, args []string, idx int) (loggedFd, bool) {
+	if idx >= len(args) {
+		return loggedFd{}, false
+	}
+	fdNo, _, ok := parseRet(args[idx])
+	if !ok {
+		return loggedFd{}, false
+	}
+	fd, ok := table.fds[int(fdNo)]
+	return fd, ok
+}
+
+// updateSocket updates the local address, peer address, or listening state of
+// the socket passed to a successful bind(2), connect(2), or listen(2).
+func updateSocket(table *fdTable, rec straceRecord) {
+	fd, ok := fdArg(table, rec.args, 0)
+	if !ok {
+		return
+	}
+	switch rec.syscall {
+	case "bind":
+		if len(rec.args) > 1 {
+			fd.socket.local = sockaddrArg(rec.args[1])
+		}
+	case "connect":
+		if len(rec.args) > 1 {
+			fd.socket.peer = sockaddrArg(rec.args[1])
+		}
+	case "listen":
+		fd.socket.listening = true
+	}
+	table.fds[fd.event.FdNo] = fd
+}
+
+// setCloexec sets or clears the close-on-exec flag of the specified fd.
+func setCloexec(table *fdTable, arg string, cloexec bool) {
+	fdNo, _, ok := parseRet(arg)
+	if !ok {
+		return
+	}
+	if fd, ok := table.fds[int(fdNo)]; ok {
+		fd.cloexec = cloexec
+		table.fds[int(fdNo)] = fd
+	}
+}
+
+// rangeArg returns the fd number from a close_range(2) range argument, where
+// strace might log the maximum fd number as “~0U”.
+func rangeArg(arg string) uint32 {
+	fdNo, err := strconv.ParseUint(arg, 0, 32)
+	if err != nil {
+		return math.MaxUint32
+	}
+	return uint32(fdNo)
+}
+
+// Origin returns the event that opened the specified fd number and true, if
+// the fd was opened by the traced process and not closed afterwards.
+// Otherwise, it returns false.
+func (s *StraceLog) Origin(fdNo int) (Event, bool) {
+	return origin(s.Events, fdNo)
+}
+
+// LeakReport returns a [fdooze.LeakReport] listing the fds the traced process
+// opened, but didn't close before exiting. As strace doesn't log the fds
+// inherited by the traced process, the fd number compaction of the report
+// only accounts for the fds opened by the traced process. The leaks are
+// described using their fd links, if logged, otherwise the paths passed to
+// the syscalls opening them. The leaks are keyed the same as leaks discovered
+// from procfs as far as the log allows, such as keying sockets by their
+// domains, types, protocols, and addresses as logged by their socket, bind,
+// listen, connect, and accept syscalls, so that the report can be compared
+// with procfs-derived reports using [fdooze.LeakReport.DiffAgainst].
+func (s *StraceLog) LeakReport() (fdooze.LeakReport, error) {
+	if !s.Exited {
+		return fdooze.LeakReport{}, errors.New("traced process wasn't logged exiting")
+	}
+	fdNos := s.open.fdNos()
+	report := fdooze.LeakReport{
+		Leaks:      make([]fdooze.LeakedFd, 0, len(fdNos)),
+		Compaction: fdooze.FdCompaction{MaxFd: -1, Open: len(fdNos)},
+	}
+	for _, fdNo := range fdNos {
+		fd := s.open.fds[fdNo]
+		report.Compaction.MaxFd = fdNo
+		report.Leaks = append(report.Leaks, fdooze.LeakedFd{
+			FdNo:        fdNo,
+			Key:         fd.key(),
+			Description: fd.description(),
+		})
+	}
+	return report, nil
+}
+
+// description returns a multi-line textual description of the logged fd.
+func (f loggedFd) description() string {
+	desc := fmt.Sprintf("fd %d", f.event.FdNo)
+	indent := filedesc.Indentation(1)
+	switch {
+	case strings.HasPrefix(f.link, "/"):
+		desc += fmt.Sprintf("\n%spath: %q", indent, redact(f.link))
+	case f.link != "":
+		desc += fmt.Sprintf("\n%slink: %q", indent, f.link)
+	case f.path != "":
+		desc += fmt.Sprintf("\n%spath: %q", indent, redact(f.path))
+	}
+	desc += fmt.Sprintf("\n%sopened by %s(2)", indent, f.event.Syscall)
+	if f.event.TID != 0 {
+		desc += fmt.Sprintf(" in thread %d", f.event.TID)
+	}
+	return desc
+}
+
+// redact returns the specified value redacted using [fdooze.Redact].
+func redact(value string) string {
+	if fdooze.Redact == nil {
+		return value
+	}
+	return fdooze.Redact(value)
+}
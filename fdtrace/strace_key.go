@@ -0,0 +1,292 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdtrace
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+)
+
+// loggedSocket are the socket properties logged in an strace log, as far as
+// known.
+type loggedSocket struct {
+	known     bool // domain, type, and protocol are known.
+	domain    filedesc.SocketDomain
+	typ       filedesc.SocketType
+	protocol  filedesc.SocketProtocol
+	listening bool
+	local     string // local address in the format of filedesc.SocketFd.Name.
+	peer      string // peer address in the format of filedesc.SocketFd.Peer.
+}
+
+// key returns the run-independent key of the logged fd for comparing leaks
+// across runs, using the same keys as for leaks discovered from procfs where
+// the strace log allows. Logging with -y, or better -yy, thus allows comparing
+// strace-derived and procfs-derived leak reports.
+func (f loggedFd) key() string {
+	if f.socket.known {
+		return fdooze.SocketLeakKey(f.socket.domain, f.socket.typ, f.socket.protocol,
+			f.socket.listening, f.socket.local, f.socket.peer)
+	}
+	switch link := f.link; {
+	case strings.HasPrefix(link, "/dev/shm/"):
+		return "shm " + redact(link)
+	case strings.HasPrefix(link, "/"):
+		return "path " + redact(link)
+	case strings.HasPrefix(link, "pipe:"):
+		return "pipe"
+	case strings.HasPrefix(link, "anon_inode:"):
+		return "anon_inode " + strings.Trim(strings.TrimPrefix(link, "anon_inode:"), "[]")
+	case link != "":
+		if nstype, _, ok := strings.Cut(link, ":["); ok && namespaceTypes[nstype] {
+			return "namespace " + nstype
+		}
+		return "socket"
+	}
+	if ftype, ok := anonInodeSyscalls[f.event.Syscall]; ok {
+		return "anon_inode " + ftype
+	}
+	switch f.event.Syscall {
+	case "pipe", "pipe2":
+		return "pipe"
+	case "socket", "socketpair", "accept", "accept4":
+		return "socket"
+	case "memfd_create":
+		return "path " + redact("/memfd:"+f.path+" (deleted)")
+	}
+	if f.path == "" {
+		return "unknown"
+	}
+	return "path " + redact(f.path)
+}
+
+// namespaceTypes are the types of namespaces as they appear in fd links.
+var namespaceTypes = map[string]bool{
+	"cgroup": true, "ipc": true, "mnt": true, "net": true,
+	"pid": true, "time": true, "user": true, "uts": true,
+}
+
+// anonInodeSyscalls maps the syscalls opening anonymous inode fds to the file
+// types of the anonymous inodes, for logs without fd links.
+var anonInodeSyscalls = map[string]string{
+	"eventfd":         "eventfd",
+	"eventfd2":        "eventfd",
+	"epoll_create":    "eventpoll",
+	"epoll_create1":   "eventpoll",
+	"signalfd":        "signalfd",
+	"signalfd4":       "signalfd",
+	"timerfd_create":  "timerfd",
+	"inotify_init":    "inotify",
+	"inotify_init1":   "inotify",
+	"fanotify_init":   "fanotify",
+	"pidfd_open":      "pidfd",
+	"userfaultfd":     "userfaultfd",
+	"io_uring_setup":  "io_uring",
+	"perf_event_open": "perf_event",
+	"fsopen":          "fscontext",
+	"fspick":          "fscontext",
+}
+
+// socketFromArgs returns the socket properties from the domain, type, and
+// protocol arguments of a socket(2) or socketpair(2) syscall.
+func socketFromArgs(args []string) loggedSocket {
+	if len(args) < 3 {
+		return loggedSocket{}
+	}
+	domain, ok := lookupName(args[0], socketNames().domains)
+	if !ok {
+		return loggedSocket{}
+	}
+	typName, _, _ := strings.Cut(args[1], "|")
+	typ, ok := lookupName(typName, socketNames().types)
+	if !ok {
+		return loggedSocket{}
+	}
+	protocols := socketNames().ipProtocols
+	if domain == unix.AF_NETLINK {
+		protocols = socketNames().nlProtocols
+	}
+	protocol, ok := lookupName(args[2], protocols)
+	if !ok {
+		return loggedSocket{}
+	}
+	return loggedSocket{
+		known:    true,
+		domain:   filedesc.SocketDomain(domain),
+		typ:      filedesc.SocketType(typ),
+		protocol: filedesc.SocketProtocol(defaultProtocol(domain, typ, protocol)),
+	}
+}
+
+// defaultProtocol returns the protocol the kernel picks for the specified
+// protocol argument of socket(2), as the protocol discovered from procfs is
+// the one picked by the kernel.
+func defaultProtocol(domain, typ, protocol int) int {
+	if protocol != 0 || (domain != unix.AF_INET && domain != unix.AF_INET6) {
+		return protocol
+	}
+	switch typ {
+	case unix.SOCK_STREAM:
+		return unix.IPPROTO_TCP
+	case unix.SOCK_DGRAM:
+		return unix.IPPROTO_UDP
+	}
+	return protocol
+}
+
+// socketFromLink returns the socket properties from an fd link as logged by
+// “strace -yy”, such as “TCP:[127.0.0.1:8080->127.0.0.1:43210]” or
+// “UNIX-STREAM:[4711,"/run/foo.sock"]”.
+func socketFromLink(link string) loggedSocket {
+	proto, addrs, ok := strings.Cut(link, ":[")
+	if !ok {
+		return loggedSocket{}
+	}
+	addrs = strings.TrimSuffix(addrs, "]")
+	var s loggedSocket
+	switch proto {
+	case "TCP", "TCPv6", "UDP", "UDPv6":
+		s = loggedSocket{known: true,
+			domain: unix.AF_INET, typ: unix.SOCK_STREAM, protocol: unix.IPPROTO_TCP}
+		if strings.HasSuffix(proto, "v6") {
+			s.domain = unix.AF_INET6
+		}
+		if strings.HasPrefix(proto, "UDP") {
+			s.typ, s.protocol = unix.SOCK_DGRAM, unix.IPPROTO_UDP
+		}
+		if _, err := strconv.ParseUint(addrs, 10, 64); err == nil {
+			return s // only the inode number, but no addresses.
+		}
+		s.local, s.peer, _ = strings.Cut(addrs, "->")
+	case "UNIX-STREAM", "UNIX-DGRAM", "UNIX-SEQPACKET":
+		s = loggedSocket{known: true, domain: unix.AF_UNIX, typ: unix.SOCK_STREAM}
+		switch proto {
+		case "UNIX-DGRAM":
+			s.typ = unix.SOCK_DGRAM
+		case "UNIX-SEQPACKET":
+			s.typ = unix.SOCK_SEQPACKET
+		}
+		if _, path, ok := strings.Cut(addrs, ","); ok {
+			s.local, _ = strconv.Unquote(path)
+		}
+	}
+	return s
+}
+
+// sockaddrArg returns the address in the format of [filedesc.SocketFd.Name]
+// from a socket address argument as logged by strace, such as
+// “{sa_family=AF_INET, sin_port=htons(80), sin_addr=inet_addr("127.0.0.1")}”.
+// It returns "" for unnamed and unsupported socket addresses.
+func sockaddrArg(arg string) string {
+	fields := map[string]string{}
+	for _, field := range splitArgs(strings.TrimSuffix(strings.TrimPrefix(arg, "{"), "}")) {
+		if name, value, ok := strings.Cut(field, "="); ok {
+			fields[name] = value
+			continue
+		}
+		// IPv6 addresses are logged as “inet_pton(AF_INET6, "::1", &sin6_addr)”.
+		if inner, ok := strings.CutPrefix(field, "inet_pton("); ok {
+			if args := splitArgs(strings.TrimSuffix(inner, ")")); len(args) == 3 {
+				fields[strings.TrimPrefix(args[2], "&")] = args[1]
+			}
+		}
+	}
+	port := func(value string) string {
+		return strings.TrimSuffix(strings.TrimPrefix(value, "htons("), ")")
+	}
+	switch fields["sa_family"] {
+	case "AF_INET":
+		addr := strings.TrimSuffix(strings.TrimPrefix(fields["sin_addr"], "inet_addr("), ")")
+		ip := net.ParseIP(unquote(addr))
+		if ip == nil {
+			return ""
+		}
+		return fmt.Sprintf("%s:%s", ip, port(fields["sin_port"]))
+	case "AF_INET6":
+		ip := net.ParseIP(unquote(fields["sin6_addr"]))
+		if ip == nil {
+			return ""
+		}
+		if zone, err := strconv.Atoi(fields["sin6_scope_id"]); err == nil && zone != 0 {
+			return fmt.Sprintf("[%s%%%d]:%s", ip, zone, port(fields["sin6_port"]))
+		}
+		return fmt.Sprintf("[%s]:%s", ip, port(fields["sin6_port"]))
+	case "AF_UNIX":
+		path := fields["sun_path"]
+		if abstract, ok := strings.CutPrefix(path, "@"); ok {
+			return "@" + unquote(abstract)
+		}
+		return unquote(path)
+	}
+	return ""
+}
+
+// unquote returns the specified value without its double quotes, if quoted.
+func unquote(value string) string {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return unquoted
+	}
+	return value
+}
+
+// lookupName returns the value of the specified symbolic constant name, or the
+// value of a numeric argument.
+func lookupName(name string, values map[string]int) (int, bool) {
+	if value, err := strconv.Atoi(name); err == nil {
+		return value, true
+	}
+	value, ok := values[name]
+	return value, ok
+}
+
+// socketNames returns the values of the symbolic names of socket domains,
+// types, and protocols, as logged by strace.
+var socketNames = sync.OnceValue(func() (names struct {
+	domains, types, ipProtocols, nlProtocols map[string]int
+}) {
+	names.domains = map[string]int{}
+	names.types = map[string]int{}
+	names.ipProtocols = map[string]int{}
+	names.nlProtocols = map[string]int{}
+	for value := 0; value <= unix.AF_MAX; value++ {
+		if name := filedesc.SocketDomain(value).String(); strings.HasPrefix(name, "AF_") {
+			names.domains[name] = value
+		}
+	}
+	for value := 0; value <= unix.SOCK_PACKET; value++ {
+		if name := filedesc.SocketType(value).String(); strings.HasPrefix(name, "SOCK_") {
+			names.types[name] = value
+		}
+	}
+	for value := 0; value <= 0xff; value++ {
+		if name := filedesc.SocketProtocol(value).String(unix.AF_INET); strings.HasPrefix(name, "IPPROTO_") {
+			names.ipProtocols[name] = value
+		}
+		if name := filedesc.SocketProtocol(value).String(unix.AF_NETLINK); strings.HasPrefix(name, "NETLINK_") {
+			names.nlProtocols[name] = value
+		}
+	}
+	names.ipProtocols["IPPROTO_MPTCP"] = unix.IPPROTO_MPTCP
+	return
+})
@@ -0,0 +1,232 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdtrace
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing/iotest"
+
+	"github.com/thediveo/fdooze"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const straceSingle = `execve("/bin/sh", ["/bin/sh", "-c", "frobnicate"], 0x7ffd6d0ea0f8 /* 20 vars */) = 0
+openat(AT_FDCWD, "/etc/ld.so.cache", O_RDONLY|O_CLOEXEC) = 3</etc/ld.so.cache>
+close(3</etc/ld.so.cache>)              = 0
+openat(AT_FDCWD, "/dev/null", O_RDONLY) = 3</dev/null<char 1:3>>
+fcntl(3</dev/null<char 1:3>>, F_DUPFD, 10) = 10</dev/null<char 1:3>>
+close(3</dev/null<char 1:3>>)           = 0
+pipe2([3<pipe:[4711]>, 4<pipe:[4711]>], 0) = 0
+close(4<pipe:[4711]>)                   = 0
+openat(AT_FDCWD, "/nonexisting", O_RDONLY) = -1 ENOENT (No such file or directory)
+close(1</dev/pts/0<char 136:0>>)        = 0
+--- SIGCHLD {si_signo=SIGCHLD, si_code=CLD_EXITED, si_pid=4242, si_uid=0, si_status=0} ---
+exit_group(42)                          = ?
++++ exited with 42 +++
+`
+
+const straceForking = `100  execve("/bin/frobnicate", ["frobnicate"], 0x7ffd6d0ea0f8 /* 1 var */) = 0
+100  12:00:00.000001 openat(AT_FDCWD, "/etc/frobnicate.conf", O_RDONLY|O_CLOEXEC) = 3
+100  clone(child_stack=0x7f00, flags=CLONE_VM|CLONE_FS|CLONE_FILES|CLONE_SIGHAND|CLONE_THREAD|CLONE_SYSVSEM, parent_tid=[101], tls=0x7f00, child_tidptr=0x7f00) = 101
+101  socket(AF_INET, SOCK_STREAM|SOCK_CLOEXEC, IPPROTO_IP) = 4
+100  clone(child_stack=NULL, flags=CLONE_CHILD_CLEARTID|CLONE_CHILD_SETTID|SIGCHLD <unfinished ...>
+102  close(3)                           = 0
+102  dup3(4, 0, 0)                      = 0
+102  execve("/bin/true", ["true"], 0x7ffd6d0ea0f8 /* 1 var */) = 0
+100  <... clone resumed>, child_tidptr=0x7f00) = 102
+102  +++ exited with 0 +++
+101  eventfd2(0, EFD_CLOEXEC <unfinished ...>
+100  fcntl(3, F_SETFD, 0)               = 0
+101  <... eventfd2 resumed>)            = 5
+100  ioctl(5, FIOCLEX)                  = 0
+100  close_range(6, ~0U, 0)             = 0
+100  execve("/bin/frobnicate", ["frobnicate", "--again"], 0x7ffd6d0ea0f8 /* 1 var */) = 0
+100  +++ killed by SIGABRT (core dumped) +++
+`
+
+var _ = Describe("reading strace logs", func() {
+
+	It("reconstructs the fd lifecycle of a single process", func() {
+		log, err := ReadStrace(strings.NewReader(straceSingle))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log.PID).To(BeZero())
+		Expect(log.Exited).To(BeTrue())
+		Expect(log.Status.ExitStatus()).To(Equal(42))
+		Expect(log.Events).To(ContainElement(Event{Syscall: "close", Op: Closed, FdNo: 1}))
+		Expect(log.Events).NotTo(ContainElement(HaveField("Syscall", "execve")))
+
+		origin, ok := log.Origin(10)
+		Expect(ok).To(BeTrue())
+		Expect(origin).To(Equal(Event{Syscall: "fcntl", Op: Opened, FdNo: 10}))
+		_, ok = log.Origin(4)
+		Expect(ok).To(BeFalse())
+
+		report, err := log.LeakReport()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Compaction).To(Equal(fdooze.FdCompaction{MaxFd: 10, Open: 2}))
+		Expect(report.Leaks).To(HaveExactElements(
+			fdooze.LeakedFd{
+				FdNo:        3,
+				Key:         "pipe",
+				Description: "fd 3\n    link: \"pipe:[4711]\"\n    opened by pipe2(2)",
+			},
+			fdooze.LeakedFd{
+				FdNo:        10,
+				Key:         "path /dev/null",
+				Description: "fd 10\n    path: \"/dev/null\"\n    opened by fcntl(2)",
+			}))
+	})
+
+	It("tells forked children from threads", func() {
+		log, err := ReadStrace(strings.NewReader(straceForking))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log.PID).To(Equal(100))
+		Expect(log.Exited).To(BeTrue())
+		Expect(log.Status.Signaled()).To(BeTrue())
+		Expect(log.Status.Signal()).To(Equal(unix.SIGABRT))
+		Expect(log.Status.CoreDump()).To(BeTrue())
+
+		Expect(log.Events).To(HaveExactElements(
+			Event{TID: 100, Syscall: "openat", Op: Opened, FdNo: 3},
+			Event{TID: 101, Syscall: "socket", Op: Opened, FdNo: 4},
+			Event{TID: 101, Syscall: "eventfd2", Op: Opened, FdNo: 5},
+			Event{TID: 100, Syscall: "execve", Op: Closed, FdNo: 4},
+			Event{TID: 100, Syscall: "execve", Op: Closed, FdNo: 5},
+		))
+
+		report, err := log.LeakReport()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(HaveExactElements(fdooze.LeakedFd{
+			FdNo:        3,
+			Key:         "path /etc/frobnicate.conf",
+			Description: "fd 3\n    path: \"/etc/frobnicate.conf\"\n    opened by openat(2) in thread 100",
+		}))
+	})
+
+	It("keys leaks the same as procfs discovery", func() {
+		goodfds := fdooze.Filedescriptors()
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		port := l.Addr().(*net.TCPAddr).Port
+		procfs, err := fdooze.NewLeakReport(fdooze.Filedescriptors(), goodfds)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(procfs.Leaks).To(HaveLen(1))
+
+		log, err := ReadStrace(strings.NewReader(fmt.Sprintf(`socket(AF_INET, SOCK_STREAM|SOCK_CLOEXEC|SOCK_NONBLOCK, IPPROTO_IP) = 3<TCP:[4711]>
+bind(3<TCP:[4711]>, {sa_family=AF_INET, sin_port=htons(%[1]d), sin_addr=inet_addr("127.0.0.1")}, 16) = 0
+listen(3<TCP:[127.0.0.1:%[1]d]>, 4096) = 0
+socket(AF_INET6, SOCK_STREAM, 0) = 4
+connect(4, {sa_family=AF_INET6, sin6_port=htons(80), sin6_flowinfo=htonl(0), inet_pton(AF_INET6, "::1", &sin6_addr), sin6_scope_id=0}, 28) = -1 EINPROGRESS (Operation now in progress)
+accept4(3, {sa_family=AF_INET, sin_port=htons(43210), sin_addr=inet_addr("127.0.0.1")}, [16], SOCK_CLOEXEC) = 5
+socket(AF_UNIX, SOCK_STREAM|SOCK_CLOEXEC, 0) = 6
+connect(6, {sa_family=AF_UNIX, sun_path="/run/foo.sock"}, 110) = 0
+eventfd2(0, EFD_CLOEXEC)                = 7
+openat(AT_FDCWD, "/etc/hostname", O_RDONLY) = 8
+dup2(8, 7)                              = 7
+dup(6)                                  = 9
+close(8)                                = 0
+accept(42, NULL, NULL)                  = 10<TCPv6:[[::1]:8080->[::1]:43210]>
+epoll_create1(EPOLL_CLOEXEC)            = 11
+exit_group(0)                           = ?
++++ exited with 0 +++
+`, port)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log.Events).To(ContainElements(
+			Event{Syscall: "dup2", Op: Closed, FdNo: 7},
+			Event{Syscall: "dup2", Op: Opened, FdNo: 7}))
+		report, err := log.LeakReport()
+		Expect(err).NotTo(HaveOccurred())
+		keys := map[int]string{}
+		for _, leak := range report.Leaks {
+			keys[leak.FdNo] = leak.Key
+		}
+		Expect(keys).To(Equal(map[int]string{
+			3:  procfs.Leaks[0].Key,
+			4:  `socket AF_INET6 SOCK_STREAM IPPROTO_TCP peer "[::1]:80"`,
+			5:  `socket AF_INET SOCK_STREAM IPPROTO_TCP peer "127.0.0.1:43210"`,
+			6:  `socket AF_UNIX SOCK_STREAM protocol 0 peer "/run/foo.sock"`,
+			7:  "path /etc/hostname",
+			9:  `socket AF_UNIX SOCK_STREAM protocol 0 peer "/run/foo.sock"`,
+			10: `socket AF_INET6 SOCK_STREAM IPPROTO_TCP peer "[::1]:43210"`,
+			11: "anon_inode eventpoll",
+		}))
+	})
+
+	It("redacts paths", func() {
+		defer func(old func(string) string) { fdooze.Redact = old }(fdooze.Redact)
+		fdooze.Redact = func(string) string { return "<redacted>" }
+		log, err := ReadStrace(strings.NewReader(straceForking))
+		Expect(err).NotTo(HaveOccurred())
+		report, err := log.LeakReport()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(And(
+			HaveField("Key", "path <redacted>"),
+			HaveField("Description", ContainSubstring(`path: "<redacted>"`)))))
+	})
+
+	It("rejects logs without the traced process exiting", func() {
+		log, err := ReadStrace(strings.NewReader(""))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log.LeakReport()).Error().To(MatchError(ContainSubstring("wasn't logged exiting")))
+
+		Expect(ReadStrace(iotest.ErrReader(errors.New("D'OH!")))).Error().To(
+			MatchError("D'OH!"))
+	})
+
+	It("parses logged syscalls", func() {
+		tid, text := splitStraceLine("[pid  4242] 1700000000.123456 close(3) = 0 <0.000010>")
+		Expect(tid).To(Equal(4242))
+		Expect(text).To(Equal("close(3) = 0 <0.000010>"))
+
+		rec, ok := parseStraceCall(text)
+		Expect(ok).To(BeTrue())
+		Expect(rec.syscall).To(Equal("close"))
+		Expect(rec.args).To(Equal([]string{"3"}))
+		Expect(rec.ret).To(Equal("0 <0.000010>"))
+		ret, _, ok := parseRet(rec.ret)
+		Expect(ok).To(BeTrue())
+		Expect(ret).To(BeZero())
+
+		_, ok = parseStraceCall("--- SIGCHLD {si_signo=SIGCHLD} ---")
+		Expect(ok).To(BeFalse())
+		_, ok = parseStraceCall("strace: Process 4243 attached")
+		Expect(ok).To(BeFalse())
+
+		Expect(splitArgs(`"a, b", [1, 2], {x=1, y=2}, 3<TCP:[1.2.3.4:5->6.7.8.9:80]>, f(1, 2)`)).To(
+			HaveExactElements(`"a, b"`, "[1, 2]", "{x=1, y=2}", "3<TCP:[1.2.3.4:5->6.7.8.9:80]>", "f(1, 2)"))
+		Expect(splitArgs("")).To(BeEmpty())
+
+		fdNo, link, ok := parseRet("3<TCP:[1.2.3.4:5->6.7.8.9:80]>")
+		Expect(ok).To(BeTrue())
+		Expect(fdNo).To(Equal(int64(3)))
+		Expect(link).To(Equal("TCP:[1.2.3.4:5->6.7.8.9:80]"))
+		_, _, ok = parseRet("? ERESTARTSYS")
+		Expect(ok).To(BeFalse())
+
+		Expect(rangeArg("4294967295")).To(Equal(uint32(4294967295)))
+		Expect(rangeArg("~0U")).To(Equal(uint32(4294967295)))
+		Expect(rangeArg("3")).To(Equal(uint32(3)))
+	})
+
+})
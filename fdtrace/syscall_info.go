@@ -0,0 +1,71 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdtrace
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// syscallInfo mirrors the kernel's struct ptrace_syscall_info as returned by
+// PTRACE_GET_SYSCALL_INFO, with the union of the entry, exit, and seccomp
+// details flattened into data.
+type syscallInfo struct {
+	op   uint8
+	_    [3]uint8
+	arch uint32
+	ip   uint64
+	sp   uint64
+	data [8]uint64
+}
+
+// nr returns the syscall number at a syscall-entry-stop.
+func (s *syscallInfo) nr() int { return int(s.data[0]) }
+
+// arg returns the specified syscall argument, counting from 0, at a
+// syscall-entry-stop.
+func (s *syscallInfo) arg(idx int) uint64 { return s.data[1+idx] }
+
+// rval returns the syscall's return value at a syscall-exit-stop; it is
+// negative if the syscall failed.
+func (s *syscallInfo) rval() int64 { return int64(s.data[0]) }
+
+// getSyscallInfo returns the syscall information of the specified tracee,
+// which must be in a syscall-stop.
+func getSyscallInfo(tid int) (syscallInfo, error) {
+	var info syscallInfo
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_GET_SYSCALL_INFO,
+		uintptr(tid), unsafe.Sizeof(info), uintptr(unsafe.Pointer(&info)), 0, 0)
+	if errno != 0 {
+		return syscallInfo{}, errno
+	}
+	return info, nil
+}
+
+// peekFdPair returns the pair of fd numbers (C ints) in the memory of the
+// specified tracee at addr, as returned by pipe(2) and socketpair(2).
+func peekFdPair(tid int, addr uintptr) ([2]int, error) {
+	var buf [8]byte
+	if _, err := unix.PtracePeekData(tid, addr, buf[:]); err != nil {
+		return [2]int{}, err
+	}
+	return [2]int{
+		int(*(*int32)(unsafe.Pointer(&buf[0]))),
+		int(*(*int32)(unsafe.Pointer(&buf[4]))),
+	}, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdtrace
+
+import "golang.org/x/sys/unix"
+
+// syscallKind specifies how a syscall affects the fd table of a process.
+type syscallKind int
+
+const (
+	opensFd     syscallKind = iota // returns a new fd.
+	opensFdPair                    // stores a new pair of fds at the address in an argument.
+	closesFd                       // closes the fd in the first argument.
+	closesRange                    // closes the range of fds in the first two arguments.
+)
+
+// fdSyscall describes a syscall opening or closing fds.
+type fdSyscall struct {
+	name    string
+	kind    syscallKind
+	pairArg int // index of the argument with the address of an fd pair.
+}
+
+// fdSyscalls maps the numbers of the syscalls opening or closing fds to their
+// descriptions. Architecture-specific legacy syscalls are added by init
+// functions of architecture-specific source files.
+var fdSyscalls = map[int]fdSyscall{
+	unix.SYS_OPENAT:            {name: "openat", kind: opensFd},
+	unix.SYS_OPENAT2:           {name: "openat2", kind: opensFd},
+	unix.SYS_OPEN_BY_HANDLE_AT: {name: "open_by_handle_at", kind: opensFd},
+	unix.SYS_DUP:               {name: "dup", kind: opensFd},
+	unix.SYS_DUP3:              {name: "dup3", kind: opensFd},
+	unix.SYS_FCNTL:             {name: "fcntl", kind: opensFd}, // only F_DUPFD and F_DUPFD_CLOEXEC
+	unix.SYS_SOCKET:            {name: "socket", kind: opensFd},
+	unix.SYS_ACCEPT4:           {name: "accept4", kind: opensFd},
+	unix.SYS_EVENTFD2:          {name: "eventfd2", kind: opensFd},
+	unix.SYS_EPOLL_CREATE1:     {name: "epoll_create1", kind: opensFd},
+	unix.SYS_TIMERFD_CREATE:    {name: "timerfd_create", kind: opensFd},
+	unix.SYS_SIGNALFD4:         {name: "signalfd4", kind: opensFd},
+	unix.SYS_INOTIFY_INIT1:     {name: "inotify_init1", kind: opensFd},
+	unix.SYS_FANOTIFY_INIT:     {name: "fanotify_init", kind: opensFd},
+	unix.SYS_MEMFD_CREATE:      {name: "memfd_create", kind: opensFd},
+	unix.SYS_PIDFD_OPEN:        {name: "pidfd_open", kind: opensFd},
+	unix.SYS_PIDFD_GETFD:       {name: "pidfd_getfd", kind: opensFd},
+	unix.SYS_USERFAULTFD:       {name: "userfaultfd", kind: opensFd},
+	unix.SYS_IO_URING_SETUP:    {name: "io_uring_setup", kind: opensFd},
+	unix.SYS_PERF_EVENT_OPEN:   {name: "perf_event_open", kind: opensFd},
+	unix.SYS_OPEN_TREE:         {name: "open_tree", kind: opensFd},
+	unix.SYS_FSOPEN:            {name: "fsopen", kind: opensFd},
+	unix.SYS_FSMOUNT:           {name: "fsmount", kind: opensFd},
+	unix.SYS_FSPICK:            {name: "fspick", kind: opensFd},
+	unix.SYS_PIPE2:             {name: "pipe2", kind: opensFdPair, pairArg: 0},
+	unix.SYS_SOCKETPAIR:        {name: "socketpair", kind: opensFdPair, pairArg: 3},
+	unix.SYS_CLOSE:             {name: "close", kind: closesFd},
+	unix.SYS_CLOSE_RANGE:       {name: "close_range", kind: closesRange},
+}
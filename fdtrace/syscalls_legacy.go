@@ -0,0 +1,37 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux && (amd64 || arm || ppc64 || ppc64le)
+
+package fdtrace
+
+import "golang.org/x/sys/unix"
+
+// Add the legacy syscalls only found on some architectures, superseded by
+// their more flexible successors on newer architectures.
+func init() {
+	for nr, syscall := range map[int]fdSyscall{
+		unix.SYS_OPEN:         {name: "open", kind: opensFd},
+		unix.SYS_CREAT:        {name: "creat", kind: opensFd},
+		unix.SYS_DUP2:         {name: "dup2", kind: opensFd},
+		unix.SYS_ACCEPT:       {name: "accept", kind: opensFd},
+		unix.SYS_EVENTFD:      {name: "eventfd", kind: opensFd},
+		unix.SYS_EPOLL_CREATE: {name: "epoll_create", kind: opensFd},
+		unix.SYS_SIGNALFD:     {name: "signalfd", kind: opensFd},
+		unix.SYS_INOTIFY_INIT: {name: "inotify_init", kind: opensFd},
+		unix.SYS_PIPE:         {name: "pipe", kind: opensFdPair, pairArg: 0},
+	} {
+		fdSyscalls[nr] = syscall
+	}
+}
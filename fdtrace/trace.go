@@ -0,0 +1,355 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdtrace
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"slices"
+	"syscall"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+)
+
+// Op is the operation of a traced fd [Event].
+type Op int
+
+const (
+	Opened Op = iota // a new fd was opened, or an fd was dup'ed onto the fd.
+	Closed           // the fd was closed.
+)
+
+// String returns the textual representation of the operation.
+func (o Op) String() string {
+	switch o {
+	case Opened:
+		return "opened"
+	case Closed:
+		return "closed"
+	}
+	return fmt.Sprintf("Op(%d)", int(o))
+}
+
+// Event is a traced syscall opening or closing an fd. Syscalls opening or
+// closing multiple fds result in multiple events.
+type Event struct {
+	TID     int    // thread ID of the thread issuing the syscall.
+	Syscall string // syscall name, such as "openat", or "execve" for close-on-exec.
+	Op      Op     // operation on the fd.
+	FdNo    int    // fd number.
+}
+
+// Trace is the recorded fd lifecycle of a traced process; see [Run].
+type Trace struct {
+	PID       int                       // PID of the traced process.
+	Events    []Event                   // fd events in the order of the syscalls returning.
+	Inherited []filedesc.FileDescriptor // fds when the process exec'ed.
+	AtExit    []filedesc.FileDescriptor // fds right before the process exited; nil if never seen exiting.
+	Status    unix.WaitStatus           // wait status of the exited process.
+
+	open map[int]struct{} // currently open fd numbers.
+}
+
+// Run starts the specified command as a traced process, records its fd
+// lifecycle until it exits, and then returns the recorded [Trace]. As Run
+// reaps the process and waits for the command itself, callers must not call
+// the command's Wait. Run leaves the command's SysProcAttr untouched, tracing
+// the process using a copy of it instead.
+func Run(cmd *exec.Cmd) (*Trace, error) {
+	// All ptrace requests must be issued from the thread the tracee was
+	// started from.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	attr := syscall.SysProcAttr{}
+	if cmd.SysProcAttr != nil {
+		attr = *cmd.SysProcAttr
+	}
+	attr.Ptrace = true
+	sysProcAttr := cmd.SysProcAttr
+	cmd.SysProcAttr = &attr
+	err := cmd.Start()
+	cmd.SysProcAttr = sysProcAttr
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cmd.Wait() }()
+	t := &Trace{PID: cmd.Process.Pid, open: map[int]struct{}{}}
+	if err := t.trace(); err != nil {
+		_ = unix.Kill(t.PID, unix.SIGKILL)
+		t.reap()
+		return nil, err
+	}
+	return t, nil
+}
+
+// trace traces the process until it exits, starting with the process stopped
+// after its successful exec.
+func (t *Trace) trace() error {
+	var ws unix.WaitStatus
+	if _, err := wait4(t.PID, &ws); err != nil {
+		return err
+	}
+	if !ws.Stopped() {
+		return errors.New("traced process didn't stop after exec")
+	}
+	if err := unix.PtraceSetOptions(t.PID, unix.PTRACE_O_TRACESYSGOOD|
+		unix.PTRACE_O_TRACEEXIT|unix.PTRACE_O_TRACECLONE|unix.PTRACE_O_TRACEEXEC|
+		unix.PTRACE_O_EXITKILL); err != nil {
+		return err
+	}
+	inherited, err := filedesc.ProcessFiledescriptors(t.PID)
+	if err != nil {
+		return err
+	}
+	t.Inherited = inherited
+	for _, fd := range inherited {
+		t.open[fd.FdNo()] = struct{}{}
+	}
+	if err := unix.PtraceSyscall(t.PID, 0); err != nil {
+		return err
+	}
+	known := map[int]bool{t.PID: true} // traced threads
+	newborn := map[int]bool{}          // cloned threads not yet stopped
+	entries := map[int]syscallInfo{}   // per thread inside a syscall
+	for {
+		tid, err := wait4(-1, &ws)
+		if err != nil {
+			return err
+		}
+		if !known[tid] && !newborn[tid] && !(ws.Stopped() && ws.StopSignal() == unix.SIGSTOP) {
+			continue // not one of our tracees.
+		}
+		if ws.Exited() || ws.Signaled() {
+			delete(known, tid)
+			delete(entries, tid)
+			if tid == t.PID {
+				t.Status = ws
+				return nil
+			}
+			continue
+		}
+		if !ws.Stopped() {
+			continue
+		}
+		inject := 0
+		switch sig := ws.StopSignal(); {
+		case sig == unix.SIGTRAP|0x80:
+			t.syscallStop(tid, entries)
+		case sig == unix.SIGTRAP && ws.TrapCause() == unix.PTRACE_EVENT_EXIT:
+			if tid == t.PID && t.AtExit == nil {
+				t.AtExit, _ = filedesc.ProcessFiledescriptors(t.PID)
+			}
+		case sig == unix.SIGTRAP && ws.TrapCause() == unix.PTRACE_EVENT_EXEC:
+			// the exec'ing thread has now taken over the thread group leader
+			// ID, and all other threads are gone.
+			clear(entries)
+			t.execed(tid)
+		case sig == unix.SIGTRAP && ws.TrapCause() == unix.PTRACE_EVENT_CLONE:
+			if clone, err := unix.PtraceGetEventMsg(tid); err == nil && !known[int(clone)] {
+				newborn[int(clone)] = true
+			}
+		case sig == unix.SIGSTOP && (!known[tid] || newborn[tid]):
+			// initial stop of a newly cloned thread.
+			known[tid] = true
+			delete(newborn, tid)
+		default:
+			inject = int(sig) // signal-delivery-stop
+		}
+		if err := unix.PtraceSyscall(tid, inject); err != nil && !errors.Is(err, unix.ESRCH) {
+			return err
+		}
+	}
+}
+
+// wait4 waits for the specified tracee, or any tracee if pid is -1, retrying
+// when interrupted. As wait4 only waits for the children and tracees of the
+// calling thread, it doesn't reap children of other goroutines, even if the
+// traced process changes its process group or session.
+func wait4(pid int, ws *unix.WaitStatus) (int, error) {
+	for {
+		tid, err := unix.Wait4(pid, ws, unix.WALL|unix.WNOTHREAD, nil)
+		if !errors.Is(err, unix.EINTR) {
+			return tid, err
+		}
+	}
+}
+
+// reap waits for the (killed) traced process to finally exit.
+func (t *Trace) reap() {
+	var ws unix.WaitStatus
+	for {
+		tid, err := wait4(-1, &ws)
+		if err != nil || (tid == t.PID && (ws.Exited() || ws.Signaled())) {
+			return
+		}
+		if ws.Stopped() {
+			_ = unix.PtraceCont(tid, 0)
+		}
+	}
+}
+
+// syscallStop handles a syscall-entry-stop or syscall-exit-stop of the
+// specified thread, remembering the syscall details on entry for
+// interpretation on exit.
+func (t *Trace) syscallStop(tid int, entries map[int]syscallInfo) {
+	info, err := getSyscallInfo(tid)
+	if err != nil {
+		return
+	}
+	switch info.op {
+	case unix.PTRACE_SYSCALL_INFO_ENTRY:
+		entries[tid] = info
+	case unix.PTRACE_SYSCALL_INFO_EXIT:
+		entry, ok := entries[tid]
+		delete(entries, tid)
+		if ok {
+			t.syscallExit(tid, entry, info.rval())
+		}
+	}
+}
+
+// syscallExit records the fd events of a successfully completed syscall
+// opening or closing fds.
+func (t *Trace) syscallExit(tid int, entry syscallInfo, rval int64) {
+	sc, ok := fdSyscalls[entry.nr()]
+	if !ok || rval < 0 {
+		return
+	}
+	switch sc.kind {
+	case opensFd:
+		switch sc.name {
+		case "fcntl":
+			if cmd := int(entry.arg(1)); cmd != unix.F_DUPFD && cmd != unix.F_DUPFD_CLOEXEC {
+				return
+			}
+		case "signalfd", "signalfd4":
+			if int32(entry.arg(0)) != -1 {
+				return // updates the signal mask of an existing signalfd.
+			}
+		case "dup2", "dup3":
+			// duplicating onto an open fd silently closes it first, unless
+			// it is the same fd.
+			if int64(int32(entry.arg(0))) == rval {
+				return
+			}
+			if _, ok := t.open[int(rval)]; ok {
+				t.record(tid, sc.name, Closed, int(rval))
+			}
+		}
+		t.record(tid, sc.name, Opened, int(rval))
+	case opensFdPair:
+		fds, err := peekFdPair(tid, uintptr(entry.arg(sc.pairArg)))
+		if err != nil {
+			return
+		}
+		t.record(tid, sc.name, Opened, fds[0])
+		t.record(tid, sc.name, Opened, fds[1])
+	case closesFd:
+		t.record(tid, sc.name, Closed, int(int32(entry.arg(0))))
+	case closesRange:
+		if entry.arg(2)&unix.CLOSE_RANGE_CLOEXEC != 0 {
+			return // only sets the close-on-exec flags.
+		}
+		first, last := uint32(entry.arg(0)), uint32(entry.arg(1))
+		for _, fdNo := range t.openFdNos() {
+			if uint32(fdNo) >= first && uint32(fdNo) <= last {
+				t.record(tid, sc.name, Closed, fdNo)
+			}
+		}
+	}
+}
+
+// execed records the fds closed by a successful exec because of their
+// close-on-exec flag.
+func (t *Trace) execed(tid int) {
+	fdNos, err := filedesc.ProcessFdNumbers(t.PID)
+	if err != nil {
+		return
+	}
+	for _, fdNo := range t.openFdNos() {
+		if !slices.Contains(fdNos, fdNo) {
+			t.record(tid, "execve", Closed, fdNo)
+		}
+	}
+}
+
+// record records an fd event and updates the set of open fds.
+func (t *Trace) record(tid int, syscall string, op Op, fdNo int) {
+	t.Events = append(t.Events, Event{TID: tid, Syscall: syscall, Op: op, FdNo: fdNo})
+	switch op {
+	case Opened:
+		t.open[fdNo] = struct{}{}
+	case Closed:
+		delete(t.open, fdNo)
+	}
+}
+
+// openFdNos returns the sorted numbers of the currently open fds.
+func (t *Trace) openFdNos() []int {
+	fdNos := make([]int, 0, len(t.open))
+	for fdNo := range t.open {
+		fdNos = append(fdNos, fdNo)
+	}
+	slices.Sort(fdNos)
+	return fdNos
+}
+
+// Origin returns the event that opened the specified fd number and true, if
+// the fd was opened by the traced process and not closed afterwards.
+// Otherwise, it returns false.
+func (t *Trace) Origin(fdNo int) (Event, bool) {
+	return origin(t.Events, fdNo)
+}
+
+// origin returns the last event of the specified fd number and true, if it
+// opened the fd. Otherwise, it returns false.
+func origin(events []Event, fdNo int) (Event, bool) {
+	for idx := len(events) - 1; idx >= 0; idx-- {
+		event := events[idx]
+		if event.FdNo != fdNo {
+			continue
+		}
+		return event, event.Op == Opened
+	}
+	return Event{}, false
+}
+
+// LeakReport returns a [fdooze.LeakReport] listing the fds the traced process
+// didn't close before exiting, except for the inherited fds and the fds matched
+// by any of the optional filter matchers. The descriptions of the leaked fds
+// are additionally annotated with the syscalls that opened them.
+func (t *Trace) LeakReport(ignoring ...types.GomegaMatcher) (fdooze.LeakReport, error) {
+	if t.AtExit == nil {
+		return fdooze.LeakReport{}, errors.New("traced process wasn't seen exiting")
+	}
+	report, err := fdooze.NewLeakReport(t.AtExit, t.Inherited, ignoring...)
+	if err != nil {
+		return fdooze.LeakReport{}, err
+	}
+	for idx, leak := range report.Leaks {
+		if origin, ok := t.Origin(leak.FdNo); ok {
+			report.Leaks[idx].Description += fmt.Sprintf("\n%sopened by %s(2) in thread %d",
+				filedesc.Indentation(1), origin.Syscall, origin.TID)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdtrace
+
+import (
+	"os/exec"
+	"syscall"
+
+	"github.com/thediveo/fdooze"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("tracing fds", func() {
+
+	It("reports fds never closed at exit", func() {
+		trace, err := Run(exec.Command("/bin/sh", "-c",
+			"exec 7</dev/null; exec 8</dev/zero; exec 8<&-; exit 42"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trace.Status.ExitStatus()).To(Equal(42))
+		Expect(trace.Inherited).To(ContainElement(HaveField("FdNo()", 0)))
+		Expect(trace.Events).To(ContainElement(And(
+			HaveField("Op", Closed), HaveField("FdNo", 8))))
+
+		origin, ok := trace.Origin(7)
+		Expect(ok).To(BeTrue())
+		Expect(origin.Op).To(Equal(Opened))
+		Expect(origin.TID).To(Equal(trace.PID))
+		_, ok = trace.Origin(8)
+		Expect(ok).To(BeFalse())
+
+		Expect(trace.AtExit).To(fdooze.HaveLeakedFds(trace.Inherited))
+		report, err := trace.LeakReport()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(And(
+			HaveField("FdNo", 7),
+			HaveField("Key", "path /dev/null"),
+			HaveField("Description", MatchRegexp(`\n\s+opened by \w+\(2\) in thread %d$`, trace.PID)))))
+
+		report, err = trace.LeakReport(fdooze.Fd().WithPath("/dev/null").Build())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(BeEmpty())
+	})
+
+	It("follows execs", func() {
+		trace, err := Run(exec.Command("/bin/sh", "-c", "exec 7</dev/null; exec /bin/true"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trace.Status.ExitStatus()).To(BeZero())
+		report, err := trace.LeakReport()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(HaveField("FdNo", 7)))
+	})
+
+	It("follows processes changing their session, leaving the command untouched", func() {
+		cmd := exec.Command("/usr/bin/setsid", "/bin/sh", "-c", "exec 7</dev/null; exit 0")
+		cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+		trace, err := Run(cmd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.SysProcAttr.Ptrace).To(BeFalse())
+		Expect(trace.Status.ExitStatus()).To(BeZero())
+		report, err := trace.LeakReport()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(HaveField("FdNo", 7)))
+	})
+
+	It("records fd pairs and closed ranges", func() {
+		t := &Trace{open: map[int]struct{}{0: {}, 1: {}, 2: {}}}
+		t.record(42, "pipe2", Opened, 3)
+		t.record(42, "pipe2", Opened, 4)
+		Expect(t.openFdNos()).To(Equal([]int{0, 1, 2, 3, 4}))
+		var entry syscallInfo
+		entry.data[1], entry.data[2] = 3, ^uint64(0)
+		for nr, sc := range fdSyscalls {
+			if sc.kind == closesRange {
+				entry.data[0] = uint64(nr)
+			}
+		}
+		t.syscallExit(42, entry, 0)
+		Expect(t.openFdNos()).To(Equal([]int{0, 1, 2}))
+		Expect(t.Events).To(HaveLen(4))
+		Expect(t.Events[3]).To(Equal(Event{TID: 42, Syscall: "close_range", Op: Closed, FdNo: 4}))
+	})
+
+	It("fails for commands that cannot be started", func() {
+		Expect(Run(exec.Command("/nonexisting"))).Error().To(HaveOccurred())
+	})
+
+	It("refuses to report without exit snapshot", func() {
+		Expect((&Trace{}).LeakReport()).Error().To(HaveOccurred())
+		Expect(Opened.String()).To(Equal("opened"))
+		Expect(Op(42).String()).To(Equal("Op(42)"))
+	})
+
+	It("follows the threads of a traced Go process", func() {
+		trace, err := Run(exec.Command("go", "version"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trace.Status.ExitStatus()).To(BeZero())
+		Expect(trace.Events).NotTo(BeEmpty())
+		Expect(trace.AtExit).NotTo(BeNil())
+	})
+
+})
@@ -0,0 +1,149 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SysRoot is the path where the sysfs filesystem is mounted, used to resolve
+// the backing files of loop devices.
+var SysRoot = "/sys"
+
+// loopDevice matches the names of loop block devices.
+var loopDevice = regexp.MustCompile(`^loop\d+$`)
+
+// BackingFile returns the file actually held open by this fd in case the raw
+// path obscures it: for loop devices, the backing file of the loop device, and
+// for files on an overlayfs, the corresponding file in either the upper or the
+// first lower directory that contains it. In all other cases, BackingFile
+// returns an empty path.
+//
+// Please note that BackingFile resolves the backing file only when called,
+// using the current state of the system.
+func (p PathFd) BackingFile() (string, error) {
+	if strings.HasPrefix(p.path, "/dev/") && loopDevice.MatchString(filepath.Base(p.path)) {
+		return loopBackingFile(SysRoot, filepath.Base(p.path))
+	}
+	if p.pid == 0 || p.mntId == 0 {
+		return "", nil
+	}
+	return overlayBackingFile(procPIDPath(p.pid)+"/mountinfo", p.mntId, p.path)
+}
+
+// loopBackingFile returns the backing file of the named loop device, as
+// reported by the sysfs mounted at sysRoot.
+func loopBackingFile(sysRoot string, name string) (string, error) {
+	backing, err := os.ReadFile(sysRoot + "/block/" + name + "/loop/backing_file")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(backing), "\n"), nil
+}
+
+// overlayBackingFile returns the file in the upper or one of the lower
+// directories of the overlayfs mount with the specified mount ID that backs
+// the specified path, using the specified procfs mountinfo file. For bind
+// mounts of directories inside an overlayfs, the root of the mount within the
+// overlayfs is taken into account. If the mount isn't an overlayfs mount, an
+// empty path is returned.
+func overlayBackingFile(mountinfoPath string, mntId int, path string) (string, error) {
+	f, err := os.Open(mountinfoPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// mountID parentID major:minor root mountpoint options [optional...] - fstype source superoptions
+		mount, super, ok := strings.Cut(scanner.Text(), " - ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(mount)
+		if len(fields) < 5 || fields[0] != strconv.Itoa(mntId) {
+			continue
+		}
+		superFields := strings.Fields(super)
+		if len(superFields) < 3 || superFields[0] != "overlay" {
+			return "", nil
+		}
+		rel, ok := relativeTo(path, unescapeMountinfo(fields[4]))
+		if !ok {
+			return "", nil
+		}
+		// The root field is the root of the mount within the overlayfs, such
+		// as "/etc" for a bind mount of an overlayfs's /etc directory.
+		rel = filepath.Join(unescapeMountinfo(fields[3]), rel)
+		var layers []string
+		for _, opt := range strings.Split(superFields[2], ",") {
+			switch key, value, _ := strings.Cut(opt, "="); key {
+			case "upperdir":
+				layers = append([]string{value}, layers...)
+			case "lowerdir":
+				layers = append(layers, strings.Split(value, ":")...)
+			}
+		}
+		for _, layer := range layers {
+			backing := filepath.Join(unescapeMountinfo(layer), rel)
+			if _, err := os.Lstat(backing); err == nil {
+				return backing, nil
+			}
+		}
+		return "", errors.New("no overlayfs layer contains " + path)
+	}
+	return "", scanner.Err()
+}
+
+// relativeTo returns the path relative to the specified mount point, and
+// whether the path is actually located beneath the mount point.
+func relativeTo(path string, mountpoint string) (string, bool) {
+	if mountpoint == "/" {
+		return path, true
+	}
+	rel, ok := strings.CutPrefix(path, mountpoint)
+	if !ok || (rel != "" && rel[0] != '/') {
+		return "", false
+	}
+	return rel, true
+}
+
+// unescapeMountinfo replaces the octal escape sequences in mountinfo fields,
+// such as "\040" for spaces.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var out strings.Builder
+	for idx := 0; idx < len(s); idx++ {
+		if s[idx] == '\\' && idx+3 < len(s) {
+			if ch, err := strconv.ParseUint(s[idx+1:idx+4], 8, 8); err == nil {
+				out.WriteByte(byte(ch))
+				idx += 3
+				continue
+			}
+		}
+		out.WriteByte(s[idx])
+	}
+	return out.String()
+}
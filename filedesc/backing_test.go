@@ -0,0 +1,82 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("backing files", func() {
+
+	It("resolves loop device backing files", func() {
+		sysRoot := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(sysRoot, "block/loop7/loop"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(sysRoot, "block/loop7/loop/backing_file"),
+			[]byte("/var/lib/images/disk.img\n"), 0644)).To(Succeed())
+		Expect(loopBackingFile(sysRoot, "loop7")).To(Equal("/var/lib/images/disk.img"))
+		Expect(loopBackingFile(sysRoot, "loop8")).Error().To(HaveOccurred())
+
+		defer func(old string) { SysRoot = old }(SysRoot)
+		SysRoot = sysRoot
+		Expect(PathFd{path: "/dev/loop7"}.BackingFile()).To(Equal("/var/lib/images/disk.img"))
+		Expect(PathFd{path: "/dev/loop-control"}.BackingFile()).To(BeEmpty())
+	})
+
+	It("resolves overlayfs backing files", func() {
+		tmp := GinkgoT().TempDir()
+		for _, dir := range []string{"upper/etc", "lower 1/etc", "lower2/usr"} {
+			Expect(os.MkdirAll(filepath.Join(tmp, dir), 0755)).To(Succeed())
+		}
+		Expect(os.WriteFile(filepath.Join(tmp, "upper/etc/hosts"), nil, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmp, "lower 1/etc/passwd"), nil, 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmp, "lower2/usr/foo"), nil, 0644)).To(Succeed())
+		escapedTmp := strings.ReplaceAll(tmp, " ", `\040`)
+		mountinfo := filepath.Join(tmp, "mountinfo")
+		Expect(os.WriteFile(mountinfo, []byte(
+			"23 28 0:22 / /proc rw,relatime - proc proc rw\n"+
+				"42 28 0:50 / /merged rw,relatime shared:1 - overlay overlay rw,lowerdir="+
+				escapedTmp+`/lower\0401:`+escapedTmp+"/lower2,upperdir="+escapedTmp+"/upper,workdir="+escapedTmp+"/work\n"+
+				"43 28 0:50 /etc /bound\\040etc rw,relatime shared:1 - overlay overlay rw,lowerdir="+
+				escapedTmp+`/lower\0401:`+escapedTmp+"/lower2,upperdir="+escapedTmp+"/upper,workdir="+escapedTmp+"/work\n"),
+			0644)).To(Succeed())
+
+		Expect(overlayBackingFile(mountinfo, 42, "/merged/etc/hosts")).To(Equal(tmp + "/upper/etc/hosts"))
+		Expect(overlayBackingFile(mountinfo, 42, "/merged/etc/passwd")).To(Equal(tmp + "/lower 1/etc/passwd"))
+		Expect(overlayBackingFile(mountinfo, 42, "/merged/usr/foo")).To(Equal(tmp + "/lower2/usr/foo"))
+		Expect(overlayBackingFile(mountinfo, 43, "/bound etc/hosts")).To(Equal(tmp + "/upper/etc/hosts"))
+		Expect(overlayBackingFile(mountinfo, 43, "/bound etc/passwd")).To(Equal(tmp + "/lower 1/etc/passwd"))
+		Expect(overlayBackingFile(mountinfo, 42, "/merged/nothing")).Error().To(HaveOccurred())
+		Expect(overlayBackingFile(mountinfo, 42, "/mergedfoo")).To(BeEmpty())
+		Expect(overlayBackingFile(mountinfo, 23, "/proc/1")).To(BeEmpty())
+		Expect(overlayBackingFile(mountinfo, 666, "/foo")).To(BeEmpty())
+		Expect(overlayBackingFile(filepath.Join(tmp, "missing"), 42, "/foo")).Error().To(HaveOccurred())
+	})
+
+	It("doesn't resolve ordinary files", func() {
+		f := Successful(os.Open("backing_test.go"))
+		defer f.Close()
+		fdesc := Successful(New(int(f.Fd())))
+		Expect(fdesc.(*PathFd).BackingFile()).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,266 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// BlockedThread is a thread of a process that is currently inside a syscall
+// operating on a particular fd, such as a blocking read(2) on a pipe. Threads
+// inside poll(2) or select(2) style syscalls operating on multiple fds show up
+// multiple times, once per fd.
+type BlockedThread struct {
+	TID     int      // thread ID.
+	Syscall string   // syscall name, such as "read".
+	FdNo    int      // fd number the syscall operates on.
+	Wchan   string   // kernel function the thread is waiting in, if known.
+	Stack   []string // kernel stack of the thread, if readable.
+}
+
+// BlockedThreads returns the threads of the process identified by pid that are
+// currently inside syscalls operating on fds, on a best effort basis: the
+// threads are sampled one after another from procfs, so the result is just a
+// snapshot of a moving target. Reading a thread's current syscall needs the
+// same permissions as ptrace'ing the process, and reading its kernel stack
+// additionally needs CAP_SYS_ADMIN; threads whose syscall cannot be read are
+// skipped, while the kernel stack is left empty if unreadable. The fds of poll(2)
+// and select(2) style syscalls are read from the memory of the process.
+//
+// BlockedThreads is intended for pointing at the culpable thread of a
+// supervised (non-Go) process that is stuck on a leaked fd.
+func BlockedThreads(pid int) ([]BlockedThread, error) {
+	taskPath := procPIDPath(pid) + "/task"
+	entries, err := os.ReadDir(taskPath)
+	if err != nil {
+		return nil, err
+	}
+	var blocked []BlockedThread
+	for _, entry := range entries {
+		tid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		tidPath := taskPath + "/" + entry.Name()
+		syscall, err := os.ReadFile(tidPath + "/syscall")
+		if err != nil {
+			continue
+		}
+		name, fdNos, ok := blockedFds(string(syscall), tidPath)
+		if !ok {
+			continue
+		}
+		thread := BlockedThread{TID: tid, Syscall: name}
+		if wchan, err := os.ReadFile(tidPath + "/wchan"); err == nil && string(wchan) != "0" {
+			thread.Wchan = string(wchan)
+		}
+		if stack, err := os.ReadFile(tidPath + "/stack"); err == nil {
+			thread.Stack = stackFrames(string(stack))
+		}
+		for _, fdNo := range fdNos {
+			thread.FdNo = fdNo
+			blocked = append(blocked, thread)
+		}
+	}
+	return blocked, nil
+}
+
+// blockedFds returns the name of the syscall and the fds it operates on from
+// the contents of the procfs task syscall file of the thread at tidPath. For
+// poll(2) and select(2) style syscalls, the fds are read from the thread's
+// memory. If the thread isn't inside a syscall operating on fds, blockedFds
+// returns false.
+func blockedFds(syscall string, tidPath string) (name string, fdNos []int, ok bool) {
+	if name, fdNo, ok := fdSyscall(syscall); ok {
+		return name, []int{fdNo}, true
+	}
+	if _, _, ok := pollSyscall(syscall); !ok {
+		return "", nil, false
+	}
+	mem, err := os.Open(tidPath + "/mem")
+	if err != nil {
+		return "", nil, false
+	}
+	defer mem.Close()
+	return polledFds(syscall, mem)
+}
+
+// fdSyscall returns the name of the syscall and its fd argument from the
+// contents of a procfs task syscall file, in the format “NR ARG1 ... ARG6 SP
+// PC”. If the thread isn't inside a syscall, such as when it is “running”, or
+// the syscall doesn't operate on an fd, fdSyscall returns false.
+func fdSyscall(syscall string) (name string, fdNo int, ok bool) {
+	fields := strings.Fields(syscall)
+	if len(fields) < 2 {
+		return "", 0, false
+	}
+	nr, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return "", 0, false
+	}
+	name, ok = fdSyscalls[nr]
+	if !ok {
+		return "", 0, false
+	}
+	arg, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "0x"), 16, 64)
+	if err != nil || int32(arg) < 0 {
+		return "", 0, false
+	}
+	return name, int(int32(arg)), true
+}
+
+// pollSyscall returns the poll(2) or select(2) style syscall and its first four
+// arguments from the contents of a procfs task syscall file, or false if the
+// thread isn't inside such a syscall.
+func pollSyscall(syscall string) (sc fdSetSyscall, args [4]uint64, ok bool) {
+	fields := strings.Fields(syscall)
+	if len(fields) < 1+len(args) {
+		return fdSetSyscall{}, args, false
+	}
+	nr, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return fdSetSyscall{}, args, false
+	}
+	sc, ok = fdSetSyscalls[nr]
+	if !ok {
+		return fdSetSyscall{}, args, false
+	}
+	for idx := range args {
+		args[idx], err = strconv.ParseUint(strings.TrimPrefix(fields[1+idx], "0x"), 16, 64)
+		if err != nil {
+			return fdSetSyscall{}, args, false
+		}
+	}
+	return sc, args, true
+}
+
+// maxPolledFds limits the number of fds read from the memory of a thread
+// inside a poll(2) or select(2) style syscall.
+const maxPolledFds = 1 << 16
+
+// polledFds returns the name of the poll(2) or select(2) style syscall and the
+// fds it operates on from the contents of a procfs task syscall file, reading
+// the pollfd array or fd_set bitmaps from the specified thread memory. The fds
+// are sorted and without duplicates.
+func polledFds(syscall string, mem io.ReaderAt) (name string, fdNos []int, ok bool) {
+	sc, args, ok := pollSyscall(syscall)
+	if !ok {
+		return "", nil, false
+	}
+	ne := binary.NativeEndian
+	if !sc.selects {
+		// struct pollfd { int fd; short events; short revents; }
+		nfds := min(args[1], maxPolledFds)
+		pollfds := make([]byte, nfds*8)
+		if _, err := mem.ReadAt(pollfds, int64(args[0])); err != nil {
+			return "", nil, false
+		}
+		for idx := range int(nfds) {
+			if fdNo := int32(ne.Uint32(pollfds[idx*8:])); fdNo >= 0 {
+				fdNos = append(fdNos, int(fdNo))
+			}
+		}
+	} else {
+		// fd_set bitmaps are arrays of unsigned longs, with the highest fd
+		// plus one as the first argument.
+		nfds := int(min(args[0], maxPolledFds))
+		wordSize := bits.UintSize / 8
+		fdset := make([]byte, (nfds+bits.UintSize-1)/bits.UintSize*wordSize)
+		for _, addr := range args[1:] {
+			if addr == 0 {
+				continue
+			}
+			if _, err := mem.ReadAt(fdset, int64(addr)); err != nil {
+				return "", nil, false
+			}
+			for fdNo := range nfds {
+				word := fdset[fdNo/bits.UintSize*wordSize:]
+				var bitmap uint64
+				if wordSize == 8 {
+					bitmap = ne.Uint64(word)
+				} else {
+					bitmap = uint64(ne.Uint32(word))
+				}
+				if bitmap&(1<<(fdNo%bits.UintSize)) != 0 {
+					fdNos = append(fdNos, fdNo)
+				}
+			}
+		}
+	}
+	slices.Sort(fdNos)
+	fdNos = slices.Compact(fdNos)
+	if len(fdNos) == 0 {
+		return "", nil, false
+	}
+	return sc.name, fdNos, true
+}
+
+// stackFrames returns the kernel functions from the contents of a procfs task
+// stack file, with lines in the format “[<0>] function+0x2c/0x40”.
+func stackFrames(stack string) []string {
+	var frames []string
+	for _, line := range strings.Split(stack, "\n") {
+		if _, frame, ok := strings.Cut(line, "] "); ok {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// fdSyscalls maps the numbers of syscalls taking an fd as their first argument
+// and potentially blocking to their names.
+var fdSyscalls = map[int]string{
+	unix.SYS_READ:        "read",
+	unix.SYS_WRITE:       "write",
+	unix.SYS_READV:       "readv",
+	unix.SYS_WRITEV:      "writev",
+	unix.SYS_PREAD64:     "pread64",
+	unix.SYS_PWRITE64:    "pwrite64",
+	unix.SYS_RECVFROM:    "recvfrom",
+	unix.SYS_RECVMSG:     "recvmsg",
+	unix.SYS_SENDTO:      "sendto",
+	unix.SYS_SENDMSG:     "sendmsg",
+	unix.SYS_ACCEPT4:     "accept4",
+	unix.SYS_CONNECT:     "connect",
+	unix.SYS_IOCTL:       "ioctl",
+	unix.SYS_FLOCK:       "flock",
+	unix.SYS_FSYNC:       "fsync",
+	unix.SYS_FCNTL:       "fcntl",
+	unix.SYS_EPOLL_PWAIT: "epoll_pwait",
+}
+
+// fdSetSyscall describes a poll(2) or select(2) style syscall operating on
+// multiple fds passed in the memory of the calling thread.
+type fdSetSyscall struct {
+	name    string
+	selects bool // fd_set bitmaps instead of a pollfd array.
+}
+
+// fdSetSyscalls maps the numbers of poll(2) and select(2) style syscalls to
+// their descriptions.
+var fdSetSyscalls = map[int]fdSetSyscall{
+	unix.SYS_PPOLL:    {name: "ppoll"},
+	unix.SYS_PSELECT6: {name: "pselect6", selects: true},
+}
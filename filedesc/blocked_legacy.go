@@ -0,0 +1,27 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux && (amd64 || arm || ppc64 || ppc64le)
+
+package filedesc
+
+import "golang.org/x/sys/unix"
+
+// Add the legacy syscalls only found on some architectures, superseded by
+// their more flexible successors on newer architectures.
+func init() {
+	fdSyscalls[unix.SYS_ACCEPT] = "accept"
+	fdSyscalls[unix.SYS_EPOLL_WAIT] = "epoll_wait"
+	fdSetSyscalls[unix.SYS_POLL] = fdSetSyscall{name: "poll"}
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("blocked threads", func() {
+
+	It("parses syscall lines", func() {
+		_, _, ok := fdSyscall("running")
+		Expect(ok).To(BeFalse())
+		_, _, ok = fdSyscall("-1 0x7ffc1dd8a8b8 0x7f3a2b1c0d1e")
+		Expect(ok).To(BeFalse())
+		_, _, ok = fdSyscall("foo 0x0")
+		Expect(ok).To(BeFalse())
+
+		name, fdNo, ok := fdSyscall("0 0x3 0x7ffc1dd8a000 0x20000 0x0 0x0 0x0 0x7ffc1dd8a8b8 0x7f3a2b1c0d1e")
+		if !ok {
+			Skip("syscall number of read(2) isn't 0 on this architecture")
+		}
+		Expect(name).To(Equal("read"))
+		Expect(fdNo).To(Equal(3))
+	})
+
+	It("parses poll and select syscall lines", func() {
+		mem := make([]byte, 0x100)
+		ne := binary.NativeEndian
+		ne.PutUint32(mem[0x10:], 7)
+		ne.PutUint32(mem[0x18:], 0xffffffff) // negative fds are ignored
+		ne.PutUint32(mem[0x20:], 3)
+
+		name, fdNos, ok := polledFds(fmt.Sprintf("%d 0x10 0x3 0x0 0x0 0x0 0x0 0x7ffc 0x7f3a", unix.SYS_PPOLL),
+			bytes.NewReader(mem))
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("ppoll"))
+		Expect(fdNos).To(Equal([]int{3, 7}))
+
+		putWord := func(offset int, word uint64) {
+			if unix.SizeofPtr == 8 {
+				ne.PutUint64(mem[offset:], word)
+				return
+			}
+			ne.PutUint32(mem[offset:], uint32(word))
+		}
+		putWord(0x40, 1<<3|1<<5) // readfds
+		putWord(0x80, 1<<3)      // writefds
+		name, fdNos, ok = polledFds(fmt.Sprintf("%d 0x6 0x40 0x80 0x0 0x0 0x0 0x7ffc 0x7f3a", unix.SYS_PSELECT6),
+			bytes.NewReader(mem))
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("pselect6"))
+		Expect(fdNos).To(Equal([]int{3, 5}))
+
+		_, _, ok = polledFds(fmt.Sprintf("%d 0x1000 0x1 0x0 0x0 0x0 0x0 0x7ffc 0x7f3a", unix.SYS_PPOLL),
+			bytes.NewReader(mem))
+		Expect(ok).To(BeFalse())
+		_, _, ok = polledFds("0 0x3 0x7ffc1dd8a000 0x20000 0x0 0x0 0x0 0x7ffc1dd8a8b8 0x7f3a2b1c0d1e",
+			bytes.NewReader(mem))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("parses kernel stacks", func() {
+		Expect(stackFrames("")).To(BeEmpty())
+		Expect(stackFrames("[<0>] pipe_read+0x2c5/0x440\n[<0>] vfs_read+0x2a2/0x2e0\n")).To(
+			Equal([]string{"pipe_read+0x2c5/0x440", "vfs_read+0x2a2/0x2e0"}))
+	})
+
+	It("finds a thread blocked on a pipe", func() {
+		r, w, err := os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Close()
+		cmd := exec.Command("cat")
+		cmd.Stdin = r
+		Expect(cmd.Start()).To(Succeed())
+		r.Close()
+		DeferCleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+
+		Eventually(func() ([]BlockedThread, error) {
+			return BlockedThreads(cmd.Process.Pid)
+		}).Should(ContainElement(And(
+			HaveField("TID", cmd.Process.Pid),
+			HaveField("Syscall", "read"),
+			HaveField("FdNo", 0))))
+	})
+
+	It("finds a thread polling a pipe", func() {
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+
+		tid := make(chan int, 1)
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			tid <- unix.Gettid()
+			_, _ = unix.Poll([]unix.PollFd{{Fd: int32(pipefds[0]), Events: unix.POLLIN}}, -1)
+		}()
+		polling := <-tid
+		defer func() {
+			_, _ = unix.Write(pipefds[1], []byte{42})
+			<-done
+		}()
+
+		Eventually(func() ([]BlockedThread, error) {
+			return BlockedThreads(os.Getpid())
+		}).Should(ContainElement(And(
+			HaveField("TID", polling),
+			HaveField("Syscall", MatchRegexp(`^p?poll$`)),
+			HaveField("FdNo", pipefds[0]))))
+	})
+
+	It("fails for non-existing processes", func() {
+		Expect(BlockedThreads(0)).Error().To(HaveOccurred())
+	})
+
+})
@@ -0,0 +1,107 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// CapabilitiesReport describes the enrichment steps skipped during fd
+// discovery due to missing privileges or kernel support, such as when lacking
+// CAP_SYS_PTRACE or when pidfd_getfd(2) is unavailable, or due to sandbox
+// policies blocking syscalls, see [RestrictedError]. In these cases,
+// discovery proceeds with whatever procfs offers, returning sparser fd
+// details.
+type CapabilitiesReport struct {
+	Skipped []SkippedEnrichment
+}
+
+// SkippedEnrichment describes a single enrichment step skipped for a
+// particular fd.
+type SkippedEnrichment struct {
+	FdNo int    // fd number
+	Step string // enrichment step skipped, such as "socket details"
+	Err  error  // the reason for skipping the step
+}
+
+// FullFidelity returns true if no enrichment steps were skipped, so that all
+// fd details are available. Suites can assert full fidelity when they expect
+// to be run with sufficient privileges.
+func (r CapabilitiesReport) FullFidelity() bool { return len(r.Skipped) == 0 }
+
+// Description returns a pretty formatted multi-line textual description of the
+// skipped enrichment steps.
+func (r CapabilitiesReport) Description(indentation uint) string {
+	if r.FullFidelity() {
+		return Indentation(indentation) + "full fidelity, no enrichment steps skipped"
+	}
+	var out strings.Builder
+	out.WriteString(Indentation(indentation))
+	out.WriteString(fmt.Sprintf("%d enrichment steps skipped:", len(r.Skipped)))
+	indent := Indentation(indentation + 1)
+	for _, skipped := range r.Skipped {
+		out.WriteString(fmt.Sprintf("\n%sfd %d: %s: %s", indent, skipped.FdNo, skipped.Step, skipped.Err))
+	}
+	return out.String()
+}
+
+// ProcessFiledescriptorsWithReport returns the list of currently open file
+// descriptors for the process identified by pid, together with a report about
+// any enrichment steps skipped due to missing privileges or kernel support.
+// In contrast to [ProcessFiledescriptors], file descriptors which cannot be
+// fully enriched are not dropped, but returned with the details procfs offers.
+func ProcessFiledescriptorsWithReport(pid int) ([]FileDescriptor, CapabilitiesReport, error) {
+	report := CapabilitiesReport{}
+	fds, err := discover(procPIDPath(pid)+"/fd", &report, nil)
+	if err != nil {
+		return nil, CapabilitiesReport{}, err
+	}
+	return fds, report, nil
+}
+
+// isPrivilegeError returns true if err indicates missing privileges or kernel
+// support.
+func isPrivilegeError(err error) bool {
+	return errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) ||
+		errors.Is(err, unix.ENOSYS)
+}
+
+// newDegraded returns a degraded FileDescriptor in case the full enrichment
+// failed with the specified error due to missing privileges or kernel
+// support, or due to a sandbox policy, noting the skipped step in the optional
+// report. Otherwise, it returns the original error.
+func newDegraded(fdNo int, base string, linkDest string, err error, report *CapabilitiesReport, o *discoveryOptions) (FileDescriptor, error) {
+	if !isPrivilegeError(err) || !strings.HasPrefix(linkDest, "socket:[") {
+		return nil, err
+	}
+	fdesc, degradedErr := newDegradedSocketFd(fdNo, base, linkDest, o)
+	if degradedErr != nil {
+		return nil, degradedErr
+	}
+	if report != nil {
+		report.Skipped = append(report.Skipped, SkippedEnrichment{
+			FdNo: fdNo,
+			Step: "socket details",
+			Err:  err,
+		})
+	}
+	return fdesc, nil
+}
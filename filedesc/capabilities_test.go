@@ -0,0 +1,94 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("degraded discovery", Serial, func() {
+
+	It("reports missing processes", func() {
+		Expect(ProcessFiledescriptorsWithReport(-1)).Error().To(HaveOccurred())
+	})
+
+	It("reports full fidelity", func() {
+		fds, report, err := ProcessFiledescriptorsWithReport(os.Getpid())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fds).NotTo(BeEmpty())
+		Expect(report.FullFidelity()).To(BeTrue())
+		Expect(report.Description(0)).To(Equal("full fidelity, no enrichment steps skipped"))
+	})
+
+	It("falls back onto degraded socket fds", func() {
+		fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		defer unix.Close(fd)
+		fullfdesc := Successful(New(fd))
+
+		oldpidfdGetfd := pidfdGetfd
+		defer func() { pidfdGetfd = oldpidfdGetfd }()
+		pidfdGetfd = func(int, int, int) (int, error) { return -1, unix.EPERM }
+
+		Expect(ProcessFiledescriptors(os.Getpid())).NotTo(
+			ContainElement(HaveField("FdNo()", fd)))
+
+		fds, report, err := ProcessFiledescriptorsWithReport(os.Getpid())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fds).To(ContainElement(And(
+			HaveField("FdNo()", fd),
+			HaveField("Degraded()", BeTrue()),
+			HaveField("Ino()", Not(BeZero())))))
+		Expect(report.FullFidelity()).To(BeFalse())
+		Expect(report.Skipped).To(ContainElement(And(
+			HaveField("FdNo", fd),
+			HaveField("Step", "socket details"),
+			HaveField("Err", MatchError(unix.EPERM)))))
+		Expect(report.Description(0)).To(MatchRegexp(
+			`^\d+ enrichment steps skipped:\n(\s+fd \d+: socket details: operation not permitted\n?)+$`))
+
+		for _, fdesc := range fds {
+			if fdesc.FdNo() != fd {
+				continue
+			}
+			Expect(fdesc.Description(0)).To(MatchRegexp(
+				`\n\s+socket, ino \d+ \(further details unavailable\)$`))
+			Expect(fdesc.Equal(fdesc)).To(BeTrue())
+			Expect(fdesc.Equal(fullfdesc)).To(BeFalse())
+		}
+	})
+
+	It("doesn't degrade on other errors", func() {
+		report := CapabilitiesReport{}
+		Expect(newDegraded(0, "/proc/self/fd", "socket:[1]", errors.New("foo"), &report, nil)).Error().To(
+			MatchError("foo"))
+		Expect(newDegraded(0, "/proc/self/fd", "pipe:[1]", unix.EPERM, &report, nil)).Error().To(
+			MatchError(unix.EPERM))
+		Expect(newDegraded(-1, "/proc/self/fd", "socket:[1]", unix.EPERM, &report, nil)).Error().To(
+			HaveOccurred())
+		Expect(newDegraded(0, "/proc/self/fd", "socket:[abc]", unix.EPERM, &report, nil)).Error().To(
+			HaveOccurred())
+		Expect(report.FullFidelity()).To(BeTrue())
+	})
+
+})
@@ -0,0 +1,169 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DiffDescription returns a field-by-field diff of the specified two file
+// descriptors, with one line per differing field in the form of “field: a →
+// b”, such as the flags, file offsets, paths, and socket peers. Fields only
+// present with one of the file descriptors, such as when comparing file
+// descriptors of different kinds, are shown as “(none)” for the other file
+// descriptor. If there are no differences, DiffDescription returns an empty
+// string.
+func DiffDescription(a, b FileDescriptor) string {
+	afields := diffFields(a)
+	bfields := diffFields(b)
+	names := make([]string, 0, len(afields)+len(bfields))
+	avalues := make(map[string]string, len(afields))
+	bvalues := make(map[string]string, len(bfields))
+	for _, field := range afields {
+		names = append(names, field.name)
+		avalues[field.name] = field.value
+	}
+	for _, field := range bfields {
+		if _, ok := avalues[field.name]; !ok {
+			names = append(names, field.name)
+		}
+		bvalues[field.name] = field.value
+	}
+	var diffs []string
+	for _, name := range names {
+		avalue, aok := avalues[name]
+		bvalue, bok := bvalues[name]
+		if aok && bok && avalue == bvalue {
+			continue
+		}
+		if !aok {
+			avalue = "(none)"
+		}
+		if !bok {
+			bvalue = "(none)"
+		}
+		diffs = append(diffs, fmt.Sprintf("%s: %s → %s", name, avalue, bvalue))
+	}
+	return strings.Join(diffs, "\n")
+}
+
+// diffField is a named and textually rendered field of a file descriptor.
+type diffField struct {
+	name  string
+	value string
+}
+
+// diffFields returns the fields of the specified file descriptor to be
+// compared by [DiffDescription]: the fd number and kind come first, followed
+// by the fields common to all kinds of file descriptors, and finally the
+// kind-specific fields.
+func diffFields(fd FileDescriptor) []diffField {
+	var fields []diffField
+	if base, ok := fd.(interface {
+		PID() int
+		Flags() Flags
+		Pos() int64
+		MountId() int
+	}); ok {
+		fields = append(fields,
+			diffField{"pid", strconv.Itoa(base.PID())},
+			diffField{"flags", fmt.Sprintf("0x%x (%s)", int(base.Flags()), strings.Join(base.Flags().Names(), ","))},
+			diffField{"pos", strconv.FormatInt(base.Pos(), 10)},
+			diffField{"mnt_id", strconv.Itoa(base.MountId())})
+	}
+	kind := fmt.Sprintf("%T", fd)
+	switch fd := fd.(type) {
+	case *PathFd:
+		kind = "path"
+		fields = append(fields,
+			diffField{"path", strconv.Quote(fd.Path())},
+			diffField{"ino", strconv.FormatUint(fd.Ino(), 10)},
+			diffField{"size", strconv.FormatUint(fd.Size(), 10)})
+	case *ShmFd:
+		kind = "shm"
+		fields = append(fields,
+			diffField{"path", strconv.Quote(fd.Path())},
+			diffField{"ino", strconv.FormatUint(fd.Ino(), 10)},
+			diffField{"size", strconv.FormatUint(fd.Size(), 10)},
+			diffField{"uid", strconv.FormatUint(uint64(fd.UID()), 10)},
+			diffField{"gid", strconv.FormatUint(uint64(fd.GID()), 10)})
+	case *PipeFd:
+		kind = "pipe"
+		fields = append(fields,
+			diffField{"ino", strconv.FormatUint(fd.Ino(), 10)})
+	case *SocketFd:
+		kind = "socket"
+		fields = append(fields,
+			diffField{"ino", strconv.FormatUint(fd.Ino(), 10)},
+			diffField{"socket", fmt.Sprintf("%s, %s, %s",
+				fd.domain.String(), fd.typ.String(), fd.protocol.String(fd.domain))},
+			diffField{"listening", strconv.FormatBool(fd.Listening())},
+			diffField{"local", strconv.Quote(fd.Name())},
+			diffField{"peer", strconv.Quote(fd.Peer())})
+		if fd.tcpState >= 0 {
+			fields = append(fields, diffField{"TCP state", fd.tcpState.String()})
+		}
+	case *AnonInodeFd:
+		kind = "anon_inode"
+		fields = append(fields,
+			diffField{"type", fd.FileType()})
+	case *EpollFd:
+		kind = "anon_inode"
+		targets := make([]string, 0, len(fd.Targets()))
+		for _, target := range fd.Targets() {
+			targets = append(targets, fmt.Sprintf("%d (%s)", target.FdNo, target.Events))
+		}
+		fields = append(fields,
+			diffField{"type", fd.FileType()},
+			diffField{"targets", strings.Join(targets, ", ")})
+	case *EventfdFd:
+		kind = "anon_inode"
+		fields = append(fields,
+			diffField{"type", fd.FileType()},
+			diffField{"count", strconv.FormatUint(fd.Count(), 10)})
+	case *InotifyFd:
+		kind = "anon_inode"
+		fields = append(fields,
+			diffField{"type", fd.FileType()},
+			diffField{"watches", strconv.Itoa(len(fd.Watches()))})
+	case *FanotifyFd:
+		kind = "anon_inode"
+		fields = append(fields,
+			diffField{"type", fd.FileType()},
+			diffField{"init flags", fd.InitFlags().String()},
+			diffField{"marks", strconv.Itoa(len(fd.Marks()))})
+	case *IoUringFd:
+		kind = "anon_inode"
+		fields = append(fields,
+			diffField{"type", fd.FileType()},
+			diffField{"registered files", strconv.Itoa(len(fd.RegisteredFiles()))})
+	case *TimerfdFd:
+		kind = "anon_inode"
+		fields = append(fields,
+			diffField{"type", fd.FileType()},
+			diffField{"clock", clockName(fd.ClockID())},
+			diffField{"interval", fd.Interval().String()})
+	case *NamespaceFd:
+		kind = "namespace"
+		fields = append(fields,
+			diffField{"type", fd.NamespaceType()},
+			diffField{"ino", strconv.FormatUint(fd.Ino(), 10)})
+	}
+	return append([]diffField{{"fd", strconv.Itoa(fd.FdNo())}, {"kind", kind}}, fields...)
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("diffing fds", func() {
+
+	It("returns no diff for the same fd", func() {
+		f := Successful(os.Open("diff_test.go"))
+		defer f.Close()
+		fd := Successful(New(int(f.Fd())))
+		Expect(DiffDescription(fd, fd)).To(BeEmpty())
+	})
+
+	It("diffs flags and file offsets", func() {
+		f := Successful(os.Open("diff_test.go"))
+		defer f.Close()
+		before := Successful(New(int(f.Fd())))
+
+		Successful(f.Seek(42, 0))
+		Expect(unix.SetNonblock(int(f.Fd()), true)).To(Succeed())
+		after := Successful(New(int(f.Fd())))
+		Expect(after.(*PathFd).Pos()).To(Equal(int64(42)))
+
+		Expect(DiffDescription(before, after)).To(MatchRegexp(
+			`^flags: 0x[0-9a-f]+ \(O_RDONLY,.*\) → 0x[0-9a-f]+ \(O_RDONLY,.*O_NONBLOCK.*\)\npos: 0 → 42$`))
+	})
+
+	It("diffs fds of different kinds", func() {
+		f := Successful(os.Open("diff_test.go"))
+		defer f.Close()
+		sfd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0))
+		defer unix.Close(sfd)
+
+		pathfd := Successful(New(int(f.Fd())))
+		sockfd := Successful(New(sfd))
+		diff := DiffDescription(pathfd, sockfd)
+		Expect(diff).To(MatchRegexp(`(?m)^kind: path → socket$`))
+		Expect(diff).To(MatchRegexp(`(?m)^path: ".*/diff_test.go" → \(none\)$`))
+		Expect(diff).To(MatchRegexp(`(?m)^peer: \(none\) → ""$`))
+	})
+
+})
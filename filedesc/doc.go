@@ -35,6 +35,21 @@ open file descriptor details of the process with the specified PID. For this,
 the process must be either belonging to the same user or the caller must possess
 sufficient capabilities to access arbitrary processes.
 
+Processes in child user namespaces, such as started using “unshare -Ur”, can be
+discovered as long as the caller owns their user namespace. User and group IDs,
+such as of shared memory object owners and unix socket peer credentials, are
+then reported as seen from inside the process's user namespace, using its
+[IDMap]s. Enrichment steps failing for lack of privileges are reported by
+[ProcessFiledescriptorsWithReport] instead of dropping the affected fds.
+
+By default, file descriptors are discovered from the procfs mounted on
+"/proc". In environments where a private procfs is mounted elsewhere, set
+[ProcRoot] accordingly, or set the environment variable named by [ProcRootEnv].
+
+In order to check the details of specific live objects, such as an *os.File or
+a net.Conn, [FromFile] and [FromConn] return the FileDescriptor for the fd
+underlying the object.
+
 [HaveField]: https://onsi.github.io/gomega/#havefieldfield-interface-value-interface
 [HaveExistingField]: https://onsi.github.io/gomega/#havefieldfield-interface-value-interface
 */
@@ -0,0 +1,171 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Names of the environment capabilities probed by [ProbeEnvironment].
+const (
+	CapabilityProcfs     = "procfs"      // procfs fd directories can be read.
+	CapabilityFdinfo     = "fdinfo"      // fdinfo contains flags and mnt_id.
+	CapabilityStatx      = "statx"       // statx(2) is supported.
+	CapabilityPidfd      = "pidfd_getfd" // fds can be cloned via pidfd_getfd(2).
+	CapabilitySockDiag   = "sock_diag"   // unix socket details via sock_diag netlink.
+	CapabilityReadlink   = "readlink"    // fd links can be read, not blocked by a sandbox policy.
+	CapabilityGetsockopt = "getsockopt"  // socket options can be read, not blocked by a sandbox policy.
+)
+
+// EnvironmentReport is the capability matrix of the current environment, as
+// returned by [ProbeEnvironment]. Suites can use it in order to skip or
+// degrade checks deliberately on exotic CI runners, instead of failing
+// mysteriously.
+type EnvironmentReport struct {
+	KernelRelease string       // kernel release, such as "6.1.0-18-amd64".
+	Capabilities  []Capability // probed capabilities, in probing order.
+}
+
+// Capability describes a single probed environment capability.
+type Capability struct {
+	Name      string // name of the capability, such as [CapabilityPidfd].
+	Available bool   // true if the capability is available.
+	Err       error  // the reason for the capability being unavailable.
+}
+
+// Available returns true if the named capability has been probed and is
+// available.
+func (r EnvironmentReport) Available(name string) bool {
+	for _, capability := range r.Capabilities {
+		if capability.Name == name {
+			return capability.Available
+		}
+	}
+	return false
+}
+
+// Description returns a pretty formatted multi-line textual description of the
+// capability matrix.
+func (r EnvironmentReport) Description(indentation uint) string {
+	var out strings.Builder
+	out.WriteString(Indentation(indentation))
+	out.WriteString(fmt.Sprintf("kernel %s:", r.KernelRelease))
+	indent := Indentation(indentation + 1)
+	for _, capability := range r.Capabilities {
+		if capability.Available {
+			out.WriteString(fmt.Sprintf("\n%s%s: available", indent, capability.Name))
+			continue
+		}
+		out.WriteString(fmt.Sprintf("\n%s%s: unavailable: %s", indent, capability.Name, capability.Err))
+	}
+	return out.String()
+}
+
+// ProbeEnvironment probes the current environment for the capabilities fd
+// discovery and enrichment rely on, such as procfs availability, pidfd
+// support, and sock_diag permissions, as well as sandbox policies, such as
+// seccomp or Landlock, blocking syscalls, and returns the resulting capability
+// matrix.
+func ProbeEnvironment() EnvironmentReport {
+	report := EnvironmentReport{}
+	var uname unix.Utsname
+	if unix.Uname(&uname) == nil {
+		report.KernelRelease = unix.ByteSliceToString(uname.Release[:])
+	}
+	probe := func(name string, fn func() error) {
+		err := fn()
+		report.Capabilities = append(report.Capabilities, Capability{
+			Name:      name,
+			Available: err == nil,
+			Err:       err,
+		})
+	}
+
+	probe(CapabilityProcfs, func() error {
+		_, err := os.ReadDir(procSelfPath() + "/fd")
+		return err
+	})
+
+	// Use a pipe as a well-known fd to probe with.
+	var pipefds [2]int
+	pipeErr := unix.Pipe2(pipefds[:], unix.O_CLOEXEC)
+	if pipeErr == nil {
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+	}
+	probe(CapabilityFdinfo, func() error {
+		if pipeErr != nil {
+			return pipeErr
+		}
+		_, err := newFiledesc(pipefds[0], procSelfPath()+"/fd", nil)
+		return err
+	})
+	probe(CapabilityStatx, func() error {
+		var stx unix.Statx_t
+		return statx(unix.AT_FDCWD, "/", unix.AT_STATX_DONT_SYNC, unix.STATX_INO, &stx)
+	})
+	probe(CapabilityPidfd, func() error {
+		if pipeErr != nil {
+			return pipeErr
+		}
+		pidFd, err := unix.PidfdOpen(os.Getpid(), 0)
+		if err != nil {
+			return err
+		}
+		defer unix.Close(pidFd)
+		fd, err := pidfdGetfd(pidFd, pipefds[0], 0)
+		if err != nil {
+			return err
+		}
+		return unix.Close(fd)
+	})
+	probe(CapabilityReadlink, func() error {
+		if pipeErr != nil {
+			return pipeErr
+		}
+		_, err := readlink(fmt.Sprintf("%s/fd/%d", procSelfPath(), pipefds[0]))
+		return restricted("readlink", err)
+	})
+	probe(CapabilityGetsockopt, func() error {
+		fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		defer unix.Close(fd)
+		_, err = getsockoptInt(fd, unix.SOL_SOCKET, unix.SO_DOMAIN)
+		return restricted("getsockopt", err)
+	})
+	probe(CapabilitySockDiag, func() error {
+		pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		defer unix.Close(pair[0])
+		defer unix.Close(pair[1])
+		var stat unix.Stat_t
+		if err := unix.Fstat(pair[0], &stat); err != nil {
+			return err
+		}
+		_, err = unixRecvQueueLen(stat.Ino)
+		return err
+	})
+	return report
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("environment probing", func() {
+
+	It("probes the environment", func() {
+		report := ProbeEnvironment()
+		Expect(report.KernelRelease).NotTo(BeEmpty())
+		Expect(report.Capabilities).To(HaveEach(
+			HaveField("Name", BeElementOf(CapabilityProcfs, CapabilityFdinfo, CapabilityStatx,
+				CapabilityPidfd, CapabilityReadlink, CapabilityGetsockopt, CapabilitySockDiag))))
+		Expect(report.Capabilities).To(HaveLen(7))
+		Expect(report.Available(CapabilityProcfs)).To(BeTrue())
+		Expect(report.Available(CapabilityStatx)).To(BeTrue())
+		Expect(report.Available("foobar")).To(BeFalse())
+		Expect(report.Description(0)).To(MatchRegexp(
+			`^kernel .+:\n\s+procfs: available\n`))
+	})
+
+	It("reports unavailable capabilities", Serial, func() {
+		oldGetfd := pidfdGetfd
+		DeferCleanup(func() { pidfdGetfd = oldGetfd })
+		pidfdGetfd = func(int, int, int) (int, error) { return -1, unix.ENOSYS }
+
+		report := ProbeEnvironment()
+		Expect(report.Available(CapabilityPidfd)).To(BeFalse())
+		Expect(report.Capabilities).To(ContainElement(And(
+			HaveField("Name", CapabilityPidfd),
+			HaveField("Err", Satisfy(func(err error) bool { return errors.Is(err, unix.ENOSYS) })))))
+		Expect(report.Description(0)).To(ContainSubstring(
+			"pidfd_getfd: unavailable: function not implemented"))
+	})
+
+	It("reports sandbox restrictions", Serial, func() {
+		oldReadlink, oldGetsockopt := readlink, getsockoptInt
+		DeferCleanup(func() { readlink, getsockoptInt = oldReadlink, oldGetsockopt })
+		readlink = func(string) (string, error) { return "", unix.EACCES }
+		getsockoptInt = func(int, int, int) (int, error) { return 0, unix.EPERM }
+
+		report := ProbeEnvironment()
+		Expect(report.Available(CapabilityReadlink)).To(BeFalse())
+		Expect(report.Available(CapabilityGetsockopt)).To(BeFalse())
+		Expect(report.Description(0)).To(ContainSubstring(
+			"getsockopt: unavailable: getsockopt blocked by sandbox policy: operation not permitted"))
+	})
+
+})
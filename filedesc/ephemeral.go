@@ -0,0 +1,239 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Definitions from the inet_diag UAPI, see:
+// https://elixir.bootlin.com/linux/latest/source/include/uapi/linux/inet_diag.h
+const (
+	sizeofInetDiagReqV2 = 56 // sizeof(struct inet_diag_req_v2)
+	sizeofInetDiagMsg   = 72 // sizeof(struct inet_diag_msg)
+)
+
+// EphemeralPortRange returns the range of local ports used for ephemeral
+// ports, as configured by the net.ipv4.ip_local_port_range sysctl, which also
+// applies to IPv6.
+func EphemeralPortRange() (low int, high int, err error) {
+	portRange, err := os.ReadFile(ProcRoot + "/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(portRange))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("invalid ip_local_port_range %q", strings.TrimSpace(string(portRange)))
+	}
+	if low, err = strconv.Atoi(fields[0]); err != nil {
+		return 0, 0, err
+	}
+	if high, err = strconv.Atoi(fields[1]); err != nil {
+		return 0, 0, err
+	}
+	return low, high, nil
+}
+
+// EphemeralPortUsage details the consumption of ephemeral ports by the client
+// TCP sockets of a process. As the same ephemeral port can be used for
+// connections to different peers, ephemeral ports are exhausted per peer.
+type EphemeralPortUsage struct {
+	Low, High   int            // ephemeral port range.
+	Established int            // ESTABLISHED client sockets of the process.
+	TimeWait    int            // client sockets in TIME_WAIT.
+	PerPeer     map[string]int // ESTABLISHED and TIME_WAIT client sockets per peer address.
+}
+
+// Size returns the number of ports in the ephemeral port range.
+func (u EphemeralPortUsage) Size() int { return u.High - u.Low + 1 }
+
+// Utilization returns the peer address with the most client sockets using
+// ephemeral ports, together with the fraction of the ephemeral port range
+// these sockets use. If there are no such sockets, Utilization returns an
+// empty peer address and zero.
+func (u EphemeralPortUsage) Utilization() (peer string, fraction float64) {
+	most := 0
+	for p, count := range u.PerPeer {
+		if count > most || (count == most && p < peer) {
+			peer, most = p, count
+		}
+	}
+	if most == 0 || u.Size() <= 0 {
+		return "", 0
+	}
+	return peer, float64(most) / float64(u.Size())
+}
+
+// Description returns a pretty formatted multi-line textual description of the
+// ephemeral port usage, listing the peers in order of decreasing usage.
+func (u EphemeralPortUsage) Description(indentation uint) string {
+	var buff strings.Builder
+	buff.WriteString(fmt.Sprintf("%sephemeral ports %d-%d: %d ESTABLISHED, %d TIME_WAIT client sockets",
+		Indentation(indentation), u.Low, u.High, u.Established, u.TimeWait))
+	peers := make([]string, 0, len(u.PerPeer))
+	for peer := range u.PerPeer {
+		peers = append(peers, peer)
+	}
+	slices.SortFunc(peers, func(a, b string) int {
+		if u.PerPeer[a] != u.PerPeer[b] {
+			return u.PerPeer[b] - u.PerPeer[a]
+		}
+		return strings.Compare(a, b)
+	})
+	indent := Indentation(indentation + 1)
+	for _, peer := range peers {
+		buff.WriteString(fmt.Sprintf("\n%speer %q: %d ports (%.1f%%)",
+			indent, peer, u.PerPeer[peer], 100*float64(u.PerPeer[peer])/float64(u.Size())))
+	}
+	return buff.String()
+}
+
+// ProcessEphemeralPortUsage returns the ephemeral port usage of the process
+// identified by pid, based on its ESTABLISHED TCP client sockets with local
+// ports from the ephemeral port range. As sockets in TIME_WAIT are owned by the
+// kernel instead of any process, all sockets in TIME_WAIT with ephemeral local
+// ports are accounted for. Please note that sock_diag only sees the sockets of
+// the network namespace of the calling process.
+func ProcessEphemeralPortUsage(pid int) (EphemeralPortUsage, error) {
+	low, high, err := EphemeralPortRange()
+	if err != nil {
+		return EphemeralPortUsage{}, err
+	}
+	fds, err := ProcessFiledescriptorsWith(pid, OnlyKinds("socket"))
+	if err != nil {
+		return EphemeralPortUsage{}, err
+	}
+	inos := map[uint64]struct{}{}
+	for _, fd := range fds {
+		inos[fd.(*SocketFd).Ino()] = struct{}{}
+	}
+	usage := EphemeralPortUsage{Low: low, High: high, PerPeer: map[string]int{}}
+	for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+		socks, err := tcpClientSockets(family)
+		if err != nil {
+			return EphemeralPortUsage{}, err
+		}
+		for _, sock := range socks {
+			if sock.localPort < low || sock.localPort > high {
+				continue
+			}
+			switch sock.state {
+			case unix.BPF_TCP_ESTABLISHED:
+				if _, ok := inos[sock.ino]; !ok {
+					continue
+				}
+				usage.Established++
+			case unix.BPF_TCP_TIME_WAIT:
+				usage.TimeWait++
+			default:
+				continue
+			}
+			usage.PerPeer[sock.peer]++
+		}
+	}
+	return usage, nil
+}
+
+// inetDiagSock is a TCP socket as reported by the inet_diag netlink
+// interface.
+type inetDiagSock struct {
+	state     int
+	localPort int
+	peer      string // peer address in "host:port" format.
+	ino       uint64
+}
+
+// tcpClientSockets returns the ESTABLISHED and TIME_WAIT TCP sockets of the
+// specified address family in the network namespace of the calling process.
+func tcpClientSockets(family uint8) ([]inetDiagSock, error) {
+	nlfd, err := counted(unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG))
+	if err != nil {
+		return nil, err
+	}
+	defer closeFd(nlfd)
+
+	req := make([]byte, unix.NLMSG_HDRLEN+sizeofInetDiagReqV2)
+	ne := binary.NativeEndian
+	ne.PutUint32(req[0:], uint32(len(req)))                   // nlmsg_len
+	ne.PutUint16(req[4:], unix.SOCK_DIAG_BY_FAMILY)           // nlmsg_type
+	ne.PutUint16(req[6:], unix.NLM_F_REQUEST|unix.NLM_F_DUMP) // nlmsg_flags
+	diag := req[unix.NLMSG_HDRLEN:]
+	diag[0] = family                                                              // sdiag_family
+	diag[1] = unix.IPPROTO_TCP                                                    // sdiag_protocol
+	ne.PutUint32(diag[4:], 1<<unix.BPF_TCP_ESTABLISHED|1<<unix.BPF_TCP_TIME_WAIT) // idiag_states
+	if err := countedErr(unix.Sendto(nlfd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})); err != nil {
+		return nil, err
+	}
+
+	var socks []inetDiagSock
+	resp := make([]byte, 32*1024)
+	for {
+		n, err := recvfrom(nlfd, resp)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(resp[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			switch msg.Header.Type {
+			case unix.NLMSG_DONE:
+				return socks, nil
+			case unix.NLMSG_ERROR:
+				if len(msg.Data) >= 4 {
+					if errno := int32(ne.Uint32(msg.Data)); errno < 0 {
+						return nil, syscall.Errno(-errno)
+					}
+				}
+				return nil, errors.New("sock_diag error")
+			case unix.SOCK_DIAG_BY_FAMILY:
+				if len(msg.Data) < sizeofInetDiagMsg {
+					return nil, errors.New("truncated inet_diag_msg")
+				}
+				socks = append(socks, inetDiagSockFrom(family, msg.Data))
+			}
+		}
+	}
+}
+
+// inetDiagSockFrom returns the socket details from the specified
+// inet_diag_msg.
+func inetDiagSockFrom(family uint8, msg []byte) inetDiagSock {
+	be := binary.BigEndian
+	iplen := net.IPv4len
+	if family == unix.AF_INET6 {
+		iplen = net.IPv6len
+	}
+	peerIP := net.IP(slices.Clone(msg[24 : 24+iplen])) // id.idiag_dst
+	return inetDiagSock{
+		state:     int(msg[1]),                                                              // idiag_state
+		localPort: int(be.Uint16(msg[4:])),                                                  // id.idiag_sport
+		peer:      net.JoinHostPort(peerIP.String(), strconv.Itoa(int(be.Uint16(msg[6:])))), // id.idiag_dport
+		ino:       uint64(binary.NativeEndian.Uint32(msg[68:])),                             // idiag_inode
+	}
+}
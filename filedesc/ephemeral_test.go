@@ -0,0 +1,76 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("ephemeral ports", func() {
+
+	It("reads the ephemeral port range", Serial, func() {
+		low, high, err := EphemeralPortRange()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(low).To(BeNumerically(">", 0))
+		Expect(high).To(BeNumerically(">=", low))
+
+		oldProcRoot := ProcRoot
+		DeferCleanup(func() { ProcRoot = oldProcRoot })
+		ProcRoot = GinkgoT().TempDir()
+		portRange := filepath.Join(ProcRoot, "sys/net/ipv4/ip_local_port_range")
+		Expect(EphemeralPortRange()).Error().To(HaveOccurred())
+		Expect(os.MkdirAll(filepath.Dir(portRange), 0700)).To(Succeed())
+		Expect(os.WriteFile(portRange, []byte("1000\n"), 0600)).To(Succeed())
+		Expect(EphemeralPortRange()).Error().To(HaveOccurred())
+		Expect(os.WriteFile(portRange, []byte("1000\t1999\n"), 0600)).To(Succeed())
+		low, high, err = EphemeralPortRange()
+		Expect(err).NotTo(HaveOccurred())
+		Expect([]int{low, high}).To(Equal([]int{1000, 1999}))
+		Expect(EphemeralPortUsage{Low: low, High: high}.Size()).To(Equal(1000))
+	})
+
+	It("accounts for client sockets per peer", func() {
+		l := Successful(net.Listen("tcp", "127.0.0.1:0"))
+		defer l.Close()
+		for range 5 {
+			conn := Successful(net.Dial("tcp", l.Addr().String()))
+			defer conn.Close()
+			sconn := Successful(l.Accept())
+			defer sconn.Close()
+		}
+
+		usage := Successful(ProcessEphemeralPortUsage(os.Getpid()))
+		Expect(usage.Established).To(BeNumerically(">=", 5))
+		Expect(usage.PerPeer).To(HaveKeyWithValue(l.Addr().String(), BeNumerically(">=", 5)))
+		peer, fraction := usage.Utilization()
+		Expect(peer).NotTo(BeEmpty())
+		Expect(fraction).To(BeNumerically(">", 0))
+		Expect(usage.Description(0)).To(MatchRegexp(
+			`^ephemeral ports \d+-\d+: \d+ ESTABLISHED, \d+ TIME_WAIT client sockets\n\s+peer ".*": \d+ ports \(\d+\.\d%\)`))
+
+		peer, fraction = EphemeralPortUsage{Low: 1, High: 10}.Utilization()
+		Expect(peer).To(BeEmpty())
+		Expect(fraction).To(BeZero())
+	})
+
+})
@@ -0,0 +1,78 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// EpollEvents specifies the event mask of an epoll target file descriptor
+// (“tfd”), as shown in the fdinfo of an eventpoll file descriptor. It
+// additionally implements Stringer returning the known set bits with their
+// symbolic constant names.
+type EpollEvents uint32
+
+// Names returns the known symbolic constant names for the set bit(s), in the
+// order of their bit values. Any unknown remaining bits are returned as a
+// single hex number.
+func (e EpollEvents) Names() []string {
+	n := make([]string, 0)
+	remaining := uint32(e)
+	for _, event := range epollEventNames {
+		if remaining&event.bit != 0 {
+			n = append(n, event.name)
+			remaining &^= event.bit
+		}
+	}
+	if remaining != 0 {
+		n = append(n, fmt.Sprintf("0x%x", remaining))
+	}
+	return n
+}
+
+// String returns the symbolic names of the set bits, joined by “|”.
+func (e EpollEvents) String() string {
+	return strings.Join(e.Names(), "|")
+}
+
+// epollEventNames lists the epoll event bits with their textual names, in order
+// of their bit values. Please note that the “input-only” flags EPOLLEXCLUSIVE,
+// EPOLLWAKEUP, EPOLLONESHOT, and EPOLLET are also part of the event mask as
+// shown in fdinfo.
+var epollEventNames = []struct {
+	bit  uint32
+	name string
+}{
+	{unix.EPOLLIN, "EPOLLIN"},
+	{unix.EPOLLPRI, "EPOLLPRI"},
+	{unix.EPOLLOUT, "EPOLLOUT"},
+	{unix.EPOLLERR, "EPOLLERR"},
+	{unix.EPOLLHUP, "EPOLLHUP"},
+	{unix.EPOLLRDNORM, "EPOLLRDNORM"},
+	{unix.EPOLLRDBAND, "EPOLLRDBAND"},
+	{unix.EPOLLWRNORM, "EPOLLWRNORM"},
+	{unix.EPOLLWRBAND, "EPOLLWRBAND"},
+	{unix.EPOLLMSG, "EPOLLMSG"},
+	{unix.EPOLLRDHUP, "EPOLLRDHUP"},
+	{unix.EPOLLEXCLUSIVE, "EPOLLEXCLUSIVE"},
+	{unix.EPOLLWAKEUP, "EPOLLWAKEUP"},
+	{unix.EPOLLONESHOT, "EPOLLONESHOT"},
+	{unix.EPOLLET, "EPOLLET"},
+}
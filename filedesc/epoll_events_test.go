@@ -0,0 +1,41 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("epoll events", func() {
+
+	It("returns correct event names", func() {
+		Expect(EpollEvents(0).Names()).To(BeEmpty())
+		Expect(EpollEvents(unix.EPOLLIN | unix.EPOLLOUT | unix.EPOLLET).Names()).To(
+			Equal([]string{"EPOLLIN", "EPOLLOUT", "EPOLLET"}))
+		Expect(EpollEvents(unix.EPOLLIN | unix.EPOLLEXCLUSIVE | unix.EPOLLONESHOT).String()).To(
+			Equal("EPOLLIN|EPOLLEXCLUSIVE|EPOLLONESHOT"))
+	})
+
+	It("returns unknown bits in hex", func() {
+		Expect(EpollEvents(unix.EPOLLHUP | 0x1000000).Names()).To(
+			Equal([]string{"EPOLLHUP", "0x1000000"}))
+	})
+
+})
@@ -24,8 +24,11 @@ import (
 	"math"
 	"math/bits"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // FileDescriptor describes a Linux “fd” file descriptor in more detail than
@@ -47,7 +50,7 @@ type FileDescriptor interface {
 //
 // [procfs]: https://man7.org/linux/man-pages/man5/proc.5.html
 func Filedescriptors() []FileDescriptor {
-	fds, _ := filedescriptors("/proc/self/fd") // keep silent in case of errors
+	fds, _ := filedescriptors(ownFdPath()) // keep silent in case of errors
 	return fds
 }
 
@@ -56,48 +59,193 @@ func Filedescriptors() []FileDescriptor {
 // process does not possess the necessary access rights to the process
 // identified by pid an error is returned instead.
 func ProcessFiledescriptors(pid int) ([]FileDescriptor, error) {
-	return filedescriptors(fmt.Sprintf("/proc/%d/fd", pid))
+	return filedescriptors(procPIDPath(pid) + "/fd")
 }
 
-// internal implementation to discovery file descriptors that can be tested
-// using fake proc file systems.
-func filedescriptors(fdDirPath string) ([]FileDescriptor, error) {
-	// Don't use ioutil.ReadDir as it will **incorrectly sort** the fd numbers!
-	// Well, don't use ioutil anymore anyway ;)
-	fdfilesdir, err := os.Open(fdDirPath)
+// FdNumbers returns the sorted fd numbers of the currently open file
+// descriptors for this process, without any further discovery. This is cheap
+// even for huge fd tables, so it can be used to plan chunked discoveries using
+// [OnlyFdRange].
+func FdNumbers() ([]int, error) {
+	return fdNumbers(ownFdPath())
+}
+
+// ProcessFdNumbers returns the sorted fd numbers of the currently open file
+// descriptors for the process identified by pid, without any further
+// discovery.
+func ProcessFdNumbers(pid int) ([]int, error) {
+	return fdNumbers(fdDirPathOf(pid))
+}
+
+// fdDirPathOf returns the path of the procfs fd directory of the process
+// identified by pid, preferring the fast path for the calling process.
+func fdDirPathOf(pid int) string {
+	if pid == os.Getpid() {
+		return ownFdPath()
+	}
+	return procPIDPath(pid) + "/fd"
+}
+
+// CountFds returns the number of currently open file descriptors for the
+// process identified by pid, only counting the entries of its procfs fd
+// directory without any further discovery, so it is nearly free. For the
+// calling process, the fd for reading its fd directory isn't counted.
+func CountFds(pid int) (int, error) {
+	fdNos, err := ProcessFdNumbers(pid)
+	return len(fdNos), err
+}
+
+// fdNumbers returns the sorted fd numbers from the specified procfs fd
+// directory.
+func fdNumbers(fdDirPath string) ([]int, error) {
+	dirfd, err := openDir(fdDirPath)
 	if err != nil {
 		return nil, err
 	}
-	defer fdfilesdir.Close()
-	// In case we now read the open fds from our process's fd directory, we
-	// cannot avoid but to include this directory read fd also, so we need to
-	// skip and drop it later when fetching fd details.
-	fdfiles, err := fdfilesdir.ReadDir(-1)
+	defer closeFd(dirfd)
+	names, err := readDirnames(dirfd, fdDirPath)
 	if err != nil {
 		return nil, err
 	}
-	fds := make([]FileDescriptor, 0, len(fdfiles)-1)
+	return sortedFdNumbers(fdDirPath, dirfd, names), nil
+}
+
+// sortedFdNumbers returns the sorted fd numbers from the specified names read
+// from the fd directory at fdDirPath, skipping the fd of the directory itself
+// when reading the fd directory of the calling process.
+func sortedFdNumbers(fdDirPath string, dirfd int, names []string) []int {
 	skipDirectoryFdNo := -1
-	if strings.HasPrefix(fdDirPath, "/proc/self/") {
-		skipDirectoryFdNo = int(fdfilesdir.Fd())
+	if isOwnBase(fdDirPath) {
+		skipDirectoryFdNo = dirfd
 	}
-	for _, fdfile := range fdfiles {
-		fdNo, err := strconv.Atoi(fdfile.Name())
+	fdNos := make([]int, 0, len(names))
+	for _, name := range names {
+		fdNo, err := strconv.Atoi(name)
 		if err != nil || fdNo == skipDirectoryFdNo {
 			continue
 		}
-		fdesc, err := newWithBase(fdNo, fdDirPath)
+		fdNos = append(fdNos, fdNo)
+	}
+	slices.Sort(fdNos)
+	return fdNos
+}
+
+// internal implementation to discovery file descriptors that can be tested
+// using fake proc file systems.
+func filedescriptors(fdDirPath string) ([]FileDescriptor, error) {
+	return discover(fdDirPath, nil, nil)
+}
+
+// discover returns the file descriptors from the specified procfs fd
+// directory. If report isn't nil, discover falls back to degraded file
+// descriptors where enrichment steps fail due to missing privileges, noting the
+// skipped steps in the report. If opts isn't nil, only the selected file
+// descriptors are discovered.
+func discover(fdDirPath string, report *CapabilitiesReport, opts *discoveryOptions) ([]FileDescriptor, error) {
+	defer opts.trackStats()()
+	// In case we now read the open fds from our process's fd directory, we
+	// cannot avoid but to include this directory read fd also, so fdNumbers
+	// skips it.
+	fdNos, err := fdNumbers(fdDirPath)
+	if err != nil {
+		return nil, err
+	}
+	return enrich(fdDirPath, fdNos, report, opts)
+}
+
+// FiledescriptorsOf returns the list of file descriptors with the specified
+// fd numbers that are still open in this process, restricted by the specified
+// discovery options. In contrast to [FiledescriptorsWith], FiledescriptorsOf
+// doesn't read the fd directory, so that processes with huge fd tables can
+// discover their fds in chunks of the fd numbers returned by [FdNumbers]
+// without repeatedly reading the complete fd table. When discovering
+// [WithContext] and the context is done before all fds have been discovered,
+// FiledescriptorsOf returns only the fds discovered so far and the context's
+// error.
+func FiledescriptorsOf(fdNos []int, opts ...DiscoveryOption) ([]FileDescriptor, error) {
+	o := newDiscoveryOptions(opts)
+	defer o.trackStats()()
+	return enrich(ownFdPath(), fdNos, nil, o)
+}
+
+// enrich returns the file descriptors with the specified fd numbers from the
+// specified procfs fd directory, silently skipping fds that have been closed
+// in the meantime. See [discover] for the report and discovery options.
+func enrich(fdDirPath string, fdNos []int, report *CapabilitiesReport, opts *discoveryOptions) (fds []FileDescriptor, err error) {
+	if opts == nil {
+		opts = &discoveryOptions{} // the defaults, but caching per-discovery state.
+	}
+	fds = make([]FileDescriptor, 0, len(fdNos))
+	defer func() {
+		anchorFds(fds, fdDirPath)
+		markResolverPeers(fds, fdDirPath)
+		if opts.sameFileAcrossMounts() {
+			canonicalizePaths(fds, pidFromBase(fdDirPath))
+		}
+		if opts != nil && opts.stats != nil {
+			opts.stats.Fds += len(fds)
+		}
+	}()
+	for _, fdNo := range fdNos {
+		if !opts.selectsFdNo(fdNo) {
+			continue
+		}
+		if err := opts.done(); err != nil {
+			return fds, err
+		}
+		linkDest, err := readlink(fmt.Sprintf("%s/%d", fdDirPath, fdNo))
+		if err != nil {
+			if !isPrivilegeError(err) {
+				continue // silently skip fds that have been gone by now.
+			}
+			// A sandbox policy blocks reading the fd links, so try to
+			// reconstruct the link from what statx tells us about the fd.
+			linkDest = linkDestFromStat(fdNo, fdDirPath, opts.enrichmentTimeout())
+			if report != nil {
+				report.Skipped = append(report.Skipped, SkippedEnrichment{
+					FdNo: fdNo,
+					Step: "link",
+					Err:  restricted("readlink", err),
+				})
+			}
+		}
+		if !opts.selectsKind(linkKind(linkDest)) {
+			continue
+		}
+		enrichStart := time.Now()
+		fdesc, err := new(fdNo, fdDirPath, linkDest, opts)
+		if opts != nil && opts.stats != nil {
+			opts.stats.Enrichment += time.Since(enrichStart)
+		}
 		if err != nil {
-			continue // silently skip fds that have been gone by now.
+			var restrictedErr *RestrictedError
+			if report == nil && !errors.As(err, &restrictedErr) {
+				continue
+			}
+			// Try to fall back onto what procfs offers if we lack the
+			// privileges for the full enrichment, or a sandbox policy blocks
+			// it.
+			fdesc, err = newDegraded(fdNo, fdDirPath, linkDest, err, report, opts)
+			if err != nil {
+				continue
+			}
 		}
+		setLink(fdesc, linkDest)
 		fds = append(fds, fdesc)
 	}
 	return fds, nil
 }
 
+// setLink sets the fd link destination the specified fd was discovered from.
+func setLink(fd FileDescriptor, linkDest string) {
+	if fd, ok := fd.(interface{ setLink(link string) }); ok {
+		fd.setLink(linkDest)
+	}
+}
+
 // New returns a FileDescriptor for the fd number specified. The information
 // about the specified fd is gathered from the procfs filesystem mounted on
-// /proc.
+// [ProcRoot].
 func New(fdNo int) (FileDescriptor, error) {
 	return NewForPID(fdNo, os.Getpid())
 }
@@ -105,125 +253,305 @@ func New(fdNo int) (FileDescriptor, error) {
 // NewForPID returns a FileDescriptor for the process identified by pid and the
 // particular fd number.
 func NewForPID(fdNo int, pid int) (FileDescriptor, error) {
-	return newWithBase(fdNo, fmt.Sprintf("/proc/%d/fd", pid))
+	return newWithBase(fdNo, procPIDPath(pid)+"/fd")
 }
 
 // newWithBase returns a FileDescriptor for the fd of the process in the procfs
 // with the base path.
 func newWithBase(fdNo int, base string) (FileDescriptor, error) {
-	linkDest, err := os.Readlink(fmt.Sprintf("%s/%d", base, fdNo))
+	linkDest, err := readlinkCounted(fmt.Sprintf("%s/%d", base, fdNo))
+	if err != nil {
+		return nil, err
+	}
+	fdesc, err := new(fdNo, base, linkDest, nil)
 	if err != nil {
 		return nil, err
 	}
-	return new(fdNo, base, linkDest)
+	setLink(fdesc, linkDest)
+	anchorFds([]FileDescriptor{fdesc}, base)
+	markResolverPeers([]FileDescriptor{fdesc}, base)
+	return fdesc, nil
+}
+
+// anchorFds sets the start time of the owning process on the specified fds of
+// a process other than the calling process, reading the start time only once
+// instead of once per fd. The calling process's own fds are already anchored
+// when creating them.
+func anchorFds(fds []FileDescriptor, base string) {
+	if len(fds) == 0 || isOwnBase(base) || pidFromBase(base) == 0 {
+		return
+	}
+	start, err := startTime(filepath.Dir(base) + "/stat")
+	if err != nil {
+		return
+	}
+	for _, fd := range fds {
+		if fd, ok := fd.(interface{ anchor(start uint64) }); ok {
+			fd.anchor(start)
+		}
+	}
 }
 
 // new returns a new FileDescriptor for the specified fd number, corresponding
-// with the specified link.
-func new(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+// with the specified link, using the specified discovery options.
+func new(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
 	// Is this one of the various anonymous inode fd types? As it doesn't fit
 	// into the TYPE:[INO] pattern, we have to check for it separately.
 	if strings.HasPrefix(linkDest, anonInodePrefix) {
-		return NewAnonInodeFd(fdNo, base, linkDest)
+		return newAnonInodeFd(fdNo, base, linkDest, o)
 	}
 	// Is this one of the links with an embedded file type and inode number?
 	if delim := strings.Index(linkDest, ":["); delim > 1 {
 		factory, ok := fdTypeFactories[linkDest[:delim]]
 		if ok {
-			return factory(fdNo, base, linkDest)
+			return factory(fdNo, base, linkDest, o)
 		}
 	}
+	// POSIX shared memory objects are files, but deserve their own type.
+	if strings.HasPrefix(linkDest, shmPrefix) {
+		return newShmFd(fdNo, base, linkDest, o)
+	}
 	// Fall back onto the plain file system path fd type.
-	return NewPathFd(fdNo, base, linkDest)
+	return newPathFd(fdNo, base, linkDest, o)
 }
 
 // fdConstructor returns a new FileDescriptor for the specified fd number and
-// link “destination”. These destinations can be “ordinary” file paths, or in
-// the formats “type:[inode]” and “anon_inode:<type>”.
-type fdConstructor func(fdNo int, base string, linkDest string) (FileDescriptor, error)
+// link “destination”, using the specified discovery options (nil meaning the
+// defaults). These destinations can be “ordinary” file paths, or in the
+// formats “type:[inode]” and “anon_inode:<type>”.
+type fdConstructor func(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error)
 
 // fdTypeFactories maps “type:[inode]” fd link destinations to their
 // corresponding type factory.
 var fdTypeFactories = map[string]fdConstructor{
-	"pipe":   NewPipeFd,
-	"socket": NewSocketFd,
+	"pipe":   newPipeFd,
+	"socket": newSocketFd,
+	// Linux-kernel namespaces
+	"cgroup": newNamespaceFd,
+	"ipc":    newNamespaceFd,
+	"mnt":    newNamespaceFd,
+	"net":    newNamespaceFd,
+	"pid":    newNamespaceFd,
+	"time":   newNamespaceFd,
+	"user":   newNamespaceFd,
+	"uts":    newNamespaceFd,
 }
 
 // filedesc describes the information common to all “types” of file descriptors.
 type filedesc struct {
-	fdNo  int   // file descriptor number
-	flags Flags // access mode and status flags as used by open(2)
-	mntId int   // mount ID; might be present in /proc/self/mountinfo
+	fdNo  int               // file descriptor number
+	flags Flags             // access mode and status flags as used by open(2)
+	pos   int64             // file offset
+	mntId int               // mount ID; might be present in /proc/self/mountinfo
+	pid   int               // PID of the process owning this fd, or 0 if unknown
+	start uint64            // start time of the owning process, or 0 if unknown
+	raw   map[string]string // complete fdinfo, only if WithRawFdinfo is used
+	link  string            // fd link destination, or "" if unknown
+
+	warnings []string // lenient fdinfo parse warnings
 }
 
 // newFiledesc returns a new filedesc for a specific fd (number), initialized
-// with information gathered from the procfs filesystem mounted on /proc.
-func newFiledesc(fdNo int, base string) (filedesc, error) {
+// with information gathered from the procfs filesystem at base, using the
+// specified discovery options. For the
+// calling process's own fds, newFiledesc takes the fast path via syscalls
+// where possible; see [WithoutFastOwnDiscovery].
+func newFiledesc(fdNo int, base string, o *discoveryOptions) (filedesc, error) {
+	if o.fastOwnDiscovery() && isOwnBase(base) {
+		if f, err := ownFiledesc(fdNo, o); err == nil {
+			return f, nil
+		}
+	}
 	// for some types of file descriptors, we might face a rather lengthy
 	// fdinfo, so we don't try to swallow it completely, but only read up to the
 	// point we need. As it seems, the generic bits of information always come
 	// first.
-	file, err := os.Open(fmt.Sprintf("%sinfo/%d", base, fdNo))
+	file, err := openFile(fmt.Sprintf("%sinfo/%d", base, fdNo))
 	if err != nil {
 		return filedesc{}, err
 	}
 	defer file.Close()
-	return fdFromReader(fdNo, file)
+	f, err := fdFromReader(fdNo, file, o.parsesStrictly())
+	if err != nil {
+		return filedesc{}, err
+	}
+	f.pid = pidFromBase(base)
+	if isOwnBase(base) {
+		f.start, _ = ownStartTime()
+	}
+	if o.retainsRawFdinfo() {
+		f.raw, _ = readFdinfo(fdNo, base)
+	}
+	return f, nil
+}
+
+// pidFromBase returns the PID of the process whose fd directory is at the
+// specified base path, or 0 if the base path doesn't identify a process.
+func pidFromBase(base string) int {
+	pidArg := filepath.Base(filepath.Dir(base))
+	if pidArg == "self" || pidArg == "thread-self" {
+		return os.Getpid()
+	}
+	pid, err := strconv.Atoi(pidArg)
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	return pid
 }
 
 // fdFromReader returns a filedesc initialized from the fdinfo read from the
-// specified reader.
-func fdFromReader(fd int, r io.Reader) (filedesc, error) {
+// specified reader. Unless strict, malformed or unknown fdinfo doesn't fail,
+// but gets recorded as parse warnings instead. As older
+// kernels omit the mnt_id line, a missing mnt_id is valid and means an unknown
+// mount ID only on kernels without fdinfo mount IDs, see [KernelFeatures]. A
+// zero mnt_id is always valid and means an unknown mount ID.
+func fdFromReader(fd int, r io.Reader, strict bool) (filedesc, error) {
 	f := filedesc{fdNo: fd}
+	malformed := func(err error) error {
+		if strict {
+			return err
+		}
+		f.warnings = append(f.warnings, err.Error())
+		return nil
+	}
 	scanner := bufio.NewScanner(r)
-	complete := false
+	complete, hasMntId := false, false
 scanning:
 	for scanner.Scan() {
 		line := scanner.Text()
 		switch {
 		case strings.HasPrefix(line, "pos:"):
-			// ...go on...
+			pos, err := strconv.ParseInt(strings.Trim(line[4:], "\t "), 10, 64)
+			if err != nil {
+				if err := malformed(err); err != nil {
+					return filedesc{}, err
+				}
+				continue
+			}
+			f.pos = pos
 		case strings.HasPrefix(line, "flags:"):
 			flags, err := strconv.ParseUint(strings.Trim(line[6:], "\t "), 8, bits.UintSize)
-			if err != nil {
-				return filedesc{}, err
+			if err == nil && flags > math.MaxInt {
+				err = fmt.Errorf("fdFromReader: flags outside range: %d", flags)
 			}
-			if flags > math.MaxInt {
-				return filedesc{}, fmt.Errorf("fdFromReader: flags outside range: %d", flags)
+			if err != nil {
+				if err := malformed(err); err != nil {
+					return filedesc{}, err
+				}
+				continue
 			}
 			f.flags = Flags(flags)
+			complete = true
 		case strings.HasPrefix(line, "mnt_id:"):
+			complete, hasMntId = true, true
 			mntId, err := strconv.ParseInt(strings.Trim(line[7:], "\t "), 10, bits.UintSize)
-			if err != nil {
-				return filedesc{}, err
+			if err == nil && (mntId < 0 || mntId > math.MaxInt) {
+				err = fmt.Errorf("fdFromReader: mnt_id outside range: %d", mntId)
 			}
-			if mntId <= 0 || mntId > math.MaxInt {
-				return filedesc{}, fmt.Errorf("fdFromReader: mnt_id outside range: %d", mntId)
+			if err != nil {
+				if err := malformed(err); err != nil {
+					return filedesc{}, err
+				}
+				break scanning
 			}
 			f.mntId = int(mntId)
-			complete = true
 			break scanning
+		default:
+			if err := malformed(fmt.Errorf("fdFromReader: unknown fdinfo line %q", line)); err != nil {
+				return filedesc{}, err
+			}
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		return filedesc{}, err
 	}
 	if !complete {
-		return filedesc{}, errors.New("fdFromReader: incomplete fdinfo data")
+		if err := malformed(errors.New("fdFromReader: incomplete fdinfo data")); err != nil {
+			return filedesc{}, err
+		}
+	} else if !hasMntId && features().FdinfoMntID {
+		if err := malformed(errors.New("fdFromReader: missing mnt_id")); err != nil {
+			return filedesc{}, err
+		}
 	}
 	return f, nil
 }
 
+// readFdinfo returns the key-value pairs from the complete fdinfo of the
+// specified fd (number). Please note that keys are returned without trailing
+// colons and values are returned with surrounding whitespace trimmed. The
+// values of keys appearing multiple times, such as the “tfd” lines of eventpoll
+// fds, are joined with newlines.
+func readFdinfo(fdNo int, base string) (map[string]string, error) {
+	file, err := openFile(fmt.Sprintf("%sinfo/%d", base, fdNo))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, "\t ")
+		if prev, ok := info[key]; ok {
+			value = prev + "\n" + value
+		}
+		info[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
 // Fd returns the fd number.
 func (fd filedesc) FdNo() int { return fd.fdNo }
 
+// Pos returns the file offset at discovery time. Pipes, sockets, and other fds
+// not supporting seeking always have a zero file offset. Own fds discovered on
+// the fast path [WithoutOwnFileOffsets] have a zero file offset, too.
+func (fd filedesc) Pos() int64 { return fd.pos }
+
 // Flags returns the file descriptor's flags, consisting of the access mode and
 // status flags as used by open(2).
 func (fd filedesc) Flags() Flags { return fd.flags }
 
-// MountId returns the ID of the mount this fd is on.
+// MountId returns the ID of the mount this fd is on, or 0 if unknown.
 func (fd filedesc) MountId() int { return fd.mntId }
 
+// PID returns the PID of the process this fd belongs to, or 0 if unknown.
+func (fd filedesc) PID() int { return fd.pid }
+
+// StartTime returns the start time in clock ticks after system boot of the
+// process this fd belongs to, or 0 if unknown. Together with the PID, the start
+// time identifies a particular process incarnation, as PIDs might get reused.
+func (fd filedesc) StartTime() uint64 { return fd.start }
+
+// anchor sets the start time of the process this fd belongs to.
+func (fd *filedesc) anchor(start uint64) { fd.start = start }
+
+// setLink sets the fd link destination this fd was discovered from, see also
+// [LinkPrehashOf].
+func (fd *filedesc) setLink(link string) { fd.link = link }
+
+// linkDest returns the fd link destination this fd was discovered from, or ""
+// if unknown.
+func (fd filedesc) linkDest() string { return fd.link }
+
+// RawFdinfo returns the complete fdinfo key-value pairs of this fd, as read at
+// discovery time, or nil if discovery didn't use [WithRawFdinfo].
+// Keys are without trailing colons, values have surrounding whitespace trimmed,
+// and the values of repeated keys are joined with newlines.
+func (fd filedesc) RawFdinfo() map[string]string { return fd.raw }
+
+// ParseWarnings returns the warnings about unknown or malformed fdinfo lines
+// collected while leniently parsing the fdinfo of this fd, or nil if there were
+// none; see also [WithStrictFdinfo].
+func (fd filedesc) ParseWarnings() []string { return fd.warnings }
+
 // Description returns a pretty formatted textual description of the common
 // elements for each fd (filedesc): the fd number and the (current) flags. For
 // better use, the flags are shown with their symbolic names, where possible.
@@ -238,7 +566,10 @@ func (fd filedesc) Description(indentation uint) string {
 
 // Equal returns true if other is a filedesc with the same fd number and mount
 // ID, but ignores the flags. This caters for before/after situations where the
-// fd flags might have changed in between.
+// fd flags might have changed in between. If either mount ID is unknown, Equal
+// leaves it to the other identity data of the specific kinds of fds, such as
+// paths and inode numbers.
 func (fd filedesc) Equal(other *filedesc) bool {
-	return fd.fdNo == other.fdNo && fd.mntId == other.mntId
+	return fd.fdNo == other.fdNo &&
+		(fd.mntId == other.mntId || fd.mntId == 0 || other.mntId == 0)
 }
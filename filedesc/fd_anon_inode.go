@@ -35,7 +35,15 @@ type AnonInodeFd struct {
 // NewAnonInodeFd returns a new FileDescriptor for an fd for an “anonymous
 // inode”.
 func NewAnonInodeFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
-	filedesc, err := newFiledesc(fdNo, base)
+	return newAnonInodeFd(fdNo, base, linkDest, nil)
+}
+
+// newAnonInodeFd implements [NewAnonInodeFd] using the specified discovery options.
+func newAnonInodeFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	if factory, ok := anonInodeFactories[strings.Trim(linkDest[len(anonInodePrefix):], "[]")]; ok {
+		return factory(fdNo, base, linkDest, o)
+	}
+	filedesc, err := newFiledesc(fdNo, base, o)
 	if err != nil {
 		return nil, err
 	}
@@ -45,6 +53,41 @@ func NewAnonInodeFd(fdNo int, base string, linkDest string) (FileDescriptor, err
 	}, nil
 }
 
+// anonInodeFactories maps the “file” types of anonymous inodes to the
+// factories of their dedicated FileDescriptor types.
+var anonInodeFactories = map[string]fdConstructor{
+	"eventfd":   newEventfdFd,
+	"eventpoll": newEpollFd,
+	"fanotify":  newFanotifyFd,
+	"inotify":   newInotifyFd,
+	"io_uring":  newIoUringFd,
+	"timerfd":   newTimerfdFd,
+}
+
+// AnonInodeOf returns the anonymous inode details of the specified fd and true,
+// if the fd is either a generic anonymous inode fd or one of the dedicated
+// anonymous inode fd types, such as an epoll fd. Otherwise, it returns nil and
+// false.
+func AnonInodeOf(fd FileDescriptor) (*AnonInodeFd, bool) {
+	switch fd := fd.(type) {
+	case *AnonInodeFd:
+		return fd, true
+	case *EpollFd:
+		return &fd.AnonInodeFd, true
+	case *EventfdFd:
+		return &fd.AnonInodeFd, true
+	case *TimerfdFd:
+		return &fd.AnonInodeFd, true
+	case *InotifyFd:
+		return &fd.AnonInodeFd, true
+	case *FanotifyFd:
+		return &fd.AnonInodeFd, true
+	case *IoUringFd:
+		return &fd.AnonInodeFd, true
+	}
+	return nil, false
+}
+
 // FileType returns the “file type” of this anonymous inode.
 func (a AnonInodeFd) FileType() string { return a.ftype }
 
@@ -38,7 +38,7 @@ var _ = Describe("anonymous inode fd", func() {
 		defer unix.Close(fd)
 
 		fdesc := Successful(New(fd))
-		anonfd := fdesc.(*AnonInodeFd)
+		anonfd := fdesc.(*EventfdFd)
 		Expect(anonfd.FileType()).To(Equal("eventfd"))
 		Expect(anonfd.Description(0)).To(MatchRegexp(
 			`fd \d+, flags 0x.* \(O_RDWR,O_CLOEXEC\)\n\s+anonymous inode file type: "eventfd"`))
@@ -56,4 +56,47 @@ var _ = Describe("anonymous inode fd", func() {
 		Expect(fdesc.Equal(fd0)).To(BeFalse())
 	})
 
+	It("counts inotify watches", func() {
+		fd := Successful(unix.InotifyInit1(unix.IN_CLOEXEC))
+		defer unix.Close(fd)
+		Successful(unix.InotifyAddWatch(fd, GinkgoT().TempDir(), unix.IN_CREATE))
+		Successful(unix.InotifyAddWatch(fd, GinkgoT().TempDir(), unix.IN_DELETE))
+
+		fdesc := Successful(New(fd))
+		anonfd, ok := AnonInodeOf(fdesc)
+		Expect(ok).To(BeTrue())
+		Expect(anonfd.FileType()).To(Equal("inotify"))
+		Expect(fdesc.(*InotifyFd).Watches()).To(HaveLen(2))
+		Expect(fdesc.Description(0)).To(MatchRegexp(`\n\s+watches: 2\n`))
+
+		evfd := Successful(unix.Eventfd(0, unix.EFD_CLOEXEC))
+		defer unix.Close(evfd)
+		evfdesc := Successful(New(evfd))
+		Expect(evfdesc.Description(0)).NotTo(ContainSubstring("watches"))
+	})
+
+	It("detects armed eventfds and timerfds", func() {
+		idlefd := Successful(unix.Eventfd(0, unix.EFD_CLOEXEC))
+		defer unix.Close(idlefd)
+		Expect(Successful(New(idlefd)).(*EventfdFd).Armed()).To(BeFalse())
+
+		evfd := Successful(unix.Eventfd(42, unix.EFD_CLOEXEC))
+		defer unix.Close(evfd)
+		fdesc := Successful(New(evfd))
+		Expect(fdesc.(*EventfdFd).Armed()).To(BeTrue())
+		Expect(fdesc.Description(0)).To(MatchRegexp(`\n\s+armed: will fire or wake up waiters\n`))
+
+		tfd := Successful(unix.TimerfdCreate(unix.CLOCK_MONOTONIC, unix.TFD_CLOEXEC))
+		defer unix.Close(tfd)
+		Expect(Successful(New(tfd)).(*TimerfdFd).Armed()).To(BeFalse())
+		Expect(unix.TimerfdSettime(tfd, 0, &unix.ItimerSpec{
+			Value: unix.Timespec{Sec: 3600},
+		}, nil)).To(Succeed())
+		Expect(Successful(New(tfd)).(*TimerfdFd).Armed()).To(BeTrue())
+	})
+
+	It("returns the inotify watches limit", func() {
+		Expect(InotifyMaxUserWatches()).To(BeNumerically(">", 0))
+	})
+
 })
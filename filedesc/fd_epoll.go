@@ -0,0 +1,125 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EpollFd implements FileDescriptor for an fd referencing an epoll instance,
+// that is, an anonymous inode of “file” type “eventpoll”. In addition to the
+// generic anonymous inode information, it details the target fds registered
+// with the epoll instance, together with their event masks. This allows telling
+// the Go runtime's netpoller apart from epoll instances of applications.
+type EpollFd struct {
+	AnonInodeFd
+	targets []EpollTarget // target fds registered with this epoll instance.
+}
+
+// EpollTarget is a target fd (“tfd”) registered with an epoll instance.
+//
+// Please note that the target fd number is the fd number at the time of
+// registration with the epoll instance: the target fd might have been
+// dup(2)'ed and closed since then, or might even belong to a different process
+// when the epoll fd was passed on.
+type EpollTarget struct {
+	FdNo   int         // target fd number at the time of registration.
+	Events EpollEvents // event mask of the target fd.
+}
+
+// NewEpollFd returns a new FileDescriptor for an fd referencing an epoll
+// instance.
+func NewEpollFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newEpollFd(fdNo, base, linkDest, nil)
+}
+
+// newEpollFd implements [NewEpollFd] using the specified discovery options.
+func newEpollFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	filedesc, err := newFiledesc(fdNo, base, o)
+	if err != nil {
+		return nil, err
+	}
+	e := &EpollFd{
+		AnonInodeFd: AnonInodeFd{
+			filedesc: filedesc,
+			ftype:    strings.Trim(linkDest[len(anonInodePrefix):], "[]"),
+		},
+	}
+	if info, err := readFdinfo(fdNo, base); err == nil {
+		e.targets = epollTargetsFromFdinfo(info)
+	}
+	return e, nil
+}
+
+// Targets returns the target fds registered with this epoll instance, in the
+// order as shown in the fdinfo.
+func (e EpollFd) Targets() []EpollTarget { return e.targets }
+
+// epollTargetsFromFdinfo returns the epoll targets from the “tfd” lines of the
+// specified fdinfo, skipping malformed lines. A tfd line has the format
+// “tfd: N events: HEX data: HEX pos: N ino: HEX sdev: HEX”.
+func epollTargetsFromFdinfo(info map[string]string) []EpollTarget {
+	tfds, ok := info["tfd"]
+	if !ok {
+		return nil
+	}
+	var targets []EpollTarget
+	for _, tfd := range strings.Split(tfds, "\n") {
+		fields := strings.Fields(tfd)
+		if len(fields) < 3 || fields[1] != "events:" {
+			continue
+		}
+		fdNo, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		events, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			continue
+		}
+		targets = append(targets, EpollTarget{FdNo: fdNo, Events: EpollEvents(events)})
+	}
+	return targets
+}
+
+// Description returns a pretty formatted multi-line textual description
+// detailing the fd number, flags, and “file type” of anonymous node, as well as
+// the target fds registered with this epoll instance and their event masks.
+func (e EpollFd) Description(indentation uint) string {
+	indent := Indentation(indentation + 1) // further details are always indented further
+	desc := e.AnonInodeFd.Description(indentation) +
+		fmt.Sprintf("\n%starget fds: %d", indent, len(e.targets))
+	indent = Indentation(indentation + 2)
+	for _, target := range e.targets {
+		desc += fmt.Sprintf("\n%swatching fd %d (%s)", indent, target.FdNo, target.Events)
+	}
+	return desc
+}
+
+// Equal returns true, if other is also an epoll fd with the same fd number (and
+// mount ID). The registered target fds are not taken into consideration, as
+// they might change over the lifetime of an epoll instance.
+func (e EpollFd) Equal(other FileDescriptor) bool {
+	o, ok := other.(*EpollFd)
+	if !ok {
+		return false
+	}
+	return e.AnonInodeFd.filedesc.Equal(&o.AnonInodeFd.filedesc) &&
+		e.ftype == o.ftype
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("epoll fd", func() {
+
+	const fakeBase = "/proc/fake/fd"
+
+	It("correctly fails for invalid fd number", func() {
+		Expect(NewEpollFd(-1, fakeBase, "anon_inode:[eventpoll]")).Error().
+			To(HaveOccurred())
+	})
+
+	It("lists the registered target fds", func() {
+		epfd := Successful(unix.EpollCreate1(unix.EPOLL_CLOEXEC))
+		defer unix.Close(epfd)
+		evfd := Successful(unix.Eventfd(0, unix.EFD_CLOEXEC))
+		defer unix.Close(evfd)
+		Expect(unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, evfd,
+			&unix.EpollEvent{Events: unix.EPOLLIN | unix.EPOLLET})).To(Succeed())
+
+		fdesc := Successful(New(epfd))
+		Expect(fdesc).To(BeAssignableToTypeOf(&EpollFd{}))
+		epoll := fdesc.(*EpollFd)
+		Expect(epoll.FileType()).To(Equal("eventpoll"))
+		Expect(epoll.Targets()).To(ConsistOf(And(
+			HaveField("FdNo", evfd),
+			HaveField("Events", WithTransform(func(e EpollEvents) EpollEvents {
+				return e & (unix.EPOLLIN | unix.EPOLLET)
+			}, Equal(EpollEvents(unix.EPOLLIN|unix.EPOLLET)))))))
+		Expect(epoll.Description(0)).To(MatchRegexp(
+			`anonymous inode file type: "eventpoll"\n\s+target fds: 1\n\s+watching fd %d \(EPOLLIN\|.*EPOLLET\)$`, evfd))
+
+		anonfd, ok := AnonInodeOf(epoll)
+		Expect(ok).To(BeTrue())
+		Expect(anonfd.FileType()).To(Equal("eventpoll"))
+	})
+
+	It("parses tfd lines", func() {
+		Expect(epollTargetsFromFdinfo(map[string]string{})).To(BeEmpty())
+		Expect(epollTargetsFromFdinfo(map[string]string{
+			"tfd": "        5 events:       19 data:                5  pos:0 ino:3a1 sdev:f\n" +
+				"foo events: 1\n" +
+				"7 events: xyz\n" +
+				"       42 events:        1 data:                0  pos:0 ino:3a2 sdev:f",
+		})).To(Equal([]EpollTarget{
+			{FdNo: 5, Events: unix.EPOLLIN | unix.EPOLLERR | unix.EPOLLHUP},
+			{FdNo: 42, Events: unix.EPOLLIN},
+		}))
+	})
+
+	It("determines equality correctly", func() {
+		epfd := Successful(unix.EpollCreate1(unix.EPOLL_CLOEXEC))
+		defer unix.Close(epfd)
+
+		fdesc := Successful(New(epfd))
+		Expect(fdesc.Equal(nil)).To(BeFalse())
+		Expect(fdesc.Equal(fdesc)).To(BeTrue())
+		Expect(fdesc.Equal(&fdesc.(*EpollFd).AnonInodeFd)).To(BeFalse())
+		Expect(fdesc.Equal(Successful(New(0)))).To(BeFalse())
+	})
+
+})
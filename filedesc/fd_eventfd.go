@@ -0,0 +1,110 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EventfdFd implements FileDescriptor for an fd referencing an eventfd, that
+// is, an anonymous inode of “file” type “eventfd”, as created by eventfd(2). In
+// addition to the generic anonymous inode information, it details the counter
+// value at discovery time, as well as the eventfd's ID.
+type EventfdFd struct {
+	AnonInodeFd
+	count uint64 // counter value at discovery time.
+	id    int    // eventfd ID, or -1 if unknown.
+}
+
+// NewEventfdFd returns a new FileDescriptor for an fd referencing an eventfd.
+func NewEventfdFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newEventfdFd(fdNo, base, linkDest, nil)
+}
+
+// newEventfdFd implements [NewEventfdFd] using the specified discovery options.
+func newEventfdFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	filedesc, err := newFiledesc(fdNo, base, o)
+	if err != nil {
+		return nil, err
+	}
+	e := &EventfdFd{
+		AnonInodeFd: AnonInodeFd{
+			filedesc: filedesc,
+			ftype:    strings.Trim(linkDest[len(anonInodePrefix):], "[]"),
+		},
+		id: -1,
+	}
+	if info, err := readFdinfo(fdNo, base); err == nil {
+		e.count, e.id = eventfdFromFdinfo(info)
+	}
+	return e, nil
+}
+
+// Count returns the counter value of this eventfd at discovery time. A
+// non-zero counter will wake up a reader.
+func (e EventfdFd) Count() uint64 { return e.count }
+
+// Armed returns true if the counter of this eventfd was non-zero at discovery
+// time. Such an eventfd will wake up a reader, so its leak is more severe than
+// that of an idle eventfd.
+func (e EventfdFd) Armed() bool { return e.count != 0 }
+
+// ID returns the ID of this eventfd, or -1 if the kernel doesn't show eventfd
+// IDs (before Linux 5.2). The ID is unique across eventfds and thus allows
+// correlating eventfd fds across processes.
+func (e EventfdFd) ID() int { return e.id }
+
+// eventfdFromFdinfo returns the counter value (in hex) and ID from the
+// specified eventfd fdinfo. The ID is -1 if missing or malformed.
+func eventfdFromFdinfo(info map[string]string) (count uint64, id int) {
+	count, _ = strconv.ParseUint(info["eventfd-count"], 16, 64)
+	id, err := strconv.Atoi(info["eventfd-id"])
+	if err != nil {
+		id = -1
+	}
+	return count, id
+}
+
+// Description returns a pretty formatted multi-line textual description
+// detailing the fd number, flags, and “file type” of anonymous node, as well as
+// the eventfd's counter value and ID, if known. Armed eventfds are called out.
+func (e EventfdFd) Description(indentation uint) string {
+	indent := Indentation(indentation + 1) // further details are always indented further
+	desc := e.AnonInodeFd.Description(indentation)
+	if e.Armed() {
+		desc += fmt.Sprintf("\n%sarmed: will fire or wake up waiters", indent)
+	}
+	desc += fmt.Sprintf("\n%scount: %d", indent, e.count)
+	if e.id >= 0 {
+		desc += fmt.Sprintf("\n%seventfd ID: %d", indent, e.id)
+	}
+	return desc
+}
+
+// Equal returns true, if other is also an eventfd with the same fd number (and
+// mount ID). The counter values are not taken into consideration, as they
+// change over the lifetime of an eventfd.
+func (e EventfdFd) Equal(other FileDescriptor) bool {
+	o, ok := other.(*EventfdFd)
+	if !ok {
+		return false
+	}
+	return e.AnonInodeFd.filedesc.Equal(&o.AnonInodeFd.filedesc) &&
+		e.ftype == o.ftype
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("eventfd fd", func() {
+
+	const fakeBase = "/proc/fake/fd"
+
+	It("correctly fails for invalid fd number", func() {
+		Expect(NewEventfdFd(-1, fakeBase, "anon_inode:[eventfd]")).Error().
+			To(HaveOccurred())
+	})
+
+	It("returns the counter value and ID", func() {
+		evfd := Successful(unix.Eventfd(42, unix.EFD_CLOEXEC))
+		defer unix.Close(evfd)
+
+		fdesc := Successful(New(evfd))
+		Expect(fdesc).To(BeAssignableToTypeOf(&EventfdFd{}))
+		eventfd := fdesc.(*EventfdFd)
+		Expect(eventfd.FileType()).To(Equal("eventfd"))
+		Expect(eventfd.Count()).To(Equal(uint64(42)))
+		Expect(eventfd.ID()).To(BeNumerically(">=", 0))
+		Expect(eventfd.Description(0)).To(MatchRegexp(`\n\s+count: 42\n\s+eventfd ID: \d+$`))
+
+		Expect(unix.Write(evfd, []byte{1, 0, 0, 0, 0, 0, 0, 0})).To(Equal(8))
+		Expect(Successful(New(evfd)).(*EventfdFd).Count()).To(Equal(uint64(43)))
+	})
+
+	It("parses the counter value and ID", func() {
+		count, id := eventfdFromFdinfo(map[string]string{})
+		Expect(count).To(BeZero())
+		Expect(id).To(Equal(-1))
+		count, id = eventfdFromFdinfo(map[string]string{
+			"eventfd-count": "2a",
+			"eventfd-id":    "666",
+		})
+		Expect(count).To(Equal(uint64(42)))
+		Expect(id).To(Equal(666))
+		_, id = eventfdFromFdinfo(map[string]string{"eventfd-count": "0"})
+		Expect(id).To(Equal(-1))
+	})
+
+	It("determines equality correctly", func() {
+		evfd := Successful(unix.Eventfd(0, unix.EFD_CLOEXEC))
+		defer unix.Close(evfd)
+
+		fdesc := Successful(New(evfd))
+		Expect(fdesc.Equal(nil)).To(BeFalse())
+		Expect(fdesc.Equal(fdesc)).To(BeTrue())
+		Expect(fdesc.Equal(&fdesc.(*EventfdFd).AnonInodeFd)).To(BeFalse())
+		Expect(fdesc.Equal(Successful(New(0)))).To(BeFalse())
+
+		Expect(unix.Write(evfd, []byte{1, 0, 0, 0, 0, 0, 0, 0})).To(Equal(8))
+		Expect(fdesc.Equal(Successful(New(evfd)))).To(BeTrue())
+	})
+
+})
@@ -0,0 +1,385 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// FanotifyFd implements FileDescriptor for an fd referencing a fanotify
+// group, that is, an anonymous inode of “file” type “fanotify”, as created
+// by fanotify_init(2). In addition to the generic anonymous inode information,
+// it details the initialization flags of the fanotify group as well as its
+// individual inode, mount, and filesystem marks.
+type FanotifyFd struct {
+	AnonInodeFd
+	initFlags  FanotifyInitFlags // flags passed to fanotify_init(2).
+	eventFlags Flags             // open flags of the fds of events.
+	markList   []FanotifyMark    // individual marks.
+}
+
+// FanotifyMarkType specifies the type of object a fanotify mark is placed on.
+type FanotifyMarkType int
+
+const (
+	FanotifyInodeMark      FanotifyMarkType = iota // mark on a file or directory.
+	FanotifyMountMark                              // mark on a mount.
+	FanotifyFilesystemMark                         // mark on a filesystem.
+)
+
+// String returns the textual representation of the mark type.
+func (t FanotifyMarkType) String() string {
+	switch t {
+	case FanotifyInodeMark:
+		return "inode"
+	case FanotifyMountMark:
+		return "mount"
+	case FanotifyFilesystemMark:
+		return "filesystem"
+	}
+	return fmt.Sprintf("FanotifyMarkType(%d)", int(t))
+}
+
+// FanotifyMark is an individual mark of a fanotify group.
+type FanotifyMark struct {
+	Type        FanotifyMarkType // type of the marked object.
+	Dev         uint64           // device of the marked file, directory, or filesystem; zero for mount marks.
+	Ino         uint64           // inode number of the marked file or directory; zero for other marks.
+	MountID     int              // ID of the marked mount; zero for other marks.
+	Flags       uint32           // FAN_MARK_* flags of the mark, such as FAN_MARK_EVICTABLE.
+	Mask        FanotifyMask     // event mask of the mark.
+	IgnoredMask FanotifyMask     // ignored event mask of the mark.
+	Path        string           // path of the marked file, directory, or mount, if resolvable; otherwise, "".
+}
+
+// NewFanotifyFd returns a new FileDescriptor for an fd referencing a fanotify
+// group.
+//
+// Resolving the paths of marked files and directories needs the
+// CAP_DAC_READ_SEARCH capability, as the paths are resolved from the file
+// handles of the marks using open_by_handle_at(2). Without this capability,
+// the marked paths are left empty. The paths of marked mounts are always
+// resolved, as long as the mounts are still mounted.
+func NewFanotifyFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newFanotifyFd(fdNo, base, linkDest, nil)
+}
+
+// newFanotifyFd implements [NewFanotifyFd] using the specified discovery options.
+func newFanotifyFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	filedesc, err := newFiledesc(fdNo, base, o)
+	if err != nil {
+		return nil, err
+	}
+	f := &FanotifyFd{
+		AnonInodeFd: AnonInodeFd{
+			filedesc: filedesc,
+			ftype:    strings.Trim(linkDest[len(anonInodePrefix):], "[]"),
+		},
+	}
+	info, err := readFdinfo(fdNo, base)
+	if err != nil {
+		return f, nil
+	}
+	f.initFlags, f.eventFlags = fanotifyFlagsFromFdinfo(info)
+	var handles []*unix.FileHandle
+	f.markList, handles = fanotifyMarksFromFdinfo(info)
+	if len(f.markList) == 0 {
+		return f, nil
+	}
+	mounts, err := ProcessMounts(filedesc.pid)
+	if err != nil {
+		return f, nil
+	}
+	for idx := range f.markList {
+		mark := &f.markList[idx]
+		switch mark.Type {
+		case FanotifyInodeMark:
+			if handles[idx] != nil {
+				mark.Path = resolveFileHandle(base, mounts, mark.Dev, *handles[idx])
+			}
+		case FanotifyMountMark:
+			for _, mount := range mounts {
+				if mount.ID == mark.MountID {
+					mark.Path = mount.MountPoint
+					break
+				}
+			}
+		}
+	}
+	return f, nil
+}
+
+// InitFlags returns the flags the fanotify group was initialized with, such as
+// its notification class.
+func (f FanotifyFd) InitFlags() FanotifyInitFlags { return f.initFlags }
+
+// EventFlags returns the open flags of the fds passed with fanotify events.
+func (f FanotifyFd) EventFlags() Flags { return f.eventFlags }
+
+// Marks returns the individual marks of this fanotify group.
+func (f FanotifyFd) Marks() []FanotifyMark { return f.markList }
+
+// fanotifyFlagsFromFdinfo returns the initialization flags and event flags
+// from the “fanotify flags:HEX event-flags:HEX” line of the specified fdinfo.
+func fanotifyFlagsFromFdinfo(info map[string]string) (FanotifyInitFlags, Flags) {
+	flags, rest, _ := strings.Cut(info["fanotify flags"], " ")
+	initFlags, _ := strconv.ParseUint(flags, 16, 32)
+	var eventFlags uint64
+	if value, ok := strings.CutPrefix(rest, "event-flags:"); ok {
+		eventFlags, _ = strconv.ParseUint(value, 16, 32)
+	}
+	return FanotifyInitFlags(initFlags), Flags(eventFlags)
+}
+
+// fanotifyMarksFromFdinfo returns the marks and the file handles of inode
+// marks (nil if unknown or not an inode mark) from the “fanotify ino”,
+// “fanotify mnt_id”, and “fanotify sdev” lines of the specified fdinfo,
+// skipping malformed lines. These lines have the formats:
+//   - “fanotify ino:HEX sdev:HEX mflags:HEX mask:HEX ignored_mask:HEX
+//     fhandle-bytes:HEX fhandle-type:HEX f_handle:HEX” for inode marks,
+//   - “fanotify mnt_id:HEX mflags:HEX mask:HEX ignored_mask:HEX” for mount
+//     marks,
+//   - “fanotify sdev:HEX mflags:HEX mask:HEX ignored_mask:HEX” for filesystem
+//     marks.
+func fanotifyMarksFromFdinfo(info map[string]string) ([]FanotifyMark, []*unix.FileHandle) {
+	var marks []FanotifyMark
+	var handles []*unix.FileHandle
+	for _, typ := range []struct {
+		key  string
+		mark FanotifyMarkType
+	}{
+		{"fanotify ino", FanotifyInodeMark},
+		{"fanotify mnt_id", FanotifyMountMark},
+		{"fanotify sdev", FanotifyFilesystemMark},
+	} {
+		lines, ok := info[typ.key]
+		if !ok {
+			continue
+		}
+		firstKey := strings.TrimPrefix(typ.key, "fanotify ")
+		for _, line := range strings.Split(lines, "\n") {
+			fields := map[string]string{}
+			for idx, field := range strings.Fields(line) {
+				if idx == 0 {
+					fields[firstKey] = field
+					continue
+				}
+				if key, value, ok := strings.Cut(field, ":"); ok {
+					fields[key] = value
+				}
+			}
+			mflags, err1 := strconv.ParseUint(fields["mflags"], 16, 32)
+			mask, err2 := strconv.ParseUint(fields["mask"], 16, 64)
+			ignored, err3 := strconv.ParseUint(fields["ignored_mask"], 16, 64)
+			if err1 != nil || err2 != nil || err3 != nil {
+				continue
+			}
+			mark := FanotifyMark{
+				Type:        typ.mark,
+				Flags:       uint32(mflags),
+				Mask:        FanotifyMask(mask),
+				IgnoredMask: FanotifyMask(ignored),
+			}
+			var handle *unix.FileHandle
+			switch typ.mark {
+			case FanotifyInodeMark:
+				ino, err1 := strconv.ParseUint(fields["ino"], 16, 64)
+				sdev, err2 := strconv.ParseUint(fields["sdev"], 16, 32)
+				if err1 != nil || err2 != nil {
+					continue
+				}
+				mark.Ino, mark.Dev = ino, kernelDev(uint32(sdev))
+				htype, err1 := strconv.ParseInt(fields["fhandle-type"], 16, 32)
+				hbytes, err2 := hex.DecodeString(fields["f_handle"])
+				if err1 == nil && err2 == nil && len(hbytes) > 0 {
+					h := unix.NewFileHandle(int32(htype), hbytes)
+					handle = &h
+				}
+			case FanotifyMountMark:
+				mntID, err := strconv.ParseInt(fields["mnt_id"], 16, 32)
+				if err != nil {
+					continue
+				}
+				mark.MountID = int(mntID)
+			case FanotifyFilesystemMark:
+				sdev, err := strconv.ParseUint(fields["sdev"], 16, 32)
+				if err != nil {
+					continue
+				}
+				mark.Dev = kernelDev(uint32(sdev))
+			}
+			marks = append(marks, mark)
+			handles = append(handles, handle)
+		}
+	}
+	return marks, handles
+}
+
+// Description returns a pretty formatted multi-line textual description
+// detailing the fd number, flags, and “file type” of anonymous node, the
+// number of marks, the initialization and event flags, as well as the
+// individual marks with their paths, if known, and event masks.
+func (f FanotifyFd) Description(indentation uint) string {
+	indent := Indentation(indentation + 1)
+	desc := f.AnonInodeFd.Description(indentation) +
+		fmt.Sprintf("\n%smarks: %d", indent, len(f.markList)) +
+		fmt.Sprintf("\n%sinit flags: %s", indent, f.initFlags) +
+		fmt.Sprintf("\n%sevent flags: %s", indent, strings.Join(f.eventFlags.Names(), ","))
+	indent = Indentation(indentation + 2)
+	for _, mark := range f.markList {
+		var what string
+		switch mark.Type {
+		case FanotifyInodeMark:
+			what = fmt.Sprintf("inode %d on device %d:%d",
+				mark.Ino, unix.Major(mark.Dev), unix.Minor(mark.Dev))
+		case FanotifyMountMark:
+			what = fmt.Sprintf("mount ID %d", mark.MountID)
+		case FanotifyFilesystemMark:
+			what = fmt.Sprintf("device %d:%d", unix.Major(mark.Dev), unix.Minor(mark.Dev))
+		}
+		if mark.Path != "" {
+			what = strconv.Quote(mark.Path)
+		}
+		desc += fmt.Sprintf("\n%s%s mark: %s (%s)", indent, mark.Type, what, mark.Mask)
+		if mark.IgnoredMask != 0 {
+			desc += fmt.Sprintf(", ignoring (%s)", mark.IgnoredMask)
+		}
+	}
+	return desc
+}
+
+// Equal returns true, if other is also a fanotify fd with the same fd number
+// (and mount ID). The marks are not taken into consideration, as they might
+// change over the lifetime of a fanotify group.
+func (f FanotifyFd) Equal(other FileDescriptor) bool {
+	o, ok := other.(*FanotifyFd)
+	if !ok {
+		return false
+	}
+	return f.AnonInodeFd.filedesc.Equal(&o.AnonInodeFd.filedesc) &&
+		f.ftype == o.ftype
+}
+
+// FanotifyInitFlags specifies the flags of a fanotify group, as passed to
+// fanotify_init(2). It additionally implements Stringer returning the
+// notification class and the known set flags with their symbolic constant
+// names.
+type FanotifyInitFlags uint32
+
+// String returns the symbolic name of the notification class, followed by the
+// symbolic names of the set flags, joined by “|”. Any unknown remaining bits
+// are shown as a single hex number.
+func (f FanotifyInitFlags) String() string {
+	var class string
+	switch uint32(f) & unix.FAN_ALL_CLASS_BITS {
+	case unix.FAN_CLASS_NOTIF:
+		class = "FAN_CLASS_NOTIF"
+	case unix.FAN_CLASS_CONTENT:
+		class = "FAN_CLASS_CONTENT"
+	case unix.FAN_CLASS_PRE_CONTENT:
+		class = "FAN_CLASS_PRE_CONTENT"
+	default:
+		class = fmt.Sprintf("class 0x%x", uint32(f)&unix.FAN_ALL_CLASS_BITS)
+	}
+	n := []string{class}
+	remaining := uint32(f) &^ unix.FAN_ALL_CLASS_BITS
+	for _, flag := range fanotifyInitFlagNames {
+		if remaining&flag.bit != 0 {
+			n = append(n, flag.name)
+			remaining &^= flag.bit
+		}
+	}
+	if remaining != 0 {
+		n = append(n, fmt.Sprintf("0x%x", remaining))
+	}
+	return strings.Join(n, "|")
+}
+
+// FanotifyMask specifies the event mask of a fanotify mark. It additionally
+// implements Stringer returning the known set bits with their symbolic
+// constant names.
+type FanotifyMask uint64
+
+// String returns the symbolic names of the set bits, joined by “|”. Any
+// unknown remaining bits are shown as a single hex number.
+func (m FanotifyMask) String() string {
+	n := make([]string, 0)
+	remaining := uint64(m)
+	for _, event := range fanotifyMaskNames {
+		if remaining&event.bit != 0 {
+			n = append(n, event.name)
+			remaining &^= event.bit
+		}
+	}
+	if remaining != 0 {
+		n = append(n, fmt.Sprintf("0x%x", remaining))
+	}
+	return strings.Join(n, "|")
+}
+
+// fanotifyInitFlagNames lists the fanotify_init(2) flags (except for the
+// notification class) with their textual names, in order of their bit values.
+var fanotifyInitFlagNames = []struct {
+	bit  uint32
+	name string
+}{
+	{unix.FAN_CLOEXEC, "FAN_CLOEXEC"},
+	{unix.FAN_NONBLOCK, "FAN_NONBLOCK"},
+	{unix.FAN_UNLIMITED_QUEUE, "FAN_UNLIMITED_QUEUE"},
+	{unix.FAN_UNLIMITED_MARKS, "FAN_UNLIMITED_MARKS"},
+	{unix.FAN_ENABLE_AUDIT, "FAN_ENABLE_AUDIT"},
+	{unix.FAN_REPORT_PIDFD, "FAN_REPORT_PIDFD"},
+	{unix.FAN_REPORT_TID, "FAN_REPORT_TID"},
+	{unix.FAN_REPORT_FID, "FAN_REPORT_FID"},
+	{unix.FAN_REPORT_DIR_FID, "FAN_REPORT_DIR_FID"},
+	{unix.FAN_REPORT_NAME, "FAN_REPORT_NAME"},
+	{unix.FAN_REPORT_TARGET_FID, "FAN_REPORT_TARGET_FID"},
+}
+
+// fanotifyMaskNames lists the fanotify event bits with their textual names, in
+// order of their bit values.
+var fanotifyMaskNames = []struct {
+	bit  uint64
+	name string
+}{
+	{unix.FAN_ACCESS, "FAN_ACCESS"},
+	{unix.FAN_MODIFY, "FAN_MODIFY"},
+	{unix.FAN_ATTRIB, "FAN_ATTRIB"},
+	{unix.FAN_CLOSE_WRITE, "FAN_CLOSE_WRITE"},
+	{unix.FAN_CLOSE_NOWRITE, "FAN_CLOSE_NOWRITE"},
+	{unix.FAN_OPEN, "FAN_OPEN"},
+	{unix.FAN_MOVED_FROM, "FAN_MOVED_FROM"},
+	{unix.FAN_MOVED_TO, "FAN_MOVED_TO"},
+	{unix.FAN_CREATE, "FAN_CREATE"},
+	{unix.FAN_DELETE, "FAN_DELETE"},
+	{unix.FAN_DELETE_SELF, "FAN_DELETE_SELF"},
+	{unix.FAN_MOVE_SELF, "FAN_MOVE_SELF"},
+	{unix.FAN_OPEN_EXEC, "FAN_OPEN_EXEC"},
+	{unix.FAN_Q_OVERFLOW, "FAN_Q_OVERFLOW"},
+	{unix.FAN_FS_ERROR, "FAN_FS_ERROR"},
+	{unix.FAN_OPEN_PERM, "FAN_OPEN_PERM"},
+	{unix.FAN_ACCESS_PERM, "FAN_ACCESS_PERM"},
+	{unix.FAN_OPEN_EXEC_PERM, "FAN_OPEN_EXEC_PERM"},
+	{unix.FAN_EVENT_ON_CHILD, "FAN_EVENT_ON_CHILD"},
+	{unix.FAN_RENAME, "FAN_RENAME"},
+	{unix.FAN_ONDIR, "FAN_ONDIR"},
+}
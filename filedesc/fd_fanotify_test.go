@@ -0,0 +1,143 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("fanotify fd", func() {
+
+	const fakeBase = "/proc/fake/fd"
+
+	fanotifyInit := func() int {
+		GinkgoHelper()
+		fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC,
+			uint(os.O_RDONLY|unix.O_LARGEFILE))
+		if errors.Is(err, unix.EPERM) {
+			Skip("needs CAP_SYS_ADMIN")
+		}
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(unix.Close, fd)
+		return fd
+	}
+
+	It("correctly fails for invalid fd number", func() {
+		Expect(NewFanotifyFd(-1, fakeBase, "anon_inode:[fanotify]")).Error().
+			To(HaveOccurred())
+	})
+
+	It("lists the flags and marks", func() {
+		fd := fanotifyInit()
+		dir := GinkgoT().TempDir()
+		Expect(unix.FanotifyMark(fd, unix.FAN_MARK_ADD,
+			unix.FAN_OPEN|unix.FAN_CLOSE_WRITE, unix.AT_FDCWD, dir)).To(Succeed())
+		Expect(unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_MOUNT,
+			unix.FAN_OPEN, unix.AT_FDCWD, "/")).To(Succeed())
+		var st unix.Stat_t
+		Expect(unix.Stat(dir, &st)).To(Succeed())
+
+		fdesc := Successful(New(fd))
+		Expect(fdesc).To(BeAssignableToTypeOf(&FanotifyFd{}))
+		fanotify := fdesc.(*FanotifyFd)
+		Expect(fanotify.FileType()).To(Equal("fanotify"))
+		Expect(fanotify.InitFlags() & unix.FAN_ALL_CLASS_BITS).To(BeEquivalentTo(unix.FAN_CLASS_NOTIF))
+		Expect(fanotify.EventFlags() & unix.O_ACCMODE).To(BeEquivalentTo(os.O_RDONLY))
+		Expect(fanotify.Marks()).To(ConsistOf(
+			And(
+				HaveField("Type", FanotifyInodeMark),
+				HaveField("Dev", st.Dev),
+				HaveField("Ino", st.Ino),
+				HaveField("Mask", FanotifyMask(unix.FAN_OPEN|unix.FAN_CLOSE_WRITE))),
+			And(
+				HaveField("Type", FanotifyMountMark),
+				HaveField("MountID", Not(BeZero())),
+				HaveField("Path", "/"),
+				HaveField("Mask", FanotifyMask(unix.FAN_OPEN))),
+		))
+		desc := fanotify.Description(0)
+		Expect(desc).To(MatchRegexp(`\n\s+marks: 2\n`))
+		Expect(desc).To(MatchRegexp(`\n\s+init flags: FAN_CLASS_NOTIF\|FAN_CLOEXEC`))
+		Expect(desc).To(MatchRegexp(`\n\s+event flags: O_RDONLY`))
+		Expect(desc).To(MatchRegexp(`\n\s+mount mark: "/" \(FAN_OPEN\)`))
+		Expect(desc).To(MatchRegexp(`\n\s+inode mark: .* \(FAN_CLOSE_WRITE\|FAN_OPEN\)`))
+	})
+
+	It("parses fanotify lines", func() {
+		flags, eventFlags := fanotifyFlagsFromFdinfo(map[string]string{})
+		Expect(flags).To(BeZero())
+		Expect(eventFlags).To(BeZero())
+		flags, eventFlags = fanotifyFlagsFromFdinfo(map[string]string{
+			"fanotify flags": "211 event-flags:8002",
+		})
+		Expect(flags).To(Equal(FanotifyInitFlags(unix.FAN_CLOEXEC | unix.FAN_UNLIMITED_QUEUE | unix.FAN_REPORT_FID)))
+		Expect(eventFlags).To(Equal(Flags(0x8002))) // O_RDWR|O_LARGEFILE
+
+		marks, handles := fanotifyMarksFromFdinfo(map[string]string{
+			"fanotify ino": "11001b sdev:fe00001 mflags:0 mask:20 ignored_mask:0 fhandle-bytes:8 fhandle-type:1 f_handle:1b001100acb2389d\n" +
+				"x sdev:0 mflags:0 mask:0 ignored_mask:0",
+			"fanotify mnt_id": "2a mflags:0 mask:1 ignored_mask:0",
+			"fanotify sdev":   "800001 mflags:200 mask:8 ignored_mask:2",
+		})
+		Expect(marks).To(Equal([]FanotifyMark{
+			{Type: FanotifyInodeMark, Dev: unix.Mkdev(254, 1), Ino: 0x11001b, Mask: unix.FAN_OPEN},
+			{Type: FanotifyMountMark, MountID: 42, Mask: unix.FAN_ACCESS},
+			{Type: FanotifyFilesystemMark, Dev: unix.Mkdev(8, 1), Flags: unix.FAN_MARK_EVICTABLE,
+				Mask: unix.FAN_CLOSE_WRITE, IgnoredMask: unix.FAN_MODIFY},
+		}))
+		Expect(handles).To(HaveLen(3))
+		Expect(handles[0].Bytes()).To(HaveLen(8))
+		Expect(handles[1]).To(BeNil())
+		Expect(handles[2]).To(BeNil())
+
+		f := FanotifyFd{AnonInodeFd: AnonInodeFd{ftype: "fanotify"}, markList: marks}
+		Expect(f.Description(0)).To(MatchRegexp(
+			`\n\s+inode mark: inode 1114139 on device 254:1 \(FAN_OPEN\)` +
+				`\n\s+mount mark: mount ID 42 \(FAN_ACCESS\)` +
+				`\n\s+filesystem mark: device 8:1 \(FAN_CLOSE_WRITE\), ignoring \(FAN_MODIFY\)$`))
+	})
+
+	It("names flags and mask bits", func() {
+		Expect(FanotifyInitFlags(0).String()).To(Equal("FAN_CLASS_NOTIF"))
+		Expect(FanotifyInitFlags(unix.FAN_CLASS_PRE_CONTENT | unix.FAN_NONBLOCK | 0x80000000).String()).To(
+			Equal("FAN_CLASS_PRE_CONTENT|FAN_NONBLOCK|0x80000000"))
+		Expect(FanotifyInitFlags(0xc).String()).To(Equal("class 0xc"))
+		Expect(FanotifyMask(0).String()).To(BeEmpty())
+		Expect(FanotifyMask(unix.FAN_MODIFY | unix.FAN_ONDIR | 0x100000000).String()).To(
+			Equal("FAN_MODIFY|FAN_ONDIR|0x100000000"))
+		Expect(FanotifyMountMark.String()).To(Equal("mount"))
+		Expect(FanotifyMarkType(42).String()).To(Equal("FanotifyMarkType(42)"))
+	})
+
+	It("determines equality correctly", func() {
+		fd := fanotifyInit()
+
+		fdesc := Successful(New(fd))
+		Expect(fdesc.Equal(nil)).To(BeFalse())
+		Expect(fdesc.Equal(fdesc)).To(BeTrue())
+		Expect(fdesc.Equal(&fdesc.(*FanotifyFd).AnonInodeFd)).To(BeFalse())
+		Expect(fdesc.Equal(Successful(New(0)))).To(BeFalse())
+	})
+
+})
@@ -0,0 +1,260 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// InotifyFd implements FileDescriptor for an fd referencing an inotify
+// instance, that is, an anonymous inode of “file” type “inotify”, as created
+// by inotify_init1(2). In addition to the generic anonymous inode information,
+// it details the individual watches of the inotify instance.
+type InotifyFd struct {
+	AnonInodeFd
+	watches []InotifyWatch // individual watches.
+}
+
+// InotifyWatch is an individual watch of an inotify instance.
+type InotifyWatch struct {
+	WD   int    // watch descriptor, as returned by inotify_add_watch(2).
+	Dev  uint64 // device of the watched file or directory.
+	Ino  uint64 // inode number of the watched file or directory.
+	Mask uint32 // event mask of the watch.
+	Path string // path of the watched file or directory, if resolvable; otherwise, "".
+}
+
+// NewInotifyFd returns a new FileDescriptor for an fd referencing an inotify
+// instance.
+//
+// Resolving the paths of watched files and directories needs the
+// CAP_DAC_READ_SEARCH capability, as the paths are resolved from the file
+// handles of the watches using open_by_handle_at(2). Without this capability,
+// the watched paths are left empty.
+func NewInotifyFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newInotifyFd(fdNo, base, linkDest, nil)
+}
+
+// newInotifyFd implements [NewInotifyFd] using the specified discovery options.
+func newInotifyFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	filedesc, err := newFiledesc(fdNo, base, o)
+	if err != nil {
+		return nil, err
+	}
+	i := &InotifyFd{
+		AnonInodeFd: AnonInodeFd{
+			filedesc: filedesc,
+			ftype:    strings.Trim(linkDest[len(anonInodePrefix):], "[]"),
+		},
+	}
+	info, err := readFdinfo(fdNo, base)
+	if err != nil {
+		return i, nil
+	}
+	var handles []*unix.FileHandle
+	i.watches, handles = inotifyWatchesFromFdinfo(info)
+	var mounts []Mount
+	for idx := range i.watches {
+		if handles[idx] == nil {
+			continue
+		}
+		if mounts == nil {
+			if mounts, err = ProcessMounts(filedesc.pid); err != nil {
+				break
+			}
+		}
+		i.watches[idx].Path = resolveFileHandle(base, mounts, i.watches[idx].Dev, *handles[idx])
+	}
+	return i, nil
+}
+
+// Watches returns the individual watches of this inotify instance.
+func (i InotifyFd) Watches() []InotifyWatch { return i.watches }
+
+// inotifyWatchesFromFdinfo returns the watches and their file handles (nil if
+// unknown) from the “inotify wd” lines of the specified fdinfo, skipping
+// malformed lines. An inotify wd line has the format “inotify wd:N ino:HEX
+// sdev:HEX mask:HEX ignored_mask:HEX fhandle-bytes:HEX fhandle-type:HEX
+// f_handle:HEX”, where the file handle fields are missing in kernels without
+// CONFIG_EXPORTFS.
+func inotifyWatchesFromFdinfo(info map[string]string) ([]InotifyWatch, []*unix.FileHandle) {
+	wds, ok := info["inotify wd"]
+	if !ok {
+		return nil, nil
+	}
+	var watches []InotifyWatch
+	var handles []*unix.FileHandle
+	for _, wd := range strings.Split(wds, "\n") {
+		fields := map[string]string{}
+		for idx, field := range strings.Fields(wd) {
+			if idx == 0 {
+				fields["wd"] = field
+				continue
+			}
+			if key, value, ok := strings.Cut(field, ":"); ok {
+				fields[key] = value
+			}
+		}
+		wdNo, err1 := strconv.Atoi(fields["wd"])
+		ino, err2 := strconv.ParseUint(fields["ino"], 16, 64)
+		sdev, err3 := strconv.ParseUint(fields["sdev"], 16, 32)
+		mask, err4 := strconv.ParseUint(fields["mask"], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+		watches = append(watches, InotifyWatch{
+			WD:   wdNo,
+			Dev:  kernelDev(uint32(sdev)),
+			Ino:  ino,
+			Mask: uint32(mask),
+		})
+		var handle *unix.FileHandle
+		htype, err1 := strconv.ParseInt(fields["fhandle-type"], 16, 32)
+		hbytes, err2 := hex.DecodeString(fields["f_handle"])
+		if err1 == nil && err2 == nil && len(hbytes) > 0 {
+			h := unix.NewFileHandle(int32(htype), hbytes)
+			handle = &h
+		}
+		handles = append(handles, handle)
+	}
+	return watches, handles
+}
+
+// kernelDev returns the device number for the specified kernel-internal
+// device number, which uses a different encoding than user space.
+func kernelDev(sdev uint32) uint64 {
+	return unix.Mkdev(sdev>>20, sdev&0xfffff)
+}
+
+// resolveFileHandle returns the path of the file identified by the specified
+// file handle on the specified device, trying the mounts of this device as
+// seen by the process with the procfs fd directory at base. If the path cannot
+// be resolved, resolveFileHandle returns "".
+func resolveFileHandle(base string, mounts []Mount, dev uint64, handle unix.FileHandle) string {
+	procBase := strings.TrimSuffix(base, "/fd")
+	for _, mount := range mounts {
+		if mount.Dev != dev {
+			continue
+		}
+		mountFd, err := counted(unix.Open(procBase+"/root"+mount.MountPoint, unix.O_PATH|unix.O_CLOEXEC, 0))
+		if err != nil {
+			continue
+		}
+		fd, err := counted(unix.OpenByHandleAt(mountFd, handle, unix.O_PATH|unix.O_CLOEXEC))
+		closeFd(mountFd)
+		if err != nil {
+			if err == unix.EPERM {
+				return "" // lacking CAP_DAC_READ_SEARCH, so don't try other mounts.
+			}
+			continue
+		}
+		path, err := readlinkCounted(fmt.Sprintf("%s/%d", ownFdPath(), fd))
+		closeFd(fd)
+		if err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Description returns a pretty formatted multi-line textual description
+// detailing the fd number, flags, and “file type” of anonymous node, as well as
+// the number of watches and the individual watches with their paths, if known,
+// and event masks.
+func (i InotifyFd) Description(indentation uint) string {
+	desc := i.AnonInodeFd.Description(indentation) +
+		fmt.Sprintf("\n%swatches: %d", Indentation(indentation+1), len(i.watches))
+	indent := Indentation(indentation + 2)
+	for _, watch := range i.watches {
+		what := fmt.Sprintf("inode %d on device %d:%d",
+			watch.Ino, unix.Major(watch.Dev), unix.Minor(watch.Dev))
+		if watch.Path != "" {
+			what = strconv.Quote(watch.Path)
+		}
+		desc += fmt.Sprintf("\n%swd %d: %s (%s)", indent, watch.WD, what, InotifyMask(watch.Mask))
+	}
+	return desc
+}
+
+// Equal returns true, if other is also an inotify fd with the same fd number
+// (and mount ID). The watches are not taken into consideration, as they might
+// change over the lifetime of an inotify instance.
+func (i InotifyFd) Equal(other FileDescriptor) bool {
+	o, ok := other.(*InotifyFd)
+	if !ok {
+		return false
+	}
+	return i.AnonInodeFd.filedesc.Equal(&o.AnonInodeFd.filedesc) &&
+		i.ftype == o.ftype
+}
+
+// InotifyMask specifies the event mask of an inotify watch. It additionally
+// implements Stringer returning the known set bits with their symbolic
+// constant names.
+type InotifyMask uint32
+
+// String returns the symbolic names of the set bits, joined by “|”. Any
+// unknown remaining bits are shown as a single hex number.
+func (m InotifyMask) String() string {
+	n := make([]string, 0)
+	remaining := uint32(m)
+	for _, event := range inotifyMaskNames {
+		if remaining&event.bit != 0 {
+			n = append(n, event.name)
+			remaining &^= event.bit
+		}
+	}
+	if remaining != 0 {
+		n = append(n, fmt.Sprintf("0x%x", remaining))
+	}
+	return strings.Join(n, "|")
+}
+
+// inotifyMaskNames lists the inotify event bits with their textual names, in
+// order of their bit values.
+var inotifyMaskNames = []struct {
+	bit  uint32
+	name string
+}{
+	{unix.IN_ACCESS, "IN_ACCESS"},
+	{unix.IN_MODIFY, "IN_MODIFY"},
+	{unix.IN_ATTRIB, "IN_ATTRIB"},
+	{unix.IN_CLOSE_WRITE, "IN_CLOSE_WRITE"},
+	{unix.IN_CLOSE_NOWRITE, "IN_CLOSE_NOWRITE"},
+	{unix.IN_OPEN, "IN_OPEN"},
+	{unix.IN_MOVED_FROM, "IN_MOVED_FROM"},
+	{unix.IN_MOVED_TO, "IN_MOVED_TO"},
+	{unix.IN_CREATE, "IN_CREATE"},
+	{unix.IN_DELETE, "IN_DELETE"},
+	{unix.IN_DELETE_SELF, "IN_DELETE_SELF"},
+	{unix.IN_MOVE_SELF, "IN_MOVE_SELF"},
+	{unix.IN_UNMOUNT, "IN_UNMOUNT"},
+	{unix.IN_Q_OVERFLOW, "IN_Q_OVERFLOW"},
+	{unix.IN_IGNORED, "IN_IGNORED"},
+	{unix.IN_ONLYDIR, "IN_ONLYDIR"},
+	{unix.IN_DONT_FOLLOW, "IN_DONT_FOLLOW"},
+	{unix.IN_EXCL_UNLINK, "IN_EXCL_UNLINK"},
+	{unix.IN_MASK_CREATE, "IN_MASK_CREATE"},
+	{unix.IN_MASK_ADD, "IN_MASK_ADD"},
+	{unix.IN_ISDIR, "IN_ISDIR"},
+	{unix.IN_ONESHOT, "IN_ONESHOT"},
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("inotify fd", func() {
+
+	const fakeBase = "/proc/fake/fd"
+
+	It("correctly fails for invalid fd number", func() {
+		Expect(NewInotifyFd(-1, fakeBase, "anon_inode:inotify")).Error().
+			To(HaveOccurred())
+	})
+
+	It("lists the watches", func() {
+		fd := Successful(unix.InotifyInit1(unix.IN_CLOEXEC))
+		defer unix.Close(fd)
+		dir := GinkgoT().TempDir()
+		wd := Successful(unix.InotifyAddWatch(fd, dir, unix.IN_CREATE|unix.IN_DELETE))
+		var st unix.Stat_t
+		Expect(unix.Stat(dir, &st)).To(Succeed())
+
+		fdesc := Successful(New(fd))
+		Expect(fdesc).To(BeAssignableToTypeOf(&InotifyFd{}))
+		inotify := fdesc.(*InotifyFd)
+		Expect(inotify.FileType()).To(Equal("inotify"))
+		Expect(inotify.Watches()).To(ConsistOf(And(
+			HaveField("WD", wd),
+			HaveField("Dev", st.Dev),
+			HaveField("Ino", st.Ino),
+			HaveField("Mask", uint32(unix.IN_CREATE|unix.IN_DELETE)))))
+		Expect(inotify.Description(0)).To(MatchRegexp(
+			`\n\s+watches: 1\n\s+wd %d: .* \(IN_CREATE\|IN_DELETE\)$`, wd))
+
+		if path := inotify.Watches()[0].Path; path != "" {
+			Expect(path).To(Equal(dir))
+			Expect(inotify.Description(0)).To(ContainSubstring(`: "` + dir + `" (`))
+		} else {
+			Expect(inotify.Description(0)).To(MatchRegexp(`: inode %d on device \d+:\d+ `, st.Ino))
+		}
+	})
+
+	It("parses inotify wd lines", func() {
+		watches, handles := inotifyWatchesFromFdinfo(map[string]string{})
+		Expect(watches).To(BeEmpty())
+		Expect(handles).To(BeEmpty())
+
+		watches, handles = inotifyWatchesFromFdinfo(map[string]string{
+			"inotify wd": "2 ino:11001b sdev:fe00001 mask:200 ignored_mask:0 fhandle-bytes:8 fhandle-type:1 f_handle:1b001100acb2389d\n" +
+				"x ino:1 sdev:0 mask:0\n" +
+				"3 ino:2a sdev:800001 mask:100 ignored_mask:0",
+		})
+		Expect(watches).To(Equal([]InotifyWatch{
+			{WD: 2, Dev: unix.Mkdev(254, 1), Ino: 0x11001b, Mask: unix.IN_DELETE},
+			{WD: 3, Dev: unix.Mkdev(8, 1), Ino: 42, Mask: unix.IN_CREATE},
+		}))
+		Expect(handles).To(HaveLen(2))
+		Expect(handles[0].Type()).To(Equal(int32(1)))
+		Expect(handles[0].Bytes()).To(HaveLen(8))
+		Expect(handles[1]).To(BeNil())
+	})
+
+	It("names mask bits", func() {
+		Expect(InotifyMask(0).String()).To(BeEmpty())
+		Expect(InotifyMask(unix.IN_MODIFY | unix.IN_ISDIR | 0x08000000).String()).To(
+			Equal("IN_MODIFY|IN_ISDIR|0x8000000"))
+	})
+
+	It("determines equality correctly", func() {
+		fd := Successful(unix.InotifyInit1(unix.IN_CLOEXEC))
+		defer unix.Close(fd)
+
+		fdesc := Successful(New(fd))
+		Expect(fdesc.Equal(nil)).To(BeFalse())
+		Expect(fdesc.Equal(fdesc)).To(BeTrue())
+		Expect(fdesc.Equal(&fdesc.(*InotifyFd).AnonInodeFd)).To(BeFalse())
+		Expect(fdesc.Equal(Successful(New(0)))).To(BeFalse())
+	})
+
+})
@@ -0,0 +1,78 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IoUringFd implements FileDescriptor for an fd referencing an io_uring
+// instance, that is, an anonymous inode of “file” type “io_uring”, as created
+// by io_uring_setup(2). In addition to the generic anonymous inode
+// information, it details the files registered with the ring.
+type IoUringFd struct {
+	AnonInodeFd
+	registered []RegisteredFile // files registered with this ring.
+}
+
+// NewIoUringFd returns a new FileDescriptor for an fd referencing an io_uring
+// instance.
+func NewIoUringFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newIoUringFd(fdNo, base, linkDest, nil)
+}
+
+// newIoUringFd implements [NewIoUringFd] using the specified discovery options.
+func newIoUringFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	filedesc, err := newFiledesc(fdNo, base, o)
+	if err != nil {
+		return nil, err
+	}
+	r := &IoUringFd{
+		AnonInodeFd: AnonInodeFd{
+			filedesc: filedesc,
+			ftype:    strings.Trim(linkDest[len(anonInodePrefix):], "[]"),
+		},
+	}
+	r.registered, _ = ioUringRegisteredFiles(fdNo, base, o.enrichmentTimeout())
+	return r, nil
+}
+
+// RegisteredFiles returns the files registered with this io_uring instance;
+// see also [StaleRegisteredFiles].
+func (r IoUringFd) RegisteredFiles() []RegisteredFile { return r.registered }
+
+// Description returns a pretty formatted multi-line textual description
+// detailing the fd number, flags, and “file type” of anonymous node, as well as
+// the number of files registered with this io_uring instance.
+func (r IoUringFd) Description(indentation uint) string {
+	indent := Indentation(indentation + 1) // further details are always indented further
+	return r.AnonInodeFd.Description(indentation) +
+		fmt.Sprintf("\n%sregistered files: %d", indent, len(r.registered))
+}
+
+// Equal returns true, if other is also an io_uring fd with the same fd number
+// (and mount ID). The registered files are not taken into consideration, as
+// they might change over the lifetime of an io_uring instance.
+func (r IoUringFd) Equal(other FileDescriptor) bool {
+	o, ok := other.(*IoUringFd)
+	if !ok {
+		return false
+	}
+	return r.AnonInodeFd.filedesc.Equal(&o.AnonInodeFd.filedesc) &&
+		r.ftype == o.ftype
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NamespaceNamer, if set, returns a human-readable name for the Linux-kernel
+// namespace of the specified type (such as "net", "mnt", et cetera) and inode
+// number, or "" if it cannot name the namespace. For instance, a NamespaceNamer
+// might use the [lxkns] discovery engine to name namespaces after the
+// containers using them, making descriptions of namespace fds far more legible
+// in multi-container test rigs.
+//
+// [lxkns]: https://github.com/thediveo/lxkns
+var NamespaceNamer func(nstype string, ino uint64) string
+
+// NamespaceNames maps namespace types (such as "net", "mnt", et cetera) and
+// inode numbers to human-readable namespace names. NamespaceNames adapts the
+// results of namespace discoveries, such as by [lxkns], to a [NamespaceNamer]
+// without fdooze depending on any particular discovery engine. For instance,
+// to name namespaces after the containers using them:
+//
+//	result := discover.Namespaces(discover.WithStandardDiscovery(),
+//	    discover.WithContainerizer(cizer))
+//	names := filedesc.NamespaceNames{}
+//	for _, cntr := range result.Containers {
+//	    for _, ns := range cntr.Process.Namespaces {
+//	        if ns != nil {
+//	            names.Add(ns.Type().Name(), ns.ID().Ino, cntr.Name)
+//	        }
+//	    }
+//	}
+//	filedesc.NamespaceNamer = names.Namer()
+//
+// [lxkns]: https://github.com/thediveo/lxkns
+type NamespaceNames map[string]map[uint64]string
+
+// Add names the namespace of the specified type and inode number, unless it
+// has already been named, so that the first name added wins.
+func (n NamespaceNames) Add(nstype string, ino uint64, name string) {
+	names, ok := n[nstype]
+	if !ok {
+		names = map[uint64]string{}
+		n[nstype] = names
+	}
+	if _, ok := names[ino]; !ok {
+		names[ino] = name
+	}
+}
+
+// Namer returns a [NamespaceNamer] looking up namespace names in these
+// NamespaceNames.
+func (n NamespaceNames) Namer() func(nstype string, ino uint64) string {
+	return func(nstype string, ino uint64) string {
+		return n[nstype][ino]
+	}
+}
+
+// NamespaceFd implements the FileDescriptor interface for an fd referencing a
+// Linux-kernel namespace, such as when opening /proc/$PID/ns/net.
+type NamespaceFd struct {
+	filedesc
+	nstype string // type of namespace, such as "net", "mnt", et cetera.
+	ino    uint64 // namespace's inode number from the nsfs.
+}
+
+// NewNamespaceFd returns a new FileDescriptor for a namespace fd.
+func NewNamespaceFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newNamespaceFd(fdNo, base, linkDest, nil)
+}
+
+// newNamespaceFd implements [NewNamespaceFd] using the specified discovery options.
+func newNamespaceFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	nstype, inoArg, ok := strings.Cut(linkDest, ":[")
+	if !ok {
+		return nil, fmt.Errorf("invalid namespace link %q", linkDest)
+	}
+	ino, err := strconv.ParseUint(strings.TrimSuffix(inoArg, "]"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	filedesc, err := newFiledesc(fdNo, base, o)
+	if err != nil {
+		return nil, err
+	}
+	return &NamespaceFd{
+		filedesc: filedesc,
+		nstype:   nstype,
+		ino:      ino,
+	}, nil
+}
+
+// NamespaceType returns the type of namespace, such as "net", "mnt", et cetera.
+func (n NamespaceFd) NamespaceType() string { return n.nstype }
+
+// Ino returns the namespace's inode number, identifying the namespace.
+func (n NamespaceFd) Ino() uint64 { return n.ino }
+
+// Name returns the human-readable name of the namespace as returned by the
+// [NamespaceNamer], or "" if there is no NamespaceNamer or it cannot name this
+// namespace.
+func (n NamespaceFd) Name() string {
+	if NamespaceNamer == nil {
+		return ""
+	}
+	return NamespaceNamer(n.nstype, n.ino)
+}
+
+// Description returns a pretty formatted multi-line textual description
+// detailing the fd number, flags, namespace type and inode number, as well as
+// the namespace's name, if known.
+func (n NamespaceFd) Description(indentation uint) string {
+	indent := Indentation(indentation + 1) // further details are always indented further
+	desc := n.filedesc.Description(indentation) +
+		fmt.Sprintf("\n%snamespace %s:[%d]", indent, n.nstype, n.ino)
+	if name := n.Name(); name != "" {
+		desc += fmt.Sprintf(" %q", name)
+	}
+	return desc
+}
+
+// Equal returns true, if other is a NamespaceFd with the same fd number and
+// mount ID, as well as the same namespace type and inode number.
+func (n NamespaceFd) Equal(other FileDescriptor) bool {
+	o, ok := other.(*NamespaceFd)
+	if !ok {
+		return false
+	}
+	return n.filedesc.Equal(&o.filedesc) &&
+		n.nstype == o.nstype && n.ino == o.ino
+}
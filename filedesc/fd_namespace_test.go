@@ -0,0 +1,103 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("namespace fd", func() {
+
+	const fakeBase = "/proc/fake/fd"
+
+	It("correctly fails for invalid fd number or namespace link", func() {
+		Expect(NewNamespaceFd(-1, fakeBase, "net")).Error().To(HaveOccurred())
+		Expect(NewNamespaceFd(-1, fakeBase, "net:[abc]")).Error().To(HaveOccurred())
+		Expect(NewNamespaceFd(-1, fakeBase, "net:[4026531840]")).Error().To(HaveOccurred())
+	})
+
+	It("returns correct namespace details", func() {
+		fd := Successful(unix.Open("/proc/self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0))
+		defer unix.Close(fd)
+
+		var netnsStat unix.Stat_t
+		Expect(unix.Fstat(fd, &netnsStat)).To(Succeed())
+
+		fdesc := Successful(New(fd))
+		nsfd := fdesc.(*NamespaceFd)
+		Expect(nsfd.NamespaceType()).To(Equal("net"))
+		Expect(nsfd.Ino()).To(Equal(netnsStat.Ino))
+		Expect(nsfd.Name()).To(BeEmpty())
+		Expect(nsfd.Description(0)).To(MatchRegexp(
+			`^fd \d+, flags 0x.* \(O_RDONLY,O_CLOEXEC\)\n\s+namespace net:\[\d+\]$`))
+	})
+
+	It("names namespaces", Serial, func() {
+		fd := Successful(unix.Open("/proc/self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0))
+		defer unix.Close(fd)
+
+		NamespaceNamer = func(nstype string, ino uint64) string {
+			if nstype != "net" {
+				return ""
+			}
+			return "initial network namespace"
+		}
+		DeferCleanup(func() { NamespaceNamer = nil })
+
+		fdesc := Successful(New(fd))
+		Expect(fdesc.(*NamespaceFd).Name()).To(Equal("initial network namespace"))
+		Expect(fdesc.Description(0)).To(MatchRegexp(
+			`namespace net:\[\d+\] "initial network namespace"$`))
+	})
+
+	It("names namespaces using a names table", Serial, func() {
+		fd := Successful(unix.Open("/proc/self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0))
+		defer unix.Close(fd)
+		var netnsStat unix.Stat_t
+		Expect(unix.Fstat(fd, &netnsStat)).To(Succeed())
+
+		names := NamespaceNames{}
+		names.Add("net", netnsStat.Ino, "pompous_pike")
+		names.Add("net", netnsStat.Ino, "mad_hatter")
+		names.Add("mnt", netnsStat.Ino, "confused_cat")
+		NamespaceNamer = names.Namer()
+		DeferCleanup(func() { NamespaceNamer = nil })
+
+		fdesc := Successful(New(fd))
+		Expect(fdesc.(*NamespaceFd).Name()).To(Equal("pompous_pike"))
+		Expect(fdesc.Description(0)).To(MatchRegexp(`namespace net:\[\d+\] "pompous_pike"$`))
+		Expect(NamespaceNamer("net", netnsStat.Ino+1)).To(BeEmpty())
+		Expect(NamespaceNamer("user", netnsStat.Ino)).To(BeEmpty())
+	})
+
+	It("determines equality correctly", func() {
+		fd := Successful(unix.Open("/proc/self/ns/net", unix.O_RDONLY|unix.O_CLOEXEC, 0))
+		defer unix.Close(fd)
+
+		fdesc := Successful(New(fd))
+		Expect(fdesc.Equal(nil)).To(BeFalse())
+		Expect(fdesc.Equal(fdesc)).To(BeTrue())
+
+		fd0 := Successful(New(0))
+		Expect(fdesc.Equal(fd0)).To(BeFalse())
+	})
+
+})
@@ -16,46 +16,345 @@
 
 package filedesc
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// errUnresponsive signals that an enrichment step timed out.
+var errUnresponsive = errors.New("unresponsive backing filesystem")
+
+// unresponsiveMounts tracks the IDs of the mounts with statx calls still
+// blocked after having timed out.
+var unresponsiveMounts = struct {
+	sync.Mutex
+	ids map[int]struct{}
+}{ids: map[int]struct{}{}}
+
+// statx can be replaced in unit tests in order to simulate unresponsive
+// backing filesystems.
+var statx = func(dirfd int, path string, flags int, mask int, stx *unix.Statx_t) error {
+	return countedErr(unix.Statx(dirfd, path, flags, mask, stx))
+}
 
 // PathFd implements FileDescriptor for an fd with a path to a regular file,
 // directory, device, ... in the VFS.
 type PathFd struct {
 	filedesc
-	path string // just a plain and simple absolute path.
+	path     string // just a plain and simple absolute path.
+	dev      uint64 // device of the open file, or 0 if unknown.
+	ino      uint64 // inode number of the open file, or 0 if unknown.
+	nlink    uint32 // number of hard links to the open file.
+	size     uint64 // size of the open file in bytes.
+	blocks   uint64 // number of 512 byte blocks allocated to the open file.
+	replaced bool   // path doesn't resolve to the open file anymore.
+
+	canonical    string // path via the first mount of its filesystem, if known.
+	acrossMounts bool   // discovered WithSameFileAcrossMounts.
+
+	unresponsive bool // statx'ing the open file timed out.
 }
 
 // NewPathFd returns a new FileDescriptor for an fd with an ordinary file system
 // path. The link argument specifies the (absolute) file system path.
+//
+// Additionally, NewPathFd statx'es the fd's procfs link itself, not the target
+// path, in order to learn the authoritative device and inode number of the
+// open file. When discovering [WithConfirmedPaths] and the path doesn't resolve
+// to the same file anymore, such as when the file has been deleted or replaced
+// in the meantime, the PathFd is marked as such.
 func NewPathFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
-	filedesc, err := newFiledesc(fdNo, base)
+	return newPathFd(fdNo, base, linkDest, nil)
+}
+
+// newPathFd implements [NewPathFd] using the specified discovery options.
+func newPathFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	filedesc, err := newFiledesc(fdNo, base, o)
 	if err != nil {
 		return nil, err
 	}
-	return &PathFd{
+	p := &PathFd{
 		filedesc: filedesc,
 		path:     linkDest,
-	}, nil
+	}
+	stx, err := statxFile(fmt.Sprintf("%s/%d", base, fdNo), p.mntId, o.enrichmentTimeout())
+	switch {
+	case err == nil:
+		p.dev = unix.Mkdev(stx.Dev_major, stx.Dev_minor)
+		p.ino = stx.Ino
+		p.nlink = stx.Nlink
+		p.size = stx.Size
+		p.blocks = stx.Blocks
+	case errors.Is(err, errUnresponsive):
+		p.unresponsive = true
+	}
+	if o.confirmsPaths() && p.ino != 0 {
+		// Resolve the path from the point of view of the process owning the
+		// fd, as it might have a different root directory.
+		stx, err := statxFile(strings.TrimSuffix(base, "/fd")+"/root"+linkDest, p.mntId,
+			o.enrichmentTimeout())
+		p.replaced = err != nil ||
+			unix.Mkdev(stx.Dev_major, stx.Dev_minor) != p.dev || stx.Ino != p.ino
+	}
+	return p, nil
+}
+
+// statxFile returns the statx information of the file at the specified path,
+// following (magic) links, on the mount with the specified ID, subject to the
+// specified timeout.
+func statxFile(path string, mntId int, timeout time.Duration) (unix.Statx_t, error) {
+	return statxTimeout(path, mntId,
+		unix.STATX_INO|unix.STATX_NLINK|unix.STATX_SIZE|unix.STATX_BLOCKS, timeout)
+}
+
+// statxTimeout returns the statx information with the specified mask of the
+// file at the specified path, following (magic) links. Network filesystems
+// are asked to not synchronize with their servers. If statx doesn't return
+// within the specified timeout, errUnresponsive is returned instead, and the
+// mount with the specified ID is considered to be unresponsive until this
+// statx returns: in the meantime, statxTimeout returns errUnresponsive right
+// away for the same mount. A zero mount ID means an unknown mount, and a zero
+// or negative timeout means no timeout; see also [WithEnrichmentTimeout]. On
+// kernels without statx support, ENOSYS is returned without trying.
+func statxTimeout(path string, mntId int, mask int, timeout time.Duration) (unix.Statx_t, error) {
+	return statxAtTimeout(unix.AT_FDCWD, path, 0, mntId, mask, timeout)
+}
+
+// statxAtTimeout works like [statxTimeout], but takes a directory fd and
+// additional flags, such as AT_EMPTY_PATH for statx'ing the directory fd
+// itself.
+func statxAtTimeout(dirfd int, path string, flags int, mntId int, mask int, timeout time.Duration) (unix.Statx_t, error) {
+	if !features().Statx {
+		return unix.Statx_t{}, unix.ENOSYS
+	}
+	if mntId != 0 {
+		unresponsiveMounts.Lock()
+		_, unresponsive := unresponsiveMounts.ids[mntId]
+		unresponsiveMounts.Unlock()
+		if unresponsive {
+			return unix.Statx_t{}, errUnresponsive
+		}
+	}
+	type result struct {
+		stx unix.Statx_t
+		err error
+	}
+	do := func() (r result) {
+		r.err = statx(dirfd, path, flags|unix.AT_STATX_DONT_SYNC, mask, &r.stx)
+		return
+	}
+	if timeout <= 0 {
+		r := do()
+		return r.stx, r.err
+	}
+	done := make(chan result, 1) // buffered, so a late statx doesn't block forever.
+	var returned, timedOut bool  // both protected by unresponsiveMounts.
+	go func() {
+		r := do()
+		unresponsiveMounts.Lock()
+		returned = true
+		if timedOut {
+			delete(unresponsiveMounts.ids, mntId)
+		}
+		unresponsiveMounts.Unlock()
+		done <- r
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.stx, r.err
+	case <-timer.C:
+		unresponsiveMounts.Lock()
+		if !returned && mntId != 0 {
+			timedOut = true
+			unresponsiveMounts.ids[mntId] = struct{}{}
+		}
+		unresponsiveMounts.Unlock()
+		return unix.Statx_t{}, errUnresponsive
+	}
 }
 
 // Path returns the path name this fd references.
 func (p PathFd) Path() string { return p.path }
 
+// Dev returns the device of the open file, or 0 if unknown.
+func (p PathFd) Dev() uint64 { return p.dev }
+
+// Ino returns the inode number of the open file, or 0 if unknown.
+func (p PathFd) Ino() uint64 { return p.ino }
+
+// Nlink returns the number of hard links to the open file; it is only valid if
+// Ino returns a non-zero inode number. A zero Nlink indicates that the file has
+// already been unlinked and its disk space is held only by open fds.
+func (p PathFd) Nlink() uint32 { return p.nlink }
+
+// Size returns the size of the open file in bytes; it is only valid if Ino
+// returns a non-zero inode number.
+func (p PathFd) Size() uint64 { return p.size }
+
+// DiskUsage returns the disk space in bytes allocated to the open file; it is
+// only valid if Ino returns a non-zero inode number. For sparse files,
+// DiskUsage might be (much) smaller than Size.
+func (p PathFd) DiskUsage() uint64 { return p.blocks * 512 }
+
+// SharedMemory returns true if the open file is a memfd or a POSIX shared
+// memory object, that is, if its memory might also be mapped.
+func (p PathFd) SharedMemory() bool {
+	return strings.HasPrefix(p.path, "/memfd:") || strings.HasPrefix(p.path, "/dev/shm/")
+}
+
+// Unlinked returns true if the open file has already been unlinked, so that
+// its disk space is held only by open fds. This is the classic disk space leak
+// symptom.
+func (p PathFd) Unlinked() bool { return p.ino != 0 && p.nlink == 0 }
+
+// Tmpfile returns true if the open file is an unnamed temporary file, as
+// created by open(2) with O_TMPFILE, which hasn't been given a name using
+// linkat(2) yet. The kernel shows the path of such files as a pseudo name of
+// the form “#ino (deleted)” inside the directory specified when opening them,
+// even after they have been given a name, so the number of hard links tells
+// them apart, if known.
+func (p PathFd) Tmpfile() bool {
+	return int(p.flags)&O_TMPFILE == O_TMPFILE && strings.HasSuffix(p.path, deletedSuffix) &&
+		(p.ino == 0 || p.nlink == 0)
+}
+
+// TmpfileDir returns the directory of an unnamed temporary file, see
+// [PathFd.Tmpfile]; otherwise, it returns "".
+func (p PathFd) TmpfileDir() string {
+	if !p.Tmpfile() {
+		return ""
+	}
+	return filepath.Dir(strings.TrimSuffix(p.path, deletedSuffix))
+}
+
+// deletedSuffix is appended by the kernel to the paths of unlinked files.
+const deletedSuffix = " (deleted)"
+
+// Unresponsive returns true if enriching this fd timed out, because the backing
+// filesystem is unresponsive, such as a dead NFS or FUSE filesystem. In this
+// case, the device, inode, and size information is unknown. See also
+// [WithEnrichmentTimeout].
+func (p PathFd) Unresponsive() bool { return p.unresponsive }
+
+// Replaced returns true if the path doesn't resolve to the open file anymore,
+// because it has been deleted or replaced by a different file. Replaced always
+// returns false unless discovered [WithConfirmedPaths].
+func (p PathFd) Replaced() bool { return p.replaced }
+
 // Description returns a pretty formatted multi-line textual description
-// detailing the fd number, flags, and path.
+// detailing the fd number, flags, and path. Unnamed temporary files are
+// described by their directory instead of their pseudo path.
 func (p PathFd) Description(indentation uint) string {
 	indent := Indentation(indentation + 1) // further details are always indented further
-	return p.filedesc.Description(indentation) +
+	if p.Tmpfile() {
+		desc := p.filedesc.Description(indentation) +
+			fmt.Sprintf("\n%sunnamed temp file in %q", indent, p.TmpfileDir())
+		if p.ino != 0 {
+			desc += fmt.Sprintf(" (size %d)", p.size)
+		}
+		if p.unresponsive {
+			desc += fmt.Sprintf("\n%sunresponsive backing filesystem", indent)
+		}
+		return desc
+	}
+	desc := p.filedesc.Description(indentation) +
 		fmt.Sprintf("\n%spath: %q", indent, p.path)
+	if p.replaced {
+		desc += fmt.Sprintf(" (path no longer resolves to open file with inode %d)", p.ino)
+	}
+	if p.unresponsive {
+		desc += fmt.Sprintf("\n%sunresponsive backing filesystem", indent)
+	}
+	if p.Unlinked() {
+		desc += fmt.Sprintf("\n%snlink 0: file already unlinked, space held only by this fd", indent)
+	}
+	return desc
 }
 
 // Equal returns true, if other is a pathFd with the same fd number and mount
-// ID, as well as the same filename/path.
+// ID, as well as the same filename/path. If either PathFd has been discovered
+// [WithSameFileAcrossMounts], Equal additionally returns true if other has the
+// same fd number and references the same file via a different path; see
+// [PathFd.SameFile].
 func (p PathFd) Equal(other FileDescriptor) bool {
 	o, ok := other.(*PathFd)
 	if !ok {
 		return false
 	}
+	if (p.acrossMounts || o.acrossMounts) && p.fdNo == o.fdNo && p.path != o.path {
+		return p.SameFile(o)
+	}
 	return p.filedesc.Equal(&o.filedesc) &&
 		p.path == o.path
 }
+
+// SameFile returns true if other references the same file, even if via a
+// different path on a different mount, such as a different bind mount of the
+// same directory. If the device and inode numbers of both open files are
+// known, they decide; otherwise, the canonical paths decide, see
+// [PathFd.CanonicalPath].
+func (p PathFd) SameFile(other *PathFd) bool {
+	if p.ino != 0 && other.ino != 0 {
+		return p.dev == other.dev && p.ino == other.ino
+	}
+	return p.CanonicalPath() == other.CanonicalPath()
+}
+
+// SameFileAcrossMounts returns true if this PathFd has been discovered
+// [WithSameFileAcrossMounts], so that it is equal to PathFds with the same fd
+// number referencing the same file via different paths.
+func (p PathFd) SameFileAcrossMounts() bool { return p.acrossMounts }
+
+// CanonicalPath returns the path of the open file via the first mount of its
+// filesystem that reaches the file, as determined from the mountinfo of the
+// process owning the fd. Files opened via different bind mounts of the same
+// directory thus have the same canonical path. If the mount of the fd is
+// unknown, CanonicalPath returns the path instead. Unless the canonical path
+// has already been determined at discovery time because of
+// [WithSameFileAcrossMounts], CanonicalPath reads the mountinfo of the owning
+// process.
+func (p PathFd) CanonicalPath() string {
+	if p.canonical != "" {
+		return p.canonical
+	}
+	if p.mntId == 0 || p.pid == 0 {
+		return p.path
+	}
+	mounts, err := ProcessMounts(p.pid)
+	if err != nil {
+		return p.path
+	}
+	return canonicalPath(mounts, p.mntId, p.path)
+}
+
+// canonicalizePaths marks the specified fds of the process identified by pid
+// to be compared across mounts and determines their canonical paths, reading
+// the process's mountinfo only once.
+func canonicalizePaths(fds []FileDescriptor, pid int) {
+	var mounts []Mount
+	for _, fd := range fds {
+		pathfd, ok := fd.(*PathFd)
+		if !ok {
+			continue
+		}
+		pathfd.acrossMounts = true
+		if pid == 0 || pathfd.mntId == 0 {
+			continue
+		}
+		if mounts == nil {
+			var err error
+			if mounts, err = ProcessMounts(pid); err != nil {
+				return
+			}
+		}
+		pathfd.canonical = canonicalPath(mounts, pathfd.mntId, pathfd.path)
+	}
+}
@@ -17,6 +17,14 @@
 package filedesc
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"golang.org/x/sys/unix"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -28,6 +36,15 @@ var _ = Describe("file path fd", func() {
 
 	const fakeBase = "/proc/fake/fd"
 
+	// quickly returns a new PathFd for the specified fd of our own process,
+	// discovered via our PID with a short enrichment timeout.
+	quickly := func(fd int) *PathFd {
+		base := procPIDPath(os.Getpid()) + "/fd"
+		linkDest := Successful(os.Readlink(base + "/" + strconv.Itoa(fd)))
+		o := newDiscoveryOptions([]DiscoveryOption{WithEnrichmentTimeout(10 * time.Millisecond)})
+		return Successful(newPathFd(fd, base, linkDest, o)).(*PathFd)
+	}
+
 	It("fails when given an invalid fd number", func() {
 		Expect(NewPathFd(-1, fakeBase, "/foobar")).Error().
 			To(HaveOccurred())
@@ -44,6 +61,139 @@ var _ = Describe("file path fd", func() {
 			fd))
 	})
 
+	It("detects replaced files", func() {
+		confirm := newDiscoveryOptions([]DiscoveryOption{WithConfirmedPaths()})
+		tmpdir := GinkgoT().TempDir()
+		path := filepath.Join(tmpdir, "foo")
+		Expect(os.WriteFile(path, []byte("foo"), 0600)).To(Succeed())
+		fd := Successful(unix.Open(path, unix.O_RDONLY, 0))
+		defer unix.Close(fd)
+
+		fdesc := Successful(newPathFd(fd, "/proc/self/fd", path, confirm))
+		pathfd := fdesc.(*PathFd)
+		Expect(pathfd.Ino()).NotTo(BeZero())
+		Expect(pathfd.Dev()).NotTo(BeZero())
+		Expect(pathfd.Replaced()).To(BeFalse())
+		Expect(pathfd.Description(0)).NotTo(ContainSubstring("no longer resolves"))
+
+		Expect(os.Remove(path)).To(Succeed())
+		Expect(os.WriteFile(path, []byte("bar"), 0600)).To(Succeed())
+		Expect(Successful(NewPathFd(fd, "/proc/self/fd", path)).(*PathFd).Replaced()).To(BeFalse())
+		fdesc = Successful(newPathFd(fd, "/proc/self/fd", path, confirm))
+		pathfd = fdesc.(*PathFd)
+		Expect(pathfd.Replaced()).To(BeTrue())
+		Expect(pathfd.Description(0)).To(MatchRegexp(
+			`path: ".*/foo" \(path no longer resolves to open file with inode \d+\)`))
+	})
+
+	It("calls out unlinked files", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "foo")
+		Expect(os.WriteFile(path, []byte("foo"), 0600)).To(Succeed())
+		fd := Successful(unix.Open(path, unix.O_RDONLY, 0))
+		defer unix.Close(fd)
+
+		pathfd := Successful(New(fd)).(*PathFd)
+		Expect(pathfd.Nlink()).To(Equal(uint32(1)))
+		Expect(pathfd.Size()).To(Equal(uint64(3)))
+		Expect(pathfd.Unlinked()).To(BeFalse())
+		Expect(pathfd.Description(0)).NotTo(ContainSubstring("nlink"))
+
+		Expect(os.Remove(path)).To(Succeed())
+		pathfd = Successful(New(fd)).(*PathFd)
+		Expect(pathfd.Nlink()).To(BeZero())
+		Expect(pathfd.Unlinked()).To(BeTrue())
+		Expect(pathfd.Description(0)).To(MatchRegexp(
+			`path: ".*/foo \(deleted\)"\n\s+nlink 0: file already unlinked, space held only by this fd$`))
+	})
+
+	It("describes unnamed temp files", func() {
+		dir := GinkgoT().TempDir()
+		fd, err := unix.Open(dir, O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, 0600)
+		if err != nil {
+			Skip("needs O_TMPFILE support")
+		}
+		defer unix.Close(fd)
+		Expect(unix.Write(fd, []byte("foobar"))).To(Equal(6))
+
+		pathfd := Successful(New(fd)).(*PathFd)
+		Expect(pathfd.Tmpfile()).To(BeTrue())
+		Expect(pathfd.TmpfileDir()).To(Equal(dir))
+		Expect(pathfd.Description(0)).To(MatchRegexp(
+			`\n\s+unnamed temp file in %q \(size 6\)$`, dir))
+
+		path := filepath.Join(dir, "foo")
+		Expect(unix.Linkat(fd, "", unix.AT_FDCWD, path, unix.AT_EMPTY_PATH)).To(Succeed())
+		pathfd = Successful(New(fd)).(*PathFd)
+		Expect(pathfd.Tmpfile()).To(BeFalse())
+		Expect(pathfd.TmpfileDir()).To(BeEmpty())
+		Expect(pathfd.Nlink()).To(Equal(uint32(1)))
+		Expect(pathfd.Description(0)).To(ContainSubstring("path: "))
+	})
+
+	It("marks fds on unresponsive backing filesystems", Serial, func() {
+		unblock := make(chan struct{})
+		defer close(unblock)
+		oldStatx := statx
+		DeferCleanup(func() { statx = oldStatx })
+		DeferCleanup(func() {
+			// wait for the blocked statx to return after unblocking it.
+			Eventually(func() int {
+				unresponsiveMounts.Lock()
+				defer unresponsiveMounts.Unlock()
+				return len(unresponsiveMounts.ids)
+			}).Should(BeZero())
+		})
+		statx = func(int, string, int, int, *unix.Statx_t) error {
+			<-unblock
+			return nil
+		}
+
+		fd := Successful(unix.Open("fd_path_test.go", unix.O_RDONLY, 0))
+		defer unix.Close(fd)
+
+		pathfd := quickly(fd)
+		Expect(pathfd.Unresponsive()).To(BeTrue())
+		Expect(pathfd.Ino()).To(BeZero())
+		Expect(pathfd.Description(0)).To(MatchRegexp(
+			`path: ".*/fd_path_test.go"\n\s+unresponsive backing filesystem$`))
+	})
+
+	It("gives up on unresponsive mounts after their first timeout", Serial, func() {
+		unblock := make(chan struct{})
+		var unblockOnce sync.Once
+		defer unblockOnce.Do(func() { close(unblock) })
+		var calls atomic.Int32
+		oldStatx := statx
+		DeferCleanup(func() { statx = oldStatx })
+		DeferCleanup(func() {
+			// wait for the blocked statx to return after unblocking it.
+			Eventually(func() int {
+				unresponsiveMounts.Lock()
+				defer unresponsiveMounts.Unlock()
+				return len(unresponsiveMounts.ids)
+			}).Should(BeZero())
+		})
+		statx = func(int, string, int, int, *unix.Statx_t) error {
+			calls.Add(1)
+			<-unblock
+			return nil
+		}
+
+		fd := Successful(unix.Open("fd_path_test.go", unix.O_RDONLY, 0))
+		defer unix.Close(fd)
+		otherfd := Successful(unix.Open("fd_path.go", unix.O_RDONLY, 0))
+		defer unix.Close(otherfd)
+
+		Expect(quickly(fd).Unresponsive()).To(BeTrue())
+		Expect(quickly(otherfd).Unresponsive()).To(BeTrue())
+		Expect(calls.Load()).To(Equal(int32(1)))
+
+		unblockOnce.Do(func() { close(unblock) })
+		Eventually(func() bool {
+			return quickly(otherfd).Unresponsive()
+		}).Should(BeFalse())
+	})
+
 	It("determines equality correctly", func() {
 		fd := Successful(unix.Open("fd_path_test.go", unix.O_RDONLY, 0))
 		defer unix.Close(fd)
@@ -56,4 +206,51 @@ var _ = Describe("file path fd", func() {
 		Expect(fdesc.Equal(fd0)).To(BeFalse())
 	})
 
+	It("optionally considers the same file via different bind mounts equal", func() {
+		tmpdir := GinkgoT().TempDir()
+		srcdir := filepath.Join(tmpdir, "src")
+		binddir := filepath.Join(tmpdir, "bind")
+		Expect(os.Mkdir(srcdir, 0700)).To(Succeed())
+		Expect(os.Mkdir(binddir, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(srcdir, "app.conf"), []byte("foo"), 0600)).To(Succeed())
+		if err := unix.Mount(srcdir, binddir, "", unix.MS_BIND, ""); err != nil {
+			Skip("needs privileges to bind mount: " + err.Error())
+		}
+		DeferCleanup(func() { _ = unix.Unmount(binddir, unix.MNT_DETACH) })
+
+		// Re-open the same file through the bind mount under the same fd
+		// number.
+		fd := Successful(unix.Open(filepath.Join(srcdir, "app.conf"), unix.O_RDONLY, 0))
+		defer unix.Close(fd)
+		before := Successful(New(fd)).(*PathFd)
+		bindfd := Successful(unix.Open(filepath.Join(binddir, "app.conf"), unix.O_RDONLY, 0))
+		Expect(unix.Dup3(bindfd, fd, unix.O_CLOEXEC)).To(Succeed())
+		Expect(unix.Close(bindfd)).To(Succeed())
+		after := Successful(New(fd)).(*PathFd)
+
+		Expect(after.Path()).To(HaveSuffix("/bind/app.conf"))
+		Expect(after.MountId()).NotTo(Equal(before.MountId()))
+		Expect(after.CanonicalPath()).To(Equal(before.CanonicalPath()))
+		Expect(after.SameFile(before)).To(BeTrue())
+		Expect(after.Equal(before)).To(BeFalse())
+
+		Expect(after.SameFileAcrossMounts()).To(BeFalse())
+
+		// the canonical path gets determined at discovery time.
+		fds := FiledescriptorsWith(WithSameFileAcrossMounts())
+		idx := slices.IndexFunc(fds, func(f FileDescriptor) bool { return f.FdNo() == fd })
+		Expect(idx).NotTo(BeNumerically("<", 0))
+		Expect(fds[idx]).To(BeAssignableToTypeOf(&PathFd{}))
+		across := fds[idx].(*PathFd)
+		Expect(across.SameFileAcrossMounts()).To(BeTrue())
+		Expect(across.canonical).To(Equal(before.CanonicalPath()))
+		Expect(across.Equal(before)).To(BeTrue())
+		Expect(before.Equal(across)).To(BeTrue())
+
+		other := Successful(unix.Open("fd_path_test.go", unix.O_RDONLY, 0))
+		defer unix.Close(other)
+		Expect(unix.Dup3(other, fd, unix.O_CLOEXEC)).To(Succeed())
+		Expect(Successful(New(fd)).Equal(across)).To(BeFalse())
+	})
+
 })
@@ -40,12 +40,17 @@ type PipeFd struct {
 
 // NewPipeFd returns a new FileDescriptor for a pipe fd.
 func NewPipeFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newPipeFd(fdNo, base, linkDest, nil)
+}
+
+// newPipeFd implements [NewPipeFd] using the specified discovery options.
+func newPipeFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
 	inoArg := strings.TrimSuffix(strings.TrimPrefix(linkDest, "pipe:["), "]")
 	ino, err := strconv.ParseUint(inoArg, 10, 64)
 	if err != nil {
 		return nil, err
 	}
-	filedesc, err := newFiledesc(fdNo, base)
+	filedesc, err := newFiledesc(fdNo, base, o)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,94 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// shmPrefix is the path prefix of POSIX shared memory objects, as created by
+// shm_open(3).
+const shmPrefix = "/dev/shm/"
+
+// ShmFd implements FileDescriptor for an fd referencing a POSIX shared memory
+// object in /dev/shm, such as created by shm_open(3). While shared memory
+// objects are files in a tmpfs, IPC-heavy applications tend to treat them
+// differently from ordinary files.
+//
+// The owner user and group IDs are as seen from inside the user namespace of
+// the process owning the fd, which might be a child user namespace.
+type ShmFd struct {
+	PathFd
+	uid uint32 // owner user ID
+	gid uint32 // owner group ID
+}
+
+// NewShmFd returns a new FileDescriptor for an fd referencing a POSIX shared
+// memory object.
+func NewShmFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newShmFd(fdNo, base, linkDest, nil)
+}
+
+// newShmFd implements [NewShmFd] using the specified discovery options.
+func newShmFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	fdesc, err := newPathFd(fdNo, base, linkDest, o)
+	if err != nil {
+		return nil, err
+	}
+	s := &ShmFd{PathFd: *fdesc.(*PathFd)}
+	if stx, err := statxTimeout(fmt.Sprintf("%s/%d", base, fdNo), s.mntId,
+		unix.STATX_UID|unix.STATX_GID, o.enrichmentTimeout()); err == nil {
+		// statx returns the IDs as seen from our own user namespace, so
+		// translate them into the IDs as seen by the owning process.
+		s.uid, s.gid = idsInside(strings.TrimSuffix(base, "/fd"), stx.Uid, stx.Gid, o)
+	}
+	return s, nil
+}
+
+// Name returns the name of the shared memory object, that is, the path without
+// the /dev/shm/ prefix.
+func (s ShmFd) Name() string { return s.path[len(shmPrefix):] }
+
+// UID returns the user ID of the owner of the shared memory object, as seen
+// from inside the user namespace of the process owning the fd.
+func (s ShmFd) UID() uint32 { return s.uid }
+
+// GID returns the group ID of the owner of the shared memory object, as seen
+// from inside the user namespace of the process owning the fd.
+func (s ShmFd) GID() uint32 { return s.gid }
+
+// Description returns a pretty formatted multi-line textual description
+// detailing the fd number, flags, path, as well as the size and owner of the
+// shared memory object.
+func (s ShmFd) Description(indentation uint) string {
+	indent := Indentation(indentation + 1) // further details are always indented further
+	return s.PathFd.Description(indentation) +
+		fmt.Sprintf("\n%sshared memory size: %d, owner: %d:%d", indent, s.size, s.uid, s.gid)
+}
+
+// Equal returns true, if other is a ShmFd with the same fd number and mount ID,
+// as well as the same path.
+func (s ShmFd) Equal(other FileDescriptor) bool {
+	o, ok := other.(*ShmFd)
+	if !ok {
+		return false
+	}
+	return s.PathFd.Equal(&o.PathFd)
+}
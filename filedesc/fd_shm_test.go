@@ -0,0 +1,55 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("shared memory fd", func() {
+
+	It("classifies /dev/shm files", func() {
+		shm, err := os.CreateTemp("/dev/shm", "fdooze-*")
+		if err != nil {
+			Skip("needs /dev/shm")
+		}
+		defer os.Remove(shm.Name())
+		defer shm.Close()
+		Expect(shm.Truncate(4096)).To(Succeed())
+
+		fdesc := Successful(New(int(shm.Fd())))
+		shmfd, ok := fdesc.(*ShmFd)
+		Expect(ok).To(BeTrue())
+		Expect(shmfd.Path()).To(Equal(shm.Name()))
+		Expect("/dev/shm/" + shmfd.Name()).To(Equal(shm.Name()))
+		Expect(shmfd.Size()).To(Equal(uint64(4096)))
+		Expect(shmfd.UID()).To(Equal(uint32(os.Getuid())))
+		Expect(shmfd.GID()).To(Equal(uint32(os.Getgid())))
+		Expect(shmfd.Description(0)).To(MatchRegexp(
+			`\n\s+shared memory size: 4096, owner: \d+:\d+$`))
+		Expect(linkKind(shm.Name())).To(Equal("shm"))
+
+		Expect(fdesc.Equal(fdesc)).To(BeTrue())
+		Expect(fdesc.Equal(&shmfd.PathFd)).To(BeFalse())
+		Expect(fdesc.Equal(Successful(New(0)))).To(BeFalse())
+	})
+
+})
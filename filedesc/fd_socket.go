@@ -19,9 +19,10 @@ package filedesc
 import (
 	"errors"
 	"fmt"
-	"reflect"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -37,19 +38,39 @@ type SocketFd struct {
 	protocol  SocketProtocol
 	local     Sockaddr
 	peer      Sockaddr
+	localZone string // IPv6 zone name of the local address in the owner's netns
+	peerZone  string // IPv6 zone name of the peer address in the owner's netns
 	listening bool
+	inflight  int  // number of SCM_RIGHTS fds queued in the receive queue, or -1
+	rqlen     int  // length of the receive queue, or -1
+	degraded  bool // only the inode number is known, but no further details
+
+	tcpState TCPState // state of a TCP socket, or -1
+	tcpRecvq int      // length of a TCP socket's receive queue, or -1
+	tcpSendq int      // length of a TCP socket's send queue, or -1
+
+	tcpSinceRecv time.Duration // time since a TCP socket last received, or -1
+
+	resolver bool // connected to port 53 of a configured DNS resolver
+
+	peerCred *unix.Ucred // credentials of a connected unix socket's peer, or nil
 }
 
 // NewSocketFd returns a new FileDescriptor for a pipe fd. If there is any
 // problem with determining the plethora of socket parameters and binding, then
 // a nil FileDescriptor is returned instead with the error indication.
 func NewSocketFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newSocketFd(fdNo, base, linkDest, nil)
+}
+
+// newSocketFd implements [NewSocketFd] using the specified discovery options.
+func newSocketFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
 	inoArg := strings.TrimSuffix(strings.TrimPrefix(linkDest, "socket:["), "]")
 	ino, err := strconv.ParseUint(inoArg, 10, 64)
 	if err != nil {
 		return nil, err
 	}
-	filedesc, err := newFiledesc(fdNo, base)
+	filedesc, err := newFiledesc(fdNo, base, o)
 	if err != nil {
 		return nil, err
 	}
@@ -59,40 +80,45 @@ func NewSocketFd(fdNo int, base string, linkDest string) (FileDescriptor, error)
 	// a different process, we first need to clone the other process's fd into
 	// our own fd.
 	useableFd := fdNo
-	if !strings.HasPrefix(base, "/proc/self/") {
-		fields := strings.SplitN(base, "/", 4)
-		if len(fields) < 4 {
+	if !isOwnBase(base) {
+		// The PID is the second to last element of the base path, so we
+		// expect at least a procfs root element in front of it.
+		fields := strings.Split(strings.TrimSuffix(base, "/fd"), "/")
+		if len(fields) < 3 {
 			return nil, errors.New("invalid fd base \"" + base + "\"")
 		}
-		pid, err := strconv.Atoi(fields[2])
+		pid, err := strconv.Atoi(fields[len(fields)-1])
 		if err != nil {
 			return nil, err
 		}
-		pidFd, err := unix.PidfdOpen(pid, 0)
+		if !features().PidfdGetfd {
+			return nil, fmt.Errorf("cannot clone socket fd %d of process %d: %w", fdNo, pid, unix.ENOSYS)
+		}
+		pidFd, err := counted(unix.PidfdOpen(pid, 0))
 		if err != nil {
 			return nil, err
 		}
-		defer unix.Close(pidFd)
-		useableFd, err /* no ":=" */ = unix.PidfdGetfd(pidFd, fdNo, 0)
+		defer closeFd(pidFd)
+		useableFd, err /* no ":=" */ = pidfdGetfd(pidFd, fdNo, 0)
 		if err != nil {
 			return nil, err
 		}
-		defer unix.Close(useableFd)
+		defer closeFd(useableFd)
 	}
 
 	// Get the parameters from the call to socket(domain, type, protocol); we
 	// need to successfully retrieve these.
 	domain, err := getsockoptInt(useableFd, unix.SOL_SOCKET, unix.SO_DOMAIN)
 	if err != nil {
-		return nil, err
+		return nil, restricted("getsockopt", err)
 	}
 	typ, err := getsockoptInt(useableFd, unix.SOL_SOCKET, unix.SO_TYPE)
 	if err != nil {
-		return nil, err
+		return nil, restricted("getsockopt", err)
 	}
 	protocol, err := getsockoptInt(useableFd, unix.SOL_SOCKET, unix.SO_PROTOCOL)
 	if err != nil {
-		return nil, err
+		return nil, restricted("getsockopt", err)
 	}
 
 	// ...oh, and check if it is a listening socket. But this time we accept
@@ -105,6 +131,44 @@ func NewSocketFd(fdNo int, base string, linkDest string) (FileDescriptor, error)
 	local, _ := getsockname(useableFd)
 	peer, _ := getpeername(useableFd)
 
+	// For connected unix domain sockets, get the credentials of their peers.
+	// These credentials are as seen from our own user namespace, so translate
+	// the IDs into the IDs as seen by the owning process. Unconnected sockets
+	// report a zero PID.
+	var peerCred *unix.Ucred
+	if domain == unix.AF_UNIX {
+		cred, err := getsockoptUcred(useableFd, unix.SOL_SOCKET, unix.SO_PEERCRED)
+		if err == nil && cred.Pid != 0 {
+			cred.Uid, cred.Gid = idsInside(strings.TrimSuffix(base, "/fd"), cred.Uid, cred.Gid, o)
+			peerCred = cred
+		}
+	}
+
+	// For unix domain sockets, find out if there are any fds parked
+	// in-flight in the receive queue, passed via SCM_RIGHTS but never
+	// received. Where available, the fdinfo tells us the exact number of such
+	// in-flight fds. Otherwise, we can only hint at a non-empty receive queue
+	// that might contain SCM_RIGHTS messages.
+	inflight, rqlen := -1, -1
+	if domain == unix.AF_UNIX {
+		if info, err := readFdinfo(fdNo, base); err == nil {
+			if scmFds, err := strconv.Atoi(info["scm_fds"]); err == nil {
+				inflight = scmFds
+			}
+		}
+		if qlen, err := unixRecvQueueLen(ino); err == nil {
+			rqlen = qlen
+		}
+	}
+
+	// For TCP sockets, get their state and queue lengths, so that idle
+	// connections can be told apart from busy ones.
+	tcpState, tcpRecvq, tcpSendq, tcpSinceRecv := TCPState(-1), -1, -1, time.Duration(-1)
+	if (domain == unix.AF_INET || domain == unix.AF_INET6) &&
+		typ == unix.SOCK_STREAM && protocol == unix.IPPROTO_TCP {
+		tcpState, tcpRecvq, tcpSendq, tcpSinceRecv, _ = tcpDetails(useableFd)
+	}
+
 	return &SocketFd{
 		filedesc:  filedesc,
 		ino:       ino,
@@ -113,10 +177,53 @@ func NewSocketFd(fdNo int, base string, linkDest string) (FileDescriptor, error)
 		protocol:  SocketProtocol(protocol),
 		local:     Sockaddr{local},
 		peer:      Sockaddr{peer},
+		localZone: zoneName(strings.TrimSuffix(base, "/fd"), local),
+		peerZone:  zoneName(strings.TrimSuffix(base, "/fd"), peer),
 		listening: listening > 0,
+		inflight:  inflight,
+		peerCred:  peerCred,
+		rqlen:     rqlen,
+		tcpState:  tcpState,
+		tcpRecvq:  tcpRecvq,
+		tcpSendq:  tcpSendq,
+
+		tcpSinceRecv: tcpSinceRecv,
 	}, nil
 }
 
+// newDegradedSocketFd returns a new FileDescriptor for a socket fd with only
+// the details procfs offers, that is, the socket's inode number.
+func newDegradedSocketFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	inoArg := strings.TrimSuffix(strings.TrimPrefix(linkDest, "socket:["), "]")
+	ino, err := strconv.ParseUint(inoArg, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	filedesc, err := newFiledesc(fdNo, base, o)
+	if err != nil {
+		return nil, err
+	}
+	return &SocketFd{
+		filedesc: filedesc,
+		ino:      ino,
+		domain:   -1,
+		typ:      -1,
+		protocol: -1,
+		inflight: -1,
+		rqlen:    -1,
+		degraded: true,
+		tcpState: -1,
+		tcpRecvq: -1,
+		tcpSendq: -1,
+
+		tcpSinceRecv: -1,
+	}, nil
+}
+
+// Degraded returns true if only the socket's inode number is known, but no
+// further details, because of missing privileges or kernel support.
+func (s SocketFd) Degraded() bool { return s.degraded }
+
 // Ino returns the socket's inode number.
 func (s SocketFd) Ino() uint64 { return s.ino }
 
@@ -134,6 +241,55 @@ func (s SocketFd) Protocol() int { return int(s.protocol) }
 // Listening returns true if the socket is in listening mode.
 func (s SocketFd) Listening() bool { return s.listening }
 
+// InFlightFds returns the number of fds passed to this unix domain socket via
+// SCM_RIGHTS messages, but not yet received. Fds parked in-flight in a unix
+// socket that never gets read are an invisible, yet real leak. InFlightFds
+// returns -1 if the number is unknown, such as for non-unix sockets or on
+// kernels before 5.6.
+func (s SocketFd) InFlightFds() int { return s.inflight }
+
+// RecvQueueLen returns the length of this unix domain socket's receive queue
+// in bytes, or for a listening socket the number of pending connections.
+// RecvQueueLen returns -1 if the length is unknown, such as for non-unix
+// sockets or for unix sockets in a different network namespace.
+func (s SocketFd) RecvQueueLen() int { return s.rqlen }
+
+// TCPState returns the state of a TCP socket, such as
+// unix.BPF_TCP_ESTABLISHED, or -1 if unknown, such as for non-TCP sockets.
+func (s SocketFd) TCPState() TCPState { return s.tcpState }
+
+// TCPQueues returns the lengths in bytes of the receive and send queues of a
+// TCP socket, or -1 if unknown, such as for non-TCP sockets. For a listening
+// TCP socket, TCPQueues instead returns the number of connections waiting to
+// be accepted and the maximum accept backlog.
+func (s SocketFd) TCPQueues() (recvq int, sendq int) { return s.tcpRecvq, s.tcpSendq }
+
+// TCPSinceLastReceived returns the time since a TCP socket last received data
+// or an ACK from its peer at discovery time, or -1 if unknown, such as for
+// non-TCP sockets. For a socket in CLOSE_WAIT this is the time since the peer
+// hung up.
+func (s SocketFd) TCPSinceLastReceived() time.Duration { return s.tcpSinceRecv }
+
+// HalfClosed returns true if the socket is a TCP socket with only one direction
+// of the connection shut down. This is either the case when the peer hung up
+// but the socket hasn't been closed yet (CLOSE_WAIT), which is the classic
+// “forgot to Close after peer hung up” leak, or when the sending direction of
+// the socket has been shut down, but the peer hasn't hung up yet (FIN_WAIT1 and
+// FIN_WAIT2).
+func (s SocketFd) HalfClosed() bool {
+	switch s.tcpState {
+	case unix.BPF_TCP_CLOSE_WAIT, unix.BPF_TCP_FIN_WAIT1, unix.BPF_TCP_FIN_WAIT2:
+		return true
+	}
+	return false
+}
+
+// Resolver returns true if the socket is connected to port 53 of one of the DNS
+// resolvers configured in [ResolvConfPath], as seen from the root directory of
+// the process owning the socket. cgo and system resolvers tend to keep such
+// sockets around unpredictably.
+func (s SocketFd) Resolver() bool { return s.resolver }
+
 // Description returns a pretty formatted textual description of this socket
 // file descriptor.
 func (s SocketFd) Description(indentation uint) string {
@@ -142,6 +298,12 @@ func (s SocketFd) Description(indentation uint) string {
 
 	buff.WriteString(s.filedesc.Description(indentation))
 
+	if s.degraded {
+		buff.WriteString(newindent)
+		buff.WriteString(fmt.Sprintf("socket, ino %d (further details unavailable)", s.ino))
+		return buff.String()
+	}
+
 	buff.WriteString(newindent)
 	if s.listening {
 		buff.WriteString("listening ")
@@ -155,11 +317,61 @@ func (s SocketFd) Description(indentation uint) string {
 	if s.peer.Sockaddr != nil {
 		buff.WriteString(newindent)
 		buff.WriteString(fmt.Sprintf("peer %q", s.peer.String()))
+		if s.resolver {
+			buff.WriteString(" (DNS resolver)")
+		}
+	}
+
+	if s.peerCred != nil {
+		buff.WriteString(newindent)
+		buff.WriteString(fmt.Sprintf("peer credentials: pid %d, uid %d, gid %d",
+			s.peerCred.Pid, s.peerCred.Uid, s.peerCred.Gid))
+	}
+
+	if s.tcpState >= 0 {
+		buff.WriteString(newindent)
+		if s.tcpState == unix.BPF_TCP_LISTEN {
+			buff.WriteString(fmt.Sprintf("TCP state %s, accept queue %d of %d connections",
+				s.tcpState, s.tcpRecvq, s.tcpSendq))
+		} else {
+			buff.WriteString(fmt.Sprintf("TCP state %s, receive queue %d bytes, send queue %d bytes",
+				s.tcpState, s.tcpRecvq, s.tcpSendq))
+		}
+		switch {
+		case s.tcpState == unix.BPF_TCP_CLOSE_WAIT:
+			buff.WriteString(newindent)
+			buff.WriteString("half-closed: peer hung up, but socket not closed yet")
+			if s.tcpRecvq > 0 {
+				buff.WriteString(fmt.Sprintf(", %d bytes left unread", s.tcpRecvq))
+			}
+		case s.HalfClosed():
+			buff.WriteString(newindent)
+			buff.WriteString("half-closed: sending shut down, waiting for peer to hang up")
+		}
+	}
+
+	switch {
+	case s.inflight > 0:
+		buff.WriteString(newindent)
+		buff.WriteString(fmt.Sprintf("%d fds in-flight via SCM_RIGHTS", s.inflight))
+		if s.rqlen > 0 {
+			buff.WriteString(fmt.Sprintf(", receive queue %d bytes", s.rqlen))
+		}
+	case s.inflight < 0 && s.rqlen > 0 && !s.listening:
+		buff.WriteString(newindent)
+		buff.WriteString(fmt.Sprintf("receive queue %d bytes, might hold in-flight SCM_RIGHTS fds", s.rqlen))
 	}
 
 	return buff.String()
 }
 
+// PeerCred returns the credentials of the peer of a connected unix domain
+// socket, as taken when the peer connected or created the socket pair, or nil
+// if unknown. The user and group IDs are as seen from inside the user
+// namespace of the process owning the socket, whereas the PID is as seen from
+// the PID namespace of the discovering process.
+func (s SocketFd) PeerCred() *unix.Ucred { return s.peerCred }
+
 // Name returns the socket's name (that is, address) in textual format. Call the
 // Addr receiver instead in order to get the socket's unix.Sockaddr.
 func (s SocketFd) Name() string { return s.local.String() }
@@ -181,6 +393,17 @@ func (s SocketFd) Peer() string { return s.peer.String() }
 // *unix.SockaddrUnix or *unix.SockaddrInet, et cetera.
 func (s SocketFd) PeerAddr() unix.Sockaddr { return s.peer.Sockaddr }
 
+// NetAddr returns the socket's name (that is, address) as a net.Addr, such as
+// *net.TCPAddr, *net.UDPAddr, or *net.UnixAddr, or nil if there is no
+// equivalent net.Addr; see also [Sockaddr.NetAddr]. IPv6 zones are returned as
+// the names of the network interfaces in the network namespace of the process
+// owning the socket at discovery time, where known.
+func (s SocketFd) NetAddr() net.Addr { return s.local.netAddr(s.typ, s.localZone) }
+
+// PeerNetAddr returns the socket peer's name (that is, address) as a net.Addr,
+// or nil if the socket isn't connected or there is no equivalent net.Addr.
+func (s SocketFd) PeerNetAddr() net.Addr { return s.peer.netAddr(s.typ, s.peerZone) }
+
 // Equal returns true, if other is a pipeFd with the same fd number and mount
 // ID, as well as the same inode number.
 func (s SocketFd) Equal(other FileDescriptor) bool {
@@ -191,6 +414,6 @@ func (s SocketFd) Equal(other FileDescriptor) bool {
 	return s.filedesc.Equal(&o.filedesc) &&
 		s.ino == o.ino &&
 		s.domain == o.domain && s.typ == o.typ && s.protocol == o.protocol &&
-		s.listening == o.listening &&
-		reflect.DeepEqual(s.local, o.local) && reflect.DeepEqual(s.peer, o.peer)
+		s.listening == o.listening && s.degraded == o.degraded &&
+		s.local.Equal(o.local) && s.peer.Equal(o.peer)
 }
@@ -19,7 +19,9 @@ package filedesc
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"time"
 
 	"golang.org/x/sys/unix"
 
@@ -211,6 +213,177 @@ var _ = Describe("socket descriptors", func() {
 			Expect(fdesc.Equal(nil)).To(BeFalse())
 		})
 
+		It("detects in-flight SCM_RIGHTS fds", func() {
+			fds := Successful(unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+			defer unix.Close(fds[0])
+			defer unix.Close(fds[1])
+
+			fdesc := Successful(New(fds[1])).(*SocketFd)
+			Expect(fdesc.InFlightFds()).To(BeZero())
+			Expect(fdesc.RecvQueueLen()).To(BeZero())
+			Expect(fdesc.Description(0)).NotTo(ContainSubstring("in-flight"))
+
+			Expect(unix.Sendmsg(fds[0], []byte("x"), unix.UnixRights(0), nil, 0)).To(Succeed())
+			fdesc = Successful(New(fds[1])).(*SocketFd)
+			Expect(fdesc.InFlightFds()).To(Equal(1))
+			Expect(fdesc.RecvQueueLen()).To(Equal(1))
+			Expect(fdesc.Description(0)).To(MatchRegexp(
+				`(?m)^\s+1 fds in-flight via SCM_RIGHTS, receive queue 1 bytes$`))
+
+			fdesc.inflight = -1
+			Expect(fdesc.Description(0)).To(MatchRegexp(
+				`(?m)^\s+receive queue 1 bytes, might hold in-flight SCM_RIGHTS fds$`))
+		})
+
+		It("doesn't check non-unix sockets for in-flight fds", func() {
+			fd := Successful(unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0))
+			defer unix.Close(fd)
+			fdesc := Successful(New(fd)).(*SocketFd)
+			Expect(fdesc.InFlightFds()).To(Equal(-1))
+			Expect(fdesc.RecvQueueLen()).To(Equal(-1))
+		})
+
+		It("details TCP connections", func() {
+			l := Successful(net.Listen("tcp", "127.0.0.1:0"))
+			defer l.Close()
+			conn := Successful(net.Dial("tcp", l.Addr().String()))
+			defer conn.Close()
+			sconn := Successful(l.Accept())
+			defer sconn.Close()
+
+			fdesc := Successful(FromConn(conn.(*net.TCPConn))).(*SocketFd)
+			Expect(fdesc.TCPState()).To(Equal(TCPState(unix.BPF_TCP_ESTABLISHED)))
+			Expect(fdesc.TCPQueues()).To(Equal(0))
+			Expect(fdesc.Description(0)).To(MatchRegexp(
+				`(?m)^\s+TCP state ESTABLISHED, receive queue 0 bytes, send queue 0 bytes$`))
+
+			Expect(Successful(sconn.Write([]byte("foo")))).To(Equal(3))
+			Eventually(func() int {
+				recvq, _ := Successful(FromConn(conn.(*net.TCPConn))).(*SocketFd).TCPQueues()
+				return recvq
+			}).Should(Equal(3))
+
+			lfdesc := Successful(FromConn(l.(*net.TCPListener))).(*SocketFd)
+			Expect(lfdesc.TCPState()).To(Equal(TCPState(unix.BPF_TCP_LISTEN)))
+			recvq, sendq := lfdesc.TCPQueues()
+			Expect(recvq).To(BeZero())
+			Expect(sendq).To(BeNumerically(">", 0))
+			pending := Successful(net.Dial("tcp", l.Addr().String()))
+			defer pending.Close()
+			Eventually(func() int {
+				recvq, _ := Successful(FromConn(l.(*net.TCPListener))).(*SocketFd).TCPQueues()
+				return recvq
+			}).Should(Equal(1))
+			Expect(Successful(FromConn(l.(*net.TCPListener))).Description(0)).To(MatchRegexp(
+				`(?m)^\s+TCP state LISTEN, accept queue 1 of \d+ connections$`))
+
+			udp := Successful(unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0))
+			defer unix.Close(udp)
+			udpfd := Successful(New(udp)).(*SocketFd)
+			Expect(udpfd.TCPState()).To(Equal(TCPState(-1)))
+			Expect(udpfd.TCPSinceLastReceived()).To(Equal(time.Duration(-1)))
+			Expect(udpfd.Description(0)).NotTo(ContainSubstring("TCP state"))
+
+			Expect(TCPState(unix.BPF_TCP_LISTEN).String()).To(Equal("LISTEN"))
+			Expect(TCPState(-1).String()).To(Equal("-1"))
+		})
+
+		It("detects half-closed TCP connections", func() {
+			l := Successful(net.Listen("tcp", "127.0.0.1:0"))
+			defer l.Close()
+			conn := Successful(net.Dial("tcp", l.Addr().String()))
+			defer conn.Close()
+			sconn := Successful(l.Accept())
+
+			fdesc := Successful(FromConn(conn.(*net.TCPConn))).(*SocketFd)
+			Expect(fdesc.HalfClosed()).To(BeFalse())
+			Expect(fdesc.Description(0)).NotTo(ContainSubstring("half-closed"))
+
+			Expect(Successful(sconn.Write([]byte("foo")))).To(Equal(3))
+			Expect(sconn.Close()).To(Succeed())
+			Eventually(func() TCPState {
+				return Successful(FromConn(conn.(*net.TCPConn))).(*SocketFd).TCPState()
+			}).Should(Equal(TCPState(unix.BPF_TCP_CLOSE_WAIT)))
+			time.Sleep(100 * time.Millisecond)
+			fdesc = Successful(FromConn(conn.(*net.TCPConn))).(*SocketFd)
+			Expect(fdesc.HalfClosed()).To(BeTrue())
+			Expect(fdesc.TCPSinceLastReceived()).To(BeNumerically(">=", 100*time.Millisecond))
+			Expect(fdesc.Description(0)).To(MatchRegexp(
+				`(?m)^\s+half-closed: peer hung up, but socket not closed yet, 3 bytes left unread$`))
+
+			conn2 := Successful(net.Dial("tcp", l.Addr().String()))
+			defer conn2.Close()
+			sconn2 := Successful(l.Accept())
+			defer sconn2.Close()
+			Expect(conn2.(*net.TCPConn).CloseWrite()).To(Succeed())
+			Eventually(func() TCPState {
+				return Successful(FromConn(conn2.(*net.TCPConn))).(*SocketFd).TCPState()
+			}).Should(Equal(TCPState(unix.BPF_TCP_FIN_WAIT2)))
+			fdesc = Successful(FromConn(conn2.(*net.TCPConn))).(*SocketFd)
+			Expect(fdesc.HalfClosed()).To(BeTrue())
+			Expect(fdesc.Description(0)).To(ContainSubstring(
+				"half-closed: sending shut down, waiting for peer to hang up"))
+		})
+
+		It("reports unknown unix socket inodes", func() {
+			Expect(unixRecvQueueLen(1 << 40)).Error().To(HaveOccurred())
+			Expect(unixRecvQueueLen(1)).Error().To(HaveOccurred())
+		})
+
+		It("recognizes DNS resolver sockets", Serial, func() {
+			resolvconf := GinkgoT().TempDir() + "/resolv.conf"
+			Expect(os.WriteFile(resolvconf, []byte(
+				"# comment\nsearch example.org\nnameserver 127.0.0.1\nnameserver fe80::1%lo\n"),
+				0600)).To(Succeed())
+			oldPath := ResolvConfPath
+			DeferCleanup(func() { ResolvConfPath = oldPath })
+			ResolvConfPath = resolvconf
+
+			Expect(Resolvers()).To(ConsistOf(
+				net.ParseIP("127.0.0.1"), net.ParseIP("fe80::1")))
+
+			conn := Successful(net.Dial("udp", "127.0.0.1:53"))
+			defer conn.Close()
+			other := Successful(net.Dial("udp", "127.0.0.1:54"))
+			defer other.Close()
+
+			sfd := Successful(FromConn(conn.(*net.UDPConn))).(*SocketFd)
+			Expect(sfd.Resolver()).To(BeTrue())
+			Expect(sfd.Description(0)).To(ContainSubstring(`peer "127.0.0.1:53" (DNS resolver)`))
+			Expect(Successful(FromConn(other.(*net.UDPConn))).(*SocketFd).Resolver()).To(BeFalse())
+
+			ResolvConfPath = "/nonexisting"
+			Expect(Resolvers()).Error().To(HaveOccurred())
+			Expect(Successful(FromConn(conn.(*net.UDPConn))).(*SocketFd).Resolver()).To(BeFalse())
+		})
+
+		It("reads the resolver configuration of the owning process only once", Serial, func() {
+			base := GinkgoT().TempDir()
+			Expect(os.MkdirAll(base+"/root/etc", 0o755)).To(Succeed())
+			Expect(os.WriteFile(base+"/root/etc/resolv.conf", []byte("nameserver 127.0.0.1\n"),
+				0600)).To(Succeed())
+			oldPath := ResolvConfPath
+			DeferCleanup(func() { ResolvConfPath = oldPath })
+			ResolvConfPath = "/etc/resolv.conf"
+
+			conn1 := Successful(net.Dial("udp", "127.0.0.1:53"))
+			defer conn1.Close()
+			conn2 := Successful(net.Dial("udp", "127.0.0.1:53"))
+			defer conn2.Close()
+			fds := []FileDescriptor{
+				Successful(FromConn(conn1.(*net.UDPConn))),
+				Successful(FromConn(conn2.(*net.UDPConn))),
+			}
+			for _, fd := range fds {
+				fd.(*SocketFd).resolver = false
+			}
+
+			before := syscalls.Load()
+			markResolverPeers(fds, base+"/fd")
+			Expect(syscalls.Load()-before).To(Equal(uint64(4)), "open, read, read EOF, close")
+			Expect(fds).To(HaveEach(HaveField("Resolver()", BeTrue())))
+		})
+
 		It("understands an AF_INET socket", func() {
 			By("creating an AF_INET socket the hard way")
 			fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
@@ -223,6 +396,8 @@ var _ = Describe("socket descriptors", func() {
 			sfd := fdesc.(*SocketFd)
 			Expect(sfd.Name()).To(Equal("0.0.0.0:0"))
 			Expect(sfd.Peer()).To(Equal(""))
+			Expect(sfd.NetAddr()).To(Equal(&net.UDPAddr{IP: net.IPv4zero.To4()}))
+			Expect(sfd.PeerNetAddr()).To(BeNil())
 			Expect(sfd.Description(0)).To(MatchRegexp(
 				`fd \d+, flags 0x.* \(O_RDWR\)\n\s+socket\(AF_INET, SOCK_DGRAM, IPPROTO_UDP\), ino \d+\n\s+local "0.0.0.0:0"`))
 		})
@@ -21,19 +21,19 @@ import (
 	"fmt"
 	"math"
 	"os"
-	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
+	"testing"
 	"testing/iotest"
-	"time"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/onsi/gomega/gexec"
+	"github.com/thediveo/fdooze/fixtures"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"github.com/thediveo/fdooze/filedesc/test/canary/cage"
 	. "github.com/thediveo/success"
 )
 
@@ -44,23 +44,23 @@ var _ = Describe("file descriptors", func() {
 	When("dealing with a single file descriptor", func() {
 
 		It("returns error when reading errors", func() {
-			Expect(fdFromReader(42, iotest.ErrReader(errors.New("foobar")))).Error().To(
+			Expect(fdFromReader(42, iotest.ErrReader(errors.New("foobar")), false)).Error().To(
 				MatchError("foobar"))
 		})
 
 		It("returns error when reading incomplete information", func() {
-			r := strings.NewReader("pos:\t0\nflags:\t042\n")
-			Expect(fdFromReader(42, r)).Error().To(
+			r := strings.NewReader("pos:\t0\n")
+			Expect(fdFromReader(42, r, true)).Error().To(
 				MatchError(ContainSubstring("incomplete fdinfo data")))
 		})
 
 		It("returns error when reading out-of-range information", func() {
 			r := strings.NewReader(fmt.Sprintf(
 				"pos:\t0\nflags:\t%o\nmnt_id:\t123\n", uint64(math.MaxInt)+1))
-			Expect(fdFromReader(42, r)).Error().To(
+			Expect(fdFromReader(42, r, true)).Error().To(
 				MatchError(ContainSubstring("flags outside range:")))
 			r = strings.NewReader("pos:\t0\nflags:\t042\nmnt_id:\t-1\n")
-			Expect(fdFromReader(42, r)).Error().To(
+			Expect(fdFromReader(42, r, true)).Error().To(
 				MatchError(ContainSubstring("mnt_id outside range:")))
 		})
 
@@ -70,12 +70,28 @@ var _ = Describe("file descriptors", func() {
 
 		It("reads and returns common fd information", func() {
 			r := strings.NewReader("pos:\t0\nflags:\t042\nmnt_id:\t123\n")
-			fdesc := Successful(fdFromReader(42, r))
+			fdesc := Successful(fdFromReader(42, r, false))
 			Expect(fdesc.FdNo()).To(Equal(42))
 			Expect(fdesc.Flags()).To(Equal(Flags(042)))
 			Expect(fdesc.MountId()).To(Equal(123))
 		})
 
+		It("retains raw fdinfo only when enabled", func() {
+			fd := Successful(unix.Eventfd(42, unix.EFD_CLOEXEC))
+			defer unix.Close(fd)
+
+			Expect(Successful(newFiledesc(fd, procFdBase, nil)).RawFdinfo()).To(BeNil())
+
+			raw := newDiscoveryOptions([]DiscoveryOption{WithRawFdinfo()})
+			fdesc := Successful(newFiledesc(fd, procFdBase, raw))
+			Expect(fdesc.RawFdinfo()).To(HaveKeyWithValue("eventfd-count", MatchRegexp(`^0*2a$`)))
+			Expect(fdesc.RawFdinfo()).To(HaveKey("mnt_id"))
+			Expect(FiledescriptorsWith(OnlyFdRange(fd, fd), WithRawFdinfo())).To(ConsistOf(
+				WithTransform(func(fd FileDescriptor) map[string]string {
+					return fd.(*EventfdFd).RawFdinfo()
+				}, HaveKey("eventfd-count"))))
+		})
+
 		It("returns a correct description", func() {
 			fdesc := filedesc{
 				fdNo:  42,
@@ -87,21 +103,83 @@ var _ = Describe("file descriptors", func() {
 		})
 
 		It("doesn't fail to read information about fd 0", func() {
-			fdesc := Successful(newFiledesc(0, procFdBase))
+			fdesc := Successful(newFiledesc(0, procFdBase, nil))
 			Expect(fdesc.fdNo).To(Equal(0))
 			Expect(fdesc.mntId).NotTo(BeZero())
 		})
 
 		It("fails correctly to read invalid fd information", func() {
 			r := strings.NewReader("pos:\t0\nflags:\t099\nmnt_id:\t123\n")
-			Expect(fdFromReader(0, r)).Error().To(MatchError(MatchRegexp("invalid syntax")))
+			Expect(fdFromReader(0, r, true)).Error().To(MatchError(MatchRegexp("invalid syntax")))
 
 			r = strings.NewReader("pos:\t0\nflags:\t042\nmnt_id:\tabc\n")
-			Expect(fdFromReader(0, r)).Error().To(MatchError(MatchRegexp("invalid syntax")))
+			Expect(fdFromReader(0, r, true)).Error().To(MatchError(MatchRegexp("invalid syntax")))
+		})
+
+		It("fails strictly on unknown fdinfo lines", func() {
+			r := strings.NewReader("pos:\t0\nfoo:\tbar\nflags:\t042\nmnt_id:\t123\n")
+			Expect(fdFromReader(0, r, true)).Error().To(MatchError(ContainSubstring(`unknown fdinfo line "foo:\tbar"`)))
+		})
+
+		It("parses leniently, collecting warnings", func() {
+			fdesc := Successful(fdFromReader(42, strings.NewReader("pos:\t0\nflags:\t042\nmnt_id:\t123\n"), false))
+			Expect(fdesc.ParseWarnings()).To(BeNil())
+
+			fdesc = Successful(fdFromReader(42, strings.NewReader(
+				"pos:\t0\nfoo:\tbar\nflags:\t099\nmnt_id:\t-1\n"), false))
+			Expect(fdesc.FdNo()).To(Equal(42))
+			Expect(fdesc.Flags()).To(BeZero())
+			Expect(fdesc.MountId()).To(BeZero())
+			Expect(fdesc.ParseWarnings()).To(HaveExactElements(
+				ContainSubstring("unknown fdinfo line"),
+				ContainSubstring("invalid syntax"),
+				ContainSubstring("mnt_id outside range: -1")))
+
+			fdesc = Successful(fdFromReader(42, strings.NewReader("pos:\t0\n"), false))
+			Expect(fdesc.ParseWarnings()).To(ConsistOf(ContainSubstring("incomplete fdinfo data")))
+
+			fdesc = Successful(fdFromReader(42, strings.NewReader("pos:\t1234\nflags:\t042\nmnt_id:\t123\n"), false))
+			Expect(fdesc.Pos()).To(Equal(int64(1234)))
+			fdesc = Successful(fdFromReader(42, strings.NewReader("pos:\tabc\nflags:\t042\nmnt_id:\t123\n"), false))
+			Expect(fdesc.Pos()).To(BeZero())
+			Expect(fdesc.ParseWarnings()).To(ConsistOf(ContainSubstring("invalid syntax")))
+
+			Expect(fdFromReader(42, iotest.ErrReader(errors.New("foobar")), false)).Error().To(
+				MatchError("foobar"))
+		})
+
+		It("accepts missing mount IDs as unknown only on old kernels", Serial, func() {
+			DeferCleanup(func(old func() KernelFeatures) { features = old }, features)
+			features = func() KernelFeatures { return KernelFeatures{FdinfoMntID: true} }
+			fdesc := Successful(fdFromReader(42, strings.NewReader("pos:\t0\nflags:\t042\n"), false))
+			Expect(fdesc.Flags()).To(Equal(Flags(042)))
+			Expect(fdesc.ParseWarnings()).To(ConsistOf(ContainSubstring("missing mnt_id")))
+			Expect(fdFromReader(42, strings.NewReader("pos:\t0\nflags:\t042\n"), true)).Error().To(
+				MatchError(ContainSubstring("missing mnt_id")))
+
+			features = func() KernelFeatures { return KernelFeatures{} }
+			fdesc = Successful(fdFromReader(42, strings.NewReader("pos:\t0\nflags:\t042\n"), false))
+			Expect(fdesc.Flags()).To(Equal(Flags(042)))
+			Expect(fdesc.MountId()).To(BeZero())
+		})
+
+		It("accepts zero mount IDs as unknown", func() {
+			fdesc := Successful(fdFromReader(42, strings.NewReader("pos:\t0\nflags:\t042\nmnt_id:\t0\n"), true))
+			Expect(fdesc.MountId()).To(BeZero())
+			Expect(fdesc.ParseWarnings()).To(BeNil())
+
+			Expect(fdesc.Equal(&filedesc{fdNo: 42, mntId: 123})).To(BeTrue())
+			Expect((&filedesc{fdNo: 42, mntId: 123}).Equal(&fdesc)).To(BeTrue())
+			Expect((&filedesc{fdNo: 42, mntId: 666}).Equal(&filedesc{fdNo: 42, mntId: 123})).To(BeFalse())
+			Expect(fdesc.Equal(&filedesc{fdNo: 1})).To(BeFalse())
+
+			p := PathFd{filedesc: filedesc{fdNo: 42}, path: "/foo"}
+			Expect(p.Equal(&PathFd{filedesc: filedesc{fdNo: 42, mntId: 123}, path: "/foo"})).To(BeTrue())
+			Expect(p.Equal(&PathFd{filedesc: filedesc{fdNo: 42, mntId: 123}, path: "/bar"})).To(BeFalse())
 		})
 
 		It("fails correctly to read from fd -1", func() {
-			Expect(newFiledesc(-1, procFdBase)).Error().To(MatchError(MatchRegexp("open.*/proc/self/fdinfo/-1")))
+			Expect(newFiledesc(-1, procFdBase, nil)).Error().To(MatchError(MatchRegexp("open.*/proc/self/fdinfo/-1")))
 		})
 
 	})
@@ -123,6 +201,31 @@ var _ = Describe("file descriptors", func() {
 			Expect(fdescs).To(ContainElement(HaveField("FdNo()", fd)))
 		})
 
+		It("lists fd numbers", func() {
+			fdNos := Successful(FdNumbers())
+			Expect(fdNos).To(ContainElements(0, 1, 2))
+			Expect(slices.IsSorted(fdNos)).To(BeTrue())
+			fds := Filedescriptors()
+			Expect(fdNos).To(HaveLen(len(fds)))
+			for idx, fd := range fds {
+				Expect(fdNos[idx]).To(Equal(fd.FdNo()))
+			}
+		})
+
+		It("counts fd numbers", func() {
+			fdNos := Successful(FdNumbers())
+			Expect(Successful(ProcessFdNumbers(os.Getpid()))).To(Equal(fdNos))
+			Expect(CountFds(os.Getpid())).To(Equal(len(fdNos)))
+
+			fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+			defer unix.Close(fd)
+			Expect(CountFds(os.Getpid())).To(Equal(len(fdNos) + 1))
+
+			count, err := CountFds(-1)
+			Expect(err).To(HaveOccurred())
+			Expect(count).To(BeZero())
+		})
+
 		It("doesn't include its own fd directory fd", func() {
 			const dirPath = "/proc/self/fd"
 
@@ -151,23 +254,36 @@ var _ = Describe("file descriptors", func() {
 	})
 
 	It("discovers fds from another process", func() {
-		canaryPath := Successful(
-			gexec.Build("github.com/thediveo/fdooze/filedesc/test/canary"))
+		const canaryPeer = "1.2.34.56:12345"
+
+		canaryPath := Successful(fixtures.Build())
 		DeferCleanup(gexec.CleanupBuildArtifacts)
-		canaryCmd := exec.Command(canaryPath)
-		session := Successful(
-			gexec.Start(canaryCmd, GinkgoWriter, GinkgoWriter))
-		defer session.Terminate()
-
-		Eventually(func() []FileDescriptor {
-			fds, _ := ProcessFiledescriptors(session.Command.Process.Pid)
-			return fds
-		}).Within(2 * time.Second).ProbeEvery(250 * time.Millisecond).Should(
+		canary := Successful(fixtures.Start(canaryPath,
+			fixtures.Spec{UDPSockets: 1, UDPPeer: canaryPeer}, GinkgoWriter, GinkgoWriter))
+		defer canary.Stop()
+		Expect(canary.Leak()).To(Succeed())
+
+		Expect(ProcessFiledescriptors(canary.PID())).To(
 			ContainElement(SatisfyAll(
 				BeAssignableToTypeOf(&SocketFd{}),
 				HaveField("Type()", unix.SOCK_DGRAM),
-				HaveField("Peer()", fmt.Sprintf("%s:%d", cage.IP, cage.Port)),
+				HaveField("Peer()", canaryPeer),
 			)))
 	})
 
 })
+
+func FuzzFdFromReader(f *testing.F) {
+	f.Add("pos:\t0\nflags:\t02\nmnt_id:\t42\nino:\t1234\n")
+	f.Add("pos:\t0\nflags:\t099\nmnt_id:\t-1\n")
+	f.Add("flags:\n")
+	f.Fuzz(func(t *testing.T, fdinfo string) {
+		fdesc, err := fdFromReader(42, strings.NewReader(fdinfo), false)
+		if err != nil && !strings.Contains(err.Error(), "token too long") {
+			t.Fatalf("lenient parsing failed: %v", err)
+		}
+		if err == nil && fdesc.FdNo() != 42 {
+			t.Fatalf("wrong fd number %d", fdesc.FdNo())
+		}
+	})
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TimerfdFd implements FileDescriptor for an fd referencing a timerfd, that
+// is, an anonymous inode of “file” type “timerfd”, as created by
+// timerfd_create(2). In addition to the generic anonymous inode information, it
+// details the timer's clock, its current setting, and the number of
+// expirations not yet read, as of discovery time.
+type TimerfdFd struct {
+	AnonInodeFd
+	clockID  int           // clock ID, such as unix.CLOCK_MONOTONIC.
+	value    time.Duration // time until next expiration; zero if disarmed.
+	interval time.Duration // interval of periodic timers; zero for one-shot timers.
+	ticks    uint64        // number of expirations not yet read.
+}
+
+// NewTimerfdFd returns a new FileDescriptor for an fd referencing a timerfd.
+func NewTimerfdFd(fdNo int, base string, linkDest string) (FileDescriptor, error) {
+	return newTimerfdFd(fdNo, base, linkDest, nil)
+}
+
+// newTimerfdFd implements [NewTimerfdFd] using the specified discovery options.
+func newTimerfdFd(fdNo int, base string, linkDest string, o *discoveryOptions) (FileDescriptor, error) {
+	filedesc, err := newFiledesc(fdNo, base, o)
+	if err != nil {
+		return nil, err
+	}
+	t := &TimerfdFd{
+		AnonInodeFd: AnonInodeFd{
+			filedesc: filedesc,
+			ftype:    strings.Trim(linkDest[len(anonInodePrefix):], "[]"),
+		},
+		clockID: -1,
+	}
+	if info, err := readFdinfo(fdNo, base); err == nil {
+		t.timerFromFdinfo(info)
+	}
+	return t, nil
+}
+
+// ClockID returns the ID of the clock the timer is based on, such as
+// unix.CLOCK_MONOTONIC, or -1 if unknown.
+func (t TimerfdFd) ClockID() int { return t.clockID }
+
+// Value returns the time until the next expiration of the timer at discovery
+// time, or zero if the timer is disarmed.
+func (t TimerfdFd) Value() time.Duration { return t.value }
+
+// Interval returns the interval of a periodic timer, or zero for a one-shot
+// timer.
+func (t TimerfdFd) Interval() time.Duration { return t.interval }
+
+// Armed returns true if the timer was armed at discovery time, that is, it has
+// a non-zero timer value. Such a timerfd will fire, so its leak is more severe
+// than that of a disarmed timerfd.
+func (t TimerfdFd) Armed() bool { return t.value != 0 }
+
+// Ticks returns the number of timer expirations that haven't been read yet at
+// discovery time.
+func (t TimerfdFd) Ticks() uint64 { return t.ticks }
+
+// timerFromFdinfo sets the clock ID, timer setting, and ticks from the
+// specified timerfd fdinfo, skipping missing or malformed fields.
+func (t *TimerfdFd) timerFromFdinfo(info map[string]string) {
+	if clockID, err := strconv.Atoi(info["clockid"]); err == nil {
+		t.clockID = clockID
+	}
+	t.value, _ = parseTimespec(info["it_value"])
+	t.interval, _ = parseTimespec(info["it_interval"])
+	t.ticks, _ = strconv.ParseUint(info["ticks"], 10, 64)
+}
+
+// parseTimespec returns the duration of a timespec in the fdinfo format
+// “(sec, nsec)”.
+func parseTimespec(s string) (time.Duration, error) {
+	sec, nsec, ok := strings.Cut(strings.Trim(s, "()"), ",")
+	if !ok {
+		return 0, fmt.Errorf("invalid timespec %q", s)
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(sec), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timespec %q", s)
+	}
+	nsecs, err := strconv.ParseInt(strings.TrimSpace(nsec), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timespec %q", s)
+	}
+	return time.Duration(secs)*time.Second + time.Duration(nsecs), nil
+}
+
+// Description returns a pretty formatted multi-line textual description
+// detailing the fd number, flags, and “file type” of anonymous node, as well as
+// the timer's clock, setting, and unread expirations. Armed timerfds are called
+// out.
+func (t TimerfdFd) Description(indentation uint) string {
+	indent := Indentation(indentation + 1) // further details are always indented further
+	desc := t.AnonInodeFd.Description(indentation)
+	if t.Armed() {
+		desc += fmt.Sprintf("\n%sarmed: will fire or wake up waiters", indent)
+	}
+	desc += fmt.Sprintf("\n%sclock: %s", indent, clockName(t.clockID))
+	if t.value != 0 {
+		desc += fmt.Sprintf("\n%snext expiration in: %s", indent, t.value)
+	} else {
+		desc += fmt.Sprintf("\n%sdisarmed", indent)
+	}
+	if t.interval != 0 {
+		desc += fmt.Sprintf("\n%sinterval: %s", indent, t.interval)
+	}
+	if t.ticks != 0 {
+		desc += fmt.Sprintf("\n%sunread expirations: %d", indent, t.ticks)
+	}
+	return desc
+}
+
+// clockName returns the symbolic name of the specified clock ID, falling back
+// to the plain number for unknown clock IDs.
+func clockName(clockID int) string {
+	if name, ok := clockNames[clockID]; ok {
+		return name
+	}
+	return strconv.Itoa(clockID)
+}
+
+// clockNames maps the clock IDs supported by timerfds to their symbolic names.
+var clockNames = map[int]string{
+	unix.CLOCK_REALTIME:       "CLOCK_REALTIME",
+	unix.CLOCK_MONOTONIC:      "CLOCK_MONOTONIC",
+	unix.CLOCK_BOOTTIME:       "CLOCK_BOOTTIME",
+	unix.CLOCK_REALTIME_ALARM: "CLOCK_REALTIME_ALARM",
+	unix.CLOCK_BOOTTIME_ALARM: "CLOCK_BOOTTIME_ALARM",
+}
+
+// Equal returns true, if other is also a timerfd with the same fd number (and
+// mount ID). The timer settings are not taken into consideration, as they
+// change over the lifetime of a timerfd.
+func (t TimerfdFd) Equal(other FileDescriptor) bool {
+	o, ok := other.(*TimerfdFd)
+	if !ok {
+		return false
+	}
+	return t.AnonInodeFd.filedesc.Equal(&o.AnonInodeFd.filedesc) &&
+		t.ftype == o.ftype
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("timerfd fd", func() {
+
+	const fakeBase = "/proc/fake/fd"
+
+	It("correctly fails for invalid fd number", func() {
+		Expect(NewTimerfdFd(-1, fakeBase, "anon_inode:[timerfd]")).Error().
+			To(HaveOccurred())
+	})
+
+	It("returns the clock, setting, and ticks", func() {
+		tfd := Successful(unix.TimerfdCreate(unix.CLOCK_MONOTONIC, unix.TFD_CLOEXEC))
+		defer unix.Close(tfd)
+
+		fdesc := Successful(New(tfd))
+		Expect(fdesc).To(BeAssignableToTypeOf(&TimerfdFd{}))
+		timerfd := fdesc.(*TimerfdFd)
+		Expect(timerfd.FileType()).To(Equal("timerfd"))
+		Expect(timerfd.ClockID()).To(Equal(unix.CLOCK_MONOTONIC))
+		Expect(timerfd.Value()).To(BeZero())
+		Expect(timerfd.Interval()).To(BeZero())
+		Expect(timerfd.Ticks()).To(BeZero())
+		Expect(timerfd.Description(0)).To(MatchRegexp(`\n\s+clock: CLOCK_MONOTONIC\n\s+disarmed$`))
+
+		Expect(unix.TimerfdSettime(tfd, 0, &unix.ItimerSpec{
+			Value:    unix.Timespec{Sec: 3600},
+			Interval: unix.Timespec{Sec: 42},
+		}, nil)).To(Succeed())
+		timerfd = Successful(New(tfd)).(*TimerfdFd)
+		Expect(timerfd.Value()).To(And(
+			BeNumerically(">", 3599*time.Second), BeNumerically("<=", 3600*time.Second)))
+		Expect(timerfd.Interval()).To(Equal(42 * time.Second))
+		Expect(timerfd.Description(0)).To(MatchRegexp(
+			`\n\s+armed: will fire or wake up waiters\n\s+clock: CLOCK_MONOTONIC\n\s+next expiration in: 59m59\.\d+s\n\s+interval: 42s$`))
+
+		Expect(unix.TimerfdSettime(tfd, 0, &unix.ItimerSpec{
+			Value:    unix.Timespec{Nsec: 1},
+			Interval: unix.Timespec{Sec: 3600},
+		}, nil)).To(Succeed())
+		Eventually(func() uint64 {
+			return Successful(New(tfd)).(*TimerfdFd).Ticks()
+		}).Should(Equal(uint64(1)))
+		Expect(Successful(New(tfd)).Description(0)).To(ContainSubstring("unread expirations: 1"))
+	})
+
+	It("parses timespecs", func() {
+		Expect(parseTimespec("(0, 0)")).To(BeZero())
+		Expect(parseTimespec("(3599, 999997745)")).To(Equal(3599*time.Second + 999997745))
+		Expect(parseTimespec("")).Error().To(HaveOccurred())
+		Expect(parseTimespec("(foo, 0)")).Error().To(HaveOccurred())
+		Expect(parseTimespec("(0, bar)")).Error().To(HaveOccurred())
+	})
+
+	It("names clocks", func() {
+		Expect(clockName(unix.CLOCK_BOOTTIME)).To(Equal("CLOCK_BOOTTIME"))
+		Expect(clockName(666)).To(Equal("666"))
+	})
+
+	It("determines equality correctly", func() {
+		tfd := Successful(unix.TimerfdCreate(unix.CLOCK_MONOTONIC, unix.TFD_CLOEXEC))
+		defer unix.Close(tfd)
+
+		fdesc := Successful(New(tfd))
+		Expect(fdesc.Equal(nil)).To(BeFalse())
+		Expect(fdesc.Equal(fdesc)).To(BeTrue())
+		Expect(fdesc.Equal(&fdesc.(*TimerfdFd).AnonInodeFd)).To(BeFalse())
+		Expect(fdesc.Equal(Successful(New(0)))).To(BeFalse())
+	})
+
+})
@@ -0,0 +1,139 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// KernelFeatures describes the kernel features fd discovery picks its
+// codepaths by, as probed once at runtime by [Features]. This way, discovery
+// works gracefully from ancient 4.x kernels to the bleeding edge, skipping
+// unsupported enrichment steps upfront instead of tolerating their failures.
+type KernelFeatures struct {
+	Release     string // kernel release, such as "6.1.0-18-amd64".
+	Major       int    // kernel major version, or 0 if unknown.
+	Minor       int    // kernel minor version.
+	Statx       bool   // statx(2) is supported (4.11+).
+	PidfdGetfd  bool   // pidfd_getfd(2) is supported (5.6+) and permitted.
+	FdinfoMntID bool   // fdinfo contains mnt_id lines (3.15+).
+	StatxMntID  bool   // statx(2) returns mount IDs (5.8+).
+	ThreadSelf  bool   // procfs has a thread-self directory (3.17+).
+}
+
+// Features returns the kernel features of the current environment, probing
+// them only on first call.
+func Features() KernelFeatures { return features() }
+
+// features probes the kernel features only once; tests might replace it in
+// order to simulate older kernels.
+var features = sync.OnceValue(probeFeatures)
+
+// AtLeast returns true if the kernel version is at least the specified
+// major.minor version.
+func (f KernelFeatures) AtLeast(major, minor int) bool {
+	return f.Major > major || (f.Major == major && f.Minor >= minor)
+}
+
+// Description returns a pretty formatted single-line textual description of
+// the kernel features.
+func (f KernelFeatures) Description(indentation uint) string {
+	var features []string
+	for _, feature := range []struct {
+		name      string
+		available bool
+	}{
+		{"statx", f.Statx},
+		{"pidfd_getfd", f.PidfdGetfd},
+		{"fdinfo mnt_id", f.FdinfoMntID},
+		{"statx mnt_id", f.StatxMntID},
+		{"thread-self", f.ThreadSelf},
+	} {
+		if feature.available {
+			features = append(features, feature.name)
+		}
+	}
+	return fmt.Sprintf("%skernel %d.%d (%s), features: %s",
+		Indentation(indentation), f.Major, f.Minor, f.Release, strings.Join(features, ", "))
+}
+
+// probeFeatures probes the kernel version and features of the current
+// environment.
+func probeFeatures() KernelFeatures {
+	f := KernelFeatures{}
+	var uname unix.Utsname
+	if unix.Uname(&uname) == nil {
+		f.Release = unix.ByteSliceToString(uname.Release[:])
+		f.Major, f.Minor = parseKernelVersion(f.Release)
+	}
+
+	var stx unix.Statx_t
+	f.Statx = unix.Statx(unix.AT_FDCWD, "/", unix.AT_STATX_DONT_SYNC, unix.STATX_INO, &stx) == nil
+	_, err := os.Lstat(procThreadSelfPath())
+	f.ThreadSelf = err == nil
+
+	// Use a pipe as a well-known fd to probe with.
+	var pipefds [2]int
+	if unix.Pipe2(pipefds[:], unix.O_CLOEXEC) != nil {
+		return f
+	}
+	defer unix.Close(pipefds[0])
+	defer unix.Close(pipefds[1])
+	if info, err := readFdinfo(pipefds[0], procSelfPath()+"/fd"); err == nil {
+		_, f.FdinfoMntID = info["mnt_id"]
+	}
+	if f.Statx && unix.Statx(pipefds[0], "", unix.AT_EMPTY_PATH|unix.AT_STATX_DONT_SYNC, unix.STATX_MNT_ID, &stx) == nil {
+		f.StatxMntID = stx.Mask&unix.STATX_MNT_ID != 0
+	}
+	if pidFd, err := unix.PidfdOpen(os.Getpid(), 0); err == nil {
+		if fd, err := unix.PidfdGetfd(pidFd, pipefds[0], 0); err == nil {
+			f.PidfdGetfd = true
+			unix.Close(fd)
+		}
+		unix.Close(pidFd)
+	}
+	return f
+}
+
+// parseKernelVersion returns the major and minor version from the specified
+// kernel release, such as "6.1.0-18-amd64", or zeros if the release cannot be
+// parsed.
+func parseKernelVersion(release string) (major, minor int) {
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return 0, 0
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0
+	}
+	minorArg := fields[1]
+	if end := strings.IndexFunc(minorArg, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		minorArg = minorArg[:end]
+	}
+	minor, err = strconv.Atoi(minorArg)
+	if err != nil {
+		return 0, 0
+	}
+	return major, minor
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("kernel features", func() {
+
+	DescribeTable("parses kernel versions",
+		func(release string, major, minor int) {
+			maj, min := parseKernelVersion(release)
+			Expect(maj).To(Equal(major))
+			Expect(min).To(Equal(minor))
+		},
+		Entry(nil, "6.1.0-18-amd64", 6, 1),
+		Entry(nil, "4.19.0", 4, 19),
+		Entry(nil, "5.15-rc1", 5, 15),
+		Entry(nil, "6.18.44-fc-v130", 6, 18),
+		Entry(nil, "6", 0, 0),
+		Entry(nil, "x.1", 0, 0),
+		Entry(nil, "6.x", 0, 0),
+	)
+
+	It("compares kernel versions", func() {
+		f := KernelFeatures{Major: 5, Minor: 6}
+		Expect(f.AtLeast(4, 19)).To(BeTrue())
+		Expect(f.AtLeast(5, 6)).To(BeTrue())
+		Expect(f.AtLeast(5, 7)).To(BeFalse())
+		Expect(f.AtLeast(6, 0)).To(BeFalse())
+	})
+
+	It("probes the current kernel", func() {
+		f := Features()
+		Expect(f).To(Equal(Features()))
+		Expect(f.Major).NotTo(BeZero())
+		Expect(f.Statx).To(BeTrue())
+		Expect(f.FdinfoMntID).To(BeTrue())
+		Expect(f.ThreadSelf).To(BeTrue())
+		Expect(f.Description(1)).To(MatchRegexp(`^    kernel \d+\.\d+ \(.+\), features: statx`))
+	})
+
+	It("skips unsupported enrichment steps", Serial, func() {
+		DeferCleanup(func(old func() KernelFeatures) { features = old }, features)
+		features = func() KernelFeatures { return KernelFeatures{} }
+
+		f := Successful(os.Open("features_test.go"))
+		defer f.Close()
+		fdesc := Successful(New(int(f.Fd()))).(*PathFd)
+		Expect(fdesc.Ino()).To(BeZero())
+
+		sfd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		defer unix.Close(sfd)
+		_, report, err := ProcessFiledescriptorsWithReport(os.Getpid())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Skipped).To(ContainElement(And(
+			HaveField("FdNo", sfd),
+			HaveField("Err", MatchError(unix.ENOSYS)))))
+	})
+
+})
@@ -0,0 +1,55 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// FromFile returns a FileDescriptor for the fd underlying the specified
+// *os.File. An error is returned if the file is nil, already closed, or its
+// fd details cannot be discovered.
+func FromFile(f *os.File) (FileDescriptor, error) {
+	if f == nil {
+		return nil, errors.New("FromFile: nil file")
+	}
+	return FromConn(f)
+}
+
+// FromConn returns a FileDescriptor for the fd underlying the specified
+// syscall.Conn, such as a *net.TCPConn, *net.UnixListener, et cetera. The raw
+// fd is only accessed from inside [syscall.RawConn.Control] so that it cannot
+// be closed by someone else while we're discovering its details.
+func FromConn(conn syscall.Conn) (FileDescriptor, error) {
+	if conn == nil {
+		return nil, errors.New("FromConn: nil connection")
+	}
+	rawconn, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var fdesc FileDescriptor
+	var fdescErr error
+	if err := rawconn.Control(func(fd uintptr) {
+		fdesc, fdescErr = New(int(fd))
+	}); err != nil {
+		return nil, err
+	}
+	return fdesc, fdescErr
+}
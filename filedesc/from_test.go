@@ -0,0 +1,59 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"net"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("adopting application-level objects", func() {
+
+	It("rejects nil files and connections", func() {
+		Expect(FromFile(nil)).Error().To(HaveOccurred())
+		Expect(FromConn(nil)).Error().To(HaveOccurred())
+	})
+
+	It("rejects closed files", func() {
+		f := Successful(os.Open("from_test.go"))
+		f.Close()
+		Expect(FromFile(f)).Error().To(HaveOccurred())
+	})
+
+	It("returns the fd details of an os.File", func() {
+		f := Successful(os.Open("from_test.go"))
+		defer f.Close()
+		fdesc := Successful(FromFile(f))
+		Expect(fdesc).To(BeAssignableToTypeOf(&PathFd{}))
+		Expect(fdesc.FdNo()).To(Equal(int(f.Fd())))
+		Expect(fdesc).To(HaveField("Path()", HaveSuffix("/filedesc/from_test.go")))
+	})
+
+	It("returns the fd details of a net.Conn", func() {
+		l := Successful(net.Listen("tcp", "127.0.0.1:0"))
+		defer l.Close()
+		fdesc := Successful(FromConn(l.(*net.TCPListener)))
+		Expect(fdesc).To(BeAssignableToTypeOf(&SocketFd{}))
+		Expect(fdesc).To(HaveField("Listening()", BeTrue()))
+		Expect(fdesc).To(HaveField("Name()", l.Addr().String()))
+	})
+
+})
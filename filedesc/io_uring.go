@@ -0,0 +1,185 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// RegisteredFile is a file registered with an io_uring instance, as listed in
+// the fdinfo of the io_uring fd.
+type RegisteredFile struct {
+	Index int    // index into the registered file table.
+	Path  string // path of the registered file, such as "/tmp/foo" or "pipe:[1234]".
+	Dev   uint64 // device of a registered file system path, or 0 if unknown.
+	Ino   uint64 // inode number of a registered file system path, or 0 if unknown.
+}
+
+// ioUringRegisteredFiles returns the registered files of the io_uring fd with
+// the specified fd number. As the fdinfo lists only the paths of the registered
+// files, the device and inode numbers of registered file system paths are
+// determined by stat'ing the paths as seen from the root directory of the
+// process owning the io_uring fd, subject to the specified timeout.
+//
+// Please note that the kernel lists the registered files only if it can lock
+// the ring at the time of reading its fdinfo, so the list might come up empty
+// for busy rings.
+func ioUringRegisteredFiles(fdNo int, base string, timeout time.Duration) ([]RegisteredFile, error) {
+	file, err := openFile(fmt.Sprintf("%sinfo/%d", base, fdNo))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	files, err := registeredFilesFromScanner(bufio.NewScanner(file))
+	if err != nil {
+		return nil, err
+	}
+	root := strings.TrimSuffix(base, "/fd") + "/root"
+	for idx := range files {
+		if !strings.HasPrefix(files[idx].Path, "/") {
+			continue
+		}
+		if stx, err := statxTimeout(root+files[idx].Path, 0, unix.STATX_INO, timeout); err == nil {
+			files[idx].Dev, files[idx].Ino = unix.Mkdev(stx.Dev_major, stx.Dev_minor), stx.Ino
+		}
+	}
+	return files, nil
+}
+
+// registeredFilesFromScanner returns the registered files from the io_uring
+// fdinfo lines read by the specified scanner. The registered files are listed
+// as “INDEX: PATH” lines following the “UserFiles:” line.
+func registeredFilesFromScanner(scanner *bufio.Scanner) ([]RegisteredFile, error) {
+	var files []RegisteredFile
+	inUserFiles := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !inUserFiles {
+			inUserFiles = strings.HasPrefix(line, "UserFiles:")
+			continue
+		}
+		indexArg, path, ok := strings.Cut(strings.TrimLeft(line, " "), ": ")
+		if !ok {
+			break
+		}
+		index, err := strconv.Atoi(indexArg)
+		if err != nil {
+			break
+		}
+		files = append(files, RegisteredFile{Index: index, Path: unescapeMountinfo(path)})
+	}
+	return files, scanner.Err()
+}
+
+// StaleRegisteredFiles returns the files registered with the specified io_uring
+// fd that don't correspond to any of the specified open file descriptors of
+// the same process anymore. This catches the subtle case of an fd that has
+// been closed, but remains registered with a ring, keeping its file open.
+//
+// As the kernel lists only the paths of registered files, a registered file
+// corresponds to an open fd only if the fd has the same link destination as
+// the registered file, and additionally the same device and inode numbers in
+// case of a registered file system path. Thus, the same file opened via a
+// different path, such as a hard link or bind mount, doesn't count, and neither
+// does a different file created in place of a deleted registered file. As both
+// ends of a pipe share the same inode, a registered pipe end isn't stale as
+// long as any end of the pipe is still open.
+//
+// Please note that a registered file can't be told apart from the same file
+// opened anew via the same path, as the kernel doesn't reveal which open file
+// description got registered.
+func StaleRegisteredFiles(ring *IoUringFd, fds []FileDescriptor) []RegisteredFile {
+	type identity struct {
+		linkDest string
+		dev, ino uint64
+	}
+	open := map[string]struct{}{}
+	openFiles := map[identity]struct{}{}
+	for _, fd := range fds {
+		if owner, ok := fd.(interface{ PID() int }); !ok || owner.PID() != ring.PID() {
+			continue
+		}
+		linkDest := linkDestOf(fd)
+		open[linkDest] = struct{}{}
+		if pfd := pathFdOf(fd); pfd != nil && pfd.ino != 0 {
+			openFiles[identity{linkDest, pfd.dev, pfd.ino}] = struct{}{}
+		}
+	}
+	var stale []RegisteredFile
+	for _, registered := range ring.registered {
+		linkDest := normalizedLinkDest(registered.Path)
+		if registered.Ino != 0 {
+			if _, ok := openFiles[identity{linkDest, registered.Dev, registered.Ino}]; ok {
+				continue
+			}
+		} else if _, ok := open[linkDest]; ok {
+			continue
+		}
+		stale = append(stale, registered)
+	}
+	return stale
+}
+
+// pathFdOf returns the PathFd of the specified fd if it references a file
+// system path, such as a plain file or a POSIX shared memory object, otherwise
+// nil.
+func pathFdOf(fd FileDescriptor) *PathFd {
+	switch fd := fd.(type) {
+	case *PathFd:
+		return fd
+	case *ShmFd:
+		return &fd.PathFd
+	}
+	return nil
+}
+
+// linkDestOf returns the (normalized) link destination of the specified fd, as
+// also used in the fdinfo of io_uring fds to reference registered files.
+func linkDestOf(fd FileDescriptor) string {
+	switch fd := fd.(type) {
+	case *PathFd:
+		return fd.Path()
+	case *ShmFd:
+		return fd.Path()
+	case *PipeFd:
+		return fmt.Sprintf("pipe:[%d]", fd.Ino())
+	case *SocketFd:
+		return fmt.Sprintf("socket:[%d]", fd.Ino())
+	case *NamespaceFd:
+		return fmt.Sprintf("%s:[%d]", fd.NamespaceType(), fd.Ino())
+	}
+	if anonfd, ok := AnonInodeOf(fd); ok {
+		return anonInodePrefix + anonfd.FileType()
+	}
+	return ""
+}
+
+// normalizedLinkDest returns the specified link destination with the square
+// brackets around anonymous inode file types removed, as the kernel isn't
+// consistent in this respect.
+func normalizedLinkDest(linkDest string) string {
+	if strings.HasPrefix(linkDest, anonInodePrefix) {
+		return anonInodePrefix + strings.Trim(linkDest[len(anonInodePrefix):], "[]")
+	}
+	return linkDest
+}
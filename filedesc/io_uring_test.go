@@ -0,0 +1,126 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+// ioUringWithFiles returns a new io_uring fd with the specified fds
+// registered, skipping the current spec if io_uring is unavailable.
+func ioUringWithFiles(fds ...int32) int {
+	GinkgoHelper()
+	var params [120]byte // struct io_uring_params
+	ring, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, 4, uintptr(unsafe.Pointer(&params[0])), 0)
+	if errno != 0 {
+		Skip("io_uring unavailable: " + errno.Error())
+	}
+	DeferCleanup(func() { unix.Close(int(ring)) })
+	// opcode 2 is IORING_REGISTER_FILES, which x/sys/unix doesn't define.
+	_, _, errno = unix.Syscall6(unix.SYS_IO_URING_REGISTER, ring, 2,
+		uintptr(unsafe.Pointer(&fds[0])), uintptr(len(fds)), 0, 0)
+	Expect(errno).To(BeZero())
+	return int(ring)
+}
+
+var _ = Describe("io_uring registered files", func() {
+
+	It("parses registered files from fdinfo", func() {
+		files := Successful(registeredFilesFromScanner(bufio.NewScanner(strings.NewReader(
+			"SqMask:\t0x3\nUserFiles:\t3\n    0: /tmp/foo\\040bar\n    2: pipe:[1234]\nUserBufs:\t0\nPollList:\n"))))
+		Expect(files).To(HaveExactElements(
+			RegisteredFile{Index: 0, Path: "/tmp/foo bar"},
+			RegisteredFile{Index: 2, Path: "pipe:[1234]"}))
+		Expect(registeredFilesFromScanner(bufio.NewScanner(strings.NewReader("UserFiles:\t0\n")))).To(BeEmpty())
+		Expect(ioUringRegisteredFiles(-1, "/proc/self/fd", defaultEnrichmentTimeout)).Error().To(HaveOccurred())
+	})
+
+	It("detects stale registered files", func() {
+		f := Successful(os.Open("io_uring_test.go"))
+		defer f.Close()
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_CLOEXEC)).To(Succeed())
+		ring := ioUringWithFiles(int32(f.Fd()), -1, int32(pipefds[0]))
+
+		fdesc := Successful(New(ring)).(*IoUringFd)
+		Expect(fdesc.FileType()).To(Equal("io_uring"))
+		Expect(fdesc.RegisteredFiles()).To(HaveExactElements(
+			HaveField("Path", HaveSuffix("/io_uring_test.go")),
+			And(HaveField("Index", 2), HaveField("Path", HavePrefix("pipe:[")))))
+		Expect(fdesc.Description(0)).To(ContainSubstring("\n    registered files: 2"))
+		Expect(StaleRegisteredFiles(fdesc, Filedescriptors())).To(BeEmpty())
+
+		Expect(fdesc.RegisteredFiles()[0].Ino).NotTo(BeZero())
+
+		Expect(unix.Close(pipefds[0])).To(Succeed())
+		Expect(unix.Close(pipefds[1])).To(Succeed())
+		Expect(StaleRegisteredFiles(fdesc, Filedescriptors())).To(ConsistOf(
+			HaveField("Index", 2)))
+	})
+
+	It("doesn't mistake other fds for the same file for registered files", func() {
+		dir := GinkgoT().TempDir()
+		path := filepath.Join(dir, "registered")
+		Expect(os.WriteFile(path, []byte("foo"), 0600)).To(Succeed())
+		link := filepath.Join(dir, "link")
+		if err := os.Link(path, link); err != nil {
+			Skip("needs hard links: " + err.Error())
+		}
+		f := Successful(os.Open(path))
+		ring := ioUringWithFiles(int32(f.Fd()))
+		fdesc := Successful(New(ring)).(*IoUringFd)
+		Expect(fdesc.RegisteredFiles()).To(ConsistOf(HaveField("Ino", Not(BeZero()))))
+		Expect(StaleRegisteredFiles(fdesc, Filedescriptors())).To(BeEmpty())
+		Expect(f.Close()).To(Succeed())
+
+		By("opening the same file via a hard link")
+		l := Successful(os.Open(link))
+		defer l.Close()
+		Expect(StaleRegisteredFiles(fdesc, Filedescriptors())).To(ConsistOf(
+			HaveField("Path", path)))
+
+		By("opening a different file at the same path")
+		Expect(os.Remove(path)).To(Succeed())
+		Expect(os.WriteFile(path, []byte("bar"), 0600)).To(Succeed())
+		fdesc = Successful(New(ring)).(*IoUringFd)
+		other := Successful(os.Open(path))
+		defer other.Close()
+		Expect(StaleRegisteredFiles(fdesc, Filedescriptors())).To(ConsistOf(
+			HaveField("Path", HavePrefix(path))))
+	})
+
+	It("determines equality correctly", func() {
+		ring := ioUringWithFiles(-1)
+		fdesc := Successful(New(ring))
+		Expect(fdesc).To(BeAssignableToTypeOf(&IoUringFd{}))
+		Expect(fdesc.Equal(nil)).To(BeFalse())
+		Expect(fdesc.Equal(fdesc)).To(BeTrue())
+		Expect(fdesc.Equal(&fdesc.(*IoUringFd).AnonInodeFd)).To(BeFalse())
+		Expect(fdesc.Equal(Successful(New(0)))).To(BeFalse())
+	})
+
+})
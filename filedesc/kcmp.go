@@ -0,0 +1,117 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// kcmpFile is the KCMP_FILE comparison type of kcmp(2), checking whether two
+// fds refer to the same open file description.
+const kcmpFile = 0
+
+// SameFileDescription returns true if the fd fdNo1 of the process pid1 and the
+// fd fdNo2 of the process pid2 share the same open file description (also
+// known as an “open file table entry”). Fds share the same open file
+// description when they have been dup'ed, inherited by forked children, or
+// passed via SCM_RIGHTS. See also [kcmp(2)].
+//
+// [kcmp(2)]: https://man7.org/linux/man-pages/man2/kcmp.2.html
+func SameFileDescription(pid1, fdNo1, pid2, fdNo2 int) (bool, error) {
+	r, _, errno := unix.Syscall6(unix.SYS_KCMP,
+		uintptr(pid1), uintptr(pid2), kcmpFile, uintptr(fdNo1), uintptr(fdNo2), 0)
+	if errno != 0 {
+		return false, errno
+	}
+	return r == 0, nil
+}
+
+// pidOwner is implemented by FileDescriptor implementations knowing the
+// process they belong to.
+type pidOwner interface {
+	PID() int
+}
+
+// SharingFileDescription returns the fds from the specified list that share
+// the same open file description with the specified fd, excluding the fd
+// itself. The fds in the list may belong to different processes, such as a
+// supervising parent and its child process. An error is returned if the fd
+// doesn't know its owning process.
+func SharingFileDescription(fd FileDescriptor, fds []FileDescriptor) ([]FileDescriptor, error) {
+	owner, ok := fd.(pidOwner)
+	if !ok || owner.PID() == 0 {
+		return nil, errors.New("SharingFileDescription: fd without owning process")
+	}
+	pid := owner.PID()
+	var sharing []FileDescriptor
+	for _, other := range fds {
+		otherOwner, ok := other.(pidOwner)
+		if !ok || otherOwner.PID() == 0 {
+			continue
+		}
+		if otherOwner.PID() == pid && other.FdNo() == fd.FdNo() {
+			continue
+		}
+		same, err := SameFileDescription(pid, fd.FdNo(), otherOwner.PID(), other.FdNo())
+		if err != nil || !same {
+			continue // skip fds gone in the meantime.
+		}
+		sharing = append(sharing, other)
+	}
+	return sharing, nil
+}
+
+// SharingGroups returns the groups of fds from the specified list that share
+// an open file description, where each group contains at least two fds. Fds
+// not sharing their open file description with any other fd in the list are
+// not returned.
+func SharingGroups(fds []FileDescriptor) [][]FileDescriptor {
+	grouped := make([]bool, len(fds))
+	var groups [][]FileDescriptor
+	for idx, fd := range fds {
+		if grouped[idx] {
+			continue
+		}
+		owner, ok := fd.(pidOwner)
+		if !ok || owner.PID() == 0 {
+			continue
+		}
+		group := []FileDescriptor{fd}
+		for otherIdx := idx + 1; otherIdx < len(fds); otherIdx++ {
+			if grouped[otherIdx] {
+				continue
+			}
+			otherOwner, ok := fds[otherIdx].(pidOwner)
+			if !ok || otherOwner.PID() == 0 {
+				continue
+			}
+			same, err := SameFileDescription(
+				owner.PID(), fd.FdNo(), otherOwner.PID(), fds[otherIdx].FdNo())
+			if err != nil || !same {
+				continue
+			}
+			grouped[otherIdx] = true
+			group = append(group, fds[otherIdx])
+		}
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
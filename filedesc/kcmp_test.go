@@ -0,0 +1,64 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("open file description sharing", func() {
+
+	It("knows the owning process", func() {
+		Expect(pidFromBase("/proc/self/fd")).To(Equal(os.Getpid()))
+		Expect(pidFromBase("/proc/42/fd")).To(Equal(42))
+		Expect(pidFromBase("/proc/fake/fd")).To(BeZero())
+		Expect(Successful(New(0))).To(HaveField("PID()", os.Getpid()))
+	})
+
+	It("detects dup'ed fds", func() {
+		fd := Successful(unix.Open("kcmp_test.go", unix.O_RDONLY, 0))
+		defer unix.Close(fd)
+		dupfd := Successful(unix.Dup(fd))
+		defer unix.Close(dupfd)
+		otherfd := Successful(unix.Open("kcmp_test.go", unix.O_RDONLY, 0))
+		defer unix.Close(otherfd)
+
+		pid := os.Getpid()
+		Expect(SameFileDescription(pid, fd, pid, dupfd)).To(BeTrue())
+		Expect(SameFileDescription(pid, fd, pid, otherfd)).To(BeFalse())
+		Expect(SameFileDescription(pid, -1, pid, otherfd)).Error().To(HaveOccurred())
+
+		fdesc := Successful(New(fd))
+		dupfdesc := Successful(New(dupfd))
+		otherfdesc := Successful(New(otherfd))
+		fds := []FileDescriptor{fdesc, dupfdesc, otherfdesc}
+		Expect(SharingFileDescription(fdesc, fds)).To(ConsistOf(dupfdesc))
+		Expect(SharingFileDescription(otherfdesc, fds)).To(BeEmpty())
+		Expect(SharingGroups(fds)).To(ConsistOf(ConsistOf(fdesc, dupfdesc)))
+
+		fake := &PathFd{filedesc: filedesc{fdNo: fd}, path: "/foo"}
+		Expect(SharingFileDescription(fake, fds)).Error().To(HaveOccurred())
+		Expect(SharingGroups([]FileDescriptor{fake, fdesc})).To(BeEmpty())
+	})
+
+})
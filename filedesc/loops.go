@@ -0,0 +1,61 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// LoopDevice is an attached loop device together with its backing file.
+type LoopDevice struct {
+	Name        string // name of the loop device, such as "loop7".
+	BackingFile string // path of the backing file.
+}
+
+// LoopDevices returns the currently attached loop devices, as reported by the
+// sysfs mounted at [SysRoot].
+func LoopDevices() ([]LoopDevice, error) {
+	entries, err := os.ReadDir(SysRoot + "/block")
+	if err != nil {
+		return nil, err
+	}
+	loops := []LoopDevice{}
+	for _, entry := range entries {
+		if !loopDevice.MatchString(entry.Name()) {
+			continue
+		}
+		backing, err := loopBackingFile(SysRoot, entry.Name())
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // detached loop device
+			}
+			return nil, err
+		}
+		loops = append(loops, LoopDevice{Name: entry.Name(), BackingFile: backing})
+	}
+	return loops, nil
+}
+
+// Description returns a pretty formatted textual description of the loop
+// device.
+func (l LoopDevice) Description(indentation uint) string {
+	return fmt.Sprintf("%sloop device %q, backing file %q",
+		Indentation(indentation), "/dev/"+l.Name, l.BackingFile)
+}
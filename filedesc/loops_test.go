@@ -0,0 +1,48 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("loop devices", func() {
+
+	It("lists attached loop devices", Serial, func() {
+		oldSysRoot := SysRoot
+		DeferCleanup(func() { SysRoot = oldSysRoot })
+		SysRoot = GinkgoT().TempDir()
+		Expect(LoopDevices()).Error().To(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(SysRoot, "block/loop0/loop"), 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(SysRoot, "block/loop0/loop/backing_file"),
+			[]byte("/var/lib/images/disk.img\n"), 0600)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(SysRoot, "block/loop1"), 0700)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(SysRoot, "block/sda"), 0700)).To(Succeed())
+
+		loops := Successful(LoopDevices())
+		Expect(loops).To(ConsistOf(LoopDevice{Name: "loop0", BackingFile: "/var/lib/images/disk.img"}))
+		Expect(loops[0].Description(0)).To(Equal(
+			`loop device "/dev/loop0", backing file "/var/lib/images/disk.img"`))
+	})
+
+})
@@ -0,0 +1,75 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// FileID identifies a file by its device and inode numbers.
+type FileID struct {
+	Dev uint64 // device number, as returned by [PathFd.Dev].
+	Ino uint64 // inode number, as returned by [PathFd.Ino].
+}
+
+// MappedSizes returns the total sizes in bytes of the memory regions of the
+// process identified by pid that are mapped from files, keyed by the file
+// identities. This allows checking whether the memory of a memfd or shared
+// memory file is still mapped, so that closing its fd wouldn't release the
+// memory anyway.
+func MappedSizes(pid int) (map[FileID]uint64, error) {
+	return mappedSizes(procPIDPath(pid) + "/maps")
+}
+
+// mappedSizes returns the total sizes of the file-mapped memory regions from
+// the specified procfs process maps file.
+func mappedSizes(mapsPath string) (map[FileID]uint64, error) {
+	f, err := os.Open(mapsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sizes := map[FileID]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// address perms offset dev inode pathname
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[4] == "0" {
+			continue // skip anonymous mappings.
+		}
+		from, to, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			continue
+		}
+		start, err1 := strconv.ParseUint(from, 16, 64)
+		end, err2 := strconv.ParseUint(to, 16, 64)
+		major, minor, ok := strings.Cut(fields[3], ":")
+		maj, err3 := strconv.ParseUint(major, 16, 32)
+		min, err4 := strconv.ParseUint(minor, 16, 32)
+		ino, err5 := strconv.ParseUint(fields[4], 10, 64)
+		if !ok || err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil || end < start {
+			continue
+		}
+		sizes[FileID{Dev: unix.Mkdev(uint32(maj), uint32(min)), Ino: ino}] += end - start
+	}
+	return sizes, scanner.Err()
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("memory mappings", func() {
+
+	It("sums up file-mapped memory regions", func() {
+		maps := filepath.Join(GinkgoT().TempDir(), "maps")
+		Expect(os.WriteFile(maps, []byte(`1000-3000 r--p 00000000 fe:01 42 /foo
+3000-4000 r-xp 00002000 fe:01 42 /foo
+4000-5000 rw-p 00000000 00:00 0 [heap]
+5000-6000 rw-s 00000000 00:01 1234 /memfd:bar (deleted)
+garbage
+7000-6000 rw-s 00000000 00:01 1234 /memfd:bar (deleted)
+`), 0644)).To(Succeed())
+		Expect(mappedSizes(maps)).To(Equal(map[FileID]uint64{
+			{Dev: unix.Mkdev(0xfe, 1), Ino: 42}: 0x3000,
+			{Dev: unix.Mkdev(0, 1), Ino: 1234}:  0x1000,
+		}))
+		Expect(mappedSizes(filepath.Join(GinkgoT().TempDir(), "missing"))).Error().To(HaveOccurred())
+	})
+
+	It("finds this process's mappings", func() {
+		exe := Successful(os.Executable())
+		var stx unix.Statx_t
+		Expect(unix.Statx(unix.AT_FDCWD, exe, 0, unix.STATX_INO, &stx)).To(Succeed())
+		sizes := Successful(MappedSizes(os.Getpid()))
+		Expect(sizes).To(HaveKeyWithValue(
+			FileID{Dev: unix.Mkdev(stx.Dev_major, stx.Dev_minor), Ino: stx.Ino},
+			BeNumerically(">", 0)))
+	})
+
+})
@@ -0,0 +1,162 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Mount is a mount in the mount namespace of a process, such as a bind mount
+// or a bind-mounted namespace.
+type Mount struct {
+	ID         int    // unique mount ID.
+	Dev        uint64 // device of the mounted filesystem.
+	MountPoint string // mount point, relative to the process's root directory.
+	Root       string // root of the mount within its filesystem.
+	FSType     string // filesystem type, such as "nsfs" for namespaces.
+	Source     string // filesystem-specific mount source.
+}
+
+// Mounts returns the mounts in the mount namespace of this process.
+func Mounts() ([]Mount, error) {
+	return mounts(procSelfPath() + "/mountinfo")
+}
+
+// ProcessMounts returns the mounts in the mount namespace of the process
+// identified by pid.
+func ProcessMounts(pid int) ([]Mount, error) {
+	return mounts(procPIDPath(pid) + "/mountinfo")
+}
+
+// mounts returns the mounts listed in the specified procfs mountinfo file.
+func mounts(mountinfoPath string) ([]Mount, error) {
+	f, err := openFile(mountinfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mounts := []Mount{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// mountID parentID major:minor root mountpoint options [optional...] - fstype source superoptions
+		mount, super, ok := strings.Cut(scanner.Text(), " - ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(mount)
+		superFields := strings.Fields(super)
+		if len(fields) < 5 || len(superFields) < 2 {
+			continue
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		var dev uint64
+		if major, minor, ok := strings.Cut(fields[2], ":"); ok {
+			maj, err1 := strconv.ParseUint(major, 10, 32)
+			min, err2 := strconv.ParseUint(minor, 10, 32)
+			if err1 == nil && err2 == nil {
+				dev = unix.Mkdev(uint32(maj), uint32(min))
+			}
+		}
+		mounts = append(mounts, Mount{
+			ID:         id,
+			Dev:        dev,
+			MountPoint: unescapeMountinfo(fields[4]),
+			Root:       unescapeMountinfo(fields[3]),
+			FSType:     superFields[0],
+			Source:     unescapeMountinfo(superFields[1]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// canonicalPath returns the path via the first mount reaching the same file as
+// the specified path on the mount with the specified ID. Bind mounts of the
+// same directory thus map onto the same canonical path. If the mount is
+// unknown, canonicalPath returns the path unchanged.
+func canonicalPath(mounts []Mount, mntID int, path string) string {
+	idx := slices.IndexFunc(mounts, func(m Mount) bool { return m.ID == mntID })
+	if idx < 0 {
+		return path
+	}
+	mount := mounts[idx]
+	rel, ok := pathBelow(path, mount.MountPoint)
+	if !ok {
+		return path
+	}
+	// Locate the file within its filesystem, and then the first mount of the
+	// same filesystem that reaches it.
+	fsPath := joinBelow(mount.Root, rel)
+	for _, m := range mounts {
+		if m.Dev != mount.Dev {
+			continue
+		}
+		if rel, ok := pathBelow(fsPath, m.Root); ok {
+			return joinBelow(m.MountPoint, rel)
+		}
+	}
+	return path
+}
+
+// pathBelow returns the remainder of path below dir, such as "/b" for path
+// "/a/b" and dir "/a", or "" if path and dir are the same. It returns false if
+// path isn't dir or below it.
+func pathBelow(path, dir string) (string, bool) {
+	if path == dir {
+		return "", true
+	}
+	if dir == "/" {
+		return path, strings.HasPrefix(path, "/")
+	}
+	rest, ok := strings.CutPrefix(path, dir)
+	if !ok || !strings.HasPrefix(rest, "/") {
+		return "", false
+	}
+	return rest, true
+}
+
+// joinBelow returns dir joined with a remainder as returned by pathBelow.
+func joinBelow(dir, rest string) string {
+	switch {
+	case rest == "":
+		return dir
+	case dir == "/":
+		return rest
+	}
+	return dir + rest
+}
+
+// Namespace returns true if the mount is a bind-mounted namespace.
+func (m Mount) Namespace() bool { return m.FSType == "nsfs" }
+
+// Description returns a pretty formatted textual description of the mount.
+func (m Mount) Description(indentation uint) string {
+	what := "mount"
+	if m.Namespace() {
+		what = "namespace bind mount"
+	}
+	return fmt.Sprintf("%s%s %q, ID %d, fstype %s, source %q, root %q",
+		Indentation(indentation), what, m.MountPoint, m.ID, m.FSType, m.Source, m.Root)
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("mounts", func() {
+
+	It("lists this process's mounts", func() {
+		Expect(Mounts()).To(ContainElement(HaveField("MountPoint", "/")))
+		Expect(ProcessMounts(os.Getpid())).To(ContainElement(HaveField("MountPoint", "/")))
+		Expect(ProcessMounts(-1)).Error().To(HaveOccurred())
+	})
+
+	It("parses mountinfo", func() {
+		mountinfo := filepath.Join(GinkgoT().TempDir(), "mountinfo")
+		Expect(os.WriteFile(mountinfo, []byte(`22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+malformed line
+x 22 0:4 / /foo rw - nsfs nsfs rw
+42 22 0:4 net:[4026531840] /run/netns/foo\040bar rw shared:2 - nsfs nsfs rw
+`), 0600)).To(Succeed())
+		mounts := Successful(mounts(mountinfo))
+		Expect(mounts).To(HaveExactElements(
+			Mount{ID: 22, Dev: unix.Mkdev(8, 1), MountPoint: "/", Root: "/", FSType: "ext4", Source: "/dev/sda1"},
+			Mount{ID: 42, Dev: unix.Mkdev(0, 4), MountPoint: "/run/netns/foo bar", Root: "net:[4026531840]", FSType: "nsfs", Source: "nsfs"}))
+		Expect(mounts[0].Namespace()).To(BeFalse())
+		Expect(mounts[1].Namespace()).To(BeTrue())
+		Expect(mounts[1].Description(0)).To(Equal(
+			`namespace bind mount "/run/netns/foo bar", ID 42, fstype nsfs, source "nsfs", root "net:[4026531840]"`))
+	})
+
+	It("determines canonical paths", func() {
+		mounts := []Mount{
+			{ID: 22, Dev: unix.Mkdev(8, 1), MountPoint: "/", Root: "/"},
+			{ID: 23, Dev: unix.Mkdev(8, 2), MountPoint: "/home", Root: "/"},
+			{ID: 42, Dev: unix.Mkdev(8, 1), MountPoint: "/srv/app/config", Root: "/etc/app"},
+			{ID: 43, Dev: unix.Mkdev(8, 2), MountPoint: "/srv/home", Root: "/user"},
+		}
+		Expect(canonicalPath(mounts, 22, "/etc/app/app.conf")).To(Equal("/etc/app/app.conf"))
+		Expect(canonicalPath(mounts, 23, "/home/user/.bashrc")).To(Equal("/home/user/.bashrc"))
+		Expect(canonicalPath(mounts, 42, "/srv/app/config/app.conf")).To(Equal("/etc/app/app.conf"))
+		Expect(canonicalPath(mounts, 42, "/srv/app/config")).To(Equal("/etc/app"))
+		Expect(canonicalPath(mounts, 43, "/srv/home/.bashrc")).To(Equal("/home/user/.bashrc"))
+		Expect(canonicalPath(mounts, 22, "/")).To(Equal("/"))
+
+		Expect(canonicalPath(mounts, 666, "/srv/app/config/app.conf")).To(Equal("/srv/app/config/app.conf"))
+		Expect(canonicalPath(mounts, 42, "/srv/app/configs")).To(Equal("/srv/app/configs"))
+	})
+
+})
@@ -0,0 +1,80 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// GoRuntimeNetpollerFds returns the sorted fd numbers of the own process that
+// belong to the Go runtime's netpoller: its epoll fd, as well as the
+// non-blocking eventfd (or pipe fds with older Go runtimes) registered with it
+// in order to break out of blocking epoll_wait(2) calls. If the netpoller
+// hasn't been initialized yet, GoRuntimeNetpollerFds returns nil.
+//
+// As fds don't record who created them and for what purpose, the netpoller fds
+// are identified using heuristics: the netpoller's epoll fd is the
+// lowest-numbered epoll fd watching a non-blocking eventfd or pipe, as the Go
+// runtime initializes its netpoller upon opening the first file or socket.
+func GoRuntimeNetpollerFds() []int {
+	return netpollerFds(Filedescriptors())
+}
+
+// netpollerFds returns the sorted fd numbers of the Go runtime netpoller fds
+// found in the specified fds.
+func netpollerFds(fds []FileDescriptor) []int {
+	byFdNo := map[int]FileDescriptor{}
+	for _, fd := range fds {
+		byFdNo[fd.FdNo()] = fd
+	}
+	// fds are sorted by fd number, so the first matching epoll fd is the
+	// lowest-numbered one.
+	for _, fd := range fds {
+		epoll, ok := fd.(*EpollFd)
+		if !ok {
+			continue
+		}
+		// The Go runtime might register further non-blocking pipes with its
+		// netpoller, and the targets are listed in no particular order, so
+		// prefer an eventfd wakeup.
+		for _, target := range epoll.Targets() {
+			if wakeup, ok := byFdNo[target.FdNo].(*EventfdFd); ok && wakeup.Flags()&unix.O_NONBLOCK != 0 {
+				return []int{epoll.FdNo(), target.FdNo}
+			}
+		}
+		for _, target := range epoll.Targets() {
+			wakeup, ok := byFdNo[target.FdNo].(*PipeFd)
+			if !ok || wakeup.Flags()&unix.O_NONBLOCK == 0 {
+				continue
+			}
+			// The netpoller only registers the pipe's read end, so
+			// additionally pick up the write end.
+			fdNos := []int{epoll.FdNo()}
+			for _, other := range fds {
+				if pipe, ok := other.(*PipeFd); ok && pipe.Ino() == wakeup.Ino() &&
+					pipe.Flags()&unix.O_NONBLOCK != 0 {
+					fdNos = append(fdNos, pipe.FdNo())
+				}
+			}
+			slices.Sort(fdNos)
+			return fdNos
+		}
+	}
+	return nil
+}
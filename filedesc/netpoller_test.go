@@ -0,0 +1,84 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("Go runtime netpoller fds", func() {
+
+	It("identifies the own netpoller fds", func() {
+		netpoller := GoRuntimeNetpollerFds()
+		Expect(netpoller).To(HaveLen(2))
+		Expect(Successful(New(netpoller[0]))).To(HaveField("FileType()", "eventpoll"))
+		Expect(Successful(New(netpoller[1]))).To(HaveField("FileType()", "eventfd"))
+	})
+
+	// epollWatching returns a new epoll fd watching the specified fd.
+	epollWatching := func(fd int) int {
+		GinkgoHelper()
+		epfd := Successful(unix.EpollCreate1(unix.EPOLL_CLOEXEC))
+		DeferCleanup(func() { unix.Close(epfd) })
+		Expect(unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, fd,
+			&unix.EpollEvent{Events: unix.EPOLLIN})).To(Succeed())
+		return epfd
+	}
+
+	It("identifies netpoller pipes", func() {
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_NONBLOCK|unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		epfd := epollWatching(pipefds[0])
+
+		fds := FiledescriptorsWith(OnlyFdRange(epfd, epfd),
+			OnlyFdRange(pipefds[0], pipefds[0]), OnlyFdRange(pipefds[1], pipefds[1]))
+		Expect(netpollerFds(fds)).To(ConsistOf(epfd, pipefds[0], pipefds[1]))
+	})
+
+	It("prefers eventfds over further non-blocking pipes", func() {
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_NONBLOCK|unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		evfd := Successful(unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC))
+		defer unix.Close(evfd)
+		epfd := epollWatching(pipefds[0])
+		Expect(unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, evfd,
+			&unix.EpollEvent{Events: unix.EPOLLIN})).To(Succeed())
+
+		fds := FiledescriptorsWith(OnlyFdRange(epfd, epfd), OnlyFdRange(evfd, evfd),
+			OnlyFdRange(pipefds[0], pipefds[0]), OnlyFdRange(pipefds[1], pipefds[1]))
+		Expect(netpollerFds(fds)).To(ConsistOf(epfd, evfd))
+	})
+
+	It("skips blocking wakeup fds", func() {
+		evfd := Successful(unix.Eventfd(0, unix.EFD_CLOEXEC))
+		defer unix.Close(evfd)
+		epfd := epollWatching(evfd)
+
+		fds := FiledescriptorsWith(OnlyFdRange(epfd, epfd), OnlyFdRange(evfd, evfd))
+		Expect(fds).To(HaveLen(2))
+		Expect(netpollerFds(fds)).To(BeEmpty())
+	})
+
+})
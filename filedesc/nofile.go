@@ -0,0 +1,78 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// NofileLimits are the soft and hard RLIMIT_NOFILE limits of a process,
+// limiting the fd numbers the process can open.
+type NofileLimits struct {
+	Soft uint64 // soft limit, or unix.RLIM_INFINITY if unlimited.
+	Hard uint64 // hard limit, or unix.RLIM_INFINITY if unlimited.
+}
+
+// ProcessNofileLimits returns the RLIMIT_NOFILE limits of the process
+// identified by pid. If the calling process does not possess the necessary
+// access rights to the process identified by pid an error is returned instead.
+func ProcessNofileLimits(pid int) (NofileLimits, error) {
+	var rlimit unix.Rlimit
+	if err := countedErr(unix.Prlimit(pid, unix.RLIMIT_NOFILE, nil, &rlimit)); err != nil {
+		return NofileLimits{}, err
+	}
+	return NofileLimits{Soft: rlimit.Cur, Hard: rlimit.Max}, nil
+}
+
+// Changes returns a textual description of the changes of these limits in
+// comparison to the specified earlier limits, or an empty string if the limits
+// haven't changed.
+func (l NofileLimits) Changes(earlier NofileLimits) string {
+	var changes []string
+	change := func(name string, from, to uint64) {
+		if from == to {
+			return
+		}
+		delta := ""
+		if from != unix.RLIM_INFINITY && to != unix.RLIM_INFINITY {
+			delta = fmt.Sprintf(" (%+d)", int64(to)-int64(from))
+		}
+		changes = append(changes, fmt.Sprintf("%s limit changed from %s to %s%s",
+			name, limitString(from), limitString(to), delta))
+	}
+	change("soft", earlier.Soft, l.Soft)
+	change("hard", earlier.Hard, l.Hard)
+	return strings.Join(changes, ", ")
+}
+
+// Description returns a pretty formatted textual description of the limits.
+func (l NofileLimits) Description(indentation uint) string {
+	return fmt.Sprintf("%sRLIMIT_NOFILE soft %s, hard %s",
+		Indentation(indentation), limitString(l.Soft), limitString(l.Hard))
+}
+
+// limitString returns the textual representation of a resource limit.
+func limitString(limit uint64) string {
+	if limit == unix.RLIM_INFINITY {
+		return "unlimited"
+	}
+	return strconv.FormatUint(limit, 10)
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("RLIMIT_NOFILE limits", func() {
+
+	It("returns this process's limits", func() {
+		var rlimit unix.Rlimit
+		Expect(unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit)).To(Succeed())
+		Expect(ProcessNofileLimits(os.Getpid())).To(Equal(NofileLimits{Soft: rlimit.Cur, Hard: rlimit.Max}))
+		Expect(ProcessNofileLimits(-1)).Error().To(HaveOccurred())
+	})
+
+	It("describes limits and their changes", func() {
+		limits := Successful(ProcessNofileLimits(os.Getpid()))
+		Expect(limits.Changes(limits)).To(BeEmpty())
+
+		earlier := NofileLimits{Soft: 1024, Hard: 4096}
+		Expect(earlier.Description(0)).To(Equal("RLIMIT_NOFILE soft 1024, hard 4096"))
+		Expect(NofileLimits{Soft: 4096, Hard: 4096}.Changes(earlier)).To(Equal(
+			"soft limit changed from 1024 to 4096 (+3072)"))
+		Expect(NofileLimits{Soft: 512, Hard: unix.RLIM_INFINITY}.Changes(earlier)).To(Equal(
+			"soft limit changed from 1024 to 512 (-512), hard limit changed from 4096 to unlimited"))
+	})
+
+})
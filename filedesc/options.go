@@ -0,0 +1,304 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// DiscoveryOption configures fd discovery, see [FiledescriptorsWith] and
+// [ProcessFiledescriptorsWith]. Options either restrict discovery to only
+// selected file descriptors, or control how the discovered file descriptors
+// get enriched. Restricting discovery both speeds up discovery in processes
+// with huge fd tables and lets focused assertions skip irrelevant noise.
+type DiscoveryOption func(*discoveryOptions)
+
+// discoveryOptions are the options of a particular discovery; a nil
+// *discoveryOptions means the defaults.
+type discoveryOptions struct {
+	kinds  map[string]struct{} // nil means all kinds
+	ranges []fdRange           // nil means all fd numbers
+	stats  *DiscoveryStats     // nil means no stats
+	ctx    context.Context     // nil means no context
+
+	timeout    time.Duration // see WithEnrichmentTimeout
+	hasTimeout bool          // WithEnrichmentTimeout has been used
+
+	confirmPaths bool // see WithConfirmedPaths
+	rawFdinfo    bool // see WithRawFdinfo
+	acrossMounts bool // see WithSameFileAcrossMounts
+	strict       bool // see WithStrictFdinfo
+	slowOwn      bool // see WithoutFastOwnDiscovery
+	noOffsets    bool // see WithoutOwnFileOffsets
+
+	idMaps map[string]idMaps // ID maps read so far in this discovery, by procfs PID directory.
+}
+
+// fdRange is an inclusive range of fd numbers, with a negative upper bound
+// meaning unbounded.
+type fdRange struct {
+	from, to int
+}
+
+// OnlyKinds restricts discovery to the specified kinds of file descriptors,
+// which are "path", "shm", "pipe", "socket", "anon_inode", and "namespace".
+// Multiple OnlyKinds options add up.
+func OnlyKinds(kinds ...string) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		if o.kinds == nil {
+			o.kinds = map[string]struct{}{}
+		}
+		for _, kind := range kinds {
+			o.kinds[kind] = struct{}{}
+		}
+	}
+}
+
+// OnlyFdRange restricts discovery to the file descriptors with numbers from
+// the inclusive range [from, to]. A negative to means no upper bound; for
+// instance, OnlyFdRange(3, -1) skips the stdio fds 0, 1, and 2. Multiple
+// OnlyFdRange options add up.
+func OnlyFdRange(from, to int) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.ranges = append(o.ranges, fdRange{from: from, to: to})
+	}
+}
+
+// WithContext stops discovery as soon as the specified context is done, such
+// as when its deadline expires, returning only the file descriptors discovered
+// so far. The context is checked before enriching each individual fd.
+func WithContext(ctx context.Context) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.ctx = ctx
+	}
+}
+
+// WithConfirmedPaths checks whether the paths of the discovered PathFds still
+// resolve to the open files, so that deleted or replaced files can be marked
+// distinctly in descriptions; see [PathFd.Replaced]. It is not enabled by
+// default, as it incurs an additional statx(2) syscall per path fd.
+func WithConfirmedPaths() DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.confirmPaths = true
+	}
+}
+
+// defaultEnrichmentTimeout is the enrichment timeout used unless discovering
+// [WithEnrichmentTimeout].
+const defaultEnrichmentTimeout = 2 * time.Second
+
+// WithEnrichmentTimeout limits the time spent on potentially blocking per-fd
+// enrichment steps, such as statx'ing files on dead NFS or FUSE filesystems,
+// instead of the default of 2s. Instead of hanging the whole discovery, fds
+// whose enrichment times out are marked as being on an unresponsive backing
+// filesystem. After the first timeout on a particular mount, further fds on
+// the same mount are marked as unresponsive right away without trying, until
+// the timed out enrichment step finally returns. Please note that a timed out
+// enrichment step thus leaves a single goroutine per unresponsive mount
+// blocked until the backing filesystem responds, if ever. A zero or negative
+// timeout disables the timeout.
+func WithEnrichmentTimeout(timeout time.Duration) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.timeout = timeout
+		o.hasTimeout = true
+	}
+}
+
+// WithRawFdinfo retains the complete fdinfo key-value pairs of the discovered
+// file descriptors, available via the RawFdinfo accessor. This allows filtering
+// on kernel fields not (yet) modelled by this package, as well as including the
+// full context in bug reports. It is not enabled by default, as it incurs
+// reading the complete fdinfo of each file descriptor a second time.
+func WithRawFdinfo() DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.rawFdinfo = true
+	}
+}
+
+// WithSameFileAcrossMounts lets the discovered PathFds be equal to other
+// PathFds with the same fd number when they reference the same file via
+// different paths on different mounts, such as different bind mounts of the
+// same directory; see also [PathFd.SameFile]. This avoids false leaks when
+// services re-open their configuration through a different bind mount path,
+// such as after reload tests. It is not enabled by default, as it incurs
+// reading the mountinfo of the process owning the fds.
+func WithSameFileAcrossMounts() DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.acrossMounts = true
+	}
+}
+
+// WithStrictFdinfo parses the fdinfo of the discovered file descriptors
+// strictly, failing the discovery of fds with unknown or malformed fdinfo
+// lines, as used for the package's own development. By default, fdinfo gets
+// parsed leniently, as its format varies across kernel versions and kinds of
+// fds: malformed or unknown lines never fail discovery, but are collected as
+// parse warnings, available via the ParseWarnings accessor.
+func WithStrictFdinfo() DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.strict = true
+	}
+}
+
+// WithoutFastOwnDiscovery disables the fast path when discovering the calling
+// process's own file descriptors. On the fast path, instead of reading the
+// fdinfo of each fd, the flags are queried directly using fcntl(2) and the
+// mount ID using statx(2), as both are considerably cheaper than opening,
+// reading, and closing procfs files. Additionally, the process start time is
+// read only once. Where the fast path isn't supported by the kernel or fails,
+// discovery falls back onto the fdinfo anyway. The fast path is always skipped
+// when discovering [WithRawFdinfo].
+func WithoutFastOwnDiscovery() DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.slowOwn = true
+	}
+}
+
+// WithoutOwnFileOffsets skips querying the file offsets of the calling
+// process's own regular files, directories, and block devices using lseek(2)
+// on the fast path, see [WithoutFastOwnDiscovery], saving a syscall per such
+// fd. The fast path then reports zero file offsets, so that [DiffDescription]
+// won't show changed offsets.
+func WithoutOwnFileOffsets() DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.noOffsets = true
+	}
+}
+
+// newDiscoveryOptions returns the discovery options resulting from the
+// specified DiscoveryOption functions, or nil if there are none.
+func newDiscoveryOptions(opts []DiscoveryOption) *discoveryOptions {
+	if len(opts) == 0 {
+		return nil
+	}
+	o := &discoveryOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// confirmsPaths returns true if the paths of PathFds are to be confirmed.
+func (o *discoveryOptions) confirmsPaths() bool {
+	return o != nil && o.confirmPaths
+}
+
+// done returns the error of the discovery's context if it is done, otherwise
+// nil.
+func (o *discoveryOptions) done() error {
+	if o == nil || o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Err()
+}
+
+// enrichmentTimeout returns the timeout for potentially blocking per-fd
+// enrichment steps, with zero or negative timeouts meaning no timeout.
+func (o *discoveryOptions) enrichmentTimeout() time.Duration {
+	if o == nil || !o.hasTimeout {
+		return defaultEnrichmentTimeout
+	}
+	return o.timeout
+}
+
+// retainsRawFdinfo returns true if the complete fdinfo is to be retained.
+func (o *discoveryOptions) retainsRawFdinfo() bool {
+	return o != nil && o.rawFdinfo
+}
+
+// sameFileAcrossMounts returns true if PathFds referencing the same file via
+// different mounts are to be considered equal.
+func (o *discoveryOptions) sameFileAcrossMounts() bool {
+	return o != nil && o.acrossMounts
+}
+
+// fastOwnDiscovery returns true if the calling process's own fds are to be
+// discovered using the fast path where possible.
+func (o *discoveryOptions) fastOwnDiscovery() bool {
+	return o == nil || (!o.slowOwn && !o.rawFdinfo)
+}
+
+// ownFileOffsets returns true if the file offsets of the calling process's own
+// fds are to be queried on the fast path.
+func (o *discoveryOptions) ownFileOffsets() bool {
+	return o == nil || !o.noOffsets
+}
+
+// parsesStrictly returns true if fdinfo is to be parsed strictly.
+func (o *discoveryOptions) parsesStrictly() bool {
+	return o != nil && o.strict
+}
+
+// selectsFdNo returns true if the fd number is selected for discovery.
+func (o *discoveryOptions) selectsFdNo(fdNo int) bool {
+	if o == nil || o.ranges == nil {
+		return true
+	}
+	for _, r := range o.ranges {
+		if fdNo >= r.from && (r.to < 0 || fdNo <= r.to) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsKind returns true if the kind of fd is selected for discovery.
+func (o *discoveryOptions) selectsKind(kind string) bool {
+	if o == nil || o.kinds == nil {
+		return true
+	}
+	_, ok := o.kinds[kind]
+	return ok
+}
+
+// linkKind returns the kind of fd based on its link “destination” only,
+// without needing any further (costly) discovery.
+func linkKind(linkDest string) string {
+	if strings.HasPrefix(linkDest, anonInodePrefix) {
+		return "anon_inode"
+	}
+	if delim := strings.Index(linkDest, ":["); delim > 1 {
+		switch linkDest[:delim] {
+		case "pipe", "socket":
+			return linkDest[:delim]
+		}
+		if _, ok := fdTypeFactories[linkDest[:delim]]; ok {
+			return "namespace"
+		}
+	}
+	if strings.HasPrefix(linkDest, shmPrefix) {
+		return "shm"
+	}
+	return "path"
+}
+
+// FiledescriptorsWith returns the list of currently open file descriptors for
+// this process, restricted by the specified discovery options.
+func FiledescriptorsWith(opts ...DiscoveryOption) []FileDescriptor {
+	fds, _ := discover(ownFdPath(), nil, newDiscoveryOptions(opts)) // keep silent in case of errors
+	return fds
+}
+
+// ProcessFiledescriptorsWith returns the list of currently open file
+// descriptors for the process identified by pid, restricted by the specified
+// discovery options. If the calling process does not possess the necessary
+// access rights to the process identified by pid an error is returned instead.
+func ProcessFiledescriptorsWith(pid int, opts ...DiscoveryOption) ([]FileDescriptor, error) {
+	return discover(procPIDPath(pid)+"/fd", nil, newDiscoveryOptions(opts))
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("discovery options", func() {
+
+	It("determines the kind of fd from its link", func() {
+		Expect(linkKind("/foo/bar")).To(Equal("path"))
+		Expect(linkKind("anon_inode:[eventfd]")).To(Equal("anon_inode"))
+		Expect(linkKind("pipe:[42]")).To(Equal("pipe"))
+		Expect(linkKind("socket:[42]")).To(Equal("socket"))
+		Expect(linkKind("net:[42]")).To(Equal("namespace"))
+		Expect(linkKind("foo:[42]")).To(Equal("path"))
+	})
+
+	It("selects fd numbers and kinds", func() {
+		var o *discoveryOptions
+		Expect(o.selectsFdNo(42)).To(BeTrue())
+		Expect(o.selectsKind("foo")).To(BeTrue())
+		Expect(newDiscoveryOptions(nil)).To(BeNil())
+
+		o = newDiscoveryOptions([]DiscoveryOption{OnlyFdRange(3, 5), OnlyFdRange(10, -1)})
+		Expect(o.selectsFdNo(2)).To(BeFalse())
+		Expect(o.selectsFdNo(3)).To(BeTrue())
+		Expect(o.selectsFdNo(5)).To(BeTrue())
+		Expect(o.selectsFdNo(6)).To(BeFalse())
+		Expect(o.selectsFdNo(1000)).To(BeTrue())
+		Expect(o.selectsKind("pipe")).To(BeTrue())
+
+		o = newDiscoveryOptions([]DiscoveryOption{OnlyKinds("socket"), OnlyKinds("pipe")})
+		Expect(o.selectsFdNo(0)).To(BeTrue())
+		Expect(o.selectsKind("pipe")).To(BeTrue())
+		Expect(o.selectsKind("socket")).To(BeTrue())
+		Expect(o.selectsKind("path")).To(BeFalse())
+	})
+
+	It("discovers only selected fds", func() {
+		fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		defer unix.Close(fd)
+
+		fds := FiledescriptorsWith(OnlyKinds("socket"))
+		Expect(fds).To(ContainElement(HaveField("FdNo()", fd)))
+		Expect(fds).To(HaveEach(BeAssignableToTypeOf(&SocketFd{})))
+
+		Expect(FiledescriptorsWith(OnlyFdRange(3, -1))).To(HaveEach(
+			HaveField("FdNo()", BeNumerically(">=", 3))))
+		Expect(FiledescriptorsWith(OnlyFdRange(fd, fd))).To(ConsistOf(
+			HaveField("FdNo()", fd)))
+
+		Expect(Successful(ProcessFiledescriptorsWith(os.Getpid(), OnlyFdRange(fd, fd)))).To(
+			ConsistOf(HaveField("FdNo()", fd)))
+		Expect(ProcessFiledescriptorsWith(-1)).Error().To(HaveOccurred())
+	})
+
+	It("discovers only the specified fd numbers until the context is done", func() {
+		fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		closedFd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		defer unix.Close(fd)
+		Expect(unix.Close(closedFd)).To(Succeed())
+
+		Expect(FiledescriptorsOf([]int{fd, closedFd})).To(ConsistOf(
+			HaveField("FdNo()", fd)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		fds, err := FiledescriptorsOf([]int{fd}, WithContext(ctx))
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(fds).To(BeEmpty())
+		Expect(FiledescriptorsWith(WithContext(ctx))).To(BeEmpty())
+	})
+
+})
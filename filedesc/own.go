@@ -0,0 +1,111 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// ownFdPath returns the path to the procfs fd directory of the calling
+// process. It deliberately avoids /proc/thread-self, as after
+// unshare(CLONE_FILES) the threads of a process don't share a single fd table
+// anymore, and goroutines migrating between OS threads then would mix fd tables
+// within a single discovery.
+func ownFdPath() string {
+	return procSelfPath() + "/fd"
+}
+
+// isOwnBase returns true if the specified base path is a procfs fd directory
+// of the calling process (or thread).
+func isOwnBase(base string) bool {
+	return strings.HasPrefix(base, procSelfPath()+"/") ||
+		strings.HasPrefix(base, procThreadSelfPath()+"/")
+}
+
+// ownStart caches the start time of the calling process, once known.
+var ownStart atomic.Uint64
+
+// ownStartTime returns the start time of the calling process, reading it from
+// procfs only until it has been successfully read once.
+func ownStartTime() (uint64, error) {
+	if start := ownStart.Load(); start != 0 {
+		return start, nil
+	}
+	start, err := startTime(procSelfPath() + "/stat")
+	if err != nil {
+		return 0, err
+	}
+	ownStart.Store(start)
+	return start, nil
+}
+
+// ownFiledesc returns a new filedesc for an fd (number) of the calling process,
+// gathering the information directly using syscalls instead of reading the
+// fd's fdinfo. The flags are the same as in the fdinfo: the status flags as
+// returned by F_GETFL plus O_CLOEXEC if the fd's close-on-exec flag is set.
+// The statx(2) call is subject to the enrichment timeout of the specified
+// discovery options.
+func ownFiledesc(fdNo int, o *discoveryOptions) (filedesc, error) {
+	if !features().StatxMntID {
+		return filedesc{}, unix.ENOSYS
+	}
+	flags, err := counted(unix.FcntlInt(uintptr(fdNo), unix.F_GETFL, 0))
+	if err != nil {
+		return filedesc{}, err
+	}
+	fdflags, err := counted(unix.FcntlInt(uintptr(fdNo), unix.F_GETFD, 0))
+	if err != nil {
+		return filedesc{}, err
+	}
+	if fdflags&unix.FD_CLOEXEC != 0 {
+		flags |= unix.O_CLOEXEC
+	}
+	stx, err := statxAtTimeout(fdNo, "", unix.AT_EMPTY_PATH, 0,
+		unix.STATX_MNT_ID|unix.STATX_TYPE, o.enrichmentTimeout())
+	if err != nil {
+		return filedesc{}, err
+	}
+	if stx.Mask&unix.STATX_MNT_ID == 0 {
+		return filedesc{}, unix.ENOSYS
+	}
+	// Only regular files, directories, and block devices have meaningful file
+	// offsets, so skip the lseek for pipes, sockets, et cetera. O_PATH fds
+	// cannot be seeked and always have a zero file offset.
+	var pos int64
+	if o.ownFileOffsets() {
+		switch stx.Mode & unix.S_IFMT {
+		case unix.S_IFREG, unix.S_IFDIR, unix.S_IFBLK:
+			if pos, err = counted(unix.Seek(fdNo, 0, io.SeekCurrent)); err != nil {
+				pos = 0
+			}
+		}
+	}
+	f := filedesc{
+		fdNo:  fdNo,
+		flags: Flags(flags),
+		pos:   pos,
+		mntId: int(stx.Mnt_id),
+		pid:   os.Getpid(),
+	}
+	f.start, _ = ownStartTime()
+	return f, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("own fds fast path", func() {
+
+	slow := newDiscoveryOptions([]DiscoveryOption{WithoutFastOwnDiscovery()})
+
+	It("recognizes own procfs fd directories", func() {
+		Expect(isOwnBase(procSelfPath() + "/fd")).To(BeTrue())
+		Expect(isOwnBase(procThreadSelfPath() + "/fd")).To(BeTrue())
+		Expect(isOwnBase(procPIDPath(1) + "/fd")).To(BeFalse())
+		Expect(pidFromBase("/proc/thread-self/fd")).To(Equal(os.Getpid()))
+		Expect(ownFdPath()).To(Equal(procSelfPath() + "/fd"))
+	})
+
+	It("returns the same information as the fdinfo", func() {
+		f := Successful(os.Open("own_test.go"))
+		defer f.Close()
+		Expect(f.Seek(42, 0)).To(Equal(int64(42)))
+		Expect(Successful(ownFiledesc(int(f.Fd()),
+			newDiscoveryOptions([]DiscoveryOption{WithoutOwnFileOffsets()}))).pos).To(BeZero())
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_NONBLOCK)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		sfd := Successful(unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0))
+		defer unix.Close(sfd)
+		efd := Successful(unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK))
+		defer unix.Close(efd)
+		pfd := Successful(unix.Open(".", unix.O_PATH|unix.O_CLOEXEC, 0))
+		defer unix.Close(pfd)
+
+		fdNos := []int{int(f.Fd()), pipefds[0], pipefds[1], sfd, efd, pfd}
+		fasts := make([]filedesc, 0, len(fdNos))
+		for _, fdNo := range fdNos {
+			fasts = append(fasts, Successful(ownFiledesc(fdNo, nil)))
+		}
+		for idx, fdNo := range fdNos {
+			fast := fasts[idx]
+			Expect(fast).To(Equal(Successful(newFiledesc(fdNo, procSelfPath()+"/fd", slow))), "fd %d", fdNo)
+			Expect(fast.pid).To(Equal(os.Getpid()))
+			Expect(fast.start).NotTo(BeZero())
+		}
+
+		Expect(fasts[0].pos).To(Equal(int64(42)))
+
+		Expect(ownFiledesc(-1, nil)).Error().To(MatchError(unix.EBADF))
+	})
+
+	It("falls back onto the fdinfo", func() {
+		DeferCleanup(func(old func() KernelFeatures) { features = old }, features)
+		features = func() KernelFeatures { return KernelFeatures{Statx: true, FdinfoMntID: true} }
+		Expect(ownFiledesc(0, nil)).Error().To(MatchError(unix.ENOSYS))
+		Expect(ownFdPath()).To(Equal(procSelfPath() + "/fd"))
+		Expect(Successful(newFiledesc(0, procSelfPath()+"/fd", nil)).pid).To(Equal(os.Getpid()))
+	})
+
+	It("discovers the same fds as via the fdinfo", Serial, func() {
+		var fast, fdinfo DiscoveryStats
+		_ = FiledescriptorsWith(WithStats(&fast), WithoutOwnFileOffsets())
+		fastFds := Filedescriptors()
+		fdinfoFds := FiledescriptorsWith(WithStats(&fdinfo), WithoutFastOwnDiscovery())
+		// The Go runtime's netpoller wakeup eventfd counter changes at any
+		// time, so skip the netpoller fds. Similarly, the offset of go test's
+		// log grows with each file opened, such as by the discovery itself.
+		netpoller := netpollerFds(fastFds)
+		volatile := func(fd FileDescriptor) bool {
+			if p, ok := fd.(*PathFd); ok && filepath.Base(p.Path()) == "testlog.txt" {
+				return true
+			}
+			return slices.Contains(netpoller, fd.FdNo())
+		}
+		Expect(slices.DeleteFunc(fdinfoFds, volatile)).To(Equal(slices.DeleteFunc(slices.Clone(fastFds), volatile)))
+		Expect(fast.Syscalls).To(BeNumerically("<=", fdinfo.Syscalls))
+	})
+
+})
+
+func BenchmarkFiledescriptors(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		opts []DiscoveryOption
+	}{
+		{"fdinfo", []DiscoveryOption{WithoutFastOwnDiscovery()}},
+		{"fast", nil},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for range b.N {
+				_ = FiledescriptorsWith(bm.opts...)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"hash"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// LinkPrehash returns a hash over the sorted pairs of fd numbers and their
+// link destinations of the currently open file descriptors of the process
+// identified by pid, without any further discovery. The link destinations are
+// the targets of the magic symlinks in the process' procfs fd directory, such
+// as file paths, "pipe:[4242]", or "anon_inode:[eventfd]". The prehash is
+// computed by a single sweep over the fd directory, reading it and then reading
+// each fd link. Comparing prehashes thus allows cheaply screening whether a
+// process' fd table has changed before running a full discovery.
+//
+// Please note the following caveats:
+//   - reading the fd directory and the fd links isn't atomic, so fds might get
+//     opened and closed during the sweep. Comparing a racy prehash either
+//     fails to match and thus safely triggers a full discovery, or reflects an
+//     fd table as it might have been at some time during the sweep.
+//   - fds closed during the sweep cause LinkPrehash to return an error, as do
+//     unreadable fd links; the caller then needs to fall back to a full
+//     discovery.
+//   - a file that got closed and then reopened using the same path and with
+//     the same fd number results in the same prehash, even if the open flags
+//     differ. The same applies to anonymous inode fds of the same type, such as
+//     eventfds and epoll fds, as their link destinations lack any further
+//     identification.
+func LinkPrehash(pid int) (uint64, error) {
+	fdDirPath := fdDirPathOf(pid)
+	dirfd, err := openDir(fdDirPath)
+	if err != nil {
+		return 0, err
+	}
+	defer closeFd(dirfd)
+	names, err := readDirnames(dirfd, fdDirPath)
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, unix.PathMax)
+	h := fnv.New64a()
+	for _, fdNo := range sortedFdNumbers(fdDirPath, dirfd, names) {
+		name := strconv.Itoa(fdNo)
+		n, err := counted(unix.Readlinkat(dirfd, name, buf))
+		if err != nil {
+			return 0, &os.PathError{Op: "readlink", Path: fdDirPath + "/" + name, Err: err}
+		}
+		prehashLink(h, name, buf[:n])
+	}
+	return h.Sum64(), nil
+}
+
+// LinkPrehashOf returns the link-target prehash of the specified discovered
+// file descriptors, so that it can be compared with the [LinkPrehash] of the
+// process owning them. It returns false if any of the file descriptors lacks
+// its link destination, such as when it wasn't discovered but created
+// otherwise.
+func LinkPrehashOf(fds []FileDescriptor) (uint64, bool) {
+	links := make(map[int]string, len(fds))
+	fdNos := make([]int, 0, len(fds))
+	for _, fd := range fds {
+		linked, ok := fd.(interface{ linkDest() string })
+		if !ok || linked.linkDest() == "" {
+			return 0, false
+		}
+		links[fd.FdNo()] = linked.linkDest()
+		fdNos = append(fdNos, fd.FdNo())
+	}
+	slices.Sort(fdNos)
+	h := fnv.New64a()
+	for _, fdNo := range fdNos {
+		prehashLink(h, strconv.Itoa(fdNo), []byte(links[fdNo]))
+	}
+	return h.Sum64(), true
+}
+
+// prehashLink adds the specified fd number and its link destination to the
+// prehash.
+func prehashLink(h hash.Hash64, fdNo string, link []byte) {
+	_, _ = h.Write([]byte(fdNo))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(link)
+	_, _ = h.Write([]byte{0})
+}
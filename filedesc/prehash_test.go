@@ -0,0 +1,56 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("link-target prehash", func() {
+
+	It("rejects an invalid PID", func() {
+		_, err := LinkPrehash(-1)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("prehashes the fd table", func() {
+		prehash := Successful(LinkPrehash(os.Getpid()))
+		Expect(LinkPrehash(os.Getpid())).To(Equal(prehash))
+
+		fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		Expect(LinkPrehash(os.Getpid())).NotTo(Equal(prehash))
+		Expect(unix.Close(fd)).To(Succeed())
+		Expect(LinkPrehash(os.Getpid())).To(Equal(prehash))
+	})
+
+	It("prehashes discovered fds", func() {
+		fds := Filedescriptors()
+		prehash, ok := LinkPrehashOf(fds)
+		Expect(ok).To(BeTrue())
+		Expect(prehash).To(Equal(Successful(LinkPrehash(os.Getpid()))))
+
+		_, ok = LinkPrehashOf(append(fds, &PathFd{path: "/foo"}))
+		Expect(ok).To(BeFalse())
+	})
+
+})
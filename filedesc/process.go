@@ -0,0 +1,182 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcessInfo describes the process context needed to correctly interpret the
+// paths shown in the descriptions of a process's file descriptors: relative
+// paths are relative to the current working directory and absolute paths are
+// relative to the process's root directory, which might have been changed
+// using chroot(2).
+type ProcessInfo struct {
+	PID       int      // process ID
+	Cwd       string   // current working directory
+	Root      string   // root directory
+	Umask     int      // file mode creation mask, or -1 if not available
+	StartTime uint64   // start time in clock ticks after system boot, or 0 if not available
+	Argv      []string // command line arguments, only if explicitly requested
+	Env       []string // selected environment variables in "NAME=value" form, only if explicitly requested
+}
+
+// NewProcessInfo returns the process context information for the process
+// identified by pid. If the calling process does not possess the necessary
+// access rights to the process identified by pid an error is returned instead.
+func NewProcessInfo(pid int) (ProcessInfo, error) {
+	return processInfo(pid, procPIDPath(pid))
+}
+
+// processInfo returns the process context information from the procfs process
+// directory at the specified base path.
+func processInfo(pid int, base string) (ProcessInfo, error) {
+	cwd, err := os.Readlink(base + "/cwd")
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+	root, err := os.Readlink(base + "/root")
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+	start, _ := startTime(base + "/stat")
+	return ProcessInfo{
+		PID:       pid,
+		Cwd:       cwd,
+		Root:      root,
+		Umask:     umask(base + "/status"),
+		StartTime: start,
+	}, nil
+}
+
+// ProcessStartTime returns the start time of the process identified by pid, in
+// clock ticks after system boot. Together with the PID, the start time
+// identifies a particular process incarnation, as PIDs might get reused.
+func ProcessStartTime(pid int) (uint64, error) {
+	return startTime(procPIDPath(pid) + "/stat")
+}
+
+// startTime returns the start time from the specified procfs process stat
+// file. As the process name field might contain spaces and parentheses, the
+// fields are counted from the final closing parenthesis.
+func startTime(statPath string) (uint64, error) {
+	stat, err := readFile(statPath)
+	if err != nil {
+		return 0, err
+	}
+	idx := bytes.LastIndexByte(stat, ')')
+	if idx < 0 {
+		return 0, fmt.Errorf("malformed process stat %q", statPath)
+	}
+	// After the process name follow the fields starting with (3) state, so
+	// (22) starttime is at index 19.
+	fields := strings.Fields(string(stat[idx+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("incomplete process stat %q", statPath)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// umask returns the file mode creation mask from the specified procfs process
+// status file, or -1 if unavailable (such as on kernels before 4.7).
+func umask(statusPath string) int {
+	f, err := os.Open(statusPath)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Umask:") {
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.Trim(line[6:], "\t "), 8, 32)
+		if err != nil {
+			return -1
+		}
+		return int(mask)
+	}
+	return -1
+}
+
+// ProcessArgv returns the command line arguments of the process identified by
+// pid.
+func ProcessArgv(pid int) ([]string, error) {
+	return nulSeparated(procPIDPath(pid) + "/cmdline")
+}
+
+// ProcessEnv returns the environment variables with the specified names of the
+// process identified by pid in "NAME=value" form, in the order of the
+// specified names. Environment variables not set are skipped. Please note that
+// the environment is the initial environment of the process; later changes by
+// the process itself aren't reflected.
+func ProcessEnv(pid int, names ...string) ([]string, error) {
+	vars, err := nulSeparated(procPIDPath(pid) + "/environ")
+	if err != nil {
+		return nil, err
+	}
+	env := []string{}
+	for _, name := range names {
+		for _, v := range vars {
+			if strings.HasPrefix(v, name+"=") {
+				env = append(env, v)
+				break
+			}
+		}
+	}
+	return env, nil
+}
+
+// nulSeparated returns the NUL-separated strings from the specified procfs
+// file, such as cmdline and environ.
+func nulSeparated(path string) ([]string, error) {
+	contents, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	contents = bytes.TrimSuffix(contents, []byte{0})
+	if len(contents) == 0 {
+		return []string{}, nil
+	}
+	return strings.Split(string(contents), "\x00"), nil
+}
+
+// Description returns a pretty formatted multi-line textual description of
+// the process context.
+func (p ProcessInfo) Description(indentation uint) string {
+	indent := Indentation(indentation + 1) // further details are always indented further
+	desc := Indentation(indentation) + fmt.Sprintf("process PID %d", p.PID) +
+		fmt.Sprintf("\n%scwd: %q", indent, p.Cwd) +
+		fmt.Sprintf("\n%sroot: %q", indent, p.Root)
+	if p.Umask >= 0 {
+		desc += fmt.Sprintf("\n%sumask: %04o", indent, p.Umask)
+	}
+	if p.Argv != nil {
+		desc += fmt.Sprintf("\n%sargv: %q", indent, p.Argv)
+	}
+	for _, v := range p.Env {
+		name, value, _ := strings.Cut(v, "=")
+		desc += fmt.Sprintf("\n%senv: %s=%q", indent, name, value)
+	}
+	return desc
+}
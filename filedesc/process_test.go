@@ -0,0 +1,88 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("process information", func() {
+
+	It("reports missing processes", func() {
+		Expect(processInfo(-1, "./test/missing-proc")).Error().To(HaveOccurred())
+		Expect(umask("./test/missing-proc/status")).To(Equal(-1))
+		Expect(startTime("./test/missing-proc/stat")).Error().To(HaveOccurred())
+	})
+
+	It("returns this process's context", func() {
+		cwd := Successful(os.Getwd())
+		info := Successful(NewProcessInfo(os.Getpid()))
+		Expect(info.PID).To(Equal(os.Getpid()))
+		Expect(info.Cwd).To(Equal(cwd))
+		Expect(info.Root).To(Equal("/"))
+		Expect(info.Umask).To(BeNumerically(">=", 0))
+		Expect(info.StartTime).NotTo(BeZero())
+		Expect(ProcessStartTime(os.Getpid())).To(Equal(info.StartTime))
+		Expect(Successful(New(0)).(interface{ StartTime() uint64 }).StartTime()).To(Equal(info.StartTime))
+		Expect(info.Description(0)).To(MatchRegexp(
+			`^process PID \d+\n\s+cwd: ".*/filedesc"\n\s+root: "/"\n\s+umask: 0[0-7]{3}$`))
+	})
+
+	It("anchors discovered fds to the process start time", func() {
+		start := Successful(ProcessStartTime(os.Getpid()))
+		fds := Successful(ProcessFiledescriptors(os.Getpid()))
+		Expect(fds).NotTo(BeEmpty())
+		Expect(fds).To(HaveEach(HaveField("StartTime()", start)))
+	})
+
+	It("parses the start time", func() {
+		stat := filepath.Join(GinkgoT().TempDir(), "stat")
+		Expect(os.WriteFile(stat, []byte("42 (foo) bar) S 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 12345 19 20\n"), 0644)).To(Succeed())
+		Expect(startTime(stat)).To(Equal(uint64(12345)))
+
+		Expect(os.WriteFile(stat, []byte("42 (foo) S 1 2 3\n"), 0644)).To(Succeed())
+		Expect(startTime(stat)).Error().To(MatchError(ContainSubstring("incomplete process stat")))
+		Expect(os.WriteFile(stat, []byte("42 (foo S 1 2 3\n"), 0644)).To(Succeed())
+		Expect(startTime(stat)).Error().To(MatchError(ContainSubstring("malformed process stat")))
+	})
+
+	It("returns this process's argv and selected environment variables", func() {
+		Expect(ProcessArgv(os.Getpid())).To(Equal(os.Args))
+		Expect(os.Setenv("FDOOZE_TEST_ENV", "foo")).To(Succeed()) // doesn't change environ
+		Expect(ProcessEnv(os.Getpid(), "FDOOZE_TEST_ENV")).To(BeEmpty())
+		path := Successful(ProcessEnv(os.Getpid(), "FDOOZE_NONEXISTING", "PATH"))
+		Expect(path).To(ConsistOf(HavePrefix("PATH=")))
+		Expect(ProcessArgv(-1)).Error().To(HaveOccurred())
+		Expect(ProcessEnv(-1, "PATH")).Error().To(HaveOccurred())
+
+		info := ProcessInfo{PID: 42, Cwd: "/foo", Root: "/", Umask: -1,
+			Argv: []string{"/bin/foo", "--bar"}, Env: []string{"FOO=bar baz"}}
+		Expect(info.Description(0)).To(MatchRegexp(
+			`\n\s+argv: \["/bin/foo" "--bar"\]\n\s+env: FOO="bar baz"$`))
+	})
+
+	It("leaves out an unknown umask", func() {
+		info := ProcessInfo{PID: 42, Cwd: "/foo", Root: "/", Umask: -1}
+		Expect(info.Description(0)).NotTo(ContainSubstring("umask"))
+	})
+
+})
@@ -0,0 +1,63 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcRootEnv names the environment variable that, if set to a non-empty
+// value, overrides the default procfs mount point "/proc" at program start.
+const ProcRootEnv = "FDOOZE_PROCFS"
+
+// ProcRoot is the path where the procfs filesystem to discover file
+// descriptors from is mounted. It defaults to "/proc", unless overridden by
+// the environment variable named by [ProcRootEnv]. Setting ProcRoot is
+// required in test environments where a private procfs is mounted elsewhere,
+// such as in some chroots and sandboxes.
+var ProcRoot = procRootFromEnv()
+
+// procRootFromEnv returns the procfs mount point from the environment, falling
+// back to "/proc".
+func procRootFromEnv() string {
+	if root := os.Getenv(ProcRootEnv); root != "" {
+		return strings.TrimSuffix(root, "/")
+	}
+	return "/proc"
+}
+
+// procSelfPath returns the path to the procfs directory of the calling
+// process.
+func procSelfPath() string {
+	return ProcRoot + "/self"
+}
+
+// procThreadSelfPath returns the path to the procfs directory of the calling
+// thread. As all threads of a Go process share the same fd table, the fd
+// directory of the calling thread lists the same fds as the process's fd
+// directory, regardless of the thread the calling goroutine happens to run on.
+func procThreadSelfPath() string {
+	return ProcRoot + "/thread-self"
+}
+
+// procPIDPath returns the path to the procfs directory of the process
+// identified by pid.
+func procPIDPath(pid int) string {
+	return ProcRoot + "/" + strconv.Itoa(pid)
+}
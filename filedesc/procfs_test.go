@@ -0,0 +1,64 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("procfs root", Serial, func() {
+
+	BeforeEach(func() {
+		oldProcRoot := ProcRoot
+		DeferCleanup(func() { ProcRoot = oldProcRoot })
+	})
+
+	It("takes the procfs root from the environment", func() {
+		Expect(procRootFromEnv()).To(Equal("/proc"))
+		GinkgoT().Setenv(ProcRootEnv, "/foo/proc/")
+		Expect(procRootFromEnv()).To(Equal("/foo/proc"))
+	})
+
+	It("discovers fds from a procfs mounted elsewhere", func() {
+		ProcRoot = filepath.Join(GinkgoT().TempDir(), "altproc")
+		Expect(os.Symlink("/proc", ProcRoot)).To(Succeed())
+
+		fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		defer unix.Close(fd)
+
+		fds := Filedescriptors()
+		Expect(fds).To(ContainElement(And(
+			BeAssignableToTypeOf(&SocketFd{}),
+			HaveField("FdNo()", fd))))
+		Expect(Successful(ProcessFiledescriptors(os.Getpid()))).To(
+			ContainElement(HaveField("FdNo()", fd)))
+		Expect(Successful(New(fd))).To(BeAssignableToTypeOf(&SocketFd{}))
+		Expect(Successful(NewProcessInfo(os.Getpid()))).To(HaveField("Root", "/"))
+
+		ProcRoot = "./test/missing-proc"
+		Expect(Filedescriptors()).To(BeEmpty())
+		Expect(New(fd)).Error().To(HaveOccurred())
+	})
+
+})
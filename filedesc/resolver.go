@@ -0,0 +1,118 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ResolvConfPath is the path of the resolver configuration file listing the
+// configured DNS resolvers (name servers).
+var ResolvConfPath = "/etc/resolv.conf"
+
+// dnsPort is the well-known DNS port.
+const dnsPort = 53
+
+// Resolvers returns the IP addresses of the DNS resolvers (name servers)
+// configured in [ResolvConfPath].
+func Resolvers() ([]net.IP, error) {
+	return readResolvConf(ResolvConfPath)
+}
+
+// readResolvConf returns the IP addresses of the DNS resolvers (name servers)
+// configured in the resolver configuration file at the specified path.
+func readResolvConf(path string) ([]net.IP, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var resolvers []net.IP
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		addr, _, _ := strings.Cut(fields[1], "%") // drop any IPv6 zone
+		if ip := net.ParseIP(addr); ip != nil {
+			resolvers = append(resolvers, ip)
+		}
+	}
+	return resolvers, scanner.Err()
+}
+
+// markResolverPeers marks those socket fds of the process with the specified
+// procfs fd directory base that are connected to one of the DNS resolvers
+// configured in the process's own [ResolvConfPath], as seen from its root
+// directory. The resolver configuration is read only once, and only if there
+// are any sockets with DNS peers at all.
+func markResolverPeers(fds []FileDescriptor, base string) {
+	var resolvers []net.IP
+	read := false
+	for _, fd := range fds {
+		sfd, ok := fd.(*SocketFd)
+		if !ok || dnsPeerIP(sfd.peer.Sockaddr) == nil {
+			continue
+		}
+		if !read {
+			read = true
+			var err error
+			resolvers, err = readResolvConf(filepath.Dir(base) + "/root" + ResolvConfPath)
+			if err != nil {
+				return
+			}
+		}
+		sfd.resolver = isResolverPeer(sfd.peer.Sockaddr, resolvers)
+	}
+}
+
+// dnsPeerIP returns the IP address of the specified peer socket address if it
+// is port 53, otherwise nil.
+func dnsPeerIP(peer unix.Sockaddr) net.IP {
+	switch peer := peer.(type) {
+	case *unix.SockaddrInet4:
+		if peer.Port == dnsPort {
+			return peer.Addr[:]
+		}
+	case *unix.SockaddrInet6:
+		if peer.Port == dnsPort {
+			return peer.Addr[:]
+		}
+	}
+	return nil
+}
+
+// isResolverPeer returns true if the specified peer socket address is port 53
+// of one of the specified DNS resolvers.
+func isResolverPeer(peer unix.Sockaddr, resolvers []net.IP) bool {
+	ip := dnsPeerIP(peer)
+	if ip == nil {
+		return false
+	}
+	for _, resolver := range resolvers {
+		if resolver.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// readlink is readlinkCounted, unless mocked in order to simulate sandbox
+// policies.
+var readlink = readlinkCounted
+
+// RestrictedError indicates that a syscall needed for discovering or enriching
+// an fd has been blocked by a sandbox policy of the test environment, such as
+// seccomp or Landlock, as opposed to the fd having gone away in the meantime.
+// Discovery then falls back onto procfs-only enrichment instead of dropping
+// the fd.
+type RestrictedError struct {
+	Syscall string // name of the blocked syscall, such as "getsockopt".
+	Err     error  // the error returned by the blocked syscall.
+}
+
+// Error returns the textual description of the blocked syscall.
+func (e *RestrictedError) Error() string {
+	return fmt.Sprintf("%s blocked by sandbox policy: %s", e.Syscall, e.Err)
+}
+
+// Unwrap returns the error returned by the blocked syscall.
+func (e *RestrictedError) Unwrap() error { return e.Err }
+
+// restricted returns a RestrictedError for the specified syscall if err
+// indicates the typical EPERM, EACCES, or ENOSYS patterns of sandbox policies;
+// otherwise, it returns err as-is.
+func restricted(syscall string, err error) error {
+	if err == nil || !isPrivilegeError(err) {
+		return err
+	}
+	return &RestrictedError{Syscall: syscall, Err: err}
+}
+
+// linkDestFromStat returns a link destination for the fd (number) in the
+// specified base directory whose link cannot be read, based on statx'ing the
+// fd instead. For sockets and pipes, the link destination gets reconstructed
+// from the inode number, otherwise it is empty, as the path is unknown.
+func linkDestFromStat(fdNo int, base string, timeout time.Duration) string {
+	stx, err := statxTimeout(fmt.Sprintf("%s/%d", base, fdNo), 0,
+		unix.STATX_TYPE|unix.STATX_INO, timeout)
+	if err != nil {
+		return ""
+	}
+	switch stx.Mode & unix.S_IFMT {
+	case unix.S_IFSOCK:
+		return fmt.Sprintf("socket:[%d]", stx.Ino)
+	case unix.S_IFIFO:
+		return fmt.Sprintf("pipe:[%d]", stx.Ino)
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("sandbox-restricted discovery", Serial, func() {
+
+	It("wraps only privilege errors", func() {
+		Expect(restricted("foo", nil)).To(Succeed())
+		err := errors.New("D'OH!")
+		Expect(restricted("foo", err)).To(BeIdenticalTo(err))
+		Expect(restricted("foo", unix.EPERM)).To(And(
+			MatchError(unix.EPERM),
+			MatchError("foo blocked by sandbox policy: operation not permitted")))
+	})
+
+	It("degrades sockets when getsockopt is blocked", func() {
+		fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0))
+		defer unix.Close(fd)
+
+		oldGetsockopt := getsockoptInt
+		DeferCleanup(func() { getsockoptInt = oldGetsockopt })
+		getsockoptInt = func(int, int, int) (int, error) { return 0, unix.EPERM }
+
+		Expect(Filedescriptors()).To(ContainElement(And(
+			HaveField("FdNo()", fd),
+			HaveField("Degraded()", BeTrue()))))
+	})
+
+	It("reconstructs links when readlink is blocked", func() {
+		sfd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0))
+		defer unix.Close(sfd)
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		f := Successful(os.Open("sandbox_test.go"))
+		defer f.Close()
+
+		oldReadlink := readlink
+		DeferCleanup(func() { readlink = oldReadlink })
+		readlink = func(string) (string, error) { return "", unix.EACCES }
+
+		Expect(Filedescriptors()).To(ContainElements(
+			And(HaveField("FdNo()", sfd), BeAssignableToTypeOf(&SocketFd{})),
+			And(HaveField("FdNo()", pipefds[0]), BeAssignableToTypeOf(&PipeFd{})),
+			And(HaveField("FdNo()", int(f.Fd())), HaveField("Path()", ""), HaveField("Ino()", Not(BeZero())))))
+
+		_, report, err := ProcessFiledescriptorsWithReport(os.Getpid())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Skipped).To(ContainElement(And(
+			HaveField("FdNo", int(f.Fd())),
+			HaveField("Step", "link"),
+			HaveField("Err", MatchError(ContainSubstring("readlink blocked by sandbox policy"))))))
+	})
+
+})
@@ -0,0 +1,105 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"encoding/binary"
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Definitions from the unix_diag UAPI, see:
+// https://elixir.bootlin.com/linux/latest/source/include/uapi/linux/unix_diag.h
+const (
+	udiagShowRqlen    = 0x00000010 // UDIAG_SHOW_RQLEN
+	unixDiagRqlen     = 4          // UNIX_DIAG_RQLEN attribute type
+	sizeofUnixDiag    = 24         // sizeof(struct unix_diag_req)
+	sizeofUnixDiagMsg = 16         // sizeof(struct unix_diag_msg)
+	sizeofRtAttr      = 4          // sizeof(struct rtattr)
+)
+
+// unixRecvQueueLen returns the length of the receive queue of the unix domain
+// socket identified by its inode number, as reported by the sock_diag netlink
+// interface. For listening sockets, this is the number of pending connections
+// instead. Please note that sock_diag only sees the unix sockets of the
+// network namespace of the calling process.
+func unixRecvQueueLen(ino uint64) (int, error) {
+	if ino > 0xffffffff {
+		return 0, errors.New("unix socket inode number out of range")
+	}
+	nlfd, err := counted(unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_SOCK_DIAG))
+	if err != nil {
+		return 0, err
+	}
+	defer closeFd(nlfd)
+
+	req := make([]byte, unix.NLMSG_HDRLEN+sizeofUnixDiag)
+	ne := binary.NativeEndian
+	ne.PutUint32(req[0:], uint32(len(req)))         // nlmsg_len
+	ne.PutUint16(req[4:], unix.SOCK_DIAG_BY_FAMILY) // nlmsg_type
+	ne.PutUint16(req[6:], unix.NLM_F_REQUEST)       // nlmsg_flags
+	diag := req[unix.NLMSG_HDRLEN:]
+	diag[0] = unix.AF_UNIX                  // sdiag_family
+	ne.PutUint32(diag[4:], 0xffffffff)      // udiag_states: any
+	ne.PutUint32(diag[8:], uint32(ino))     // udiag_ino
+	ne.PutUint32(diag[12:], udiagShowRqlen) // udiag_show
+	ne.PutUint32(diag[16:], 0xffffffff)     // udiag_cookie: don't check
+	ne.PutUint32(diag[20:], 0xffffffff)
+	if err := countedErr(unix.Sendto(nlfd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK})); err != nil {
+		return 0, err
+	}
+
+	resp := make([]byte, 4096)
+	n, err := recvfrom(nlfd, resp)
+	if err != nil {
+		return 0, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(resp[:n])
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range msgs {
+		switch msg.Header.Type {
+		case unix.NLMSG_ERROR:
+			if len(msg.Data) >= 4 {
+				if errno := int32(ne.Uint32(msg.Data)); errno < 0 {
+					return 0, syscall.Errno(-errno)
+				}
+			}
+			return 0, errors.New("sock_diag error")
+		case unix.SOCK_DIAG_BY_FAMILY:
+			if len(msg.Data) < sizeofUnixDiagMsg {
+				return 0, errors.New("truncated unix_diag_msg")
+			}
+			attrs := msg.Data[sizeofUnixDiagMsg:]
+			for len(attrs) >= sizeofRtAttr {
+				attrLen := int(ne.Uint16(attrs[0:]))
+				attrType := ne.Uint16(attrs[2:])
+				if attrLen < sizeofRtAttr || attrLen > len(attrs) {
+					break
+				}
+				if attrType == unixDiagRqlen && attrLen >= sizeofRtAttr+8 {
+					return int(ne.Uint32(attrs[sizeofRtAttr:])), nil
+				}
+				attrs = attrs[min((attrLen+3)&^3, len(attrs)):]
+			}
+		}
+	}
+	return 0, errors.New("no UNIX_DIAG_RQLEN information")
+}
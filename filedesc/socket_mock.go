@@ -22,6 +22,18 @@ import "golang.org/x/sys/unix"
 
 // So, who is mocking whom?
 
-var getsockoptInt func(int, int, int) (int, error) = unix.GetsockoptInt
-var getsockname func(int) (unix.Sockaddr, error) = unix.Getsockname
-var getpeername func(int) (unix.Sockaddr, error) = unix.Getpeername
+var getsockoptInt = func(fd, level, opt int) (int, error) {
+	return counted(unix.GetsockoptInt(fd, level, opt))
+}
+var getsockname = func(fd int) (unix.Sockaddr, error) {
+	return counted(unix.Getsockname(fd))
+}
+var getpeername = func(fd int) (unix.Sockaddr, error) {
+	return counted(unix.Getpeername(fd))
+}
+var pidfdGetfd = func(pidfd, targetfd, flags int) (int, error) {
+	return counted(unix.PidfdGetfd(pidfd, targetfd, flags))
+}
+var getsockoptUcred = func(fd, level, opt int) (*unix.Ucred, error) {
+	return counted(unix.GetsockoptUcred(fd, level, opt))
+}
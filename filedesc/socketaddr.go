@@ -19,6 +19,7 @@ package filedesc
 import (
 	"fmt"
 	"net"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -62,6 +63,130 @@ func (a Sockaddr) String() string {
 	return fmt.Sprintf("%#v", a.Sockaddr)
 }
 
+// Equal returns true if both wrapped socket addresses are of the same type and
+// have the same address details, such as IP address, port, and zone. Two
+// wrapped nil socket addresses are equal. Equal compares the supported socket
+// address types field by field, so custom filters can cheaply compare socket
+// addresses in hot paths, and falls back to a deep comparison only for other
+// types of socket addresses.
+func (a Sockaddr) Equal(other Sockaddr) bool {
+	if a.Sockaddr == nil || other.Sockaddr == nil {
+		return a.Sockaddr == nil && other.Sockaddr == nil
+	}
+	switch sockaddr := a.Sockaddr.(type) {
+	case *unix.SockaddrInet4:
+		o, ok := other.Sockaddr.(*unix.SockaddrInet4)
+		return ok && sockaddr.Port == o.Port && sockaddr.Addr == o.Addr
+	case *unix.SockaddrInet6:
+		o, ok := other.Sockaddr.(*unix.SockaddrInet6)
+		return ok && sockaddr.Port == o.Port && sockaddr.ZoneId == o.ZoneId &&
+			sockaddr.Addr == o.Addr
+	case *unix.SockaddrUnix:
+		o, ok := other.Sockaddr.(*unix.SockaddrUnix)
+		return ok && sockaddr.Name == o.Name
+	case *unix.SockaddrLinklayer:
+		o, ok := other.Sockaddr.(*unix.SockaddrLinklayer)
+		return ok && sockaddr.Protocol == o.Protocol && sockaddr.Ifindex == o.Ifindex &&
+			sockaddr.Hatype == o.Hatype && sockaddr.Pkttype == o.Pkttype &&
+			sockaddr.Halen == o.Halen && sockaddr.Addr == o.Addr
+	case *unix.SockaddrNetlink:
+		o, ok := other.Sockaddr.(*unix.SockaddrNetlink)
+		return ok && sockaddr.Family == o.Family && sockaddr.Pid == o.Pid &&
+			sockaddr.Groups == o.Groups
+	case *unix.SockaddrVM:
+		o, ok := other.Sockaddr.(*unix.SockaddrVM)
+		return ok && sockaddr.Port == o.Port && sockaddr.CID == o.CID &&
+			sockaddr.Flags == o.Flags
+	case *unix.SockaddrXDP:
+		o, ok := other.Sockaddr.(*unix.SockaddrXDP)
+		return ok && sockaddr.Flags == o.Flags && sockaddr.Ifindex == o.Ifindex &&
+			sockaddr.QueueID == o.QueueID && sockaddr.SharedUmemFD == o.SharedUmemFD
+	}
+	return reflect.DeepEqual(a.Sockaddr, other.Sockaddr)
+}
+
+// NetAddr returns the wrapped socket address as a net.Addr for a socket of the
+// specified type, so that addresses can be compared structurally, such as by
+// port or by IP containment in a network, instead of by their textual
+// representations. IP socket addresses of datagram sockets are returned as
+// *net.UDPAddr, of raw sockets as *net.IPAddr, and otherwise as *net.TCPAddr.
+// As a socket address doesn't tell the network namespace its zone belongs to,
+// the zones of IPv6 socket addresses are returned as decimal interface
+// indices; see [SocketFd.NetAddr] for zones as network interface names. Unix
+// domain socket addresses are returned as *net.UnixAddr. NetAddr returns nil
+// for nil socket addresses and socket addresses without net.Addr equivalent.
+func (a Sockaddr) NetAddr(typ SocketType) net.Addr {
+	return a.netAddr(typ, "")
+}
+
+// netAddr returns the wrapped socket address as a net.Addr for a socket of the
+// specified type, using the specified zone name for IPv6 socket addresses with
+// a zone. If the zone name is empty, the decimal zone ID is used instead.
+func (a Sockaddr) netAddr(typ SocketType, zone string) net.Addr {
+	var ip net.IP
+	var port int
+	switch sockaddr := a.Sockaddr.(type) {
+	case *unix.SockaddrInet4:
+		ip, port, zone = net.IP(sockaddr.Addr[:]).To4(), sockaddr.Port, ""
+	case *unix.SockaddrInet6:
+		ip, port = net.IP(sockaddr.Addr[:]), sockaddr.Port
+		switch {
+		case sockaddr.ZoneId == 0:
+			zone = ""
+		case zone == "":
+			zone = strconv.FormatUint(uint64(sockaddr.ZoneId), 10)
+		}
+	case *unix.SockaddrUnix:
+		switch typ {
+		case unix.SOCK_DGRAM:
+			return &net.UnixAddr{Name: sockaddr.Name, Net: "unixgram"}
+		case unix.SOCK_SEQPACKET:
+			return &net.UnixAddr{Name: sockaddr.Name, Net: "unixpacket"}
+		}
+		return &net.UnixAddr{Name: sockaddr.Name, Net: "unix"}
+	default:
+		return nil
+	}
+	switch typ {
+	case unix.SOCK_DGRAM:
+		return &net.UDPAddr{IP: ip, Port: port, Zone: zone}
+	case unix.SOCK_RAW:
+		return &net.IPAddr{IP: ip, Zone: zone}
+	}
+	return &net.TCPAddr{IP: ip, Port: port, Zone: zone}
+}
+
+// zoneName returns the name of the network interface that is the zone of the
+// specified IPv6 socket address, as seen from the network namespace of the
+// process with the specified procfs base directory, such as "/proc/42". As
+// zones are only used with link-local addresses, and IPv6-enabled interfaces
+// always have a link-local address, zoneName looks up the zone in the
+// process's "net/if_inet6" table. For other socket addresses, socket addresses
+// without zone, and unknown zones zoneName returns "".
+func zoneName(procBase string, sa unix.Sockaddr) string {
+	sockaddr, ok := sa.(*unix.SockaddrInet6)
+	if !ok || sockaddr.ZoneId == 0 {
+		return ""
+	}
+	ifinet6, err := readFile(procBase + "/net/if_inet6")
+	if err != nil {
+		return ""
+	}
+	// Each line consists of the IPv6 address, the interface index, prefix
+	// length, scope, and flags in hex, and finally the interface name.
+	for _, line := range strings.Split(string(ifinet6), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		index, err := strconv.ParseUint(fields[1], 16, 32)
+		if err == nil && uint32(index) == sockaddr.ZoneId {
+			return fields[5]
+		}
+	}
+	return ""
+}
+
 // ipv6AddrFormat returns the single-line textual representation of an IPv6
 // socket address (which includes the port number, as well as optionally the
 // zone ID if not zero).
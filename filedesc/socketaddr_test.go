@@ -19,6 +19,7 @@ package filedesc
 import (
 	"fmt"
 	"net"
+	"os"
 
 	"golang.org/x/sys/unix"
 
@@ -32,6 +33,76 @@ var _ = Describe("socket address", func() {
 		Expect(Sockaddr{}.String()).To(BeEmpty())
 	})
 
+	DescribeTable("compares socket addresses",
+		func(a, b unix.Sockaddr, equal bool) {
+			Expect(Sockaddr{a}.Equal(Sockaddr{b})).To(Equal(equal))
+			Expect(Sockaddr{b}.Equal(Sockaddr{a})).To(Equal(equal))
+		},
+		Entry("nil", nil, nil, true),
+		Entry("nil and non-nil", nil, &unix.SockaddrUnix{}, false),
+		Entry("different types", &unix.SockaddrInet4{}, &unix.SockaddrInet6{}, false),
+		Entry("IPv4", &unix.SockaddrInet4{Port: 1, Addr: [4]byte{127, 0, 0, 1}},
+			&unix.SockaddrInet4{Port: 1, Addr: [4]byte{127, 0, 0, 1}}, true),
+		Entry("IPv4 ports", &unix.SockaddrInet4{Port: 1}, &unix.SockaddrInet4{Port: 2}, false),
+		Entry("IPv6 zones", &unix.SockaddrInet6{ZoneId: 1}, &unix.SockaddrInet6{ZoneId: 2}, false),
+		Entry("IPv6", &unix.SockaddrInet6{Port: 1, ZoneId: 2, Addr: [16]byte{0xfe, 0x80}},
+			&unix.SockaddrInet6{Port: 1, ZoneId: 2, Addr: [16]byte{0xfe, 0x80}}, true),
+		Entry("unix", &unix.SockaddrUnix{Name: "@foo"}, &unix.SockaddrUnix{Name: "@foo"}, true),
+		Entry("unix names", &unix.SockaddrUnix{Name: "@foo"}, &unix.SockaddrUnix{Name: "@bar"}, false),
+		Entry("link layer", &unix.SockaddrLinklayer{Ifindex: 1}, &unix.SockaddrLinklayer{Ifindex: 1}, true),
+		Entry("link layer protocols", &unix.SockaddrLinklayer{Protocol: 1}, &unix.SockaddrLinklayer{Protocol: 2}, false),
+		Entry("netlink", &unix.SockaddrNetlink{Pid: 42}, &unix.SockaddrNetlink{Pid: 42}, true),
+		Entry("netlink groups", &unix.SockaddrNetlink{Groups: 1}, &unix.SockaddrNetlink{Groups: 2}, false),
+		Entry("VM", &unix.SockaddrVM{CID: 3}, &unix.SockaddrVM{CID: 3}, true),
+		Entry("VM ports", &unix.SockaddrVM{Port: 1}, &unix.SockaddrVM{Port: 2}, false),
+		Entry("XDP", &unix.SockaddrXDP{QueueID: 1}, &unix.SockaddrXDP{QueueID: 1}, true),
+		Entry("XDP ifindices", &unix.SockaddrXDP{Ifindex: 1}, &unix.SockaddrXDP{Ifindex: 2}, false),
+		Entry("other", &unix.SockaddrL2{PSM: 1}, &unix.SockaddrL2{PSM: 1}, true),
+		Entry("other PSMs", &unix.SockaddrL2{PSM: 1}, &unix.SockaddrL2{PSM: 2}, false),
+	)
+
+	It("returns net.Addrs", func() {
+		Expect(Sockaddr{}.NetAddr(unix.SOCK_STREAM)).To(BeNil())
+		Expect(Sockaddr{Sockaddr: &unix.SockaddrNetlink{}}.NetAddr(unix.SOCK_RAW)).To(BeNil())
+
+		inet4 := Sockaddr{Sockaddr: &unix.SockaddrInet4{Port: 1234, Addr: [4]byte{10, 1, 2, 3}}}
+		Expect(inet4.NetAddr(unix.SOCK_STREAM)).To(Equal(
+			&net.TCPAddr{IP: net.IPv4(10, 1, 2, 3).To4(), Port: 1234}))
+		Expect(inet4.NetAddr(unix.SOCK_DGRAM)).To(Equal(
+			&net.UDPAddr{IP: net.IPv4(10, 1, 2, 3).To4(), Port: 1234}))
+		Expect(inet4.NetAddr(unix.SOCK_RAW)).To(Equal(
+			&net.IPAddr{IP: net.IPv4(10, 1, 2, 3).To4()}))
+
+		inet6 := Sockaddr{Sockaddr: &unix.SockaddrInet6{Port: 1234, ZoneId: 2,
+			Addr: [16]byte{0xfe, 0x80, 15: 1}}}
+		Expect(inet6.NetAddr(unix.SOCK_STREAM)).To(Equal(
+			&net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 1234, Zone: "2"}))
+		Expect(inet6.netAddr(unix.SOCK_STREAM, "eth0")).To(HaveField("Zone", "eth0"))
+
+		unixaddr := Sockaddr{Sockaddr: &unix.SockaddrUnix{Name: "@foo"}}
+		Expect(unixaddr.NetAddr(unix.SOCK_STREAM)).To(Equal(
+			&net.UnixAddr{Name: "@foo", Net: "unix"}))
+		Expect(unixaddr.NetAddr(unix.SOCK_DGRAM)).To(Equal(
+			&net.UnixAddr{Name: "@foo", Net: "unixgram"}))
+		Expect(unixaddr.NetAddr(unix.SOCK_SEQPACKET)).To(Equal(
+			&net.UnixAddr{Name: "@foo", Net: "unixpacket"}))
+	})
+
+	It("names zones as seen from the owner's network namespace", func() {
+		procBase := GinkgoT().TempDir()
+		Expect(os.Mkdir(procBase+"/net", 0o755)).To(Succeed())
+		Expect(os.WriteFile(procBase+"/net/if_inet6", []byte(
+			"00000000000000000000000000000001 01 80 10 80       lo\n"+
+				"fe8000000000000000fc00fffe000001 2a 40 20 80    veth0\n"),
+			0o644)).To(Succeed())
+
+		Expect(zoneName(procBase, &unix.SockaddrInet6{ZoneId: 42})).To(Equal("veth0"))
+		Expect(zoneName(procBase, &unix.SockaddrInet6{ZoneId: 43})).To(BeEmpty())
+		Expect(zoneName(procBase, &unix.SockaddrInet6{})).To(BeEmpty())
+		Expect(zoneName(procBase, &unix.SockaddrInet4{})).To(BeEmpty())
+		Expect(zoneName("/nonexisting", &unix.SockaddrInet6{ZoneId: 42})).To(BeEmpty())
+	})
+
 	It("defaults to struct dumping", func() {
 		a := Sockaddr{Sockaddr: &unix.SockaddrL2{}}
 		Expect(a.String()).To(Equal(fmt.Sprintf("%#v", a.Sockaddr)))
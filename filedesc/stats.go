@@ -0,0 +1,73 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// DiscoveryStats accumulates timing data about fd discoveries, so that
+// performance-conscious test suites can measure and budget the overhead fd
+// discovery adds per spec. Pass a DiscoveryStats to [WithStats] in order to
+// collect the stats of one or more discoveries.
+type DiscoveryStats struct {
+	Calls      int           // number of discoveries.
+	Fds        int           // number of file descriptors discovered.
+	Duration   time.Duration // total time spent discovering.
+	Enrichment time.Duration // part of Duration spent enriching individual fds.
+	Syscalls   uint64        // number of syscalls issued.
+}
+
+// Description returns a pretty formatted single-line textual description of
+// the discovery stats.
+func (s DiscoveryStats) Description(indentation uint) string {
+	return fmt.Sprintf("%s%d discoveries of %d fds, took %s (enrichment %s), ~%d syscalls",
+		Indentation(indentation), s.Calls, s.Fds, s.Duration, s.Enrichment, s.Syscalls)
+}
+
+// WithStats adds the timing data of the discovery to the specified stats. The
+// number of syscalls is counted process-wide, so concurrent discoveries
+// inflate each other's syscall counts.
+func WithStats(stats *DiscoveryStats) DiscoveryOption {
+	return func(o *discoveryOptions) {
+		o.stats = stats
+	}
+}
+
+// syscalls counts the number of syscalls issued during discoveries, as counted
+// by the syscall wrappers in syscalls.go.
+var syscalls atomic.Uint64
+
+// countSyscalls notes the specified number of syscalls having been issued.
+func countSyscalls(n uint64) { syscalls.Add(n) }
+
+// trackStats starts accounting a discovery in the discovery's stats, if any,
+// returning a function that must be called when the discovery is done.
+func (o *discoveryOptions) trackStats() func() {
+	if o == nil || o.stats == nil {
+		return func() {}
+	}
+	stats := o.stats
+	start, startSyscalls := time.Now(), syscalls.Load()
+	stats.Calls++
+	return func() {
+		stats.Duration += time.Since(start)
+		stats.Syscalls += syscalls.Load() - startSyscalls
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("discovery stats", func() {
+
+	It("accumulates discovery stats", func() {
+		var stats DiscoveryStats
+		fds := FiledescriptorsWith(WithStats(&stats))
+		Expect(fds).NotTo(BeEmpty())
+		Expect(stats.Calls).To(Equal(1))
+		Expect(stats.Fds).To(Equal(len(fds)))
+		Expect(stats.Duration).To(BeNumerically(">", 0))
+		Expect(stats.Enrichment).To(BeNumerically("<=", stats.Duration))
+		// at least opening the directory, reading each fd link and fdinfo.
+		Expect(stats.Syscalls).To(BeNumerically(">=", 3+4*len(fds)))
+
+		prev := stats
+		fds = FiledescriptorsWith(OnlyFdRange(0, 2), WithStats(&stats))
+		Expect(stats.Calls).To(Equal(2))
+		Expect(stats.Fds).To(Equal(prev.Fds + len(fds)))
+		Expect(stats.Duration).To(BeNumerically(">", prev.Duration))
+		Expect(stats.Syscalls).To(BeNumerically(">", prev.Syscalls))
+
+		Expect(stats.Description(1)).To(MatchRegexp(
+			`^\s+2 discoveries of \d+ fds, took .+ \(enrichment .+\), ~\d+ syscalls$`))
+	})
+
+	It("counts the syscalls issued by the syscall wrappers", Serial, func() {
+		before := syscalls.Load()
+		Expect(readFile(ProcRoot + "/self/stat")).NotTo(BeEmpty())
+		Expect(syscalls.Load()-before).To(Equal(uint64(4)), "open, read, read EOF, close")
+
+		before = syscalls.Load()
+		dirfd := Successful(openDir(ProcRoot + "/self/fd"))
+		Expect(readDirnames(dirfd, ProcRoot+"/self/fd")).NotTo(BeEmpty())
+		Expect(closeFd(dirfd)).To(Succeed())
+		Expect(syscalls.Load()-before).To(Equal(uint64(4)), "open, getdents, getdents EOF, close")
+	})
+
+})
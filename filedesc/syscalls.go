@@ -0,0 +1,133 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// The syscall wrappers in this file count each syscall they issue, so that
+// the syscall counts of the discovery stats follow the code instead of
+// needing to be kept in sync by hand.
+
+// counted passes on the results of a single syscall, counting the syscall.
+func counted[T any](v T, err error) (T, error) {
+	countSyscalls(1)
+	return v, err
+}
+
+// countedErr passes on the error of a single syscall, counting the syscall.
+func countedErr(err error) error {
+	countSyscalls(1)
+	return err
+}
+
+// closeFd closes the specified fd.
+func closeFd(fd int) error { return countedErr(unix.Close(fd)) }
+
+// countedFile is a file opened read-only.
+type countedFile struct {
+	fd   int
+	name string
+}
+
+// openFile opens the named file read-only. In contrast to [os.Open], openFile
+// doesn't try to register the file with the Go runtime's netpoller.
+func openFile(name string) (*countedFile, error) {
+	fd, err := counted(unix.Open(name, unix.O_RDONLY|unix.O_CLOEXEC, 0))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &countedFile{fd: fd, name: name}, nil
+}
+
+// Read reads up to len(p) bytes from the file, returning io.EOF at the end of
+// the file.
+func (f *countedFile) Read(p []byte) (int, error) {
+	n, err := counted(unix.Read(f.fd, p))
+	if err != nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Close closes the file.
+func (f *countedFile) Close() error { return closeFd(f.fd) }
+
+// recvfrom receives a message from the socket with the specified fd, ignoring
+// the sender address.
+func recvfrom(fd int, p []byte) (int, error) {
+	n, _, err := unix.Recvfrom(fd, p, 0)
+	countSyscalls(1)
+	return n, err
+}
+
+// readFile returns the contents of the named file.
+func readFile(name string) ([]byte, error) {
+	f, err := openFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// readlinkCounted returns the destination of the named symbolic link.
+func readlinkCounted(name string) (string, error) {
+	for size := 128; ; size *= 2 {
+		buf := make([]byte, size)
+		n, err := counted(unix.Readlink(name, buf))
+		if err != nil {
+			return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+		}
+		if n < size {
+			return string(buf[:n]), nil
+		}
+	}
+}
+
+// openDir opens the named directory, returning its fd.
+func openDir(name string) (int, error) {
+	fd, err := counted(unix.Open(name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0))
+	if err != nil {
+		return -1, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return fd, nil
+}
+
+// readDirnames returns the names of the entries of the directory with the
+// specified fd, without "." and "..".
+func readDirnames(dirfd int, name string) ([]string, error) {
+	buf := make([]byte, 8192)
+	names := []string{}
+	for {
+		n, err := counted(unix.Getdents(dirfd, buf))
+		if err != nil {
+			return nil, &os.PathError{Op: "readdirent", Path: name, Err: err}
+		}
+		if n <= 0 {
+			return names, nil
+		}
+		_, _, names = unix.ParseDirent(buf[:n], -1, names)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TCPState specifies the state of a TCP socket and implements a Stringer
+// returning the symbolic state name, such as "ESTABLISHED". A negative TCPState
+// means that the state is unknown.
+type TCPState int
+
+// tcpStateNames maps the TCP states to their corresponding textual
+// representations.
+var tcpStateNames = map[int]string{
+	unix.BPF_TCP_ESTABLISHED:  "ESTABLISHED",
+	unix.BPF_TCP_SYN_SENT:     "SYN_SENT",
+	unix.BPF_TCP_SYN_RECV:     "SYN_RECV",
+	unix.BPF_TCP_FIN_WAIT1:    "FIN_WAIT1",
+	unix.BPF_TCP_FIN_WAIT2:    "FIN_WAIT2",
+	unix.BPF_TCP_TIME_WAIT:    "TIME_WAIT",
+	unix.BPF_TCP_CLOSE:        "CLOSE",
+	unix.BPF_TCP_CLOSE_WAIT:   "CLOSE_WAIT",
+	unix.BPF_TCP_LAST_ACK:     "LAST_ACK",
+	unix.BPF_TCP_LISTEN:       "LISTEN",
+	unix.BPF_TCP_CLOSING:      "CLOSING",
+	unix.BPF_TCP_NEW_SYN_RECV: "NEW_SYN_RECV",
+}
+
+// String returns the symbolic name of the TCP state, or its number if unknown.
+func (s TCPState) String() string {
+	if name, ok := tcpStateNames[int(s)]; ok {
+		return name
+	}
+	return strconv.Itoa(int(s))
+}
+
+// tcpDetails returns the state, the receive and send queue lengths in bytes, as
+// well as the time since the last data or ACK segment was received of the TCP
+// socket with the specified (useable) fd. As the SIOCINQ and SIOCOUTQ ioctls
+// fail with EINVAL on listening sockets, for them tcpDetails instead returns
+// the number of connections waiting to be accepted and the accept backlog, as
+// reported by TCP_INFO (and similar to what "ss" shows for listeners).
+func tcpDetails(fd int) (state TCPState, recvq int, sendq int, sinceRecv time.Duration, err error) {
+	info, err := counted(unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO))
+	if err != nil {
+		return -1, -1, -1, -1, err
+	}
+	// As the peer's FIN segment also acknowledges, the time since the last
+	// received ACK tells for how long a socket has been in CLOSE_WAIT.
+	sinceRecv = time.Duration(min(info.Last_data_recv, info.Last_ack_recv)) * time.Millisecond
+	if info.State == unix.BPF_TCP_LISTEN {
+		return TCPState(info.State), int(info.Unacked), int(info.Sacked), sinceRecv, nil
+	}
+	if recvq, err = counted(unix.IoctlGetInt(fd, unix.SIOCINQ)); err != nil {
+		return -1, -1, -1, -1, err
+	}
+	if sendq, err = counted(unix.IoctlGetInt(fd, unix.SIOCOUTQ)); err != nil {
+		return -1, -1, -1, -1, err
+	}
+	return TCPState(info.State), recvq, sendq, sinceRecv, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ProcessDescendants returns the PIDs of the descendants of the process
+// identified by pid, that is, its children, grandchildren, and so on, in
+// breadth-first order. As processes come and go, the descendants are only a
+// snapshot of the process tree.
+func ProcessDescendants(pid int) ([]int, error) {
+	return processDescendants(ProcRoot, pid)
+}
+
+// processDescendants returns the PIDs of the descendants of the process
+// identified by pid, based on the parent PIDs of all processes in the procfs
+// mounted at root.
+func processDescendants(root string, pid int) ([]int, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	children := map[int][]int{}
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil || child <= 0 {
+			continue
+		}
+		ppid, err := parentPID(fmt.Sprintf("%s/%d/stat", root, child))
+		if err != nil {
+			continue // skip processes gone in the meantime.
+		}
+		children[ppid] = append(children[ppid], child)
+	}
+	var descendants []int
+	parents := []int{pid}
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+		descendants = append(descendants, children[parent]...)
+		parents = append(parents, children[parent]...)
+	}
+	return descendants, nil
+}
+
+// parentPID returns the parent PID from the specified procfs process stat
+// file.
+func parentPID(statPath string) (int, error) {
+	stat, err := os.ReadFile(statPath)
+	if err != nil {
+		return 0, err
+	}
+	idx := bytes.LastIndexByte(stat, ')')
+	if idx < 0 {
+		return 0, fmt.Errorf("malformed process stat %q", statPath)
+	}
+	// After the process name follow the fields starting with (3) state, so
+	// (4) ppid is at index 1.
+	fields := bytes.Fields(stat[idx+1:])
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("incomplete process stat %q", statPath)
+	}
+	return strconv.Atoi(string(fields[1]))
+}
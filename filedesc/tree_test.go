@@ -0,0 +1,68 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("process tree", func() {
+
+	It("discovers descendants from a fake procfs", func() {
+		root := GinkgoT().TempDir()
+		for pid, stat := range map[int]string{
+			10: "10 (init) S 1 10 10",
+			11: "11 (we) ird) S 10 11 11",
+			12: "12 (grand) S 11 12 12",
+			13: "13 (other) S 1 13 13",
+			14: "14 (child2) S 10 14 14",
+			15: "15 (broken",
+		} {
+			Expect(os.MkdirAll(filepath.Join(root, fmt.Sprint(pid)), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(root, fmt.Sprint(pid), "stat"), []byte(stat+"\n"), 0o644)).To(Succeed())
+		}
+		Expect(os.Mkdir(filepath.Join(root, "self"), 0o755)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(root, "16"), 0o755)).To(Succeed())
+
+		Expect(processDescendants(root, 10)).To(HaveExactElements(11, 14, 12))
+		Expect(processDescendants(root, 12)).To(BeEmpty())
+		Expect(processDescendants(filepath.Join(root, "missing"), 10)).Error().To(HaveOccurred())
+		Expect(parentPID(filepath.Join(root, "15", "stat"))).Error().To(MatchError(ContainSubstring("malformed")))
+	})
+
+	It("discovers the descendants of a child", func() {
+		cmd := exec.Command("sh", "-c", "sleep 10 & wait")
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		Expect(cmd.Start()).To(Succeed())
+		DeferCleanup(func() {
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			_ = cmd.Wait()
+		})
+		Eventually(func() ([]int, error) { return ProcessDescendants(cmd.Process.Pid) }).
+			Should(HaveLen(1))
+		Expect(Successful(ProcessDescendants(os.Getpid()))).To(ContainElement(cmd.Process.Pid))
+	})
+
+})
@@ -0,0 +1,146 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// OverflowID is the user and group ID processes see for IDs that are not
+// mapped into their user namespace, see also /proc/sys/kernel/overflowuid.
+const OverflowID = 65534
+
+// IDMap maps user or group IDs between the user namespace of a process and the
+// user namespace of the process reading the map, as found in the procfs
+// uid_map and gid_map files; see also [user_namespaces(7)].
+//
+// [user_namespaces(7)]: https://man7.org/linux/man-pages/man7/user_namespaces.7.html
+type IDMap []IDMapRange
+
+// IDMapRange is a single range of consecutive IDs in an IDMap.
+type IDMapRange struct {
+	Inside  uint32 // first ID inside the user namespace of the process.
+	Outside uint32 // first ID as seen from the user namespace of the reader.
+	Length  uint32 // number of consecutive IDs mapped.
+}
+
+// ProcessUIDMap returns the user ID map of the process identified by pid.
+func ProcessUIDMap(pid int) (IDMap, error) {
+	return readIDMap(procPIDPath(pid) + "/uid_map")
+}
+
+// ProcessGIDMap returns the group ID map of the process identified by pid.
+func ProcessGIDMap(pid int) (IDMap, error) {
+	return readIDMap(procPIDPath(pid) + "/gid_map")
+}
+
+// readIDMap returns the ID map read from the specified procfs uid_map or
+// gid_map file.
+func readIDMap(path string) (IDMap, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return idMapFromReader(f)
+}
+
+// idMapFromReader returns the ID map read from the specified reader.
+func idMapFromReader(r io.Reader) (IDMap, error) {
+	m := IDMap{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed ID map line %q", scanner.Text())
+		}
+		var ids [3]uint32
+		for idx, field := range fields {
+			id, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			ids[idx] = uint32(id)
+		}
+		m = append(m, IDMapRange{Inside: ids[0], Outside: ids[1], Length: ids[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// idMaps are the user and group ID maps of a process, where nil maps couldn't
+// be read.
+type idMaps struct {
+	uids, gids IDMap
+}
+
+// idsInside translates the specified user and group IDs as seen from the user
+// namespace of the calling process into the IDs as seen from inside the user
+// namespace of the process with the procfs directory at procBase. IDs whose
+// map cannot be read are returned as-is. The ID maps are read only once per
+// discovery and process.
+func idsInside(procBase string, uid, gid uint32, o *discoveryOptions) (uint32, uint32) {
+	maps := o.idMapsOf(procBase)
+	if maps.uids != nil {
+		uid = maps.uids.ToInside(uid)
+	}
+	if maps.gids != nil {
+		gid = maps.gids.ToInside(gid)
+	}
+	return uid, gid
+}
+
+// idMapsOf returns the ID maps of the process with the procfs directory at
+// procBase, reading them only on first use in a discovery.
+func (o *discoveryOptions) idMapsOf(procBase string) idMaps {
+	if o != nil {
+		if maps, ok := o.idMaps[procBase]; ok {
+			return maps
+		}
+	}
+	var maps idMaps
+	maps.uids, _ = readIDMap(procBase + "/uid_map")
+	maps.gids, _ = readIDMap(procBase + "/gid_map")
+	if o != nil {
+		if o.idMaps == nil {
+			o.idMaps = map[string]idMaps{}
+		}
+		o.idMaps[procBase] = maps
+	}
+	return maps
+}
+
+// ToInside translates an ID as seen from the user namespace of the reader of
+// the map into the ID as seen inside the user namespace of the process. IDs not
+// mapped into the user namespace are translated into [OverflowID].
+func (m IDMap) ToInside(id uint32) uint32 {
+	for _, r := range m {
+		if id >= r.Outside && uint64(id) < uint64(r.Outside)+uint64(r.Length) {
+			return r.Inside + (id - r.Outside)
+		}
+	}
+	return OverflowID
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filedesc
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/onsi/gomega/gexec"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("user namespaces", func() {
+
+	It("parses ID maps", func() {
+		m := Successful(idMapFromReader(strings.NewReader(
+			"         0       1000          1\n         1     100000      65536\n")))
+		Expect(m).To(ConsistOf(
+			IDMapRange{Inside: 0, Outside: 1000, Length: 1},
+			IDMapRange{Inside: 1, Outside: 100000, Length: 65536}))
+		Expect(m.ToInside(1000)).To(Equal(uint32(0)))
+		Expect(m.ToInside(100000)).To(Equal(uint32(1)))
+		Expect(m.ToInside(100041)).To(Equal(uint32(42)))
+		Expect(m.ToInside(0)).To(Equal(uint32(OverflowID)))
+		Expect(m.ToInside(165536)).To(Equal(uint32(OverflowID)))
+
+		Expect(IDMap{{Inside: 0, Outside: 0, Length: 4294967295}}.ToInside(4294967294)).
+			To(Equal(uint32(4294967294)))
+
+		Expect(idMapFromReader(strings.NewReader("0 1000\n"))).Error().To(HaveOccurred())
+		Expect(idMapFromReader(strings.NewReader("0 1000 foo\n"))).Error().To(HaveOccurred())
+	})
+
+	It("reads the ID maps of a process", func() {
+		Expect(ProcessUIDMap(os.Getpid())).NotTo(BeEmpty())
+		Expect(ProcessGIDMap(os.Getpid())).NotTo(BeEmpty())
+		Expect(ProcessUIDMap(-1)).Error().To(HaveOccurred())
+	})
+
+	It("reads the ID maps only once per discovery", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(dir+"/uid_map", []byte("0 1000 1\n"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(dir+"/gid_map", []byte("0 2000 1\n"), 0o600)).To(Succeed())
+
+		o := &discoveryOptions{}
+		uid, gid := idsInside(dir, 1000, 2000, o)
+		Expect(uid).To(BeZero())
+		Expect(gid).To(BeZero())
+
+		Expect(os.Remove(dir + "/uid_map")).To(Succeed())
+		Expect(os.Remove(dir + "/gid_map")).To(Succeed())
+		uid, gid = idsInside(dir, 1000, 2000, o)
+		Expect(uid).To(BeZero())
+		Expect(gid).To(BeZero())
+
+		uid, gid = idsInside(dir, 1000, 2000, nil)
+		Expect(uid).To(Equal(uint32(1000)))
+		Expect(gid).To(Equal(uint32(2000)))
+	})
+
+	It("discovers fds of a process in a child user namespace", func() {
+		unsharePath, err := exec.LookPath("unshare")
+		if err != nil {
+			Skip("needs unshare")
+		}
+		if exec.Command(unsharePath, "-U", "--map-user=1234", "--map-group=1234", "true").Run() != nil {
+			Skip("needs unprivileged user namespaces")
+		}
+		shm, err := os.CreateTemp("/dev/shm", "fdooze-*")
+		if err != nil {
+			Skip("needs /dev/shm")
+		}
+		defer os.Remove(shm.Name())
+		defer shm.Close()
+
+		sockfds := Successful(unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0))
+		defer unix.Close(sockfds[0])
+		sock := os.NewFile(uintptr(sockfds[1]), "socketpair")
+		defer sock.Close()
+
+		cmd := exec.Command(unsharePath, "-U", "--map-user=1234", "--map-group=1234",
+			"sleep", "30")
+		cmd.ExtraFiles = []*os.File{shm, sock} // become fds 3 and 4
+		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		defer session.Kill()
+		pid := session.Command.Process.Pid
+
+		// wait for unshare to have set up the ID maps and exec'ed sleep.
+		Eventually(func() string {
+			comm, _ := os.ReadFile(procPIDPath(pid) + "/comm")
+			return strings.TrimSpace(string(comm))
+		}).Within(2 * time.Second).ProbeEvery(50 * time.Millisecond).Should(Equal("sleep"))
+		Expect(Successful(ProcessUIDMap(pid)).ToInside(uint32(os.Getuid()))).To(Equal(uint32(1234)))
+
+		fds := Successful(ProcessFiledescriptors(pid))
+		Expect(fds).To(ContainElement(And(
+			BeAssignableToTypeOf(&ShmFd{}),
+			HaveField("FdNo()", 3),
+			HaveField("UID()", uint32(1234)),
+			HaveField("GID()", uint32(1234)))))
+		// the socket pair has been created by us, so its peer credentials
+		// carry our IDs, as seen from inside the child user namespace.
+		Expect(fds).To(ContainElement(And(
+			BeAssignableToTypeOf(&SocketFd{}),
+			HaveField("FdNo()", 4),
+			HaveField("PeerCred()", And(
+				HaveField("Pid", int32(os.Getpid())),
+				HaveField("Uid", uint32(1234)),
+				HaveField("Gid", uint32(1234)))))))
+	})
+
+})
@@ -1,4 +1,4 @@
-// Copyright 2023 Harald Albrecht.
+// Copyright 2022 Harald Albrecht.
 //
 // Licensed under the Apache License, Version 2.0 (the "License"); you may not
 // use this file except in compliance with the License. You may obtain a copy
@@ -12,28 +12,22 @@
 // License for the specific language governing permissions and limitations
 // under the License.
 
-package main
+//go:build linux
 
-import (
-	"net"
+package filedesc
 
-	"github.com/thediveo/fdooze/filedesc/test/canary/cage"
-	"golang.org/x/sys/unix"
+import (
+	"os"
+	"strconv"
+	"strings"
 )
 
-func main() {
-	canaryfd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+// InotifyMaxUserWatches returns the system-wide limit on the number of inotify
+// watches per user, as configured by the fs.inotify.max_user_watches sysctl.
+func InotifyMaxUserWatches() (int, error) {
+	limit, err := os.ReadFile(ProcRoot + "/sys/fs/inotify/max_user_watches")
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
-	defer unix.Close(canaryfd)
-
-	unix.Connect(canaryfd, &unix.SockaddrInet4{
-		// https://tip.golang.org/ref/spec#Conversions, sub heading "Conversions
-		// from slice to array or array pointer"
-		Addr: *(*[4]byte)(net.ParseIP(cage.IP).To4()),
-		Port: cage.Port,
-	})
-
-	select {}
+	return strconv.Atoi(strings.TrimSpace(string(limit)))
 }
@@ -0,0 +1,129 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fixtures
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ChurnMaxHold is the maximum duration a [Churn] worker holds a churned fd
+// open before closing it again.
+var ChurnMaxHold = 100 * time.Microsecond
+
+// Churn is a randomized fd churn generator that rapidly opens and closes fds
+// of mixed kinds in the calling process, such as files, pipes, sockets,
+// eventfds, and timerfds. Running fd discoveries while churning allows
+// verifying race stabilization and quorum matching under realistic
+// contention:
+//
+//	churn := fixtures.StartChurn(4, 42)
+//	defer churn.Stop()
+//	Eventually(func() []FileDescriptor {
+//	    return Quorum(3, Filedescriptors)
+//	}).ShouldNot(HaveLeakedFds(goodfds))
+//
+// The churned fds are always opened with their close-on-exec flag set.
+type Churn struct {
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+	cycles atomic.Uint64
+}
+
+// churners open fds of different kinds, returning the opened fds.
+var churners = []func() ([]int, error){
+	func() ([]int, error) { // file
+		fd, err := unix.Open("/dev/null", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		return []int{fd}, err
+	},
+	func() ([]int, error) { // pipe
+		var p [2]int
+		err := unix.Pipe2(p[:], unix.O_CLOEXEC)
+		return p[:], err
+	},
+	func() ([]int, error) { // unix domain socket pair
+		pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		return pair[:], err
+	},
+	func() ([]int, error) { // UDP socket
+		fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+		return []int{fd}, err
+	},
+	func() ([]int, error) { // eventfd
+		fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+		return []int{fd}, err
+	},
+	func() ([]int, error) { // timerfd
+		fd, err := unix.TimerfdCreate(unix.CLOCK_MONOTONIC, unix.TFD_CLOEXEC)
+		return []int{fd}, err
+	},
+}
+
+// StartChurn starts a new Churn with the specified number of workers, each
+// repeatedly opening fds of a randomly chosen kind, holding them open for a
+// random duration of up to [ChurnMaxHold], and then closing them again. The
+// random choices are seeded with the specified seed, so churns are
+// reproducible up to the scheduling of the workers.
+func StartChurn(workers int, seed uint64) *Churn {
+	c := &Churn{stop: make(chan struct{})}
+	for worker := range workers {
+		c.wg.Add(1)
+		go c.churn(rand.New(rand.NewPCG(seed, uint64(worker))))
+	}
+	return c
+}
+
+// churn runs a single churn worker until the churn is stopped.
+func (c *Churn) churn(rnd *rand.Rand) {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		fds, err := churners[rnd.IntN(len(churners))]()
+		if err == nil {
+			if hold := rnd.Int64N(int64(ChurnMaxHold) + 1); hold > 0 {
+				time.Sleep(time.Duration(hold))
+			}
+			for _, fd := range fds {
+				_ = unix.Close(fd)
+			}
+		}
+		c.cycles.Add(1)
+	}
+}
+
+// Cycles returns the number of open-close cycles so far.
+func (c *Churn) Cycles() uint64 {
+	return c.cycles.Load()
+}
+
+// Stop stops the churn, waiting for all workers to have closed their churned
+// fds, and returns the total number of open-close cycles. Stop can be called
+// multiple times.
+func (c *Churn) Stop() uint64 {
+	c.once.Do(func() { close(c.stop) })
+	c.wg.Wait()
+	return c.Cycles()
+}
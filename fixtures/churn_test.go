@@ -0,0 +1,44 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fixtures
+
+import (
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("fd churn", func() {
+
+	It("churns fds and cleans up", func() {
+		fdNos := Successful(filedesc.FdNumbers())
+
+		churn := StartChurn(4, 42)
+		Eventually(churn.Cycles).Should(BeNumerically(">", 100))
+		for range 10 {
+			Expect(filedesc.Filedescriptors()).NotTo(BeEmpty())
+		}
+		cycles := churn.Stop()
+		Expect(cycles).To(BeNumerically(">", 100))
+		Expect(churn.Stop()).To(Equal(cycles))
+
+		Expect(filedesc.FdNumbers()).To(Equal(fdNos))
+	})
+
+})
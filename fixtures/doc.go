@@ -0,0 +1,43 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+/*
+Package fixtures spawns configurable leaky fixture processes on demand, so that
+fd leak detection can be exercised systematically: the fixture processes open
+the configured numbers of files, sockets of various families, pipes, and
+timers when told to, and close them again when told to.
+
+	path, err := fixtures.Build()
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(gexec.CleanupBuildArtifacts)
+
+	fixture, err := fixtures.Start(path, fixtures.Spec{Files: 2, TCPListeners: 1}, GinkgoWriter, GinkgoWriter)
+	Expect(err).NotTo(HaveOccurred())
+	defer fixture.Stop()
+
+	goodfds, _ := session.FiledescriptorsFor(fixture.Session)
+	Expect(fixture.Leak()).To(Succeed())
+	Eventually(func() ([]FileDescriptor, error) {
+	    return session.FiledescriptorsFor(fixture.Session)
+	}).Should(HaveLeakedFds(goodfds))
+	Expect(fixture.Plumb()).To(Succeed())
+
+In order to verify fd discovery under realistic contention, [StartChurn]
+rapidly opens and closes fds of mixed kinds in the calling process, while
+[Spec.Churn] does the same in fixture processes.
+
+The fixture processes are implemented in Go, so they prime the Go runtime
+netpoller before reporting to be ready, in order to avoid false positives.
+*/
+package fixtures
@@ -0,0 +1,182 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fixtures
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/onsi/gomega/gexec"
+)
+
+// PackagePath is the package path of the leaky fixture program.
+const PackagePath = "github.com/thediveo/fdooze/fixtures/leaky"
+
+// Timeout is the maximum duration to wait for a fixture process to
+// acknowledge a step, such as having leaked its fds.
+var Timeout = 10 * time.Second
+
+// The markers printed by the leaky fixture program to its stdout after
+// completing a step.
+const (
+	MarkerReady   = "READY"
+	MarkerLeaked  = "LEAKED"
+	MarkerPlumbed = "PLUMBED"
+)
+
+// Spec specifies the fds a leaky fixture process leaks.
+type Spec struct {
+	Files        int    // number of fds for files opened read-only.
+	FilePath     string // path of the files to open; defaults to the fixture's own executable.
+	Pipes        int    // number of pipes, with two fds each.
+	TCPListeners int    // number of TCP sockets listening on the IPv4 loopback.
+	UDPSockets   int    // number of UDP sockets bound to the IPv4 loopback.
+	UDPPeer      string // optional IPv4 "addr:port" to connect the UDP sockets to.
+	UnixSockets  int    // number of unix domain stream socket pairs, with two fds each.
+	Timers       int    // number of timerfds.
+	Churn        int    // number of workers churning fds from start until exit, see [Churn].
+	ChurnSeed    uint64 // seed for churning fds.
+}
+
+// Args returns the command line arguments of the leaky fixture program for
+// this spec.
+func (s Spec) Args() []string {
+	var args []string
+	add := func(name string, n int) {
+		if n > 0 {
+			args = append(args, "-"+name, strconv.Itoa(n))
+		}
+	}
+	add("files", s.Files)
+	if s.FilePath != "" {
+		args = append(args, "-file", s.FilePath)
+	}
+	add("pipes", s.Pipes)
+	add("tcp", s.TCPListeners)
+	add("udp", s.UDPSockets)
+	if s.UDPPeer != "" {
+		args = append(args, "-udp-peer", s.UDPPeer)
+	}
+	add("unix", s.UnixSockets)
+	add("timers", s.Timers)
+	add("churn", s.Churn)
+	if s.Churn > 0 {
+		args = append(args, "-churn-seed", strconv.FormatUint(s.ChurnSeed, 10))
+	}
+	return args
+}
+
+// Fds returns the number of fds leaked according to this spec, not including
+// any churned fds.
+func (s Spec) Fds() int {
+	return s.Files + 2*s.Pipes + s.TCPListeners + s.UDPSockets + 2*s.UnixSockets + s.Timers
+}
+
+// Build builds the leaky fixture program using [gexec.Build], returning the
+// path of the binary. Use [gexec.CleanupBuildArtifacts] to remove the binary
+// when done.
+func Build() (string, error) {
+	return gexec.Build(PackagePath)
+}
+
+// Fixture is a running leaky fixture process.
+type Fixture struct {
+	Session *gexec.Session // session of the fixture process.
+	Spec    Spec           // fds to leak.
+	stdin   io.WriteCloser
+}
+
+// Start starts the leaky fixture program at the specified path with the
+// specified spec, waiting for the fixture process to become ready. The stdout
+// and stderr of the fixture process are additionally copied to the specified
+// writers, such as GinkgoWriter.
+func Start(path string, spec Spec, out, errOut io.Writer) (*Fixture, error) {
+	cmd := exec.Command(path, spec.Args()...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	session, err := gexec.Start(cmd, out, errOut)
+	if err != nil {
+		stdin.Close()
+		return nil, err
+	}
+	f := &Fixture{Session: session, Spec: spec, stdin: stdin}
+	if err := f.await(MarkerReady); err != nil {
+		f.Stop()
+		return nil, err
+	}
+	return f, nil
+}
+
+// PID returns the PID of the fixture process.
+func (f *Fixture) PID() int {
+	return f.Session.Command.Process.Pid
+}
+
+// Leak tells the fixture process to open the fds according to its spec and
+// waits for the fixture process to acknowledge.
+func (f *Fixture) Leak() error {
+	return f.step(MarkerLeaked)
+}
+
+// Plumb tells the fixture process to close the fds it leaked and waits for the
+// fixture process to acknowledge.
+func (f *Fixture) Plumb() error {
+	return f.step(MarkerPlumbed)
+}
+
+// Stop terminates the fixture process, waiting for it to exit.
+func (f *Fixture) Stop() {
+	f.stdin.Close()
+	f.Session.Terminate().Wait(Timeout)
+}
+
+// step advances the fixture process to its next step and waits for the
+// specified marker.
+func (f *Fixture) step(marker string) error {
+	if _, err := f.stdin.Write([]byte("\n")); err != nil {
+		return fmt.Errorf("fixture process %d: %w", f.PID(), err)
+	}
+	return f.await(marker)
+}
+
+// await waits for the fixture process to print the specified marker to its
+// stdout, failing if the fixture process exits or doesn't print the marker in
+// time.
+func (f *Fixture) await(marker string) error {
+	deadline := time.Now().Add(Timeout)
+	for {
+		if bytes.Contains(f.Session.Out.Contents(), []byte(marker+"\n")) {
+			return nil
+		}
+		select {
+		case <-f.Session.Exited:
+			return fmt.Errorf("fixture process %d exited with code %d while waiting for %s",
+				f.PID(), f.Session.ExitCode(), marker)
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timeout while waiting for fixture process to report " + marker)
+		}
+	}
+}
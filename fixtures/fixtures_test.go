@@ -0,0 +1,93 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fixtures
+
+import (
+	"github.com/onsi/gomega/gexec"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("leaky fixtures", func() {
+
+	var path string
+
+	BeforeEach(func() {
+		path = Successful(Build())
+		DeferCleanup(gexec.CleanupBuildArtifacts)
+	})
+
+	It("renders command line arguments", func() {
+		Expect(Spec{}.Args()).To(BeEmpty())
+		spec := Spec{Files: 1, FilePath: "/foo", Pipes: 2, TCPListeners: 3,
+			UDPSockets: 4, UDPPeer: "1.2.3.4:5", UnixSockets: 6, Timers: 7, Churn: 8, ChurnSeed: 9}
+		Expect(spec.Args()).To(HaveExactElements(
+			"-files", "1", "-file", "/foo", "-pipes", "2", "-tcp", "3",
+			"-udp", "4", "-udp-peer", "1.2.3.4:5", "-unix", "6", "-timers", "7",
+			"-churn", "8", "-churn-seed", "9"))
+		Expect(spec.Fds()).To(Equal(1 + 4 + 3 + 4 + 12 + 7))
+	})
+
+	It("leaks and plumbs fds", func() {
+		spec := Spec{Files: 2, Pipes: 1, TCPListeners: 1, UDPSockets: 2, UnixSockets: 1, Timers: 1}
+		fixture := Successful(Start(path, spec, GinkgoWriter, GinkgoWriter))
+		defer fixture.Stop()
+		Expect(fixture.PID()).To(Equal(fixture.Session.Command.Process.Pid))
+
+		goodfds := Successful(filedesc.ProcessFiledescriptors(fixture.PID()))
+
+		Expect(fixture.Leak()).To(Succeed())
+		fds := Successful(filedesc.ProcessFiledescriptors(fixture.PID()))
+		Expect(fds).To(HaveLen(len(goodfds) + spec.Fds()))
+		Expect(fds).To(ContainElement(And(
+			BeAssignableToTypeOf(&filedesc.SocketFd{}),
+			HaveField("Type()", unix.SOCK_STREAM),
+			HaveField("Listening()", true))))
+		Expect(fds).To(ContainElement(And(
+			BeAssignableToTypeOf(&filedesc.TimerfdFd{}),
+			HaveField("FileType()", "timerfd"))))
+		Expect(fds).To(ContainElement(And(
+			BeAssignableToTypeOf(&filedesc.PathFd{}),
+			HaveField("Path()", path))))
+
+		Expect(fixture.Plumb()).To(Succeed())
+		Expect(filedesc.ProcessFiledescriptors(fixture.PID())).To(HaveLen(len(goodfds)))
+	})
+
+	It("connects UDP sockets", func() {
+		fixture := Successful(Start(path, Spec{UDPSockets: 1, UDPPeer: "1.2.34.56:12345"},
+			GinkgoWriter, GinkgoWriter))
+		defer fixture.Stop()
+		Expect(fixture.Leak()).To(Succeed())
+		Expect(filedesc.ProcessFiledescriptors(fixture.PID())).To(ContainElement(And(
+			BeAssignableToTypeOf(&filedesc.SocketFd{}),
+			HaveField("Peer()", "1.2.34.56:12345"))))
+	})
+
+	It("reports fixture failures", func() {
+		fixture := Successful(Start(path, Spec{Files: 1, FilePath: "/nonexisting"}, GinkgoWriter, GinkgoWriter))
+		defer fixture.Stop()
+		Expect(fixture.Leak()).To(MatchError(ContainSubstring("exited with code")))
+
+		Expect(Start("/nonexisting", Spec{}, GinkgoWriter, GinkgoWriter)).Error().To(HaveOccurred())
+	})
+
+})
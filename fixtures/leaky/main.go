@@ -0,0 +1,130 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+// leaky is a fixture program that leaks configurable numbers of fds on
+// demand. It reports on stdout when being ready, and then advances on each
+// line read from stdin: first, it leaks fds, and then it plumbs the leaks
+// again, before finally exiting. Optionally, it churns fds from start until
+// exit.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/thediveo/fdooze/fixtures"
+	"golang.org/x/sys/unix"
+)
+
+func main() {
+	files := flag.Int("files", 0, "number of files to open")
+	filePath := flag.String("file", "", "path of files to open (default: own executable)")
+	pipes := flag.Int("pipes", 0, "number of pipes to create")
+	tcp := flag.Int("tcp", 0, "number of listening TCP sockets")
+	udp := flag.Int("udp", 0, "number of UDP sockets")
+	udpPeer := flag.String("udp-peer", "", "IPv4 address to connect UDP sockets to")
+	unixSockets := flag.Int("unix", 0, "number of unix domain socket pairs")
+	timers := flag.Int("timers", 0, "number of timerfds")
+	churn := flag.Int("churn", 0, "number of workers churning fds")
+	churnSeed := flag.Uint64("churn-seed", 0, "seed for churning fds")
+	flag.Parse()
+
+	if *filePath == "" {
+		var err error
+		*filePath, err = os.Executable()
+		must(err)
+	}
+	var peer *unix.SockaddrInet4
+	if *udpPeer != "" {
+		addr, err := net.ResolveUDPAddr("udp4", *udpPeer)
+		must(err)
+		peer = &unix.SockaddrInet4{Addr: [4]byte(addr.IP.To4()), Port: addr.Port}
+	}
+
+	primeIO()
+	if *churn > 0 {
+		fixtures.StartChurn(*churn, *churnSeed)
+	}
+	r := bufio.NewReader(os.Stdin)
+	fmt.Println("READY")
+	_, _ = r.ReadString('\n')
+
+	var fds []int
+	leak := func(fd int, err error) int {
+		must(err)
+		fds = append(fds, fd)
+		return fd
+	}
+	for range *files {
+		leak(unix.Open(*filePath, unix.O_RDONLY|unix.O_CLOEXEC, 0))
+	}
+	for range *pipes {
+		var p [2]int
+		must(unix.Pipe2(p[:], unix.O_CLOEXEC))
+		fds = append(fds, p[0], p[1])
+	}
+	loopback := &unix.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}
+	for range *tcp {
+		fd := leak(unix.Socket(unix.AF_INET, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0))
+		must(unix.Bind(fd, loopback))
+		must(unix.Listen(fd, 1))
+	}
+	for range *udp {
+		fd := leak(unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0))
+		if peer != nil {
+			must(unix.Connect(fd, peer))
+			continue
+		}
+		must(unix.Bind(fd, loopback))
+	}
+	for range *unixSockets {
+		pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		must(err)
+		fds = append(fds, pair[0], pair[1])
+	}
+	for range *timers {
+		leak(unix.TimerfdCreate(unix.CLOCK_MONOTONIC, unix.TFD_CLOEXEC))
+	}
+	fmt.Println("LEAKED")
+	_, _ = r.ReadString('\n')
+
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+	fmt.Println("PLUMBED")
+	_, _ = r.ReadString('\n')
+}
+
+// primeIO primes the Go runtime netpoller, so that the netpoller's fds are
+// already present when taking a baseline after the fixture reported to be
+// ready. Opening a pipe registers it with the netpoller; closing it again
+// doesn't leak the priming fds, yet the netpoller's fds are left open.
+func primeIO() {
+	r, w, err := os.Pipe()
+	must(err)
+	r.Close()
+	w.Close()
+}
+
+// must panics if err isn't nil.
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// FlagTransition describes how the flags of a file descriptor changed between
+// two snapshots, as determined by [FlagTransitions].
+type FlagTransition struct {
+	Before FileDescriptor // file descriptor in the before snapshot.
+	After  FileDescriptor // same file descriptor in the after snapshot.
+	Gained filedesc.Flags // flag bits set after, but not before.
+	Lost   filedesc.Flags // flag bits set before, but not after.
+}
+
+// FlagTransitions returns the flag transitions of the file descriptors present
+// in both the before and after snapshots, ordered as in the after snapshot.
+// File descriptors are considered to be the same if they belong to the same
+// process, have the same fd number, and are equal apart from their flags, see
+// [filedesc.FileDescriptor.Equal]. File descriptors without flags as well as
+// file descriptors with unchanged flags are skipped.
+func FlagTransitions(before, after []FileDescriptor) []FlagTransition {
+	type fdKey struct{ pid, fdNo int }
+	befores := make(map[fdKey]FileDescriptor, len(before))
+	for _, fd := range before {
+		befores[fdKey{pid: pidOf(fd), fdNo: fd.FdNo()}] = fd
+	}
+	var transitions []FlagTransition
+	for _, afterfd := range after {
+		beforefd, ok := befores[fdKey{pid: pidOf(afterfd), fdNo: afterfd.FdNo()}]
+		if !ok || !afterfd.Equal(beforefd) {
+			continue
+		}
+		beforeFlags, ok := flagsOf(beforefd)
+		if !ok {
+			continue
+		}
+		afterFlags, ok := flagsOf(afterfd)
+		if !ok || beforeFlags == afterFlags {
+			continue
+		}
+		transitions = append(transitions, FlagTransition{
+			Before: beforefd,
+			After:  afterfd,
+			Gained: afterFlags &^ beforeFlags,
+			Lost:   beforeFlags &^ afterFlags,
+		})
+	}
+	return transitions
+}
+
+// flagsOf returns the flags of the specified file descriptor, if available.
+func flagsOf(fd FileDescriptor) (filedesc.Flags, bool) {
+	flagsfd, ok := fd.(interface{ Flags() filedesc.Flags })
+	if !ok {
+		return 0, false
+	}
+	return flagsfd.Flags(), true
+}
+
+// HaveChangedFlags succeeds if any of the actual file descriptors, compared
+// with the same file descriptors in the before snapshot, gained any of the
+// specified gained flag bits or lost any of the specified lost flag bits; see
+// [FlagTransitions]. Libraries toggling flags on shared fds, such as setting
+// O_NONBLOCK on an inherited stdio fd or dropping O_CLOEXEC, cause subtle bugs
+// in other users of the same open file descriptions:
+//
+//	before := Filedescriptors()
+//	library.DoSomething()
+//	Expect(Filedescriptors()).NotTo(HaveChangedFlags(before, unix.O_NONBLOCK, unix.O_CLOEXEC))
+//
+// Pass zero gained or lost flags in order to not check for gained or lost
+// flags respectively.
+func HaveChangedFlags(before []FileDescriptor, gained, lost int) types.GomegaMatcher {
+	return &haveChangedFlagsMatcher{
+		before: before,
+		gained: filedesc.Flags(gained),
+		lost:   filedesc.Flags(lost),
+	}
+}
+
+type haveChangedFlagsMatcher struct {
+	before      []FileDescriptor
+	gained      filedesc.Flags
+	lost        filedesc.Flags
+	transitions []FlagTransition
+}
+
+func (matcher *haveChangedFlagsMatcher) Match(actual interface{}) (success bool, err error) {
+	actualFds, err := toFds(actual, "HaveChangedFlags")
+	if err != nil {
+		return false, err
+	}
+	matcher.transitions = nil
+	for _, transition := range FlagTransitions(matcher.before, actualFds) {
+		if transition.Gained&matcher.gained != 0 || transition.Lost&matcher.lost != 0 {
+			matcher.transitions = append(matcher.transitions, transition)
+		}
+	}
+	return len(matcher.transitions) > 0, nil
+}
+
+// FailureMessage returns a failure message if no fd changed its flags in the
+// specified ways.
+func (matcher *haveChangedFlagsMatcher) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected file descriptors to have %s", matcher.describe())
+}
+
+// NegatedFailureMessage returns a negated failure message listing the fds
+// with changed flags.
+func (matcher *haveChangedFlagsMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("Expected file descriptors not to have %s, but %d did:",
+		matcher.describe(), len(matcher.transitions)))
+	for _, transition := range matcher.transitions {
+		out.WriteString("\n")
+		out.WriteString(transition.After.Description(1))
+		if transition.Gained != 0 {
+			out.WriteString(fmt.Sprintf("\n%sgained %s",
+				filedesc.Indentation(2), strings.Join(bitNames(transition.Gained), ",")))
+		}
+		if transition.Lost != 0 {
+			out.WriteString(fmt.Sprintf("\n%slost %s",
+				filedesc.Indentation(2), strings.Join(bitNames(transition.Lost), ",")))
+		}
+	}
+	return out.String()
+}
+
+// describe returns a description of the checked flag transitions.
+func (matcher *haveChangedFlagsMatcher) describe() string {
+	var changes []string
+	if matcher.gained != 0 {
+		changes = append(changes, "gained any of "+strings.Join(bitNames(matcher.gained), ","))
+	}
+	if matcher.lost != 0 {
+		changes = append(changes, "lost any of "+strings.Join(bitNames(matcher.lost), ","))
+	}
+	if len(changes) == 0 {
+		return "changed flags in no checked way"
+	}
+	return strings.Join(changes, " or ")
+}
+
+// bitNames returns the symbolic names of the set flag bits, leaving out the
+// access mode as flag transitions are bit sets. If there are no known
+// symbolic names, the flag bits are returned in hex instead.
+func bitNames(flags filedesc.Flags) []string {
+	names := (flags &^ syscall.O_ACCMODE).Names()[1:]
+	if len(names) == 0 {
+		return []string{fmt.Sprintf("%#x", int(flags))}
+	}
+	return names
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("flag transitions", func() {
+
+	It("rejects invalid actual values", func() {
+		Expect(HaveChangedFlags(nil, unix.O_NONBLOCK, 0).Match(42)).Error().To(HaveOccurred())
+	})
+
+	It("reports fds with changed flags", func() {
+		f := Successful(os.Open("flag_transitions_test.go"))
+		defer f.Close()
+		fd := int(f.Fd())
+
+		before := Filedescriptors()
+		Expect(FlagTransitions(before, Filedescriptors())).To(BeEmpty())
+		Expect(Filedescriptors()).NotTo(HaveChangedFlags(before, unix.O_NONBLOCK, unix.O_CLOEXEC))
+
+		Expect(unix.SetNonblock(fd, true)).To(Succeed())
+		Successful(unix.FcntlInt(uintptr(fd), unix.F_SETFD, 0))
+
+		transitions := FlagTransitions(before, Filedescriptors())
+		Expect(transitions).To(ConsistOf(And(
+			HaveField("After.FdNo()", fd),
+			HaveField("Gained", BeEquivalentTo(unix.O_NONBLOCK)),
+			HaveField("Lost", BeEquivalentTo(unix.O_CLOEXEC)),
+		)))
+
+		m := HaveChangedFlags(before, unix.O_NONBLOCK, 0)
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.NegatedFailureMessage(nil)).To(MatchRegexp(
+			`(?s)^Expected file descriptors not to have gained any of O_NONBLOCK, but 1 did:\n.*fd \d+.*\n\s+gained O_NONBLOCK\n\s+lost O_CLOEXEC$`))
+
+		Expect(Filedescriptors()).To(HaveChangedFlags(before, 0, unix.O_CLOEXEC))
+		Expect(Filedescriptors()).NotTo(HaveChangedFlags(before, unix.O_APPEND, unix.O_NONBLOCK))
+		Expect(HaveChangedFlags(before, 0, 0).FailureMessage(nil)).To(Equal(
+			"Expected file descriptors to have changed flags in no checked way"))
+	})
+
+	It("ignores reused fd numbers", func() {
+		f := Successful(os.Open("flag_transitions_test.go"))
+		fd := int(f.Fd())
+		before := Filedescriptors()
+		f.Close()
+
+		g := Successful(os.Open("flag_transitions.go"))
+		defer g.Close()
+		Expect(int(g.Fd())).To(Equal(fd))
+		Expect(unix.SetNonblock(fd, true)).To(Succeed())
+		Expect(FlagTransitions(before, Filedescriptors())).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,167 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// FileTracer flags *os.File objects that were never closed explicitly, but
+// only got closed by the garbage collector finalizing them. Such “leaks plugged
+// only by GC” are latent bugs that before/after fd diffs can never see, as the
+// fds are gone by the time of the check – or not, depending on the GC's mood.
+//
+// Tracing is opt-in: only files opened through the FileTracer's wrappers, or
+// explicitly handed to [FileTracer.Track], are traced.
+//
+//	tracer := NewFileTracer()
+//	f, err := tracer.Open("foo.txt")
+//	...
+//	tracer.GC()
+//	Expect(tracer.GCClosed()).To(BeEmpty())
+type FileTracer struct {
+	mu       sync.Mutex
+	gcClosed []GCClosedFile
+}
+
+// GCClosedFile describes a traced file that wasn't closed explicitly, but only
+// by the garbage collector.
+type GCClosedFile struct {
+	FdNo     int    // fd number of the file at the time it got traced.
+	Name     string // name of the file, as passed to Open.
+	OpenedAt string // “file:line” location where the file was opened, if known.
+}
+
+// Description returns a pretty formatted single-line textual description of
+// the file closed only by the garbage collector.
+func (g GCClosedFile) Description(indentation uint) string {
+	desc := fmt.Sprintf("%sleak plugged only by GC: fd %d, name %q",
+		filedesc.Indentation(indentation), g.FdNo, g.Name)
+	if g.OpenedAt != "" {
+		desc += ", opened at " + g.OpenedAt
+	}
+	return desc
+}
+
+// NewFileTracer returns a new FileTracer.
+func NewFileTracer() *FileTracer {
+	return &FileTracer{}
+}
+
+// Open opens the named file for reading, like [os.Open], and traces it.
+func (t *FileTracer) Open(name string) (*os.File, error) {
+	return t.track(os.Open(name))
+}
+
+// Create creates or truncates the named file, like [os.Create], and traces it.
+func (t *FileTracer) Create(name string) (*os.File, error) {
+	return t.track(os.Create(name))
+}
+
+// OpenFile opens the named file with the specified flags and permissions, like
+// [os.OpenFile], and traces it.
+func (t *FileTracer) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return t.track(os.OpenFile(name, flag, perm))
+}
+
+// track traces the file if there was no error, passing on the file and error.
+func (t *FileTracer) track(f *os.File, err error) (*os.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	NotifyFdChange()
+	return t.trace(f, 3), nil
+}
+
+// Track traces the specified file, such as a file opened by some other means,
+// and returns it for convenience. Files must only be traced once and must not
+// have a finalizer set already.
+func (t *FileTracer) Track(f *os.File) *os.File {
+	return t.trace(f, 2)
+}
+
+// trace traces the specified file, attributing it to the caller the specified
+// number of frames up the call stack.
+func (t *FileTracer) trace(f *os.File, skip int) *os.File {
+	fdNo := -1
+	// Don't use f.Fd(), as this would switch the file into blocking mode.
+	if conn, err := f.SyscallConn(); err == nil {
+		_ = conn.Control(func(fd uintptr) { fdNo = int(fd) })
+	}
+	traced := GCClosedFile{FdNo: fdNo, Name: f.Name()}
+	if _, file, line, ok := runtime.Caller(skip); ok {
+		traced.OpenedAt = fmt.Sprintf("%s:%d", file, line)
+	}
+	// The finalizer of the *os.File wrapper runs before the finalizer of the
+	// wrapped internal file, which is the one closing the fd. So when our
+	// finalizer runs, an explicitly closed file tells us it's already closed.
+	runtime.SetFinalizer(f, func(f *os.File) {
+		if _, err := f.Stat(); errors.Is(err, os.ErrClosed) {
+			return
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.gcClosed = append(t.gcClosed, traced)
+	})
+	return f
+}
+
+// GCClosed returns the traced files that were finalized by the garbage
+// collector without having been closed explicitly so far. Call [FileTracer.GC]
+// first in order to finalize unreachable files.
+func (t *FileTracer) GCClosed() []GCClosedFile {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]GCClosedFile(nil), t.gcClosed...)
+}
+
+// Description returns a pretty formatted multi-line textual description of the
+// files closed only by the garbage collector so far.
+func (t *FileTracer) Description(indentation uint) string {
+	gcClosed := t.GCClosed()
+	descs := make([]string, 0, len(gcClosed))
+	for _, g := range gcClosed {
+		descs = append(descs, g.Description(indentation))
+	}
+	return strings.Join(descs, "\n")
+}
+
+// GC runs the garbage collector and waits for the finalizers of traced files
+// that became unreachable to have run, giving up after a second.
+func (t *FileTracer) GC() {
+	// As unreachable files might keep further unreachable files alive until
+	// their finalizers have run, do a second round.
+	for round := 0; round < 2; round++ {
+		done := make(chan struct{})
+		// Avoid tiny allocations, as their finalizers might never run.
+		runtime.SetFinalizer(new([16]byte), func(*[16]byte) { close(done) })
+		runtime.GC()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GC-closed file tracer", func() {
+
+	It("doesn't flag explicitly closed files", func() {
+		tracer := NewFileTracer()
+		func() {
+			f, err := tracer.Open("gc_tracer_test.go")
+			Expect(err).NotTo(HaveOccurred())
+			f.Close()
+		}()
+		tracer.GC()
+		Consistently(tracer.GCClosed).Should(BeEmpty())
+		Expect(tracer.Description(0)).To(BeEmpty())
+	})
+
+	It("flags files closed only by the GC", func() {
+		tracer := NewFileTracer()
+		goodfds := Filedescriptors()
+		func() {
+			f, err := tracer.Create(filepath.Join(GinkgoT().TempDir(), "foo"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Filedescriptors()).To(HaveLeakedFds(goodfds))
+			_ = f // ...and forget about it.
+		}()
+		Eventually(func() []GCClosedFile {
+			tracer.GC()
+			return tracer.GCClosed()
+		}).Should(ConsistOf(And(
+			HaveField("FdNo", BeNumerically(">", 2)),
+			HaveField("Name", HaveSuffix("/foo")),
+			HaveField("OpenedAt", MatchRegexp(`/gc_tracer_test\.go:\d+$`)))))
+		Expect(tracer.Description(1)).To(MatchRegexp(
+			`^\s+leak plugged only by GC: fd \d+, name ".*/foo", opened at .*/gc_tracer_test\.go:\d+$`))
+		// ...the before/after diff never sees the leak.
+		Eventually(Filedescriptors).ShouldNot(HaveLeakedFds(goodfds))
+	})
+
+	It("tracks files opened elsewhere", func() {
+		tracer := NewFileTracer()
+		Expect(tracer.OpenFile("nonexisting", os.O_RDONLY, 0)).Error().To(HaveOccurred())
+		func() {
+			f, err := os.Open("gc_tracer_test.go")
+			Expect(err).NotTo(HaveOccurred())
+			tracer.Track(f)
+		}()
+		Eventually(func() []GCClosedFile {
+			tracer.GC()
+			return tracer.GCClosed()
+		}).Should(ConsistOf(HaveField("Name", "gc_tracer_test.go")))
+	})
+
+})
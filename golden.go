@@ -0,0 +1,148 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// GoldenFormatVersion is the version of the textual snapshot format written by
+// [WriteGoldenSnapshot]. It gets incremented whenever the format changes in an
+// incompatible way.
+const GoldenFormatVersion = 1
+
+// goldenHeader is the header line of textual snapshots, with the format
+// version to be filled in.
+const goldenHeader = "# fdooze snapshot v%d"
+
+// GoldenFd is a single file descriptor in a textual snapshot, as written by
+// [WriteGoldenSnapshot] and read by [ReadGoldenSnapshot].
+type GoldenFd struct {
+	FdNo  int    // fd number.
+	Flags string // canonical flag names, such as "O_RDONLY|O_CLOEXEC", or "-" if unknown.
+	Key   string // run-independent key, as in leak reports.
+}
+
+// String returns the textual snapshot line of the fd. The key is written as a
+// quoted Go string literal, so that keys with paths containing newlines and
+// other special characters survive the round trip.
+func (g GoldenFd) String() string {
+	return fmt.Sprintf("%d %s %s", g.FdNo, g.Flags, strconv.Quote(g.Key))
+}
+
+// GoldenSnapshot returns the textual snapshot representation of the specified
+// fds in canonical ordering: by kind first and then by fd number, see also
+// [LeakReport]. Run-specific details, such as inode numbers, PIDs, and the
+// ephemeral ports of client sockets, are left out, so that the snapshot can be
+// compared with golden files.
+func GoldenSnapshot(fds []FileDescriptor) []GoldenFd {
+	fds = slices.Clone(fds)
+	slices.SortFunc(fds, compareFds)
+	golden := make([]GoldenFd, 0, len(fds))
+	for _, fd := range fds {
+		golden = append(golden, GoldenFd{
+			FdNo:  fd.FdNo(),
+			Flags: goldenFlags(fd),
+			Key:   redactKey(leakKey(fd)),
+		})
+	}
+	return golden
+}
+
+// goldenFlags returns the canonical flag names of the specified fd: the
+// access mode first, followed by the other flags in lexicographic order.
+func goldenFlags(fd FileDescriptor) string {
+	flagsfd, ok := fd.(interface{ Flags() filedesc.Flags })
+	if !ok {
+		return "-"
+	}
+	names := flagsfd.Flags().Names()
+	slices.Sort(names[1:])
+	return strings.ReplaceAll(strings.Join(names, "|"), " ", "_")
+}
+
+// WriteGoldenSnapshot writes the textual snapshot of the specified fds to w,
+// with a versioned header line followed by one line per fd in canonical
+// ordering, see [GoldenSnapshot]. For instance:
+//
+//	# fdooze snapshot v1
+//	0 O_RDWR "path /dev/pts/0"
+//	7 O_WRONLY|O_APPEND|O_CLOEXEC "path /home/leaky/module/oozing.log"
+//	5 O_RDONLY|O_CLOEXEC "pipe"
+func WriteGoldenSnapshot(w io.Writer, fds []FileDescriptor) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, goldenHeader+"\n", GoldenFormatVersion)
+	for _, g := range GoldenSnapshot(fds) {
+		bw.WriteString(g.String())
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ReadGoldenSnapshot reads a textual snapshot as written by
+// [WriteGoldenSnapshot] from r. Empty lines and further comment lines starting
+// with "#" are skipped. An error is returned if the header is missing or
+// announces an unsupported format version, or a line is malformed.
+func ReadGoldenSnapshot(r io.Reader) ([]GoldenFd, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("missing snapshot header")
+	}
+	var version int
+	if _, err := fmt.Sscanf(scanner.Text(), goldenHeader, &version); err != nil {
+		return nil, fmt.Errorf("invalid snapshot header %q", scanner.Text())
+	}
+	if version != GoldenFormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format version %d", version)
+	}
+	golden := []GoldenFd{}
+	lineNo := 1
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || fields[1] == "" || fields[2] == "" {
+			return nil, fmt.Errorf("malformed snapshot line %d: %q", lineNo, line)
+		}
+		fdNo, err := strconv.Atoi(fields[0])
+		if err != nil || fdNo < 0 {
+			return nil, fmt.Errorf("invalid fd number in snapshot line %d: %q", lineNo, line)
+		}
+		key, err := strconv.Unquote(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in snapshot line %d: %q", lineNo, line)
+		}
+		golden = append(golden, GoldenFd{FdNo: fdNo, Flags: fields[1], Key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return golden, nil
+}
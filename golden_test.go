@@ -0,0 +1,123 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing/iotest"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("golden snapshots", func() {
+
+	It("writes and reads canonical snapshots", func() {
+		f := Successful(os.Open("golden_test.go"))
+		defer f.Close()
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		fds := []FileDescriptor{
+			Successful(filedesc.New(pipefds[0])),
+			Successful(filedesc.New(int(f.Fd()))),
+		}
+
+		var buff bytes.Buffer
+		Expect(WriteGoldenSnapshot(&buff, fds)).To(Succeed())
+		Expect(buff.String()).To(MatchRegexp(
+			`^# fdooze snapshot v1\n` +
+				`\d+ O_RDONLY\|O_CLOEXEC "path /.*/golden_test\.go"\n` +
+				`\d+ O_RDONLY\|O_CLOEXEC "pipe"\n$`))
+
+		golden := Successful(ReadGoldenSnapshot(&buff))
+		Expect(golden).To(Equal(GoldenSnapshot(fds)))
+		Expect(golden).To(HaveExactElements(
+			HaveField("FdNo", int(f.Fd())),
+			HaveField("FdNo", pipefds[0])))
+
+		// Order of fds doesn't matter.
+		Expect(GoldenSnapshot([]FileDescriptor{fds[1], fds[0]})).To(Equal(golden))
+	})
+
+	It("leaves out ephemeral ports of client sockets", func() {
+		l := Successful(net.Listen("tcp", "127.0.0.1:0"))
+		defer l.Close()
+
+		snapshot := func() GoldenFd {
+			GinkgoHelper()
+			conn := Successful(net.Dial("tcp", l.Addr().String()))
+			defer conn.Close()
+			golden := GoldenSnapshot([]FileDescriptor{
+				Successful(filedesc.FromConn(conn.(*net.TCPConn))),
+			})
+			Expect(golden).To(HaveLen(1))
+			return golden[0]
+		}
+		g := snapshot()
+		Expect(g.Key).To(Equal(
+			fmt.Sprintf("socket AF_INET SOCK_STREAM IPPROTO_TCP peer %q", l.Addr().String())))
+		Expect(snapshot().Key).To(Equal(g.Key))
+	})
+
+	It("skips comments and empty lines", func() {
+		Expect(ReadGoldenSnapshot(strings.NewReader(
+			"# fdooze snapshot v1\n\n# stdio\n0 O_RDWR \"path /dev/null\"\n"))).To(
+			HaveExactElements(GoldenFd{FdNo: 0, Flags: "O_RDWR", Key: "path /dev/null"}))
+		Expect(ReadGoldenSnapshot(strings.NewReader("# fdooze snapshot v1\n"))).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid snapshots",
+		func(text string, expectedErr string) {
+			Expect(ReadGoldenSnapshot(strings.NewReader(text))).Error().To(
+				MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry(nil, "", "missing snapshot header"),
+		Entry(nil, "foo\n", "invalid snapshot header"),
+		Entry(nil, "# fdooze snapshot v42\n", "unsupported snapshot format version 42"),
+		Entry(nil, "# fdooze snapshot v1\n0 O_RDWR\n", "malformed snapshot line 2"),
+		Entry(nil, "# fdooze snapshot v1\nx O_RDWR \"pipe\"\n", "invalid fd number in snapshot line 2"),
+		Entry(nil, "# fdooze snapshot v1\n-1 O_RDWR \"pipe\"\n", "invalid fd number"),
+		Entry(nil, "# fdooze snapshot v1\n0 O_RDWR pipe\n", "invalid key in snapshot line 2"),
+	)
+
+	It("reports read errors", func() {
+		Expect(ReadGoldenSnapshot(iotest.ErrReader(os.ErrClosed))).Error().To(MatchError(os.ErrClosed))
+		Expect(ReadGoldenSnapshot(iotest.TimeoutReader(strings.NewReader(
+			"# fdooze snapshot v1\n" + strings.Repeat("x", 70000))))).Error().To(HaveOccurred())
+	})
+
+	It("round-trips keys with special characters", func() {
+		g := GoldenFd{FdNo: 42, Flags: "O_RDWR", Key: "path /tmp/foo bar\nbaz\t\"quux\""}
+		Expect(ReadGoldenSnapshot(strings.NewReader("# fdooze snapshot v1\n" + g.String() + "\n"))).To(
+			HaveExactElements(g))
+	})
+
+	It("handles fds without flags", func() {
+		Expect(goldenFlags(incarnatedFd{fdNo: 42})).To(Equal("-"))
+	})
+
+})
@@ -0,0 +1,166 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/exp/slices"
+)
+
+// IgnoringHarness succeeds if an actual FileDescriptor of the own process is
+// held by the test harness itself instead of the code under test. Use it as a
+// filter matcher with [HaveLeakedFds] in order to keep failure messages focused
+// on the application fds:
+//
+//	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringHarness()))
+//
+// The curated harness fds are:
+//   - files written by the Go testing package, such as the test log file and
+//     CPU profiles and execution traces; see the -test.* flags,
+//   - Ginkgo's report files; see the -ginkgo.*-report flags,
+//   - files inside coverage data directories; see GOCOVERDIR,
+//   - coverage and profiling output files given in the -test.* flags, such as
+//     -test.cpuprofile; see also [IgnoringProfilingFiles],
+//   - build artifacts of Gomega's gexec package,
+//   - the connection to the Ginkgo CLI when running specs in parallel, as well
+//     as the pipes Ginkgo then redirects stdout and stderr to.
+//
+// The harness fds are determined when calling IgnoringHarness. File
+// descriptors of other processes never match.
+func IgnoringHarness() types.GomegaMatcher {
+	h := newHarness(flagValue, os.Getenv)
+	pid := os.Getpid()
+	return Fd().with("held by the test harness", func(fd FileDescriptor) bool {
+		return pidOf(fd) == pid && h.owns(fd)
+	}).Build()
+}
+
+// harness describes the fds held by the test harness.
+type harness struct {
+	files        []string // absolute paths of harness files.
+	dirPrefixes  []string // path prefixes of harness directories.
+	parallelHost string   // address of the Ginkgo CLI server, if any.
+	pipeInos     []uint64 // inodes of the pipes stdout and stderr are redirected to.
+}
+
+// fileFlag names a flag whose value is a file path.
+type fileFlag struct {
+	name      string
+	outputDir bool // path is relative to the -test.outputdir.
+}
+
+// harnessFileFlags names the flags of the Go testing package and Ginkgo whose
+// values are harness file paths, except for profiling output files; see
+// [profilingFileFlags].
+var harnessFileFlags = []fileFlag{
+	{"test.testlogfile", false},
+	{"ginkgo.json-report", false},
+	{"ginkgo.junit-report", false},
+	{"ginkgo.teamcity-report", false},
+}
+
+// flagPaths returns the absolute file paths from the values of the specified
+// flags that are set.
+func flagPaths(flags []fileFlag, flagValue func(name string) string) []string {
+	var paths []string
+	for _, f := range flags {
+		path := flagValue(f.name)
+		if path == "" {
+			continue
+		}
+		if outputDir := flagValue("test.outputdir"); f.outputDir && outputDir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(outputDir, path)
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			paths = append(paths, abs)
+		}
+	}
+	return paths
+}
+
+// newHarness returns the description of the harness fds, based on the
+// specified flag and environment variable lookup functions.
+func newHarness(flagValue func(name string) string, getenv func(name string) string) *harness {
+	h := &harness{
+		files: append(flagPaths(harnessFileFlags, flagValue),
+			flagPaths(profilingFileFlags, flagValue)...),
+	}
+	for _, dir := range []string{flagValue("test.gocoverdir"), getenv("GOCOVERDIR")} {
+		if dir == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			h.dirPrefixes = append(h.dirPrefixes, abs+"/")
+		}
+	}
+	// gexec.Build places its artifacts into a temporary directory with a
+	// random suffix.
+	h.dirPrefixes = append(h.dirPrefixes, filepath.Join(os.TempDir(), "gexec_artifacts"))
+	if total, _ := strconv.Atoi(flagValue("ginkgo.parallel.total")); total > 1 {
+		h.parallelHost = strings.TrimPrefix(flagValue("ginkgo.parallel.host"), "http://")
+		for _, fdNo := range []int{1, 2} {
+			if fd, err := filedesc.New(fdNo); err == nil {
+				if pipe, ok := fd.(*filedesc.PipeFd); ok {
+					h.pipeInos = append(h.pipeInos, pipe.Ino())
+				}
+			}
+		}
+	}
+	return h
+}
+
+// owns returns true if the specified fd is held by the test harness.
+func (h *harness) owns(fd FileDescriptor) bool {
+	switch fd := fd.(type) {
+	case *filedesc.PathFd:
+		path := fd.Path()
+		if slices.Contains(h.files, path) {
+			return true
+		}
+		for _, prefix := range h.dirPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+	case *filedesc.SocketFd:
+		if h.parallelHost == "" {
+			return false
+		}
+		peer := fd.PeerNetAddr()
+		return peer != nil && peer.String() == h.parallelHost
+	case *filedesc.PipeFd:
+		return slices.Contains(h.pipeInos, fd.Ino())
+	}
+	return false
+}
+
+// flagValue returns the value of the specified command line flag, or "" if
+// there is no such flag.
+func flagValue(name string) string {
+	f := flag.Lookup(name)
+	if f == nil {
+		return ""
+	}
+	return f.Value.String()
+}
@@ -0,0 +1,127 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("harness fds", func() {
+
+	It("ignores harness files", func() {
+		dir := GinkgoT().TempDir()
+		cover := filepath.Join(dir, "cover")
+		Expect(os.Mkdir(cover, 0o755)).To(Succeed())
+		flags := map[string]string{
+			"test.testlogfile": filepath.Join(dir, "testlog.txt"),
+			"test.outputdir":   dir,
+			"test.cpuprofile":  "cpu.out",
+		}
+		h := newHarness(
+			func(name string) string { return flags[name] },
+			func(name string) string {
+				if name == "GOCOVERDIR" {
+					return cover
+				}
+				return ""
+			})
+
+		paths := []string{
+			flags["test.testlogfile"],
+			filepath.Join(dir, "cpu.out"),
+			filepath.Join(cover, "covcounters.1"),
+		}
+		gexecDir := Successful(os.MkdirTemp("", "gexec_artifacts"))
+		DeferCleanup(func() { os.RemoveAll(gexecDir) })
+		paths = append(paths, filepath.Join(gexecDir, "binary"))
+
+		goodfds := Filedescriptors()
+		for _, path := range paths {
+			f := Successful(os.Create(path))
+			defer f.Close()
+		}
+		other := Successful(os.Create(filepath.Join(dir, "application.log")))
+		defer other.Close()
+		unconfigured := Successful(os.Create(filepath.Join(dir, "trace.out")))
+		defer unconfigured.Close()
+
+		fds := Filedescriptors()
+		m := HaveLeakedFds(goodfds, Fd().with("held by the test harness", h.owns).Build())
+		Expect(m.Match(fds)).To(BeTrue())
+		Expect(m.NegatedFailureMessage(nil)).To(And(
+			ContainSubstring("Expected not to leak 2 file descriptors"),
+			ContainSubstring("application.log"),
+			ContainSubstring("trace.out")))
+
+		other.Close()
+		unconfigured.Close()
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringHarness(),
+			Fd().with("held by the test harness", h.owns).Build()))
+	})
+
+	It("ignores the parallel connection and output pipes", func() {
+		l := Successful(net.Listen("tcp", "127.0.0.1:0"))
+		defer l.Close()
+		conn := Successful(net.Dial("tcp", l.Addr().String()))
+		defer conn.Close()
+		sconn := Successful(l.Accept())
+		defer sconn.Close()
+
+		flags := map[string]string{
+			"ginkgo.parallel.total": "2",
+			"ginkgo.parallel.host":  "http://" + l.Addr().String(),
+		}
+		h := newHarness(
+			func(name string) string { return flags[name] },
+			func(string) string { return "" })
+		Expect(h.parallelHost).To(Equal(l.Addr().String()))
+
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		pipe := Successful(filedesc.New(pipefds[0])).(*filedesc.PipeFd)
+		h.pipeInos = append(h.pipeInos, pipe.Ino())
+
+		owned := 0
+		for _, fd := range Filedescriptors() {
+			if fd.FdNo() > 2 && h.owns(fd) { // stdio might be pipes, too.
+				owned++
+			}
+		}
+		Expect(owned).To(Equal(3)) // client-side connection and both pipe ends only.
+	})
+
+	It("doesn't ignore application fds", func() {
+		f := Successful(os.Open("harness_test.go"))
+		defer f.Close()
+		fd := Successful(filedesc.New(int(f.Fd())))
+		Expect(IgnoringHarness().Match(fd)).To(BeFalse())
+		Expect(newHarness(flagValue, os.Getenv).parallelHost).To(BeEmpty())
+		Expect(flagValue("no-such-flag")).To(BeEmpty())
+	})
+
+})
@@ -17,9 +17,10 @@
 package fdooze
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
 )
 
 // HaveLeakedFds succeeds if after filtering out expected file descriptors from
@@ -39,7 +40,9 @@ import (
 // accuracy.
 //
 // HaveLeakedFds does not assume any well-known fds, and in particular, it does
-// not make any assumptions about fds with numbers 0, 1, 2.
+// not make any assumptions about fds with numbers 0, 1, 2. However, leaked fds
+// sharing their open file description with other fds, such as dup'ed stdio
+// fds, are annotated as such in failure messages.
 //
 // A typical way to check for leaked (“oozed”) file descriptors is as follows,
 // after dot-importing the fdooze package:
@@ -62,56 +65,74 @@ import (
 // quite useful in covering specific use cases where the otherwise
 // straightforward before-after fd comparism isn't enough.
 //
+// File descriptors held by connection pools registered using [RegisterPool]
+// are not considered to be leaked.
+//
+// Instead of the discovered file descriptors, HaveLeakedFds also accepts a
+// discovery function, such as [Filedescriptors]. HaveLeakedFds then first
+// cheaply screens the fd table of this process by comparing its link-target
+// prehash with the prehash of the expected fds, see [filedesc.LinkPrehash], and
+// only calls the discovery function if the fd table has changed. This makes
+// per-spec leak checks nearly free in the common no-leak case:
+//
+//	Expect(Filedescriptors).NotTo(HaveLeakedFds(goodfds))
+//
+// Please note the caveats of the prehash; for instance, it doesn't notice an
+// fd that was closed and then reused for reopening the same path.
+//
+// In order to assert not only that fds leaked, but exactly which fds leaked,
+// such as in tests of intentional leaks, use [LeakMatcher.ConsistingOf]:
+//
+//	Expect(Filedescriptors()).To(HaveLeakedFds(goodfds).ConsistingOf(
+//	    Fd().WithPath("/etc/hostname").Build()))
+//
+// Use [LeakMatcher.Reporting] to enable optional annotations of the leaked fds
+// in failure messages, such as the threads blocked on them:
+//
+//	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds).Reporting(
+//	    WithBlockedThreads()))
+//
+// HaveLeakedFds refuses to compare the expected and actual file descriptors of
+// different incarnations of the same PID, returning a
+// [*ProcessIncarnationError] instead.
+//
 // [HaveField]: https://onsi.github.io/gomega/#havefieldfield-interface-value-interface
-func HaveLeakedFds(fds []FileDescriptor, ignoring ...types.GomegaMatcher) types.GomegaMatcher {
-	m := &haveLeakedFdsMatcher{
-		filters: append([]types.GomegaMatcher{
-			IgnoringFiledescriptors(fds),
-		}, ignoring...),
-	}
-	return m
+func HaveLeakedFds(fds []FileDescriptor, ignoring ...types.GomegaMatcher) LeakMatcher {
+	return fdLeakCheck.haveLeaked(fds, ignoring)
 }
 
-type haveLeakedFdsMatcher struct {
-	filters []types.GomegaMatcher
-	leaked  []FileDescriptor
+// fdLeakCheck checks for leaked file descriptors, identifying them by the same
+// fd numbers, kinds, and primary identities as [IgnoringFiledescriptors] and
+// then comparing them using [filedesc.FileDescriptor.Equal].
+var fdLeakCheck = LeakCheck[FileDescriptor]{
+	Name:       "HaveLeakedFds",
+	Noun:       "file descriptors",
+	Identity:   func(fd FileDescriptor) string { return ignoreKeyOf(fd).String() },
+	Equal:      func(actual, expected FileDescriptor) bool { return actual.Equal(expected) },
+	Describe:   describeElided,
+	Validate:   checkIncarnations,
+	Discount:   withoutPoolFds,
+	dumpLeaked: dumpLeakedFds,
+	Summary:    diskSpaceSummary,
+	Unchanged:  unchangedFdTable,
 }
 
-func (matcher *haveLeakedFdsMatcher) Match(actual interface{}) (success bool, err error) {
-	actualFds, err := toFds(actual, "HaveLeakedFds")
-	if err != nil {
-		return false, err
+// unchangedFdTable returns true if the expected fds are the fds of this
+// process and its fd table still has the same link-target prehash as the
+// expected fds.
+func unchangedFdTable(expected []FileDescriptor) bool {
+	if len(expected) == 0 {
+		return false
 	}
-	matcher.leaked = nil
-nextFd:
-	for _, actualFd := range actualFds {
-		for _, filter := range matcher.filters {
-			matches, err := filter.Match(actualFd)
-			if err != nil {
-				return false, err
-			}
-			if matches {
-				continue nextFd
-			}
+	for _, fd := range expected {
+		if pidOf(fd) != os.Getpid() {
+			return false
 		}
-		matcher.leaked = append(matcher.leaked, actualFd)
 	}
-	if len(matcher.leaked) == 0 {
-		return false, nil
+	expectedPrehash, ok := filedesc.LinkPrehashOf(expected)
+	if !ok {
+		return false
 	}
-	return true, nil // we have leak(ed)
-}
-
-// FailureMessage returns a failure message if there are leaked file
-// descriptors, listing the leaked fds with (some) detail information.
-func (matcher *haveLeakedFdsMatcher) FailureMessage(actual interface{}) (message string) {
-	return fmt.Sprintf("Expected to leak %d file descriptors:\n%s",
-		len(matcher.leaked), dumpFds(matcher.leaked, 1))
-}
-
-// NegatedFailureMessage returns a negated failure message if there aren't any
-// leaked file descriptors.
-func (matcher *haveLeakedFdsMatcher) NegatedFailureMessage(actual interface{}) (message string) {
-	return fmt.Sprintf("Expected not to leak %d file descriptors:\n%s",
-		len(matcher.leaked), dumpFds(matcher.leaked, 1))
+	prehash, err := filedesc.LinkPrehash(os.Getpid())
+	return err == nil && prehash == expectedPrehash
 }
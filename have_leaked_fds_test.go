@@ -18,6 +18,10 @@ package fdooze
 
 import (
 	"os"
+	"path/filepath"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -44,6 +48,26 @@ var _ = Describe("HaveLeakedFds matcher", func() {
 		Expect(oozed).To(BeFalse())
 	})
 
+	It("skips discovering an unchanged fd table", func() {
+		goods := Filedescriptors()
+		discoveries := 0
+		discover := func() []FileDescriptor {
+			discoveries++
+			return Filedescriptors()
+		}
+		Expect(discover).NotTo(HaveLeakedFds(goods))
+		Expect(discoveries).To(BeZero())
+
+		f, err := os.Open("have_leaked_fds_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		Expect(discover).To(HaveLeakedFds(goods))
+		Expect(discoveries).To(Equal(1))
+
+		Expect(discover).To(HaveLeakedFds(goods[:len(goods)-1]))
+		Expect(discoveries).To(Equal(2))
+	})
+
 	It("detects and details a leaked fd", func() {
 		goods := Filedescriptors()
 		Expect(goods).NotTo(BeEmpty())
@@ -66,4 +90,63 @@ var _ = Describe("HaveLeakedFds matcher", func() {
 \s+path: ".*/have_leaked_fds_test.go"`))
 	})
 
+	It("annotates leaked fds sharing their open file description", func() {
+		goods := Filedescriptors()
+		Expect(goods).NotTo(BeEmpty())
+
+		dupfd, err := unix.Dup(2)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(dupfd)
+
+		m := HaveLeakedFds(goods)
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`(?m)^\s+shares open file description with (fd \d+, )*fd 2(, fd \d+)*$`))
+	})
+
+	It("sums up unreclaimable disk space", func() {
+		goods := Filedescriptors()
+
+		path := filepath.Join(GinkgoT().TempDir(), "foo")
+		Expect(os.WriteFile(path, make([]byte, 3*1024*1024), 0600)).To(Succeed())
+		f, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		dupfd, err := unix.Dup(int(f.Fd()))
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(dupfd)
+
+		m := HaveLeakedFds(goods)
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(HavePrefix("Expected to leak 2 file descriptors:\n"))
+
+		Expect(os.Remove(path)).To(Succeed())
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(HavePrefix(
+			"Expected to leak 2 file descriptors, holding ~3.0 MiB of unreclaimable disk space:\n"))
+		Expect(m.NegatedFailureMessage(nil)).To(HavePrefix(
+			"Expected not to leak 2 file descriptors, holding ~3.0 MiB of unreclaimable disk space:\n"))
+	})
+
+	It("sums up unreclaimable shared memory", func() {
+		if _, err := os.Stat("/dev/shm"); err != nil {
+			Skip("needs /dev/shm")
+		}
+		goods := Filedescriptors()
+
+		f, err := os.CreateTemp("/dev/shm", "fdooze-test-*")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		Expect(f.Truncate(2 * 1024 * 1024)).To(Succeed())
+		Expect(unix.Fallocate(int(f.Fd()), 0, 0, 2*1024*1024)).To(Succeed())
+		Expect(os.Remove(f.Name())).To(Succeed())
+
+		Expect(Filedescriptors()).To(ContainElement(And(
+			BeAssignableToTypeOf(&filedesc.ShmFd{}), HaveField("FdNo()", int(f.Fd())))))
+		m := HaveLeakedFds(goods)
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(HavePrefix(
+			"Expected to leak 1 file descriptors, holding ~2.0 MiB of unreclaimable disk space:\n"))
+	})
+
 })
@@ -0,0 +1,91 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+)
+
+// HaveLeakedOnly succeeds if all file descriptors leaked in comparison to the
+// specified expected file descriptors are confined to the specified kinds
+// (categories) of file descriptors, or if there are no leaked fds at all. The
+// kinds are the same as for [FdMatcherBuilder.OfKind], such as "path", "shm",
+// "pipe", "socket", "anon_inode", and "namespace".
+//
+// HaveLeakedOnly gives teams a way to ratchet their fd leak enforcement
+// category by category instead of all-or-nothing. For instance, in order to
+// tolerate leaked anonymous inodes, but to fail on leaked files, pipes, and
+// sockets:
+//
+//	Expect(Filedescriptors()).To(HaveLeakedOnly(goodfds, []string{"anon_inode"}))
+//
+// As with [HaveLeakedFds], optional filter matchers can be specified in order
+// to ignore use case-specific file descriptors.
+func HaveLeakedOnly(fds []FileDescriptor, kinds []string, ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	filters := append([]types.GomegaMatcher{}, ignoring...)
+	for _, kind := range kinds {
+		filters = append(filters, Fd().OfKind(kind).Build())
+	}
+	return &haveLeakedOnlyMatcher{
+		kinds:  kinds,
+		leaked: HaveLeakedFds(fds, filters...).(*leakMatcher[FileDescriptor]),
+	}
+}
+
+// HaveLeakedSocketsOnly succeeds if all file descriptors leaked in comparison
+// to the specified expected file descriptors are sockets, or if there are no
+// leaked fds at all. It is a convenience shorthand for [HaveLeakedOnly] with
+// the "socket" kind.
+func HaveLeakedSocketsOnly(fds []FileDescriptor, ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return HaveLeakedOnly(fds, []string{"socket"}, ignoring...)
+}
+
+type haveLeakedOnlyMatcher struct {
+	kinds  []string
+	leaked *leakMatcher[FileDescriptor] // leaked fds outside the allowed kinds
+}
+
+func (matcher *haveLeakedOnlyMatcher) Match(actual interface{}) (success bool, err error) {
+	if _, err := toFds(actual, "HaveLeakedOnly"); err != nil {
+		return false, err
+	}
+	outside, err := matcher.leaked.Match(actual)
+	if err != nil {
+		return false, err
+	}
+	return !outside, nil
+}
+
+// FailureMessage returns a failure message if there are leaked file
+// descriptors outside the allowed kinds, listing these fds.
+func (matcher *haveLeakedOnlyMatcher) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected leaks to be confined to %s, but leaked %d other file descriptors:\n%s",
+		strings.Join(matcher.kinds, ", "),
+		len(matcher.leaked.leaked),
+		dumpLeakedFds(matcher.leaked.leaked, matcher.leaked.actual, matcher.leaked.expected,
+			matcher.leaked.report, 1))
+}
+
+// NegatedFailureMessage returns a negated failure message if all leaked file
+// descriptors are confined to the allowed kinds.
+func (matcher *haveLeakedOnlyMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected leaks not to be confined to %s",
+		strings.Join(matcher.kinds, ", "))
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HaveLeakedOnly matchers", func() {
+
+	It("fails for invalid actual and unknown kinds", func() {
+		m := HaveLeakedOnly(nil, []string{"socket"})
+		Expect(m.Match(nil)).Error().To(HaveOccurred())
+		Expect(m.Match(42)).Error().To(HaveOccurred())
+		Expect(HaveLeakedOnly(nil, []string{"foobar"}).Match(Filedescriptors())).Error().To(HaveOccurred())
+	})
+
+	It("succeeds without leaks", func() {
+		goods := Filedescriptors()
+		Expect(goods).To(HaveLeakedOnly(goods, nil))
+		Expect(goods).To(HaveLeakedSocketsOnly(goods))
+	})
+
+	It("succeeds for leaks confined to the allowed kinds", func() {
+		goods := Filedescriptors()
+		fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(fd)
+
+		Expect(Filedescriptors()).To(HaveLeakedSocketsOnly(goods))
+		Expect(Filedescriptors()).To(HaveLeakedOnly(goods, []string{"anon_inode", "socket"}))
+		m := HaveLeakedOnly(goods, []string{"anon_inode"})
+		Expect(Filedescriptors()).NotTo(m)
+		Expect(m.NegatedFailureMessage(nil)).To(Equal("Expected leaks not to be confined to anon_inode"))
+	})
+
+	It("reports leaks outside the allowed kinds", func() {
+		goods := Filedescriptors()
+		f, err := os.Open("have_leaked_only_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		m := HaveLeakedSocketsOnly(goods)
+		Expect(m.Match(Filedescriptors())).To(BeFalse())
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`(?m)Expected leaks to be confined to socket, but leaked 1 other file descriptors:
+\s+fd \d+, flags 0x.*
+\s+path: ".*/have_leaked_only_test.go"`))
+	})
+
+})
@@ -0,0 +1,98 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+)
+
+// IgnoringIdleHTTPConns succeeds if an actual FileDescriptor is an idle
+// kept-alive HTTP client connection to the specified address, such as the
+// address of an httptest.Server fixture. Idle connections are ESTABLISHED TCP
+// sockets connected to the address with empty receive and send queues. Use it
+// as a filter matcher with [HaveLeakedFds], as net/http's Transport keep-alives
+// are the single most common false positive in API test suites:
+//
+//	srv := httptest.NewServer(handler)
+//	...
+//	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds,
+//	    IgnoringIdleHTTPConns(srv.Listener.Addr().String())))
+//
+// Alternatively, call the Transport's CloseIdleConnections before checking.
+// Leaked idle connections are flagged as such in failure messages in any case.
+func IgnoringIdleHTTPConns(addr string) types.GomegaMatcher {
+	return Fd().with(fmt.Sprintf("being an idle connection to %q", addr), func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		return ok && s.Peer() == addr && idleConn(s)
+	}).Build()
+}
+
+// idleConn returns true if the specified socket is an ESTABLISHED TCP socket
+// with empty receive and send queues.
+func idleConn(s *filedesc.SocketFd) bool {
+	recvq, sendq := s.TCPQueues()
+	return s.TCPState() == unix.BPF_TCP_ESTABLISHED && recvq == 0 && sendq == 0
+}
+
+// idleConnAnnotation returns an annotation line for a leaked idle TCP client
+// connection. Server-side connections accepted from one of the specified
+// listeners aren't annotated, as well as any other fds.
+func idleConnAnnotation(fd FileDescriptor, listeners []*filedesc.SocketFd, indentation uint) string {
+	s, ok := fd.(*filedesc.SocketFd)
+	if !ok || !idleConn(s) || acceptedFrom(s, listeners) {
+		return ""
+	}
+	return fmt.Sprintf("\n%sidle connection, such as a kept-alive HTTP client connection "+
+		"(see IgnoringIdleHTTPConns)", filedesc.Indentation(indentation))
+}
+
+// listeningSockets returns the listening sockets among the specified fds.
+func listeningSockets(fds []FileDescriptor) []*filedesc.SocketFd {
+	var listeners []*filedesc.SocketFd
+	for _, fd := range fds {
+		if s, ok := fd.(*filedesc.SocketFd); ok && s.Listening() {
+			listeners = append(listeners, s)
+		}
+	}
+	return listeners
+}
+
+// acceptedFrom returns true if the local address of the specified socket
+// matches the local address of one of the specified listeners, that is, the
+// socket is a server-side connection. Listeners on unspecified addresses, such
+// as "0.0.0.0", match only by their ports.
+func acceptedFrom(s *filedesc.SocketFd, listeners []*filedesc.SocketFd) bool {
+	host, port, err := net.SplitHostPort(s.Name())
+	if err != nil {
+		return false
+	}
+	for _, listener := range listeners {
+		lhost, lport, err := net.SplitHostPort(listener.Name())
+		if err != nil || lport != port {
+			continue
+		}
+		if ip := net.ParseIP(lhost); lhost == host || (ip != nil && ip.IsUnspecified()) {
+			return true
+		}
+	}
+	return false
+}
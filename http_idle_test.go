@@ -0,0 +1,83 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("idle HTTP connections", func() {
+
+	It("ignores idle kept-alive client connections", func() {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("foo"))
+		}))
+		defer srv.Close()
+		addr := srv.Listener.Addr().String()
+		serverSide := Fd().WithLocalPort(srv.Listener.Addr().(*net.TCPAddr).Port).Build()
+
+		goodfds := Filedescriptors()
+		client := &http.Client{Transport: &http.Transport{}}
+		resp, err := client.Get(srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io.ReadAll(resp.Body)).To(Equal([]byte("foo")))
+		resp.Body.Close()
+
+		m := HaveLeakedFds(goodfds, serverSide)
+		Eventually(Filedescriptors).Should(m)
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`(?m)peer "` + addr + `"\n\s+TCP state ESTABLISHED, receive queue 0 bytes, send queue 0 bytes\n` +
+				`\s+idle connection, such as a kept-alive HTTP client connection \(see IgnoringIdleHTTPConns\)$`))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, serverSide, IgnoringIdleHTTPConns(addr)))
+		Expect(Filedescriptors()).To(HaveLeakedFds(goodfds, serverSide, IgnoringIdleHTTPConns("127.0.0.1:1")))
+
+		client.CloseIdleConnections()
+		Eventually(Filedescriptors).ShouldNot(HaveLeakedFds(goodfds, serverSide))
+	})
+
+	It("doesn't flag accepted server-side connections as idle client connections", func() {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("foo"))
+		}))
+		defer srv.Close()
+
+		goodfds := Filedescriptors()
+		client := &http.Client{Transport: &http.Transport{}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io.ReadAll(resp.Body)).To(Equal([]byte("foo")))
+		resp.Body.Close()
+
+		m := HaveLeakedFds(goodfds)
+		Eventually(func() int {
+			if ok, _ := m.Match(Filedescriptors()); !ok {
+				return 0
+			}
+			return strings.Count(m.FailureMessage(nil), "TCP state ESTABLISHED, receive queue 0 bytes, send queue 0 bytes")
+		}).Should(Equal(2))
+		Expect(strings.Count(m.FailureMessage(nil), "idle connection, such as")).To(Equal(1))
+	})
+
+})
@@ -0,0 +1,77 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"github.com/onsi/gomega/types"
+)
+
+// stdioCheck checks for file descriptors beyond stdio, that is, with fd
+// numbers above 2, without any baseline.
+var stdioCheck = func() LeakCheck[FileDescriptor] {
+	check := fdLeakCheck
+	check.Name = "HaveAnyFdsBeyondStdio"
+	check.Noun = "file descriptors beyond stdio"
+	return check
+}()
+
+// HaveAnyFdsBeyondStdio succeeds if the actual file descriptors contain any
+// fds other than stdin, stdout, and stderr, that is, with fd numbers above 2.
+// It works like [HaveLeakedFds] against an empty baseline, so it can be used
+// with short-lived helper binaries launched by tests that are expected to hold
+// nothing beyond stdio at a checkpoint, without having to fabricate a
+// baseline. As with HaveLeakedFds, optional filter matchers filter out
+// expected fds.
+//
+//	Expect(ProcessFiledescriptors(helper.Process.Pid)).NotTo(HaveAnyFdsBeyondStdio())
+func HaveAnyFdsBeyondStdio(ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return stdioCheck.haveLeaked(nil, append([]types.GomegaMatcher{IgnoringStdio()}, ignoring...))
+}
+
+// BeFdHygienic succeeds if the actual file descriptors contain only stdin,
+// stdout, and stderr, apart from the fds filtered out by the optional filter
+// matchers. It is the positive form of [HaveAnyFdsBeyondStdio]:
+//
+//	Expect(ProcessFiledescriptors(helper.Process.Pid)).To(BeFdHygienic())
+func BeFdHygienic(ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return &hygienicMatcher{
+		beyond: stdioCheck.haveLeaked(nil, append([]types.GomegaMatcher{IgnoringStdio()}, ignoring...)),
+	}
+}
+
+type hygienicMatcher struct {
+	beyond *leakMatcher[FileDescriptor]
+}
+
+func (matcher *hygienicMatcher) Match(actual interface{}) (success bool, err error) {
+	beyond, err := matcher.beyond.Match(actual)
+	if err != nil {
+		return false, err
+	}
+	return !beyond, nil
+}
+
+// FailureMessage returns a failure message listing the fds beyond stdio.
+func (matcher *hygienicMatcher) FailureMessage(actual interface{}) (message string) {
+	return matcher.beyond.NegatedFailureMessage(actual)
+}
+
+// NegatedFailureMessage returns a failure message if there aren't any fds
+// beyond stdio.
+func (matcher *hygienicMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return matcher.beyond.FailureMessage(actual)
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("fd hygiene", func() {
+
+	It("rejects invalid actual values", func() {
+		Expect(HaveAnyFdsBeyondStdio().Match(42)).Error().To(HaveOccurred())
+		Expect(BeFdHygienic().Match(42)).Error().To(HaveOccurred())
+	})
+
+	It("finds fds beyond stdio", func() {
+		f := Successful(os.Open("hygiene_test.go"))
+		defer f.Close()
+
+		fds := Filedescriptors()
+		Expect(fds).To(HaveAnyFdsBeyondStdio())
+		Expect(fds).NotTo(BeFdHygienic())
+
+		m := BeFdHygienic()
+		Expect(m.Match(fds)).To(BeFalse())
+		Expect(m.FailureMessage(nil)).To(And(
+			MatchRegexp(`^Expected not to leak \d+ file descriptors beyond stdio:\n`),
+			ContainSubstring("hygiene_test.go")))
+
+		Expect(fds).To(BeFdHygienic(Fd().with("being anything", func(FileDescriptor) bool { return true }).Build()))
+	})
+
+	It("accepts stdio-only fds", func() {
+		var stdio []FileDescriptor
+		for _, fd := range Filedescriptors() {
+			if fd.FdNo() <= 2 {
+				stdio = append(stdio, fd)
+			}
+		}
+		Expect(stdio).To(BeFdHygienic())
+		m := HaveAnyFdsBeyondStdio()
+		Expect(m.Match(stdio)).To(BeFalse())
+		Expect(m.FailureMessage(nil)).To(Equal("Expected to leak 0 file descriptors beyond stdio:\n"))
+	})
+
+	It("checks a launched helper process", func() {
+		cmd := exec.Command("sleep", "10")
+		Expect(cmd.Start()).To(Succeed())
+		DeferCleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+		Eventually(func() ([]FileDescriptor, error) {
+			return filedesc.ProcessFiledescriptors(cmd.Process.Pid)
+		}).Should(BeFdHygienic())
+	})
+
+})
@@ -0,0 +1,174 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// IdentityHash returns a stable hash of the identity of the specified file
+// descriptor, consisting of its kind and target identity, such as the path of
+// a file or the peer address of a client socket. The identity excludes the fd
+// number as well as other run-specific details, such as inode numbers and
+// ephemeral ports, so that identity hashes can be compared across test runs.
+func IdentityHash(fd FileDescriptor) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(leakKey(fd)))
+	return h.Sum64()
+}
+
+// SnapshotHash returns a stable hash of the identities of the specified file
+// descriptors, independent of their order. Comparing snapshot hashes is a
+// cheap way to check whether anything has changed, and allows compact storage
+// of baselines, such as in CI caches. See also [IdentityHash].
+func SnapshotHash(fds []FileDescriptor) uint64 {
+	hashes := make([]uint64, 0, len(fds))
+	for _, fd := range fds {
+		hashes = append(hashes, IdentityHash(fd))
+	}
+	slices.Sort(hashes)
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, hash := range hashes {
+		binary.LittleEndian.PutUint64(buf[:], hash)
+		_, _ = h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// FdsByIdentity maps the identity hashes of file descriptors to the file
+// descriptors with these identities, ordered by their fd numbers; see also
+// [IdentityHash]. Multiple fds share the same identity, for instance, when the
+// same file is opened multiple times.
+type FdsByIdentity map[uint64][]FileDescriptor
+
+// SnapshotByIdentity returns the currently open file descriptors for this
+// process keyed by their identity hashes, so that callers can look up fds by
+// their identities, such as when correlating fds across test runs. Please note
+// that [HaveLeakedFds] doesn't use identity hashes, but instead indexes its
+// expected fds by their fd numbers.
+func SnapshotByIdentity() FdsByIdentity {
+	return ByIdentity(Filedescriptors())
+}
+
+// ByIdentity returns the specified file descriptors keyed by their identity
+// hashes.
+func ByIdentity(fds []FileDescriptor) FdsByIdentity {
+	byIdentity := FdsByIdentity{}
+	for _, fd := range fds {
+		hash := IdentityHash(fd)
+		byIdentity[hash] = append(byIdentity[hash], fd)
+	}
+	for _, fds := range byIdentity {
+		slices.SortFunc(fds, compareFds)
+	}
+	return byIdentity
+}
+
+// Lookup returns the file descriptor with the same identity as well as the same
+// fd number as the specified file descriptor and [filedesc.FileDescriptor.Equal]
+// considering both to be equal, or nil.
+func (m FdsByIdentity) Lookup(fd FileDescriptor) FileDescriptor {
+	for _, candidate := range m[IdentityHash(fd)] {
+		if candidate.Equal(fd) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// Hashes returns the identity hashes in ascending order.
+func (m FdsByIdentity) Hashes() []uint64 {
+	hashes := make([]uint64, 0, len(m))
+	for hash := range m {
+		hashes = append(hashes, hash)
+	}
+	slices.Sort(hashes)
+	return hashes
+}
+
+// TargetIdentity identifies the underlying object a file descriptor refers
+// to, independent of the fd number and owning process. In contrast to
+// [IdentityHash], target identities include run-specific details, such as
+// inode numbers, so that they are only comparable within the same system at
+// the same time, but then tell apart different objects with otherwise the same
+// properties, such as two unnamed pipes.
+type TargetIdentity struct {
+	Kind string // kind of fd, such as "path", "pipe", or "socket".
+	Path string // path of files and shared memory objects, otherwise empty.
+	Dev  uint64 // device of files and shared memory objects, otherwise zero.
+	Ino  uint64 // inode number.
+}
+
+// TargetIdentityOf returns the identity of the underlying object the specified
+// file descriptor refers to, consisting of path, device, and inode number for
+// files and shared memory objects, and the inode numbers of pipes, sockets,
+// and namespaces. Comparing target identities allows asserting that the same
+// underlying object is open in different processes, such as after passing fds
+// or in preforking servers.
+//
+// The identities of files discovered [filedesc.WithSameFileAcrossMounts] use
+// their canonical paths instead, so that the same file opened via different
+// bind mounts has the same identity; see [filedesc.PathFd.CanonicalPath].
+//
+// TargetIdentityOf returns false if the identity of the underlying object is
+// unknown, such as for anonymous inode fds that all share the same inode, or
+// for files whose inode couldn't be determined.
+func TargetIdentityOf(fd FileDescriptor) (TargetIdentity, bool) {
+	var pathfd *filedesc.PathFd
+	kind := "path"
+	switch fd := fd.(type) {
+	case *filedesc.PathFd:
+		pathfd = fd
+	case *filedesc.ShmFd:
+		pathfd = &fd.PathFd
+		kind = "shm"
+	case *filedesc.PipeFd:
+		return TargetIdentity{Kind: "pipe", Ino: fd.Ino()}, true
+	case *filedesc.SocketFd:
+		return TargetIdentity{Kind: "socket", Ino: fd.Ino()}, fd.Ino() != 0
+	case *filedesc.NamespaceFd:
+		return TargetIdentity{Kind: "namespace", Ino: fd.Ino()}, true
+	default:
+		return TargetIdentity{}, false
+	}
+	if pathfd.Ino() == 0 {
+		return TargetIdentity{}, false
+	}
+	path := pathfd.Path()
+	if kind == "path" && pathfd.SameFileAcrossMounts() {
+		path = pathfd.CanonicalPath()
+	}
+	return TargetIdentity{Kind: kind, Path: path, Dev: pathfd.Dev(), Ino: pathfd.Ino()}, true
+}
+
+// SameTarget returns true if both file descriptors refer to the same
+// underlying object, which might be open in different processes; see
+// [TargetIdentityOf]. File descriptors with unknown target identities never
+// refer to the same target.
+func SameTarget(a, b FileDescriptor) bool {
+	aid, ok := TargetIdentityOf(a)
+	if !ok {
+		return false
+	}
+	bid, ok := TargetIdentityOf(b)
+	return ok && aid == bid
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("identity hashing", func() {
+
+	n := func(fd int, link string) FileDescriptor {
+		fdesc, err := filedesc.NewPathFd(fd, "/proc/self/fd", link)
+		Expect(err).WithOffset(1).NotTo(HaveOccurred())
+		return fdesc
+	}
+
+	It("hashes fd identities independent of fd numbers", func() {
+		Expect(IdentityHash(n(0, "/foo"))).To(Equal(IdentityHash(n(1, "/foo"))))
+		Expect(IdentityHash(n(0, "/foo"))).NotTo(Equal(IdentityHash(n(0, "/bar"))))
+	})
+
+	It("hashes snapshots independent of order", func() {
+		fds := []FileDescriptor{n(0, "/foo"), n(1, "/bar"), n(2, "/baz")}
+		hash := SnapshotHash(fds)
+		Expect(SnapshotHash(slices.Clone(fds))).To(Equal(hash))
+		slices.Reverse(fds)
+		Expect(SnapshotHash(fds)).To(Equal(hash))
+		Expect(SnapshotHash(fds[1:])).NotTo(Equal(hash))
+		Expect(SnapshotHash(append(fds, n(3, "/foo")))).NotTo(Equal(hash))
+		Expect(SnapshotHash(Filedescriptors())).To(Equal(SnapshotHash(Filedescriptors())))
+	})
+
+	It("hashes client sockets independent of their ephemeral ports across runs", func() {
+		l := Successful(net.Listen("tcp", "127.0.0.1:0"))
+		defer l.Close()
+
+		run := func() (uint64, uint64) {
+			GinkgoHelper()
+			conn := Successful(net.Dial("tcp", l.Addr().String()))
+			defer conn.Close()
+			fd := Successful(filedesc.FromConn(conn.(*net.TCPConn)))
+			return IdentityHash(fd), SnapshotHash(Filedescriptors())
+		}
+		hash, snapshot := run()
+		hash2, snapshot2 := run()
+		Expect(hash2).To(Equal(hash))
+		Expect(snapshot2).To(Equal(snapshot))
+	})
+
+	It("keys fds by identity", func() {
+		fds := []FileDescriptor{n(2, "/foo"), n(1, "/bar"), n(0, "/foo")}
+		byIdentity := ByIdentity(fds)
+		Expect(byIdentity).To(HaveLen(2))
+		Expect(byIdentity[IdentityHash(fds[0])]).To(HaveExactElements(fds[2], fds[0]))
+		Expect(byIdentity.Hashes()).To(ConsistOf(IdentityHash(fds[0]), IdentityHash(fds[1])))
+		Expect(slices.IsSorted(byIdentity.Hashes())).To(BeTrue())
+
+		Expect(byIdentity.Lookup(n(2, "/foo"))).To(BeIdenticalTo(fds[0]))
+		Expect(byIdentity.Lookup(n(3, "/foo"))).To(BeNil())
+		Expect(byIdentity.Lookup(n(2, "/baz"))).To(BeNil())
+
+		snapshot := SnapshotByIdentity()
+		for _, fd := range Filedescriptors() {
+			Expect(snapshot.Lookup(fd)).NotTo(BeNil())
+		}
+	})
+
+})
+
+var _ = Describe("target identities", func() {
+
+	It("identifies the same objects across processes", func() {
+		f := Successful(os.Open("identity_test.go"))
+		defer f.Close()
+		r, w, err := os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		defer r.Close()
+		defer w.Close()
+
+		cmd := exec.Command("sleep", "10")
+		cmd.ExtraFiles = []*os.File{f, r}
+		Expect(cmd.Start()).To(Succeed())
+		defer func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}()
+
+		own := Filedescriptors()
+		ownFd := func(fdNo int) FileDescriptor {
+			idx := slices.IndexFunc(own, func(fd FileDescriptor) bool { return fd.FdNo() == fdNo })
+			Expect(idx).WithOffset(1).NotTo(BeNumerically("<", 0))
+			return own[idx]
+		}
+		filefd := ownFd(int(f.Fd()))
+		readfd := ownFd(int(r.Fd()))
+		writefd := ownFd(int(w.Fd()))
+
+		id, ok := TargetIdentityOf(filefd)
+		Expect(ok).To(BeTrue())
+		Expect(id).To(And(
+			HaveField("Kind", "path"),
+			HaveField("Path", HaveSuffix("/identity_test.go")),
+			HaveField("Ino", Not(BeZero()))))
+
+		childFds := Successful(filedesc.ProcessFiledescriptors(cmd.Process.Pid))
+		Expect(childFds).To(ContainElement(And(
+			HaveField("FdNo()", 3), Fd().WithTargetOf(filefd).Build())))
+		Expect(childFds).To(ContainElement(And(
+			HaveField("FdNo()", 4), Fd().WithTargetOf(readfd).Build())))
+		// both ends of the same pipe share the pipe inode.
+		Expect(SameTarget(readfd, writefd)).To(BeTrue())
+		Expect(SameTarget(filefd, readfd)).To(BeFalse())
+	})
+
+	It("doesn't identify anonymous inodes", func() {
+		efd := Successful(unix.Eventfd(0, unix.EFD_CLOEXEC))
+		defer unix.Close(efd)
+		fd := Successful(filedesc.New(efd))
+		_, ok := TargetIdentityOf(fd)
+		Expect(ok).To(BeFalse())
+		Expect(SameTarget(fd, fd)).To(BeFalse())
+	})
+
+})
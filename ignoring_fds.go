@@ -18,9 +18,15 @@ package fdooze
 
 import (
 	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+
+	"golang.org/x/exp/slices"
 
 	"github.com/onsi/gomega/format"
 	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
 )
 
 // IgnoringFiledescriptors succeeds if an actual FileDescriptor in contained in
@@ -31,18 +37,144 @@ import (
 //
 // Please note that fd flags and file offsets are ignored when testing for
 // equality, in order to avoid spurious false positives.
+//
+// The expected file descriptors are indexed by their fd numbers, kinds, and
+// primary identities, such as paths and inode numbers, so that even massive
+// baselines only cost a single lookup per actual fd, and Equal gets invoked only
+// on likely matches.
 func IgnoringFiledescriptors(fds []FileDescriptor) types.GomegaMatcher {
 	m := &ignoringFds{
-		ignoreFds: map[int]FileDescriptor{},
+		ignoreFds: make(map[ignoreKey]FileDescriptor, len(fds)),
 	}
 	for _, fd := range fds {
-		m.ignoreFds[fd.FdNo()] = fd
+		m.ignoreFds[ignoreKeyOf(fd)] = fd
 	}
 	return m
 }
 
+// ignoreKey indexes file descriptors to be ignored by their fd numbers, kinds,
+// and primary identities.
+type ignoreKey struct {
+	fdNo int
+	kind reflect.Type
+	ino  uint64 // inode number of pipes, sockets, and namespaces.
+	name string // path of shared memory objects, or type of anonymous inodes.
+}
+
+// String returns the ignore index key in textual form, for use as the identity
+// of fds in [HaveLeakedFds].
+func (k ignoreKey) String() string {
+	var kind string
+	if k.kind != nil {
+		kind = k.kind.String()
+	}
+	return strconv.Itoa(k.fdNo) + " " + kind + " " + strconv.FormatUint(k.ino, 10) + " " + k.name
+}
+
+// ignoreKeyOf returns the ignore index key for the specified fd. Files aren't
+// keyed by their paths, as PathFds discovered
+// [filedesc.WithSameFileAcrossMounts] equal PathFds referencing the same file
+// via different paths; see [filedesc.PathFd.Equal].
+func ignoreKeyOf(fd FileDescriptor) ignoreKey {
+	key := ignoreKey{fdNo: fd.FdNo(), kind: reflect.TypeOf(fd)}
+	switch fd := fd.(type) {
+	case *filedesc.PathFd:
+		// keyed by fd number only.
+	case *filedesc.ShmFd:
+		key.name = fd.Path()
+	case *filedesc.PipeFd:
+		key.ino = fd.Ino()
+	case *filedesc.SocketFd:
+		key.ino = fd.Ino()
+	case *filedesc.NamespaceFd:
+		key.ino = fd.Ino()
+	default:
+		if anonfd, ok := filedesc.AnonInodeOf(fd); ok {
+			key.name = anonfd.FileType()
+		}
+	}
+	return key
+}
+
+// IgnoringShm succeeds if an actual FileDescriptor references a POSIX shared
+// memory object in /dev/shm, as created by shm_open(3). Use it as a filter
+// matcher with [HaveLeakedFds] in IPC-heavy suites that treat shared memory
+// objects differently from ordinary files.
+func IgnoringShm() types.GomegaMatcher {
+	return Fd().OfKind("shm").Build()
+}
+
+// IgnoringTmpfiles succeeds if an actual FileDescriptor references an unnamed
+// temporary file, as created by open(2) with O_TMPFILE; see
+// [filedesc.PathFd.Tmpfile]. This includes unnamed temporary files in
+// /dev/shm. Use it as a filter matcher with [HaveLeakedFds] when temp file
+// frameworks keep such files open beyond a test.
+func IgnoringTmpfiles() types.GomegaMatcher {
+	return Fd().with("being an unnamed temp file", func(fd FileDescriptor) bool {
+		p := pathFdOf(fd)
+		return p != nil && p.Tmpfile()
+	}).Build()
+}
+
+// IgnoringStdio succeeds if an actual FileDescriptor is stdin, stdout, or
+// stderr, that is, has an fd number of 0, 1, or 2. Use it as a filter matcher
+// with [HaveLeakedFds] or [Without].
+func IgnoringStdio() types.GomegaMatcher {
+	return Fd().with("being stdio", func(fd FileDescriptor) bool {
+		return fd.FdNo() <= 2
+	}).Build()
+}
+
+// IgnoringGoRuntimeNetpoller succeeds if an actual FileDescriptor of the own
+// process belongs to the Go runtime netpoller, that is, its epoll fd and its
+// wakeup eventfd or pipe fds; see [filedesc.GoRuntimeNetpollerFds] for the
+// heuristics used. Use it as a filter matcher with [HaveLeakedFds] when the
+// baseline was taken before the Go runtime initialized its netpoller upon
+// opening the first file or socket:
+//
+//	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringGoRuntimeNetpoller()))
+//
+// The netpoller fds are determined when calling IgnoringGoRuntimeNetpoller.
+// File descriptors of other processes never match.
+func IgnoringGoRuntimeNetpoller() types.GomegaMatcher {
+	netpoller := filedesc.GoRuntimeNetpollerFds()
+	pid := os.Getpid()
+	return Fd().with("belonging to the Go runtime netpoller", func(fd FileDescriptor) bool {
+		return pidOf(fd) == pid && slices.Contains(netpoller, fd.FdNo())
+	}).Build()
+}
+
+// IgnoringDNS succeeds if an actual FileDescriptor is a socket connected to one
+// of the configured DNS resolvers, see [filedesc.SocketFd.Resolver]. Use it as
+// a filter matcher with [HaveLeakedFds], as cgo and system resolvers keep such
+// sockets around unpredictably.
+func IgnoringDNS() types.GomegaMatcher {
+	return Fd().with("connected to a DNS resolver", func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		return ok && s.Resolver()
+	}).Build()
+}
+
+// PeerInCIDR succeeds if an actual FileDescriptor is an IPv4 or IPv6 socket
+// connected to a peer inside the specified network in CIDR notation. Use it as a
+// filter matcher with [HaveLeakedFds] in order to ignore connections to
+// infrastructure, such as a cluster's service network:
+//
+//	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, PeerInCIDR("10.0.0.0/8")))
+func PeerInCIDR(cidr string) types.GomegaMatcher {
+	return Fd().WithPeerInCIDR(cidr).Build()
+}
+
+// LocalPortInRange succeeds if an actual FileDescriptor is an IPv4 or IPv6
+// socket bound to a local port within the specified (inclusive) range, such as
+// Kubernetes' node port range 30000-32767. Use it as a filter matcher with
+// [HaveLeakedFds].
+func LocalPortInRange(low, high int) types.GomegaMatcher {
+	return Fd().WithLocalPortInRange(low, high).Build()
+}
+
 type ignoringFds struct {
-	ignoreFds map[int]FileDescriptor
+	ignoreFds map[ignoreKey]FileDescriptor
 }
 
 // Match succeeds if actual is a [filedesc.FileDescriptor] that is contained in
@@ -55,7 +187,7 @@ func (matcher *ignoringFds) Match(actual interface{}) (success bool, err error)
 			"IgnoringFiledescriptor matcher expects a filedesc.FileDescriptor.  Got:\n%s",
 			format.Object(actual, 1))
 	}
-	fd, ok := matcher.ignoreFds[actualFd.FdNo()]
+	fd, ok := matcher.ignoreFds[ignoreKeyOf(actualFd)]
 	if !ok {
 		return false, nil
 	}
@@ -17,6 +17,15 @@
 package fdooze
 
 import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/thediveo/fdooze/filedesc"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -48,4 +57,132 @@ not to be contained in the list of expected file descriptors
 \s+fd \d+, .*`))
 	})
 
+	It("ignores only fds with the same number, kind, and identity", func() {
+		n := func(fd int, link string) FileDescriptor {
+			fdesc, err := filedesc.NewPathFd(fd, "/proc/self/fd", link)
+			Expect(err).WithOffset(1).NotTo(HaveOccurred())
+			return fdesc
+		}
+		m := IgnoringFiledescriptors([]FileDescriptor{n(0, "/foo"), n(1, "/bar")})
+		Expect(m.Match(n(0, "/foo"))).To(BeTrue())
+		Expect(m.Match(n(1, "/bar"))).To(BeTrue())
+		Expect(m.Match(n(1, "/foo"))).To(BeFalse())
+		Expect(m.Match(n(2, "/foo"))).To(BeFalse())
+	})
+
+	It("ignores shared memory fds", func() {
+		goodfds := Filedescriptors()
+		shm, err := os.CreateTemp("/dev/shm", "fdooze-*")
+		if err != nil {
+			Skip("needs /dev/shm")
+		}
+		defer os.Remove(shm.Name())
+		defer shm.Close()
+		Expect(Filedescriptors()).To(HaveLeakedFds(goodfds))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringShm()))
+		Expect(Fd().WithPathPrefix("/dev/shm/").Build().Match(
+			FiledescriptorsWith(filedesc.OnlyKinds("shm"))[0])).To(BeTrue())
+	})
+
+	It("ignores unnamed temp files", func() {
+		goodfds := Filedescriptors()
+		tmpfile, err := os.OpenFile(GinkgoT().TempDir(), filedesc.O_TMPFILE|os.O_RDWR, 0600)
+		if err != nil {
+			Skip("needs O_TMPFILE support")
+		}
+		defer tmpfile.Close()
+		Expect(Filedescriptors()).To(HaveLeakedFds(goodfds))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringTmpfiles()))
+		Expect(IgnoringTmpfiles().Match(goodfds[0])).To(BeFalse())
+	})
+
+	It("ignores unnamed temp files in /dev/shm", func() {
+		goodfds := Filedescriptors()
+		tmpfile, err := os.OpenFile("/dev/shm", filedesc.O_TMPFILE|os.O_RDWR, 0600)
+		if err != nil {
+			Skip("needs O_TMPFILE support in /dev/shm")
+		}
+		defer tmpfile.Close()
+		Expect(FiledescriptorsWith(filedesc.OnlyKinds("shm"))).To(ContainElement(
+			HaveField("FdNo()", int(tmpfile.Fd()))))
+		Expect(Filedescriptors()).To(HaveLeakedFds(goodfds))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringTmpfiles()))
+	})
+
+	It("ignores the Go runtime netpoller fds", func() {
+		netpoller := filedesc.GoRuntimeNetpollerFds()
+		Expect(netpoller).NotTo(BeEmpty())
+		goodfds := []FileDescriptor{}
+		for _, fd := range Filedescriptors() {
+			if !slices.Contains(netpoller, fd.FdNo()) {
+				goodfds = append(goodfds, fd)
+			}
+		}
+		m := HaveLeakedFds(goodfds)
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(ContainSubstring(
+			"Go runtime netpoller (see IgnoringGoRuntimeNetpoller)"))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringGoRuntimeNetpoller()))
+	})
+
+	It("ignores DNS resolver sockets", Serial, func() {
+		resolvconf := GinkgoT().TempDir() + "/resolv.conf"
+		Expect(os.WriteFile(resolvconf, []byte("nameserver 127.0.0.1\n"), 0600)).To(Succeed())
+		oldPath := filedesc.ResolvConfPath
+		DeferCleanup(func() { filedesc.ResolvConfPath = oldPath })
+		filedesc.ResolvConfPath = resolvconf
+
+		goodfds := Filedescriptors()
+		conn, err := net.Dial("udp", "127.0.0.1:53")
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		Expect(Filedescriptors()).To(HaveLeakedFds(goodfds))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringDNS()))
+	})
+
 })
+
+// syntheticFds returns the specified number of synthetic path fds, based on
+// fake fdinfo files in a temporary directory.
+func syntheticFds(b *testing.B, count int) []FileDescriptor {
+	base := filepath.Join(b.TempDir(), "fd")
+	if err := os.Mkdir(base+"info", 0o755); err != nil {
+		b.Fatal(err)
+	}
+	fds := make([]FileDescriptor, 0, count)
+	for fdNo := 0; fdNo < count; fdNo++ {
+		if err := os.WriteFile(fmt.Sprintf("%sinfo/%d", base, fdNo),
+			[]byte("pos:\t0\nflags:\t02\nmnt_id:\t42\n"), 0o644); err != nil {
+			b.Fatal(err)
+		}
+		fd, err := filedesc.NewPathFd(fdNo, base, fmt.Sprintf("/synthetic/%d", fdNo))
+		if err != nil {
+			b.Fatal(err)
+		}
+		fds = append(fds, fd)
+	}
+	return fds
+}
+
+func BenchmarkIgnoringFiledescriptors50k(b *testing.B) {
+	fds := syntheticFds(b, 50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := IgnoringFiledescriptors(fds)
+		for _, fd := range fds {
+			if ignored, _ := m.Match(fd); !ignored {
+				b.Fatalf("fd %d not ignored", fd.FdNo())
+			}
+		}
+	}
+}
+
+func BenchmarkHaveLeakedFds50k(b *testing.B) {
+	fds := syntheticFds(b, 50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if leaked, err := HaveLeakedFds(fds).Match(fds); err != nil || leaked {
+			b.Fatalf("unexpected leaks, err: %v", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import "fmt"
+
+// ProcessIncarnationError is returned by [HaveLeakedFds] when the expected and
+// actual file descriptors of the same PID have been taken from different
+// process incarnations, that is, from processes with different start times.
+// This happens when the PID of a terminated process gets reused, such as in
+// long-running test suites with process restarts. Diffing such file
+// descriptors would silently produce nonsense.
+type ProcessIncarnationError struct {
+	PID               int    // PID of both process incarnations.
+	ExpectedStartTime uint64 // start time of the process incarnation of the expected fds.
+	ActualStartTime   uint64 // start time of the process incarnation of the actual fds.
+}
+
+// Error returns a textual description of the process incarnation mismatch.
+func (e *ProcessIncarnationError) Error() string {
+	return fmt.Sprintf("refusing to diff file descriptors of different incarnations of PID %d "+
+		"(start times %d and %d)", e.PID, e.ExpectedStartTime, e.ActualStartTime)
+}
+
+// checkIncarnations returns a *ProcessIncarnationError if any of the expected
+// and actual file descriptors have the same PID, but different process start
+// times. File descriptors with unknown PIDs or start times are skipped.
+func checkIncarnations(expected []FileDescriptor, actual []FileDescriptor) error {
+	starts := map[int]uint64{}
+	for _, fd := range expected {
+		if pid, start := incarnationOf(fd); pid != 0 && start != 0 {
+			starts[pid] = start
+		}
+	}
+	if len(starts) == 0 {
+		return nil
+	}
+	for _, fd := range actual {
+		pid, start := incarnationOf(fd)
+		if pid == 0 || start == 0 {
+			continue
+		}
+		if expectedStart, ok := starts[pid]; ok && expectedStart != start {
+			return &ProcessIncarnationError{
+				PID:               pid,
+				ExpectedStartTime: expectedStart,
+				ActualStartTime:   start,
+			}
+		}
+	}
+	return nil
+}
+
+// incarnationOf returns the PID and start time of the process owning the
+// specified fd, with zero values if unknown.
+func incarnationOf(fd FileDescriptor) (pid int, start uint64) {
+	if owner, ok := fd.(interface{ StartTime() uint64 }); ok {
+		start = owner.StartTime()
+	}
+	return pidOf(fd), start
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// incarnatedFd is a fake file descriptor of a particular process incarnation.
+type incarnatedFd struct {
+	fdNo  int
+	pid   int
+	start uint64
+}
+
+func (fd incarnatedFd) FdNo() int                       { return fd.fdNo }
+func (fd incarnatedFd) Description(uint) string         { return "incarnated fd" }
+func (fd incarnatedFd) Equal(other FileDescriptor) bool { return fd == other.(incarnatedFd) }
+func (fd incarnatedFd) PID() int                        { return fd.pid }
+func (fd incarnatedFd) StartTime() uint64               { return fd.start }
+
+var _ = Describe("process incarnations", func() {
+
+	It("accepts same incarnations and unknown incarnations", func() {
+		Expect(checkIncarnations(
+			[]FileDescriptor{incarnatedFd{fdNo: 0, pid: 42, start: 666}, incarnatedFd{fdNo: 1}},
+			[]FileDescriptor{incarnatedFd{fdNo: 0, pid: 42, start: 666}, incarnatedFd{fdNo: 1, pid: 42}},
+		)).To(Succeed())
+		Expect(checkIncarnations(
+			[]FileDescriptor{incarnatedFd{fdNo: 0, pid: 42, start: 666}},
+			[]FileDescriptor{incarnatedFd{fdNo: 0, pid: 43, start: 667}},
+		)).To(Succeed())
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(Filedescriptors()))
+	})
+
+	It("rejects different incarnations", func() {
+		m := HaveLeakedFds([]FileDescriptor{incarnatedFd{fdNo: 0, pid: 42, start: 666}})
+		_, err := m.Match([]FileDescriptor{incarnatedFd{fdNo: 0, pid: 42, start: 667}})
+		var incarnationErr *ProcessIncarnationError
+		Expect(errors.As(err, &incarnationErr)).To(BeTrue())
+		Expect(*incarnationErr).To(Equal(ProcessIncarnationError{
+			PID: 42, ExpectedStartTime: 666, ActualStartTime: 667}))
+		Expect(err).To(MatchError(
+			"refusing to diff file descriptors of different incarnations of PID 42 (start times 666 and 667)"))
+	})
+
+})
@@ -0,0 +1,94 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// HaveNoStaleRegisteredFiles succeeds if all files registered with the io_uring
+// fds in the actual list of file descriptors correspond to currently open file
+// descriptors of the same process in the list. It catches the subtle case of
+// an fd that has been closed, but remains registered with a ring, silently
+// keeping its file open:
+//
+//	Expect(Filedescriptors()).To(HaveNoStaleRegisteredFiles())
+//
+// Please note that the kernel lists the registered files of a ring only if it
+// isn't busy at the same time.
+func HaveNoStaleRegisteredFiles() types.GomegaMatcher {
+	return &staleRegisteredFilesMatcher{}
+}
+
+type staleRegisteredFilesMatcher struct {
+	stale []staleRegisteredFile
+}
+
+// staleRegisteredFile is a stale file registered with a particular ring.
+type staleRegisteredFile struct {
+	ring *filedesc.IoUringFd
+	file filedesc.RegisteredFile
+}
+
+func (matcher *staleRegisteredFilesMatcher) Match(actual interface{}) (success bool, err error) {
+	fds, err := toFds(actual, "HaveNoStaleRegisteredFiles")
+	if err != nil {
+		return false, err
+	}
+	matcher.stale = nil
+	for _, fd := range fds {
+		ring, ok := fd.(*filedesc.IoUringFd)
+		if !ok {
+			continue
+		}
+		for _, file := range filedesc.StaleRegisteredFiles(ring, fds) {
+			matcher.stale = append(matcher.stale, staleRegisteredFile{ring: ring, file: file})
+		}
+	}
+	return len(matcher.stale) == 0, nil
+}
+
+// dump returns detailed textual information about the stale registered files.
+func (matcher *staleRegisteredFilesMatcher) dump() string {
+	var out strings.Builder
+	for idx, stale := range matcher.stale {
+		if idx > 0 {
+			out.WriteRune('\n')
+		}
+		out.WriteString(fmt.Sprintf("%sio_uring fd %d, registered file #%d: %q",
+			filedesc.Indentation(1), stale.ring.FdNo(), stale.file.Index,
+			redactValue(stale.file.Path)))
+	}
+	return out.String()
+}
+
+// FailureMessage returns a failure message if there are stale registered
+// files, listing them together with their rings.
+func (matcher *staleRegisteredFilesMatcher) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected no io_uring registered files without open fds, but found %d:\n%s",
+		len(matcher.stale), matcher.dump())
+}
+
+// NegatedFailureMessage returns a negated failure message if there aren't any
+// stale registered files.
+func (matcher *staleRegisteredFilesMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return "Expected io_uring registered files without open fds"
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("io_uring registered files", func() {
+
+	It("rejects invalid actual values", func() {
+		Expect(HaveNoStaleRegisteredFiles().Match(42)).Error().To(HaveOccurred())
+	})
+
+	It("finds stale registered files", func() {
+		f, err := os.Open("io_uring_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		closed := false
+		defer func() {
+			if !closed {
+				f.Close()
+			}
+		}()
+
+		var params [120]byte // struct io_uring_params
+		ring, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, 4, uintptr(unsafe.Pointer(&params[0])), 0)
+		if errno != 0 {
+			Skip("io_uring unavailable: " + errno.Error())
+		}
+		defer unix.Close(int(ring))
+		fds := []int32{int32(f.Fd())}
+		// opcode 2 is IORING_REGISTER_FILES, which x/sys/unix doesn't define.
+		_, _, errno = unix.Syscall6(unix.SYS_IO_URING_REGISTER, ring, 2,
+			uintptr(unsafe.Pointer(&fds[0])), uintptr(len(fds)), 0, 0)
+		Expect(errno).To(BeZero())
+
+		m := HaveNoStaleRegisteredFiles()
+		Expect(Filedescriptors()).To(m)
+		Expect(m.NegatedFailureMessage(nil)).To(Equal("Expected io_uring registered files without open fds"))
+
+		Expect(f.Close()).To(Succeed())
+		closed = true
+		Expect(m.Match(Filedescriptors())).To(BeFalse())
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`^Expected no io_uring registered files without open fds, but found 1:\n    io_uring fd %d, registered file #0: ".*/io_uring_test.go"$`, ring))
+	})
+
+})
@@ -0,0 +1,224 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+)
+
+// LeakCheck describes how to check for leaked resources of type R, such as
+// file descriptors, inotify watches, or loop devices, reusing the same
+// filtering and dumping machinery as [HaveLeakedFds]. Only Identity and
+// Describe are mandatory, all other fields are optional. For instance:
+//
+//	var loopDevices = LeakCheck[string]{
+//	    Name:     "HaveLeakedLoopDevices",
+//	    Noun:     "loop devices",
+//	    Identity: func(dev string) string { return dev },
+//	    Describe: func(dev string, indentation uint) string {
+//	        return filedesc.Indentation(indentation) + dev
+//	    },
+//	}
+//
+//	func HaveLeakedLoopDevices(expected []string, ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+//	    return loopDevices.HaveLeaked(expected, ignoring...)
+//	}
+type LeakCheck[R any] struct {
+	// Name of the matcher, for use in error messages.
+	Name string
+	// Noun naming the resources in plural, for use in failure messages;
+	// defaults to "resources".
+	Noun string
+	// Identity returns the identity of a resource; actual resources with the
+	// same identity as an expected resource are not leaked.
+	Identity func(r R) string
+	// Equal optionally further compares an actual resource with an expected
+	// resource of the same identity.
+	Equal func(actual, expected R) bool
+	// Describe returns a textual description of a resource.
+	Describe func(r R, indentation uint) string
+	// Validate optionally checks that the expected and actual resources can be
+	// compared at all.
+	Validate func(expected, actual []R) error
+	// Discount optionally removes legitimately held resources from the leaked
+	// resources.
+	Discount func(leaked []R) []R
+	// DumpLeaked optionally replaces describing the leaked resources one after
+	// another in failure messages.
+	DumpLeaked func(leaked, actual, expected []R, indentation uint) string
+	// Summary optionally returns a summary of the leaked resources, to be
+	// appended to the first line of failure messages.
+	Summary func(leaked []R) string
+	// Unchanged optionally returns true if the current resources are cheaply
+	// known to be still the expected resources. When the matcher is passed a
+	// discovery function instead of the actual resources, it then skips
+	// calling the discovery function and thus doesn't find any leaks.
+	Unchanged func(expected []R) bool
+
+	// dumpLeaked optionally replaces DumpLeaked, taking the report options of
+	// the particular matcher into account.
+	dumpLeaked func(leaked, actual, expected []R, opts reportOptions, indentation uint) string
+}
+
+// HaveLeaked returns a matcher that succeeds if after filtering out the
+// expected resources from the list of actual resources the remaining list is
+// non-empty. Instead of the actual resources, the matcher also accepts a
+// func() []R discovering them, see also Unchanged. As with [HaveLeakedFds], optional filter matchers get passed the
+// individual resources and filter out resources they match. Use
+// [LeakMatcher.ConsistingOf] to additionally assert the leaked resources.
+func (c LeakCheck[R]) HaveLeaked(expected []R, ignoring ...types.GomegaMatcher) LeakMatcher {
+	return c.haveLeaked(expected, ignoring)
+}
+
+// haveLeaked returns the concrete leak matcher.
+func (c LeakCheck[R]) haveLeaked(expected []R, ignoring []types.GomegaMatcher) *leakMatcher[R] {
+	identities := map[string][]R{}
+	for _, r := range expected {
+		id := c.Identity(r)
+		identities[id] = append(identities[id], r)
+	}
+	return &leakMatcher[R]{
+		check:      c,
+		expected:   expected,
+		identities: identities,
+		filters:    ignoring,
+	}
+}
+
+type leakMatcher[R any] struct {
+	check      LeakCheck[R]
+	expected   []R
+	identities map[string][]R // expected resources by identity
+	filters    []types.GomegaMatcher
+	report     reportOptions
+	actual     []R
+	leaked     []R
+}
+
+func (matcher *leakMatcher[R]) Match(actual interface{}) (success bool, err error) {
+	actualRs, err := matcher.toResources(actual)
+	if err != nil {
+		return false, err
+	}
+	if matcher.check.Validate != nil {
+		if err := matcher.check.Validate(matcher.expected, actualRs); err != nil {
+			return false, err
+		}
+	}
+	matcher.actual = actualRs
+	matcher.leaked = nil
+nextResource:
+	for _, r := range actualRs {
+		if matcher.isExpected(r) {
+			continue
+		}
+		for _, filter := range matcher.filters {
+			matches, err := filter.Match(r)
+			if err != nil {
+				return false, err
+			}
+			if matches {
+				continue nextResource
+			}
+		}
+		matcher.leaked = append(matcher.leaked, r)
+	}
+	if matcher.check.Discount != nil {
+		matcher.leaked = matcher.check.Discount(matcher.leaked)
+	}
+	return len(matcher.leaked) > 0, nil
+}
+
+// toResources returns actual as a slice of resources, or an error if actual
+// isn't a slice of resources. If actual is a function discovering the
+// resources, toResources calls it, unless the resources are known to be
+// unchanged, returning the expected resources instead.
+func (matcher *leakMatcher[R]) toResources(actual interface{}) ([]R, error) {
+	if discover, ok := actual.(func() []R); ok {
+		if matcher.check.Unchanged != nil && matcher.check.Unchanged(matcher.expected) {
+			return matcher.expected, nil
+		}
+		return discover(), nil
+	}
+	rsT := reflect.TypeOf([]R(nil))
+	val := reflect.ValueOf(actual)
+	if val.Kind() != reflect.Slice || !val.Type().AssignableTo(rsT) {
+		return nil, fmt.Errorf(
+			"%s matcher expects an array or slice of %s.  Got:\n%s",
+			matcher.check.Name, matcher.noun(), format.Object(actual, 1))
+	}
+	return val.Convert(rsT).Interface().([]R), nil
+}
+
+// isExpected returns true if the specified actual resource is among the
+// expected resources.
+func (matcher *leakMatcher[R]) isExpected(r R) bool {
+	for _, expected := range matcher.identities[matcher.check.Identity(r)] {
+		if matcher.check.Equal == nil || matcher.check.Equal(r, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// noun returns the noun naming the resources in plural.
+func (matcher *leakMatcher[R]) noun() string {
+	if matcher.check.Noun == "" {
+		return "resources"
+	}
+	return matcher.check.Noun
+}
+
+// dump returns the detailed textual information about the leaked resources,
+// preceded by the optional summary.
+func (matcher *leakMatcher[R]) dump() string {
+	summary := ""
+	if matcher.check.Summary != nil {
+		summary = matcher.check.Summary(matcher.leaked)
+	}
+	if matcher.check.dumpLeaked != nil {
+		return summary + ":\n" + matcher.check.dumpLeaked(
+			matcher.leaked, matcher.actual, matcher.expected, matcher.report, 1)
+	}
+	if matcher.check.DumpLeaked != nil {
+		return summary + ":\n" + matcher.check.DumpLeaked(matcher.leaked, matcher.actual, matcher.expected, 1)
+	}
+	descs := make([]string, 0, len(matcher.leaked))
+	for _, r := range matcher.leaked {
+		descs = append(descs, matcher.check.Describe(r, 1))
+	}
+	return summary + ":\n" + strings.Join(descs, "\n")
+}
+
+// FailureMessage returns a failure message if there are leaked resources,
+// listing the leaked resources with (some) detail information.
+func (matcher *leakMatcher[R]) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected to leak %d %s%s",
+		len(matcher.leaked), matcher.noun(), matcher.dump())
+}
+
+// NegatedFailureMessage returns a negated failure message if there aren't any
+// leaked resources.
+func (matcher *leakMatcher[R]) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected not to leak %d %s%s",
+		len(matcher.leaked), matcher.noun(), matcher.dump())
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type loopDevice struct {
+	Dev     string
+	Backing string
+}
+
+var loopDevices = LeakCheck[loopDevice]{
+	Name:     "HaveLeakedLoopDevices",
+	Noun:     "loop devices",
+	Identity: func(l loopDevice) string { return l.Dev },
+	Describe: func(l loopDevice, indentation uint) string {
+		return filedesc.Indentation(indentation) + l.Dev + " backed by " + l.Backing
+	},
+}
+
+var _ = Describe("generic leak checks", func() {
+
+	It("rejects invalid actual values", func() {
+		m := loopDevices.HaveLeaked(nil)
+		Expect(m.Match(nil)).Error().To(MatchError(MatchRegexp(
+			`^HaveLeakedLoopDevices matcher expects an array or slice of loop devices.  Got:\n\s+<nil>: nil`)))
+		Expect(m.Match([]string{"/dev/loop0"})).Error().To(HaveOccurred())
+		Expect(LeakCheck[int]{}.HaveLeaked(nil).Match(42)).Error().To(MatchError(
+			ContainSubstring("array or slice of resources")))
+	})
+
+	It("finds leaked resources", func() {
+		expected := []loopDevice{{"/dev/loop0", "/a.img"}}
+		actual := []loopDevice{{"/dev/loop0", "/a.img"}, {"/dev/loop1", "/b.img"}, {"/dev/loop2", "/c.img"}}
+
+		Expect(expected).NotTo(loopDevices.HaveLeaked(expected))
+		m := loopDevices.HaveLeaked(expected, WithTransform(
+			func(l loopDevice) string { return l.Backing }, Equal("/c.img")))
+		Expect(m.Match(actual)).To(BeTrue())
+		Expect(m.FailureMessage(actual)).To(Equal(
+			"Expected to leak 1 loop devices:\n" + filedesc.Indentation(1) + "/dev/loop1 backed by /b.img"))
+		Expect(m.NegatedFailureMessage(actual)).To(HavePrefix("Expected not to leak 1 loop devices:\n"))
+	})
+
+	It("uses the optional hooks", func() {
+		check := loopDevices
+		check.Equal = func(actual, expected loopDevice) bool { return actual.Backing == expected.Backing }
+		check.Validate = func(expected, actual []loopDevice) error {
+			if len(actual) == 0 {
+				return errors.New("no loop devices at all")
+			}
+			return nil
+		}
+		check.Discount = func(leaked []loopDevice) []loopDevice { return leaked[1:] }
+		check.DumpLeaked = func(leaked, actual, expected []loopDevice, indentation uint) string {
+			devs := []string{}
+			for _, l := range leaked {
+				devs = append(devs, l.Dev)
+			}
+			return strings.Join(devs, ", ")
+		}
+		check.Summary = func(leaked []loopDevice) string { return " (oh no)" }
+
+		expected := []loopDevice{{"/dev/loop0", "/a.img"}}
+		actual := []loopDevice{{"/dev/loop0", "/other.img"}, {"/dev/loop1", "/b.img"}, {"/dev/loop2", "/c.img"}}
+		m := check.HaveLeaked(expected)
+		Expect(m.Match([]loopDevice{})).Error().To(MatchError("no loop devices at all"))
+		Expect(m.Match(actual)).To(BeTrue())
+		Expect(m.FailureMessage(actual)).To(Equal("Expected to leak 2 loop devices (oh no):\n/dev/loop1, /dev/loop2"))
+		Expect(m.Match(actual[:1])).To(BeFalse())
+	})
+
+	It("passes filter errors", func() {
+		m := loopDevices.HaveLeaked(nil, Fd().Build())
+		Expect(m.Match([]loopDevice{{"/dev/loop0", "/a.img"}})).Error().To(HaveOccurred())
+	})
+
+})
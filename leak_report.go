@@ -0,0 +1,233 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// LeakReport lists the file descriptors leaked in a particular test run in a
+// form that can be stored and later compared against the leaks of another
+// run, using [LeakReport.DiffAgainst].
+type LeakReport struct {
+	Leaks      []LeakedFd   `json:"leaks"`
+	Compaction FdCompaction `json:"compaction"` // informational fd number compaction of the run.
+	// NofileChanges informs about the changes of the RLIMIT_NOFILE limits
+	// since the baseline, if known; see [WithNofileLimits].
+	NofileChanges string `json:"nofile_changes,omitempty"`
+}
+
+// LeakedFd describes a single leaked file descriptor in a [LeakReport].
+type LeakedFd struct {
+	FdNo        int    `json:"fd"`          // fd number in the run the leak was reported in.
+	Key         string `json:"key"`         // run-independent key for comparing leaks across runs.
+	Description string `json:"description"` // detailed description as in failure messages.
+}
+
+// NewLeakReport returns a LeakReport listing the file descriptors in fds not
+// contained in the expected file descriptors and not filtered out by any of
+// the optional filter matchers; see also [HaveLeakedFds]. The leaks are sorted
+// by their kinds first and then by their fd numbers, so that reports are
+// stable for golden-file comparisons. Additionally, the report informs about
+// the fd number compaction of fds.
+func NewLeakReport(fds []FileDescriptor, expected []FileDescriptor, ignoring ...types.GomegaMatcher) (LeakReport, error) {
+	leaked, err := filterFds(fds,
+		append([]types.GomegaMatcher{IgnoringFiledescriptors(expected)}, ignoring...))
+	if err != nil {
+		return LeakReport{}, err
+	}
+	return newLeakReport(withoutPoolFds(leaked), fds), nil
+}
+
+// LeakReportOf returns a LeakReport listing the file descriptors leaked in the
+// most recent match of the specified [HaveLeakedFds] matcher, without
+// computing the leaks again. If the matcher notes RLIMIT_NOFILE limit changes,
+// see [WithNofileLimits], so does the report. If the specified matcher isn't a
+// HaveLeakedFds matcher, LeakReportOf returns false.
+func LeakReportOf(matcher types.GomegaMatcher) (LeakReport, bool) {
+	var m *leakMatcher[FileDescriptor]
+	switch matcher := matcher.(type) {
+	case *leakMatcher[FileDescriptor]:
+		m = matcher
+	case *recordedLeakMatcher:
+		m = matcher.leakMatcher
+	default:
+		return LeakReport{}, false
+	}
+	report := newLeakReport(m.leaked, m.actual)
+	report.NofileChanges = m.report.nofileChanges()
+	return report, true
+}
+
+// newLeakReport returns a LeakReport listing the specified leaked fds among
+// all fds, sorted by their kinds first and then by their fd numbers.
+func newLeakReport(leaked []FileDescriptor, fds []FileDescriptor) LeakReport {
+	leaked = slices.Clone(leaked)
+	slices.SortFunc(leaked, compareFds)
+	report := LeakReport{
+		Leaks:      make([]LeakedFd, 0, len(leaked)),
+		Compaction: Compaction(fds),
+	}
+	for _, fd := range leaked {
+		report.Leaks = append(report.Leaks, LeakedFd{
+			FdNo:        fd.FdNo(),
+			Key:         redactKey(leakKey(fd)),
+			Description: redactQuoted(describe(fd, 0)),
+		})
+	}
+	return report
+}
+
+// ReadLeakReport reads a LeakReport in JSON format from the specified reader.
+func ReadLeakReport(r io.Reader) (LeakReport, error) {
+	var report LeakReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return LeakReport{}, err
+	}
+	return report, nil
+}
+
+// Write writes the LeakReport in JSON format to the specified writer.
+func (r LeakReport) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// leakKey returns a key for the specified fd that doesn't depend on
+// run-specific details, such as fd and inode numbers, so that leaks can be
+// compared across different test runs. Files discovered
+// [filedesc.WithSameFileAcrossMounts] are keyed by their canonical paths
+// instead, so that the same file opened via different bind mounts gets the same
+// key.
+func leakKey(fd FileDescriptor) string {
+	switch fd := fd.(type) {
+	case *filedesc.PathFd:
+		if fd.SameFileAcrossMounts() {
+			return "path " + fd.CanonicalPath()
+		}
+		return "path " + fd.Path()
+	case *filedesc.ShmFd:
+		return "shm " + fd.Path()
+	case *filedesc.PipeFd:
+		return "pipe"
+	case *filedesc.SocketFd:
+		return socketKey(
+			filedesc.SocketDomain(fd.Domain()), filedesc.SocketType(fd.Type()),
+			filedesc.SocketProtocol(fd.Protocol()), fd.Listening(), fd.Name(), fd.Peer())
+	case *filedesc.NamespaceFd:
+		return "namespace " + fd.NamespaceType()
+	}
+	if anonfd, ok := filedesc.AnonInodeOf(fd); ok {
+		return "anon_inode " + anonfd.FileType()
+	}
+	return fmt.Sprintf("%T", fd)
+}
+
+// socketKey returns the run-independent key of a socket. Listening sockets are
+// keyed by their local addresses. All other sockets are keyed by their peers
+// only, as their local addresses usually contain ephemeral ports that differ
+// between runs.
+func socketKey(domain filedesc.SocketDomain, typ filedesc.SocketType, protocol filedesc.SocketProtocol, listening bool, local string, peer string) string {
+	key := fmt.Sprintf("socket %s %s %s", domain, typ, protocol.String(domain))
+	if listening {
+		return key + fmt.Sprintf(" local %q listening", local)
+	}
+	if peer != "" {
+		key += fmt.Sprintf(" peer %q", peer)
+	}
+	return key
+}
+
+// SocketLeakKey returns the run-independent key of a socket with the specified
+// properties as used in [LeakReport] leaks, with its addresses redacted using
+// [Redact]. It allows building LeakReports from other sources than procfs,
+// such as strace logs, that can be compared with LeakReports from procfs.
+func SocketLeakKey(domain filedesc.SocketDomain, typ filedesc.SocketType, protocol filedesc.SocketProtocol, listening bool, local string, peer string) string {
+	return redactKey(socketKey(domain, typ, protocol, listening, local, peer))
+}
+
+// LeakDiff is the difference between the leaks of two LeakReports.
+type LeakDiff struct {
+	New         []LeakedFd // leaks not present in the other report.
+	Preexisting []LeakedFd // leaks also present in the other report.
+	Gone        []LeakedFd // leaks of the other report not present anymore.
+}
+
+// DiffAgainst compares the leaks of this report with the leaks of another,
+// such as a stored report from a previous run, and returns the new,
+// pre-existing, and gone leaks. Leaks are compared using their run-independent
+// keys, so that fd and inode numbers differing between runs don't matter.
+func (r LeakReport) DiffAgainst(other LeakReport) LeakDiff {
+	others := map[string][]LeakedFd{}
+	for _, leak := range other.Leaks {
+		others[leak.Key] = append(others[leak.Key], leak)
+	}
+	diff := LeakDiff{}
+	for _, leak := range r.Leaks {
+		if prev := others[leak.Key]; len(prev) > 0 {
+			others[leak.Key] = prev[1:]
+			diff.Preexisting = append(diff.Preexisting, leak)
+			continue
+		}
+		diff.New = append(diff.New, leak)
+	}
+	for _, leak := range other.Leaks {
+		if prev := others[leak.Key]; len(prev) > 0 {
+			others[leak.Key] = prev[1:]
+			diff.Gone = append(diff.Gone, leak)
+		}
+	}
+	return diff
+}
+
+// Description returns a pretty formatted multi-line textual description of the
+// leak differences, highlighting new leaks first.
+func (d LeakDiff) Description(indentation uint) string {
+	var out strings.Builder
+	section := func(title string, leaks []LeakedFd) {
+		if len(leaks) == 0 {
+			return
+		}
+		if out.Len() > 0 {
+			out.WriteRune('\n')
+		}
+		out.WriteString(filedesc.Indentation(indentation))
+		out.WriteString(fmt.Sprintf("%s (%d):", title, len(leaks)))
+		for _, leak := range leaks {
+			out.WriteRune('\n')
+			out.WriteString(indentLines(leak.Description, indentation+1))
+		}
+	}
+	section("new leaks", d.New)
+	section("pre-existing leaks", d.Preexisting)
+	section("gone leaks", d.Gone)
+	return out.String()
+}
+
+// indentLines indents all lines of s by the specified indentation level.
+func indentLines(s string, indentation uint) string {
+	indent := filedesc.Indentation(indentation)
+	return indent + strings.ReplaceAll(s, "\n", "\n"+indent)
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// WriteMarkdown writes the LeakReport in Markdown format to the specified
+// writer, suitable for posting as a pull request comment. The detailed
+// descriptions of the individual leaked file descriptors are collapsible.
+func (r LeakReport) WriteMarkdown(w io.Writer) error {
+	var out strings.Builder
+	out.WriteString("## File Descriptor Leak Report\n\n")
+	if len(r.Leaks) == 0 {
+		out.WriteString("No leaked file descriptors.\n")
+	} else {
+		out.WriteString(fmt.Sprintf("**%d leaked file descriptors**\n", len(r.Leaks)))
+	}
+	for _, leak := range r.Leaks {
+		fence := markdownFence(leak.Description)
+		out.WriteString(fmt.Sprintf("\n<details>\n<summary>fd %d: %s</summary>\n\n%s\n%s\n%s\n\n</details>\n",
+			leak.FdNo, template.HTMLEscapeString(leak.Key),
+			fence, leak.Description, fence))
+	}
+	if r.Compaction.Open > 0 {
+		out.WriteString(fmt.Sprintf("\n_%s_\n", r.Compaction.Description()))
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// markdownFence returns a code fence for the specified text that is longer
+// than any run of backticks inside the text.
+func markdownFence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// WriteHTML writes the LeakReport as a standalone HTML document to the
+// specified writer. The detailed descriptions of the individual leaked file
+// descriptors are collapsible.
+func (r LeakReport) WriteHTML(w io.Writer) error {
+	return leakReportHTML.Execute(w, r)
+}
+
+var leakReportHTML = template.Must(template.New("leakreport").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>File Descriptor Leak Report</title>
+<style>
+body { font-family: sans-serif; }
+summary { cursor: pointer; font-family: monospace; }
+pre { background: #f6f8fa; padding: 0.5em; }
+</style>
+</head>
+<body>
+<h1>File Descriptor Leak Report</h1>
+{{- if .Leaks}}
+<p><strong>{{len .Leaks}} leaked file descriptors</strong></p>
+{{- range .Leaks}}
+<details>
+<summary>fd {{.FdNo}}: {{.Key}}</summary>
+<pre>{{.Description}}</pre>
+</details>
+{{- end}}
+{{- else}}
+<p>No leaked file descriptors.</p>
+{{- end}}
+{{- if .Compaction.Open}}
+<p><em>{{.Compaction.Description}}</em></p>
+{{- end}}
+</body>
+</html>
+`))
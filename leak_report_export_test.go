@@ -0,0 +1,59 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("leak report export", func() {
+
+	report := LeakReport{Leaks: []LeakedFd{
+		{FdNo: 42, Key: `path /foo<bar>`, Description: "fd 42, flags 0x0 (O_RDONLY)\n    path: \"/foo<bar>\""},
+		{FdNo: 43, Key: "pipe", Description: "fd 43 ```"},
+	}}
+
+	It("writes Markdown", func() {
+		var out strings.Builder
+		Expect(report.WriteMarkdown(&out)).To(Succeed())
+		Expect(out.String()).To(HavePrefix("## File Descriptor Leak Report\n\n**2 leaked file descriptors**\n"))
+		Expect(out.String()).To(ContainSubstring(
+			"<details>\n<summary>fd 42: path /foo&lt;bar&gt;</summary>\n\n```\nfd 42, flags 0x0 (O_RDONLY)\n    path: \"/foo<bar>\"\n```\n\n</details>\n"))
+		Expect(out.String()).To(ContainSubstring("\n````\nfd 43 ```\n````\n"))
+
+		out.Reset()
+		Expect(LeakReport{}.WriteMarkdown(&out)).To(Succeed())
+		Expect(out.String()).To(HaveSuffix("No leaked file descriptors.\n"))
+	})
+
+	It("writes HTML", func() {
+		var out strings.Builder
+		Expect(report.WriteHTML(&out)).To(Succeed())
+		Expect(out.String()).To(HavePrefix("<!DOCTYPE html>\n"))
+		Expect(out.String()).To(ContainSubstring("<p><strong>2 leaked file descriptors</strong></p>"))
+		Expect(out.String()).To(ContainSubstring(
+			"<summary>fd 42: path /foo&lt;bar&gt;</summary>\n<pre>fd 42, flags 0x0 (O_RDONLY)\n    path: &#34;/foo&lt;bar&gt;&#34;</pre>"))
+
+		out.Reset()
+		Expect(LeakReport{}.WriteHTML(&out)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("<p>No leaked file descriptors.</p>"))
+	})
+
+})
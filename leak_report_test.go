@@ -0,0 +1,166 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("leak reports", func() {
+
+	It("fails when a filter fails", func() {
+		Expect(NewLeakReport(Filedescriptors(), nil, HaveField("Foo", 42))).Error().To(HaveOccurred())
+	})
+
+	It("reports leaks and stores/reads reports", func() {
+		goods := Filedescriptors()
+		f, err := os.Open("leak_report_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		report, err := NewLeakReport(Filedescriptors(), goods)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(And(
+			HaveField("FdNo", int(f.Fd())),
+			HaveField("Key", HaveSuffix("/leak_report_test.go")),
+			HaveField("Description", ContainSubstring("leak_report_test.go")))))
+
+		var buff bytes.Buffer
+		Expect(report.Write(&buff)).To(Succeed())
+		Expect(ReadLeakReport(&buff)).To(Equal(report))
+		Expect(ReadLeakReport(strings.NewReader("{"))).Error().To(HaveOccurred())
+	})
+
+	It("optionally doesn't report the same file via a different bind mount", func() {
+		tmpdir := GinkgoT().TempDir()
+		srcdir := filepath.Join(tmpdir, "src")
+		binddir := filepath.Join(tmpdir, "bind")
+		Expect(os.Mkdir(srcdir, 0700)).To(Succeed())
+		Expect(os.Mkdir(binddir, 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(srcdir, "app.conf"), []byte("foo"), 0600)).To(Succeed())
+		if err := unix.Mount(srcdir, binddir, "", unix.MS_BIND, ""); err != nil {
+			Skip("needs privileges to bind mount: " + err.Error())
+		}
+		DeferCleanup(func() { _ = unix.Unmount(binddir, unix.MNT_DETACH) })
+
+		// Re-open the same file through the bind mount under the same fd
+		// number.
+		fd, err := unix.Open(filepath.Join(srcdir, "app.conf"), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(fd)
+		goods := Filedescriptors()
+		bindfd, err := unix.Open(filepath.Join(binddir, "app.conf"), unix.O_RDONLY, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unix.Dup3(bindfd, fd, unix.O_CLOEXEC)).To(Succeed())
+		Expect(unix.Close(bindfd)).To(Succeed())
+
+		report, err := NewLeakReport(Filedescriptors(), goods)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(And(
+			HaveField("FdNo", fd),
+			HaveField("Key", HaveSuffix("/bind/app.conf")))))
+
+		report, err = NewLeakReport(FiledescriptorsWith(filedesc.WithSameFileAcrossMounts()), goods)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(BeEmpty())
+
+		other, err := os.Open("leak_report_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unix.Dup3(int(other.Fd()), fd, unix.O_CLOEXEC)).To(Succeed())
+		Expect(other.Close()).To(Succeed())
+		report, err = NewLeakReport(FiledescriptorsWith(filedesc.WithSameFileAcrossMounts()), goods)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(And(
+			HaveField("FdNo", fd),
+			HaveField("Key", HaveSuffix("/leak_report_test.go")))))
+	})
+
+	It("keys client sockets independent of their ephemeral ports", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		goods := Filedescriptors()
+
+		run := func() LeakReport {
+			GinkgoHelper()
+			conn, err := net.Dial("tcp", l.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			report, err := NewLeakReport(Filedescriptors(), goods)
+			Expect(err).NotTo(HaveOccurred())
+			return report
+		}
+		previous := run()
+		current := run()
+		Expect(current.Leaks).To(ContainElement(HaveField("Key", And(
+			HavePrefix("socket AF_INET SOCK_STREAM IPPROTO_TCP"),
+			HaveSuffix(fmt.Sprintf(" peer %q", l.Addr().String()))))))
+		Expect(current.Leaks[0].Description).NotTo(Equal(previous.Leaks[0].Description))
+
+		diff := current.DiffAgainst(previous)
+		Expect(diff.New).To(BeEmpty())
+		Expect(diff.Gone).To(BeEmpty())
+		Expect(diff.Preexisting).To(HaveLen(len(current.Leaks)))
+	})
+
+	It("keys listening sockets by their local addresses", func() {
+		goods := Filedescriptors()
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		report, err := NewLeakReport(Filedescriptors(), goods)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(HaveField("Key",
+			fmt.Sprintf("socket AF_INET SOCK_STREAM IPPROTO_TCP local %q listening", l.Addr().String()))))
+	})
+
+	It("diffs against another report", func() {
+		goods := Filedescriptors()
+		f, err := os.Open("leak_report_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		previous, err := NewLeakReport(Filedescriptors(), goods)
+		Expect(err).NotTo(HaveOccurred())
+		previous.Leaks = append(previous.Leaks, LeakedFd{FdNo: 666, Key: "pipe", Description: "fd 666"})
+
+		fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(fd)
+		current, err := NewLeakReport(Filedescriptors(), goods)
+		Expect(err).NotTo(HaveOccurred())
+
+		diff := current.DiffAgainst(previous)
+		Expect(diff.New).To(ConsistOf(HaveField("Key", HavePrefix("socket AF_UNIX SOCK_STREAM"))))
+		Expect(diff.Preexisting).To(ConsistOf(HaveField("Key", HaveSuffix("/leak_report_test.go"))))
+		Expect(diff.Gone).To(ConsistOf(HaveField("FdNo", 666)))
+		Expect(diff.Description(0)).To(MatchRegexp(
+			`(?s)^new leaks \(1\):\n\s+fd \d+, .*socket\(AF_UNIX.*\npre-existing leaks \(1\):\n\s+fd \d+, .*leak_report_test.go.*\ngone leaks \(1\):\n\s+fd 666$`))
+		Expect(LeakDiff{}.Description(0)).To(BeEmpty())
+	})
+
+})
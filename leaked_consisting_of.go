@@ -0,0 +1,196 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+)
+
+// LeakMatcher is a matcher checking for leaked resources, such as returned by
+// [HaveLeakedFds], that additionally allows asserting exactly which resources
+// leaked.
+type LeakMatcher interface {
+	types.GomegaMatcher
+	// ConsistingOf returns a matcher that succeeds if the leaked resources
+	// consist of exactly the specified elements, in any order. Similar to
+	// Gomega's ConsistOf, elements can be either matchers or values, where
+	// values are matched using Gomega's Equal matcher. Each element must
+	// match exactly one leaked resource and each leaked resource must be
+	// matched by exactly one element. Without any elements, ConsistingOf
+	// succeeds only if there are no leaked resources at all.
+	ConsistingOf(elements ...any) types.GomegaMatcher
+	// Reporting returns this matcher with the specified report options
+	// enabling optional annotations of leaked file descriptors in failure
+	// messages. Matchers for other kinds of resources ignore them.
+	Reporting(opts ...ReportOption) LeakMatcher
+}
+
+// Reporting returns this matcher with the specified report options.
+func (matcher *leakMatcher[R]) Reporting(opts ...ReportOption) LeakMatcher {
+	for _, opt := range opts {
+		opt(&matcher.report)
+	}
+	return matcher
+}
+
+// ConsistingOf returns a matcher that succeeds if the leaked resources consist
+// of exactly the specified elements, in any order.
+func (matcher *leakMatcher[R]) ConsistingOf(elements ...any) types.GomegaMatcher {
+	matchers := make([]types.GomegaMatcher, 0, len(elements))
+	for _, element := range elements {
+		m, ok := element.(types.GomegaMatcher)
+		if !ok {
+			m = gomega.Equal(element)
+		}
+		matchers = append(matchers, m)
+	}
+	return &leakedConsistingOfMatcher[R]{
+		leaked:   matcher,
+		elements: matchers,
+	}
+}
+
+type leakedConsistingOfMatcher[R any] struct {
+	leaked   *leakMatcher[R]
+	elements []types.GomegaMatcher
+	extra    []R                   // leaked resources not matched by any element
+	missing  []types.GomegaMatcher // elements not matching any leaked resource
+}
+
+func (matcher *leakedConsistingOfMatcher[R]) Match(actual interface{}) (success bool, err error) {
+	if _, err := matcher.leaked.Match(actual); err != nil {
+		return false, err
+	}
+	leaked := matcher.leaked.leaked
+	// matches[e] lists the indices of the leaked resources matched by
+	// element e.
+	matches := make([][]int, len(matcher.elements))
+	for e, element := range matcher.elements {
+		for r, resource := range leaked {
+			ok, err := element.Match(resource)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				matches[e] = append(matches[e], r)
+			}
+		}
+	}
+	elementOf := pairElements(matches, len(leaked))
+	matcher.extra, matcher.missing = nil, nil
+	paired := make([]bool, len(matcher.elements))
+	for r, e := range elementOf {
+		if e < 0 {
+			matcher.extra = append(matcher.extra, leaked[r])
+			continue
+		}
+		paired[e] = true
+	}
+	for e, element := range matcher.elements {
+		if !paired[e] {
+			matcher.missing = append(matcher.missing, element)
+		}
+	}
+	return len(matcher.extra) == 0 && len(matcher.missing) == 0, nil
+}
+
+// pairElements returns for each of the specified number of resources the index
+// of the element it is paired with, or -1 if unpaired, maximizing the number
+// of pairs. The elements' lists of matching resources are given by matches.
+// Pairing uses augmenting paths, so that an element taking a resource another
+// element needs doesn't leave that other element unpaired.
+func pairElements(matches [][]int, resources int) []int {
+	elementOf := make([]int, resources)
+	for r := range elementOf {
+		elementOf[r] = -1
+	}
+	var augment func(e int, visited []bool) bool
+	augment = func(e int, visited []bool) bool {
+		for _, r := range matches[e] {
+			if visited[r] {
+				continue
+			}
+			visited[r] = true
+			if elementOf[r] < 0 || augment(elementOf[r], visited) {
+				elementOf[r] = e
+				return true
+			}
+		}
+		return false
+	}
+	for e := range matches {
+		augment(e, make([]bool, resources))
+	}
+	return elementOf
+}
+
+// describeElements returns the descriptions of the specified elements, one per
+// line; fd matchers built using [Fd] are described by their conditions.
+func describeElements(elements []types.GomegaMatcher) string {
+	descs := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if fdm, ok := element.(*fdMatcher); ok {
+			descs = append(descs, format.Indent+fdm.description())
+			continue
+		}
+		descs = append(descs, format.Object(element, 1))
+	}
+	return strings.Join(descs, "\n")
+}
+
+// FailureMessage returns a failure message if the leaked resources don't
+// consist of exactly the specified elements, listing the unexpectedly leaked
+// resources and the elements not matching any leaked resource.
+func (matcher *leakedConsistingOfMatcher[R]) FailureMessage(actual interface{}) (message string) {
+	message = fmt.Sprintf("Expected the leaked %s to consist of exactly %d elements, but leaked %d %s%s",
+		matcher.leaked.noun(), len(matcher.elements),
+		len(matcher.leaked.leaked), matcher.leaked.noun(), matcher.dump())
+	if len(matcher.extra) > 0 {
+		descs := make([]string, 0, len(matcher.extra))
+		for _, r := range matcher.extra {
+			descs = append(descs, matcher.leaked.check.Describe(r, 1))
+		}
+		message += fmt.Sprintf("\nthe unexpectedly leaked %s were:\n%s",
+			matcher.leaked.noun(), strings.Join(descs, "\n"))
+	}
+	if len(matcher.missing) > 0 {
+		message += fmt.Sprintf("\nthe missing elements were:\n%s", describeElements(matcher.missing))
+	}
+	return message
+}
+
+// NegatedFailureMessage returns a negated failure message if the leaked
+// resources consist of exactly the specified elements.
+func (matcher *leakedConsistingOfMatcher[R]) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected the leaked %s not to consist of exactly %d elements, but leaked %d %s%s",
+		matcher.leaked.noun(), len(matcher.elements),
+		len(matcher.leaked.leaked), matcher.leaked.noun(), matcher.dump())
+}
+
+// dump returns the detailed textual information about the leaked resources, if
+// any.
+func (matcher *leakedConsistingOfMatcher[R]) dump() string {
+	if len(matcher.leaked.leaked) == 0 {
+		return ""
+	}
+	return matcher.leaked.dump()
+}
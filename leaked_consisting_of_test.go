@@ -0,0 +1,104 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("asserting the leaked set", func() {
+
+	var names = LeakCheck[string]{
+		Name:     "HaveLeakedNames",
+		Noun:     "names",
+		Identity: func(name string) string { return name },
+		Describe: func(name string, indentation uint) string {
+			return filedesc.Indentation(indentation) + name
+		},
+	}
+
+	It("fails for invalid actual", func() {
+		Expect(HaveLeakedFds(nil).ConsistingOf().Match(42)).Error().To(HaveOccurred())
+	})
+
+	It("succeeds only without leaks when not given any elements", func() {
+		goods := Filedescriptors()
+		Expect(goods).To(HaveLeakedFds(goods).ConsistingOf())
+		Expect([]string{"foo"}).NotTo(names.HaveLeaked(nil).ConsistingOf())
+	})
+
+	It("asserts exactly the leaked fds", func() {
+		goods := Filedescriptors()
+		path, err := filepath.Abs("leaked_consisting_of_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		f, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(fd)
+
+		Expect(Filedescriptors()).To(HaveLeakedFds(goods).ConsistingOf(
+			Fd().OfKind("socket").Build(),
+			HaveField("FdNo()", int(f.Fd()))))
+		Expect(Filedescriptors()).To(HaveLeakedFds(goods, Fd().OfKind("socket").Build()).
+			ConsistingOf(Fd().WithPath(path).Build()))
+
+		m := HaveLeakedFds(goods).ConsistingOf(
+			Fd().WithPath(path).Build(),
+			Fd().WithPath("/etc/hostname").Build())
+		Expect(m.Match(Filedescriptors())).To(BeFalse())
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`(?s)^Expected the leaked file descriptors to consist of exactly 2 elements, but leaked 2 file descriptors.*:
+.*
+the unexpectedly leaked file descriptors were:
+\s+fd %d, .*
+the missing elements were:
+\s+file descriptor with path "/etc/hostname"$`, fd))
+
+		m = HaveLeakedFds(goods).ConsistingOf(Fd().OfKind("socket").Build(), Fd().OfKind("path").Build())
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.NegatedFailureMessage(nil)).To(HavePrefix(
+			"Expected the leaked file descriptors not to consist of exactly 2 elements, but leaked 2 file descriptors"))
+	})
+
+	It("matches values and doesn't get confused by overlapping matchers", func() {
+		m := names.HaveLeaked([]string{"foo"}).ConsistingOf(HavePrefix("ba"), "bar")
+		Expect([]string{"foo", "bar", "baz"}).To(m)
+		Expect([]string{"foo", "bar", "bar"}).To(m)
+		Expect([]string{"foo", "bar"}).NotTo(m)
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`^Expected the leaked names to consist of exactly 2 elements, but leaked 1 names:
+    bar
+the missing elements were:
+\s+<\*matchers.EqualMatcher \| 0x[0-9a-f]+>: {\s+Expected: <string>"bar",\s+}$`))
+	})
+
+	It("pairs elements with resources", func() {
+		Expect(pairElements([][]int{{0, 1}, {0}}, 2)).To(Equal([]int{1, 0}))
+		Expect(pairElements([][]int{{0}, {0}}, 2)).To(Equal([]int{0, -1}))
+		Expect(pairElements(nil, 1)).To(Equal([]int{-1}))
+	})
+
+})
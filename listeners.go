@@ -0,0 +1,143 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+)
+
+// HaveNoUnexpectedListeners succeeds if all listening sockets are listening on
+// allowed addresses only. Leaked listeners, such as debug servers or pprof
+// endpoints accidentally left enabled, are a security-relevant variant of fd
+// leaks. As HaveNoUnexpectedListeners doesn't need a baseline, it works for
+// launched processes, too:
+//
+//	Expect(filedesc.ProcessFiledescriptors(pid)).To(
+//	    HaveNoUnexpectedListeners("127.0.0.1:8080", ":9090"))
+//
+// Allowed addresses are specified in one of the following forms:
+//   - "host:port" for IPv4 and IPv6 sockets, such as "127.0.0.1:8080" or
+//     "[::1]:8080"; the host must be an IP address.
+//   - ":port" for IPv4 and IPv6 sockets listening on the specified port on any
+//     address.
+//   - "host:*" for IPv4 and IPv6 sockets listening on any port on the specified
+//     address.
+//   - any other address, such as "/run/foo.sock" or "@abstract", is compared
+//     to the names of unix domain sockets, see [filedesc.SocketFd.Name].
+func HaveNoUnexpectedListeners(allowed ...string) types.GomegaMatcher {
+	return &haveNoUnexpectedListenersMatcher{allowed: allowed}
+}
+
+type haveNoUnexpectedListenersMatcher struct {
+	allowed    []string
+	unexpected []FileDescriptor
+}
+
+func (matcher *haveNoUnexpectedListenersMatcher) Match(actual interface{}) (success bool, err error) {
+	actualFds, err := toFds(actual, "HaveNoUnexpectedListeners")
+	if err != nil {
+		return false, err
+	}
+	matcher.unexpected = nil
+nextFd:
+	for _, fd := range actualFds {
+		s, ok := fd.(*filedesc.SocketFd)
+		if !ok || !s.Listening() {
+			continue
+		}
+		for _, allowed := range matcher.allowed {
+			ok, err := allowsListener(allowed, s)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				continue nextFd
+			}
+		}
+		matcher.unexpected = append(matcher.unexpected, fd)
+	}
+	return len(matcher.unexpected) == 0, nil
+}
+
+// allowsListener returns true if the specified allowed address matches the
+// address of the listening socket s. It returns an error if an allowed IPv4 or
+// IPv6 address is invalid.
+func allowsListener(allowed string, s *filedesc.SocketFd) (bool, error) {
+	var ip net.IP
+	var port int
+	switch sa := s.Addr().(type) {
+	case *unix.SockaddrInet4:
+		ip, port = sa.Addr[:], sa.Port
+	case *unix.SockaddrInet6:
+		ip, port = sa.Addr[:], sa.Port
+	default:
+		return s.Name() == allowed, nil
+	}
+	host, portspec, err := net.SplitHostPort(allowed)
+	if err != nil {
+		return false, nil // not an IP address, so cannot match
+	}
+	if host != "" {
+		allowedIP := net.ParseIP(host)
+		if allowedIP == nil {
+			return false, fmt.Errorf("HaveNoUnexpectedListeners: invalid IP address in %q", allowed)
+		}
+		if !allowedIP.Equal(ip) {
+			return false, nil
+		}
+	}
+	if portspec == "*" {
+		return true, nil
+	}
+	allowedPort, err := strconv.ParseUint(portspec, 10, 16)
+	if err != nil {
+		return false, fmt.Errorf("HaveNoUnexpectedListeners: invalid port in %q", allowed)
+	}
+	return int(allowedPort) == port, nil
+}
+
+// FailureMessage returns a failure message if there are unexpected listening
+// sockets, listing these sockets.
+func (matcher *haveNoUnexpectedListenersMatcher) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected to listen only on %s, but found %d unexpected listeners:\n%s",
+		allowedListeners(matcher.allowed), len(matcher.unexpected), dumpFds(matcher.unexpected, 1))
+}
+
+// NegatedFailureMessage returns a negated failure message if there aren't any
+// unexpected listening sockets.
+func (matcher *haveNoUnexpectedListenersMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected to listen not only on %s", allowedListeners(matcher.allowed))
+}
+
+// allowedListeners returns a textual list of the allowed listener addresses.
+func allowedListeners(allowed []string) string {
+	if len(allowed) == 0 {
+		return "no addresses"
+	}
+	quoted := make([]string, 0, len(allowed))
+	for _, addr := range allowed {
+		quoted = append(quoted, strconv.Quote(addr))
+	}
+	return strings.Join(quoted, ", ")
+}
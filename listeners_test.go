@@ -0,0 +1,75 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"net"
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HaveNoUnexpectedListeners matcher", func() {
+
+	It("fails for invalid actual and invalid allowed addresses", func() {
+		m := HaveNoUnexpectedListeners()
+		Expect(m.Match(nil)).Error().To(HaveOccurred())
+		Expect(m.Match(42)).Error().To(HaveOccurred())
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		Expect(HaveNoUnexpectedListeners("localhost:80").Match(Filedescriptors())).Error().To(
+			MatchError(ContainSubstring("invalid IP address")))
+		Expect(HaveNoUnexpectedListeners(":http").Match(Filedescriptors())).Error().To(
+			MatchError(ContainSubstring("invalid port")))
+	})
+
+	It("detects unexpected listeners", func() {
+		Expect(Filedescriptors()).To(HaveNoUnexpectedListeners())
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+		m := HaveNoUnexpectedListeners("/run/foo.sock")
+		fds := Filedescriptors()
+		Expect(m.Match(fds)).To(BeFalse())
+		Expect(m.FailureMessage(fds)).To(MatchRegexp(
+			`^Expected to listen only on "/run/foo.sock", but found 1 unexpected listeners:\n\s+fd \d+, .*\n\s+listening socket\(AF_INET, SOCK_STREAM`))
+		Expect(m.NegatedFailureMessage(fds)).To(Equal(
+			`Expected to listen not only on "/run/foo.sock"`))
+
+		Expect(fds).NotTo(HaveNoUnexpectedListeners("127.0.0.2:" + port))
+		Expect(fds).NotTo(HaveNoUnexpectedListeners("127.0.0.1:1"))
+		Expect(fds).To(HaveNoUnexpectedListeners("127.0.0.1:" + port))
+		Expect(fds).To(HaveNoUnexpectedListeners(":" + port))
+		Expect(fds).To(HaveNoUnexpectedListeners("127.0.0.1:*"))
+	})
+
+	It("checks unix domain listeners", func() {
+		l, err := net.Listen("unix", "@fdooze-listener-test")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+
+		Expect(Filedescriptors()).NotTo(HaveNoUnexpectedListeners())
+		Expect(Filedescriptors()).To(HaveNoUnexpectedListeners("@fdooze-listener-test"))
+	})
+
+})
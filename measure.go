@@ -0,0 +1,53 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"github.com/onsi/gomega/gmeasure"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// Names of the measurements recorded by [MeasureDiscovery].
+const (
+	DiscoveryDurationMeasurement  = "fd discovery"
+	EnrichmentDurationMeasurement = "fd enrichment"
+	DiscoveredFdsMeasurement      = "fds discovered"
+	DiscoverySyscallsMeasurement  = "fd discovery syscalls"
+	MaxFdMeasurement              = "max fd number"
+)
+
+// MeasureDiscovery returns the list of currently open file descriptors for this
+// process, restricted by the optional discovery options, and records the
+// discovery overhead in the specified [gmeasure.Experiment], together with the
+// highest open fd number as a time series of the fd number compaction; see also
+// [Compaction]. This allows
+// performance-conscious suites to budget the overhead of fd leak checks, for
+// instance:
+//
+//	experiment := gmeasure.NewExperiment("fd leak check overhead")
+//	AddReportEntry(experiment.Name, experiment)
+//	goodfds := MeasureDiscovery(experiment)
+func MeasureDiscovery(experiment *gmeasure.Experiment, opts ...filedesc.DiscoveryOption) []FileDescriptor {
+	var stats filedesc.DiscoveryStats
+	fds := filedesc.FiledescriptorsWith(append(opts, filedesc.WithStats(&stats))...)
+	experiment.RecordDuration(DiscoveryDurationMeasurement, stats.Duration)
+	experiment.RecordDuration(EnrichmentDurationMeasurement, stats.Enrichment)
+	experiment.RecordValue(DiscoveredFdsMeasurement, float64(stats.Fds))
+	experiment.RecordValue(DiscoverySyscallsMeasurement, float64(stats.Syscalls))
+	experiment.RecordValue(MaxFdMeasurement, float64(Compaction(fds).MaxFd))
+	return fds
+}
@@ -0,0 +1,45 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"github.com/onsi/gomega/gmeasure"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("measuring discovery overhead", func() {
+
+	It("records discovery measurements", func() {
+		experiment := gmeasure.NewExperiment("fd discovery overhead")
+		fds := MeasureDiscovery(experiment)
+		Expect(fds).NotTo(BeEmpty())
+		Expect(fds).NotTo(HaveLeakedFds(Filedescriptors()))
+
+		Expect(experiment.GetStats(DiscoveryDurationMeasurement).DurationFor(gmeasure.StatMax)).
+			To(BeNumerically(">", 0))
+		Expect(experiment.GetStats(DiscoveredFdsMeasurement).FloatFor(gmeasure.StatMax)).
+			To(BeNumerically("==", len(fds)))
+		Expect(experiment.GetStats(DiscoverySyscallsMeasurement).FloatFor(gmeasure.StatMax)).
+			To(BeNumerically(">", len(fds)))
+		Expect(experiment.Get(EnrichmentDurationMeasurement).Durations).To(HaveLen(1))
+		Expect(experiment.GetStats(MaxFdMeasurement).FloatFor(gmeasure.StatMax)).
+			To(BeNumerically("==", Compaction(fds).MaxFd))
+	})
+
+})
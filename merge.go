@@ -0,0 +1,86 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"github.com/onsi/gomega/types"
+)
+
+// MergeBaselines returns a new baseline with the file descriptors of baseline
+// a extended by the file descriptors of baseline b. Use it when a fixture adds
+// known fds mid-suite and the existing baseline must be extended instead of
+// recaptured, as recapturing would also absorb any leaks accumulated so far:
+//
+//	goodfds = MergeBaselines(goodfds, fixturefds)
+//
+// Fds are de-duplicated based on their owning processes and fd numbers: fds
+// equal to an fd already in the merged baseline are dropped, while fds with
+// the same number but a different identity replace the existing fds, as the fd
+// numbers have been reused. The merged baseline lists the fds in the order of
+// a, followed by the fds only present in b. Neither a nor b are modified.
+func MergeBaselines(a, b []FileDescriptor) []FileDescriptor {
+	type slot struct {
+		pid, fdNo int
+	}
+	merged := make([]FileDescriptor, 0, len(a)+len(b))
+	slots := make(map[slot]int, len(a)+len(b)) // index into merged
+	for _, fds := range [][]FileDescriptor{a, b} {
+		for _, fd := range fds {
+			s := slot{pid: pidOf(fd), fdNo: fd.FdNo()}
+			if idx, ok := slots[s]; ok {
+				if !merged[idx].Equal(fd) {
+					merged[idx] = fd
+				}
+				continue
+			}
+			slots[s] = len(merged)
+			merged = append(merged, fd)
+		}
+	}
+	return merged
+}
+
+// Without returns a new snapshot with the file descriptors from fds that
+// aren't matched by any of the specified filter matchers, keeping the order
+// of fds. Complementary to [MergeBaselines], it allows pre-pruning baselines
+// and actual fds before handing them to matchers, keeping failure dumps clean:
+//
+//	goodfds, _ := Without(Filedescriptors(), IgnoringStdio(), IgnoringHarness())
+//
+// If a filter matcher returns an error, Without returns this error.
+func Without(fds []FileDescriptor, filters ...types.GomegaMatcher) ([]FileDescriptor, error) {
+	pruned, err := filterFds(fds, filters)
+	if err != nil {
+		return nil, err
+	}
+	if pruned == nil {
+		pruned = []FileDescriptor{}
+	}
+	return pruned, nil
+}
+
+// WithoutFunc returns a new snapshot with the file descriptors from fds for
+// which the specified function returns false, keeping the order of fds.
+func WithoutFunc(fds []FileDescriptor, del func(fd FileDescriptor) bool) []FileDescriptor {
+	pruned := make([]FileDescriptor, 0, len(fds))
+	for _, fd := range fds {
+		if !del(fd) {
+			pruned = append(pruned, fd)
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("merging baselines", func() {
+
+	It("merges without duplicates", func() {
+		Expect(MergeBaselines(nil, nil)).To(BeEmpty())
+
+		a := Filedescriptors()
+		f := Successful(os.Open("merge_test.go"))
+		defer f.Close()
+		b := Filedescriptors()
+
+		merged := MergeBaselines(a, b)
+		Expect(merged).To(HaveLen(len(b)))
+		Expect(merged[:len(a)]).To(HaveExactElements(a))
+		Expect(merged).To(ContainElement(HaveField("FdNo()", int(f.Fd()))))
+		Expect(MergeBaselines(merged, merged)).To(HaveLen(len(b)))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(merged))
+	})
+
+	It("replaces fds with reused numbers", func() {
+		f1 := Successful(os.Open("merge.go"))
+		a := Filedescriptors()
+		aCopy := slices.Clone(a)
+		fdNo := int(f1.Fd())
+		f1.Close()
+		f2 := Successful(os.Open("merge_test.go"))
+		defer f2.Close()
+		if int(f2.Fd()) != fdNo {
+			Skip("fd number not reused")
+		}
+		b := Filedescriptors()
+
+		merged := MergeBaselines(a, b)
+		Expect(a).To(Equal(aCopy))
+		Expect(merged).To(HaveLen(len(a)))
+		Expect(merged).To(ContainElement(And(
+			HaveField("FdNo()", fdNo),
+			HaveField("Path()", HaveSuffix("/merge_test.go")))))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(merged))
+		Expect(Filedescriptors()).To(HaveLeakedFds(a))
+	})
+
+})
+
+var _ = Describe("pruning snapshots", func() {
+
+	It("removes fds matching filters", func() {
+		fds := Filedescriptors()
+		pruned := Successful(Without(fds, IgnoringStdio()))
+		Expect(pruned).NotTo(ContainElement(HaveField("FdNo()", BeNumerically("<=", 2))))
+		Expect(pruned).To(HaveLen(len(WithoutFunc(fds, func(fd FileDescriptor) bool { return fd.FdNo() <= 2 }))))
+		Expect(Without(fds)).To(Equal(fds))
+		Expect(Without(nil, IgnoringStdio())).To(BeEmpty())
+		Expect(Without(fds, HaveField("Foo", 42))).Error().To(HaveOccurred())
+
+		r := NewRecorder(1)
+		r.Record("all")
+		snapshot := Successful(r.Snapshots()[0].Without(IgnoringStdio()))
+		Expect(snapshot.Label).To(Equal("all"))
+		Expect(snapshot.Fds).NotTo(ContainElement(HaveField("FdNo()", 0)))
+		Expect(r.Snapshots()[0].Fds).To(ContainElement(HaveField("FdNo()", 0)))
+		Expect(r.Snapshots()[0].Without(HaveField("Foo", 42))).Error().To(HaveOccurred())
+	})
+
+})
@@ -0,0 +1,71 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// NofileLimits returns the current RLIMIT_NOFILE limits of this process.
+func NofileLimits() filedesc.NofileLimits {
+	limits, _ := filedesc.ProcessNofileLimits(os.Getpid()) // never fails for ourselves
+	return limits
+}
+
+// HaveRestoredNofileLimits succeeds if the actual RLIMIT_NOFILE limits are the
+// same as the specified baseline limits. Some code raises the limits and never
+// restores them, so that subsequent tests run with different limits:
+//
+//	goodlimits := NofileLimits()
+//	...
+//	Expect(NofileLimits()).To(HaveRestoredNofileLimits(goodlimits))
+func HaveRestoredNofileLimits(limits filedesc.NofileLimits) types.GomegaMatcher {
+	return &haveRestoredNofileLimitsMatcher{expected: limits}
+}
+
+type haveRestoredNofileLimitsMatcher struct {
+	expected filedesc.NofileLimits
+}
+
+func (matcher *haveRestoredNofileLimitsMatcher) Match(actual interface{}) (success bool, err error) {
+	actualLimits, ok := actual.(filedesc.NofileLimits)
+	if !ok {
+		return false, fmt.Errorf(
+			"HaveRestoredNofileLimits matcher expects a filedesc.NofileLimits.  Got:\n%s",
+			format.Object(actual, 1))
+	}
+	return actualLimits == matcher.expected, nil
+}
+
+// FailureMessage returns a failure message if the limits haven't been
+// restored, detailing the changes.
+func (matcher *haveRestoredNofileLimitsMatcher) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected RLIMIT_NOFILE limits to be restored, but %s",
+		actual.(filedesc.NofileLimits).Changes(matcher.expected))
+}
+
+// NegatedFailureMessage returns a negated failure message if the limits are
+// the same as the baseline limits.
+func (matcher *haveRestoredNofileLimitsMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected RLIMIT_NOFILE limits to have changed from\n%s",
+		matcher.expected.Description(1))
+}
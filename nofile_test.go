@@ -0,0 +1,76 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RLIMIT_NOFILE limits", func() {
+
+	It("asserts restored limits", func() {
+		goodlimits := NofileLimits()
+		Expect(goodlimits.Soft).NotTo(BeZero())
+		Expect(NofileLimits()).To(HaveRestoredNofileLimits(goodlimits))
+		Expect(NewSharedBaseline(nil).NofileLimits()).To(Equal(goodlimits))
+		Expect(NofileLimits()).To(NewSharedBaseline(nil).HaveRestoredNofileLimits())
+
+		m := HaveRestoredNofileLimits(goodlimits)
+		Expect(m.Match(42)).Error().To(HaveOccurred())
+		raised := filedesc.NofileLimits{Soft: goodlimits.Soft + 1000, Hard: goodlimits.Hard}
+		Expect(m.Match(raised)).To(BeFalse())
+		Expect(m.FailureMessage(raised)).To(MatchRegexp(
+			`^Expected RLIMIT_NOFILE limits to be restored, but soft limit changed from \d+ to \d+ \(\+1000\)$`))
+		Expect(m.NegatedFailureMessage(goodlimits)).To(MatchRegexp(
+			`^Expected RLIMIT_NOFILE limits to have changed from\n\s+RLIMIT_NOFILE soft \d+, hard `))
+	})
+
+	It("notes changed limits in failure messages and leak reports", Serial, func() {
+		baseline := NewSharedBaseline(Filedescriptors())
+		goodlimits := baseline.NofileLimits()
+		lowered := unix.Rlimit{Cur: goodlimits.Soft - 1, Max: goodlimits.Hard}
+		Expect(unix.Setrlimit(unix.RLIMIT_NOFILE, &lowered)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(unix.Setrlimit(unix.RLIMIT_NOFILE,
+				&unix.Rlimit{Cur: goodlimits.Soft, Max: goodlimits.Hard})).To(Succeed())
+		})
+		f, err := os.Open("nofile_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		m := baseline.HaveLeakedFds()
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`\n\s+RLIMIT_NOFILE soft limit changed from \d+ to \d+ \(-1\)$`))
+		report, ok := LeakReportOf(m)
+		Expect(ok).To(BeTrue())
+		Expect(report.NofileChanges).To(MatchRegexp(`^soft limit changed from \d+ to \d+ \(-1\)$`))
+
+		m = HaveLeakedFds(baseline.Filedescriptors())
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).NotTo(ContainSubstring("RLIMIT_NOFILE"))
+		report, _ = LeakReportOf(m)
+		Expect(report.NofileChanges).To(BeEmpty())
+	})
+
+})
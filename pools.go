@@ -0,0 +1,133 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"sync"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+)
+
+// Pool describes a connection pool, such as a database/sql connection pool,
+// that legitimately holds on to file descriptors across specs. Register pools
+// using [RegisterPool], so that [HaveLeakedFds] and [NewLeakReport]
+// automatically subtract the file descriptors held by warm pools. As pools
+// live in this process, only this process's own file descriptors get
+// subtracted, but never the file descriptors of other processes. See package
+// [github.com/thediveo/fdooze/fdsql] for registering database/sql pools.
+type Pool struct {
+	Name string                       // name of the pool, for diagnosis.
+	Owns func(fd FileDescriptor) bool // returns true for fds the pool might own.
+	// Capacity returns the number of fds the pool currently holds at most,
+	// such as the number of open connections; nil means any number of fds
+	// owned by the pool.
+	Capacity func() int
+}
+
+var (
+	poolsMu sync.RWMutex
+	pools   []*Pool
+)
+
+// RegisterPool registers the specified connection pool, returning a function
+// to unregister the pool again.
+func RegisterPool(pool Pool) (unregister func()) {
+	p := &pool
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	pools = append(pools, p)
+	return func() {
+		poolsMu.Lock()
+		defer poolsMu.Unlock()
+		for idx, registered := range pools {
+			if registered == p {
+				pools = append(pools[:idx], pools[idx+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// OwnedByPeer returns a pool predicate for sockets connected to the specified
+// peer address, such as "127.0.0.1:5432" or a unix domain socket path.
+func OwnedByPeer(peer string) func(fd FileDescriptor) bool {
+	return func(fd FileDescriptor) bool {
+		s, ok := fd.(*filedesc.SocketFd)
+		return ok && s.Peer() == peer
+	}
+}
+
+// OwnedByPath returns a pool predicate for fds referencing the file at the
+// specified path, such as the database file of an embedded database. Fds are
+// matched by the identity of the file the path resolves to when creating the
+// predicate, that is, its device and inode number, so that the same file opened
+// via a different path matches too. Where the identities are unknown, the
+// paths are compared instead.
+func OwnedByPath(path string) func(fd FileDescriptor) bool {
+	var stat unix.Stat_t
+	statted := unix.Stat(path, &stat) == nil
+	return func(fd FileDescriptor) bool {
+		pathfd := pathFdOf(fd)
+		if pathfd == nil {
+			return false
+		}
+		if statted && pathfd.Ino() != 0 {
+			return uint64(stat.Dev) == pathfd.Dev() && stat.Ino == pathfd.Ino()
+		}
+		return pathfd.Path() == path
+	}
+}
+
+// withoutPoolFds returns the specified fds without the fds held by registered
+// connection pools. Only fds of this process are subtracted, as the pools are
+// part of this process.
+func withoutPoolFds(fds []FileDescriptor) []FileDescriptor {
+	poolsMu.RLock()
+	defer poolsMu.RUnlock()
+	if len(pools) == 0 {
+		return fds
+	}
+	capacities := make([]int, len(pools))
+	for idx, pool := range pools {
+		capacities[idx] = -1
+		if pool.Capacity != nil {
+			capacities[idx] = pool.Capacity()
+		}
+	}
+	pid := os.Getpid()
+	remaining := make([]FileDescriptor, 0, len(fds))
+nextFd:
+	for _, fd := range fds {
+		if pidOf(fd) != pid {
+			remaining = append(remaining, fd)
+			continue
+		}
+		for idx, pool := range pools {
+			if capacities[idx] == 0 || !pool.Owns(fd) {
+				continue
+			}
+			if capacities[idx] > 0 {
+				capacities[idx]--
+			}
+			continue nextFd
+		}
+		remaining = append(remaining, fd)
+	}
+	return remaining
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("connection pools", func() {
+
+	var peer string
+	var port int
+
+	BeforeEach(func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		conns := make(chan net.Conn, 10)
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conns <- conn
+			}
+		}()
+		DeferCleanup(func() {
+			l.Close()
+			for {
+				select {
+				case conn := <-conns:
+					conn.Close()
+				default:
+					return
+				}
+			}
+		})
+		peer = l.Addr().String()
+		port = l.Addr().(*net.TCPAddr).Port
+	})
+
+	It("subtracts fds held by registered pools", func() {
+		goodfds := Filedescriptors()
+		for range 2 {
+			conn, err := net.Dial("tcp", peer)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+		}
+
+		serverSide := Fd().WithLocalPort(port).Build() // the server's accepted connections
+		Expect(Filedescriptors()).To(HaveLeakedFds(goodfds, serverSide))
+
+		unregister := RegisterPool(Pool{
+			Name:     "warm",
+			Owns:     OwnedByPeer(peer),
+			Capacity: func() int { return 2 },
+		})
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, serverSide))
+		report, err := NewLeakReport(Filedescriptors(), goodfds, serverSide)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(BeEmpty())
+
+		leaky, err := net.Dial("tcp", peer)
+		Expect(err).NotTo(HaveOccurred())
+		defer leaky.Close()
+		m := HaveLeakedFds(goodfds, serverSide)
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(HavePrefix("Expected to leak 1 file descriptors:"))
+
+		unregister()
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(HavePrefix("Expected to leak 3 file descriptors:"))
+	})
+
+	It("matches pool-owned fds by path", func() {
+		goodfds := Filedescriptors()
+		path, err := filepath.Abs("pools_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		db, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		Expect(Filedescriptors()).To(HaveLeakedFds(goodfds))
+		DeferCleanup(RegisterPool(Pool{Name: "embedded", Owns: OwnedByPath(path)}))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds))
+	})
+
+	It("matches pool-owned fds by file identity", func() {
+		goodfds := Filedescriptors()
+		path, err := filepath.Abs("pools_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		link := filepath.Join(GinkgoT().TempDir(), "link")
+		if err := os.Link(path, link); err != nil {
+			Skip("needs hard links: " + err.Error())
+		}
+		db, err := os.Open(link)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		DeferCleanup(RegisterPool(Pool{Name: "embedded", Owns: OwnedByPath(path)}))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds))
+
+		other, err := os.Open("pools.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer other.Close()
+		Expect(Filedescriptors()).To(HaveLeakedFds(goodfds))
+	})
+
+	It("matches the file identity at the time of creating the predicate", func() {
+		dir := GinkgoT().TempDir()
+		path := filepath.Join(dir, "db")
+		Expect(os.WriteFile(path, nil, 0o600)).To(Succeed())
+		db, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		owns := OwnedByPath(path)
+
+		replacement := filepath.Join(dir, "replacement")
+		Expect(os.WriteFile(replacement, nil, 0o600)).To(Succeed())
+		Expect(os.Rename(replacement, path)).To(Succeed())
+		Expect(Filedescriptors()).To(ContainElement(
+			SatisfyAll(HaveField("FdNo()", int(db.Fd())), Satisfy(owns))))
+	})
+
+	It("subtracts only fds of this process", func() {
+		path, err := filepath.Abs("pools_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		db, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+		DeferCleanup(RegisterPool(Pool{Name: "embedded", Owns: OwnedByPath(path)}))
+
+		cmd := exec.Command("sleep", "30")
+		cmd.ExtraFiles = []*os.File{db} // becomes fd 3
+		Expect(cmd.Start()).To(Succeed())
+		DeferCleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+		helperFds, err := filedesc.ProcessFiledescriptors(cmd.Process.Pid)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(helperFds).To(ContainElement(HaveField("FdNo()", 3)))
+		Expect(withoutPoolFds(helperFds)).To(ContainElement(HaveField("FdNo()", 3)))
+		Expect(withoutPoolFds(Filedescriptors())).NotTo(ContainElement(
+			HaveField("FdNo()", int(db.Fd()))))
+	})
+
+})
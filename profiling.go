@@ -0,0 +1,88 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// IgnoringProfilingFiles succeeds if an actual FileDescriptor of the own
+// process references a Go coverage data file or a profile or execution trace
+// output file. Use it as a filter matcher with [HaveLeakedFds] when running
+// suites with coverage or profiling enabled, as the files are opened at
+// varying times and otherwise cause baseline churn:
+//
+//	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringProfilingFiles()))
+//
+// The files are recognized either by their paths given in the -test.* flags,
+// such as -test.cpuprofile and -test.trace, or by their path patterns: the
+// “covmeta.*” and “covcounters.*” files in coverage data directories (see
+// -test.gocoverdir and GOCOVERDIR), as well as names such as “cpu.out”,
+// “mem.prof”, “trace.out”, and “*.pprof”. Leaked profiling files are flagged
+// as such in failure messages in any case.
+func IgnoringProfilingFiles() types.GomegaMatcher {
+	paths := flagPaths(profilingFileFlags, flagValue)
+	pid := os.Getpid()
+	return Fd().with("being a coverage or profiling output file", func(fd FileDescriptor) bool {
+		pathfd := pathFdOf(fd)
+		return pathfd != nil && pidOf(fd) == pid &&
+			(slices.Contains(paths, pathfd.Path()) || isProfilingFile(pathfd.Path()))
+	}).Build()
+}
+
+// profilingFileFlags names the flags of the Go testing package whose values
+// are coverage and profiling output file paths.
+var profilingFileFlags = []fileFlag{
+	{"test.coverprofile", true},
+	{"test.cpuprofile", true},
+	{"test.memprofile", true},
+	{"test.blockprofile", true},
+	{"test.mutexprofile", true},
+	{"test.trace", true},
+}
+
+// profilingFilePattern matches the file names commonly used for profiles and
+// execution traces, optionally prefixed, such as “pkg.test-cpu.out”.
+var profilingFilePattern = regexp.MustCompile(
+	`^(.*[._-])?(cpu|mem|heap|alloc|block|mutex|goroutine|trace|cover|coverage)(profile)?\.(out|prof|pprof)$|\.pprof$`)
+
+// isProfilingFile returns true if the specified path matches the path
+// patterns of Go coverage data files, profiles, and execution traces.
+func isProfilingFile(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, "covmeta.") || strings.HasPrefix(name, "covcounters.") ||
+		profilingFilePattern.MatchString(name)
+}
+
+// profilingAnnotation returns an annotation line for a leaked coverage or
+// profiling output file. Otherwise, an empty annotation is returned.
+func profilingAnnotation(fd FileDescriptor, indentation uint) string {
+	pathfd := pathFdOf(fd)
+	if pathfd == nil || !isProfilingFile(pathfd.Path()) {
+		return ""
+	}
+	return fmt.Sprintf("\n%scoverage or profiling output file (see IgnoringProfilingFiles)",
+		filedesc.Indentation(indentation))
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("profiling files", func() {
+
+	DescribeTable("recognizes coverage and profiling files",
+		func(path string, expected bool) {
+			Expect(isProfilingFile(path)).To(Equal(expected))
+		},
+		Entry(nil, "/tmp/cover/covmeta.4a3bd9a7b1c4e1f5", true),
+		Entry(nil, "/tmp/cover/covcounters.4a3bd9a7b1c4e1f5.1234.1700000000", true),
+		Entry(nil, "/src/cpu.out", true),
+		Entry(nil, "/src/mem.prof", true),
+		Entry(nil, "/src/fdooze.test-cpuprofile.out", true),
+		Entry(nil, "/src/trace.out", true),
+		Entry(nil, "/src/coverage.out", true),
+		Entry(nil, "/src/heap.pprof", true),
+		Entry(nil, "/src/whatever.pprof", true),
+		Entry(nil, "/src/output.out", false),
+		Entry(nil, "/src/cpu.go", false),
+		Entry(nil, "/src/covmeta", false),
+	)
+
+	It("ignores and flags profiling files", func() {
+		dir := GinkgoT().TempDir()
+		goodfds := Filedescriptors()
+		f := Successful(os.Create(filepath.Join(dir, "cpu.out")))
+		defer f.Close()
+
+		m := HaveLeakedFds(goodfds)
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.NegatedFailureMessage(nil)).To(ContainSubstring(
+			"coverage or profiling output file (see IgnoringProfilingFiles)"))
+		Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringProfilingFiles()))
+	})
+
+	It("ignores profiling files given by flags", func() {
+		dir := GinkgoT().TempDir()
+		flags := map[string]string{
+			"test.outputdir":  dir,
+			"test.cpuprofile": "profile.bin",
+			"test.trace":      filepath.Join(dir, "tracing.bin"),
+		}
+		Expect(flagPaths(profilingFileFlags, func(name string) string { return flags[name] })).To(
+			ConsistOf(filepath.Join(dir, "profile.bin"), filepath.Join(dir, "tracing.bin")))
+	})
+
+})
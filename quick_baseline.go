@@ -0,0 +1,140 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"slices"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// QuickBaseline is a baseline of expected file descriptors of a process that
+// makes per-spec leak checks nearly free in the common no-leak case: instead of
+// always running a full discovery with its enrichment of each fd, it first
+// cheaply screens the process' fd table by comparing its link-target prehash
+// with the baseline's prehash, see [filedesc.LinkPrehash]. Only if the
+// prehashes differ or the prehash cannot be computed, a full discovery is run.
+//
+//	var baseline *QuickBaseline
+//
+//	BeforeEach(func() {
+//	    baseline = NewQuickBaseline()
+//	    DeferCleanup(func() {
+//	        Expect(baseline.Current()).NotTo(baseline.HaveLeakedFds())
+//	    })
+//	})
+//
+// Please note that the prehash doesn't notice an fd that was closed and then
+// reused for reopening the same path or for an anonymous inode fd of the same
+// type, such as an eventfd. When in doubt, use [HaveLeakedFds] with a full
+// discovery instead.
+type QuickBaseline struct {
+	pid       int // PID of the process, or 0 for this process.
+	fds       []FileDescriptor
+	prehash   uint64 // link-target prehash of the baseline fd table.
+	prehashed bool   // prehash is valid for the baseline fds.
+}
+
+// NewQuickBaseline returns a new QuickBaseline for this process, taking a full
+// snapshot of the currently open file descriptors.
+func NewQuickBaseline() *QuickBaseline {
+	b, _ := newQuickBaseline(0)
+	return b
+}
+
+// NewProcessQuickBaseline returns a new QuickBaseline for the process
+// identified by pid, taking a full snapshot of its currently open file
+// descriptors.
+func NewProcessQuickBaseline(pid int) (*QuickBaseline, error) {
+	if pid == os.Getpid() {
+		pid = 0
+	}
+	return newQuickBaseline(pid)
+}
+
+// newQuickBaseline returns a new QuickBaseline for the process identified by
+// pid, or this process if pid is zero. As the fd table might change while
+// discovering the baseline fds, the prehash is taken before and after the
+// discovery and only considered valid if both prehashes are the same.
+// Otherwise, the quick screening always falls back to a full discovery.
+func newQuickBaseline(pid int) (*QuickBaseline, error) {
+	b := &QuickBaseline{pid: pid}
+	before, beforeErr := b.linkPrehash()
+	fds, err := b.discover()
+	if err != nil {
+		return nil, err
+	}
+	after, afterErr := b.linkPrehash()
+	b.fds = fds
+	b.prehash = after
+	b.prehashed = beforeErr == nil && afterErr == nil && before == after
+	return b, nil
+}
+
+// Filedescriptors returns a copy of the expected file descriptors.
+func (b *QuickBaseline) Filedescriptors() []FileDescriptor {
+	return slices.Clone(b.fds)
+}
+
+// Unchanged returns true if the fd table of the process passes the quick
+// screening as unchanged: its link-target prehash is the same as at baseline
+// time. It returns false if the fd table has changed, the prehash cannot be
+// computed, or there is no valid baseline prehash.
+func (b *QuickBaseline) Unchanged() bool {
+	if !b.prehashed {
+		return false
+	}
+	prehash, err := b.linkPrehash()
+	return err == nil && prehash == b.prehash
+}
+
+// Current returns the currently open file descriptors of the process. If the
+// fd table passes the quick screening as unchanged, the baseline file
+// descriptors are returned instead of running a full discovery. Otherwise, the
+// open file descriptors are fully discovered; in case of a discovery error nil
+// is returned.
+func (b *QuickBaseline) Current() []FileDescriptor {
+	if b.Unchanged() {
+		return b.Filedescriptors()
+	}
+	fds, _ := b.discover()
+	return fds
+}
+
+// HaveLeakedFds returns a [HaveLeakedFds] matcher for the expected file
+// descriptors of this baseline, together with the optional filter matchers.
+func (b *QuickBaseline) HaveLeakedFds(ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return HaveLeakedFds(b.fds, ignoring...)
+}
+
+// discover runs a full discovery of the open file descriptors of the process.
+func (b *QuickBaseline) discover() ([]FileDescriptor, error) {
+	if b.pid == 0 {
+		return filedesc.Filedescriptors(), nil
+	}
+	return filedesc.ProcessFiledescriptors(b.pid)
+}
+
+// linkPrehash returns the link-target prehash of the process' fd table.
+func (b *QuickBaseline) linkPrehash() (uint64, error) {
+	if b.pid == 0 {
+		return filedesc.LinkPrehash(os.Getpid())
+	}
+	return filedesc.LinkPrehash(b.pid)
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("quick baseline", func() {
+
+	It("short-circuits an unchanged fd table", func() {
+		b := NewQuickBaseline()
+		Expect(b.Filedescriptors()).NotTo(BeEmpty())
+		Expect(b.Unchanged()).To(BeTrue())
+		current := b.Current()
+		Expect(current).To(HaveLen(len(b.fds)))
+		for idx := range current {
+			Expect(current[idx]).To(BeIdenticalTo(b.fds[idx]))
+		}
+		Expect(current).NotTo(b.HaveLeakedFds())
+	})
+
+	It("runs a full discovery for a changed fd table", func() {
+		b := NewQuickBaseline()
+		fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		defer unix.Close(fd)
+
+		Expect(b.Unchanged()).To(BeFalse())
+		Expect(b.Current()).To(b.HaveLeakedFds())
+
+		unix.Close(fd)
+		Expect(b.Unchanged()).To(BeTrue())
+		Expect(b.Current()).NotTo(b.HaveLeakedFds())
+	})
+
+	It("notices reused fd numbers", func() {
+		fd := Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0))
+		b := NewQuickBaseline()
+		Expect(b.prehashed).To(BeTrue())
+
+		Expect(unix.Close(fd)).To(Succeed())
+		f := Successful(os.Open("quick_baseline_test.go"))
+		defer f.Close()
+		Expect(int(f.Fd())).To(Equal(fd))
+
+		Expect(b.Unchanged()).To(BeFalse())
+		Expect(b.Current()).To(b.HaveLeakedFds())
+	})
+
+	It("falls back to full discovery without a valid prehash", func() {
+		b := NewQuickBaseline()
+		b.prehashed = false
+		Expect(b.Unchanged()).To(BeFalse())
+		Expect(b.Current()).NotTo(b.HaveLeakedFds())
+	})
+
+	It("screens other processes", func() {
+		Expect(NewProcessQuickBaseline(-1)).Error().To(HaveOccurred())
+
+		b := Successful(NewProcessQuickBaseline(os.Getpid()))
+		Expect(b.pid).To(BeZero())
+		Expect(b.Unchanged()).To(BeTrue())
+	})
+
+})
@@ -0,0 +1,47 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import "runtime"
+
+// Quorum runs the specified fd discovery function the specified number of
+// passes and returns only those file descriptors present in all passes. This
+// suppresses one-off procfs races as well as short-lived helper fds, but
+// without having to resort to a fixed grace duration. The file descriptors are
+// returned in the order of the final discovery pass.
+//
+// Pass Quorum's result to [HaveLeakedFds] in order to only report leaked fds
+// that are present in all discovery passes:
+//
+//	Expect(Quorum(3, Filedescriptors)).NotTo(HaveLeakedFds(goodfds))
+//
+// A passes value of less than 1 is treated as a single pass.
+func Quorum(passes int, discover func() []FileDescriptor) []FileDescriptor {
+	fds := discover()
+	for pass := 1; pass < passes; pass++ {
+		runtime.Gosched() // give short-lived fds a chance to go away.
+		present := IgnoringFiledescriptors(fds)
+		next := discover()
+		fds = fds[:0:0]
+		for _, fd := range next {
+			if ok, _ := present.Match(fd); ok {
+				fds = append(fds, fd)
+			}
+		}
+	}
+	return fds
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	"github.com/thediveo/fdooze/fixtures"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("quorum discovery", func() {
+
+	It("returns the fds of a single pass", func() {
+		fds := Quorum(0, Filedescriptors)
+		Expect(fds).NotTo(BeEmpty())
+		Expect(fds).NotTo(HaveLeakedFds(Filedescriptors()))
+	})
+
+	It("suppresses short-lived fds", func() {
+		goodfds := Filedescriptors()
+		var f *os.File
+		pass := 0
+		discover := func() []FileDescriptor {
+			pass++
+			switch pass {
+			case 1:
+				var err error
+				f, err = os.Open("quorum_test.go")
+				Expect(err).NotTo(HaveOccurred())
+			case 2:
+				f.Close()
+			}
+			return Filedescriptors()
+		}
+		Expect(Quorum(3, discover)).NotTo(HaveLeakedFds(goodfds))
+		Expect(pass).To(Equal(3))
+	})
+
+	It("keeps permanent fds", func() {
+		goodfds := Filedescriptors()
+		f, err := os.Open("quorum_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		Expect(Quorum(3, Filedescriptors)).To(HaveLeakedFds(goodfds))
+	})
+	It("suppresses churned fds under contention", func() {
+		goodfds := Filedescriptors()
+		churn := fixtures.StartChurn(4, 42)
+		defer churn.Stop()
+		Eventually(churn.Cycles).Should(BeNumerically(">", 100))
+
+		Eventually(func() []FileDescriptor {
+			return Quorum(5, Filedescriptors)
+		}).ShouldNot(HaveLeakedFds(goodfds))
+	})
+
+})
@@ -0,0 +1,202 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// Recorder keeps the last N recorded fd snapshots in a ring buffer with bounded
+// memory, so that on failure the evolution of the leaked fds can be dumped:
+// when they were first seen and how the fd numbers changed over time. This
+// often immediately reveals the operation that created the leaked fds.
+//
+//	rec := NewRecorder(16)
+//	goodfds := rec.Record("baseline")
+//	dial()
+//	rec.Record("dialed")
+//	hangup()
+//	Expect(rec.Record("hung up")).NotTo(rec.HaveLeakedFds(goodfds))
+//
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	mu        sync.Mutex
+	snapshots []Snapshot // ring buffer
+	next      int        // index of the next snapshot slot to (over)write
+	count     uint64     // total number of snapshots recorded
+}
+
+// Snapshot is a recorded snapshot of file descriptors.
+type Snapshot struct {
+	Seq   uint64           // sequence number of the snapshot, counting from 1.
+	Label string           // label identifying the point of recording.
+	Time  time.Time        // time of recording.
+	Fds   []FileDescriptor // recorded file descriptors.
+}
+
+// Without returns a copy of the snapshot without the file descriptors matched
+// by any of the specified filter matchers; see [Without].
+func (s Snapshot) Without(filters ...types.GomegaMatcher) (Snapshot, error) {
+	fds, err := Without(s.Fds, filters...)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	s.Fds = fds
+	return s, nil
+}
+
+// NewRecorder returns a new Recorder keeping the last capacity snapshots. A
+// capacity of less than 1 is treated as 1.
+func NewRecorder(capacity int) *Recorder {
+	return &Recorder{snapshots: make([]Snapshot, 0, max(capacity, 1))}
+}
+
+// Record records a snapshot of the file descriptors of this process with the
+// specified label and returns the file descriptors.
+func (r *Recorder) Record(label string) []FileDescriptor {
+	fds := Filedescriptors()
+	r.RecordFds(label, fds)
+	return fds
+}
+
+// RecordFds records the specified file descriptors as a snapshot with the
+// specified label, such as fds of another process.
+func (r *Recorder) RecordFds(label string, fds []FileDescriptor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count++
+	snapshot := Snapshot{Seq: r.count, Label: label, Time: time.Now(), Fds: fds}
+	if len(r.snapshots) < cap(r.snapshots) {
+		r.snapshots = append(r.snapshots, snapshot)
+		return
+	}
+	r.snapshots[r.next] = snapshot
+	r.next = (r.next + 1) % len(r.snapshots)
+}
+
+// Snapshots returns the recorded snapshots still kept, oldest first.
+func (r *Recorder) Snapshots() []Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshots := make([]Snapshot, 0, len(r.snapshots))
+	snapshots = append(snapshots, r.snapshots[r.next:]...)
+	return append(snapshots, r.snapshots[:r.next]...)
+}
+
+// Evolution returns a pretty formatted multi-line textual description of the
+// evolution of the specified (leaked) fds over the recorded snapshots: for
+// each fd it lists the snapshots where its state changed, that is, when it was
+// absent, present (first seen), or when its fd number referenced something
+// else.
+func (r *Recorder) Evolution(fds []FileDescriptor, indentation uint) string {
+	snapshots := r.Snapshots()
+	if len(snapshots) == 0 || len(fds) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%sevolution over the last %d recorded snapshots:",
+		filedesc.Indentation(indentation), len(snapshots)))
+	for _, fd := range fds {
+		out.WriteString(fmt.Sprintf("\n%sfd %d (%s):",
+			filedesc.Indentation(indentation+1), fd.FdNo(), redactKey(leakKey(fd))))
+		prevState := ""
+		seen := false
+		for _, snapshot := range snapshots {
+			state := fdState(fd, snapshot.Fds)
+			if state == prevState {
+				continue
+			}
+			prevState = state
+			if state == "present" {
+				if !seen {
+					state = "first seen"
+				} else {
+					state = "seen again"
+				}
+				seen = true
+			}
+			out.WriteString(fmt.Sprintf("\n%s#%d %q (+%s): %s",
+				filedesc.Indentation(indentation+2), snapshot.Seq, snapshot.Label,
+				snapshot.Time.Sub(snapshots[0].Time).Round(time.Microsecond), state))
+		}
+	}
+	return out.String()
+}
+
+// fdState returns the state of the specified fd in the specified snapshot
+// fds: "absent", "present", or what the fd number referenced instead.
+func fdState(fd FileDescriptor, fds []FileDescriptor) string {
+	pid := pidOf(fd)
+	for _, other := range fds {
+		if other.FdNo() != fd.FdNo() || pidOf(other) != pid {
+			continue
+		}
+		if other.Equal(fd) {
+			return "present"
+		}
+		return "referenced " + redactKey(leakKey(other))
+	}
+	return "absent"
+}
+
+// HaveLeakedFds returns a [HaveLeakedFds] matcher that additionally dumps the
+// evolution of the leaked fds over the recorded snapshots in its failure
+// messages.
+func (r *Recorder) HaveLeakedFds(fds []FileDescriptor, ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return &recordedLeakMatcher{
+		leakMatcher: fdLeakCheck.haveLeaked(fds, ignoring),
+		recorder:    r,
+	}
+}
+
+type recordedLeakMatcher struct {
+	*leakMatcher[FileDescriptor]
+	recorder *Recorder
+}
+
+// Reporting returns this matcher with the specified report options.
+func (matcher *recordedLeakMatcher) Reporting(opts ...ReportOption) LeakMatcher {
+	matcher.leakMatcher.Reporting(opts...)
+	return matcher
+}
+
+// FailureMessage returns a failure message if there are leaked fds, followed
+// by the evolution of the leaked fds.
+func (matcher *recordedLeakMatcher) FailureMessage(actual interface{}) (message string) {
+	return matcher.withEvolution(matcher.leakMatcher.FailureMessage(actual))
+}
+
+// NegatedFailureMessage returns a negated failure message if there are leaked
+// fds, followed by the evolution of the leaked fds.
+func (matcher *recordedLeakMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return matcher.withEvolution(matcher.leakMatcher.NegatedFailureMessage(actual))
+}
+
+// withEvolution appends the evolution of the leaked fds to the specified
+// message, if any.
+func (matcher *recordedLeakMatcher) withEvolution(message string) string {
+	if evolution := matcher.recorder.Evolution(matcher.leaked, 0); evolution != "" {
+		return message + "\n" + evolution
+	}
+	return message
+}
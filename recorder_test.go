@@ -0,0 +1,76 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("snapshot recorder", func() {
+
+	It("keeps only the last snapshots", func() {
+		r := NewRecorder(0)
+		Expect(r.Snapshots()).To(BeEmpty())
+		Expect(r.Evolution(Filedescriptors(), 0)).To(BeEmpty())
+
+		r = NewRecorder(2)
+		for _, label := range []string{"a", "b", "c"} {
+			r.RecordFds(label, nil)
+		}
+		Expect(r.Snapshots()).To(HaveExactElements(
+			And(HaveField("Seq", uint64(2)), HaveField("Label", "b")),
+			And(HaveField("Seq", uint64(3)), HaveField("Label", "c"))))
+		r.RecordFds("d", nil)
+		Expect(r.Snapshots()).To(HaveExactElements(
+			HaveField("Label", "c"), HaveField("Label", "d")))
+	})
+
+	It("dumps the evolution of leaked fds", func() {
+		r := NewRecorder(8)
+		goodfds := r.Record("baseline")
+
+		f1 := Successful(os.Open("recorder.go"))
+		r.Record("opened recorder.go")
+		fdNo := int(f1.Fd())
+		f1.Close()
+		f2 := Successful(os.Open("recorder_test.go"))
+		defer f2.Close()
+		if int(f2.Fd()) != fdNo {
+			Skip("fd number not reused")
+		}
+		r.Record("opened recorder_test.go")
+		r.Record("idle")
+
+		m := r.HaveLeakedFds(goodfds)
+		Expect(m.Match(r.Record("check"))).To(BeTrue())
+		Expect(m.NegatedFailureMessage(nil)).To(MatchRegexp(
+			`(?s)^Expected not to leak 1 file descriptors:\n.*recorder_test\.go.*\n` +
+				`evolution over the last 5 recorded snapshots:\n` +
+				`    fd \d+ \(path .*/recorder_test\.go\):\n` +
+				`        #1 "baseline" \(\+0s\): absent\n` +
+				`        #2 "opened recorder\.go" \(\+.*\): referenced path .*/recorder\.go\n` +
+				`        #3 "opened recorder_test\.go" \(\+.*\): first seen$`))
+		Expect(m.FailureMessage(nil)).To(ContainSubstring("evolution over the last"))
+
+		Expect(r.HaveLeakedFds(Filedescriptors()).Match(Filedescriptors())).To(BeFalse())
+	})
+
+})
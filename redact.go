@@ -0,0 +1,80 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Redact, if non-nil, redacts sensitive values, such as paths, peer addresses,
+// and unix socket names, before they land in failure messages and leak reports.
+// Redact is passed each individual value and returns the value to render
+// instead, such as:
+//
+//	Redact = func(value string) string {
+//	    return tenantHosts.ReplaceAllString(value, "<tenant>")
+//	}
+//
+// Redaction applies to the rendered values only; matching and the identities
+// of file descriptors (see [IdentityHash]) are unaffected.
+var Redact func(value string) string
+
+// redactValue returns the specified value redacted using [Redact].
+func redactValue(value string) string {
+	if Redact == nil {
+		return value
+	}
+	return Redact(value)
+}
+
+// redactQuoted returns the specified (multi-line) text with all quoted values
+// redacted using [Redact].
+func redactQuoted(text string) string {
+	if Redact == nil {
+		return text
+	}
+	var out strings.Builder
+	for pos := 0; pos < len(text); pos++ {
+		if text[pos] == '"' {
+			if quoted, err := strconv.QuotedPrefix(text[pos:]); err == nil {
+				if value, err := strconv.Unquote(quoted); err == nil {
+					out.WriteString(strconv.Quote(Redact(value)))
+					pos += len(quoted) - 1
+					continue
+				}
+			}
+		}
+		out.WriteByte(text[pos])
+	}
+	return out.String()
+}
+
+// redactKey returns the specified leak key with its values redacted using
+// [Redact]. The paths of path and shared memory fd keys are unquoted, whereas
+// the addresses of socket keys are quoted.
+func redactKey(key string) string {
+	if Redact == nil {
+		return key
+	}
+	for _, prefix := range []string{"path ", "shm "} {
+		if path, ok := strings.CutPrefix(key, prefix); ok {
+			return prefix + Redact(path)
+		}
+	}
+	return redactQuoted(key)
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("redaction", func() {
+
+	It("leaves values alone without redaction", func() {
+		Expect(redactQuoted(`path: "/secret"`)).To(Equal(`path: "/secret"`))
+		Expect(redactKey("path /secret")).To(Equal("path /secret"))
+		Expect(redactValue("/secret")).To(Equal("/secret"))
+	})
+
+	It("redacts values", Serial, func() {
+		DeferCleanup(func() { Redact = nil })
+		Redact = func(value string) string { return strings.ReplaceAll(value, "secret", "<redacted>") }
+
+		Expect(redactQuoted(`path: "/secret/foo" "not \"closed`)).To(Equal(
+			`path: "/<redacted>/foo" "not \"closed`))
+		Expect(redactKey("path /secret")).To(Equal("path /<redacted>"))
+		Expect(redactKey("shm /dev/shm/secret")).To(Equal("shm /dev/shm/<redacted>"))
+		Expect(redactKey(`socket AF_UNIX SOCK_STREAM 0 local "@secret" peer "@secret"`)).To(Equal(
+			`socket AF_UNIX SOCK_STREAM 0 local "@<redacted>" peer "@<redacted>"`))
+		Expect(redactValue("secret")).To(Equal("<redacted>"))
+	})
+
+	It("redacts failure messages and leak reports", Serial, func() {
+		DeferCleanup(func() { Redact = nil })
+
+		goodfds := Filedescriptors()
+		dir := filepath.Join(GinkgoT().TempDir(), "secret-tenant")
+		Expect(os.Mkdir(dir, 0700)).To(Succeed())
+		f, err := os.Create(filepath.Join(dir, "leaked"))
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		l, err := net.Listen("unix", "@secret-socket")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		fds := Filedescriptors()
+		hashes := SnapshotHash(fds)
+
+		Redact = func(value string) string { return strings.ReplaceAll(value, "secret", "<redacted>") }
+		m := HaveLeakedFds(goodfds)
+		Expect(m.Match(fds)).To(BeTrue())
+		Expect(m.FailureMessage(fds)).NotTo(ContainSubstring("secret"))
+		Expect(m.FailureMessage(fds)).To(ContainSubstring(`<redacted>-tenant/leaked"`))
+		Expect(m.FailureMessage(fds)).To(ContainSubstring(`"@<redacted>-socket"`))
+
+		report, err := NewLeakReport(fds, goodfds)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ContainElements(
+			HaveField("Key", HaveSuffix("<redacted>-tenant/leaked")),
+			HaveField("Description", ContainSubstring(`"@<redacted>-socket"`))))
+		for _, leak := range report.Leaks {
+			Expect(leak.Key).NotTo(ContainSubstring("secret"))
+			Expect(leak.Description).NotTo(ContainSubstring("secret"))
+		}
+
+		Expect(SnapshotHash(fds)).To(Equal(hashes))
+	})
+
+})
@@ -0,0 +1,92 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Renderer renders the pretty formatted (multi-line) textual description of a
+// file descriptor, as shown in the failure messages of matchers and in leak
+// reports. Renderers must honor the specified indentation level, see also
+// [filedesc.Indentation]. A renderer might call the file descriptor's own
+// Description method in order to decorate the default description, such as
+// appending internal asset IDs resolved from paths.
+type Renderer interface {
+	Render(fd FileDescriptor, indentation uint) string
+}
+
+// RendererFunc adapts an ordinary function to the [Renderer] interface.
+type RendererFunc func(fd FileDescriptor, indentation uint) string
+
+// Render returns f(fd, indentation).
+func (f RendererFunc) Render(fd FileDescriptor, indentation uint) string {
+	return f(fd, indentation)
+}
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = map[string]Renderer{}
+)
+
+// RegisterRenderer registers a custom renderer for the specified kind of file
+// descriptors, as for [FdMatcherBuilder.OfKind], such as "path" or "socket".
+// The empty kind "" registers a global renderer used for all kinds of file
+// descriptors without their own registered renderer. Registering a nil
+// renderer removes a previously registered renderer. Without any registered
+// renderers, the file descriptors' own Description methods are used.
+func RegisterRenderer(kind string, renderer Renderer) error {
+	if _, ok := fdKinds[kind]; !ok && kind != "" {
+		return fmt.Errorf("RegisterRenderer: unknown fd kind %q", kind)
+	}
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	if renderer == nil {
+		delete(renderers, kind)
+		return nil
+	}
+	renderers[kind] = renderer
+	return nil
+}
+
+// describe returns the textual description of the specified fd, using a
+// registered renderer for the kind of fd, a registered global renderer, or
+// otherwise the fd's own description, in this order.
+func describe(fd FileDescriptor, indentation uint) string {
+	renderersMu.RLock()
+	renderer, ok := renderers[kindOf(fd)]
+	if !ok {
+		renderer, ok = renderers[""]
+	}
+	renderersMu.RUnlock()
+	if ok {
+		return renderer.Render(fd, indentation)
+	}
+	return fd.Description(indentation)
+}
+
+// kindOf returns the kind name of the specified fd, or "" if the fd isn't of
+// any known kind.
+func kindOf(fd FileDescriptor) string {
+	for kind, test := range fdKinds {
+		if test(fd) {
+			return kind
+		}
+	}
+	return ""
+}
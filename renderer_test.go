@@ -0,0 +1,64 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pluggable renderers", Serial, func() {
+
+	AfterEach(func() {
+		Expect(RegisterRenderer("", nil)).To(Succeed())
+		Expect(RegisterRenderer("path", nil)).To(Succeed())
+	})
+
+	It("rejects unknown kinds", func() {
+		Expect(RegisterRenderer("foobar", nil)).To(MatchError(
+			`RegisterRenderer: unknown fd kind "foobar"`))
+	})
+
+	It("renders using the registered renderers", func() {
+		pathfd, err := filedesc.NewPathFd(0, "/proc/self/fd", "/foo/bar")
+		Expect(err).NotTo(HaveOccurred())
+		nsfd := &filedesc.NamespaceFd{}
+		Expect(describe(pathfd, 0)).To(Equal(pathfd.Description(0)))
+
+		Expect(RegisterRenderer("", RendererFunc(func(fd FileDescriptor, indentation uint) string {
+			return "global"
+		}))).To(Succeed())
+		Expect(describe(pathfd, 0)).To(Equal("global"))
+		Expect(describe(nsfd, 0)).To(Equal("global"))
+
+		Expect(RegisterRenderer("path", RendererFunc(func(fd FileDescriptor, indentation uint) string {
+			return fd.Description(indentation) + fmt.Sprintf("\n%sasset: 42",
+				filedesc.Indentation(indentation+1))
+		}))).To(Succeed())
+		Expect(describe(pathfd, 0)).To(HaveSuffix("\n    asset: 42"))
+		Expect(dumpFds([]FileDescriptor{pathfd}, 0)).To(HaveSuffix("\n    asset: 42"))
+		Expect(describe(nsfd, 0)).To(Equal("global"))
+
+		Expect(RegisterRenderer("path", nil)).To(Succeed())
+		Expect(describe(pathfd, 0)).To(Equal("global"))
+	})
+
+})
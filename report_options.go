@@ -0,0 +1,75 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import "github.com/thediveo/fdooze/filedesc"
+
+// ReportOption enables optional annotations of the leaked file descriptors in
+// the failure messages of a particular [HaveLeakedFds] matcher; see
+// [LeakMatcher.Reporting]. As these annotations are more costly to gather or
+// more verbose than the default annotations, they are disabled by default.
+type ReportOption func(*reportOptions)
+
+// reportOptions are the report options of a particular leak matcher.
+type reportOptions struct {
+	baselineNeighbors bool                   // see WithBaselineNeighbors
+	blockedThreads    bool                   // see WithBlockedThreads
+	nofileBaseline    *filedesc.NofileLimits // see WithNofileLimits
+}
+
+// WithBaselineNeighbors annotates leaked fds with their nearest fds in the
+// baseline, giving immediate context in fd number reuse situations: either the
+// baseline fd with the same number, which referenced something else before,
+// or otherwise the baseline fds with the next lower and higher numbers.
+func WithBaselineNeighbors() ReportOption {
+	return func(o *reportOptions) {
+		o.baselineNeighbors = true
+	}
+}
+
+// WithBlockedThreads annotates leaked fds with the threads of their owning
+// processes currently blocked in syscalls on them, such as a thread stuck in a
+// read(2) on a leaked pipe, pointing directly at the culpable thread. It is
+// best effort and mainly intended for supervised non-Go processes; see
+// [filedesc.BlockedThreads] for the permissions needed.
+func WithBlockedThreads() ReportOption {
+	return func(o *reportOptions) {
+		o.blockedThreads = true
+	}
+}
+
+// WithNofileLimits notes the changes of the RLIMIT_NOFILE limits of this
+// process since the specified baseline limits, including the deltas, such as
+// from code raising the soft limit and never restoring it. The changes are
+// noted in failure messages as well as in leak reports from [LeakReportOf].
+// [SharedBaseline.HaveLeakedFds] automatically notes the changes since the
+// limits snapshotted with the baseline.
+func WithNofileLimits(baseline filedesc.NofileLimits) ReportOption {
+	return func(o *reportOptions) {
+		o.nofileBaseline = &baseline
+	}
+}
+
+// nofileChanges returns the textual description of the changes of the
+// RLIMIT_NOFILE limits since the baseline limits, or "" if there are no
+// baseline limits or no changes.
+func (o reportOptions) nofileChanges() string {
+	if o.nofileBaseline == nil {
+		return ""
+	}
+	return NofileLimits().Changes(*o.nofileBaseline)
+}
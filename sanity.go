@@ -0,0 +1,38 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import "github.com/thediveo/fdooze/filedesc"
+
+// EnvironmentReport is the capability matrix of the current environment; it
+// is a type alias of [filedesc.EnvironmentReport].
+type EnvironmentReport = filedesc.EnvironmentReport
+
+// Sanity probes the current environment for procfs availability, pidfd
+// support, sock_diag permissions, and further kernel features, and returns the
+// resulting capability matrix. Suites can then skip or degrade checks
+// deliberately instead of failing mysteriously on exotic CI runners:
+//
+//	if !Sanity().Available(filedesc.CapabilityPidfd) {
+//	    Skip("needs pidfd_getfd(2)")
+//	}
+//
+// Run “go run github.com/thediveo/fdooze/cmd/fdooze sanity” in order to print
+// the capability matrix of a particular environment.
+func Sanity() EnvironmentReport {
+	return filedesc.ProbeEnvironment()
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// DescendantFiledescriptorsFor returns the open file descriptors of the
+// descendants of the process specified by session, that is, the processes
+// exec'd by the session's process, their children, and so on, indexed by
+// PID. Descendants that terminate during discovery are skipped.
+func DescendantFiledescriptorsFor(session *gexec.Session) (map[int][]filedesc.FileDescriptor, error) {
+	pid, err := sessionPid(session)
+	if err != nil {
+		return nil, err
+	}
+	descendants, err := filedesc.ProcessDescendants(pid)
+	if err != nil {
+		return nil, err
+	}
+	fds := make(map[int][]filedesc.FileDescriptor, len(descendants))
+	for _, descendant := range descendants {
+		descendantFds, err := filedesc.ProcessFiledescriptors(descendant)
+		if err != nil {
+			continue // descendant might have terminated in the meantime.
+		}
+		fds[descendant] = descendantFds
+	}
+	return fds, nil
+}
+
+// HaveDescendantsInheritingOnly succeeds if all descendants of the actual
+// gexec.Session's process hold no file descriptors other than stdio and the
+// declared fds matched by any of the specified filter matchers. This catches
+// fds missing their close-on-exec flag in supervised processes that exec
+// further children, which otherwise go unnoticed two levels down:
+//
+//	session, _ := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+//	Eventually(session).Should(HaveDescendantsInheritingOnly(
+//	    fdooze.Fd().WithPath("/run/my-service/control.sock").Build()))
+//
+// Please note that descendants might legitimately open fds themselves after
+// having been exec'd, so the check should happen at a checkpoint where the
+// descendants are known to be idle. See also [fdooze.BeFdHygienic].
+func HaveDescendantsInheritingOnly(declared ...types.GomegaMatcher) types.GomegaMatcher {
+	return &haveDescendantsInheritingOnlyMatcher{
+		declared: append([]types.GomegaMatcher{fdooze.IgnoringStdio()}, declared...),
+	}
+}
+
+type haveDescendantsInheritingOnlyMatcher struct {
+	declared    []types.GomegaMatcher
+	pid         int
+	descendants int
+	undeclared  map[int][]filedesc.FileDescriptor // undeclared fds by descendant PID
+	pids        []int                             // PIDs with undeclared fds, in discovery order
+}
+
+func (matcher *haveDescendantsInheritingOnlyMatcher) Match(actual interface{}) (success bool, err error) {
+	session, ok := actual.(*gexec.Session)
+	if !ok {
+		return false, fmt.Errorf(
+			"HaveDescendantsInheritingOnly matcher expects a *gexec.Session.  Got:\n%s",
+			format.Object(actual, 1))
+	}
+	matcher.pid, err = sessionPid(session)
+	if err != nil {
+		return false, err
+	}
+	descendants, err := filedesc.ProcessDescendants(matcher.pid)
+	if err != nil {
+		return false, err
+	}
+	matcher.descendants = len(descendants)
+	matcher.undeclared = map[int][]filedesc.FileDescriptor{}
+	matcher.pids = nil
+	for _, descendant := range descendants {
+		fds, err := filedesc.ProcessFiledescriptors(descendant)
+		if err != nil {
+			continue // descendant might have terminated in the meantime.
+		}
+		undeclared, err := fdooze.Without(fds, matcher.declared...)
+		if err != nil {
+			return false, err
+		}
+		if len(undeclared) > 0 {
+			matcher.undeclared[descendant] = undeclared
+			matcher.pids = append(matcher.pids, descendant)
+		}
+	}
+	return len(matcher.pids) == 0, nil
+}
+
+// FailureMessage returns a failure message listing the undeclared fds per
+// descendant.
+func (matcher *haveDescendantsInheritingOnlyMatcher) FailureMessage(actual interface{}) (message string) {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf(
+		"Expected descendants of PID %d to inherit only stdio and declared file descriptors, but found",
+		matcher.pid))
+	for _, pid := range matcher.pids {
+		fds := matcher.undeclared[pid]
+		out.WriteString(fmt.Sprintf("\n%sPID %d", filedesc.Indentation(1), pid))
+		if argv, err := filedesc.ProcessArgv(pid); err == nil && len(argv) > 0 {
+			out.WriteString(fmt.Sprintf(" (%q)", argv[0]))
+		}
+		out.WriteString(fmt.Sprintf(" with %d undeclared file descriptors:", len(fds)))
+		for _, fd := range fds {
+			out.WriteRune('\n')
+			out.WriteString(fd.Description(2))
+		}
+	}
+	return out.String()
+}
+
+// NegatedFailureMessage returns a negated failure message if all descendants
+// inherited only stdio and declared file descriptors.
+func (matcher *haveDescendantsInheritingOnlyMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf(
+		"Expected descendants of PID %d not to inherit only stdio and declared file descriptors, but all %d did",
+		matcher.pid, matcher.descendants)
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package session
+
+import (
+	"os/exec"
+	"syscall"
+
+	"github.com/onsi/gomega/gexec"
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("descendants fd inheritance", func() {
+
+	// start starts the specified shell script in its own process group as a
+	// session, killing the whole process group when the spec is done.
+	start := func(script string) *gexec.Session {
+		GinkgoHelper()
+		cmd := exec.Command("sh", "-c", script)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			Eventually(session).Should(gexec.Exit())
+		})
+		Eventually(func() ([]int, error) {
+			return filedesc.ProcessDescendants(cmd.Process.Pid)
+		}).Should(HaveLen(1))
+		return session
+	}
+
+	It("rejects invalid actual values", func() {
+		Expect(HaveDescendantsInheritingOnly().Match(42)).Error().To(HaveOccurred())
+		Expect(HaveDescendantsInheritingOnly().Match(&gexec.Session{})).Error().To(HaveOccurred())
+		Expect(DescendantFiledescriptorsFor(nil)).Error().To(HaveOccurred())
+	})
+
+	It("accepts descendants with only stdio", func() {
+		session := start("sleep 10 & wait")
+		fds, err := DescendantFiledescriptorsFor(session)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fds).To(HaveLen(1))
+		for _, descendantFds := range fds {
+			Expect(descendantFds).To(fdooze.BeFdHygienic())
+		}
+
+		m := HaveDescendantsInheritingOnly()
+		Expect(m.Match(session)).To(BeTrue())
+		Expect(m.NegatedFailureMessage(nil)).To(MatchRegexp(
+			`^Expected descendants of PID \d+ not to inherit only stdio and declared file descriptors, but all 1 did$`))
+	})
+
+	It("catches undeclared inherited fds", func() {
+		session := start("exec 3</dev/null; sleep 10 & wait")
+
+		m := HaveDescendantsInheritingOnly()
+		Expect(m.Match(session)).To(BeFalse())
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`^Expected descendants of PID \d+ to inherit only stdio and declared file descriptors, but found\n` +
+				`    PID \d+ \("sleep"\) with 1 undeclared file descriptors:\n` +
+				`        fd 3, .*\n.*"/dev/null"`))
+
+		Expect(session).To(HaveDescendantsInheritingOnly(fdooze.Fd().WithPath("/dev/null").Build()))
+		Expect(HaveDescendantsInheritingOnly(HaveField("Foo", 42)).Match(session)).Error().To(HaveOccurred())
+	})
+
+})
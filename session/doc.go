@@ -25,6 +25,33 @@ identifier free to be used by test writers as they see fit.
 	Eventually(sessionFds).ShouldNot(HaveLeakedFds(goodfds))
 	Eventually(session.Interrupt()).Should(gexec.Exit(0))
 
+In order to correctly interpret relative or chroot'ed paths of leaked fds,
+[ProcessInfoFor] returns the current working and root directories of the
+session's process. Its description can be passed as an optional annotation:
+
+	info, _ := ProcessInfoFor(session)
+	Eventually(sessionFds).ShouldNot(HaveLeakedFds(goodfds), info.Description(0))
+
+In matrix CI runs, [WithArgv] and [WithEnv] additionally include the command
+line arguments and selected environment variables of the session's process, so
+that it is clear which variant of a binary leaked; [WithRedaction] keeps
+sensitive values out of failure messages:
+
+	info, _ := ProcessInfoFor(session, WithArgv(), WithEnv("GOMAXPROCS"))
+
+When checking the test process itself for leaks while sessions are running,
+the pipes connected to a session's stdin, stdout, and stderr are expected.
+[IgnoringStdioPipesOf] returns a filter matcher ignoring these pipes:
+
+	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringStdioPipesOf(session)))
+
+When the session's process execs further children, fds missing their
+close-on-exec flag leak into these grandchildren. [HaveDescendantsInheritingOnly]
+checks that all descendants of the session's process hold only stdio and
+declared fds:
+
+	Expect(session).To(HaveDescendantsInheritingOnly(fdooze.Fd().WithPath("/dev/null").Build()))
+
 # Launched Go Processes False Positives
 
 In case the launched process is implemented in Go, fd leak tests need to be
@@ -41,6 +68,12 @@ them and for what purpose. An epoll fd might be used in an application itself
 and thus quite often be ambigous. Also, the exact fd number will depend on a Go
 application highly specific initialization process.
 
+For the test process itself, [fdooze.IgnoringGoRuntimeNetpoller] heuristically
+identifies the netpoller's epoll fd together with its non-blocking wakeup
+eventfd (or pipe with older Go runtimes) and filters them out. Leaked fds of
+the test process belonging to the netpoller are additionally tagged as such in
+failure messages. However, this doesn't work for launched processes.
+
 It is thus mandatory to take a "reference" snapshot of baseline fds only after
 the launched process has opened its first file or network socket. In case of
 network-facing services this will be when the listening transport port has
@@ -0,0 +1,89 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package session
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// InfoOption opts into including further optional information in the process
+// context information returned by [ProcessInfoFor].
+type InfoOption func(*infoOptions)
+
+type infoOptions struct {
+	argv   bool
+	env    []string
+	redact func(name, value string) string
+}
+
+// WithArgv includes the command line arguments of the session's process.
+func WithArgv() InfoOption {
+	return func(o *infoOptions) { o.argv = true }
+}
+
+// WithEnv includes the environment variables with the specified names of the
+// session's process, if set. Multiple WithEnv options add up.
+func WithEnv(names ...string) InfoOption {
+	return func(o *infoOptions) { o.env = append(o.env, names...) }
+}
+
+// WithRedaction redacts the included command line arguments and environment
+// variable values using the specified redaction function, before they land in
+// failure messages. The redaction function is passed the name of an
+// environment variable, or "argv[n]" for the nth command line argument,
+// together with the value and returns the (redacted) value.
+func WithRedaction(redact func(name, value string) string) InfoOption {
+	return func(o *infoOptions) { o.redact = redact }
+}
+
+// withOptionalInfo adds the optional information specified by the options to
+// the process context information.
+func withOptionalInfo(info *filedesc.ProcessInfo, opts []InfoOption) error {
+	o := infoOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.argv {
+		argv, err := filedesc.ProcessArgv(info.PID)
+		if err != nil {
+			return err
+		}
+		if o.redact != nil {
+			for idx, arg := range argv {
+				argv[idx] = o.redact("argv["+strconv.Itoa(idx)+"]", arg)
+			}
+		}
+		info.Argv = argv
+	}
+	if len(o.env) > 0 {
+		env, err := filedesc.ProcessEnv(info.PID, o.env...)
+		if err != nil {
+			return err
+		}
+		if o.redact != nil {
+			for idx, v := range env {
+				name, value, _ := strings.Cut(v, "=")
+				env[idx] = name + "=" + o.redact(name, value)
+			}
+		}
+		info.Env = env
+	}
+	return nil
+}
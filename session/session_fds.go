@@ -21,25 +21,88 @@ import (
 	"io/fs"
 
 	"github.com/onsi/gomega/gexec"
+	"github.com/thediveo/fdooze"
 	"github.com/thediveo/fdooze/filedesc"
 )
 
 // Filedescriptors returns the list of currently open file descriptors for the
 // process specified by session.
 func FiledescriptorsFor(session *gexec.Session) ([]filedesc.FileDescriptor, error) {
-	if session == nil || session.Command == nil {
-		return nil, errors.New("invalid session or session command")
-	}
-	if session.Command.Process == nil || session.Command.Process.Pid == -1 {
-		return nil, errors.New("invalid session without process")
+	pid, err := sessionPid(session)
+	if err != nil {
+		return nil, err
 	}
 	// We can only try now to get the file descriptors for the process belonging
 	// to the session. If that fails and the reason is that we couldn't read the
 	// process's file descriptor directory, then return a more meaningful error
 	// to the caller that the session already has terminated.
-	fds, err := filedesc.ProcessFiledescriptors(session.Command.Process.Pid)
+	fds, err := filedesc.ProcessFiledescriptors(pid)
 	if errors.Is(err, fs.ErrNotExist) {
 		return nil, errors.New("session has already ended")
 	}
 	return fds, err
 }
+
+// FiledescriptorsWithReportFor returns the list of currently open file
+// descriptors for the process specified by session, together with a report
+// about any enrichment steps skipped due to missing privileges or kernel
+// support. See also [filedesc.ProcessFiledescriptorsWithReport].
+func FiledescriptorsWithReportFor(session *gexec.Session) ([]filedesc.FileDescriptor, filedesc.CapabilitiesReport, error) {
+	pid, err := sessionPid(session)
+	if err != nil {
+		return nil, filedesc.CapabilitiesReport{}, err
+	}
+	fds, report, err := filedesc.ProcessFiledescriptorsWithReport(pid)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, filedesc.CapabilitiesReport{}, errors.New("session has already ended")
+	}
+	return fds, report, err
+}
+
+// ProcessInfoFor returns the process context information, such as the current
+// working and root directories, for the process specified by session. This
+// information helps in interpreting the (relative or chroot'ed) paths shown in
+// the descriptions of leaked file descriptors. The current working and root
+// directories are redacted using [fdooze.Redact].
+//
+// In matrix CI runs it is often unclear which variant or configuration of a
+// binary leaked. Optionally, the process's command line arguments and selected
+// environment variables can be included using [WithArgv] and [WithEnv], with
+// [WithRedaction] redacting sensitive values:
+//
+//	info, _ := ProcessInfoFor(session, WithArgv(), WithEnv("GOMAXPROCS", "DB_URL"),
+//	    WithRedaction(func(name, value string) string {
+//	        if name == "DB_URL" {
+//	            return "<redacted>"
+//	        }
+//	        return value
+//	    }))
+func ProcessInfoFor(session *gexec.Session, opts ...InfoOption) (filedesc.ProcessInfo, error) {
+	pid, err := sessionPid(session)
+	if err != nil {
+		return filedesc.ProcessInfo{}, err
+	}
+	info, err := filedesc.NewProcessInfo(pid)
+	if err == nil {
+		if fdooze.Redact != nil {
+			info.Cwd, info.Root = fdooze.Redact(info.Cwd), fdooze.Redact(info.Root)
+		}
+		err = withOptionalInfo(&info, opts)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return filedesc.ProcessInfo{}, errors.New("session has already ended")
+	}
+	return info, err
+}
+
+// sessionPid returns the PID of the process belonging to the specified
+// session, or an error if the session is invalid or without a process.
+func sessionPid(session *gexec.Session) (int, error) {
+	if session == nil || session.Command == nil {
+		return 0, errors.New("invalid session or session command")
+	}
+	if session.Command.Process == nil || session.Command.Process.Pid == -1 {
+		return 0, errors.New("invalid session without process")
+	}
+	return session.Command.Process.Pid, nil
+}
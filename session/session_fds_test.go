@@ -17,13 +17,16 @@
 package session
 
 import (
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/onsi/gomega"
-	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 	"github.com/thediveo/fdooze"
 	"github.com/thediveo/fdooze/filedesc"
+	"github.com/thediveo/fdooze/fixtures"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -49,11 +52,16 @@ var _ = Describe("session fd leak detection", func() {
 		It("rejects nil sessions and commands", func() {
 			Expect(FiledescriptorsFor(nil)).Error().To(HaveOccurred())
 			Expect(FiledescriptorsFor(&gexec.Session{})).Error().To(HaveOccurred())
+			Expect(ProcessInfoFor(nil)).Error().To(HaveOccurred())
+			Expect(ProcessInfoFor(&gexec.Session{})).Error().To(HaveOccurred())
+			_, _, err := FiledescriptorsWithReportFor(nil)
+			Expect(err).To(HaveOccurred())
 		})
 
 		It("rejects session without a process", func() {
 			session := &gexec.Session{Command: exec.Command("foobar")}
 			Expect(FiledescriptorsFor(session)).Error().To(HaveOccurred())
+			Expect(ProcessInfoFor(session)).Error().To(HaveOccurred())
 		})
 
 		It("returns an error when the session already has terminated", func() {
@@ -62,45 +70,104 @@ var _ = Describe("session fd leak detection", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(session).Should(gexec.Exit())
 			Expect(FiledescriptorsFor(session)).Error().To(MatchError("session has already ended"))
+			Expect(ProcessInfoFor(session)).Error().To(MatchError("session has already ended"))
+			_, _, err = FiledescriptorsWithReportFor(session)
+			Expect(err).To(MatchError("session has already ended"))
 		})
 
 	})
 
-	It("finds leaks without false positives", func() {
-		leakyPath, err := gexec.Build("./test/leaky")
+	It("optionally includes argv and environment variables", func() {
+		cmd := exec.Command("sleep", "60")
+		cmd.Env = []string{"FDOOZE_VARIANT=foo", "FDOOZE_SECRET=bar"}
+		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 		Expect(err).NotTo(HaveOccurred())
+		defer func() { session.Kill().Wait() }()
+
+		// wait for the forked child to have exec'ed sleep.
+		Eventually(func() ([]string, error) {
+			return filedesc.ProcessArgv(session.Command.Process.Pid)
+		}).Should(ContainElement("60"))
 
-		cmd := exec.Command(leakyPath)
-		in, err := cmd.StdinPipe()
+		info, err := ProcessInfoFor(session)
 		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Argv).To(BeNil())
+		Expect(info.Env).To(BeNil())
+
+		info, err = ProcessInfoFor(session,
+			WithArgv(),
+			WithEnv("FDOOZE_VARIANT", "FDOOZE_SECRET", "FDOOZE_MISSING"),
+			WithRedaction(func(name, value string) string {
+				if name == "FDOOZE_SECRET" || name == "argv[1]" {
+					return "<redacted>"
+				}
+				return value
+			}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Argv).To(HaveExactElements(HaveSuffix("sleep"), "<redacted>"))
+		Expect(info.Env).To(HaveExactElements("FDOOZE_VARIANT=foo", "FDOOZE_SECRET=<redacted>"))
+		Expect(info.Description(0)).To(ContainSubstring(`env: FDOOZE_VARIANT="foo"`))
+	})
+
+	It("redacts the working and root directories", Serial, func() {
+		DeferCleanup(func() { fdooze.Redact = nil })
+		fdooze.Redact = func(value string) string { return strings.ReplaceAll(value, "secret", "<redacted>") }
+
+		cmd := exec.Command("sleep", "60")
+		cmd.Dir = filepath.Join(GinkgoT().TempDir(), "secret-tenant")
+		Expect(os.Mkdir(cmd.Dir, 0o700)).To(Succeed())
 		session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
 		Expect(err).NotTo(HaveOccurred())
-		defer session.Terminate()
+		defer func() { session.Kill().Wait() }()
+
+		info, err := ProcessInfoFor(session)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Cwd).To(HaveSuffix("/<redacted>-tenant"))
+		Expect(info.Description(0)).NotTo(ContainSubstring("secret"))
+	})
+
+	It("finds leaks without false positives", func() {
+		leakyPath, err := fixtures.Build()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(gexec.CleanupBuildArtifacts)
+
+		fixture, err := fixtures.Start(leakyPath, fixtures.Spec{Files: 1, FilePath: "session_fds_test.go"},
+			GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		defer fixture.Stop()
+		session := fixture.Session
 
 		sessionFds := func() ([]filedesc.FileDescriptor, error) {
 			return FiledescriptorsFor(session)
 		}
 
 		By("getting initial reference")
-		Eventually(session.Out).Should(gbytes.Say("READY"))
 
 		goodfds, err := sessionFds()
 		Expect(err).NotTo(HaveOccurred())
 		Expect(goodfds[0]).NotTo(Equal(fdooze.Filedescriptors()[0]), "malfunction: got fds of myself")
 
+		info, err := ProcessInfoFor(session)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.PID).To(Equal(session.Command.Process.Pid))
+		Expect(info.Root).To(Equal("/"))
+
+		reportfds, report, err := FiledescriptorsWithReportFor(session)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.FullFidelity()).To(BeTrue())
+		Expect(reportfds).To(HaveLen(len(goodfds)))
+
 		By("triggering a leak")
-		_, _ = in.Write([]byte("\n"))
-		Eventually(session.Out).Should(gbytes.Say("LEAK"))
-		Eventually(sessionFds).Should(ContainElement(HaveFdWithPath(HaveSuffix("test/leaky/main.go"))))
+		Expect(fixture.Leak()).To(Succeed())
+		Eventually(sessionFds).Should(ContainElement(HaveFdWithPath(HaveSuffix("/session_fds_test.go"))))
 		Eventually(sessionFds).Should(fdooze.HaveLeakedFds(goodfds), "should have leaked")
 
 		By("plumbing the leak")
-		_, _ = in.Write([]byte("\n"))
-		Eventually(session.Out).Should(gbytes.Say("PLUMBED"))
-		Eventually(sessionFds).ShouldNot(ContainElement(HaveFdWithPath(HaveSuffix("test/leaky/main.go"))))
+		Expect(fixture.Plumb()).To(Succeed())
+		Eventually(sessionFds).ShouldNot(ContainElement(HaveFdWithPath(HaveSuffix("/session_fds_test.go"))))
 		Eventually(sessionFds).ShouldNot(fdooze.HaveLeakedFds(goodfds), "leak should be gone")
 
-		_, _ = in.Write([]byte("\n"))
+		fixture.Stop()
 		Eventually(session).Should(gexec.Exit())
 	})
 
@@ -0,0 +1,76 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package session
+
+import (
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// StdioPipesFor returns those file descriptors of the calling (test) process
+// that are pipes connected to the stdin, stdout, or stderr of the process
+// specified by session. These pipes usually have been created by gexec (or
+// rather, os/exec) when starting the session and thus are expected, instead of
+// being leaks.
+func StdioPipesFor(session *gexec.Session) ([]filedesc.FileDescriptor, error) {
+	pid, err := sessionPid(session)
+	if err != nil {
+		return nil, err
+	}
+	stdioInos := map[uint64]struct{}{}
+	for fdNo := 0; fdNo <= 2; fdNo++ {
+		fd, err := filedesc.NewForPID(fdNo, pid)
+		if err != nil {
+			continue // stdio fd might be closed, so skip it.
+		}
+		if pipefd, ok := fd.(*filedesc.PipeFd); ok {
+			stdioInos[pipefd.Ino()] = struct{}{}
+		}
+	}
+	pipes := []filedesc.FileDescriptor{}
+	for _, fd := range filedesc.Filedescriptors() {
+		pipefd, ok := fd.(*filedesc.PipeFd)
+		if !ok {
+			continue
+		}
+		if _, ok := stdioInos[pipefd.Ino()]; ok {
+			pipes = append(pipes, fd)
+		}
+	}
+	return pipes, nil
+}
+
+// IgnoringStdioPipesOf returns a filter matcher for use with
+// [fdooze.HaveLeakedFds] that ignores the pipes of the calling (test) process
+// that are connected to the stdin, stdout, or stderr of the process specified
+// by session. This removes a standing source of noise when checking the test
+// process itself for fd leaks while running sessions:
+//
+//	goodfds := Filedescriptors()
+//	session, _ := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+//	defer session.Terminate()
+//	Expect(Filedescriptors()).NotTo(HaveLeakedFds(goodfds, IgnoringStdioPipesOf(session)))
+//
+// Please note that the stdio pipes are determined when calling
+// IgnoringStdioPipesOf, so the session's process must still be running by
+// then. Otherwise, the returned filter matcher doesn't ignore any fds.
+func IgnoringStdioPipesOf(session *gexec.Session) types.GomegaMatcher {
+	pipes, _ := StdioPipesFor(session)
+	return fdooze.IgnoringFiledescriptors(pipes)
+}
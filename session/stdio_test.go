@@ -0,0 +1,64 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package session
+
+import (
+	"github.com/onsi/gomega/gexec"
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+	"github.com/thediveo/fdooze/fixtures"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("session stdio pipes", func() {
+
+	It("rejects invalid sessions", func() {
+		Expect(StdioPipesFor(nil)).Error().To(HaveOccurred())
+		Expect(fdooze.Filedescriptors()).To(ContainElement(Not(IgnoringStdioPipesOf(nil))))
+	})
+
+	It("correlates the session's stdio pipes", func() {
+		leakyPath, err := fixtures.Build()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(gexec.CleanupBuildArtifacts)
+
+		goodfds := fdooze.Filedescriptors()
+
+		fixture, err := fixtures.Start(leakyPath, fixtures.Spec{}, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		defer fixture.Stop()
+		session := fixture.Session
+
+		pipes, err := StdioPipesFor(session)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pipes).To(HaveLen(3))
+		Expect(pipes).To(HaveEach(BeAssignableToTypeOf(&filedesc.PipeFd{})))
+
+		// The Go runtime might additionally hold a pidfd for the session's
+		// process, so we ignore anonymous inodes.
+		anonInodes := fdooze.Fd().OfKind("anon_inode").Build()
+		Expect(fdooze.Filedescriptors()).To(fdooze.HaveLeakedFds(goodfds, anonInodes))
+		Expect(fdooze.Filedescriptors()).NotTo(fdooze.HaveLeakedFds(goodfds,
+			anonInodes, IgnoringStdioPipesOf(session)))
+
+		fixture.Stop()
+		Eventually(session).Should(gexec.Exit())
+	})
+
+})
@@ -0,0 +1,136 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// ShardedLeakResult is the (potentially partial) result of a sharded leak
+// check, see [CheckLeaksSharded].
+type ShardedLeakResult struct {
+	Leaked      []FileDescriptor // leaked fds found in the checked fd number ranges.
+	CheckedUpTo int              // highest fd number checked, or -1 if none.
+	MaxFdNo     int              // highest fd number to be checked, or -1 if none.
+	Complete    bool             // true if all fd number ranges have been checked.
+}
+
+// CheckLeaksSharded checks the currently open file descriptors of this process
+// for leaks in comparison to the expected file descriptors, with the optional
+// filter matchers filtering out use case-specific file descriptors as with
+// [HaveLeakedFds]. However, instead of discovering and comparing all file
+// descriptors in one go, CheckLeaksSharded reads the fd table only once and
+// then works incrementally through contiguous fd number ranges of chunkSize
+// open fds each, until either all ranges have been checked or the specified
+// context is done, such as when its deadline expires. The context is also
+// checked while discovering the fds of each chunk. As the fd table is read
+// only once, fds opened after the start of the check aren't checked.
+//
+// This caters for processes with huge fd tables of 100k+ fds, where a complete
+// leak check might otherwise either time out or block a spec for many seconds.
+// In case the context is done before all chunks have been checked, the partial
+// result lists the leaks found so far and Complete is false.
+//
+// A chunkSize of less than 1 checks all file descriptors in a single chunk.
+func CheckLeaksSharded(ctx context.Context, expected []FileDescriptor, chunkSize int, ignoring ...types.GomegaMatcher) (ShardedLeakResult, error) {
+	result := ShardedLeakResult{CheckedUpTo: -1, MaxFdNo: -1}
+	fdNos, err := filedesc.FdNumbers()
+	if err != nil {
+		return result, err
+	}
+	if len(fdNos) == 0 {
+		result.Complete = true
+		return result, nil
+	}
+	result.MaxFdNo = fdNos[len(fdNos)-1]
+	if chunkSize < 1 {
+		chunkSize = len(fdNos)
+	}
+	for idx, fdRange := range fdRanges(fdNos, chunkSize) {
+		if ctx.Err() != nil {
+			return result, nil
+		}
+		from, to := fdRange[0], fdRange[1]
+		chunk := fdNos[idx*chunkSize : min((idx+1)*chunkSize, len(fdNos))]
+		fds, err := filedesc.FiledescriptorsOf(chunk, filedesc.WithContext(ctx))
+		if err != nil {
+			return result, nil // context done while discovering this chunk.
+		}
+		filters := append([]types.GomegaMatcher{
+			IgnoringFiledescriptors(fdsInRange(expected, from, to))}, ignoring...)
+		leaked, err := filterFds(fds, filters)
+		if err != nil {
+			return result, err
+		}
+		result.Leaked = append(result.Leaked, leaked...)
+		result.CheckedUpTo = to
+		if to < 0 {
+			result.CheckedUpTo = result.MaxFdNo
+		}
+	}
+	result.Complete = true
+	return result, nil
+}
+
+// fdRanges partitions the fd number space into contiguous fd number ranges of
+// chunkSize of the specified fd numbers each, starting at fd number 0. The
+// range boundaries thus match the chunks of chunkSize fd numbers. The last
+// range is open-ended, as indicated by a -1 upper bound.
+func fdRanges(fdNos []int, chunkSize int) [][2]int {
+	ranges := [][2]int{}
+	from := 0
+	for start := 0; start < len(fdNos); start += chunkSize {
+		if start+chunkSize >= len(fdNos) {
+			ranges = append(ranges, [2]int{from, -1})
+			break
+		}
+		to := fdNos[start+chunkSize-1]
+		ranges = append(ranges, [2]int{from, to})
+		from = to + 1
+	}
+	return ranges
+}
+
+// fdsInRange returns only those fds with fd numbers in the specified range,
+// where a negative upper bound means no upper bound.
+func fdsInRange(fds []FileDescriptor, from, to int) []FileDescriptor {
+	inRange := []FileDescriptor{}
+	for _, fd := range fds {
+		if fd.FdNo() >= from && (to < 0 || fd.FdNo() <= to) {
+			inRange = append(inRange, fd)
+		}
+	}
+	return inRange
+}
+
+// Description returns a pretty formatted multi-line textual description of the
+// sharded leak check result, including whether it is only a partial result.
+func (r ShardedLeakResult) Description(indentation uint) string {
+	desc := filedesc.Indentation(indentation) + fmt.Sprintf("%d leaked file descriptors", len(r.Leaked))
+	if !r.Complete {
+		desc += fmt.Sprintf(" (partial result: checked fd numbers up to %d of %d)",
+			r.CheckedUpTo, r.MaxFdNo)
+	}
+	if len(r.Leaked) > 0 {
+		desc += ":\n" + dumpFds(r.Leaked, indentation+1)
+	}
+	return desc
+}
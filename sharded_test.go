@@ -0,0 +1,108 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"context"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("sharded leak checks", func() {
+
+	It("checks in chunks", func() {
+		goodfds := Filedescriptors()
+		result, err := CheckLeaksSharded(context.Background(), goodfds, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Complete).To(BeTrue())
+		Expect(result.Leaked).To(BeEmpty())
+		Expect(result.CheckedUpTo).To(Equal(result.MaxFdNo))
+		Expect(result.Description(0)).To(Equal("0 leaked file descriptors"))
+
+		var files []*os.File
+		for range 3 {
+			f, err := os.Open("sharded_test.go")
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+			files = append(files, f)
+		}
+		result, err = CheckLeaksSharded(context.Background(), goodfds, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Complete).To(BeTrue())
+		Expect(result.Leaked).To(HaveLen(3))
+		Expect(result.Leaked).To(ContainElement(HaveField("FdNo()", int(files[2].Fd()))))
+
+		result, err = CheckLeaksSharded(context.Background(), goodfds, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Leaked).To(HaveLen(3))
+	})
+
+	It("partitions the fd number space without gaps", func() {
+		Expect(fdRanges([]int{3, 4, 10, 11, 20}, 2)).To(HaveExactElements(
+			[2]int{0, 4}, [2]int{5, 11}, [2]int{12, -1}))
+		Expect(fdRanges([]int{3, 4}, 2)).To(Equal([][2]int{{0, -1}}))
+		Expect(fdRanges([]int{7}, 5)).To(Equal([][2]int{{0, -1}}))
+		Expect(fdRanges(nil, 2)).To(BeEmpty())
+	})
+
+	It("catches fds reopened in gaps", func() {
+		// Leave a gap in the fd numbers by closing the middle of three files;
+		// the ranges derived from the remaining fds must still cover the gap,
+		// so that a different file opened under the gap's fd number leaks.
+		var files []*os.File
+		for range 3 {
+			f, err := os.Open("sharded_test.go")
+			Expect(err).NotTo(HaveOccurred())
+			defer f.Close()
+			files = append(files, f)
+		}
+		goodfds := Filedescriptors()
+		gapFdNo := int(files[1].Fd())
+		Expect(files[1].Close()).To(Succeed())
+		ranges := fdRanges([]int{int(files[0].Fd()), int(files[2].Fd())}, 1)
+		Expect(ranges[0][1]).To(BeNumerically("<", gapFdNo))
+		Expect(ranges[1][0]).To(BeNumerically("<=", gapFdNo))
+
+		f, err := os.Open("sharded.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		Expect(int(f.Fd())).To(Equal(gapFdNo))
+		result, err := CheckLeaksSharded(context.Background(), goodfds, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Complete).To(BeTrue())
+		Expect(result.Leaked).To(ConsistOf(HaveField("FdNo()", gapFdNo)))
+	})
+
+	It("returns partial results", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		result, err := CheckLeaksSharded(ctx, nil, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Complete).To(BeFalse())
+		Expect(result.CheckedUpTo).To(Equal(-1))
+		Expect(result.Description(0)).To(MatchRegexp(
+			`^0 leaked file descriptors \(partial result: checked fd numbers up to -1 of \d+\)$`))
+	})
+
+	It("reports filter errors", func() {
+		_, err := CheckLeaksSharded(context.Background(), nil, 1, HaveField("Foo", 42))
+		Expect(err).To(HaveOccurred())
+	})
+
+})
@@ -0,0 +1,89 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// SharedBaseline is a baseline of expected file descriptors that is safe for
+// concurrent use, so that multiple concurrently running specs can check for fd
+// leaks against the same suite-level baseline. Intentionally created
+// long-lived file descriptors, such as a suite-wide database connection opened
+// in a SynchronizedBeforeSuite, can be added to the baseline using
+// [SharedBaseline.Extend].
+//
+//	var baseline = NewSharedBaseline(Filedescriptors())
+//
+//	var _ = Describe("...", func() {
+//	    AfterEach(func() {
+//	        Expect(Filedescriptors()).NotTo(baseline.HaveLeakedFds())
+//	    })
+//	})
+type SharedBaseline struct {
+	mu     sync.RWMutex
+	fds    []FileDescriptor
+	limits filedesc.NofileLimits // RLIMIT_NOFILE limits at baseline time
+}
+
+// NewSharedBaseline returns a new SharedBaseline with the specified expected
+// file descriptors. It additionally snapshots the current RLIMIT_NOFILE limits
+// of this process.
+func NewSharedBaseline(fds []FileDescriptor) *SharedBaseline {
+	return &SharedBaseline{fds: slices.Clone(fds), limits: NofileLimits()}
+}
+
+// Filedescriptors returns a copy of the current list of expected file
+// descriptors.
+func (b *SharedBaseline) Filedescriptors() []FileDescriptor {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return slices.Clone(b.fds)
+}
+
+// Extend atomically adds the specified file descriptors to the baseline, see
+// [MergeBaselines]. Any already expected file descriptors of the same
+// processes and with the same fd numbers are replaced.
+func (b *SharedBaseline) Extend(fds ...FileDescriptor) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fds = MergeBaselines(b.fds, fds)
+}
+
+// NofileLimits returns the RLIMIT_NOFILE limits snapshotted together with the
+// baseline.
+func (b *SharedBaseline) NofileLimits() filedesc.NofileLimits {
+	return b.limits
+}
+
+// HaveRestoredNofileLimits returns a [HaveRestoredNofileLimits] matcher for
+// the RLIMIT_NOFILE limits snapshotted together with the baseline.
+func (b *SharedBaseline) HaveRestoredNofileLimits() types.GomegaMatcher {
+	return HaveRestoredNofileLimits(b.limits)
+}
+
+// HaveLeakedFds returns a [HaveLeakedFds] matcher for the current list of
+// expected file descriptors of this baseline, together with the optional
+// filter matchers. The matcher notes changes of the RLIMIT_NOFILE limits since
+// the limits snapshotted with the baseline, see [WithNofileLimits].
+func (b *SharedBaseline) HaveLeakedFds(ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return HaveLeakedFds(b.Filedescriptors(), ignoring...).Reporting(WithNofileLimits(b.limits))
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"sync"
+
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("shared baseline", func() {
+
+	It("extends the baseline", func() {
+		baseline := NewSharedBaseline(Filedescriptors())
+		Expect(Filedescriptors()).NotTo(baseline.HaveLeakedFds())
+
+		f, err := os.Open("shared_baseline_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		Expect(Filedescriptors()).To(baseline.HaveLeakedFds())
+
+		fd, err := filedesc.New(int(f.Fd()))
+		Expect(err).NotTo(HaveOccurred())
+		baseline.Extend(fd)
+		Expect(Filedescriptors()).NotTo(baseline.HaveLeakedFds())
+		baseline.Extend(fd)
+		Expect(baseline.Filedescriptors()).To(HaveLen(len(Filedescriptors())))
+	})
+
+	It("is safe for concurrent use", func() {
+		baseline := NewSharedBaseline(nil)
+		var wg sync.WaitGroup
+		for fdNo := 0; fdNo < 10; fdNo++ {
+			wg.Add(1)
+			go func(fdNo int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				baseline.Extend(incarnatedFd{fdNo: fdNo})
+				_ = baseline.Filedescriptors()
+			}(fdNo)
+		}
+		wg.Wait()
+		Expect(baseline.Filedescriptors()).To(HaveLen(10))
+	})
+
+})
@@ -0,0 +1,88 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"strconv"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// LoopDevices returns the currently attached loop devices, or an empty list
+// in case of errors.
+func LoopDevices() []filedesc.LoopDevice {
+	loops, _ := filedesc.LoopDevices()
+	return loops
+}
+
+// HaveLeakedLoopDevices succeeds if after filtering out the expected loop
+// devices from the list of actual loop devices the remaining list is
+// non-empty. Loop devices are expected if they have the same name and backing
+// file. As with [HaveLeakedFds], optional filter matchers can be specified:
+//
+//	goodloops := LoopDevices()
+//	...
+//	Expect(LoopDevices()).NotTo(HaveLeakedLoopDevices(goodloops))
+//
+// Please note that loop devices are a system-wide resource, so loop devices
+// attached by other processes in the meantime are reported too.
+func HaveLeakedLoopDevices(loops []filedesc.LoopDevice, ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return loopDeviceLeakCheck.HaveLeaked(loops, ignoring...)
+}
+
+var loopDeviceLeakCheck = LeakCheck[filedesc.LoopDevice]{
+	Name:     "HaveLeakedLoopDevices",
+	Noun:     "loop devices",
+	Identity: func(l filedesc.LoopDevice) string { return l.Name },
+	Equal: func(actual, expected filedesc.LoopDevice) bool {
+		return actual.BackingFile == expected.BackingFile
+	},
+	Describe: func(l filedesc.LoopDevice, indentation uint) string {
+		return redactQuoted(l.Description(indentation))
+	},
+}
+
+// Mounts returns the mounts in the mount namespace of this process, or an
+// empty list in case of errors.
+func Mounts() []filedesc.Mount {
+	mounts, _ := filedesc.Mounts()
+	return mounts
+}
+
+// HaveLeakedMounts succeeds if after filtering out the expected mounts from
+// the list of actual mounts the remaining list is non-empty. This catches
+// leaked bind mounts as well as leaked bind-mounted namespaces, which
+// frequently accompany fd leaks in container runtime test suites. Mounts are
+// expected if they have the same (unique) mount ID. As with [HaveLeakedFds],
+// optional filter matchers can be specified:
+//
+//	goodmounts := Mounts()
+//	...
+//	Expect(Mounts()).NotTo(HaveLeakedMounts(goodmounts))
+func HaveLeakedMounts(mounts []filedesc.Mount, ignoring ...types.GomegaMatcher) types.GomegaMatcher {
+	return mountLeakCheck.HaveLeaked(mounts, ignoring...)
+}
+
+var mountLeakCheck = LeakCheck[filedesc.Mount]{
+	Name:     "HaveLeakedMounts",
+	Noun:     "mounts",
+	Identity: func(m filedesc.Mount) string { return strconv.Itoa(m.ID) },
+	Describe: func(m filedesc.Mount, indentation uint) string {
+		return redactQuoted(m.Description(indentation))
+	},
+}
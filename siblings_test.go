@@ -0,0 +1,53 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("sibling matchers", func() {
+
+	It("finds leaked loop devices", func() {
+		Expect(LoopDevices()).NotTo(HaveLeakedLoopDevices(LoopDevices()))
+
+		goodloops := []filedesc.LoopDevice{{Name: "loop0", BackingFile: "/a.img"}}
+		loops := []filedesc.LoopDevice{{Name: "loop0", BackingFile: "/b.img"}, {Name: "loop1", BackingFile: "/c.img"}}
+		m := HaveLeakedLoopDevices(goodloops, HaveField("Name", "loop1"))
+		Expect(m.Match(loops)).To(BeTrue())
+		Expect(m.FailureMessage(loops)).To(MatchRegexp(
+			`^Expected to leak 1 loop devices:\n\s+loop device "/dev/loop0", backing file "/b.img"$`))
+		Expect(goodloops).NotTo(HaveLeakedLoopDevices(goodloops))
+	})
+
+	It("finds leaked mounts", func() {
+		goodmounts := Mounts()
+		Expect(goodmounts).NotTo(BeEmpty())
+		Expect(Mounts()).NotTo(HaveLeakedMounts(goodmounts))
+
+		mounts := append(goodmounts, filedesc.Mount{
+			ID: -1, MountPoint: "/run/netns/foo", Root: "net:[4026531840]", FSType: "nsfs", Source: "nsfs"})
+		m := HaveLeakedMounts(goodmounts)
+		Expect(m.Match(mounts)).To(BeTrue())
+		Expect(m.FailureMessage(mounts)).To(MatchRegexp(
+			`^Expected to leak 1 mounts:\n\s+namespace bind mount "/run/netns/foo", ID -1, `))
+	})
+
+})
@@ -0,0 +1,94 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// StablePollingInterval is the interval in which [WaitForStableFds] polls the
+// fd table of a process. WaitForStableFds never polls less often than once per
+// quiescence window.
+var StablePollingInterval = 50 * time.Millisecond
+
+// WaitForStableFds polls the fd table of the process identified by pid until
+// no file descriptors have been added or removed for the specified window
+// duration, and then returns the stable snapshot. This is useful both for
+// taking a baseline after complex process startups as well as before final
+// leak checks of busy services:
+//
+//	goodfds := Successful(WaitForStableFds(pid, 500*time.Millisecond, 10*time.Second))
+//
+// If the fd table doesn't quiesce within the specified timeout, the most recent
+// snapshot is returned together with an error. An error is also returned if the
+// process' fd table cannot be read.
+func WaitForStableFds(pid int, window, timeout time.Duration) ([]FileDescriptor, error) {
+	interval := StablePollingInterval
+	if interval <= 0 || interval > window {
+		interval = window
+	}
+	discover := func() ([]FileDescriptor, error) {
+		if pid == os.Getpid() {
+			// don't pick up our own discovery's directory fd.
+			return filedesc.Filedescriptors(), nil
+		}
+		return filedesc.ProcessFiledescriptors(pid)
+	}
+	deadline := time.Now().Add(timeout)
+	fds, err := discover()
+	if err != nil {
+		return nil, err
+	}
+	stableSince := time.Now()
+	for {
+		if time.Since(stableSince) >= window {
+			return fds, nil
+		}
+		if !time.Now().Before(deadline) {
+			return fds, fmt.Errorf("fd table of process %d didn't quiesce for %s within %s",
+				pid, window, timeout)
+		}
+		time.Sleep(interval)
+		next, err := discover()
+		if err != nil {
+			return fds, err
+		}
+		if !sameFds(fds, next) {
+			stableSince = time.Now()
+		}
+		fds = next
+	}
+}
+
+// sameFds returns true if both lists contain the same file descriptors,
+// regardless of their order.
+func sameFds(fds, others []FileDescriptor) bool {
+	if len(fds) != len(others) {
+		return false
+	}
+	present := IgnoringFiledescriptors(fds)
+	for _, fd := range others {
+		if ok, _ := present.Match(fd); !ok {
+			return false
+		}
+	}
+	return true
+}
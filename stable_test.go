@@ -0,0 +1,114 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"time"
+
+	"github.com/onsi/gomega/gexec"
+	"github.com/thediveo/fdooze/fixtures"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("waiting for stable fds", func() {
+
+	It("returns a stable snapshot", func() {
+		goodfds := Filedescriptors()
+		fds, err := WaitForStableFds(os.Getpid(), 100*time.Millisecond, 2*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fds).NotTo(BeEmpty())
+		Expect(fds).NotTo(HaveLeakedFds(goodfds))
+	})
+
+	It("waits for a churning fd table to quiesce", func() {
+		goodfds := Filedescriptors()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			files := []*os.File{}
+			defer func() {
+				for _, f := range files {
+					f.Close()
+				}
+			}()
+			for i := 0; i < 10; i++ {
+				f, err := os.Open("stable_test.go")
+				Expect(err).NotTo(HaveOccurred())
+				files = append(files, f)
+				time.Sleep(40 * time.Millisecond)
+			}
+		}()
+		start := time.Now()
+		fds, err := WaitForStableFds(os.Getpid(), 200*time.Millisecond, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(done).Should(BeClosed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 400*time.Millisecond))
+		Expect(fds).NotTo(HaveLeakedFds(goodfds))
+	})
+
+	It("times out on a busy fd table", func() {
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+		go func() {
+			defer close(stopped)
+			files := []*os.File{}
+			defer func() {
+				for _, f := range files {
+					f.Close()
+				}
+			}()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+				if f, err := os.Open("stable_test.go"); err == nil {
+					files = append(files, f)
+				}
+			}
+		}()
+		fds, err := WaitForStableFds(os.Getpid(), 200*time.Millisecond, 300*time.Millisecond)
+		Expect(err).To(MatchError(MatchRegexp(`didn't quiesce for 200ms within 300ms`)))
+		Expect(fds).NotTo(BeEmpty())
+	})
+
+	It("doesn't quiesce on a churning fixture process", func() {
+		path, err := fixtures.Build()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(gexec.CleanupBuildArtifacts)
+		fixture, err := fixtures.Start(path, fixtures.Spec{Churn: 2, ChurnSeed: 42}, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		defer fixture.Stop()
+
+		_, err = WaitForStableFds(fixture.PID(), 200*time.Millisecond, 500*time.Millisecond)
+		Expect(err).To(MatchError(MatchRegexp(`didn't quiesce`)))
+	})
+
+	It("reports inaccessible processes", func() {
+		Expect(WaitForStableFds(0, time.Millisecond, time.Second)).Error().To(HaveOccurred())
+	})
+
+})
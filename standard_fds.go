@@ -0,0 +1,67 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	"github.com/onsi/gomega/types"
+)
+
+// StandardFds returns the file descriptors every Go test process predictably
+// has open: stdin, stdout, and stderr, the Go runtime netpoller fds, as well
+// as the coverage and profiling output files (see [IgnoringProfilingFiles]).
+// In the simplest cases, StandardFds can be used instead of a live baseline of
+// expected file descriptors:
+//
+//	AfterEach(func() {
+//	    Expect(Filedescriptors()).NotTo(HaveLeakedFds(StandardFds()))
+//	})
+//
+// StandardFds primes the Go runtime netpoller before taking its snapshot, so
+// that the netpoller fds are always included, independent of whether the test
+// process has already opened any pollable file or socket. Test processes run
+// in parallel by Ginkgo additionally have their harness fds, which can be
+// ignored using [IgnoringHarness].
+func StandardFds() []FileDescriptor {
+	primeNetpoller()
+	standard := []types.GomegaMatcher{
+		IgnoringStdio(),
+		IgnoringGoRuntimeNetpoller(),
+		IgnoringProfilingFiles(),
+	}
+	return WithoutFunc(Filedescriptors(), func(fd FileDescriptor) bool {
+		for _, matcher := range standard {
+			if ok, _ := matcher.Match(fd); ok {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// primeNetpoller ensures that the Go runtime has initialized its netpoller by
+// creating a pipe, which the runtime registers with its netpoller, and then
+// closing it again.
+func primeNetpoller() {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	r.Close()
+	w.Close()
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("standard fds", func() {
+
+	It("returns stdio and the netpoller fds", func() {
+		fds := StandardFds()
+		Expect(fds).To(ContainElements(
+			HaveField("FdNo()", 0), HaveField("FdNo()", 1), HaveField("FdNo()", 2)))
+		for _, fdNo := range filedesc.GoRuntimeNetpollerFds() {
+			Expect(fds).To(ContainElement(HaveField("FdNo()", fdNo)))
+		}
+	})
+
+	It("doesn't include other fds", func() {
+		f := Successful(os.Open("standard_fds_test.go"))
+		defer f.Close()
+
+		Expect(StandardFds()).NotTo(ContainElement(HaveField("FdNo()", int(f.Fd()))))
+		Expect(Filedescriptors()).To(HaveLeakedFds(StandardFds()))
+	})
+
+})
@@ -0,0 +1,74 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+/*
+Package suite helps with checking for fd leaks at the Ginkgo suite level,
+catching leaks that accumulate across specs but net out within individual
+specs.
+
+Take a snapshot of the baseline fds only after the suite-wide fixtures, such as
+database connections, are up, and then verify at suite teardown that only the
+fixtures' fds remain:
+
+	var _ = SynchronizedBeforeSuite(func() []byte {
+	    ...
+	}, func(data []byte) {
+	    db = connectDB(data)
+	    suite.Snapshot()
+	})
+
+	var _ = SynchronizedAfterSuite(func() {
+	    db.Close()
+	    suite.Verify(Fd().WithPath("/var/db/sock").Build())
+	}, func() {
+	    ...
+	})
+
+Please note that fds missing in comparison to the baseline are not leaks, so
+tearing down the fixtures before calling suite.Verify is fine. However, any fds
+that the fixtures' teardown itself leaks would then also be reported.
+
+Processes started by the suite, such as services under test started using
+exec.Cmd.Start, can be registered with [Register], so that suite.Verify also
+checks them for leaked fds, attributing any leaks to the particular process:
+
+	Expect(suite.Register(cmd.Process.Pid, "my-service", "BeforeSuite")).To(Succeed())
+
+In addition, [CheckSpec] checks each individual spec for leaked fds when called
+in a top-level BeforeEach node. The check can be configured per spec or
+container using Ginkgo labels, so that the configuration is visible in the spec
+tree:
+
+	var _ = BeforeEach(func() { suite.CheckSpec() })
+
+	It("doesn't care", Label(suite.LabelCheckOff), func() { ... })
+	It("leaks a little", suite.Budget(2), func() { ... })
+
+Load-generating specs might exhaust the ephemeral port range when leaking
+client connections or cycling through them too fast, leaving them in TIME_WAIT.
+[WarnEphemeralPorts] adds a warning report entry to the current spec when the
+client sockets to any peer use at least the specified fraction of the ephemeral
+port range:
+
+	var _ = AfterEach(func() { suite.WarnEphemeralPorts(0.8) })
+
+Specs exhausting RLIMIT_NOFILE tend to hang until they time out. [Watchdog]
+instead fails the current spec immediately when this process exceeds a hard
+ceiling of open fds, returning a context that gets cancelled at the same time:
+
+	It("hammers the API", func() {
+	    client.HammerAPI(suite.Watchdog(1000, 10*time.Millisecond))
+	})
+*/
+package suite
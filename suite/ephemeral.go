@@ -0,0 +1,55 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// EphemeralPortsReportEntry is the name of the Ginkgo report entries added by
+// [WarnEphemeralPorts].
+const EphemeralPortsReportEntry = "ephemeral ports nearing exhaustion"
+
+// WarnEphemeralPorts warns when the client TCP sockets of this process to any
+// peer use at least the specified fraction of the ephemeral port range, such
+// as 0.8, during load-generating tests. The warning is added as a Ginkgo
+// report entry named [EphemeralPortsReportEntry] to the current spec without
+// failing it. Call WarnEphemeralPorts in a (top-level) AfterEach node or at
+// the end of a load-generating spec:
+//
+//	var _ = AfterEach(func() { suite.WarnEphemeralPorts(0.8) })
+//
+// Please note that the TIME_WAIT sockets of other processes in the same
+// network namespace count too, as they also eat into the ephemeral port range.
+func WarnEphemeralPorts(fraction float64) {
+	ginkgo.GinkgoHelper()
+	usage, err := filedesc.ProcessEphemeralPortUsage(os.Getpid())
+	if err != nil {
+		return // keep silent, as this is only a warning
+	}
+	peer, utilization := usage.Utilization()
+	if peer == "" || utilization < fraction {
+		return
+	}
+	ginkgo.AddReportEntry(EphemeralPortsReportEntry,
+		fmt.Sprintf("%.1f%% of ephemeral ports used for peer %q\n%s",
+			100*utilization, peer, usage.Description(1)))
+}
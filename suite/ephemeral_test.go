@@ -0,0 +1,43 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ephemeral port warnings", func() {
+
+	It("warns about ephemeral ports nearing exhaustion", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer l.Close()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		WarnEphemeralPorts(1.1)
+		Expect(CurrentSpecReport().ReportEntries).To(BeEmpty())
+		WarnEphemeralPorts(0)
+		Expect(CurrentSpecReport().ReportEntries).To(ConsistOf(
+			HaveField("Name", EphemeralPortsReportEntry)))
+	})
+
+})
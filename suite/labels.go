@@ -0,0 +1,109 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+)
+
+// LabelCheckOff is the Ginkgo label disabling the per-spec fd leak check of
+// [CheckSpec] for a spec or all specs of a container.
+const LabelCheckOff = "fdcheck:off"
+
+// LabelBudgetPrefix is the prefix of Ginkgo labels specifying the number of
+// leaked file descriptors tolerated by the per-spec fd leak check of
+// [CheckSpec], such as "fdbudget:10".
+const LabelBudgetPrefix = "fdbudget:"
+
+// NofileLimitsReportEntry is the name of the Ginkgo report entries added by
+// [CheckSpec] when a spec changed the RLIMIT_NOFILE limits.
+const NofileLimitsReportEntry = "RLIMIT_NOFILE changed"
+
+// Budget returns the Ginkgo label specifying the number of leaked file
+// descriptors tolerated by the per-spec fd leak check of [CheckSpec].
+//
+//	It("leaks a little", Budget(2), func() { ... })
+func Budget(leaks int) ginkgo.Labels {
+	return ginkgo.Label(LabelBudgetPrefix + strconv.Itoa(leaks))
+}
+
+// CheckSpec takes a snapshot of the currently open file descriptors and
+// defers checking for leaked file descriptors until after the current spec,
+// with the optional filter matchers filtering out use case-specific file
+// descriptors. Call CheckSpec in a (top-level) BeforeEach node:
+//
+//	var _ = BeforeEach(func() { suite.CheckSpec() })
+//
+// CheckSpec honors the Ginkgo labels of the current spec and its containers,
+// so that the check configuration is visible in the spec tree: the label
+// [LabelCheckOff] disables the check, while a label with the
+// [LabelBudgetPrefix], such as "fdbudget:10", tolerates up to the specified
+// number of leaked fds.
+//
+// CheckSpec additionally flags changes of the RLIMIT_NOFILE limits during the
+// spec by adding a report entry named [NofileLimitsReportEntry] detailing the
+// changes, without failing the spec.
+func CheckSpec(ignoring ...types.GomegaMatcher) {
+	ginkgo.GinkgoHelper()
+	off, budget, err := specConfig(ginkgo.CurrentSpecReport().Labels())
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	if off {
+		return
+	}
+	goodfds := fdooze.Filedescriptors()
+	goodlimits := fdooze.NofileLimits()
+	ginkgo.DeferCleanup(func() {
+		if changes := fdooze.NofileLimits().Changes(goodlimits); changes != "" {
+			ginkgo.AddReportEntry(NofileLimitsReportEntry, "RLIMIT_NOFILE "+changes)
+		}
+		if budget == 0 {
+			gomega.Eventually(fdooze.Filedescriptors).ShouldNot(
+				fdooze.HaveLeakedFds(goodfds, ignoring...))
+			return
+		}
+		gomega.Eventually(func() ([]fdooze.LeakedFd, error) {
+			report, err := fdooze.NewLeakReport(fdooze.Filedescriptors(), goodfds, ignoring...)
+			return report.Leaks, err
+		}).Should(gomega.WithTransform(func(leaks []fdooze.LeakedFd) int { return len(leaks) },
+			gomega.BeNumerically("<=", budget)),
+			"leaked fds exceeding the budget of %d", budget)
+	})
+}
+
+// specConfig returns the per-spec check configuration from the specified
+// Ginkgo labels: whether the check is off and the tolerated number of leaks.
+func specConfig(labels []string) (off bool, budget int, err error) {
+	for _, label := range labels {
+		switch {
+		case label == LabelCheckOff:
+			off = true
+		case strings.HasPrefix(label, LabelBudgetPrefix):
+			budget, err = strconv.Atoi(label[len(LabelBudgetPrefix):])
+			if err != nil || budget < 0 {
+				return false, 0, fmt.Errorf("invalid fd budget label %q", label)
+			}
+		}
+	}
+	return off, budget, nil
+}
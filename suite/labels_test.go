@@ -0,0 +1,94 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"os"
+
+	"github.com/onsi/ginkgo/v2/types"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("label-driven per-spec checks", func() {
+
+	It("parses labels", func() {
+		off, budget, err := specConfig(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(off).To(BeFalse())
+		Expect(budget).To(BeZero())
+
+		off, budget, err = specConfig([]string{"foo", LabelCheckOff, "fdbudget:42"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(off).To(BeTrue())
+		Expect(budget).To(Equal(42))
+
+		_, _, err = specConfig([]string{"fdbudget:foo"})
+		Expect(err).To(MatchError(`invalid fd budget label "fdbudget:foo"`))
+		_, _, err = specConfig([]string{"fdbudget:-1"})
+		Expect(err).To(HaveOccurred())
+
+		Expect(Budget(10)).To(ConsistOf("fdbudget:10"))
+	})
+
+	Context("checking specs", Ordered, func() {
+
+		var leaked []*os.File
+
+		BeforeEach(func() { CheckSpec() })
+
+		AfterAll(func() {
+			for _, f := range leaked {
+				f.Close()
+			}
+		})
+
+		leak := func() {
+			f, err := os.Open("labels.go")
+			Expect(err).NotTo(HaveOccurred())
+			leaked = append(leaked, f)
+		}
+
+		It("passes without leaks", func() {})
+
+		It("is switched off", Label(LabelCheckOff), func() { leak() })
+
+		It("tolerates leaks within budget", Budget(2), func() { leak(); leak() })
+
+		var rlimit unix.Rlimit
+		var entries []types.ReportEntry
+		ReportAfterEach(func(report SpecReport) { entries = report.ReportEntries })
+
+		It("flags changed RLIMIT_NOFILE limits", func() {
+			Expect(unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit)).To(Succeed())
+			lowered := rlimit
+			lowered.Cur--
+			Expect(unix.Setrlimit(unix.RLIMIT_NOFILE, &lowered)).To(Succeed())
+		})
+
+		It("has flagged the changed limits", func() {
+			Expect(unix.Setrlimit(unix.RLIMIT_NOFILE, &rlimit)).To(Succeed())
+			Expect(entries).To(ConsistOf(And(
+				HaveField("Name", NofileLimitsReportEntry),
+				HaveField("Value.String()", MatchRegexp(`^RLIMIT_NOFILE soft limit changed from \d+ to \d+ \(-1\)$`)))))
+		})
+
+	})
+
+})
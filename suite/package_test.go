@@ -0,0 +1,44 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var fixture *os.File
+
+var _ = BeforeSuite(func() {
+	var err error
+	fixture, err = os.Open("doc.go")
+	Expect(err).NotTo(HaveOccurred())
+	Snapshot()
+})
+
+var _ = AfterSuite(func() {
+	Verify()
+	fixture.Close()
+})
+
+func TestSuitePackage(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "suite package")
+}
@@ -0,0 +1,121 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// SupervisedProcess is a process started by the suite and registered using
+// [Register], so that it gets included in the suite-level leak check of
+// [Verify].
+type SupervisedProcess struct {
+	PID       int    // PID of the process.
+	Name      string // name of the process, for attributing leaks.
+	Phase     string // phase of the suite the process was started in, such as "BeforeSuite".
+	StartTime uint64 // start time of the process incarnation, in clock ticks after system boot.
+
+	baseline []fdooze.FileDescriptor
+}
+
+// processes lists the supervised processes, guarded by mu.
+var processes []*SupervisedProcess
+
+// Register registers the process identified by pid as a supervised process
+// with the specified name and phase for attributed reporting, taking a
+// snapshot of its currently open file descriptors as the process's baseline.
+// [Verify] then checks all still-running supervised processes for leaked fds,
+// in addition to the suite process itself. Registering a PID again replaces
+// its previous registration.
+//
+//	cmd := exec.Command("my-service")
+//	Expect(cmd.Start()).To(Succeed())
+//	Expect(suite.Register(cmd.Process.Pid, "my-service", "BeforeSuite")).To(Succeed())
+func Register(pid int, name, phase string) error {
+	start, err := filedesc.ProcessStartTime(pid)
+	if err != nil {
+		return err
+	}
+	fds, err := filedesc.ProcessFiledescriptors(pid)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	unregister(pid)
+	processes = append(processes, &SupervisedProcess{
+		PID:       pid,
+		Name:      name,
+		Phase:     phase,
+		StartTime: start,
+		baseline:  fds,
+	})
+	return nil
+}
+
+// Unregister removes the supervised process identified by pid, if registered.
+func Unregister(pid int) {
+	mu.Lock()
+	defer mu.Unlock()
+	unregister(pid)
+}
+
+// unregister removes the supervised process identified by pid; the caller
+// must hold mu.
+func unregister(pid int) {
+	for idx, proc := range processes {
+		if proc.PID == pid {
+			processes = append(processes[:idx], processes[idx+1:]...)
+			return
+		}
+	}
+}
+
+// Processes returns the currently registered supervised processes.
+func Processes() []SupervisedProcess {
+	mu.Lock()
+	defer mu.Unlock()
+	procs := make([]SupervisedProcess, 0, len(processes))
+	for _, proc := range processes {
+		procs = append(procs, *proc)
+	}
+	return procs
+}
+
+// verifyProcesses checks all still-running supervised processes for leaked
+// fds in comparison to their baselines. Processes that have terminated in the
+// meantime cannot leak fds anymore and thus are skipped; this includes
+// processes whose PID has been reused by a different process incarnation.
+func verifyProcesses(ignoring ...types.GomegaMatcher) {
+	ginkgo.GinkgoHelper()
+	for _, proc := range Processes() {
+		proc := proc
+		gomega.Eventually(func() []fdooze.FileDescriptor {
+			if start, err := filedesc.ProcessStartTime(proc.PID); err != nil || start != proc.StartTime {
+				return nil
+			}
+			fds, _ := filedesc.ProcessFiledescriptors(proc.PID)
+			return fds
+		}).ShouldNot(fdooze.HaveLeakedFds(proc.baseline, ignoring...),
+			"leaked fds in supervised process %q (PID %d, started in %s)",
+			proc.Name, proc.PID, proc.Phase)
+	}
+}
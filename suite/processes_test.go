@@ -0,0 +1,86 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/onsi/gomega/gexec"
+	"github.com/thediveo/fdooze"
+	"github.com/thediveo/fdooze/filedesc"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("supervised processes", func() {
+
+	// start starts a shell with the specified script, waiting for the shell to
+	// be up and running (or having already exec'ed sleep), and registers it as
+	// a supervised process.
+	start := func(script string) *gexec.Session {
+		GinkgoHelper()
+		session, err := gexec.Start(exec.Command("/bin/sh", "-c", script), GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() { session.Kill().Wait() })
+		pid := session.Command.Process.Pid
+		Eventually(func() string {
+			comm, _ := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+			return strings.TrimSpace(string(comm))
+		}).Should(BeElementOf("sh", "sleep"))
+		Expect(Register(pid, "leaky", "It")).To(Succeed())
+		DeferCleanup(func() { Unregister(pid) })
+		return session
+	}
+
+	It("registers and unregisters processes", func() {
+		session := start("exec sleep 30")
+		pid := session.Command.Process.Pid
+		Expect(Processes()).To(ContainElement(And(
+			HaveField("PID", pid),
+			HaveField("Name", "leaky"),
+			HaveField("Phase", "It"),
+			HaveField("StartTime", Not(BeZero())))))
+		Expect(Register(pid, "leaky", "again")).To(Succeed())
+		Expect(Processes()).To(ConsistOf(HaveField("Phase", "again")))
+		Unregister(pid)
+		Expect(Processes()).To(BeEmpty())
+
+		Expect(Register(-1, "nope", "It")).NotTo(Succeed())
+	})
+
+	It("detects leaks in supervised processes", func() {
+		session := start("sleep 0.5; exec 5</dev/null; exec sleep 30")
+		Eventually(func() []fdooze.FileDescriptor {
+			fds, _ := filedesc.ProcessFiledescriptors(session.Command.Process.Pid)
+			return fds
+		}).Should(ContainElement(HaveField("FdNo()", 5)))
+		Expect(InterceptGomegaFailure(func() { verifyProcesses() })).To(MatchError(
+			MatchRegexp(`leaked fds in supervised process "leaky" \(PID %d, started in It\)`,
+				session.Command.Process.Pid)))
+	})
+
+	It("skips terminated processes", func() {
+		session := start("sleep 0.5; exec 5</dev/null; exec sleep 30")
+		session.Kill().Wait()
+		Expect(InterceptGomegaFailure(func() { verifyProcesses() })).To(Succeed())
+	})
+
+})
@@ -0,0 +1,73 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"sync"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze"
+)
+
+var (
+	mu       sync.Mutex
+	baseline *fdooze.SharedBaseline
+)
+
+// Snapshot takes a snapshot of the currently open file descriptors as the
+// suite-level baseline. Call Snapshot only after the suite-wide fixtures have
+// been set up, such as at the end of a BeforeSuite node or of the second
+// (all-processes) function of a SynchronizedBeforeSuite node.
+func Snapshot() {
+	mu.Lock()
+	defer mu.Unlock()
+	baseline = fdooze.NewSharedBaseline(fdooze.Filedescriptors())
+}
+
+// Baseline returns the suite-level baseline taken by [Snapshot], or nil if no
+// snapshot has been taken yet. Specs might extend the baseline with
+// intentionally created long-lived file descriptors.
+func Baseline() *fdooze.SharedBaseline {
+	mu.Lock()
+	defer mu.Unlock()
+	return baseline
+}
+
+// Verify checks that, in comparison to the suite-level baseline taken by
+// [Snapshot], no file descriptors have been leaked, with the optional filter
+// matchers filtering out use case-specific file descriptors; see also
+// [fdooze.HaveLeakedFds]. In order to give fds in the process of being closed
+// a chance, Verify eventually checks using Gomega's default Eventually timeout
+// and polling interval. Call Verify in an AfterSuite node or the first
+// (all-processes) function of a SynchronizedAfterSuite node.
+//
+// Verify additionally checks all still-running supervised processes registered
+// using [Register] for fds leaked in comparison to their own baselines,
+// attributing any leaks to the particular process.
+//
+// Verify fails the suite if no baseline snapshot has been taken.
+func Verify(ignoring ...types.GomegaMatcher) {
+	ginkgo.GinkgoHelper()
+	b := Baseline()
+	gomega.Expect(b).NotTo(gomega.BeNil(),
+		"suite.Verify: no baseline snapshot taken; call suite.Snapshot first")
+	gomega.Eventually(fdooze.Filedescriptors).ShouldNot(b.HaveLeakedFds(ignoring...),
+		"leaked fds accumulated across specs")
+	verifyProcesses(ignoring...)
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"os"
+
+	"github.com/thediveo/fdooze"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("suite-level fd leak checks", func() {
+
+	It("has taken a baseline including the fixtures", func() {
+		Expect(Baseline()).NotTo(BeNil())
+		Expect(Baseline().Filedescriptors()).To(ContainElement(
+			HaveField("FdNo()", int(fixture.Fd()))))
+	})
+
+	It("detects leaks accumulated across specs", func() {
+		f, err := os.Open("suite.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		Expect(InterceptGomegaFailure(func() { Verify() })).To(MatchError(
+			ContainSubstring("leaked fds accumulated across specs")))
+		Expect(fdooze.Filedescriptors()).To(Baseline().HaveLeakedFds())
+	})
+
+	It("fails without a baseline", func() {
+		defer func(b *fdooze.SharedBaseline) { baseline = b }(Baseline())
+		baseline = nil
+		Expect(InterceptGomegaFailure(func() { Verify() })).To(MatchError(
+			ContainSubstring("no baseline snapshot taken")))
+	})
+
+})
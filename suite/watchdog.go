@@ -0,0 +1,57 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/thediveo/fdooze"
+)
+
+// Watchdog starts an [fdooze.Watchdog] for the current spec that fails the
+// spec immediately when this process exceeds the specified hard ceiling of
+// open file descriptors, polling the fd count in the specified interval,
+// instead of waiting for the spec to time out after exhausting RLIMIT_NOFILE.
+// The watchdog is automatically stopped after the
+// spec. Watchdog returns the watchdog's context, which gets cancelled when the
+// ceiling is exceeded, so that the spec code can additionally abort early:
+//
+//	It("hammers the API", func() {
+//	    ctx := suite.Watchdog(1000, 10*time.Millisecond)
+//	    client.HammerAPI(ctx)
+//	})
+//
+// Please note that Ginkgo cannot interrupt a spec's code itself, so spec code
+// ignoring the returned context keeps running until it returns on its own.
+func Watchdog(ceiling int, interval time.Duration) context.Context {
+	return watchdog(ceiling, interval, func(err *fdooze.FdCeilingError) {
+		defer ginkgo.GinkgoRecover()
+		ginkgo.Fail(err.Error())
+	})
+}
+
+// watchdog starts a watchdog for the current spec polling in the specified
+// interval, calling the specified function when this process exceeds the
+// specified ceiling.
+func watchdog(ceiling int, interval time.Duration, onExceeded func(err *fdooze.FdCeilingError)) context.Context {
+	wd := fdooze.StartWatchdog(context.Background(), os.Getpid(), ceiling, interval, onExceeded)
+	ginkgo.DeferCleanup(func() { _ = wd.Stop() })
+	return wd.Context()
+}
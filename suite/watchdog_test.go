@@ -0,0 +1,46 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package suite
+
+import (
+	"context"
+	"time"
+
+	"github.com/thediveo/fdooze"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("spec fd watchdog", func() {
+
+	const interval = 10 * time.Millisecond
+
+	It("doesn't fail a well-behaved spec", func() {
+		ctx := Watchdog(100000, interval)
+		Consistently(ctx.Done()).WithTimeout(5 * interval).ShouldNot(BeClosed())
+	})
+
+	It("reports exceeding the ceiling", func() {
+		exceeded := make(chan *fdooze.FdCeilingError, 1)
+		ctx := watchdog(0, interval, func(err *fdooze.FdCeilingError) { exceeded <- err })
+		Eventually(ctx.Done()).Within(time.Second).Should(BeClosed())
+		Expect(exceeded).To(Receive(HaveField("Ceiling", 0)))
+		Expect(context.Cause(ctx)).To(HaveOccurred())
+	})
+
+})
@@ -0,0 +1,147 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// FdTransfer is the outcome of passing fds via SCM_RIGHTS to a (supervised)
+// process, as determined by [DiffTransfer].
+type FdTransfer struct {
+	Received   []FileDescriptor // new fds of the receiving process sharing their open file descriptions with sent fds.
+	Missing    []FileDescriptor // sent fds without a matching new fd in the receiving process.
+	Unexpected []FileDescriptor // new fds of the receiving process not matching any sent fd.
+}
+
+// Exact returns true if all sent fds have been received and the receiving
+// process didn't gain any other fds.
+func (t FdTransfer) Exact() bool {
+	return len(t.Missing) == 0 && len(t.Unexpected) == 0
+}
+
+// DiffTransfer diffs the fd tables of a process before and after passing the
+// specified sent fds to it over a unix socket using SCM_RIGHTS, matching the
+// new fds of the receiving process against the sent fds. As the receiving fds
+// share their open file descriptions with the sent fds, they are matched using
+// [filedesc.SameFileDescription] instead of just their fd properties. Sending
+// the same fd multiple times requires as many receiving fds.
+//
+// Matching requires the calling process to have ptrace read access to both the
+// sending and receiving processes, otherwise an error is returned.
+func DiffTransfer(before, after, sent []FileDescriptor) (FdTransfer, error) {
+	newfds, err := filterFds(after, []types.GomegaMatcher{IgnoringFiledescriptors(before)})
+	if err != nil {
+		return FdTransfer{}, err
+	}
+	transfer := FdTransfer{}
+	matched := make([]bool, len(newfds))
+	for _, sentfd := range sent {
+		sentPid := pidOf(sentfd)
+		if sentPid == 0 {
+			return FdTransfer{}, fmt.Errorf("DiffTransfer: sent fd %d without owning process", sentfd.FdNo())
+		}
+		found := false
+		for idx, newfd := range newfds {
+			if matched[idx] {
+				continue
+			}
+			same, err := filedesc.SameFileDescription(sentPid, sentfd.FdNo(), pidOf(newfd), newfd.FdNo())
+			if err != nil {
+				return FdTransfer{}, fmt.Errorf("DiffTransfer: cannot compare sent fd %d with fd %d of PID %d: %w",
+					sentfd.FdNo(), newfd.FdNo(), pidOf(newfd), err)
+			}
+			if same {
+				matched[idx] = true
+				transfer.Received = append(transfer.Received, newfd)
+				found = true
+				break
+			}
+		}
+		if !found {
+			transfer.Missing = append(transfer.Missing, sentfd)
+		}
+	}
+	for idx, newfd := range newfds {
+		if !matched[idx] {
+			transfer.Unexpected = append(transfer.Unexpected, newfd)
+		}
+	}
+	return transfer, nil
+}
+
+// HaveReceivedExactly succeeds if the actual fds of a process, compared with
+// the fds of the same process before an SCM_RIGHTS transfer, gained exactly
+// fds sharing their open file descriptions with the sent fds, and nothing
+// else; see [DiffTransfer]. This supports testing fd-passing protocols, such
+// as systemd's socket activation or container runtimes handing over console
+// and socket fds:
+//
+//	before := Successful(filedesc.ProcessFiledescriptors(child.Pid))
+//	sendFds(conn, listener, console)
+//	Eventually(func() ([]FileDescriptor, error) {
+//	    return filedesc.ProcessFiledescriptors(child.Pid)
+//	}).Should(HaveReceivedExactly(before, []FileDescriptor{listenerFd, consoleFd}))
+func HaveReceivedExactly(before, sent []FileDescriptor) types.GomegaMatcher {
+	return &haveReceivedExactlyMatcher{before: before, sent: sent}
+}
+
+type haveReceivedExactlyMatcher struct {
+	before   []FileDescriptor
+	sent     []FileDescriptor
+	transfer FdTransfer
+}
+
+func (matcher *haveReceivedExactlyMatcher) Match(actual interface{}) (success bool, err error) {
+	actualFds, err := toFds(actual, "HaveReceivedExactly")
+	if err != nil {
+		return false, err
+	}
+	matcher.transfer, err = DiffTransfer(matcher.before, actualFds, matcher.sent)
+	if err != nil {
+		return false, err
+	}
+	return matcher.transfer.Exact(), nil
+}
+
+// FailureMessage returns a failure message listing the missing and unexpected
+// fds.
+func (matcher *haveReceivedExactlyMatcher) FailureMessage(actual interface{}) (message string) {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("Expected to have received exactly %d sent file descriptors, but",
+		len(matcher.sent)))
+	if len(matcher.transfer.Missing) > 0 {
+		out.WriteString(fmt.Sprintf("\n%smissing %d sent file descriptors:\n%s",
+			filedesc.Indentation(1), len(matcher.transfer.Missing), dumpFds(matcher.transfer.Missing, 2)))
+	}
+	if len(matcher.transfer.Unexpected) > 0 {
+		out.WriteString(fmt.Sprintf("\n%sgot %d unexpected file descriptors:\n%s",
+			filedesc.Indentation(1), len(matcher.transfer.Unexpected), dumpFds(matcher.transfer.Unexpected, 2)))
+	}
+	return out.String()
+}
+
+// NegatedFailureMessage returns a negated failure message if exactly the sent
+// fds have been received.
+func (matcher *haveReceivedExactlyMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected not to have received exactly %d sent file descriptors:\n%s",
+		len(matcher.sent), dumpFds(matcher.transfer.Received, 1))
+}
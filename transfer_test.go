@@ -0,0 +1,125 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("fd transfers", func() {
+
+	// transfer passes the specified fds over the unix socket pair and returns
+	// the received fds.
+	transfer := func(pair [2]int, fdNos ...int) []int {
+		GinkgoHelper()
+		Expect(unix.Sendmsg(pair[0], []byte{0}, unix.UnixRights(fdNos...), nil, 0)).To(Succeed())
+		oob := make([]byte, unix.CmsgSpace(4*len(fdNos)))
+		_, oobn, _, _, err := unix.Recvmsg(pair[1], make([]byte, 1), oob, unix.MSG_CMSG_CLOEXEC)
+		Expect(err).NotTo(HaveOccurred())
+		cmsgs := Successful(unix.ParseSocketControlMessage(oob[:oobn]))
+		Expect(cmsgs).To(HaveLen(1))
+		received := Successful(unix.ParseUnixRights(&cmsgs[0]))
+		DeferCleanup(func() {
+			for _, fdNo := range received {
+				unix.Close(fdNo)
+			}
+		})
+		return received
+	}
+
+	var pair [2]int
+
+	BeforeEach(func() {
+		pair = Successful(unix.Socketpair(unix.AF_UNIX, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0))
+		DeferCleanup(func() {
+			unix.Close(pair[0])
+			unix.Close(pair[1])
+		})
+	})
+
+	It("rejects invalid actual values and sent fds", func() {
+		Expect(HaveReceivedExactly(nil, nil).Match(42)).Error().To(HaveOccurred())
+		Expect(DiffTransfer(nil, nil, []FileDescriptor{&filedesc.PipeFd{}})).Error().To(
+			MatchError(ContainSubstring("without owning process")))
+	})
+
+	It("verifies the exact transfer", func() {
+		f := Successful(os.Open("transfer_test.go"))
+		defer f.Close()
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		sent := []FileDescriptor{
+			Successful(filedesc.New(int(f.Fd()))),
+			Successful(filedesc.New(pipefds[0])),
+		}
+
+		before := Filedescriptors()
+		received := transfer(pair, int(f.Fd()), pipefds[0])
+		after := Filedescriptors()
+
+		t := Successful(DiffTransfer(before, after, sent))
+		Expect(t.Exact()).To(BeTrue())
+		Expect(t.Received).To(ConsistOf(
+			HaveField("FdNo()", received[0]), HaveField("FdNo()", received[1])))
+		Expect(after).To(HaveReceivedExactly(before, sent))
+
+		m := HaveReceivedExactly(before, sent)
+		Expect(m.Match(after)).To(BeTrue())
+		Expect(m.NegatedFailureMessage(nil)).To(MatchRegexp(
+			`^Expected not to have received exactly 2 sent file descriptors:\n`))
+	})
+
+	It("reports missing and unexpected fds", func() {
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		sent := []FileDescriptor{
+			Successful(filedesc.New(pipefds[0])),
+			Successful(filedesc.New(pipefds[1])),
+		}
+
+		before := Filedescriptors()
+		_ = transfer(pair, pipefds[0])
+		efd := Successful(unix.Eventfd(0, unix.EFD_CLOEXEC))
+		defer unix.Close(efd)
+		after := Filedescriptors()
+
+		t := Successful(DiffTransfer(before, after, sent))
+		Expect(t.Exact()).To(BeFalse())
+		Expect(t.Received).To(HaveLen(1))
+		Expect(t.Missing).To(ConsistOf(HaveField("FdNo()", pipefds[1])))
+		Expect(t.Unexpected).To(ConsistOf(HaveField("FdNo()", efd)))
+
+		m := HaveReceivedExactly(before, sent)
+		Expect(m.Match(after)).To(BeFalse())
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(
+			`^Expected to have received exactly 2 sent file descriptors, but\n` +
+				`    missing 1 sent file descriptors:\n        fd \d+, .*\n.*\n` +
+				`    got 1 unexpected file descriptors:\n        fd \d+`))
+	})
+
+})
@@ -18,12 +18,15 @@ package fdooze
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"strings"
 
 	"golang.org/x/exp/slices"
 
 	"github.com/onsi/gomega/format" // That's fine ... because this is a package used only in tests anyway
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
 )
 
 var fdsT = reflect.TypeOf([]FileDescriptor{})
@@ -49,17 +52,369 @@ func toFds(actual interface{}, matchername string) ([]FileDescriptor, error) {
 	return val.Convert(fdsT).Interface().([]FileDescriptor), nil
 }
 
+// filterFds returns those fds not matched by any of the specified filter
+// matchers, keeping the original order of fds. If a filter returns an error,
+// then filterFds returns this error.
+func filterFds(fds []FileDescriptor, filters []types.GomegaMatcher) ([]FileDescriptor, error) {
+	var unmatched []FileDescriptor
+nextFd:
+	for _, fd := range fds {
+		for _, filter := range filters {
+			matches, err := filter.Match(fd)
+			if err != nil {
+				return nil, err
+			}
+			if matches {
+				continue nextFd
+			}
+		}
+		unmatched = append(unmatched, fd)
+	}
+	return unmatched, nil
+}
+
+// kindOrder defines the order of the kinds of fds in dumps, with fds of
+// unknown kinds coming last.
+var kindOrder = []string{"path", "shm", "pipe", "socket", "anon_inode", "namespace"}
+
+// compareFds orders fds by their kind in [kindOrder] first, then by their fd
+// numbers, and finally by the PIDs of their owning processes, so that dumps
+// are fully deterministic.
+func compareFds(a, b FileDescriptor) int {
+	kindRank := func(fd FileDescriptor) int {
+		if rank := slices.Index(kindOrder, kindOf(fd)); rank >= 0 {
+			return rank
+		}
+		return len(kindOrder)
+	}
+	if rankA, rankB := kindRank(a), kindRank(b); rankA != rankB {
+		return rankA - rankB
+	}
+	if a.FdNo() != b.FdNo() {
+		return a.FdNo() - b.FdNo()
+	}
+	return pidOf(a) - pidOf(b)
+}
+
 // dumpFds returns detailed textual information about the specified (leaked)
-// fds. The fds are numerically sorted in the dump by their file descriptor
-// numbers.
+// fds. The fds are sorted in the dump by their kind first and then by their
+// file descriptor numbers, see [compareFds]; the specified fds slice is left
+// untouched.
 func dumpFds(fds []FileDescriptor, indentation uint) string {
-	slices.SortFunc(fds, func(a, b FileDescriptor) int { return a.FdNo() - b.FdNo() })
+	fds = slices.Clone(fds)
+	slices.SortFunc(fds, compareFds)
 	var out strings.Builder
 	for idx, fd := range fds {
 		if idx > 0 {
 			out.WriteRune('\n')
 		}
-		out.WriteString(fd.Description(indentation))
+		out.WriteString(describeElided(fd, indentation))
+	}
+	return out.String()
+}
+
+// Leak severities, with higher values indicating more severe leaks.
+const (
+	severityNormal = iota // leaked fd just sits there
+	severityHigh          // leaked fd will fire or wake up someone
+)
+
+// leakSeverity returns the severity of the specified leaked fd. Armed timerfds
+// and eventfds with non-zero counters are more severe leaks than other fds, as
+// they will fire or wake up someone.
+func leakSeverity(fd FileDescriptor) int {
+	if armed, ok := fd.(interface{ Armed() bool }); ok && armed.Armed() {
+		return severityHigh
+	}
+	return severityNormal
+}
+
+// dumpLeakedFds returns detailed textual information about the specified
+// leaked fds, similar to dumpFds. However, more severe leaks are dumped first,
+// and only then sorted by their kinds and fd numbers. Additionally, leaked fds sharing
+// their open file description with any of the other fds in all are annotated,
+// such as when a “leaked” fd actually is a dup of stdio. If reporting
+// [WithBaselineNeighbors], leaked fds are also annotated with their nearest
+// fds in the (optional) baseline, and if reporting [WithBlockedThreads], with
+// the threads currently blocked on them.
+func dumpLeakedFds(leaked []FileDescriptor, all []FileDescriptor, baseline []FileDescriptor, opts reportOptions, indentation uint) string {
+	leaked = slices.Clone(leaked)
+	slices.SortFunc(leaked, func(a, b FileDescriptor) int {
+		if sevA, sevB := leakSeverity(a), leakSeverity(b); sevA != sevB {
+			return sevB - sevA
+		}
+		return compareFds(a, b)
+	})
+	var out strings.Builder
+	mappings := map[int]map[filedesc.FileID]uint64{} // per PID
+	blocked := map[int][]filedesc.BlockedThread{}    // per PID
+	listeners := listeningSockets(all)
+	var netpoller []int
+	if slices.ContainsFunc(leaked, func(fd FileDescriptor) bool { return pidOf(fd) == os.Getpid() }) {
+		netpoller = filedesc.GoRuntimeNetpollerFds()
+	}
+	for idx, fd := range leaked {
+		if idx > 0 {
+			out.WriteRune('\n')
+		}
+		out.WriteString(describeElided(fd, indentation))
+		out.WriteString(mappingAnnotation(fd, mappings, indentation+1))
+		out.WriteString(backingAnnotation(fd, indentation+1))
+		out.WriteString(netpollerAnnotation(fd, netpoller, indentation+1))
+		out.WriteString(idleConnAnnotation(fd, listeners, indentation+1))
+		out.WriteString(profilingAnnotation(fd, indentation+1))
+		if opts.baselineNeighbors {
+			out.WriteString(baselineAnnotation(fd, baseline, indentation+1))
+		}
+		out.WriteString(changedAnnotation(fd, baseline, indentation+1))
+		if opts.blockedThreads {
+			out.WriteString(blockedAnnotation(fd, blocked, indentation+1))
+		}
+		sharing, err := filedesc.SharingFileDescription(fd, all)
+		if err != nil || len(sharing) == 0 {
+			continue
+		}
+		out.WriteRune('\n')
+		out.WriteString(filedesc.Indentation(indentation + 1))
+		out.WriteString("shares open file description with ")
+		for sharedIdx, shared := range sharing {
+			if sharedIdx > 0 {
+				out.WriteString(", ")
+			}
+			out.WriteString(fmt.Sprintf("fd %d", shared.FdNo()))
+			if pid, ownpid := pidOf(shared), pidOf(fd); pid != ownpid {
+				out.WriteString(fmt.Sprintf(" of PID %d", pid))
+			}
+		}
+	}
+	if changes := opts.nofileChanges(); changes != "" {
+		out.WriteRune('\n')
+		out.WriteString(filedesc.Indentation(indentation))
+		out.WriteString("RLIMIT_NOFILE " + changes)
+	}
+	return out.String()
+}
+
+// mappingAnnotation returns an annotation line for a leaked memfd or shared
+// memory fd, stating whether its memory is still mapped and thus closing the
+// fd wouldn't release the memory anyway. The mapped file sizes of the owning
+// processes are cached in mappings. If the fd isn't a memfd or shared memory
+// fd, or its owning process is unknown, an empty annotation is returned.
+func mappingAnnotation(fd FileDescriptor, mappings map[int]map[filedesc.FileID]uint64, indentation uint) string {
+	pathfd := pathFdOf(fd)
+	if pathfd == nil || !pathfd.SharedMemory() || pathfd.Ino() == 0 {
+		return ""
+	}
+	pid := pidOf(fd)
+	if pid == 0 {
+		return ""
+	}
+	sizes, ok := mappings[pid]
+	if !ok {
+		sizes, _ = filedesc.MappedSizes(pid)
+		mappings[pid] = sizes
+	}
+	if sizes == nil {
+		return ""
+	}
+	indent := filedesc.Indentation(indentation)
+	if size := sizes[filedesc.FileID{Dev: pathfd.Dev(), Ino: pathfd.Ino()}]; size > 0 {
+		return fmt.Sprintf("\n%smemory still mapped: %s (closing the fd won't release it)",
+			indent, humanBytes(size))
+	}
+	return fmt.Sprintf("\n%smemory not mapped (closing the fd releases it)", indent)
+}
+
+// backingAnnotation returns an annotation line for a leaked loop device fd or
+// overlayfs file fd, showing the file actually held open. Otherwise, an empty
+// annotation is returned.
+func backingAnnotation(fd FileDescriptor, indentation uint) string {
+	pathfd := pathFdOf(fd)
+	if pathfd == nil {
+		return ""
+	}
+	backing, err := pathfd.BackingFile()
+	if err != nil || backing == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n%sbacking file: %q", filedesc.Indentation(indentation), redactValue(backing))
+}
+
+// blockedAnnotation returns annotation lines for the threads of the process
+// owning the specified leaked fd that are currently blocked in syscalls on
+// this fd, including the topmost frames of their kernel stacks where readable.
+// The blocked threads of the owning processes are cached in blocked. If there
+// are no such threads, an empty annotation is returned.
+func blockedAnnotation(fd FileDescriptor, blocked map[int][]filedesc.BlockedThread, indentation uint) string {
+	pid := pidOf(fd)
+	if pid == 0 {
+		return ""
+	}
+	threads, ok := blocked[pid]
+	if !ok {
+		threads, _ = filedesc.BlockedThreads(pid)
+		blocked[pid] = threads
+	}
+	var out strings.Builder
+	for _, thread := range threads {
+		if thread.FdNo != fd.FdNo() {
+			continue
+		}
+		out.WriteString(fmt.Sprintf("\n%sthread %d is currently blocked on this fd in %s",
+			filedesc.Indentation(indentation), thread.TID, thread.Syscall))
+		if thread.Wchan != "" {
+			out.WriteString(fmt.Sprintf(" (waiting in %s)", thread.Wchan))
+		}
+		for idx, frame := range thread.Stack {
+			if idx == blockedStackFrames {
+				out.WriteString(fmt.Sprintf("\n%s...", filedesc.Indentation(indentation+1)))
+				break
+			}
+			out.WriteString(fmt.Sprintf("\n%s%s", filedesc.Indentation(indentation+1), frame))
+		}
 	}
 	return out.String()
 }
+
+// blockedStackFrames is the maximum number of topmost kernel stack frames shown
+// for a thread blocked on a leaked fd.
+const blockedStackFrames = 4
+
+// changedAnnotation returns annotation lines for a leaked fd that replaced an
+// expected fd of the same process and with the same fd number in the baseline,
+// diffing the expected and leaked fds field by field; see
+// [filedesc.DiffDescription]. Otherwise, an empty annotation is returned.
+func changedAnnotation(fd FileDescriptor, baseline []FileDescriptor, indentation uint) string {
+	idx := slices.IndexFunc(baseline, func(base FileDescriptor) bool {
+		return base.FdNo() == fd.FdNo() && pidOf(base) == pidOf(fd)
+	})
+	if idx < 0 {
+		return ""
+	}
+	diff := filedesc.DiffDescription(baseline[idx], fd)
+	if diff == "" {
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("\n%schanged from expected fd:", filedesc.Indentation(indentation)))
+	for _, line := range strings.Split(redactQuoted(diff), "\n") {
+		out.WriteString("\n" + filedesc.Indentation(indentation+1) + line)
+	}
+	return out.String()
+}
+
+// baselineAnnotation returns annotation lines for a leaked fd with the
+// descriptions of its nearest fds of the same process in the baseline. If
+// there are no such fds, an empty annotation is returned.
+func baselineAnnotation(fd FileDescriptor, baseline []FileDescriptor, indentation uint) string {
+	if len(baseline) == 0 {
+		return ""
+	}
+	var lower, higher FileDescriptor
+	for _, base := range baseline {
+		if pidOf(base) != pidOf(fd) {
+			continue
+		}
+		switch no := base.FdNo(); {
+		case no == fd.FdNo():
+			return fmt.Sprintf("\n%sfd %d existed before as:\n%s",
+				filedesc.Indentation(indentation), no, describeElided(base, indentation+1))
+		case no < fd.FdNo() && (lower == nil || no > lower.FdNo()):
+			lower = base
+		case no > fd.FdNo() && (higher == nil || no < higher.FdNo()):
+			higher = base
+		}
+	}
+	var neighbors []string
+	for _, neighbor := range []FileDescriptor{lower, higher} {
+		if neighbor != nil {
+			neighbors = append(neighbors, describeElided(neighbor, indentation+1))
+		}
+	}
+	if len(neighbors) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n%snearest baseline fds:\n%s",
+		filedesc.Indentation(indentation), strings.Join(neighbors, "\n"))
+}
+
+// netpollerAnnotation returns an annotation line for a leaked fd of the own
+// process belonging to the Go runtime netpoller with the specified fd numbers.
+// Otherwise, an empty annotation is returned.
+func netpollerAnnotation(fd FileDescriptor, netpoller []int, indentation uint) string {
+	if pidOf(fd) != os.Getpid() || !slices.Contains(netpoller, fd.FdNo()) {
+		return ""
+	}
+	return fmt.Sprintf("\n%sGo runtime netpoller (see IgnoringGoRuntimeNetpoller)",
+		filedesc.Indentation(indentation))
+}
+
+// pidOf returns the PID of the process owning the specified fd, or 0 if
+// unknown.
+func pidOf(fd FileDescriptor) int {
+	if owner, ok := fd.(interface{ PID() int }); ok {
+		return owner.PID()
+	}
+	return 0
+}
+
+// pathFdOf returns the PathFd of the specified fd if it is a file or shared
+// memory object, otherwise nil.
+func pathFdOf(fd FileDescriptor) *filedesc.PathFd {
+	switch fd := fd.(type) {
+	case *filedesc.PathFd:
+		return fd
+	case *filedesc.ShmFd:
+		return &fd.PathFd
+	}
+	return nil
+}
+
+// unreclaimableDiskSpace returns the total disk space in bytes allocated to
+// the files referenced by the specified fds that have already been unlinked,
+// such as deleted or temporary files. Files referenced by multiple fds are
+// counted only once.
+func unreclaimableDiskSpace(fds []FileDescriptor) uint64 {
+	type fileID struct{ dev, ino uint64 }
+	seen := map[fileID]struct{}{}
+	var total uint64
+	for _, fd := range fds {
+		pathfd := pathFdOf(fd)
+		if pathfd == nil || !pathfd.Unlinked() {
+			continue
+		}
+		id := fileID{dev: pathfd.Dev(), ino: pathfd.Ino()}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		total += pathfd.DiskUsage()
+	}
+	return total
+}
+
+// diskSpaceSummary returns a summary of the unreclaimable disk space held by
+// the specified fds, such as ", holding ~1.2 GiB of unreclaimable disk space",
+// or "" if there is no such disk space held.
+func diskSpaceSummary(fds []FileDescriptor) string {
+	space := unreclaimableDiskSpace(fds)
+	if space == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", holding ~%s of unreclaimable disk space", humanBytes(space))
+}
+
+// humanBytes returns the specified number of bytes in a human-readable form,
+// using binary units.
+func humanBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
@@ -17,7 +17,11 @@
 package fdooze
 
 import (
+	"os"
+	"os/exec"
+
 	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -46,4 +50,185 @@ var _ = Describe("util", func() {
 			`(?m)^fd 0, flags 0x.* \(.*\)\n\s+path: "/foo0/bar"\nfd 1, flags 0x.* \(.*\)\n\s+path: "/bar1/baz"$`))
 	})
 
+	It("sorts by kind first, without touching the caller's fds", func() {
+		var pipefds [2]int
+		Expect(unix.Pipe2(pipefds[:], unix.O_CLOEXEC)).To(Succeed())
+		defer unix.Close(pipefds[0])
+		defer unix.Close(pipefds[1])
+		pipe, err := filedesc.New(pipefds[0])
+		Expect(err).NotTo(HaveOccurred())
+		filefd, err := unix.Open("util_test.go", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(filefd)
+		pathN, err := filedesc.NewPathFd(filefd, "/proc/self/fd", "/foo")
+		Expect(err).NotTo(HaveOccurred())
+		path0, err := filedesc.NewPathFd(0, "/proc/self/fd", "/bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		fds := []FileDescriptor{pipe, pathN, path0}
+		Expect(dumpFds(fds, 0)).To(MatchRegexp(
+			`(?s)^fd 0, .*path: "/bar"\nfd %d, .*path: "/foo"\nfd %d, .*pipe`, filefd, pipefds[0]))
+		Expect(dumpLeakedFds(fds, fds, nil, reportOptions{}, 0)).To(MatchRegexp(
+			`(?s)^fd 0, .*path: "/bar"\nfd %d, .*path: "/foo"\nfd %d, .*pipe`, filefd, pipefds[0]))
+		Expect(fds).To(HaveExactElements(pipe, pathN, path0))
+	})
+
+	It("optionally shows baseline neighbors of leaked fds", func() {
+		n := func(fd int, link string) FileDescriptor {
+			fdesc, err := filedesc.NewPathFd(fd, "/proc/self/fd", link)
+			Expect(err).WithOffset(1).NotTo(HaveOccurred())
+			return fdesc
+		}
+		filefd, err := unix.Open("util_test.go", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(filefd)
+
+		baseline := []FileDescriptor{n(0, "/a"), n(1, "/b"), n(filefd, "/c")}
+		reused := n(1, "/reused")
+		leaked := n(2, "/leaked")
+		fds := []FileDescriptor{reused, leaked}
+		Expect(dumpLeakedFds(fds, fds, baseline, reportOptions{}, 0)).NotTo(ContainSubstring("baseline"))
+
+		neighbors := reportOptions{}
+		WithBaselineNeighbors()(&neighbors)
+		Expect(dumpLeakedFds(fds, fds, baseline, neighbors, 0)).To(MatchRegexp(
+			`(?m)^\s+fd 1 existed before as:\n\s+fd 1, .*\n\s+path: "/b"$`))
+		Expect(dumpLeakedFds(fds, fds, baseline, neighbors, 0)).To(MatchRegexp(
+			`(?m)^\s+nearest baseline fds:\n\s+fd 1, .*\n\s+path: "/b"\n\s+fd %d, .*\n\s+path: "/c"$`, filefd))
+		Expect(dumpLeakedFds(fds, fds, nil, neighbors, 0)).NotTo(ContainSubstring("baseline"))
+	})
+
+	It("diffs leaked fds against expected fds with the same fd numbers", func() {
+		n := func(fd int, link string) FileDescriptor {
+			fdesc, err := filedesc.NewPathFd(fd, "/proc/self/fd", link)
+			Expect(err).WithOffset(1).NotTo(HaveOccurred())
+			return fdesc
+		}
+		baseline := []FileDescriptor{n(0, "/a"), n(1, "/b")}
+		reused := n(1, "/reused")
+		leaked := n(2, "/leaked")
+		fds := []FileDescriptor{reused, leaked}
+		Expect(dumpLeakedFds(fds, fds, baseline, reportOptions{}, 0)).To(MatchRegexp(
+			`(?m)^fd 1, .*\n.*\n\s+changed from expected fd:\n\s+path: "/b" → "/reused"$`))
+		Expect(changedAnnotation(leaked, baseline, 1)).To(BeEmpty())
+		Expect(changedAnnotation(reused, []FileDescriptor{reused}, 1)).To(BeEmpty())
+	})
+
+	It("optionally shows threads blocked on leaked fds", func() {
+		r, w, err := os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Close()
+		cmd := exec.Command("cat")
+		cmd.Stdin = r
+		Expect(cmd.Start()).To(Succeed())
+		r.Close()
+		DeferCleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+		Eventually(func() ([]filedesc.BlockedThread, error) {
+			return filedesc.BlockedThreads(cmd.Process.Pid)
+		}).Should(ContainElement(HaveField("FdNo", 0)))
+
+		fds, err := filedesc.ProcessFiledescriptors(cmd.Process.Pid)
+		Expect(err).NotTo(HaveOccurred())
+		m := HaveLeakedFds(nil)
+		Expect(m.Match(fds)).To(BeTrue())
+		Expect(m.FailureMessage(fds)).NotTo(ContainSubstring("blocked"))
+
+		m = HaveLeakedFds(nil).Reporting(WithBlockedThreads())
+		Expect(m.Match(fds)).To(BeTrue())
+		Expect(m.FailureMessage(fds)).To(MatchRegexp(
+			`(?m)^\s+fd 0, .*
+(\s+.*
+)*?\s+thread %d is currently blocked on this fd in read`,
+			cmd.Process.Pid))
+
+		var stdin FileDescriptor
+		for _, fd := range fds {
+			if fd.FdNo() == 0 {
+				stdin = fd
+			}
+		}
+		Expect(stdin).NotTo(BeNil())
+		blocked := map[int][]filedesc.BlockedThread{
+			cmd.Process.Pid: {{TID: 42, Syscall: "read", FdNo: 0, Wchan: "pipe_read",
+				Stack: []string{"pipe_read+0x2c/0x40", "vfs_read+0x1/0x2", "ksys_read+0x1/0x2",
+					"do_syscall_64+0x1/0x2", "entry_SYSCALL_64_after_hwframe+0x1/0x2"}}},
+		}
+		Expect(blockedAnnotation(stdin, blocked, 1)).To(Equal(`
+    thread 42 is currently blocked on this fd in read (waiting in pipe_read)
+        pipe_read+0x2c/0x40
+        vfs_read+0x1/0x2
+        ksys_read+0x1/0x2
+        do_syscall_64+0x1/0x2
+        ...`))
+	})
+
+	It("dumps more severe leaks first", func() {
+		idlefd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(idlefd)
+		armedfd, err := unix.Eventfd(42, unix.EFD_CLOEXEC)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(armedfd)
+
+		idle, err := filedesc.New(idlefd)
+		Expect(err).NotTo(HaveOccurred())
+		armed, err := filedesc.New(armedfd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leakSeverity(idle)).To(Equal(severityNormal))
+		Expect(leakSeverity(armed)).To(Equal(severityHigh))
+
+		fds := []FileDescriptor{idle, armed}
+		Expect(dumpLeakedFds(fds, fds, nil, reportOptions{}, 0)).To(MatchRegexp(
+			`(?s)^fd %d, .*armed: will fire or wake up waiters\n.*\nfd %d, `, armedfd, idlefd))
+	})
+
+	It("annotates leaked shared memory with its mapping state", func() {
+		shm, err := os.CreateTemp("/dev/shm", "fdooze-*")
+		if err != nil {
+			Skip("needs /dev/shm")
+		}
+		defer os.Remove(shm.Name())
+		defer shm.Close()
+		shmfd := int(shm.Fd())
+		Expect(unix.Ftruncate(shmfd, 2*1024*1024)).To(Succeed())
+
+		fd, err := filedesc.New(shmfd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fd.(*filedesc.ShmFd).SharedMemory()).To(BeTrue())
+		fds := []FileDescriptor{fd}
+		Expect(dumpLeakedFds(fds, fds, nil, reportOptions{}, 0)).To(HaveSuffix(
+			"\n    memory not mapped (closing the fd releases it)"))
+
+		mem, err := unix.Mmap(shmfd, 0, 2*1024*1024, unix.PROT_READ, unix.MAP_SHARED)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = unix.Munmap(mem) }()
+		Expect(dumpLeakedFds(fds, fds, nil, reportOptions{}, 0)).To(HaveSuffix(
+			"\n    memory still mapped: 2.0 MiB (closing the fd won't release it)"))
+
+		pathfd, err := filedesc.NewPathFd(0, "/proc/self/fd", "/foo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mappingAnnotation(pathfd, nil, 0)).To(BeEmpty())
+	})
+
+	It("annotates only fds with backing files", func() {
+		f, err := os.Open("util_test.go")
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+		fd, err := filedesc.New(int(f.Fd()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backingAnnotation(fd, 1)).To(BeEmpty())
+		Expect(backingAnnotation(&filedesc.NamespaceFd{}, 1)).To(BeEmpty())
+	})
+
+	It("formats bytes for humans", func() {
+		Expect(humanBytes(0)).To(Equal("0 B"))
+		Expect(humanBytes(1023)).To(Equal("1023 B"))
+		Expect(humanBytes(1024)).To(Equal("1.0 KiB"))
+		Expect(humanBytes(1288490189)).To(Equal("1.2 GiB"))
+		Expect(humanBytes(1 << 62)).To(Equal("4096.0 PiB"))
+	})
+
 })
@@ -0,0 +1,104 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"fmt"
+
+	"github.com/onsi/gomega/types"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// InotifyWatches returns the total number of inotify watches across all
+// inotify file descriptors in the specified list of file descriptors.
+func InotifyWatches(fds []FileDescriptor) int {
+	watches := 0
+	for _, fd := range fds {
+		if inotify, ok := fd.(*filedesc.InotifyFd); ok {
+			watches += len(inotify.Watches())
+		}
+	}
+	return watches
+}
+
+// HaveInotifyWatchesWithin succeeds if the total number of inotify watches
+// across all inotify file descriptors in the actual list of file descriptors
+// doesn't exceed the specified budget. Inotify watches are a scarce resource,
+// limited per user by the fs.inotify.max_user_watches sysctl, so leaking
+// watches can be as harmful as leaking the inotify fds themselves.
+//
+//	Expect(Filedescriptors()).To(HaveInotifyWatchesWithin(100))
+func HaveInotifyWatchesWithin(budget int) types.GomegaMatcher {
+	return &inotifyWatchesMatcher{
+		name:   "HaveInotifyWatchesWithin",
+		budget: func() (int, error) { return budget, nil },
+	}
+}
+
+// HaveInotifyWatchHeadroom succeeds if the total number of inotify watches
+// across all inotify file descriptors in the actual list of file descriptors
+// leaves at least the specified headroom of watches below the system's
+// fs.inotify.max_user_watches limit.
+//
+// Please note that the limit applies to all processes of the same user, so
+// other processes might already eat into the headroom.
+func HaveInotifyWatchHeadroom(headroom int) types.GomegaMatcher {
+	return &inotifyWatchesMatcher{
+		name: "HaveInotifyWatchHeadroom",
+		budget: func() (int, error) {
+			limit, err := filedesc.InotifyMaxUserWatches()
+			if err != nil {
+				return 0, fmt.Errorf("HaveInotifyWatchHeadroom cannot determine max_user_watches: %w", err)
+			}
+			return limit - headroom, nil
+		},
+	}
+}
+
+type inotifyWatchesMatcher struct {
+	name    string
+	budget  func() (int, error)
+	limit   int // the budget determined when matching
+	watches int // the total number of watches when matching
+}
+
+func (matcher *inotifyWatchesMatcher) Match(actual interface{}) (success bool, err error) {
+	fds, err := toFds(actual, matcher.name)
+	if err != nil {
+		return false, err
+	}
+	matcher.limit, err = matcher.budget()
+	if err != nil {
+		return false, err
+	}
+	matcher.watches = InotifyWatches(fds)
+	return matcher.watches <= matcher.limit, nil
+}
+
+// FailureMessage returns a failure message if the inotify watches exceed the
+// budget.
+func (matcher *inotifyWatchesMatcher) FailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected at most %d inotify watches, but found %d",
+		matcher.limit, matcher.watches)
+}
+
+// NegatedFailureMessage returns a negated failure message if the inotify
+// watches stay within the budget.
+func (matcher *inotifyWatchesMatcher) NegatedFailureMessage(actual interface{}) (message string) {
+	return fmt.Sprintf("Expected more than %d inotify watches, but found %d",
+		matcher.limit, matcher.watches)
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("inotify watch budget", func() {
+
+	It("rejects invalid actual values", func() {
+		Expect(HaveInotifyWatchesWithin(1).Match(42)).Error().To(HaveOccurred())
+	})
+
+	It("sums up inotify watches", func() {
+		fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+		Expect(err).NotTo(HaveOccurred())
+		defer unix.Close(fd)
+		for _, dir := range []string{GinkgoT().TempDir(), GinkgoT().TempDir(), GinkgoT().TempDir()} {
+			_, err := unix.InotifyAddWatch(fd, dir, unix.IN_CREATE)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		fds := Filedescriptors()
+		Expect(InotifyWatches(fds)).To(BeNumerically(">=", 3))
+		Expect(fds).To(HaveInotifyWatchesWithin(InotifyWatches(fds)))
+
+		m := HaveInotifyWatchesWithin(2)
+		Expect(m.Match(fds)).To(BeFalse())
+		Expect(m.FailureMessage(fds)).To(MatchRegexp(`^Expected at most 2 inotify watches, but found \d+$`))
+		Expect(m.NegatedFailureMessage(fds)).To(MatchRegexp(`^Expected more than 2 inotify watches, but found \d+$`))
+	})
+
+	It("checks the headroom", func() {
+		Expect(Filedescriptors()).To(HaveInotifyWatchHeadroom(1))
+		Expect(Filedescriptors()).NotTo(HaveInotifyWatchHeadroom(1 << 40))
+	})
+
+})
@@ -0,0 +1,135 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/onsi/gomega"
+	"github.com/thediveo/fdooze/filedesc"
+)
+
+// FdCeilingError is the cause of a [Watchdog] context getting cancelled when
+// the watched process exceeded its hard fd ceiling.
+type FdCeilingError struct {
+	PID     int // PID of the watched process.
+	Ceiling int // hard ceiling of open fds.
+	Count   int // count of open fds exceeding the ceiling.
+}
+
+// Error returns a description of the exceeded fd ceiling.
+func (e *FdCeilingError) Error() string {
+	return fmt.Sprintf("process %d has %d open file descriptors, exceeding the hard ceiling of %d",
+		e.PID, e.Count, e.Ceiling)
+}
+
+// Watchdog watches the number of open file descriptors of a process during the
+// execution of a test, failing fast when the fd count explodes, instead of
+// waiting for the test to time out after exhausting RLIMIT_NOFILE. Counting the
+// open fds is cheap, see [filedesc.CountFds], so the watchdog can poll in short
+// intervals.
+//
+//	wd := StartWatchdog(ctx, os.Getpid(), 1000, 10*time.Millisecond, nil)
+//	defer wd.Stop()
+//	client.HammerAPI(wd.Context())
+//	Expect(wd.Stop()).To(Succeed())
+//
+// See also [github.com/thediveo/fdooze/suite.Watchdog] for failing Ginkgo
+// specs immediately.
+type Watchdog struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+	once   sync.Once
+	mu     sync.Mutex
+	err    error
+}
+
+// StartWatchdog starts a new Watchdog for the process identified by pid with
+// the specified hard ceiling of open fds, polling the fd count in the
+// specified interval using Gomega's Eventually. When the process exceeds the ceiling,
+// the watchdog calls the optional onExceeded function, cancels its context
+// with an [*FdCeilingError] cause, and then stops watching. The watchdog also
+// stops when the specified context is done or the process' fd table cannot be
+// read anymore, such as when the process has terminated.
+func StartWatchdog(ctx context.Context, pid int, ceiling int, interval time.Duration, onExceeded func(err *FdCeilingError)) *Watchdog {
+	wctx, cancel := context.WithCancelCause(ctx)
+	w := &Watchdog{
+		ctx:    wctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.watch(pid, ceiling, interval, onExceeded)
+	return w
+}
+
+// watch polls the count of open fds of the process identified by pid until
+// the ceiling has been exceeded, the fd table cannot be read anymore, or the
+// watchdog's context is done.
+func (w *Watchdog) watch(pid int, ceiling int, interval time.Duration, onExceeded func(err *FdCeilingError)) {
+	defer close(w.done)
+	var count int
+	g := gomega.NewGomega(func(string, ...int) {}) // not exceeding isn't a failure.
+	exceeded := g.Eventually(w.ctx, func() (int, error) {
+		var err error
+		count, err = filedesc.CountFds(pid)
+		if err != nil {
+			return 0, gomega.StopTrying("cannot read fd table").Wrap(err)
+		}
+		return count, nil
+	}).WithTimeout(math.MaxInt64).WithPolling(interval).Should(gomega.BeNumerically(">", ceiling))
+	if !exceeded {
+		return
+	}
+	ceilingErr := &FdCeilingError{PID: pid, Ceiling: ceiling, Count: count}
+	w.mu.Lock()
+	w.err = ceilingErr
+	w.mu.Unlock()
+	if onExceeded != nil {
+		onExceeded(ceilingErr)
+	}
+	w.cancel(ceilingErr)
+}
+
+// Context returns the context of the watchdog that gets cancelled with an
+// [*FdCeilingError] cause when the watched process exceeds the ceiling, so
+// that the test code can abort early. The context also gets cancelled when
+// stopping the watchdog.
+func (w *Watchdog) Context() context.Context {
+	return w.ctx
+}
+
+// Err returns an [*FdCeilingError] if the watched process exceeded the
+// ceiling, otherwise nil.
+func (w *Watchdog) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Stop stops the watchdog, waiting for it to finish, and then returns an
+// [*FdCeilingError] if the watched process exceeded the ceiling, otherwise
+// nil. Stop can be called multiple times.
+func (w *Watchdog) Stop() error {
+	w.once.Do(func() { w.cancel(context.Canceled) })
+	<-w.done
+	return w.Err()
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/thediveo/fdooze/filedesc"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/thediveo/success"
+)
+
+var _ = Describe("fd watchdog", func() {
+
+	const interval = 10 * time.Millisecond
+
+	It("keeps quiet below the ceiling", func() {
+		count := Successful(filedesc.CountFds(os.Getpid()))
+		wd := StartWatchdog(context.Background(), os.Getpid(), count+100, interval, nil)
+		Consistently(wd.Context().Done()).WithTimeout(5 * interval).ShouldNot(BeClosed())
+		Expect(wd.Stop()).To(Succeed())
+		Expect(wd.Stop()).To(Succeed())
+		Expect(context.Cause(wd.Context())).To(MatchError(context.Canceled))
+	})
+
+	It("fails fast when exceeding the ceiling", func() {
+		count := Successful(filedesc.CountFds(os.Getpid()))
+		exceeded := make(chan *FdCeilingError, 1)
+		wd := StartWatchdog(context.Background(), os.Getpid(), count+2, interval, func(err *FdCeilingError) {
+			exceeded <- err
+		})
+		defer func() { _ = wd.Stop() }()
+
+		var fds []int
+		defer func() {
+			for _, fd := range fds {
+				_ = unix.Close(fd)
+			}
+		}()
+		for range 5 {
+			fds = append(fds, Successful(unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM, 0)))
+		}
+
+		Eventually(wd.Context().Done()).Within(time.Second).Should(BeClosed())
+		var ceilingErr *FdCeilingError
+		Expect(context.Cause(wd.Context())).To(BeAssignableToTypeOf(ceilingErr))
+		Expect(exceeded).To(Receive(And(
+			HaveField("PID", os.Getpid()),
+			HaveField("Ceiling", count+2),
+			HaveField("Count", BeNumerically(">", count+2)))))
+		Expect(wd.Stop()).To(MatchError(MatchRegexp(
+			`^process \d+ has \d+ open file descriptors, exceeding the hard ceiling of \d+$`)))
+	})
+
+	It("stops when the process is gone", func() {
+		wd := StartWatchdog(context.Background(), -1, 0, interval, nil)
+		Eventually(wd.done).Within(time.Second).Should(BeClosed())
+		Expect(wd.Stop()).To(Succeed())
+	})
+
+})
@@ -0,0 +1,102 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/onsi/gomega/format"
+)
+
+// DescriptionWidth limits the width in characters of the lines of file
+// descriptor descriptions in failure messages. Overlong quoted values, such as
+// long paths and unix socket names, get elided in their middle, keeping their
+// beginnings and ends. Leak reports always contain the full descriptions, see
+// [NewLeakReport].
+//
+// Eliding is disabled when DescriptionWidth is zero or negative, as well as when
+// Gomega's format.MaxLength is zero, that is, when Gomega has been told not to
+// truncate its output.
+var DescriptionWidth = 120
+
+// ellipsis replaces the elided middle part of an overlong value.
+const ellipsis = "…"
+
+// minElidedLen is the minimum number of characters of an elided value to keep
+// besides the ellipsis.
+const minElidedLen = 8
+
+// describeElided returns the description of the specified fd with its values
+// redacted (see [Redact]) and overlong lines elided to [DescriptionWidth].
+func describeElided(fd FileDescriptor, indentation uint) string {
+	return elideDescription(redactQuoted(describe(fd, indentation)))
+}
+
+// elideDescription returns the specified (multi-line) description with the
+// longest quoted value in each overlong line elided in its middle, so that the
+// line fits [DescriptionWidth] if possible.
+func elideDescription(desc string) string {
+	if DescriptionWidth <= 0 || format.MaxLength == 0 {
+		return desc
+	}
+	lines := strings.Split(desc, "\n")
+	for idx, line := range lines {
+		lines[idx] = elideLine(line, DescriptionWidth)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// elideLine returns the specified line with its longest quoted value elided
+// in its middle, if the line exceeds the specified width.
+func elideLine(line string, width int) string {
+	excess := utf8.RuneCountInString(line) - width
+	if excess <= 0 {
+		return line
+	}
+	// Find the longest quoted value in this line.
+	start, end := -1, -1
+	for pos := 0; pos < len(line); pos++ {
+		if line[pos] != '"' {
+			continue
+		}
+		quoted, err := strconv.QuotedPrefix(line[pos:])
+		if err != nil {
+			continue
+		}
+		if len(quoted) > end-start {
+			start, end = pos, pos+len(quoted)
+		}
+		pos += len(quoted) - 1
+	}
+	if start < 0 {
+		return line
+	}
+	value, err := strconv.Unquote(line[start:end])
+	if err != nil {
+		return line
+	}
+	runes := []rune(value)
+	keep := max(len(runes)-excess-utf8.RuneCountInString(ellipsis), minElidedLen)
+	if keep >= len(runes) {
+		return line
+	}
+	head := (keep + 1) / 2
+	elided := string(runes[:head]) + ellipsis + string(runes[len(runes)-(keep-head):])
+	return line[:start] + strconv.Quote(elided) + line[end:]
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Harald Albrecht.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy
+// of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package fdooze
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/gomega/format"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("description width", func() {
+
+	It("elides overlong quoted values in their middle", func() {
+		Expect(elideLine(`path: "/foo/bar"`, 20)).To(Equal(`path: "/foo/bar"`))
+		Expect(elideLine(`path: "/0123456789/abcdefghij/foo.go"`, 30)).To(Equal(
+			`path: "/0123456789…hij/foo.go"`))
+		Expect(elideLine(`local "a" peer "/0123456789/abcdefghij"`, 30)).To(Equal(
+			`local "a" peer "/01234…efghij"`))
+		Expect(elideLine(`no quoted values here, just a long line`, 10)).To(Equal(
+			`no quoted values here, just a long line`))
+		Expect(elideLine(`"/0123456789/abcdefghij"`, 2)).To(Equal(`"/012…ghij"`))
+	})
+
+	It("elides overlong lines only in failure messages", Serial, func() {
+		oldWidth, oldMaxLength := DescriptionWidth, format.MaxLength
+		DeferCleanup(func() { DescriptionWidth, format.MaxLength = oldWidth, oldMaxLength })
+		DescriptionWidth = 60
+
+		goodfds := Filedescriptors()
+		dir := filepath.Join(GinkgoT().TempDir(), strings.Repeat("x", 100))
+		Expect(os.Mkdir(dir, 0700)).To(Succeed())
+		f, err := os.Create(filepath.Join(dir, "leaked"))
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		m := HaveLeakedFds(goodfds)
+		Expect(m.Match(Filedescriptors())).To(BeTrue())
+		Expect(m.FailureMessage(nil)).To(MatchRegexp(`(?m)^\s+path: ".*…x+/leaked"$`))
+		for _, line := range strings.Split(m.FailureMessage(nil), "\n") {
+			if strings.Contains(line, "path:") {
+				Expect(len([]rune(line))).To(BeNumerically("<=", DescriptionWidth))
+			}
+		}
+
+		report, err := NewLeakReport(Filedescriptors(), goodfds)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Leaks).To(ConsistOf(HaveField("Description", ContainSubstring(f.Name()))))
+
+		format.MaxLength = 0
+		Expect(m.FailureMessage(nil)).To(ContainSubstring(f.Name()))
+		format.MaxLength = oldMaxLength
+		DescriptionWidth = 0
+		Expect(m.FailureMessage(nil)).To(ContainSubstring(f.Name()))
+	})
+
+})